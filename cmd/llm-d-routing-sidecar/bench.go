@@ -0,0 +1,76 @@
+/*
+Copyright 2025 The llm-d Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/llm-d/llm-d-routing-sidecar/internal/proxy"
+	"github.com/llm-d/llm-d-routing-sidecar/internal/signals"
+)
+
+// benchCommand is the subcommand measuring the overhead of the sidecar
+const benchCommand = "bench"
+
+// runBench runs the bench subcommand with the given arguments and returns its exit code. It
+// fails when the p99 latency or the allocations of a connector exceed the given maximums, so it
+// can gate regressions of the request body handling.
+func runBench(args []string, stdout io.Writer) int {
+	fs := flag.NewFlagSet(benchCommand, flag.ContinueOnError)
+	connectors := fs.String("connectors", strings.Join([]string{proxy.BenchPassthrough, proxy.ConnectorNIXLV1, proxy.ConnectorNIXLV2, proxy.ConnectorLMCache}, ","), "comma-separated list of the benchmarked connectors, and passthrough for the requests without prefiller header")
+	requests := fs.Int("requests", 10000, "the number of measured requests per connector, after as many warmup requests")
+	promptBytes := fs.Int("prompt-bytes", 16<<10, "the size of the prompt of the requests")
+	maxP99 := fs.Duration("max-p99", 0, "fail when the p99 overhead latency of a connector exceeds this duration (0 disables the check)")
+	maxAllocs := fs.Uint64("max-allocs", 0, "fail when the allocations per request of a connector exceed this number (0 disables the check)")
+	if err := fs.Parse(args); err != nil {
+		return exitInvalidConfig
+	}
+
+	ctx := signals.SetupSignalHandler(context.Background())
+	results, err := proxy.Bench(ctx, proxy.BenchConfig{
+		Connectors:  strings.Split(*connectors, ","),
+		Requests:    *requests,
+		PromptBytes: *promptBytes,
+	})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: bench failed: %v\n", err)
+		return exitFailure
+	}
+
+	passed := true
+	w := tabwriter.NewWriter(stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "CONNECTOR\tREQUESTS\tERRORS\tMEAN\tP50\tP99\tALLOCS/REQ\tBYTES/REQ")
+	for _, r := range results {
+		fmt.Fprintf(w, "%s\t%d\t%d\t%s\t%s\t%s\t%d\t%d\n", r.Connector, r.Requests, r.Errors, r.Mean, r.P50, r.P99, r.AllocsPerRequest, r.BytesPerRequest)
+		passed = passed && r.Errors == 0 &&
+			(*maxP99 == 0 || r.P99 <= *maxP99) &&
+			(*maxAllocs == 0 || r.AllocsPerRequest <= *maxAllocs)
+	}
+	w.Flush() //nolint:all
+
+	if !passed {
+		fmt.Fprintln(os.Stderr, "Error: bench failed: errors, or p99 latency or allocations beyond the maximums")
+		return exitFailure
+	}
+	return 0
+}
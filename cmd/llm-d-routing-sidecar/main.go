@@ -17,93 +17,468 @@ package main
 
 import (
 	"context"
+	"errors"
 	"flag"
-	"net/url"
+	"fmt"
+	"io"
+	"net"
 	"os"
+	"slices"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
 
+	"github.com/spiffe/go-spiffe/v2/workloadapi"
 	"k8s.io/klog/v2"
 
+	"github.com/llm-d/llm-d-routing-sidecar/internal/activation"
+	"github.com/llm-d/llm-d-routing-sidecar/internal/audit"
+	"github.com/llm-d/llm-d-routing-sidecar/internal/identity"
+	"github.com/llm-d/llm-d-routing-sidecar/internal/kvevents"
+	"github.com/llm-d/llm-d-routing-sidecar/internal/logging"
+	"github.com/llm-d/llm-d-routing-sidecar/internal/metrics"
+	"github.com/llm-d/llm-d-routing-sidecar/internal/profiling"
 	"github.com/llm-d/llm-d-routing-sidecar/internal/proxy"
 	"github.com/llm-d/llm-d-routing-sidecar/internal/signals"
+	"github.com/llm-d/llm-d-routing-sidecar/pkg/config"
+	"github.com/llm-d/llm-d-routing-sidecar/pkg/middleware"
 )
 
+// spiffeSourceTimeout is how long to wait for the first SVID from the SPIFFE Workload API
+const spiffeSourceTimeout = 30 * time.Second
+
+// Exit codes of the sidecar, so restart policies tell failures from clean exits
+const (
+	exitFailure       = 1 // failed to start or to serve, or self-test failed
+	exitInvalidConfig = 2 // invalid flags, environment variables or configuration file
+)
+
+// adminListenerName is the name of the inherited listener serving the admin endpoints
+const adminListenerName = "admin"
+
+// errSelfTestFailed reports a failed self-test
+var errSelfTestFailed = errors.New("self-test failed")
+
 func main() {
-	port := flag.String("port", "8000", "the port the sidecar is listening on")
-	vLLMPort := flag.String("vllm-port", "8001", "the port vLLM is listening on")
-	connector := flag.String("connector", "nixlv2", "the P/D connector being used. Either nixl, nixlv2 or lmcache")
-	prefillerUseTLS := flag.Bool("prefiller-use-tls", false, "whether to use TLS when sending requests to prefillers")
-	decoderUseTLS := flag.Bool("decoder-use-tls", false, "whether to use TLS when sending requests to the decoder")
-	prefillerInsecureSkipVerify := flag.Bool("prefiller-tls-insecure-skip-verify", false, "configures the proxy to skip TLS verification for requests to prefiller")
-	decoderInsecureSkipVerify := flag.Bool("decoder-tls-insecure-skip-verify", false, "configures the proxy to skip TLS verification for requests to decoder")
-	secureProxy := flag.Bool("secure-proxy", true, "Enables secure proxy. Defaults to true.")
-	certPath := flag.String(
-		"cert-path", "", "The path to the certificate for secure proxy. The certificate and private key files "+
-			"are assumed to be named tls.crt and tls.key, respectively. If not set, and secureProxy is enabled, "+
-			"then a self-signed certificate is used (for testing).")
-	enableSSRFProtection := flag.Bool("enable-ssrf-protection", false, "enable SSRF protection using InferencePool allowlisting")
-	inferencePoolNamespace := flag.String("inference-pool-namespace", os.Getenv("INFERENCE_POOL_NAMESPACE"), "the Kubernetes namespace to watch for InferencePool resources (defaults to INFERENCE_POOL_NAMESPACE env var)")
-	inferencePoolName := flag.String("inference-pool-name", os.Getenv("INFERENCE_POOL_NAME"), "the specific InferencePool name to watch (defaults to INFERENCE_POOL_NAME env var)")
+	if len(os.Args) > 1 && os.Args[1] == benchCommand {
+		os.Exit(runBench(os.Args[2:], os.Stdout))
+	}
 
 	klog.InitFlags(nil)
-	flag.Parse()
-
-	// make sure to flush logs before exiting
-	defer klog.Flush()
+	cfg, settings, err := config.LoadSettings(flag.CommandLine, os.Args[1:], os.LookupEnv)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: invalid configuration: %v\n", err)
+		os.Exit(exitInvalidConfig)
+	}
+	if cfg.LogFormat == logging.FormatJSON {
+		// also called directly by the contextual loggers, instead of through klog
+		klog.SetLoggerWithOptions(logging.NewJSON(os.Stderr, verbosity(flag.CommandLine)), klog.ContextualLogger(true))
+	}
 
 	ctx := signals.SetupSignalHandler(context.Background())
-	logger := klog.FromContext(ctx)
+	err = run(ctx, cfg, settings)
+	if err != nil {
+		klog.FromContext(ctx).Error(err, "exiting")
+	}
 
-	if *connector != proxy.ConnectorNIXLV1 && *connector != proxy.ConnectorNIXLV2 && *connector != proxy.ConnectorLMCache {
-		logger.Info("Error: --connector must either be 'nixl', 'nixlv2' or 'lmcache'")
-		return
+	// make sure to flush logs before exiting
+	klog.Flush()
+	if err != nil {
+		os.Exit(exitFailure)
 	}
-	if *connector == proxy.ConnectorNIXLV1 {
+}
+
+// run starts the sidecar and serves until ctx is done, or fails with the first error of its servers
+func run(ctx context.Context, cfg *config.Config, settings []config.Setting) error {
+	id := identity.FromEnv(os.LookupEnv, cfg.InferencePoolName)
+	logger := logging.Redact(logging.Deduplicate(klog.FromContext(ctx), cfg.LogDedupWindow), cfg.LogRedactFields).WithValues(id.LogValues()...)
+	ctx = klog.NewContext(ctx, logger)
+
+	// the effective configuration, to diagnose the configuration drifts of a fleet
+	var effective atomic.Pointer[[]config.Setting]
+	effective.Store(&settings)
+	logger.Info("effective configuration", "settings", settings)
+
+	if cfg.Connector == proxy.ConnectorNIXLV1 {
 		logger.Info("Warning: nixl connector is deprecated and will be removed in a future release in favor of --connector=nixlv2")
 	}
-	logger.Info("p/d connector validated", "connector", connector)
+	logger.Info("p/d connector validated", "connector", cfg.Connector)
+	for _, name := range cfg.DisabledFeatureFlags() {
+		logger.Info("Warning: flag ignored, its feature is disabled by --feature-gates", "flag", name)
+	}
 
-	// Determine namespace and pool name for SSRF protection
-	if *enableSSRFProtection {
-		if *inferencePoolNamespace == "" {
-			logger.Info("Error: --inference-pool-namespace or INFERENCE_POOL_NAMESPACE environment variable is required when --enable-ssrf-protection is true")
-			return
+	if cfg.EnableSSRFProtection {
+		logger.Info("SSRF protection enabled", "namespace", cfg.InferencePoolNamespace, "poolName", cfg.InferencePoolName, "strict", cfg.SSRFStrict)
+	}
+	for _, pool := range cfg.Pools {
+		logger.Info("virtual pool configured", "pool", pool.Name, "port", pool.Port, "connector", pool.Connector,
+			"namespace", pool.InferencePoolNamespace, "poolName", pool.InferencePoolName)
+	}
+	if cfg.PrefillOverrides != nil {
+		logger.Info("prefill overrides configured", "overrides", cfg.PrefillOverrides)
+	}
+	metrics.ConfigureLabels(cfg.MetricsLabelConfig())
+
+	var spiffeSource *workloadapi.X509Source
+	if cfg.SPIFFEEndpointSocket != "" {
+		sourceCtx, cancelFn := context.WithTimeout(ctx, spiffeSourceTimeout)
+		var err error
+		spiffeSource, err = workloadapi.NewX509Source(sourceCtx,
+			workloadapi.WithClientOptions(workloadapi.WithAddr(cfg.SPIFFEEndpointSocket)))
+		cancelFn()
+		if err != nil {
+			return fmt.Errorf("failed to fetch the SVID from the SPIFFE Workload API at %s: %w", cfg.SPIFFEEndpointSocket, err)
+		}
+		defer spiffeSource.Close() //nolint:all
+		logger.Info("mTLS identities sourced from the SPIFFE Workload API", "socket", cfg.SPIFFEEndpointSocket)
+	}
+
+	var auditLog *audit.Log
+	if cfg.SSRFAuditLog != "" {
+		var err error
+		auditLog, err = audit.Open(cfg.SSRFAuditLog)
+		if err != nil {
+			return fmt.Errorf("failed to open the SSRF audit log: %w", err)
+		}
+		defer auditLog.Close() //nolint:all
+		logger.Info("auditing SSRF protection decisions", "path", cfg.SSRFAuditLog, "allowed", cfg.SSRFAuditAllowed)
+	}
+
+	// start reverse proxy HTTP server
+	proxyConfig := newProxyConfig(cfg, spiffeSource)
+	proxyConfig.SSRFAuditLog = auditLog
+	if cfg.CallerTokenAudience != "" {
+		reviewer, err := proxy.NewTokenReviewer()
+		if err != nil {
+			return err
+		}
+		proxyConfig.CallerTokenReviewer = reviewer
+		logger.Info("authenticating the callers of the prefill requests", "audience", cfg.CallerTokenAudience, "subjects", cfg.CallerAuthorizedSubjects)
+	}
+	if cfg.CallerHMACKeyFile != "" {
+		logger.Info("verifying the signatures of the prefill requests", "keyFile", cfg.CallerHMACKeyFile)
+	}
+
+	// listeners inherited from a supervising process replace the listening ports, those named
+	// after a virtual pool serving the pool
+	inherited, err := activation.Listeners()
+	if err != nil {
+		return fmt.Errorf("failed to inherit listeners: %w", err)
+	}
+	pools := append([]config.Pool{{Port: cfg.Port}}, cfg.Pools...)
+	proxyListeners := map[string][]net.Listener{}
+	var adminListener net.Listener
+	for _, ln := range inherited {
+		switch {
+		case ln.Name == adminListenerName:
+			adminListener = ln
+		case slices.ContainsFunc(cfg.Pools, func(pool config.Pool) bool { return pool.Name == ln.Name }):
+			proxyListeners[ln.Name] = append(proxyListeners[ln.Name], ln)
+		default:
+			proxyListeners[""] = append(proxyListeners[""], ln)
+		}
+	}
+	for _, pool := range pools {
+		if n := len(proxyListeners[pool.Name]); n > 0 && n != cfg.DataParallelSize {
+			return fmt.Errorf("inherited %d proxy listeners of the %s for %d data parallel ranks", n, poolName(pool), cfg.DataParallelSize)
+		}
+	}
+	if len(inherited) > 0 {
+		logger.Info("serving inherited listeners", "proxy", len(proxyListeners[""]), "admin", adminListener != nil)
+		for _, pool := range cfg.Pools {
+			if n := len(proxyListeners[pool.Name]); n > 0 {
+				logger.Info("serving inherited listeners", "pool", pool.Name, "proxy", n)
+			}
+		}
+	}
+
+	// one proxy per data parallel rank of each pool, the main pool first
+	proxyServers := make([]*proxy.Server, 0, len(pools)*cfg.DataParallelSize)
+	for _, pool := range pools {
+		poolServers := make([]*proxy.Server, 0, cfg.DataParallelSize)
+		for rank := range cfg.DataParallelSize {
+			rankPort, err := offsetPort(pool.Port, rank)
+			if err != nil {
+				return fmt.Errorf("invalid port: %w", err)
+			}
+			targetURL, err := cfg.DecoderTarget(rank)
+			if err != nil {
+				return fmt.Errorf("failed to create the decoder URL of rank %d: %w", rank, err)
+			}
+
+			rankConfig, err := newRankConfig(cfg, proxyConfig, pool, rank)
+			if err != nil {
+				return err
+			}
+			if listeners := proxyListeners[pool.Name]; listeners != nil {
+				rankConfig.Listener = listeners[rank]
+			}
+			proxyServer, err := proxy.NewProxy(rankPort, targetURL, rankConfig)
+			if err != nil {
+				return fmt.Errorf("failed to create the proxy of rank %d: %w", rank, err)
+			}
+			poolServers = append(poolServers, proxyServer)
+		}
+		proxy.LinkDataParallelRanks(poolServers...)
+		proxyServers = append(proxyServers, poolServers...)
+	}
+
+	if cfg.SelfTestPrefiller != "" {
+		passed := true
+		for _, proxyServer := range proxyServers {
+			passed = runSelfTest(ctx, proxyServer, cfg.SelfTestPrefiller, cfg.SelfTestModel) && passed
+		}
+		if !passed {
+			return errSelfTestFailed
+		}
+		return nil
+	}
+
+	// the first server failing stops the others
+	ctx, cancelFn := context.WithCancel(ctx)
+	defer cancelFn()
+	var wg sync.WaitGroup
+	errs := make(chan error, len(proxyServers)+1)
+
+	// dump the runtime state on SIGQUIT
+	signals.SetupDumpHandler(ctx, func() {
+		for _, proxyServer := range proxyServers {
+			proxyServer.LogState(logger)
 		}
-		if *inferencePoolName == "" {
-			logger.Info("Error: --inference-pool-name or INFERENCE_POOL_NAME environment variable is required when --enable-ssrf-protection is true")
+	})
+
+	// reload the routing settings on SIGHUP
+	signals.SetupReloadHandler(ctx, func() {
+		settings, err := reload(proxyServers, pools, spiffeSource)
+		if err != nil {
+			logger.Error(err, "failed to reload the configuration, keeping the previous one")
 			return
 		}
+		effective.Store(&settings)
+		logger.Info("effective configuration reloaded", "settings", settings)
+	})
 
-		logger.Info("SSRF protection enabled", "namespace", inferencePoolNamespace, "poolName", inferencePoolName)
+	if cfg.AdminPort != "" || adminListener != nil {
+		adminConfig := proxy.AdminConfig{
+			MergeDecoderMetrics: cfg.MergeDecoderMetrics,
+			BindAddresses:       cfg.AdminBindAddresses,
+			Listener:            adminListener,
+			Configuration:       func() any { return *effective.Load() },
+		}
+		if cfg.MetricsIdentityLabels {
+			adminConfig.MetricsLabels = id.Labels()
+		}
+		adminServer := proxy.NewAdminServer(cfg.AdminPort, adminConfig, proxyServers...)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := adminServer.Start(ctx); err != nil {
+				errs <- fmt.Errorf("admin server failed: %w", err)
+				cancelFn()
+			}
+		}()
 	}
 
-	// start reverse proxy HTTP server
-	scheme := "http"
-	if *decoderUseTLS {
-		scheme = "https"
+	if cfg.ProfilingServerAddress != "" {
+		stop, err := profiling.Start(logger, profiling.Config{
+			ServerAddress:     cfg.ProfilingServerAddress,
+			ApplicationName:   cfg.ProfilingApplicationName,
+			Tags:              map[string]string{"connector": cfg.Connector},
+			BasicAuthUser:     cfg.ProfilingBasicAuthUser,
+			BasicAuthPassword: cfg.ProfilingBasicAuthPassword,
+			TenantID:          cfg.ProfilingTenantID,
+			UploadRate:        cfg.ProfilingUploadRate,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to start profiler: %w", err)
+		}
+		defer func() {
+			if err := stop(); err != nil {
+				logger.Error(err, "failed to stop profiler")
+			}
+		}()
+		logger.Info("pushing profiles", "serverAddress", cfg.ProfilingServerAddress, "uploadRate", cfg.ProfilingUploadRate)
+	}
+
+	if cfg.OTLPMetricsEndpoint != "" {
+		shutdown, err := metrics.StartOTLPExporter(ctx, metrics.OTLPConfig{
+			Endpoint:      cfg.OTLPMetricsEndpoint,
+			Insecure:      cfg.OTLPMetricsInsecure,
+			Interval:      cfg.OTLPMetricsInterval,
+			InferencePool: cfg.InferencePoolName,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to start OTLP metrics exporter: %w", err)
+		}
+		defer func() {
+			// push the last metrics before exiting
+			shutdownCtx, cancelFn := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancelFn()
+			if err := shutdown(shutdownCtx); err != nil {
+				logger.Error(err, "failed to stop OTLP metrics exporter")
+			}
+		}()
+		logger.Info("pushing metrics over OTLP", "endpoint", cfg.OTLPMetricsEndpoint, "interval", cfg.OTLPMetricsInterval)
+	}
+
+	if cfg.KVEventsSource != "" {
+		relay, err := kvevents.NewRelay(logger.WithName("kv events"), kvevents.Config{
+			Source: cfg.KVEventsSource,
+			Topic:  cfg.KVEventsTopic,
+			Sink:   cfg.KVEventsSink,
+			Model:  cfg.KVEventsModel,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to create KV events relay: %w", err)
+		}
+		go relay.Run(ctx)
+		logger.Info("relaying KV events", "source", cfg.KVEventsSource, "sink", cfg.KVEventsSink)
+	}
+
+	for i, proxyServer := range proxyServers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := proxyServer.Start(ctx); err != nil {
+				errs <- fmt.Errorf("proxy server of %s failed: %w", rankName(pools[i/cfg.DataParallelSize], i%cfg.DataParallelSize), err)
+				cancelFn()
+			}
+		}()
+	}
+	wg.Wait()
+
+	close(errs)
+	var failures []error
+	for err := range errs {
+		failures = append(failures, err)
+	}
+	return errors.Join(failures...)
+}
+
+// newProxyConfig returns the configuration of the proxies of the data parallel ranks
+func newProxyConfig(cfg *config.Config, spiffeSource *workloadapi.X509Source) proxy.Config {
+	proxyConfig := cfg.ProxyConfig()
+	proxyConfig.Middlewares = middleware.Registered()
+	proxyConfig.Identity = identity.FromEnv(os.LookupEnv, cfg.InferencePoolName)
+
+	if spiffeSource != nil {
+		proxyConfig.SPIFFESource = spiffeSource
+	}
+	return proxyConfig
+}
+
+// newRankConfig returns the configuration of the proxy of a data parallel rank of a pool
+func newRankConfig(cfg *config.Config, proxyConfig proxy.Config, pool config.Pool, rank int) (proxy.Config, error) {
+	rankConfig := proxyConfig
+	if pool.Name != "" {
+		rankConfig = pool.ProxyConfig(proxyConfig)
+		rankConfig.Identity = identity.FromEnv(os.LookupEnv, pool.InferencePoolName)
+	}
+	rankConfig.DataParallelRank = rank
+	if rankConfig.PrefillerStatsFile != "" && rank > 0 {
+		// each rank selects its prefillers
+		rankConfig.PrefillerStatsFile += "." + strconv.Itoa(rank)
+	}
+	if cfg.CanaryVLLMPort != "" {
+		var err error
+		rankConfig.CanaryDecoderPort, err = offsetPort(cfg.CanaryVLLMPort, rank)
+		if err != nil {
+			return rankConfig, fmt.Errorf("invalid canary vLLM port: %w", err)
+		}
 	}
-	targetURL, err := url.Parse(scheme + "://localhost:" + *vLLMPort)
+	if cfg.GRPCPort != "" && cfg.FeatureEnabled(config.FeatureGRPCFrontend) && pool.Name == "" {
+		// the gRPC frontend serves the main pool
+		var err error
+		rankConfig.GRPCPort, err = offsetPort(cfg.GRPCPort, rank)
+		if err != nil {
+			return rankConfig, fmt.Errorf("invalid gRPC port: %w", err)
+		}
+	}
+	return rankConfig, nil
+}
+
+// poolName names a pool in the errors
+func poolName(pool config.Pool) string {
+	if pool.Name == "" {
+		return "main pool"
+	}
+	return "pool " + pool.Name
+}
+
+// verbosity returns the klog verbosity set on the command line, also applied to the JSON logs
+func verbosity(fs *flag.FlagSet) int {
+	v, _ := strconv.Atoi(fs.Lookup("v").Value.String())
+	return v
+}
+
+// rankName names a data parallel rank of a pool in the errors
+func rankName(pool config.Pool, rank int) string {
+	if pool.Name == "" {
+		return fmt.Sprintf("rank %d", rank)
+	}
+	return fmt.Sprintf("rank %d of pool %s", rank, pool.Name)
+}
+
+// reload loads the configuration again from the command line, the environment and the
+// configuration file, and reloads the routing settings of the proxies. The pools cannot change
+// without a restart, since their ports are already listened on. It returns the reloaded settings.
+func reload(proxyServers []*proxy.Server, pools []config.Pool, spiffeSource *workloadapi.X509Source) ([]config.Setting, error) {
+	fs := flag.NewFlagSet(os.Args[0], flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	klog.InitFlags(fs)
+	cfg, settings, err := config.LoadSettings(fs, os.Args[1:], os.LookupEnv)
 	if err != nil {
-		logger.Error(err, "failed to create targetURL")
-		return
+		return nil, fmt.Errorf("invalid configuration: %w", err)
+	}
+
+	reloaded := append([]config.Pool{{Port: cfg.Port}}, cfg.Pools...)
+	if !slices.Equal(reloaded, pools) {
+		return nil, errors.New("the pools cannot be reloaded")
 	}
 
-	config := proxy.Config{
-		Connector:                   *connector,
-		PrefillerUseTLS:             *prefillerUseTLS,
-		SecureProxy:                 *secureProxy,
-		CertPath:                    *certPath,
-		PrefillerInsecureSkipVerify: *prefillerInsecureSkipVerify,
-		DecoderInsecureSkipVerify:   *decoderInsecureSkipVerify,
-		EnableSSRFProtection:        *enableSSRFProtection,
-		InferencePoolNamespace:      *inferencePoolNamespace,
-		InferencePoolName:           *inferencePoolName,
+	metrics.ConfigureLabels(cfg.MetricsLabelConfig())
+	proxyConfig := newProxyConfig(cfg, spiffeSource)
+	size := len(proxyServers) / len(pools) // the data parallel size cannot be reloaded either
+	for i, proxyServer := range proxyServers {
+		pool, rank := pools[i/size], i%size
+		rankConfig, err := newRankConfig(cfg, proxyConfig, pool, rank)
+		if err != nil {
+			return nil, err
+		}
+		if err := proxyServer.Reload(rankConfig); err != nil {
+			return nil, fmt.Errorf("failed to reload the proxy of %s: %w", rankName(pool, rank), err)
+		}
 	}
+	return settings, nil
+}
 
-	proxy, err := proxy.NewProxy(*port, targetURL, config)
+// offsetPort returns the port serving the given data parallel rank
+func offsetPort(port string, rank int) (string, error) {
+	if rank == 0 {
+		return port, nil
+	}
+	p, err := strconv.Atoi(port)
 	if err != nil {
-		logger.Error(err, "Failed to create proxy")
+		return "", fmt.Errorf("failed to parse port %q: %w", port, err)
 	}
-	if err := proxy.Start(ctx); err != nil {
-		logger.Error(err, "failed to start proxy server")
+	return strconv.Itoa(p + rank), nil
+}
+
+// runSelfTest runs the P/D self-test and logs the outcome of each stage
+func runSelfTest(ctx context.Context, server *proxy.Server, prefiller string, model string) bool {
+	logger := klog.FromContext(ctx)
+
+	report, err := server.SelfTest(ctx, prefiller, model)
+	if err != nil {
+		logger.Error(err, "self-test failed to run")
+		return false
 	}
+
+	for _, stage := range report.Stages {
+		logger.Info("self-test stage", "stage", stage.Name, "passed", stage.Passed, "statusCode", stage.StatusCode, "message", stage.Message)
+	}
+	logger.Info("self-test completed", "connector", report.Connector, "prefiller", report.Prefiller, "model", report.Model, "passed", report.Passed())
+
+	return report.Passed()
 }
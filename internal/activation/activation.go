@@ -0,0 +1,99 @@
+/*
+Copyright 2025 The llm-d Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package activation accepts the listeners inherited from a supervising process, following the
+// systemd socket activation protocol, e.g. to hand the listeners over to a new binary without
+// refusing connections
+package activation
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+)
+
+const (
+	// Environment variables of the socket activation protocol
+	envListenPID     = "LISTEN_PID"
+	envListenFDs     = "LISTEN_FDS"
+	envListenFDNames = "LISTEN_FDNAMES"
+
+	// listenFDsStart is the first inherited file descriptor
+	listenFDsStart = 3
+)
+
+// Listener is an inherited listener
+type Listener struct {
+	net.Listener
+
+	// Name is the name of the file descriptor, from LISTEN_FDNAMES
+	Name string
+}
+
+// Listeners returns the listeners inherited by the process, none when it was not passed any.
+// The environment variables of the protocol are unset, so child processes do not inherit them.
+func Listeners() ([]Listener, error) {
+	defer func() {
+		os.Unsetenv(envListenPID)     //nolint:all
+		os.Unsetenv(envListenFDs)     //nolint:all
+		os.Unsetenv(envListenFDNames) //nolint:all
+	}()
+	return listeners(os.Getenv, os.Getpid(), listenFDsStart)
+}
+
+// listeners returns the listeners passed to the process with the given pid, starting at firstFD
+func listeners(getenv func(string) string, pid int, firstFD int) ([]Listener, error) {
+	if getenv(envListenFDs) == "" {
+		return nil, nil
+	}
+
+	// the listeners are passed to the given process only, not to its children
+	if listenPID, err := strconv.Atoi(getenv(envListenPID)); err != nil || listenPID != pid {
+		return nil, nil
+	}
+
+	count, err := strconv.Atoi(getenv(envListenFDs))
+	if err != nil || count < 0 {
+		return nil, fmt.Errorf("invalid %s %q", envListenFDs, getenv(envListenFDs))
+	}
+
+	var names []string
+	if fdNames := getenv(envListenFDNames); fdNames != "" {
+		names = strings.Split(fdNames, ":")
+	}
+
+	result := make([]Listener, 0, count)
+	for i := range count {
+		name := "LISTEN_FD_" + strconv.Itoa(firstFD+i)
+		if i < len(names) {
+			name = names[i]
+		}
+
+		file := os.NewFile(uintptr(firstFD+i), name)
+		ln, err := net.FileListener(file)
+		file.Close() //nolint:all // the listener holds its own copy of the file descriptor
+		if err != nil {
+			for _, l := range result {
+				l.Close() //nolint:all
+			}
+			return nil, fmt.Errorf("inherited file descriptor %d (%s) is not a listener: %w", firstFD+i, name, err)
+		}
+		result = append(result, Listener{Listener: ln, Name: name})
+	}
+	return result, nil
+}
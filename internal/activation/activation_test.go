@@ -0,0 +1,103 @@
+//go:build !windows
+// +build !windows
+
+/*
+Copyright 2025 The llm-d Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package activation
+
+import (
+	"net"
+	"os"
+	"strconv"
+	"syscall"
+
+	. "github.com/onsi/ginkgo/v2" // nolint:revive
+	. "github.com/onsi/gomega"    // nolint:revive
+)
+
+var _ = Describe("Inherited listeners", func() {
+	var (
+		env    map[string]string
+		getenv = func(name string) string { return env[name] }
+	)
+
+	BeforeEach(func() {
+		env = map[string]string{}
+	})
+
+	// inherit returns a copy of the file descriptor of the given file, owned by the listeners
+	inherit := func(file *os.File) int {
+		fd, err := syscall.Dup(int(file.Fd()))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(file.Close()).To(Succeed())
+		return fd
+	}
+
+	It("should return no listener when none was passed", func() {
+		listeners, err := listeners(getenv, os.Getpid(), 3)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(listeners).To(BeEmpty())
+	})
+
+	It("should ignore the listeners passed to another process", func() {
+		env[envListenPID] = strconv.Itoa(os.Getpid() + 1)
+		env[envListenFDs] = "1"
+		listeners, err := listeners(getenv, os.Getpid(), 3)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(listeners).To(BeEmpty())
+	})
+
+	It("should accept the named listeners", func() {
+		ln, err := net.Listen("tcp", "127.0.0.1:0")
+		Expect(err).ToNot(HaveOccurred())
+		DeferCleanup(ln.Close)
+		file, err := ln.(*net.TCPListener).File()
+		Expect(err).ToNot(HaveOccurred())
+		fd, addr := inherit(file), ln.Addr()
+		env[envListenPID] = strconv.Itoa(os.Getpid())
+		env[envListenFDs] = "1"
+		env[envListenFDNames] = "admin"
+
+		listeners, err := listeners(getenv, os.Getpid(), fd)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(listeners).To(HaveLen(1))
+		DeferCleanup(listeners[0].Close)
+		Expect(listeners[0].Name).To(Equal("admin"))
+		Expect(listeners[0].Addr().String()).To(Equal(addr.String()))
+
+		conn, err := net.Dial("tcp", addr.String())
+		Expect(err).ToNot(HaveOccurred())
+		conn.Close() //nolint:all
+	})
+
+	It("should reject file descriptors not listening", func() {
+		file, err := os.CreateTemp(GinkgoT().TempDir(), "fd")
+		Expect(err).ToNot(HaveOccurred())
+		env[envListenPID] = strconv.Itoa(os.Getpid())
+		env[envListenFDs] = "1"
+
+		_, err = listeners(getenv, os.Getpid(), inherit(file))
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("should reject an invalid count", func() {
+		env[envListenPID] = strconv.Itoa(os.Getpid())
+		env[envListenFDs] = "many"
+		_, err := listeners(getenv, os.Getpid(), 3)
+		Expect(err).To(HaveOccurred())
+	})
+})
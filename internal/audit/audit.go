@@ -0,0 +1,90 @@
+/*
+Copyright 2025 The llm-d Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package audit writes security audit records as JSON lines, in a stream distinct from
+// the operational log, so they can be shipped to a SIEM
+package audit
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// StdoutPath is the path of the audit log written to the standard output
+const StdoutPath = "-"
+
+// Record is a security audit record
+type Record struct {
+	Time         time.Time `json:"time"`
+	Event        string    `json:"event"`
+	Decision     string    `json:"decision"`
+	Target       string    `json:"target"`
+	ClientIP     string    `json:"clientIP"`
+	ForwardedFor string    `json:"forwardedFor,omitempty"`
+	Identity     string    `json:"identity,omitempty"` // the SPIFFE ID of the authenticated client
+	Method       string    `json:"method"`
+	Path         string    `json:"path"`
+	UserAgent    string    `json:"userAgent,omitempty"`
+	Rank         int       `json:"dpRank"`
+}
+
+// Log writes audit records, one JSON object per line. It is safe for concurrent use.
+type Log struct {
+	mu      sync.Mutex
+	encoder *json.Encoder
+	closer  io.Closer
+}
+
+// New returns an audit log writing to w
+func New(w io.Writer) *Log {
+	return &Log{encoder: json.NewEncoder(w)}
+}
+
+// Open returns an audit log appending to the file at path, created if needed, or writing
+// to the standard output when path is StdoutPath
+func Open(path string) (*Log, error) {
+	if path == StdoutPath {
+		return New(os.Stdout), nil
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o600)
+	if err != nil {
+		return nil, err
+	}
+	log := New(f)
+	log.closer = f
+	return log, nil
+}
+
+// Write writes a record, timestamped now unless its time is set
+func (l *Log) Write(record Record) error {
+	if record.Time.IsZero() {
+		record.Time = time.Now().UTC()
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.encoder.Encode(record)
+}
+
+// Close closes the file of the audit log, if any
+func (l *Log) Close() error {
+	if l.closer == nil {
+		return nil
+	}
+	return l.closer.Close()
+}
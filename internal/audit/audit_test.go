@@ -0,0 +1,75 @@
+/*
+Copyright 2025 The llm-d Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package audit
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2" // nolint:revive
+	. "github.com/onsi/gomega"    // nolint:revive
+)
+
+var _ = Describe("Audit log", func() {
+	It("should append one JSON record per line", func() {
+		path := filepath.Join(GinkgoT().TempDir(), "audit.log")
+		Expect(os.WriteFile(path, []byte(`{"event":"previous"}`+"\n"), 0o600)).To(Succeed())
+
+		log, err := Open(path)
+		Expect(err).ToNot(HaveOccurred())
+
+		var wg sync.WaitGroup
+		for range 10 {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				defer GinkgoRecover()
+				Expect(log.Write(Record{Event: "ssrf", Decision: "deny", Target: "10.0.0.1:8000", ClientIP: "10.0.0.2"})).To(Succeed())
+			}()
+		}
+		wg.Wait()
+		Expect(log.Close()).To(Succeed())
+
+		f, err := os.Open(path)
+		Expect(err).ToNot(HaveOccurred())
+		defer f.Close() //nolint:all
+
+		var records []Record
+		scanner := bufio.NewScanner(f)
+		for scanner.Scan() {
+			var record Record
+			Expect(json.Unmarshal(scanner.Bytes(), &record)).To(Succeed())
+			records = append(records, record)
+		}
+		Expect(records).To(HaveLen(11))
+		Expect(records[0].Event).To(Equal("previous"))
+		for _, record := range records[1:] {
+			Expect(record.Decision).To(Equal("deny"))
+			Expect(record.Target).To(Equal("10.0.0.1:8000"))
+			Expect(record.Time).To(BeTemporally("~", time.Now(), time.Minute))
+		}
+	})
+
+	It("should fail to open a log in a missing directory", func() {
+		_, err := Open(filepath.Join(GinkgoT().TempDir(), "missing", "audit.log"))
+		Expect(err).To(HaveOccurred())
+	})
+})
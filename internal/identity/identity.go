@@ -0,0 +1,107 @@
+/*
+Copyright 2025 The llm-d Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package identity describes the Kubernetes identity of the sidecar, to slice its telemetry
+package identity
+
+import (
+	"go.opentelemetry.io/otel/attribute"
+	semconv "go.opentelemetry.io/otel/semconv/v1.37.0"
+)
+
+const (
+	// Environment variables holding the Kubernetes attributes of the pod, set with the downward API
+	envPodName      = "POD_NAME"
+	envPodNamespace = "POD_NAMESPACE"
+	envNodeName     = "NODE_NAME"
+
+	// inferencePoolKey is the attribute of the InferencePool, which has no semantic convention
+	inferencePoolKey = attribute.Key("k8s.inferencepool.name")
+)
+
+// Identity is the pod, namespace, node and InferencePool of the sidecar. Unknown fields are empty.
+type Identity struct {
+	Pod           string
+	Namespace     string
+	Node          string
+	InferencePool string
+}
+
+// FromEnv returns the identity of the sidecar from the POD_NAME, POD_NAMESPACE and NODE_NAME
+// environment variables set with the downward API, and the name of its InferencePool
+func FromEnv(lookupEnv func(string) (string, bool), inferencePool string) Identity {
+	pod, _ := lookupEnv(envPodName)
+	namespace, _ := lookupEnv(envPodNamespace)
+	node, _ := lookupEnv(envNodeName)
+	return Identity{
+		Pod:           pod,
+		Namespace:     namespace,
+		Node:          node,
+		InferencePool: inferencePool,
+	}
+}
+
+// LogValues returns the key/value pairs of the known fields, to add to a logger
+func (i Identity) LogValues() []any {
+	var values []any
+	for _, field := range i.fields() {
+		values = append(values, field.log, field.value)
+	}
+	return values
+}
+
+// Attributes returns the OpenTelemetry attributes of the known fields
+func (i Identity) Attributes() []attribute.KeyValue {
+	var attributes []attribute.KeyValue
+	for _, field := range i.fields() {
+		attributes = append(attributes, field.attribute.String(field.value))
+	}
+	return attributes
+}
+
+// Labels returns the Prometheus labels of the known fields
+func (i Identity) Labels() map[string]string {
+	labels := map[string]string{}
+	for _, field := range i.fields() {
+		labels[field.label] = field.value
+	}
+	return labels
+}
+
+// field is a known field of the identity, with its log key, attribute and label names
+type field struct {
+	log       string
+	attribute attribute.Key
+	label     string
+	value     string
+}
+
+// fields returns the known fields of the identity
+func (i Identity) fields() []field {
+	all := []field{
+		{log: "pod", attribute: semconv.K8SPodNameKey, label: "pod", value: i.Pod},
+		{log: "namespace", attribute: semconv.K8SNamespaceNameKey, label: "namespace", value: i.Namespace},
+		{log: "node", attribute: semconv.K8SNodeNameKey, label: "node", value: i.Node},
+		{log: "inferencePool", attribute: inferencePoolKey, label: "inference_pool", value: i.InferencePool},
+	}
+	known := make([]field, 0, len(all))
+	for _, f := range all {
+		if f.value != "" {
+			known = append(known, f)
+		}
+	}
+	return known
+}
@@ -0,0 +1,59 @@
+/*
+Copyright 2025 The llm-d Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package identity
+
+import (
+	. "github.com/onsi/ginkgo/v2" // nolint:revive
+	. "github.com/onsi/gomega"    // nolint:revive
+	"go.opentelemetry.io/otel/attribute"
+)
+
+var _ = Describe("Identity", func() {
+	lookupEnv := func(env map[string]string) func(string) (string, bool) {
+		return func(name string) (string, bool) {
+			value, ok := env[name]
+			return value, ok
+		}
+	}
+
+	It("should read the identity from the downward API", func() {
+		identity := FromEnv(lookupEnv(map[string]string{
+			envPodName:      "decode-0",
+			envPodNamespace: "llm-d",
+			envNodeName:     "node-a",
+		}), "pool")
+
+		Expect(identity).To(Equal(Identity{Pod: "decode-0", Namespace: "llm-d", Node: "node-a", InferencePool: "pool"}))
+		Expect(identity.LogValues()).To(Equal([]any{"pod", "decode-0", "namespace", "llm-d", "node", "node-a", "inferencePool", "pool"}))
+		Expect(identity.Labels()).To(Equal(map[string]string{"pod": "decode-0", "namespace": "llm-d", "node": "node-a", "inference_pool": "pool"}))
+		Expect(identity.Attributes()).To(ConsistOf(
+			attribute.String("k8s.pod.name", "decode-0"),
+			attribute.String("k8s.namespace.name", "llm-d"),
+			attribute.String("k8s.node.name", "node-a"),
+			attribute.String("k8s.inferencepool.name", "pool"),
+		))
+	})
+
+	It("should skip the unknown fields", func() {
+		identity := FromEnv(lookupEnv(map[string]string{envPodName: "decode-0"}), "")
+
+		Expect(identity.LogValues()).To(Equal([]any{"pod", "decode-0"}))
+		Expect(identity.Labels()).To(Equal(map[string]string{"pod": "decode-0"}))
+		Expect(identity.Attributes()).To(HaveLen(1))
+		Expect(Identity{}.LogValues()).To(BeEmpty())
+	})
+})
@@ -0,0 +1,363 @@
+/*
+Copyright 2025 The llm-d Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package kvevents relays the KV cache events of the decode engine to the llm-d scheduler
+package kvevents
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/nats-io/nats.go"
+
+	"github.com/llm-d/llm-d-routing-sidecar/internal/metrics"
+)
+
+const (
+	// Environment variables holding the Kubernetes attributes of the pod, set with the downward API
+	envPodName      = "POD_NAME"
+	envPodNamespace = "POD_NAMESPACE"
+
+	// Headers of the events relayed over NATS or HTTP
+	headerTopic     = "KV-Events-Topic"
+	headerSequence  = "KV-Events-Sequence"
+	headerPod       = "KV-Events-Pod"
+	headerNamespace = "KV-Events-Namespace"
+
+	contentTypeMsgpack = "application/msgpack"
+
+	httpSinkTimeout = 10 * time.Second
+
+	minReconnectDelay = 1 * time.Second
+	maxReconnectDelay = 30 * time.Second
+)
+
+// Config configures the KV events relay
+type Config struct {
+	// Source is the event stream of the engine: tcp://host:port for a ZMQ publisher, or
+	// nats://host:port/subject
+	Source string
+
+	// Topic is the prefix of the ZMQ topics subscribed to. Empty subscribes to every topic.
+	Topic string
+
+	// Sink is where the events are republished: tcp://[host]:port to bind a ZMQ publisher,
+	// nats://host:port/subject, or the http(s) URL the events are posted to
+	Sink string
+
+	// Pod and Namespace identify the pod in the relayed events. Default to the POD_NAME and
+	// POD_NAMESPACE environment variables.
+	Pod       string
+	Namespace string
+
+	// Model is the model served by the engine, part of the relayed topics
+	Model string
+}
+
+// Event is a batch of KV cache events, as published by vLLM: the payload is msgpack encoded.
+// Relayed events are tagged with the identity of the pod.
+type Event struct {
+	Topic     string
+	Sequence  uint64
+	Payload   []byte
+	Pod       string
+	Namespace string
+}
+
+// source receives the events of the engine
+type source interface {
+	// receive calls handle for each event until the stream fails or ctx is done
+	receive(ctx context.Context, handle func(Event)) error
+}
+
+// sink republishes the events
+type sink interface {
+	publish(event Event) error
+	close()
+}
+
+// Relay subscribes to the KV cache events of the engine and republishes them tagged with
+// the pod identity, so the scheduler can track the block residency without engine access
+type Relay struct {
+	logger logr.Logger
+	config Config
+	source source
+	sink   sink
+	topic  string
+}
+
+// NewRelay creates a KV events relay
+func NewRelay(logger logr.Logger, config Config) (*Relay, error) {
+	if config.Pod == "" {
+		config.Pod = os.Getenv(envPodName)
+	}
+	if config.Namespace == "" {
+		config.Namespace = os.Getenv(envPodNamespace)
+	}
+	if config.Pod == "" {
+		return nil, errors.New("the pod identity of the KV events is unknown, set POD_NAME")
+	}
+
+	source, err := newSource(config)
+	if err != nil {
+		return nil, err
+	}
+	sink, err := newSink(logger, config.Sink)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Relay{
+		logger: logger,
+		config: config,
+		source: source,
+		sink:   sink,
+		// the topic format the llm-d KV cache indexer expects
+		topic: "kv@" + config.Pod + "@" + config.Model,
+	}, nil
+}
+
+// Run relays the events until ctx is done, reconnecting to the source when the stream fails
+func (r *Relay) Run(ctx context.Context) {
+	defer r.sink.close()
+
+	delay := minReconnectDelay
+	for {
+		start := time.Now()
+		err := r.source.receive(ctx, r.relay)
+		if ctx.Err() != nil {
+			return
+		}
+
+		if time.Since(start) > maxReconnectDelay {
+			delay = minReconnectDelay
+		}
+		r.logger.Error(err, "KV events stream failed, reconnecting", "source", r.config.Source, "delay", delay)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(delay):
+		}
+		delay = min(2*delay, maxReconnectDelay)
+	}
+}
+
+// relay republishes an event under the topic of the pod
+func (r *Relay) relay(event Event) {
+	event.Topic = r.topic
+	event.Pod = r.config.Pod
+	event.Namespace = r.config.Namespace
+	if err := r.sink.publish(event); err != nil {
+		r.logger.V(4).Info("failed to relay KV events", "sink", r.config.Sink, "error", err.Error())
+		metrics.RecordKVEvents(false)
+		return
+	}
+	metrics.RecordKVEvents(true)
+}
+
+func newSource(config Config) (source, error) {
+	u, err := url.Parse(config.Source)
+	if err != nil {
+		return nil, fmt.Errorf("invalid KV events source: %w", err)
+	}
+
+	switch u.Scheme {
+	case "tcp":
+		return &zmqSource{address: u.Host, topic: config.Topic}, nil
+	case "nats":
+		subject := strings.TrimPrefix(u.Path, "/")
+		if subject == "" {
+			return nil, errors.New("the NATS KV events source has no subject")
+		}
+		u.Path = ""
+		return &natsSource{url: u.String(), subject: subject}, nil
+	}
+	return nil, fmt.Errorf("unsupported KV events source %q", config.Source)
+}
+
+func newSink(logger logr.Logger, sinkURL string) (sink, error) {
+	u, err := url.Parse(sinkURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid KV events sink: %w", err)
+	}
+
+	switch u.Scheme {
+	case "tcp":
+		publisher, err := listenPublisher(u.Host, logger)
+		if err != nil {
+			return nil, err
+		}
+		return &zmqSink{publisher: publisher}, nil
+	case "nats":
+		subject := strings.TrimPrefix(u.Path, "/")
+		if subject == "" {
+			return nil, errors.New("the NATS KV events sink has no subject")
+		}
+		u.Path = ""
+		conn, err := nats.Connect(u.String(), nats.MaxReconnects(-1))
+		if err != nil {
+			return nil, err
+		}
+		return &natsSink{conn: conn, subject: subject}, nil
+	case "http", "https":
+		return &httpSink{url: sinkURL, client: &http.Client{Timeout: httpSinkTimeout}}, nil
+	}
+	return nil, fmt.Errorf("unsupported KV events sink %q", sinkURL)
+}
+
+// zmqSource subscribes to the ZMQ publisher of vLLM
+type zmqSource struct {
+	address string
+	topic   string
+}
+
+func (s *zmqSource) receive(ctx context.Context, handle func(Event)) error {
+	conn, err := dialSubscriber(ctx, s.address, s.topic)
+	if err != nil {
+		return err
+	}
+	stop := context.AfterFunc(ctx, func() { conn.Close() }) //nolint:all
+	defer stop()
+	defer conn.Close() //nolint:all
+
+	for {
+		parts, err := conn.readMessage(nil)
+		if err != nil {
+			return err
+		}
+
+		// topic, sequence number and payload; older publishers omit the sequence number
+		switch len(parts) {
+		case 3:
+			if len(parts[1]) != 8 {
+				continue
+			}
+			handle(Event{Topic: string(parts[0]), Sequence: binary.BigEndian.Uint64(parts[1]), Payload: parts[2]})
+		case 2:
+			handle(Event{Topic: string(parts[0]), Payload: parts[1]})
+		}
+	}
+}
+
+// natsSource subscribes to a NATS subject
+type natsSource struct {
+	url     string
+	subject string
+}
+
+func (s *natsSource) receive(ctx context.Context, handle func(Event)) error {
+	conn, err := nats.Connect(s.url)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	messages := make(chan *nats.Msg, 1024)
+	sub, err := conn.ChanSubscribe(s.subject, messages)
+	if err != nil {
+		return err
+	}
+	defer sub.Unsubscribe() //nolint:all
+
+	closed := make(chan struct{})
+	conn.SetClosedHandler(func(*nats.Conn) { close(closed) })
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-closed:
+			return errors.New("NATS connection closed")
+		case msg := <-messages:
+			sequence, _ := strconv.ParseUint(msg.Header.Get(headerSequence), 10, 64) //nolint:all
+			handle(Event{Topic: msg.Subject, Sequence: sequence, Payload: msg.Data})
+		}
+	}
+}
+
+// zmqSink republishes the events on a ZMQ publisher, in the vLLM format
+type zmqSink struct {
+	publisher *zmtpPublisher
+}
+
+func (s *zmqSink) publish(event Event) error {
+	s.publisher.publish([][]byte{[]byte(event.Topic), binary.BigEndian.AppendUint64(nil, event.Sequence), event.Payload})
+	return nil
+}
+
+func (s *zmqSink) close() {
+	s.publisher.Close() //nolint:all
+}
+
+// natsSink republishes the events on a NATS subject, tagged with headers
+type natsSink struct {
+	conn    *nats.Conn
+	subject string
+}
+
+func (s *natsSink) publish(event Event) error {
+	msg := nats.NewMsg(s.subject)
+	msg.Data = event.Payload
+	msg.Header.Set(headerTopic, event.Topic)
+	msg.Header.Set(headerSequence, strconv.FormatUint(event.Sequence, 10))
+	msg.Header.Set(headerPod, event.Pod)
+	msg.Header.Set(headerNamespace, event.Namespace)
+	return s.conn.PublishMsg(msg)
+}
+
+func (s *natsSink) close() {
+	s.conn.Close()
+}
+
+// httpSink posts the events to an HTTP endpoint, tagged with headers
+type httpSink struct {
+	url    string
+	client *http.Client
+}
+
+func (s *httpSink) publish(event Event) error {
+	req, err := http.NewRequest(http.MethodPost, s.url, bytes.NewReader(event.Payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", contentTypeMsgpack)
+	req.Header.Set(headerTopic, event.Topic)
+	req.Header.Set(headerSequence, strconv.FormatUint(event.Sequence, 10))
+	req.Header.Set(headerPod, event.Pod)
+	req.Header.Set(headerNamespace, event.Namespace)
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close() //nolint:all
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("KV events sink returned status code %d", resp.StatusCode)
+	}
+	return nil
+}
+
+func (s *httpSink) close() {}
@@ -0,0 +1,149 @@
+/*
+Copyright 2025 The llm-d Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kvevents
+
+import (
+	"context"
+	"encoding/binary"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	"github.com/go-logr/logr"
+	. "github.com/onsi/ginkgo/v2" //nolint:revive
+	. "github.com/onsi/gomega"    //nolint:revive
+)
+
+var _ = Describe("Relay", func() {
+	var (
+		engine *zmtpPublisher
+		ctx    context.Context
+		cancel context.CancelFunc
+	)
+
+	BeforeEach(func() {
+		var err error
+		engine, err = listenPublisher("127.0.0.1:0", logr.Discard())
+		Expect(err).ToNot(HaveOccurred())
+		ctx, cancel = context.WithCancel(context.Background())
+	})
+
+	AfterEach(func() {
+		cancel()
+		engine.Close() //nolint:all
+	})
+
+	publishEngineEvent := func() {
+		engine.publish([][]byte{[]byte("kv-events"), binary.BigEndian.AppendUint64(nil, 42), []byte("payload")})
+	}
+
+	It("should post the events tagged with the pod identity", func() {
+		requests := make(chan *http.Request, 16)
+		bodies := make(chan []byte, 16)
+		sink := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			body, _ := io.ReadAll(r.Body) //nolint:all
+			requests <- r
+			bodies <- body
+		}))
+		defer sink.Close()
+
+		relay, err := NewRelay(logr.Discard(), Config{
+			Source:    "tcp://" + engine.Addr().String(),
+			Sink:      sink.URL,
+			Pod:       "decode-0",
+			Namespace: "llm-d",
+			Model:     "llama",
+		})
+		Expect(err).ToNot(HaveOccurred())
+		go relay.Run(ctx)
+
+		Eventually(func() int {
+			publishEngineEvent()
+			return len(requests)
+		}).WithTimeout(5 * time.Second).WithPolling(50 * time.Millisecond).ShouldNot(BeZero())
+
+		r := <-requests
+		Expect(r.Header.Get(headerTopic)).To(Equal("kv@decode-0@llama"))
+		Expect(r.Header.Get(headerSequence)).To(Equal("42"))
+		Expect(r.Header.Get(headerPod)).To(Equal("decode-0"))
+		Expect(r.Header.Get(headerNamespace)).To(Equal("llm-d"))
+		Expect(r.Header.Get("Content-Type")).To(Equal(contentTypeMsgpack))
+		Expect(<-bodies).To(Equal([]byte("payload")))
+	})
+
+	It("should republish the events on a ZMQ publisher", func() {
+		relay, err := NewRelay(logr.Discard(), Config{
+			Source: "tcp://" + engine.Addr().String(),
+			Sink:   "tcp://127.0.0.1:0",
+			Pod:    "decode-0",
+			Model:  "llama",
+		})
+		Expect(err).ToNot(HaveOccurred())
+		address := relay.sink.(*zmqSink).publisher.Addr().String()
+		go relay.Run(ctx)
+
+		subscriber, err := dialSubscriber(ctx, address, "kv@decode-0@")
+		Expect(err).ToNot(HaveOccurred())
+		defer subscriber.Close() //nolint:all
+
+		received := make(chan [][]byte, 16)
+		go func() {
+			for {
+				parts, err := subscriber.readMessage(nil)
+				if err != nil {
+					return
+				}
+				received <- parts
+			}
+		}()
+
+		Eventually(func() int {
+			publishEngineEvent()
+			return len(received)
+		}).WithTimeout(5 * time.Second).WithPolling(50 * time.Millisecond).ShouldNot(BeZero())
+		Expect(<-received).To(Equal([][]byte{
+			[]byte("kv@decode-0@llama"),
+			binary.BigEndian.AppendUint64(nil, 42),
+			[]byte("payload"),
+		}))
+	})
+
+	It("should require the pod identity", func() {
+		GinkgoT().Setenv(envPodName, "")
+		_, err := NewRelay(logr.Discard(), Config{Source: "tcp://127.0.0.1:5557", Sink: "http://127.0.0.1:8080"})
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("should default the pod identity to the downward API environment", func() {
+		GinkgoT().Setenv(envPodName, "decode-1")
+		GinkgoT().Setenv(envPodNamespace, "llm-d")
+		relay, err := NewRelay(logr.Discard(), Config{Source: "tcp://127.0.0.1:5557", Sink: "http://127.0.0.1:8080", Model: "llama"})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(relay.topic).To(Equal("kv@decode-1@llama"))
+		Expect(relay.config.Namespace).To(Equal("llm-d"))
+	})
+
+	It("should reject unsupported sources and sinks", func() {
+		_, err := NewRelay(logr.Discard(), Config{Source: "ipc:///tmp/kv", Sink: "http://127.0.0.1:8080", Pod: "decode-0"})
+		Expect(err).To(HaveOccurred())
+		_, err = NewRelay(logr.Discard(), Config{Source: "nats://127.0.0.1:4222", Sink: "http://127.0.0.1:8080", Pod: "decode-0"})
+		Expect(err).To(HaveOccurred())
+		_, err = NewRelay(logr.Discard(), Config{Source: "tcp://127.0.0.1:5557", Sink: "udp://127.0.0.1:8080", Pod: "decode-0"})
+		Expect(err).To(HaveOccurred())
+	})
+})
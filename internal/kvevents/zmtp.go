@@ -0,0 +1,390 @@
+/*
+Copyright 2025 The llm-d Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kvevents
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-logr/logr"
+)
+
+// This file implements the subset of ZMTP 3.0 (https://rfc.zeromq.org/spec/23/) spoken by
+// vLLM KV event publishers: PUB and SUB sockets over TCP with the NULL security mechanism.
+
+const (
+	zmtpGreetingSize = 64
+
+	zmtpFlagMore    = 0x01
+	zmtpFlagLong    = 0x02
+	zmtpFlagCommand = 0x04
+
+	zmtpMaxFrameSize = 64 << 20
+
+	zmtpWriteTimeout = 5 * time.Second
+)
+
+// zmtpGreeting is the greeting of a ZMTP 3.0 peer using the NULL mechanism
+var zmtpGreeting = func() []byte {
+	greeting := make([]byte, zmtpGreetingSize)
+	greeting[0] = 0xff // signature
+	greeting[9] = 0x7f
+	greeting[10] = 3 // version 3.0
+	greeting[11] = 0
+	copy(greeting[12:32], "NULL") // mechanism, as-server and filler left zero
+	return greeting
+}()
+
+// zmtpConn is a ZMTP connection, after the handshake
+type zmtpConn struct {
+	conn   net.Conn
+	reader *bufio.Reader
+}
+
+// zmtpHandshake exchanges the greetings and READY commands with a peer
+func zmtpHandshake(conn net.Conn, socketType string) (*zmtpConn, error) {
+	c := &zmtpConn{conn: conn, reader: bufio.NewReader(conn)}
+
+	if _, err := conn.Write(zmtpGreeting); err != nil {
+		return nil, err
+	}
+	greeting := make([]byte, zmtpGreetingSize)
+	if _, err := io.ReadFull(c.reader, greeting); err != nil {
+		return nil, err
+	}
+	if greeting[0] != 0xff || greeting[9] != 0x7f || greeting[10] < 3 {
+		return nil, errors.New("peer does not speak ZMTP 3")
+	}
+	if mechanism := string(bytes.TrimRight(greeting[12:32], "\x00")); mechanism != "NULL" {
+		return nil, fmt.Errorf("unsupported ZMTP security mechanism %q", mechanism)
+	}
+
+	if err := c.writeCommand("READY", zmtpProperty("Socket-Type", socketType)); err != nil {
+		return nil, err
+	}
+	name, body, err := c.readCommand()
+	if err != nil {
+		return nil, err
+	}
+	if name != "READY" {
+		return nil, fmt.Errorf("unexpected ZMTP command %s: %s", name, body)
+	}
+	return c, nil
+}
+
+// zmtpProperty encodes a metadata property of a READY command
+func zmtpProperty(name string, value string) []byte {
+	property := []byte{byte(len(name))}
+	property = append(property, name...)
+	property = binary.BigEndian.AppendUint32(property, uint32(len(value)))
+	return append(property, value...)
+}
+
+// writeFrame writes a message or command frame
+func writeFrame(w io.Writer, flags byte, body []byte) error {
+	header := make([]byte, 0, 9)
+	if len(body) > 255 {
+		header = append(header, flags|zmtpFlagLong)
+		header = binary.BigEndian.AppendUint64(header, uint64(len(body)))
+	} else {
+		header = append(header, flags, byte(len(body)))
+	}
+	if _, err := w.Write(header); err != nil {
+		return err
+	}
+	_, err := w.Write(body)
+	return err
+}
+
+func (c *zmtpConn) writeCommand(name string, data []byte) error {
+	body := append([]byte{byte(len(name))}, name...)
+	return writeFrame(c.conn, zmtpFlagCommand, append(body, data...))
+}
+
+// writeMessage writes a multipart message
+func (c *zmtpConn) writeMessage(parts [][]byte) error {
+	w := bufio.NewWriter(c.conn)
+	for i, part := range parts {
+		var flags byte
+		if i < len(parts)-1 {
+			flags = zmtpFlagMore
+		}
+		if err := writeFrame(w, flags, part); err != nil {
+			return err
+		}
+	}
+	return w.Flush()
+}
+
+// readFrame reads a message or command frame
+func (c *zmtpConn) readFrame() (byte, []byte, error) {
+	flags, err := c.reader.ReadByte()
+	if err != nil {
+		return 0, nil, err
+	}
+
+	var size uint64
+	if flags&zmtpFlagLong != 0 {
+		var header [8]byte
+		if _, err := io.ReadFull(c.reader, header[:]); err != nil {
+			return 0, nil, err
+		}
+		size = binary.BigEndian.Uint64(header[:])
+	} else {
+		b, err := c.reader.ReadByte()
+		if err != nil {
+			return 0, nil, err
+		}
+		size = uint64(b)
+	}
+	if size > zmtpMaxFrameSize {
+		return 0, nil, fmt.Errorf("ZMTP frame of %d bytes is too large", size)
+	}
+
+	body := make([]byte, size)
+	if _, err := io.ReadFull(c.reader, body); err != nil {
+		return 0, nil, err
+	}
+	return flags, body, nil
+}
+
+// readCommand reads a command frame, returning its name and data
+func (c *zmtpConn) readCommand() (string, []byte, error) {
+	flags, body, err := c.readFrame()
+	if err != nil {
+		return "", nil, err
+	}
+	if flags&zmtpFlagCommand == 0 {
+		return "", nil, errors.New("expected a ZMTP command")
+	}
+	return parseCommand(body)
+}
+
+func parseCommand(body []byte) (string, []byte, error) {
+	if len(body) == 0 || len(body) < int(body[0])+1 {
+		return "", nil, errors.New("malformed ZMTP command")
+	}
+	return string(body[1 : body[0]+1]), body[body[0]+1:], nil
+}
+
+// readMessage reads a multipart message. Commands received in between are passed to
+// onCommand, if set, and skipped otherwise.
+func (c *zmtpConn) readMessage(onCommand func(name string, data []byte)) ([][]byte, error) {
+	var parts [][]byte
+	for {
+		flags, body, err := c.readFrame()
+		if err != nil {
+			return nil, err
+		}
+		if flags&zmtpFlagCommand != 0 {
+			if name, data, err := parseCommand(body); err == nil && onCommand != nil {
+				onCommand(name, data)
+			}
+			continue
+		}
+
+		parts = append(parts, body)
+		if flags&zmtpFlagMore == 0 {
+			return parts, nil
+		}
+	}
+}
+
+func (c *zmtpConn) Close() error {
+	return c.conn.Close()
+}
+
+// dialSubscriber connects a SUB socket to a publisher, subscribed to the topics starting with prefix
+func dialSubscriber(ctx context.Context, address string, prefix string) (*zmtpConn, error) {
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", address)
+	if err != nil {
+		return nil, err
+	}
+
+	c, err := zmtpHandshake(conn, "SUB")
+	if err != nil {
+		conn.Close() //nolint:all
+		return nil, err
+	}
+	if err := c.writeMessage([][]byte{append([]byte{1}, prefix...)}); err != nil {
+		conn.Close() //nolint:all
+		return nil, err
+	}
+	return c, nil
+}
+
+// zmtpPublisher is a PUB socket bound to a TCP address, sending messages to the subscribers
+// of their topic. Slow subscribers are disconnected rather than holding the others back.
+type zmtpPublisher struct {
+	listener net.Listener
+	logger   logr.Logger
+
+	mu          sync.Mutex
+	subscribers map[*zmtpSubscriber]struct{}
+}
+
+// zmtpSubscriber is a connected SUB peer with its subscriptions
+type zmtpSubscriber struct {
+	conn     *zmtpConn
+	mu       sync.Mutex
+	prefixes []string
+}
+
+func listenPublisher(address string, logger logr.Logger) (*zmtpPublisher, error) {
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &zmtpPublisher{
+		listener:    listener,
+		logger:      logger,
+		subscribers: make(map[*zmtpSubscriber]struct{}),
+	}
+	go p.accept()
+	return p, nil
+}
+
+func (p *zmtpPublisher) accept() {
+	for {
+		conn, err := p.listener.Accept()
+		if err != nil {
+			return
+		}
+		go p.serve(conn)
+	}
+}
+
+// serve handshakes with a subscriber and tracks its subscriptions until it disconnects
+func (p *zmtpPublisher) serve(conn net.Conn) {
+	c, err := zmtpHandshake(conn, "PUB")
+	if err != nil {
+		p.logger.V(4).Info("ZMTP handshake failed", "peer", conn.RemoteAddr().String(), "error", err.Error())
+		conn.Close() //nolint:all
+		return
+	}
+
+	s := &zmtpSubscriber{conn: c}
+	p.mu.Lock()
+	p.subscribers[s] = struct{}{}
+	p.mu.Unlock()
+	defer p.remove(s)
+
+	for {
+		// ZMTP 3.0 subscriptions are messages, ZMTP 3.1 ones are commands
+		parts, err := c.readMessage(func(name string, data []byte) {
+			switch name {
+			case "SUBSCRIBE":
+				s.subscribe(string(data))
+			case "CANCEL":
+				s.cancel(string(data))
+			}
+		})
+		if err != nil {
+			return
+		}
+		if len(parts) == 1 && len(parts[0]) > 0 {
+			switch parts[0][0] {
+			case 1:
+				s.subscribe(string(parts[0][1:]))
+			case 0:
+				s.cancel(string(parts[0][1:]))
+			}
+		}
+	}
+}
+
+func (p *zmtpPublisher) remove(s *zmtpSubscriber) {
+	p.mu.Lock()
+	delete(p.subscribers, s)
+	p.mu.Unlock()
+	s.conn.Close() //nolint:all
+}
+
+// publish sends a message to the subscribers of its topic, the first part
+func (p *zmtpPublisher) publish(parts [][]byte) {
+	p.mu.Lock()
+	subscribers := make([]*zmtpSubscriber, 0, len(p.subscribers))
+	for s := range p.subscribers {
+		subscribers = append(subscribers, s)
+	}
+	p.mu.Unlock()
+
+	topic := string(parts[0])
+	for _, s := range subscribers {
+		if !s.subscribed(topic) {
+			continue
+		}
+		s.conn.conn.SetWriteDeadline(time.Now().Add(zmtpWriteTimeout)) //nolint:all
+		if err := s.conn.writeMessage(parts); err != nil {
+			p.logger.V(4).Info("dropping slow or gone subscriber", "peer", s.conn.conn.RemoteAddr().String(), "error", err.Error())
+			p.remove(s)
+		}
+	}
+}
+
+func (p *zmtpPublisher) Addr() net.Addr {
+	return p.listener.Addr()
+}
+
+func (p *zmtpPublisher) Close() error {
+	err := p.listener.Close()
+	p.mu.Lock()
+	for s := range p.subscribers {
+		s.conn.Close() //nolint:all
+	}
+	p.mu.Unlock()
+	return err
+}
+
+func (s *zmtpSubscriber) subscribe(prefix string) {
+	s.mu.Lock()
+	s.prefixes = append(s.prefixes, prefix)
+	s.mu.Unlock()
+}
+
+func (s *zmtpSubscriber) cancel(prefix string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i, p := range s.prefixes {
+		if p == prefix {
+			s.prefixes = append(s.prefixes[:i], s.prefixes[i+1:]...)
+			return
+		}
+	}
+}
+
+func (s *zmtpSubscriber) subscribed(topic string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, prefix := range s.prefixes {
+		if strings.HasPrefix(topic, prefix) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,83 @@
+/*
+Copyright 2025 The llm-d Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kvevents
+
+import (
+	"bytes"
+	"context"
+	"time"
+
+	"github.com/go-logr/logr"
+	. "github.com/onsi/ginkgo/v2" //nolint:revive
+	. "github.com/onsi/gomega"    //nolint:revive
+)
+
+var _ = Describe("ZMTP", func() {
+	It("should greet with version 3.0 and the NULL mechanism", func() {
+		Expect(zmtpGreeting).To(HaveLen(64))
+		Expect(zmtpGreeting[0]).To(Equal(byte(0xff)))
+		Expect(zmtpGreeting[9]).To(Equal(byte(0x7f)))
+		Expect(zmtpGreeting[10:12]).To(Equal([]byte{3, 0}))
+		Expect(zmtpGreeting[12:17]).To(Equal([]byte("NULL\x00")))
+	})
+
+	It("should encode short and long frames", func() {
+		var short bytes.Buffer
+		Expect(writeFrame(&short, zmtpFlagMore, []byte("topic"))).To(Succeed())
+		Expect(short.Bytes()).To(Equal(append([]byte{zmtpFlagMore, 5}, "topic"...)))
+
+		var long bytes.Buffer
+		Expect(writeFrame(&long, 0, make([]byte, 300))).To(Succeed())
+		Expect(long.Bytes()[:9]).To(Equal([]byte{zmtpFlagLong, 0, 0, 0, 0, 0, 0, 0x01, 0x2c}))
+		Expect(long.Len()).To(Equal(309))
+	})
+
+	It("should deliver the messages of the subscribed topics", func() {
+		publisher, err := listenPublisher("127.0.0.1:0", logr.Discard())
+		Expect(err).ToNot(HaveOccurred())
+		defer publisher.Close() //nolint:all
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		subscriber, err := dialSubscriber(ctx, publisher.Addr().String(), "kv@")
+		Expect(err).ToNot(HaveOccurred())
+		defer subscriber.Close() //nolint:all
+
+		// the subscription is registered asynchronously
+		received := make(chan [][]byte, 16)
+		go func() {
+			for {
+				parts, err := subscriber.readMessage(nil)
+				if err != nil {
+					close(received)
+					return
+				}
+				received <- parts
+			}
+		}()
+		Eventually(func() [][]byte {
+			publisher.publish([][]byte{[]byte("other"), []byte("ignored")})
+			publisher.publish([][]byte{[]byte("kv@pod@model"), make([]byte, 300)})
+			select {
+			case parts := <-received:
+				return parts
+			case <-time.After(100 * time.Millisecond):
+				return nil
+			}
+		}).WithTimeout(5 * time.Second).Should(Equal([][]byte{[]byte("kv@pod@model"), make([]byte, 300)}))
+	})
+})
@@ -0,0 +1,124 @@
+/*
+Copyright 2025 The llm-d Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package logging
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/go-logr/logr"
+)
+
+// Deduplicate returns a logger logging the same info or error message of the same logger at
+// most once per window, e.g. "waiting for vLLM to be ready" at high QPS. The repeats are
+// summarized at the end of the window. The verbose logs are not deduplicated, since they are
+// enabled for debugging.
+func Deduplicate(logger logr.Logger, window time.Duration) logr.Logger {
+	if window <= 0 || logger.GetSink() == nil {
+		return logger
+	}
+	d := &deduplicator{window: window, repeats: map[string]*repeat{}}
+	// the sink is already initialized, only the frame of the dedupSink is added
+	return logr.New(&dedupSink{sink: logger.WithCallDepth(1).GetSink(), d: d})
+}
+
+// deduplicator counts the repeats of the messages within their window
+type deduplicator struct {
+	window time.Duration
+
+	mu      sync.Mutex
+	repeats map[string]*repeat
+}
+
+// repeat is a message logged within its window
+type repeat struct {
+	count int
+	timer *time.Timer
+}
+
+// allow reports whether a message is logged, counting it as a repeat otherwise. The repeats
+// are summarized with the given function once the window of the message ends.
+func (d *deduplicator) allow(key string, summarize func(count int)) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	r, ok := d.repeats[key]
+	if !ok {
+		r = &repeat{}
+		d.repeats[key] = r
+		r.timer = time.AfterFunc(d.window, func() {
+			d.mu.Lock()
+			count := r.count
+			delete(d.repeats, key)
+			d.mu.Unlock()
+			if count > 0 {
+				summarize(count)
+			}
+		})
+		return true
+	}
+	r.count++
+	return false
+}
+
+// dedupSink deduplicates the messages of a logger, scoped by its name and values
+type dedupSink struct {
+	sink  logr.LogSink
+	d     *deduplicator
+	scope string
+}
+
+func (s *dedupSink) Init(logr.RuntimeInfo) {}
+
+func (s *dedupSink) Enabled(level int) bool {
+	return s.sink.Enabled(level)
+}
+
+func (s *dedupSink) Info(level int, msg string, keysAndValues ...any) {
+	if level > 0 || s.d.allow(s.scope+"\x00info\x00"+msg, func(count int) { s.summarize(msg, count) }) {
+		s.sink.Info(level, msg, keysAndValues...)
+	}
+}
+
+func (s *dedupSink) Error(err error, msg string, keysAndValues ...any) {
+	if s.d.allow(s.scope+"\x00error\x00"+msg, func(count int) { s.summarize(msg, count) }) {
+		s.sink.Error(err, msg, keysAndValues...)
+	}
+}
+
+// summarize logs the number of repeats of a message within the window
+func (s *dedupSink) summarize(msg string, count int) {
+	s.sink.Info(0, fmt.Sprintf("message repeated %d times in %s", count, s.d.window), "message", msg)
+}
+
+func (s *dedupSink) WithValues(keysAndValues ...any) logr.LogSink {
+	return &dedupSink{sink: s.sink.WithValues(keysAndValues...), d: s.d, scope: s.scope + fmt.Sprint(keysAndValues...)}
+}
+
+func (s *dedupSink) WithName(name string) logr.LogSink {
+	return &dedupSink{sink: s.sink.WithName(name), d: s.d, scope: s.scope + "/" + name}
+}
+
+// WithCallDepth implements logr.CallDepthLogSink, so the callers are those of the messages
+func (s *dedupSink) WithCallDepth(depth int) logr.LogSink {
+	sink, ok := s.sink.(logr.CallDepthLogSink)
+	if !ok {
+		return s
+	}
+	return &dedupSink{sink: sink.WithCallDepth(depth), d: s.d, scope: s.scope}
+}
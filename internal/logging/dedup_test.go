@@ -0,0 +1,103 @@
+/*
+Copyright 2025 The llm-d Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package logging
+
+import (
+	"errors"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/go-logr/logr/funcr"
+	. "github.com/onsi/ginkgo/v2" //nolint:revive
+	. "github.com/onsi/gomega"    //nolint:revive
+)
+
+var _ = Describe("Log deduplication", func() {
+	const window = 200 * time.Millisecond
+
+	var (
+		mu     sync.Mutex
+		logs   []string
+		logger logr.Logger
+	)
+
+	BeforeEach(func() {
+		logs = nil
+		logger = Deduplicate(funcr.New(func(prefix, args string) {
+			mu.Lock()
+			defer mu.Unlock()
+			logs = append(logs, args)
+		}, funcr.Options{Verbosity: 4}), window)
+	})
+
+	written := func() []string {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]string(nil), logs...)
+	}
+
+	It("should log a repeated message once per window, then summarize the repeats", func() {
+		for range 5 {
+			logger.Error(errors.New("connection refused"), "waiting for vLLM to be ready")
+		}
+		Expect(written()).To(HaveLen(1))
+		Expect(written()[0]).To(ContainSubstring(`"msg"="waiting for vLLM to be ready"`))
+
+		Eventually(written).Should(HaveLen(2))
+		Expect(written()[1]).To(ContainSubstring(`"msg"="message repeated 4 times in 200ms"`))
+		Expect(written()[1]).To(ContainSubstring(`"message"="waiting for vLLM to be ready"`))
+
+		logger.Error(errors.New("connection refused"), "waiting for vLLM to be ready")
+		Expect(written()).To(HaveLen(3))
+	})
+
+	It("should not summarize a message logged once", func() {
+		logger.Info("starting")
+		Consistently(written, 2*window).Should(HaveLen(1))
+	})
+
+	It("should deduplicate the messages of each logger separately", func() {
+		for _, rank := range []string{"0", "1", "0", "1"} {
+			logger.WithName("proxy server").WithValues("dp_rank", rank).Info("warning: missing 'remote_block_ids' field in prefiller response")
+		}
+		logger.WithName("admin server").Info("warning: missing 'remote_block_ids' field in prefiller response")
+
+		Expect(written()).To(HaveLen(3))
+	})
+
+	It("should not deduplicate the verbose logs", func() {
+		for range 3 {
+			logger.V(4).Info("proxying request")
+		}
+		Expect(written()).To(HaveLen(3))
+	})
+
+	It("should keep the logger when disabled", func() {
+		Expect(Deduplicate(logr.Discard(), 0)).To(Equal(logr.Discard()))
+	})
+
+	It("should report the callers of the messages", func() {
+		logger = Deduplicate(funcr.New(func(prefix, args string) {
+			logs = append(logs, args)
+		}, funcr.Options{LogCaller: funcr.All}), window)
+		logger.Info("starting")
+
+		Expect(strings.Join(written(), "\n")).To(ContainSubstring(`"file"="dedup_test.go"`))
+	})
+})
@@ -0,0 +1,82 @@
+/*
+Copyright 2025 The llm-d Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package logging formats the logs of the routing sidecar
+package logging
+
+import (
+	"fmt"
+	"io"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/go-logr/logr/funcr"
+)
+
+const (
+	// FormatText is the klog text format
+	FormatText = "text"
+
+	// FormatJSON writes a JSON object per line, for log pipelines without klog parser
+	FormatJSON = "json"
+)
+
+// jsonKeys renames the log keys differing from the names of the metrics labels and trace
+// attributes, so the JSON logs can be joined with them
+var jsonKeys = map[string]string{
+	"inferencePool": "inference_pool",
+	"traceID":       "trace_id",
+	"requestID":     "request_id",
+}
+
+// NewJSON returns a logger writing a JSON object per line to w, with the timestamp, the caller
+// and the level, down to the given verbosity
+func NewJSON(w io.Writer, verbosity int) logr.Logger {
+	var mu sync.Mutex
+	return funcr.NewJSON(func(obj string) {
+		mu.Lock()
+		defer mu.Unlock()
+		fmt.Fprintln(w, obj) //nolint:all
+	}, funcr.Options{
+		LogCaller:        funcr.All,
+		LogTimestamp:     true,
+		TimestampFormat:  time.RFC3339Nano,
+		Verbosity:        verbosity,
+		RenderValuesHook: renameKeys,
+		RenderArgsHook:   renameKeys,
+	})
+}
+
+// renameKeys renames the keys of a key/value list to their JSON names, copying the list
+// owned by the caller only when needed
+func renameKeys(kvList []any) []any {
+	renamedList := kvList
+	for i := 0; i < len(kvList); i += 2 {
+		key, ok := kvList[i].(string)
+		if !ok {
+			continue
+		}
+		if renamed, ok := jsonKeys[key]; ok {
+			if &renamedList[0] == &kvList[0] {
+				renamedList = slices.Clone(kvList)
+			}
+			renamedList[i] = renamed
+		}
+	}
+	return renamedList
+}
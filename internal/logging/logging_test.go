@@ -0,0 +1,82 @@
+/*
+Copyright 2025 The llm-d Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"strings"
+
+	. "github.com/onsi/ginkgo/v2" //nolint:revive
+	. "github.com/onsi/gomega"    //nolint:revive
+)
+
+var _ = Describe("JSON logs", func() {
+	var buffer bytes.Buffer
+
+	BeforeEach(func() {
+		buffer.Reset()
+	})
+
+	lines := func() []map[string]any {
+		var objects []map[string]any
+		for _, line := range strings.Split(strings.TrimSpace(buffer.String()), "\n") {
+			object := map[string]any{}
+			Expect(json.Unmarshal([]byte(line), &object)).To(Succeed())
+			objects = append(objects, object)
+		}
+		return objects
+	}
+
+	It("should write a JSON object per line", func() {
+		logger := NewJSON(&buffer, 0).WithName("proxy server").WithValues("dp_rank", "0")
+		logger.Info("starting", "addr", ":8000")
+		logger.Error(errors.New("boom"), "failed")
+
+		objects := lines()
+		Expect(objects).To(HaveLen(2))
+		Expect(objects[0]).To(HaveKeyWithValue("msg", "starting"))
+		Expect(objects[0]).To(HaveKeyWithValue("logger", "proxy server"))
+		Expect(objects[0]).To(HaveKeyWithValue("dp_rank", "0"))
+		Expect(objects[0]).To(HaveKeyWithValue("addr", ":8000"))
+		Expect(objects[0]).To(HaveKey("ts"))
+		Expect(objects[0]).To(HaveKey("caller"))
+		Expect(objects[1]).To(HaveKeyWithValue("error", "boom"))
+	})
+
+	It("should name the keys like the metrics labels and trace attributes", func() {
+		logger := NewJSON(&buffer, 0).WithValues("inferencePool", "pool")
+		logger.Info("slow request", "traceID", "4bf92f3577b34da6a3ce929d0e0e4736")
+
+		objects := lines()
+		Expect(objects[0]).To(HaveKeyWithValue("inference_pool", "pool"))
+		Expect(objects[0]).To(HaveKeyWithValue("trace_id", "4bf92f3577b34da6a3ce929d0e0e4736"))
+		Expect(objects[0]).ToNot(HaveKey("inferencePool"))
+	})
+
+	It("should only write the logs up to the verbosity", func() {
+		logger := NewJSON(&buffer, 2)
+		logger.V(2).Info("shown")
+		logger.V(4).Info("hidden")
+
+		objects := lines()
+		Expect(objects).To(HaveLen(1))
+		Expect(objects[0]).To(HaveKeyWithValue("msg", "shown"))
+		Expect(objects[0]).To(HaveKeyWithValue("level", BeNumerically("==", 2)))
+	})
+})
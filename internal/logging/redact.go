@@ -0,0 +1,221 @@
+/*
+Copyright 2025 The llm-d Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package logging
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/go-logr/logr"
+)
+
+// Redacted replaces the values of the sensitive fields in the logs
+const Redacted = "[REDACTED]"
+
+// sensitiveFields are always redacted, compared once normalized
+var sensitiveFields = []string{
+	"authorization",
+	"proxy-authorization",
+	"x-api-key",
+	"api-key",
+	"cookie",
+	"set-cookie",
+	"password",
+	"secret",
+	"client-secret",
+	"token",
+	"access-token",
+	"refresh-token",
+	"sleep-control-token",
+}
+
+var (
+	// credentialPattern matches the credentials of the authorization headers
+	credentialPattern = regexp.MustCompile(`(?i)\b(bearer|basic)\s+[a-z0-9._~+/=-]+`)
+
+	// fieldPattern matches the fields of JSON objects, headers and query strings
+	fieldPattern = regexp.MustCompile(`(?i)("?)([a-z][a-z0-9_-]{0,63})("?\s*[:=]\s*)("(?:[^"\\]|\\.)*"|(?:(?:bearer|basic)\s+)?[^\s,&;"}]+)`)
+)
+
+// Redact returns a logger masking the sensitive fields, e.g. the Authorization headers and the
+// API keys, anywhere in the keys and values of the logs, including the proxied request and
+// error bodies. The given fields are redacted in addition to the built-in ones.
+func Redact(logger logr.Logger, fields []string) logr.Logger {
+	if logger.GetSink() == nil {
+		return logger
+	}
+	r := &redactor{fields: map[string]bool{}}
+	for _, field := range append(fields, sensitiveFields...) {
+		r.fields[normalizeField(field)] = true
+	}
+	// the sink is already initialized, only the frame of the redactSink is added
+	return logr.New(&redactSink{sink: logger.WithCallDepth(1).GetSink(), r: r})
+}
+
+// normalizeField folds the spellings of a field, e.g. X-Api-Key, x_api_key and xApiKey
+func normalizeField(field string) string {
+	return strings.NewReplacer("-", "", "_", "").Replace(strings.ToLower(field))
+}
+
+// redactor masks the values of the sensitive fields
+type redactor struct {
+	fields map[string]bool
+}
+
+func (r *redactor) sensitive(field string) bool {
+	return r.fields[normalizeField(field)]
+}
+
+// keysAndValues returns a copy of the keys and values with the sensitive values masked
+func (r *redactor) keysAndValues(keysAndValues []any) []any {
+	redacted := make([]any, len(keysAndValues))
+	for i, value := range keysAndValues {
+		if i%2 == 1 {
+			if key, ok := keysAndValues[i-1].(string); ok && r.sensitive(key) {
+				value = Redacted
+			} else {
+				value = r.value(value)
+			}
+		}
+		redacted[i] = value
+	}
+	return redacted
+}
+
+// value masks the sensitive fields of a logged value
+func (r *redactor) value(value any) any {
+	switch v := value.(type) {
+	case string:
+		return r.text(v)
+	case []byte:
+		return r.text(string(v))
+	case json.RawMessage:
+		return r.text(string(v))
+	case error:
+		if text := v.Error(); r.text(text) != text {
+			return redactedError(r.text(text))
+		}
+		return v
+	case http.Header:
+		header := make(http.Header, len(v))
+		for key, values := range v {
+			for _, value := range values {
+				if r.sensitive(key) {
+					value = Redacted
+				}
+				header.Add(key, r.text(value))
+			}
+		}
+		return header
+	case map[string]string:
+		m := make(map[string]string, len(v))
+		for key, value := range v {
+			if r.sensitive(key) {
+				value = Redacted
+			}
+			m[key] = r.text(value)
+		}
+		return m
+	case map[string]any:
+		m := make(map[string]any, len(v))
+		for key, value := range v {
+			if r.sensitive(key) {
+				value = Redacted
+			}
+			m[key] = r.value(value)
+		}
+		return m
+	case []any:
+		s := make([]any, len(v))
+		for i, value := range v {
+			s[i] = r.value(value)
+		}
+		return s
+	case logr.Marshaler:
+		return v
+	case fmt.Stringer:
+		return r.text(v.String())
+	default:
+		return value
+	}
+}
+
+// text masks the credentials and the values of the sensitive fields in a text
+func (r *redactor) text(text string) string {
+	text = credentialPattern.ReplaceAllString(text, "$1 "+Redacted)
+	return fieldPattern.ReplaceAllStringFunc(text, func(match string) string {
+		groups := fieldPattern.FindStringSubmatch(match)
+		if !r.sensitive(groups[2]) {
+			return match
+		}
+		value := Redacted
+		if strings.HasPrefix(groups[4], `"`) {
+			value = `"` + Redacted + `"`
+		}
+		return groups[1] + groups[2] + groups[3] + value
+	})
+}
+
+// redactedError is an error whose message was redacted
+type redactedError string
+
+func (e redactedError) Error() string {
+	return string(e)
+}
+
+// redactSink masks the sensitive fields of the logs of a logger
+type redactSink struct {
+	sink logr.LogSink
+	r    *redactor
+}
+
+func (s *redactSink) Init(logr.RuntimeInfo) {}
+
+func (s *redactSink) Enabled(level int) bool {
+	return s.sink.Enabled(level)
+}
+
+func (s *redactSink) Info(level int, msg string, keysAndValues ...any) {
+	s.sink.Info(level, msg, s.r.keysAndValues(keysAndValues)...)
+}
+
+func (s *redactSink) Error(err error, msg string, keysAndValues ...any) {
+	if err != nil {
+		err = s.r.value(err).(error)
+	}
+	s.sink.Error(err, msg, s.r.keysAndValues(keysAndValues)...)
+}
+
+func (s *redactSink) WithValues(keysAndValues ...any) logr.LogSink {
+	return &redactSink{sink: s.sink.WithValues(s.r.keysAndValues(keysAndValues)...), r: s.r}
+}
+
+func (s *redactSink) WithName(name string) logr.LogSink {
+	return &redactSink{sink: s.sink.WithName(name), r: s.r}
+}
+
+// WithCallDepth implements logr.CallDepthLogSink, so the callers are those of the messages
+func (s *redactSink) WithCallDepth(depth int) logr.LogSink {
+	sink, ok := s.sink.(logr.CallDepthLogSink)
+	if !ok {
+		return s
+	}
+	return &redactSink{sink: sink.WithCallDepth(depth), r: s.r}
+}
@@ -0,0 +1,95 @@
+/*
+Copyright 2025 The llm-d Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package logging
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/go-logr/logr"
+	"github.com/go-logr/logr/funcr"
+	. "github.com/onsi/ginkgo/v2" //nolint:revive
+	. "github.com/onsi/gomega"    //nolint:revive
+)
+
+var _ = Describe("Log redaction", func() {
+	var (
+		logs   []string
+		logger logr.Logger
+	)
+
+	BeforeEach(func() {
+		logs = nil
+		logger = Redact(funcr.New(func(prefix, args string) {
+			logs = append(logs, args)
+		}, funcr.Options{Verbosity: 5}), []string{"x-tenant-token"})
+	})
+
+	It("should redact the sensitive keys", func() {
+		logger.WithValues("apiKey", "sk-1").Info("request", "Authorization", "Bearer abc", "x_tenant_token", "t0k3n", "model", "llama")
+
+		Expect(logs).To(HaveLen(1))
+		Expect(logs[0]).ToNot(ContainSubstring("sk-1"))
+		Expect(logs[0]).ToNot(ContainSubstring("abc"))
+		Expect(logs[0]).ToNot(ContainSubstring("t0k3n"))
+		Expect(logs[0]).To(ContainSubstring(`"model"="llama"`))
+	})
+
+	It("should redact the sensitive fields of the bodies", func() {
+		logger.V(5).Info("sending request to prefiller", "body", []byte(`{"api_key":"sk-1","model":"llama","max_tokens":1}`))
+
+		Expect(logs[0]).To(ContainSubstring(`\"api_key\":\"[REDACTED]\"`))
+		Expect(logs[0]).To(ContainSubstring(`\"max_tokens\":1`))
+	})
+
+	It("should redact the credentials in the errors and messages", func() {
+		logger.Error(errors.New("upstream returned: Authorization: Bearer abc.def"), "prefill request failed", "message", "invalid x-api-key=sk-1&model=llama")
+
+		Expect(logs[0]).ToNot(ContainSubstring("abc.def"))
+		Expect(logs[0]).ToNot(ContainSubstring("sk-1"))
+		Expect(logs[0]).To(ContainSubstring("model=llama"))
+	})
+
+	It("should redact the headers", func() {
+		header := http.Header{"Authorization": {"Basic dXNlcjpwYXNz"}, "Content-Type": {"application/json"}}
+		logger.Info("request", "headers", header)
+
+		Expect(logs[0]).ToNot(ContainSubstring("dXNlcjpwYXNz"))
+		Expect(logs[0]).To(ContainSubstring("application/json"))
+		Expect(header.Get("Authorization")).To(Equal("Basic dXNlcjpwYXNz"))
+	})
+
+	It("should redact the stringers", func() {
+		logger.Info("request", "body", stringer(`{"token":"t0k3n"}`))
+
+		Expect(logs[0]).ToNot(ContainSubstring("t0k3n"))
+	})
+
+	It("should keep the logs without sensitive fields", func() {
+		err := errors.New("connection refused")
+		logger.Error(err, "waiting for vLLM to be ready", "target", "localhost:8001")
+
+		Expect(logs[0]).To(Equal(`"msg"="waiting for vLLM to be ready" "error"="connection refused" "target"="localhost:8001"`))
+	})
+})
+
+// stringer is a value logged as its String
+type stringer string
+
+func (s stringer) String() string {
+	return string(s)
+}
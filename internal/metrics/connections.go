@@ -0,0 +1,110 @@
+/*
+Copyright 2025 The llm-d Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package metrics
+
+import (
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// streamAgeBuckets are the bounds of the stream age distribution, in seconds, up to the
+// long generations a rollout waits for
+var streamAgeBuckets = []float64{10, 30, 60, 120, 300, 600, 1200, 1800, 3600}
+
+// ConnectionStats are the requests in flight of a proxy when the metrics are collected
+type ConnectionStats struct {
+	// StreamAges are the ages of the streamed responses in flight
+	StreamAges []time.Duration
+
+	// Draining reports whether the proxy is shutting down, waiting for its Requests in flight
+	// to complete
+	Draining bool
+	Requests int
+}
+
+// connectionsCollector collects the streams and the drain progress per data parallel rank
+type connectionsCollector struct {
+	activeStreams  *prometheus.Desc
+	streamAge      *prometheus.Desc
+	draining       *prometheus.Desc
+	drainRemaining *prometheus.Desc
+	mu             sync.Mutex
+	stats          map[string]func() ConnectionStats
+}
+
+var connections = &connectionsCollector{
+	activeStreams: prometheus.NewDesc(prometheus.BuildFQName(namespace, "", "active_streams"),
+		"Number of streamed responses in flight.",
+		[]string{RankLabel}, nil),
+	streamAge: prometheus.NewDesc(prometheus.BuildFQName(namespace, "", "active_stream_age_seconds"),
+		"Distribution of the ages of the streamed responses in flight, when collected.",
+		[]string{RankLabel}, nil),
+	draining: prometheus.NewDesc(prometheus.BuildFQName(namespace, "", "draining"),
+		"1 while the proxy is shutting down and waiting for the requests in flight to complete, 0 otherwise.",
+		[]string{RankLabel}, nil),
+	drainRemaining: prometheus.NewDesc(prometheus.BuildFQName(namespace, "", "drain_remaining_requests"),
+		"Number of requests in flight the proxy still waits for while shutting down, only reported while draining.",
+		[]string{RankLabel}, nil),
+	stats: map[string]func() ConnectionStats{},
+}
+
+// Describe implements prometheus.Collector
+func (c *connectionsCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.activeStreams
+	ch <- c.streamAge
+	ch <- c.draining
+	ch <- c.drainRemaining
+}
+
+// Collect implements prometheus.Collector
+func (c *connectionsCollector) Collect(ch chan<- prometheus.Metric) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for rank, collect := range c.stats {
+		stats := collect()
+		ch <- prometheus.MustNewConstMetric(c.activeStreams, prometheus.GaugeValue, float64(len(stats.StreamAges)), rank)
+
+		buckets := make(map[float64]uint64, len(streamAgeBuckets))
+		var sum float64
+		for _, age := range stats.StreamAges {
+			sum += age.Seconds()
+			for _, bound := range streamAgeBuckets {
+				if age.Seconds() <= bound {
+					buckets[bound]++
+				}
+			}
+		}
+		ch <- prometheus.MustNewConstHistogram(c.streamAge, uint64(len(stats.StreamAges)), sum, buckets, rank)
+
+		draining := 0.0
+		if stats.Draining {
+			draining = 1
+			ch <- prometheus.MustNewConstMetric(c.drainRemaining, prometheus.GaugeValue, float64(stats.Requests), rank)
+		}
+		ch <- prometheus.MustNewConstMetric(c.draining, prometheus.GaugeValue, draining, rank)
+	}
+}
+
+// RegisterConnections reports the streams and the drain progress of the proxy of the given
+// data parallel rank, replacing the previous one
+func RegisterConnections(rank string, stats func() ConnectionStats) {
+	connections.mu.Lock()
+	defer connections.mu.Unlock()
+	connections.stats[rank] = stats
+}
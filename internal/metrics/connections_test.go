@@ -0,0 +1,77 @@
+/*
+Copyright 2025 The llm-d Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package metrics
+
+import (
+	"time"
+
+	dto "github.com/prometheus/client_model/go"
+
+	. "github.com/onsi/ginkgo/v2" // nolint:revive
+	. "github.com/onsi/gomega"    // nolint:revive
+)
+
+var _ = Describe("Connections", func() {
+	// gather returns the connection metrics of the rank
+	gather := func(rank string) map[string]*dto.Metric {
+		families, err := Registry.Gather()
+		Expect(err).ToNot(HaveOccurred())
+		collected := map[string]*dto.Metric{}
+		for _, family := range families {
+			for _, metric := range family.Metric {
+				for _, label := range metric.Label {
+					if label.GetName() == RankLabel && label.GetValue() == rank {
+						collected[family.GetName()] = metric
+					}
+				}
+			}
+		}
+		return collected
+	}
+
+	It("should report the streams and their ages", func() {
+		RegisterConnections("connections-streams", func() ConnectionStats {
+			return ConnectionStats{StreamAges: []time.Duration{5 * time.Second, 45 * time.Second, 2 * time.Hour}, Requests: 4}
+		})
+
+		collected := gather("connections-streams")
+		Expect(collected["llm_d_routing_sidecar_active_streams"].GetGauge().GetValue()).To(Equal(3.0))
+		Expect(collected["llm_d_routing_sidecar_draining"].GetGauge().GetValue()).To(BeZero())
+		Expect(collected).ToNot(HaveKey("llm_d_routing_sidecar_drain_remaining_requests"))
+
+		ages := collected["llm_d_routing_sidecar_active_stream_age_seconds"].GetHistogram()
+		Expect(ages.GetSampleCount()).To(Equal(uint64(3)))
+		Expect(ages.GetSampleSum()).To(Equal(7250.0))
+		counts := map[float64]uint64{}
+		for _, bucket := range ages.Bucket {
+			counts[bucket.GetUpperBound()] = bucket.GetCumulativeCount()
+		}
+		Expect(counts).To(HaveKeyWithValue(10.0, uint64(1)))
+		Expect(counts).To(HaveKeyWithValue(60.0, uint64(2)))
+		Expect(counts).To(HaveKeyWithValue(3600.0, uint64(2)))
+	})
+
+	It("should report the drain progress", func() {
+		RegisterConnections("connections-draining", func() ConnectionStats {
+			return ConnectionStats{StreamAges: []time.Duration{time.Minute}, Draining: true, Requests: 2}
+		})
+
+		collected := gather("connections-draining")
+		Expect(collected["llm_d_routing_sidecar_draining"].GetGauge().GetValue()).To(Equal(1.0))
+		Expect(collected["llm_d_routing_sidecar_drain_remaining_requests"].GetGauge().GetValue()).To(Equal(2.0))
+	})
+})
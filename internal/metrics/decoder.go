@@ -0,0 +1,123 @@
+/*
+Copyright 2025 The llm-d Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
+	"google.golang.org/protobuf/proto"
+)
+
+// ScrapeFunc returns the metrics exposed by a decoder in the Prometheus text format
+type ScrapeFunc func() (io.Reader, error)
+
+// decoderGatherer scrapes the metrics exposed by a decoder and adds labels to every sample
+type decoderGatherer struct {
+	scrape ScrapeFunc
+	labels prometheus.Labels
+}
+
+// NewDecoderGatherer returns a gatherer scraping the decoder metrics with scrape and
+// relabeling every sample with the given labels, so they can be merged with the sidecar metrics.
+func NewDecoderGatherer(scrape ScrapeFunc, labels prometheus.Labels) prometheus.Gatherer {
+	return &decoderGatherer{
+		scrape: scrape,
+		labels: labels,
+	}
+}
+
+// Gather implements prometheus.Gatherer
+func (g *decoderGatherer) Gather() ([]*dto.MetricFamily, error) {
+	r, err := g.scrape()
+	if err != nil {
+		return nil, fmt.Errorf("failed to scrape decoder metrics: %w", err)
+	}
+
+	var parser expfmt.TextParser
+	families, err := parser.TextToMetricFamilies(r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse decoder metrics: %w", err)
+	}
+
+	result := make([]*dto.MetricFamily, 0, len(families))
+	for _, family := range families {
+		for _, metric := range family.Metric {
+			metric.Label = relabel(metric.Label, g.labels)
+		}
+		result = append(result, family)
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].GetName() < result[j].GetName()
+	})
+	return result, nil
+}
+
+// labeledGatherer adds labels to every sample of the metrics gathered
+type labeledGatherer struct {
+	gatherer prometheus.Gatherer
+	labels   prometheus.Labels
+}
+
+// WithLabels returns a gatherer relabeling every sample gathered with the given labels,
+// e.g. the identity of the pod
+func WithLabels(gatherer prometheus.Gatherer, labels prometheus.Labels) prometheus.Gatherer {
+	if len(labels) == 0 {
+		return gatherer
+	}
+	return &labeledGatherer{
+		gatherer: gatherer,
+		labels:   labels,
+	}
+}
+
+// Gather implements prometheus.Gatherer
+func (g *labeledGatherer) Gather() ([]*dto.MetricFamily, error) {
+	families, err := g.gatherer.Gather()
+	for _, family := range families {
+		for _, metric := range family.Metric {
+			metric.Label = relabel(metric.Label, g.labels)
+		}
+	}
+	return families, err
+}
+
+// relabel sets the given labels on a sample, replacing the existing values
+func relabel(pairs []*dto.LabelPair, labels prometheus.Labels) []*dto.LabelPair {
+	result := make([]*dto.LabelPair, 0, len(pairs)+len(labels))
+	for _, pair := range pairs {
+		if _, ok := labels[pair.GetName()]; !ok {
+			result = append(result, pair)
+		}
+	}
+	for name, value := range labels {
+		result = append(result, &dto.LabelPair{
+			Name:  proto.String(name),
+			Value: proto.String(value),
+		})
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].GetName() < result[j].GetName()
+	})
+	return result
+}
@@ -0,0 +1,93 @@
+/*
+Copyright 2025 The llm-d Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package metrics
+
+import (
+	"errors"
+	"io"
+	"strings"
+
+	. "github.com/onsi/ginkgo/v2" // nolint:revive
+	. "github.com/onsi/gomega"    // nolint:revive
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const decoderMetrics = `# HELP vllm:num_requests_running Number of requests currently running.
+# TYPE vllm:num_requests_running gauge
+vllm:num_requests_running{model_name="Qwen/Qwen2-0.5B"} 3
+# HELP vllm:prompt_tokens_total Number of prefill tokens processed.
+# TYPE vllm:prompt_tokens_total counter
+vllm:prompt_tokens_total{decoder="stale",model_name="Qwen/Qwen2-0.5B"} 42
+`
+
+var _ = Describe("Decoder gatherer", func() {
+	It("should add the labels to every decoder sample", func() {
+		gatherer := NewDecoderGatherer(func() (io.Reader, error) {
+			return strings.NewReader(decoderMetrics), nil
+		}, prometheus.Labels{"decoder": "localhost:8001"})
+
+		families, err := gatherer.Gather()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(families).To(HaveLen(2))
+		Expect(families[0].GetName()).To(Equal("vllm:num_requests_running"))
+		Expect(families[1].GetName()).To(Equal("vllm:prompt_tokens_total"))
+
+		for _, family := range families {
+			Expect(family.Metric).To(HaveLen(1))
+			labels := map[string]string{}
+			for _, pair := range family.Metric[0].Label {
+				labels[pair.GetName()] = pair.GetValue()
+			}
+			Expect(labels).To(Equal(map[string]string{
+				"decoder":    "localhost:8001",
+				"model_name": "Qwen/Qwen2-0.5B",
+			}))
+		}
+	})
+
+	It("should return an error when the decoder cannot be scraped", func() {
+		gatherer := NewDecoderGatherer(func() (io.Reader, error) {
+			return nil, errors.New("connection refused")
+		}, prometheus.Labels{"decoder": "localhost:8001"})
+
+		_, err := gatherer.Gather()
+		Expect(err).To(MatchError(ContainSubstring("connection refused")))
+	})
+})
+
+var _ = Describe("Labeled gatherer", func() {
+	It("should add the labels to every sample", func() {
+		registry := prometheus.NewRegistry()
+		counter := prometheus.NewCounterVec(prometheus.CounterOpts{Name: "test_total", Help: "Test."}, []string{"route"})
+		registry.MustRegister(counter)
+		counter.WithLabelValues("/v1/completions").Inc()
+
+		families, err := WithLabels(registry, prometheus.Labels{"pod": "decode-0"}).Gather()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(families).To(HaveLen(1))
+		labels := map[string]string{}
+		for _, pair := range families[0].Metric[0].Label {
+			labels[pair.GetName()] = pair.GetValue()
+		}
+		Expect(labels).To(Equal(map[string]string{"pod": "decode-0", "route": "/v1/completions"}))
+	})
+
+	It("should return the gatherer without labels", func() {
+		registry := prometheus.NewRegistry()
+		Expect(WithLabels(registry, nil)).To(BeIdenticalTo(registry))
+	})
+})
@@ -0,0 +1,142 @@
+/*
+Copyright 2025 The llm-d Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package metrics
+
+import (
+	"hash/fnv"
+	"strconv"
+	"sync/atomic"
+)
+
+// otherLabelValue replaces the label values out of the allowlist
+const otherLabelValue = "other"
+
+// LabelOptions controls the values of an optional label of the completion request metrics
+type LabelOptions struct {
+	// Enabled attaches the label to the metrics, left empty otherwise
+	Enabled bool
+
+	// Allowlist holds the values kept as is. The other values are replaced with "other", or
+	// hashed when HashBuckets is set. All the values are kept when both are empty.
+	Allowlist []string
+
+	// HashBuckets hashes the values out of the allowlist into this number of values, e.g. to
+	// tell tenants apart without exposing their IDs. Zero replaces them with "other".
+	HashBuckets int
+}
+
+// LabelConfig controls the optional labels of the completion request metrics, bounding
+// their cardinality in clusters serving many models or tenants
+type LabelConfig struct {
+	// Model is the label of the model requested
+	Model LabelOptions
+
+	// Tenant is the label of the tenant, read from the TenantHeader request header
+	Tenant LabelOptions
+
+	// TenantHeader is the request header holding the tenant
+	TenantHeader string
+
+	// Prefiller is the label of the prefiller host:port of disaggregated requests
+	Prefiller LabelOptions
+}
+
+// CompletionLabels are the values of the optional labels of a completion request
+type CompletionLabels struct {
+	Model     string
+	Tenant    string
+	Prefiller string
+}
+
+// labelConfig is the configuration of the optional labels, compiled
+var labelConfig atomic.Pointer[compiledLabelConfig]
+
+func init() {
+	ConfigureLabels(LabelConfig{Model: LabelOptions{Enabled: true}})
+}
+
+// compiledLabelConfig is a LabelConfig with its allowlists indexed
+type compiledLabelConfig struct {
+	model        compiledLabelOptions
+	tenant       compiledLabelOptions
+	tenantHeader string
+	prefiller    compiledLabelOptions
+}
+
+type compiledLabelOptions struct {
+	enabled     bool
+	allowlist   map[string]struct{}
+	hashBuckets int
+}
+
+// ConfigureLabels sets which optional labels are attached to the completion request metrics.
+// Only the model label is attached by default.
+func ConfigureLabels(config LabelConfig) {
+	labelConfig.Store(&compiledLabelConfig{
+		model:        compileLabelOptions(config.Model),
+		tenant:       compileLabelOptions(config.Tenant),
+		tenantHeader: config.TenantHeader,
+		prefiller:    compileLabelOptions(config.Prefiller),
+	})
+}
+
+// TenantHeader returns the request header holding the tenant when the tenant label is
+// attached, empty otherwise
+func TenantHeader() string {
+	config := labelConfig.Load()
+	if !config.tenant.enabled {
+		return ""
+	}
+	return config.tenantHeader
+}
+
+func compileLabelOptions(options LabelOptions) compiledLabelOptions {
+	compiled := compiledLabelOptions{enabled: options.Enabled, hashBuckets: options.HashBuckets}
+	if len(options.Allowlist) > 0 {
+		compiled.allowlist = make(map[string]struct{}, len(options.Allowlist))
+		for _, value := range options.Allowlist {
+			compiled.allowlist[value] = struct{}{}
+		}
+	}
+	return compiled
+}
+
+// values returns the label values of a completion request, bounded as configured
+func (l CompletionLabels) values() (model string, tenant string, prefiller string) {
+	config := labelConfig.Load()
+	return config.model.value(l.Model), config.tenant.value(l.Tenant), config.prefiller.value(l.Prefiller)
+}
+
+// value returns the label value of the given value
+func (o *compiledLabelOptions) value(value string) string {
+	switch {
+	case !o.enabled || value == "":
+		return ""
+	case o.allowlist == nil && o.hashBuckets <= 0:
+		return value
+	}
+	if _, ok := o.allowlist[value]; ok {
+		return value
+	}
+	if o.hashBuckets <= 0 {
+		return otherLabelValue
+	}
+
+	h := fnv.New32a()
+	h.Write([]byte(value)) //nolint:all
+	return "hash-" + strconv.Itoa(int(h.Sum32()%uint32(o.hashBuckets)))
+}
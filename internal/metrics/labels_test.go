@@ -0,0 +1,82 @@
+/*
+Copyright 2025 The llm-d Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package metrics
+
+import (
+	"fmt"
+
+	. "github.com/onsi/ginkgo/v2" // nolint:revive
+	. "github.com/onsi/gomega"    // nolint:revive
+)
+
+var _ = Describe("Completion labels", func() {
+	labels := CompletionLabels{Model: "llama", Tenant: "acme", Prefiller: "10.0.0.1:8000"}
+
+	configure := func(config LabelConfig) {
+		ConfigureLabels(config)
+		DeferCleanup(ConfigureLabels, LabelConfig{Model: LabelOptions{Enabled: true}})
+	}
+
+	It("should only attach the model label by default", func() {
+		model, tenant, prefiller := labels.values()
+		Expect(model).To(Equal("llama"))
+		Expect(tenant).To(BeEmpty())
+		Expect(prefiller).To(BeEmpty())
+		Expect(TenantHeader()).To(BeEmpty())
+	})
+
+	It("should attach the enabled labels", func() {
+		configure(LabelConfig{
+			Tenant:       LabelOptions{Enabled: true},
+			TenantHeader: "X-Tenant",
+			Prefiller:    LabelOptions{Enabled: true},
+		})
+
+		model, tenant, prefiller := labels.values()
+		Expect(model).To(BeEmpty())
+		Expect(tenant).To(Equal("acme"))
+		Expect(prefiller).To(Equal("10.0.0.1:8000"))
+		Expect(TenantHeader()).To(Equal("X-Tenant"))
+	})
+
+	It("should report the values out of the allowlist as other", func() {
+		configure(LabelConfig{Model: LabelOptions{Enabled: true, Allowlist: []string{"llama", "mistral"}}})
+
+		Expect(CompletionLabels{Model: "mistral"}.values()).To(Equal("mistral"))
+		Expect(CompletionLabels{Model: "qwen"}.values()).To(Equal("other"))
+		Expect(CompletionLabels{}.values()).To(BeEmpty())
+	})
+
+	It("should hash the values out of the allowlist into buckets", func() {
+		configure(LabelConfig{Tenant: LabelOptions{Enabled: true, Allowlist: []string{"acme"}, HashBuckets: 4}, TenantHeader: "X-Tenant"})
+
+		_, tenant, _ := labels.values()
+		Expect(tenant).To(Equal("acme"))
+
+		hashed := map[string]bool{}
+		for i := range 100 {
+			_, tenant, _ := CompletionLabels{Tenant: fmt.Sprintf("tenant-%d", i)}.values()
+			Expect(tenant).To(HavePrefix("hash-"))
+			hashed[tenant] = true
+		}
+		Expect(len(hashed)).To(BeNumerically("<=", 4))
+
+		_, first, _ := CompletionLabels{Tenant: "tenant-1"}.values()
+		_, second, _ := CompletionLabels{Tenant: "tenant-1"}.values()
+		Expect(first).To(Equal(second))
+	})
+})
@@ -0,0 +1,705 @@
+/*
+Copyright 2025 The llm-d Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package metrics contains the routing sidecar Prometheus metrics
+package metrics
+
+import (
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+)
+
+const (
+	namespace = "llm_d_routing_sidecar"
+
+	// RankLabel is the label holding the data parallel rank handled by a proxy
+	RankLabel = "dp_rank"
+
+	// TraceIDLabel is the exemplar label holding the ID of the trace of a request
+	TraceIDLabel = "trace_id"
+)
+
+var (
+	// Registry holds the routing sidecar metrics
+	Registry = prometheus.NewRegistry()
+
+	requestsTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "requests_total",
+			Help:      "Total number of requests handled by the sidecar, by route and status code.",
+		},
+		[]string{RankLabel, "route", "code"},
+	)
+
+	requestDuration = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "request_duration_seconds",
+			Help:      "End-to-end latency of the requests handled by the sidecar, by route.",
+			Buckets:   []float64{0.01, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60, 120, 300, 600},
+		},
+		[]string{RankLabel, "route"},
+	)
+
+	prefillRequestsTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "prefill_requests_total",
+			Help:      "Total number of requests sent to prefillers, by connector and status code.",
+		},
+		[]string{RankLabel, "connector", "code"},
+	)
+
+	sloBudgetExceededTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "slo_budget_exceeded_total",
+			Help:      "Total number of requests whose prefill was skipped or canceled because it exceeded the TTFT budget, by connector.",
+		},
+		[]string{RankLabel, "connector"},
+	)
+
+	modalityRequestsTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "modality_requests_total",
+			Help:      "Total number of completion requests, by content modality and whether the prefill was disaggregated.",
+		},
+		[]string{RankLabel, "modality", "disaggregated"},
+	)
+
+	promptSizeRequestsTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "prompt_size_requests_total",
+			Help:      "Total number of completion requests, by estimated prompt size in tokens and whether the prefill was disaggregated.",
+		},
+		[]string{RankLabel, "prompt_size", "disaggregated"},
+	)
+
+	promptSizeDuration = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "prompt_size_request_duration_seconds",
+			Help:      "End-to-end latency of the completion requests, by estimated prompt size in tokens and whether the prefill was disaggregated.",
+			Buckets:   []float64{0.01, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60, 120, 300, 600},
+		},
+		[]string{RankLabel, "prompt_size", "disaggregated"},
+	)
+
+	hedgedRequestsTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "hedged_requests_total",
+			Help:      "Total number of decode requests hedged to a sibling data parallel rank, by winning request (primary or hedge).",
+		},
+		[]string{RankLabel, "winner"},
+	)
+
+	prefillCacheRequestsTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "prefill_cache_requests_total",
+			Help:      "Total number of disaggregated requests looked up in the prefill cache, by result (hit or miss).",
+		},
+		[]string{RankLabel, "result"},
+	)
+
+	prefixCacheDecisionsTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "prefix_cache_decisions_total",
+			Help:      "Total number of disaggregated requests by prefill decision, local when the decoder is estimated to cache the prompt prefix or remote.",
+		},
+		[]string{RankLabel, "prefill"},
+	)
+
+	policyDecisionsTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "routing_policy_decisions_total",
+			Help:      "Total number of completion requests by routing policy decision (allow, deny, decode, rewrite or error).",
+		},
+		[]string{RankLabel, "decision"},
+	)
+
+	kvEventsTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "kv_events_total",
+			Help:      "Total number of KV cache event batches of the engine relayed, by result (relayed or failed).",
+		},
+		[]string{"result"},
+	)
+
+	upgradedConnections = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "upgraded_connections",
+			Help:      "Number of open upgraded (e.g. WebSocket) connections, by protocol.",
+		},
+		[]string{RankLabel, "protocol"},
+	)
+
+	upgradedConnectionDuration = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "upgraded_connection_duration_seconds",
+			Help:      "Lifetime of the upgraded connections, by protocol.",
+			Buckets:   []float64{0.1, 1, 5, 10, 30, 60, 300, 600, 1800, 3600},
+		},
+		[]string{RankLabel, "protocol"},
+	)
+
+	upgradedConnectionBytes = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "upgraded_connection_bytes_total",
+			Help:      "Total number of bytes relayed over upgraded connections, by protocol and direction (sent to or received from the decoder).",
+		},
+		[]string{RankLabel, "protocol", "direction"},
+	)
+
+	requestSize = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "request_size_bytes",
+			Help:      "Size of the completion request bodies sent to the prefillers and the decoder, by route, model, tenant, prefiller and leg (prefill or decode).",
+			Buckets:   []float64{256, 1024, 4096, 16384, 65536, 262144, 1048576, 4194304, 16777216, 67108864},
+		},
+		[]string{RankLabel, "route", "model", "tenant", "prefiller", "leg"},
+	)
+
+	responseSize = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "response_size_bytes",
+			Help:      "Size of the completion response bodies streamed to the clients, by route, model, tenant and prefiller.",
+			Buckets:   []float64{256, 1024, 4096, 16384, 65536, 262144, 1048576, 4194304, 16777216, 67108864},
+		},
+		[]string{RankLabel, "route", "model", "tenant", "prefiller"},
+	)
+
+	completionRequestsTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "completion_requests_total",
+			Help:      "Total number of completion requests, by route, model, tenant, prefiller and status code.",
+		},
+		[]string{RankLabel, "route", "model", "tenant", "prefiller", "code"},
+	)
+
+	completionRequestDuration = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "completion_request_duration_seconds",
+			Help:      "End-to-end latency of the completion requests, by route, model, tenant and prefiller.",
+			Buckets:   []float64{0.01, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60, 120, 300, 600},
+		},
+		[]string{RankLabel, "route", "model", "tenant", "prefiller"},
+	)
+
+	allowlistWatchReconnectsTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "ssrf_allowlist_watch_reconnects_total",
+			Help:      "Total number of reconnections of the InferencePool and pod watches of the SSRF protection after a failure.",
+		},
+		[]string{RankLabel},
+	)
+
+	allowlistSyncAge = &ageCollector{
+		desc: prometheus.NewDesc(prometheus.BuildFQName(namespace, "", "ssrf_allowlist_sync_age_seconds"),
+			"Seconds since the SSRF protection allowlist was last in sync with the API server, 0 while the InferencePool is watched.",
+			[]string{RankLabel}, nil),
+		ages: map[string]func() time.Duration{},
+	}
+
+	admissionQueueDepth = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "admission_queue_depth",
+			Help:      "Number of requests waiting in the admission queue, by priority class.",
+		},
+		[]string{RankLabel, "priority"},
+	)
+
+	admissionQueueWait = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "admission_queue_wait_seconds",
+			Help:      "Time the admitted requests waited in the admission queue, by priority class.",
+			Buckets:   []float64{0.001, 0.01, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60},
+		},
+		[]string{RankLabel, "priority"},
+	)
+
+	admissionRejectedTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "admission_rejected_total",
+			Help:      "Total number of requests rejected by the admission queue, by priority class and reason (full or timeout).",
+		},
+		[]string{RankLabel, "priority", "reason"},
+	)
+
+	usageTokensTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "usage_tokens_total",
+			Help:      "Total number of tokens reported in the usage of the streamed completion requests, by route, model, tenant, prefiller and type (prompt or completion).",
+		},
+		[]string{RankLabel, "route", "model", "tenant", "prefiller", "type"},
+	)
+
+	clientCancellationsTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "client_cancellations_total",
+			Help:      "Total number of completion requests canceled by the client, by phase (queued, prefill, decode or streaming).",
+		},
+		[]string{RankLabel, "phase"},
+	)
+
+	decodeTargetRequestsTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "decode_target_requests_total",
+			Help:      "Total number of decode requests split between the stable and canary engines, by target and status code.",
+		},
+		[]string{RankLabel, "target", "code"},
+	)
+
+	decodeTargetDuration = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "decode_target_duration_seconds",
+			Help:      "Latency of the decode requests split between the stable and canary engines, by target.",
+			Buckets:   []float64{0.01, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60, 120, 300, 600},
+		},
+		[]string{RankLabel, "target"},
+	)
+
+	connectorRequestsTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "connector_requests_total",
+			Help:      "Total number of disaggregated requests assigned to the configured or experiment connector, by connector and status code.",
+		},
+		[]string{RankLabel, "connector", "code"},
+	)
+
+	connectorRequestDuration = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "connector_request_duration_seconds",
+			Help:      "Latency of the disaggregated requests assigned to the configured or experiment connector, by connector.",
+			Buckets:   []float64{0.01, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60, 120, 300, 600},
+		},
+		[]string{RankLabel, "connector"},
+	)
+
+	deprecatedUsesTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "deprecated_uses_total",
+			Help:      "Total number of requests using a deprecated header or connector, by feature.",
+		},
+		[]string{RankLabel, "feature"},
+	)
+
+	requestTimeoutsTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "request_timeouts_total",
+			Help:      "Total number of completion requests canceled by their deadline, or by the idle timeout of their stream, by timeout.",
+		},
+		[]string{RankLabel, "timeout"},
+	)
+
+	stalledStreamsTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "stalled_streams_total",
+			Help:      "Total number of decoder event streams canceled after receiving no data for the stall timeout.",
+		},
+		[]string{RankLabel},
+	)
+
+	decodeReplaysTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "decode_replays_total",
+			Help:      "Total number of decode-only requests replayed after a decoder connection reset, by target: local or sibling rank.",
+		},
+		[]string{RankLabel, "target"},
+	)
+
+	upstreamErrorsTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "upstream_errors_total",
+			Help:      "Total number of failed requests to the decoder or prefillers, by upstream and error class.",
+		},
+		[]string{RankLabel, "upstream", "class"},
+	)
+
+	batches = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "batches",
+			Help:      "Number of batches of the batch API queued or active.",
+		},
+		[]string{RankLabel, "state"},
+	)
+
+	batchItemFailuresTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "batch_item_failures_total",
+			Help:      "Total number of failed batch items, by reason: timeout or error.",
+		},
+		[]string{RankLabel, "reason"},
+	)
+
+	prefillerSelectionsTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "prefiller_selections_total",
+			Help:      "Total number of prefill targets selected among the candidate prefillers of the requests, by strategy and prefiller.",
+		},
+		[]string{RankLabel, "strategy", "prefiller"},
+	)
+
+	panicsTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "panics_total",
+			Help:      "Total number of panics recovered in the request handlers, by route.",
+		},
+		[]string{RankLabel, "route"},
+	)
+
+	kvTransferRetriesTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "kv_transfer_retries_total",
+			Help:      "Total number of disaggregated requests retried after the decoder failed to pull the KV blocks, by retry: prefill or decode-only.",
+		},
+		[]string{RankLabel, "retry"},
+	)
+
+	prefillDuration = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "prefill_duration_seconds",
+			Help:      "Latency of the requests sent to prefillers, by connector.",
+			Buckets:   []float64{0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60},
+		},
+		[]string{RankLabel, "connector"},
+	)
+)
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		requestsTotal,
+		requestDuration,
+		prefillRequestsTotal,
+		prefillDuration,
+		sloBudgetExceededTotal,
+		modalityRequestsTotal,
+		promptSizeRequestsTotal,
+		promptSizeDuration,
+		hedgedRequestsTotal,
+		prefillCacheRequestsTotal,
+		prefixCacheDecisionsTotal,
+		policyDecisionsTotal,
+		kvEventsTotal,
+		upgradedConnections,
+		upgradedConnectionDuration,
+		upgradedConnectionBytes,
+		requestSize,
+		responseSize,
+		completionRequestsTotal,
+		completionRequestDuration,
+		allowlistWatchReconnectsTotal,
+		allowlistSyncAge,
+		connections,
+		admissionQueueDepth,
+		admissionQueueWait,
+		admissionRejectedTotal,
+		clientCancellationsTotal,
+		usageTokensTotal,
+		decodeTargetRequestsTotal,
+		decodeTargetDuration,
+		connectorRequestsTotal,
+		connectorRequestDuration,
+		deprecatedUsesTotal,
+		requestTimeoutsTotal,
+		stalledStreamsTotal,
+		decodeReplaysTotal,
+		upstreamErrorsTotal,
+		kvTransferRetriesTotal,
+		panicsTotal,
+		batches,
+		batchItemFailuresTotal,
+		prefillerSelectionsTotal,
+	)
+}
+
+// ageCollector collects a gauge of the age computed by a function per data parallel rank
+type ageCollector struct {
+	desc *prometheus.Desc
+	mu   sync.Mutex
+	ages map[string]func() time.Duration
+}
+
+// Describe implements prometheus.Collector
+func (c *ageCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.desc
+}
+
+// Collect implements prometheus.Collector
+func (c *ageCollector) Collect(ch chan<- prometheus.Metric) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for rank, age := range c.ages {
+		ch <- prometheus.MustNewConstMetric(c.desc, prometheus.GaugeValue, age().Seconds(), rank)
+	}
+}
+
+// RecordRequest records a request handled by the proxy of the given data parallel rank.
+// The trace ID, if any, is attached as exemplar to the latency.
+func RecordRequest(rank string, route string, code int, duration time.Duration, traceID string) {
+	requestsTotal.WithLabelValues(rank, route, strconv.Itoa(code)).Inc()
+	observe(requestDuration.WithLabelValues(rank, route), duration, traceID)
+}
+
+// RecordPrefill records a request sent to a prefiller by the proxy of the given data parallel rank.
+// The trace ID, if any, is attached as exemplar to the latency.
+func RecordPrefill(rank string, connector string, code int, duration time.Duration, traceID string) {
+	prefillRequestsTotal.WithLabelValues(rank, connector, strconv.Itoa(code)).Inc()
+	observe(prefillDuration.WithLabelValues(rank, connector), duration, traceID)
+}
+
+// RecordRequestSize records the size of a completion request body sent to a prefiller or the decoder
+func RecordRequestSize(rank string, route string, labels CompletionLabels, leg string, size int64) {
+	model, tenant, prefiller := labels.values()
+	requestSize.WithLabelValues(rank, route, model, tenant, prefiller, leg).Observe(float64(size))
+}
+
+// RecordCompletion records a completion request served, with the size of the response body
+// sent to the client. The trace ID, if any, is attached as exemplar to the latency.
+func RecordCompletion(rank string, route string, labels CompletionLabels, code int, size int64, duration time.Duration, traceID string) {
+	model, tenant, prefiller := labels.values()
+	completionRequestsTotal.WithLabelValues(rank, route, model, tenant, prefiller, strconv.Itoa(code)).Inc()
+	observe(completionRequestDuration.WithLabelValues(rank, route, model, tenant, prefiller), duration, traceID)
+	responseSize.WithLabelValues(rank, route, model, tenant, prefiller).Observe(float64(size))
+}
+
+// RegisterAllowlistSyncAge reports the age of the SSRF protection allowlist of the given data
+// parallel rank, replacing the previous one
+func RegisterAllowlistSyncAge(rank string, age func() time.Duration) {
+	allowlistSyncAge.mu.Lock()
+	defer allowlistSyncAge.mu.Unlock()
+	allowlistSyncAge.ages[rank] = age
+}
+
+// RecordAllowlistWatchReconnect records a reconnection of a watch of the SSRF protection after a failure
+func RecordAllowlistWatchReconnect(rank string) {
+	allowlistWatchReconnectsTotal.WithLabelValues(rank).Inc()
+}
+
+// RecordUsage records the prompt and completion tokens reported in the usage of a completion request
+func RecordUsage(rank string, route string, labels CompletionLabels, promptTokens int, completionTokens int) {
+	model, tenant, prefiller := labels.values()
+	usageTokensTotal.WithLabelValues(rank, route, model, tenant, prefiller, "prompt").Add(float64(promptTokens))
+	usageTokensTotal.WithLabelValues(rank, route, model, tenant, prefiller, "completion").Add(float64(completionTokens))
+}
+
+// SetAdmissionQueueDepth records the number of requests of a priority class waiting in the admission queue
+func SetAdmissionQueueDepth(rank string, priority string, depth int) {
+	admissionQueueDepth.WithLabelValues(rank, priority).Set(float64(depth))
+}
+
+// RecordAdmissionWait records the time a request waited in the admission queue before being admitted
+func RecordAdmissionWait(rank string, priority string, wait time.Duration) {
+	admissionQueueWait.WithLabelValues(rank, priority).Observe(wait.Seconds())
+}
+
+// RecordAdmissionRejected records a request rejected by the admission queue
+func RecordAdmissionRejected(rank string, priority string, reason string) {
+	admissionRejectedTotal.WithLabelValues(rank, priority, reason).Inc()
+}
+
+// RecordClientCancellation records a completion request canceled by the client in the given phase
+func RecordClientCancellation(rank string, phase string) {
+	clientCancellationsTotal.WithLabelValues(rank, phase).Inc()
+}
+
+// RecordDecodeTarget records a decode request sent to the stable or canary engine
+func RecordDecodeTarget(rank string, target string, code int, duration time.Duration) {
+	decodeTargetRequestsTotal.WithLabelValues(rank, target, strconv.Itoa(code)).Inc()
+	decodeTargetDuration.WithLabelValues(rank, target).Observe(duration.Seconds())
+}
+
+// RecordConnectorRequest records a disaggregated request assigned to the configured or experiment connector
+func RecordConnectorRequest(rank string, connector string, code int, duration time.Duration) {
+	connectorRequestsTotal.WithLabelValues(rank, connector, strconv.Itoa(code)).Inc()
+	connectorRequestDuration.WithLabelValues(rank, connector).Observe(duration.Seconds())
+}
+
+// RecordDeprecatedUse records a request using a deprecated header or connector
+func RecordDeprecatedUse(rank string, feature string) {
+	deprecatedUsesTotal.WithLabelValues(rank, feature).Inc()
+}
+
+// RecordRequestTimeout records a completion request canceled by the given timeout: deadline or idle
+func RecordRequestTimeout(rank string, timeout string) {
+	requestTimeoutsTotal.WithLabelValues(rank, timeout).Inc()
+}
+
+// RecordStalledStream records a decoder event stream canceled by the stall watchdog
+func RecordStalledStream(rank string) {
+	stalledStreamsTotal.WithLabelValues(rank).Inc()
+}
+
+// RecordDecodeReplay records a decode-only request replayed after a decoder connection reset
+func RecordDecodeReplay(rank string, target string) {
+	decodeReplaysTotal.WithLabelValues(rank, target).Inc()
+}
+
+// RecordUpstreamError records a failed request to the decoder or a prefiller by error class
+func RecordUpstreamError(rank string, upstream string, class string) {
+	upstreamErrorsTotal.WithLabelValues(rank, upstream, class).Inc()
+}
+
+// RecordKVTransferRetry records a disaggregated request retried after a KV transfer failure
+func RecordKVTransferRetry(rank string, retry string) {
+	kvTransferRetriesTotal.WithLabelValues(rank, retry).Inc()
+}
+
+// AddBatches adds to the number of batches queued or active
+func AddBatches(rank string, state string, delta float64) {
+	batches.WithLabelValues(rank, state).Add(delta)
+}
+
+// RecordBatchItemFailure records a failed batch item
+func RecordBatchItemFailure(rank string, reason string) {
+	batchItemFailuresTotal.WithLabelValues(rank, reason).Inc()
+}
+
+// RecordPrefillerSelection records a prefill target selected among the candidate prefillers
+func RecordPrefillerSelection(rank string, strategy string, prefiller string) {
+	prefillerSelectionsTotal.WithLabelValues(rank, strategy, prefiller).Inc()
+}
+
+// RecordPanic records a panic recovered in the handler of a route
+func RecordPanic(rank string, route string) {
+	panicsTotal.WithLabelValues(rank, route).Inc()
+}
+
+// RecordSLOBudgetExceeded records a prefill skipped or canceled because it exceeded the TTFT budget
+func RecordSLOBudgetExceeded(rank string, connector string) {
+	sloBudgetExceededTotal.WithLabelValues(rank, connector).Inc()
+}
+
+// RecordPromptSize records a completion request by its estimated prompt size.
+// The trace ID, if any, is attached as exemplar to the latency.
+func RecordPromptSize(rank string, promptSize string, disaggregated bool, duration time.Duration, traceID string) {
+	d := strconv.FormatBool(disaggregated)
+	promptSizeRequestsTotal.WithLabelValues(rank, promptSize, d).Inc()
+	observe(promptSizeDuration.WithLabelValues(rank, promptSize, d), duration, traceID)
+}
+
+// RecordModality records a completion request by its content modality
+func RecordModality(rank string, modality string, disaggregated bool) {
+	modalityRequestsTotal.WithLabelValues(rank, modality, strconv.FormatBool(disaggregated)).Inc()
+}
+
+// RecordHedgedRequest records a decode request hedged to a sibling rank, and which request won
+func RecordHedgedRequest(rank string, hedgeWon bool) {
+	winner := "primary"
+	if hedgeWon {
+		winner = "hedge"
+	}
+	hedgedRequestsTotal.WithLabelValues(rank, winner).Inc()
+}
+
+// RecordPrefillCacheLookup records a disaggregated request looked up in the prefill cache
+func RecordPrefillCacheLookup(rank string, hit bool) {
+	result := "miss"
+	if hit {
+		result = "hit"
+	}
+	prefillCacheRequestsTotal.WithLabelValues(rank, result).Inc()
+}
+
+// RecordPrefixCacheDecision records whether a request is prefilled locally because the decoder is
+// estimated to cache its prompt prefix, or remotely
+func RecordPrefixCacheDecision(rank string, local bool) {
+	prefill := "remote"
+	if local {
+		prefill = "local"
+	}
+	prefixCacheDecisionsTotal.WithLabelValues(rank, prefill).Inc()
+}
+
+// RecordPolicyDecision records the routing policy decision on a completion request
+func RecordPolicyDecision(rank string, decision string) {
+	policyDecisionsTotal.WithLabelValues(rank, decision).Inc()
+}
+
+// RecordKVEvents records a batch of KV cache events relayed to the scheduler
+func RecordKVEvents(relayed bool) {
+	result := "failed"
+	if relayed {
+		result = "relayed"
+	}
+	kvEventsTotal.WithLabelValues(result).Inc()
+}
+
+// RecordUpgradedConnectionOpened records an upgraded connection opened with the decoder
+func RecordUpgradedConnectionOpened(rank string, protocol string) {
+	upgradedConnections.WithLabelValues(rank, protocol).Inc()
+}
+
+// RecordUpgradedConnectionClosed records an upgraded connection closed, with the bytes relayed
+// to (sent) and from (received) the decoder
+func RecordUpgradedConnectionClosed(rank string, protocol string, sent int64, received int64, duration time.Duration) {
+	upgradedConnections.WithLabelValues(rank, protocol).Dec()
+	upgradedConnectionDuration.WithLabelValues(rank, protocol).Observe(duration.Seconds())
+	upgradedConnectionBytes.WithLabelValues(rank, protocol, "sent").Add(float64(sent))
+	upgradedConnectionBytes.WithLabelValues(rank, protocol, "received").Add(float64(received))
+}
+
+// observe records a latency, with the trace ID as exemplar when the request is traced
+func observe(observer prometheus.Observer, duration time.Duration, traceID string) {
+	if traceID != "" {
+		if exemplarObserver, ok := observer.(prometheus.ExemplarObserver); ok {
+			exemplarObserver.ObserveWithExemplar(duration.Seconds(), prometheus.Labels{TraceIDLabel: traceID})
+			return
+		}
+	}
+	observer.Observe(duration.Seconds())
+}
@@ -0,0 +1,90 @@
+/*
+Copyright 2025 The llm-d Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package metrics
+
+import (
+	"context"
+	"os"
+	"time"
+
+	otelprom "go.opentelemetry.io/contrib/bridges/prometheus"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetrichttp"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/resource"
+	semconv "go.opentelemetry.io/otel/semconv/v1.37.0"
+
+	"github.com/llm-d/llm-d-routing-sidecar/internal/identity"
+)
+
+const serviceName = "llm-d-routing-sidecar"
+
+// OTLPConfig configures the push of the sidecar metrics to an OpenTelemetry collector
+type OTLPConfig struct {
+	// Endpoint is the host:port of the collector OTLP/HTTP receiver
+	Endpoint string
+
+	// Insecure sends the metrics over plain HTTP
+	Insecure bool
+
+	// Interval is the time between two pushes
+	Interval time.Duration
+
+	// InferencePool is the name of the InferencePool of the sidecar, if any
+	InferencePool string
+}
+
+// StartOTLPExporter periodically pushes the sidecar metrics to an OpenTelemetry collector
+// over OTLP/HTTP, as an alternative to scraping the admin metrics endpoint. The standard
+// OTEL_EXPORTER_OTLP_* and OTEL_RESOURCE_ATTRIBUTES environment variables are honored.
+// The returned function pushes the pending metrics and stops the exporter.
+func StartOTLPExporter(ctx context.Context, config OTLPConfig) (func(context.Context) error, error) {
+	options := []otlpmetrichttp.Option{otlpmetrichttp.WithEndpoint(config.Endpoint)}
+	if config.Insecure {
+		options = append(options, otlpmetrichttp.WithInsecure())
+	}
+	exporter, err := otlpmetrichttp.New(ctx, options...)
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := detectResource(ctx, identity.FromEnv(os.LookupEnv, config.InferencePool))
+	if err != nil {
+		return nil, err
+	}
+
+	// The Prometheus collectors stay the source of truth, bridged to the OpenTelemetry SDK
+	reader := sdkmetric.NewPeriodicReader(exporter,
+		sdkmetric.WithInterval(config.Interval),
+		sdkmetric.WithProducer(otelprom.NewMetricProducer(otelprom.WithGatherer(Registry))),
+	)
+	provider := sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader), sdkmetric.WithResource(res))
+	return provider.Shutdown, nil
+}
+
+// detectResource describes the sidecar, including the Kubernetes attributes of its pod
+func detectResource(ctx context.Context, id identity.Identity) (*resource.Resource, error) {
+	attributes := append([]attribute.KeyValue{semconv.ServiceName(serviceName)}, id.Attributes()...)
+
+	// the attributes set in the environment take precedence
+	return resource.New(ctx,
+		resource.WithAttributes(attributes...),
+		resource.WithHost(),
+		resource.WithTelemetrySDK(),
+		resource.WithFromEnv(),
+	)
+}
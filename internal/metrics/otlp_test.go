@@ -0,0 +1,86 @@
+/*
+Copyright 2025 The llm-d Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package metrics
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2" // nolint:revive
+	. "github.com/onsi/gomega"    // nolint:revive
+	collectormetrics "go.opentelemetry.io/proto/otlp/collector/metrics/v1"
+	"google.golang.org/protobuf/proto"
+)
+
+var _ = Describe("OTLP exporter", func() {
+	It("should push the sidecar metrics with the pod attributes", func() {
+		GinkgoT().Setenv("POD_NAME", "decode-0")
+		GinkgoT().Setenv("POD_NAMESPACE", "llm-d")
+
+		// Collector receiving the pushed metrics
+		pushed := make(chan *collectormetrics.ExportMetricsServiceRequest, 10)
+		collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			defer GinkgoRecover()
+			Expect(r.URL.Path).To(Equal("/v1/metrics"))
+
+			b, err := io.ReadAll(r.Body)
+			Expect(err).ToNot(HaveOccurred())
+			request := &collectormetrics.ExportMetricsServiceRequest{}
+			Expect(proto.Unmarshal(b, request)).To(Succeed())
+			pushed <- request
+
+			w.Header().Set("Content-Type", "application/x-protobuf")
+			w.WriteHeader(http.StatusOK)
+		}))
+		DeferCleanup(collector.Close)
+
+		RecordRequest("0", "/v1/chat/completions", http.StatusOK, 10*time.Millisecond, "")
+
+		shutdown, err := StartOTLPExporter(context.Background(), OTLPConfig{
+			Endpoint:      collector.Listener.Addr().String(),
+			Insecure:      true,
+			Interval:      100 * time.Millisecond,
+			InferencePool: "pool",
+		})
+		Expect(err).ToNot(HaveOccurred())
+		DeferCleanup(shutdown, context.Background())
+
+		var request *collectormetrics.ExportMetricsServiceRequest
+		Eventually(pushed, 5*time.Second).Should(Receive(&request))
+		Expect(request.ResourceMetrics).ToNot(BeEmpty())
+
+		attributes := map[string]string{}
+		for _, attribute := range request.ResourceMetrics[0].Resource.Attributes {
+			attributes[attribute.Key] = attribute.Value.GetStringValue()
+		}
+		Expect(attributes).To(HaveKeyWithValue("service.name", "llm-d-routing-sidecar"))
+		Expect(attributes).To(HaveKeyWithValue("k8s.pod.name", "decode-0"))
+		Expect(attributes).To(HaveKeyWithValue("k8s.namespace.name", "llm-d"))
+		Expect(attributes).To(HaveKeyWithValue("k8s.inferencepool.name", "pool"))
+
+		names := []string{}
+		for _, scope := range request.ResourceMetrics[0].ScopeMetrics {
+			for _, metric := range scope.Metrics {
+				names = append(names, metric.Name)
+			}
+		}
+		Expect(names).To(ContainElements("llm_d_routing_sidecar_requests_total", "llm_d_routing_sidecar_request_duration_seconds"))
+	})
+})
@@ -0,0 +1,109 @@
+/*
+Copyright 2025 The llm-d Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package profiling pushes the continuous profiles of the routing sidecar
+package profiling
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/grafana/pyroscope-go"
+)
+
+const (
+	// Environment variables holding the Kubernetes attributes of the pod, set with the downward API
+	envPodName      = "POD_NAME"
+	envPodNamespace = "POD_NAMESPACE"
+)
+
+// Config configures the push of the sidecar profiles
+type Config struct {
+	// ServerAddress is the URL of the Pyroscope-compatible server the profiles are pushed to
+	ServerAddress string
+
+	// ApplicationName is the name the profiles are pushed under
+	ApplicationName string
+
+	// Tags are attached to every profile, in addition to the pod and namespace
+	Tags map[string]string
+
+	// BasicAuthUser and BasicAuthPassword authenticate with the server, when set
+	BasicAuthUser     string
+	BasicAuthPassword string
+
+	// TenantID is the tenant of multi-tenant servers
+	TenantID string
+
+	// UploadRate is the time between two pushes
+	UploadRate time.Duration
+}
+
+// Start periodically pushes the CPU and allocation profiles of the sidecar. The returned
+// function pushes the last profiles and stops the profiler.
+func Start(logger logr.Logger, config Config) (func() error, error) {
+	tags := map[string]string{}
+	if pod := os.Getenv(envPodName); pod != "" {
+		tags["pod"] = pod
+	}
+	if namespace := os.Getenv(envPodNamespace); namespace != "" {
+		tags["namespace"] = namespace
+	}
+	for name, value := range config.Tags {
+		tags[name] = value
+	}
+
+	profiler, err := pyroscope.Start(pyroscope.Config{
+		ApplicationName:   config.ApplicationName,
+		ServerAddress:     config.ServerAddress,
+		Tags:              tags,
+		BasicAuthUser:     config.BasicAuthUser,
+		BasicAuthPassword: config.BasicAuthPassword,
+		TenantID:          config.TenantID,
+		UploadRate:        config.UploadRate,
+		Logger:            &pyroscopeLogger{logger: logger},
+		ProfileTypes: []pyroscope.ProfileType{
+			pyroscope.ProfileCPU,
+			pyroscope.ProfileAllocObjects,
+			pyroscope.ProfileAllocSpace,
+			pyroscope.ProfileInuseObjects,
+			pyroscope.ProfileInuseSpace,
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+	return profiler.Stop, nil
+}
+
+// pyroscopeLogger forwards the profiler logs to the sidecar logger
+type pyroscopeLogger struct {
+	logger logr.Logger
+}
+
+func (l *pyroscopeLogger) Infof(format string, args ...any) {
+	l.logger.V(4).Info(fmt.Sprintf(format, args...))
+}
+
+func (l *pyroscopeLogger) Debugf(format string, args ...any) {
+	l.logger.V(5).Info(fmt.Sprintf(format, args...))
+}
+
+func (l *pyroscopeLogger) Errorf(format string, args ...any) {
+	l.logger.Error(nil, fmt.Sprintf(format, args...))
+}
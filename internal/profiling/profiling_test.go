@@ -0,0 +1,61 @@
+/*
+Copyright 2025 The llm-d Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package profiling
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2" // nolint:revive
+	. "github.com/onsi/gomega"    // nolint:revive
+	"k8s.io/klog/v2/ktesting"
+)
+
+var _ = Describe("Profiler", func() {
+	It("should push the profiles with the connector and pod tags", func() {
+		logger, _ := ktesting.NewTestContext(GinkgoT())
+		GinkgoT().Setenv(envPodName, "decode-0")
+
+		// Pyroscope server receiving the pushed profiles
+		names := make(chan string, 100)
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			io.ReadAll(r.Body) //nolint:all
+			if r.URL.Path == "/ingest" {
+				names <- r.URL.Query().Get("name")
+			}
+			w.WriteHeader(http.StatusOK)
+		}))
+		DeferCleanup(server.Close)
+
+		stop, err := Start(logger, Config{
+			ServerAddress:   server.URL,
+			ApplicationName: "llm-d-routing-sidecar",
+			Tags:            map[string]string{"connector": "nixlv2"},
+			UploadRate:      time.Second,
+		})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(stop()).To(Succeed())
+
+		var name string
+		Eventually(names, 5*time.Second).Should(Receive(&name))
+		Expect(name).To(HavePrefix("llm-d-routing-sidecar"))
+		Expect(name).To(ContainSubstring("connector=nixlv2"))
+		Expect(name).To(ContainSubstring("pod=decode-0"))
+	})
+})
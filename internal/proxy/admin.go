@@ -0,0 +1,350 @@
+/*
+Copyright 2025 The llm-d Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package proxy
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/pprof"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"k8s.io/klog/v2"
+
+	"github.com/llm-d/llm-d-routing-sidecar/internal/metrics"
+)
+
+const (
+	// AdminStatePath is the admin endpoint returning the runtime state of the proxy servers
+	AdminStatePath = "/debug/state"
+
+	// AdminMetricsPath is the admin endpoint exposing the Prometheus metrics
+	AdminMetricsPath = "/metrics"
+
+	// AdminRankHealthPath is the admin endpoint returning the health of each data parallel rank
+	AdminRankHealthPath = "/health/ranks"
+
+	// AdminFlushPrefillersPath is the admin endpoint flushing the cached prefiller proxies and
+	// rebuilding the allowlist, e.g. after a rollout of the prefill fleet
+	AdminFlushPrefillersPath = "/cache/prefillers/flush"
+
+	// AdminPrefillerScoresPath is the admin endpoint returning the recent latency and error rate of
+	// the prefillers, which bias their selection
+	AdminPrefillerScoresPath = "/debug/prefillers"
+
+	// AdminRoutingDecisionsPath is the admin endpoint returning the last routing decisions of the
+	// completion requests, to answer why a request went where it did
+	AdminRoutingDecisionsPath = "/debug/routing"
+
+	// AdminConfigPath is the admin endpoint returning the effective configuration of the sidecar,
+	// with the secrets masked
+	AdminConfigPath = "/debug/config"
+
+	// AdminPprofPath is the admin endpoint serving the pprof profiles, e.g. for Parca to scrape
+	AdminPprofPath = "/debug/pprof/"
+)
+
+// AdminConfig represents the admin server configuration
+type AdminConfig struct {
+	// MergeDecoderMetrics merges the metrics scraped from the decoders into the sidecar metrics.
+	MergeDecoderMetrics bool
+
+	// MetricsLabels are added to every sample of the metrics, e.g. the identity of the pod
+	MetricsLabels prometheus.Labels
+
+	// BindAddresses are the addresses the admin server listens on, e.g. 127.0.0.1 to only serve
+	// local clients. The admin server listens on all the interfaces when empty.
+	BindAddresses []string
+
+	// Listener serves the admin endpoints instead of listening on the admin port
+	Listener net.Listener
+
+	// Configuration returns the effective configuration served on AdminConfigPath, which is not
+	// served when nil
+	Configuration func() any
+}
+
+// AdminServer serves administrative endpoints for one or more proxy servers
+type AdminServer struct {
+	logger  logr.Logger
+	addr    net.Addr // the admin TCP address, read once listening
+	port    string   // the admin TCP port
+	servers []*Server
+
+	listening chan struct{} // closed once the address is set
+
+	config AdminConfig
+}
+
+// NewAdminServer creates a new admin server for the given proxy servers
+func NewAdminServer(port string, config AdminConfig, servers ...*Server) *AdminServer {
+	return &AdminServer{
+		port:      port,
+		servers:   servers,
+		config:    config,
+		listening: make(chan struct{}),
+	}
+}
+
+// Addr returns the TCP address of the admin server, nil until it is listening
+func (a *AdminServer) Addr() net.Addr {
+	select {
+	case <-a.listening:
+		return a.addr
+	default:
+		return nil
+	}
+}
+
+// Start the admin HTTP server.
+func (a *AdminServer) Start(ctx context.Context) error {
+	logger := klog.FromContext(ctx).WithName("admin server")
+	a.logger = logger
+
+	var err error
+	listeners := []net.Listener{a.config.Listener}
+	if a.config.Listener == nil {
+		listeners, err = listen(a.config.BindAddresses, a.port)
+		if err != nil {
+			logger.Error(err, "Failed to start")
+			return err
+		}
+	}
+	a.addr = listeners[0].Addr()
+	close(a.listening)
+
+	server := &http.Server{
+		Handler:           a.createRoutes(),
+		ReadHeaderTimeout: 30 * time.Second,
+	}
+
+	go func() {
+		<-ctx.Done()
+		// the metrics report the drain progress until the proxies are drained
+		a.waitDrained()
+		logger.Info("shutting down")
+
+		ctx, cancelFn := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancelFn()
+		if err := server.Shutdown(ctx); err != nil {
+			logger.Error(err, "failed to gracefully shutdown")
+		}
+	}()
+
+	logger.Info("starting", "addr", listenerAddrs(listeners))
+	if err := serve(server, listeners, false); err != http.ErrServerClosed {
+		logger.Error(err, "failed to start")
+		return err
+	}
+	return nil
+}
+
+// waitDrained waits for the requests in flight of the proxy servers to complete, at most for
+// the shutdown timeout of the proxies
+func (a *AdminServer) waitDrained() {
+	var timeout time.Duration
+	for _, s := range a.servers {
+		timeout = max(timeout, s.shutdownTimeout())
+	}
+	ticker := time.NewTicker(drainPollInterval)
+	defer ticker.Stop()
+	deadline := time.After(timeout)
+	for {
+		drained := true
+		for _, s := range a.servers {
+			drained = drained && s.inflight.len() == 0
+		}
+		if drained {
+			return
+		}
+		select {
+		case <-ticker.C:
+		case <-deadline:
+			return
+		}
+	}
+}
+
+func (a *AdminServer) createRoutes() *http.ServeMux {
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("GET "+AdminStatePath, a.stateHandler)
+	mux.Handle("GET "+AdminMetricsPath, a.metricsHandler())
+	mux.HandleFunc("GET "+AdminRankHealthPath, a.ranksHealthHandler)
+	mux.HandleFunc("GET "+AdminRankHealthPath+"/{rank}", a.rankHealthHandler)
+	mux.HandleFunc("POST "+AdminFlushPrefillersPath, a.flushPrefillersHandler)
+	mux.HandleFunc("GET "+AdminPrefillerScoresPath, a.prefillerScoresHandler)
+	mux.HandleFunc("GET "+AdminRoutingDecisionsPath, a.routingDecisionsHandler)
+	if a.config.Configuration != nil {
+		mux.HandleFunc("GET "+AdminConfigPath, a.configHandler)
+	}
+	mux.HandleFunc("GET "+AdminPprofPath, pprof.Index)
+	mux.HandleFunc("GET "+AdminPprofPath+"cmdline", pprof.Cmdline)
+	mux.HandleFunc("GET "+AdminPprofPath+"profile", pprof.Profile)
+	mux.HandleFunc("GET "+AdminPprofPath+"symbol", pprof.Symbol)
+	mux.HandleFunc("GET "+AdminPprofPath+"trace", pprof.Trace)
+
+	return mux
+}
+
+func (a *AdminServer) stateHandler(w http.ResponseWriter, _ *http.Request) {
+	states := make([]State, 0, len(a.servers))
+	for _, s := range a.servers {
+		states = append(states, s.State())
+	}
+
+	a.sendJSON(w, http.StatusOK, states)
+}
+
+// flushPrefillersHandler flushes the prefiller caches of all the proxy servers
+func (a *AdminServer) flushPrefillersHandler(w http.ResponseWriter, _ *http.Request) {
+	flushes := make([]PrefillerFlush, 0, len(a.servers))
+	for _, s := range a.servers {
+		flush := s.FlushPrefillers()
+		a.logger.Info("flushed prefiller caches", metrics.RankLabel, flush.Rank,
+			"prefillerProxies", flush.PrefillerProxies, "allowlistTargets", flush.AllowlistTargets)
+		flushes = append(flushes, flush)
+	}
+
+	a.sendJSON(w, http.StatusOK, flushes)
+}
+
+// prefillerScoresHandler returns the scores of the prefillers selected by all the proxy servers
+func (a *AdminServer) prefillerScoresHandler(w http.ResponseWriter, _ *http.Request) {
+	scores := make([]PrefillerScores, 0, len(a.servers))
+	for _, s := range a.servers {
+		scores = append(scores, s.PrefillerScores())
+	}
+
+	a.sendJSON(w, http.StatusOK, scores)
+}
+
+// routingDecisionsHandler returns the last routing decisions of all the proxy servers
+func (a *AdminServer) routingDecisionsHandler(w http.ResponseWriter, _ *http.Request) {
+	decisions := make([]RoutingDecisions, 0, len(a.servers))
+	for _, s := range a.servers {
+		decisions = append(decisions, s.RoutingDecisions())
+	}
+
+	a.sendJSON(w, http.StatusOK, decisions)
+}
+
+// configHandler returns the effective configuration of the sidecar
+func (a *AdminServer) configHandler(w http.ResponseWriter, _ *http.Request) {
+	a.sendJSON(w, http.StatusOK, a.config.Configuration())
+}
+
+// ranksHealthHandler returns the health of all the data parallel ranks. It
+// responds with 503 when any rank is unhealthy.
+func (a *AdminServer) ranksHealthHandler(w http.ResponseWriter, r *http.Request) {
+	healths := make([]RankHealth, len(a.servers))
+
+	var wg sync.WaitGroup
+	for i, s := range a.servers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			healths[i] = s.Health(r.Context())
+		}()
+	}
+	wg.Wait()
+
+	statusCode := http.StatusOK
+	for _, health := range healths {
+		if !health.Healthy {
+			statusCode = http.StatusServiceUnavailable
+		}
+	}
+	a.sendJSON(w, statusCode, healths)
+}
+
+// rankHealthHandler returns the health of a single data parallel rank, so
+// traffic can be steered away from a crashed rank while the others are healthy.
+// The pool query parameter selects the rank of a virtual pool.
+func (a *AdminServer) rankHealthHandler(w http.ResponseWriter, r *http.Request) {
+	rank, err := strconv.Atoi(r.PathValue("rank"))
+	if err != nil {
+		http.Error(w, "invalid rank", http.StatusBadRequest)
+		return
+	}
+
+	for _, s := range a.servers {
+		if s.config.DataParallelRank != rank || s.config.Pool != r.URL.Query().Get("pool") {
+			continue
+		}
+
+		health := s.Health(r.Context())
+		statusCode := http.StatusOK
+		if !health.Healthy {
+			statusCode = http.StatusServiceUnavailable
+		}
+		a.sendJSON(w, statusCode, health)
+		return
+	}
+	http.Error(w, "unknown rank", http.StatusNotFound)
+}
+
+func (a *AdminServer) sendJSON(w http.ResponseWriter, statusCode int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		a.logger.Error(err, "failed to send response to client")
+	}
+}
+
+// metricsHandler serves the sidecar metrics, merged with the relabeled decoder metrics when configured
+func (a *AdminServer) metricsHandler() http.Handler {
+	gatherers := prometheus.Gatherers{metrics.WithLabels(metrics.Registry, a.config.MetricsLabels)}
+	if a.config.MergeDecoderMetrics {
+		for _, s := range a.servers {
+			if s.config.Pool != "" {
+				continue // the decoders of the main pool
+			}
+			labels := prometheus.Labels{
+				decoderMetricsLabel: s.decoderAddress(),
+				metrics.RankLabel:   s.rank(),
+			}
+			for name, value := range a.config.MetricsLabels {
+				labels[name] = value
+			}
+			gatherers = append(gatherers, metrics.NewDecoderGatherer(s.scrapeDecoderMetrics, labels))
+		}
+	}
+
+	return promhttp.HandlerFor(gatherers, promhttp.HandlerOpts{
+		ErrorLog:      &promErrorLogger{a},
+		ErrorHandling: promhttp.ContinueOnError,
+		// exemplars are only exposed in the OpenMetrics format
+		EnableOpenMetrics: true,
+	})
+}
+
+// promErrorLogger logs the errors reported while gathering metrics
+type promErrorLogger struct {
+	admin *AdminServer
+}
+
+func (l *promErrorLogger) Println(v ...any) {
+	l.admin.logger.Error(nil, "failed to gather metrics", "error", fmt.Sprint(v...))
+}
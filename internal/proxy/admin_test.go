@@ -0,0 +1,420 @@
+/*
+Copyright 2025 The llm-d Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package proxy
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/llm-d/llm-d-routing-sidecar/test/mock"
+	. "github.com/onsi/ginkgo/v2" // nolint:revive
+	. "github.com/onsi/gomega"    // nolint:revive
+	"k8s.io/klog/v2/ktesting"
+)
+
+var _ = Describe("Admin server", func() {
+	It("should report in-flight requests and cached prefiller proxies", func() {
+		_, ctx := ktesting.NewTestContext(GinkgoT())
+		ctx, cancelFn := context.WithCancel(ctx)
+		defer cancelFn()
+
+		// Decoder blocking until released
+		release := make(chan struct{})
+		decodeBackend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+			<-release
+			w.WriteHeader(http.StatusOK)
+		}))
+		DeferCleanup(decodeBackend.Close)
+		DeferCleanup(func() { close(release) })
+
+		prefillBackend := httptest.NewServer(&mock.ChatCompletionHandler{
+			Connector: ConnectorNIXLV2,
+			Role:      mock.RolePrefill,
+		})
+		DeferCleanup(prefillBackend.Close)
+
+		decodeURL, err := url.Parse(decodeBackend.URL)
+		Expect(err).ToNot(HaveOccurred())
+
+		proxy, err := NewProxy("0", decodeURL, Config{Connector: ConnectorNIXLV2})
+		Expect(err).ToNot(HaveOccurred())
+		admin := NewAdminServer("0", AdminConfig{}, proxy)
+
+		go func() {
+			defer GinkgoRecover()
+			Expect(proxy.Start(ctx)).To(Succeed())
+		}()
+		go func() {
+			defer GinkgoRecover()
+			Expect(admin.Start(ctx)).To(Succeed())
+		}()
+
+		time.Sleep(1 * time.Second)
+		Expect(proxy.Addr()).ToNot(BeNil())
+		Expect(admin.Addr()).ToNot(BeNil())
+
+		By("sending a request which blocks in the decode stage")
+		prefillHostPort := prefillBackend.URL[len("http://"):]
+		body := `{"model": "Qwen/Qwen2-0.5B", "prompt": "Hello", "max_tokens": 50}`
+		req, err := http.NewRequest(http.MethodPost, "http://"+proxy.Addr().String()+CompletionsPath, strings.NewReader(body))
+		Expect(err).ToNot(HaveOccurred())
+		req.Header.Add(requestHeaderPrefillHostPort, prefillHostPort)
+
+		go func() {
+			resp, err := http.DefaultClient.Do(req)
+			if err == nil {
+				resp.Body.Close() //nolint:all
+			}
+		}()
+
+		By("fetching the state from the admin server")
+		Eventually(func(g Gomega) {
+			resp, err := http.Get("http://" + admin.Addr().String() + AdminStatePath)
+			g.Expect(err).ToNot(HaveOccurred())
+			defer resp.Body.Close() //nolint:all
+
+			var states []State
+			g.Expect(json.NewDecoder(resp.Body).Decode(&states)).To(Succeed())
+			g.Expect(states).To(HaveLen(1))
+
+			g.Expect(states[0].Connector).To(Equal(ConnectorNIXLV2))
+			g.Expect(states[0].PrefillerProxies).To(ContainElement(prefillHostPort))
+			g.Expect(states[0].InflightRequests).To(HaveLen(1))
+
+			inflight := states[0].InflightRequests[0]
+			g.Expect(inflight.Path).To(Equal(CompletionsPath))
+			g.Expect(inflight.Prefiller).To(Equal(prefillHostPort))
+			g.Expect(inflight.Stage).To(Equal(stageDecode))
+		}).WithTimeout(5 * time.Second).Should(Succeed())
+	})
+
+	It("should report the health of each data parallel rank", func() {
+		_, ctx := ktesting.NewTestContext(GinkgoT())
+		ctx, cancelFn := context.WithCancel(ctx)
+		defer cancelFn()
+
+		healthyBackend := httptest.NewServer(&mock.GenericHandler{})
+		DeferCleanup(healthyBackend.Close)
+
+		// Crashed rank: nothing is listening on the decoder port anymore
+		crashedBackend := httptest.NewServer(&mock.GenericHandler{})
+		crashedBackend.Close()
+
+		servers := make([]*Server, 0, 2)
+		for rank, backend := range []*httptest.Server{healthyBackend, crashedBackend} {
+			decodeURL, err := url.Parse(backend.URL)
+			Expect(err).ToNot(HaveOccurred())
+
+			proxy, err := NewProxy("0", decodeURL, Config{Connector: ConnectorNIXLV2, DataParallelRank: rank})
+			Expect(err).ToNot(HaveOccurred())
+			servers = append(servers, proxy)
+		}
+		// the first rank of a virtual pool, on the crashed decoder
+		decodeURL, err := url.Parse(crashedBackend.URL)
+		Expect(err).ToNot(HaveOccurred())
+		poolProxy, err := NewProxy("0", decodeURL, Config{Connector: ConnectorNIXLV2, Pool: "pool-b"})
+		Expect(err).ToNot(HaveOccurred())
+		servers = append(servers, poolProxy)
+		admin := NewAdminServer("0", AdminConfig{}, servers...)
+
+		go func() {
+			defer GinkgoRecover()
+			Expect(admin.Start(ctx)).To(Succeed())
+		}()
+		Eventually(func() net.Addr { return admin.Addr() }).ShouldNot(BeNil())
+
+		By("fetching the health of all ranks")
+		resp, err := http.Get("http://" + admin.Addr().String() + AdminRankHealthPath)
+		Expect(err).ToNot(HaveOccurred())
+		defer resp.Body.Close() //nolint:all
+		Expect(resp.StatusCode).To(Equal(http.StatusServiceUnavailable))
+
+		var healths []RankHealth
+		Expect(json.NewDecoder(resp.Body).Decode(&healths)).To(Succeed())
+		Expect(healths).To(HaveLen(3))
+		Expect(healths[0].Rank).To(Equal(0))
+		Expect(healths[0].Healthy).To(BeTrue())
+		Expect(healths[1].Rank).To(Equal(1))
+		Expect(healths[1].Healthy).To(BeFalse())
+		Expect(healths[2].Rank).To(Equal(0))
+		Expect(healths[2].Pool).To(Equal("pool-b"))
+
+		By("fetching the health of each rank")
+		for rank, statusCode := range []int{http.StatusOK, http.StatusServiceUnavailable} {
+			resp, err := http.Get(fmt.Sprintf("http://%s%s/%d", admin.Addr().String(), AdminRankHealthPath, rank))
+			Expect(err).ToNot(HaveOccurred())
+			resp.Body.Close() //nolint:all
+			Expect(resp.StatusCode).To(Equal(statusCode))
+		}
+
+		resp, err = http.Get("http://" + admin.Addr().String() + AdminRankHealthPath + "/0?pool=pool-b")
+		Expect(err).ToNot(HaveOccurred())
+		resp.Body.Close() //nolint:all
+		Expect(resp.StatusCode).To(Equal(http.StatusServiceUnavailable))
+
+		resp, err = http.Get("http://" + admin.Addr().String() + AdminRankHealthPath + "/2")
+		Expect(err).ToNot(HaveOccurred())
+		resp.Body.Close() //nolint:all
+		Expect(resp.StatusCode).To(Equal(http.StatusNotFound))
+	})
+
+	It("should flush the cached prefiller proxies and prefill responses", func() {
+		_, ctx := ktesting.NewTestContext(GinkgoT())
+		ctx, cancelFn := context.WithCancel(ctx)
+		defer cancelFn()
+
+		decodeBackend := httptest.NewServer(&mock.ChatCompletionHandler{
+			Connector: ConnectorNIXLV2,
+			Role:      mock.RoleDecode,
+		})
+		DeferCleanup(decodeBackend.Close)
+
+		prefillBackend := httptest.NewServer(&mock.ChatCompletionHandler{
+			Connector: ConnectorNIXLV2,
+			Role:      mock.RolePrefill,
+		})
+		DeferCleanup(prefillBackend.Close)
+
+		decodeURL, err := url.Parse(decodeBackend.URL)
+		Expect(err).ToNot(HaveOccurred())
+
+		proxy, err := NewProxy("0", decodeURL, Config{
+			Connector:        ConnectorNIXLV2,
+			PrefillCacheSize: 16,
+			PrefillCacheTTL:  time.Minute,
+		})
+		Expect(err).ToNot(HaveOccurred())
+		admin := NewAdminServer("0", AdminConfig{}, proxy)
+
+		go func() {
+			defer GinkgoRecover()
+			Expect(proxy.Start(ctx)).To(Succeed())
+		}()
+		go func() {
+			defer GinkgoRecover()
+			Expect(admin.Start(ctx)).To(Succeed())
+		}()
+
+		time.Sleep(1 * time.Second)
+		Expect(proxy.Addr()).ToNot(BeNil())
+		Expect(admin.Addr()).ToNot(BeNil())
+
+		body := `{"model": "Qwen/Qwen2-0.5B", "prompt": "Hello", "max_tokens": 50}`
+		req, err := http.NewRequest(http.MethodPost, "http://"+proxy.Addr().String()+CompletionsPath, strings.NewReader(body))
+		Expect(err).ToNot(HaveOccurred())
+		req.Header.Add(requestHeaderPrefillHostPort, prefillBackend.URL[len("http://"):])
+		resp, err := http.DefaultClient.Do(req)
+		Expect(err).ToNot(HaveOccurred())
+		resp.Body.Close() //nolint:all
+		Expect(resp.StatusCode).To(Equal(http.StatusOK))
+		Expect(proxy.prefillerProxies.Len()).To(Equal(1))
+
+		resp, err = http.Post("http://"+admin.Addr().String()+AdminFlushPrefillersPath, "", nil)
+		Expect(err).ToNot(HaveOccurred())
+		defer resp.Body.Close() //nolint:all
+		Expect(resp.StatusCode).To(Equal(http.StatusOK))
+
+		var flushes []PrefillerFlush
+		Expect(json.NewDecoder(resp.Body).Decode(&flushes)).To(Succeed())
+		Expect(flushes).To(Equal([]PrefillerFlush{{PrefillerProxies: 1, PrefillCache: 1}}))
+		Expect(proxy.prefillerProxies.Len()).To(BeZero())
+		Expect(proxy.prefillCache.entries.Len()).To(BeZero())
+	})
+
+	It("should return the scores of the prefillers", func() {
+		_, ctx := ktesting.NewTestContext(GinkgoT())
+		ctx, cancelFn := context.WithCancel(ctx)
+		defer cancelFn()
+
+		decodeBackend := httptest.NewServer(&mock.ChatCompletionHandler{Connector: ConnectorNIXLV2, Role: mock.RoleDecode})
+		DeferCleanup(decodeBackend.Close)
+		prefillBackend := httptest.NewServer(&mock.ChatCompletionHandler{Connector: ConnectorNIXLV2, Role: mock.RolePrefill})
+		DeferCleanup(prefillBackend.Close)
+		failingBackend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+			w.WriteHeader(http.StatusInternalServerError)
+		}))
+		DeferCleanup(failingBackend.Close)
+
+		decodeURL, err := url.Parse(decodeBackend.URL)
+		Expect(err).ToNot(HaveOccurred())
+		proxy, err := NewProxy("0", decodeURL, Config{
+			Connector:                  ConnectorNIXLV2,
+			PrefillerSelectionStrategy: PrefillerSelectionRoundRobin,
+		})
+		Expect(err).ToNot(HaveOccurred())
+		admin := NewAdminServer("0", AdminConfig{}, proxy)
+
+		go func() {
+			defer GinkgoRecover()
+			Expect(proxy.Start(ctx)).To(Succeed())
+		}()
+		go func() {
+			defer GinkgoRecover()
+			Expect(admin.Start(ctx)).To(Succeed())
+		}()
+		Eventually(func() net.Addr { return proxy.Addr() }).ShouldNot(BeNil())
+		Eventually(func() net.Addr { return admin.Addr() }).ShouldNot(BeNil())
+
+		prefiller := prefillBackend.URL[len("http://"):]
+		failing := failingBackend.URL[len("http://"):]
+		body := `{"model": "Qwen/Qwen2-0.5B", "prompt": "Hello", "max_tokens": 50}`
+		for range 2 {
+			req, err := http.NewRequest(http.MethodPost, "http://"+proxy.Addr().String()+CompletionsPath, strings.NewReader(body))
+			Expect(err).ToNot(HaveOccurred())
+			req.Header.Add(requestHeaderPrefillHostPort, prefiller+","+failing)
+			resp, err := http.DefaultClient.Do(req)
+			Expect(err).ToNot(HaveOccurred())
+			resp.Body.Close() //nolint:all
+		}
+
+		resp, err := http.Get("http://" + admin.Addr().String() + AdminPrefillerScoresPath)
+		Expect(err).ToNot(HaveOccurred())
+		defer resp.Body.Close() //nolint:all
+		Expect(resp.StatusCode).To(Equal(http.StatusOK))
+
+		var scores []PrefillerScores
+		Expect(json.NewDecoder(resp.Body).Decode(&scores)).To(Succeed())
+		Expect(scores).To(HaveLen(1))
+		Expect(scores[0].Strategy).To(Equal(PrefillerSelectionRoundRobin))
+		Expect(scores[0].Prefillers).To(ConsistOf(
+			And(HaveField("Target", prefiller), HaveField("Samples", 1), HaveField("ErrorRate", 0.0), HaveField("Avoided", false)),
+			And(HaveField("Target", failing), HaveField("Samples", 1), HaveField("ErrorRate", 1.0), HaveField("Avoided", true),
+				HaveField("P95Seconds", BeNumerically(">=", prefillerFailureLatency.Seconds()))),
+		))
+	})
+
+	It("should return the last routing decisions", func() {
+		_, ctx := ktesting.NewTestContext(GinkgoT())
+		ctx, cancelFn := context.WithCancel(ctx)
+		defer cancelFn()
+
+		decodeBackend := httptest.NewServer(&mock.ChatCompletionHandler{Connector: ConnectorNIXLV2, Role: mock.RoleDecode})
+		DeferCleanup(decodeBackend.Close)
+		prefillBackend := httptest.NewServer(&mock.ChatCompletionHandler{Connector: ConnectorNIXLV2, Role: mock.RolePrefill})
+		DeferCleanup(prefillBackend.Close)
+
+		decodeURL, err := url.Parse(decodeBackend.URL)
+		Expect(err).ToNot(HaveOccurred())
+		proxy, err := NewProxy("0", decodeURL, Config{
+			Connector:                  ConnectorNIXLV2,
+			PrefillerSelectionStrategy: PrefillerSelectionRoundRobin,
+			RoutingDecisionsSize:       2,
+		})
+		Expect(err).ToNot(HaveOccurred())
+		admin := NewAdminServer("0", AdminConfig{}, proxy)
+
+		go func() {
+			defer GinkgoRecover()
+			Expect(proxy.Start(ctx)).To(Succeed())
+		}()
+		go func() {
+			defer GinkgoRecover()
+			Expect(admin.Start(ctx)).To(Succeed())
+		}()
+		Eventually(func() net.Addr { return proxy.Addr() }).ShouldNot(BeNil())
+		Eventually(func() net.Addr { return admin.Addr() }).ShouldNot(BeNil())
+
+		prefiller := prefillBackend.URL[len("http://"):]
+		other := "localhost:" + prefiller[strings.LastIndex(prefiller, ":")+1:]
+		send := func(body string, prefillers string) {
+			req, err := http.NewRequest(http.MethodPost, "http://"+proxy.Addr().String()+CompletionsPath, strings.NewReader(body))
+			Expect(err).ToNot(HaveOccurred())
+			if prefillers != "" {
+				req.Header.Add(requestHeaderPrefillHostPort, prefillers)
+			}
+			resp, err := http.DefaultClient.Do(req)
+			Expect(err).ToNot(HaveOccurred())
+			resp.Body.Close() //nolint:all
+			Expect(resp.StatusCode).To(Equal(http.StatusOK))
+		}
+		send(`{"model": "Qwen/Qwen2-0.5B", "prompt": "Hello", "n": 2}`, prefiller)
+		send(`{"model": "Qwen/Qwen2-0.5B", "prompt": "Hello"}`, prefiller+","+other)
+		send(`{"model": "Qwen/Qwen2-0.5B", "prompt": "Hello", "n": 2}`, prefiller)
+
+		resp, err := http.Get("http://" + admin.Addr().String() + AdminRoutingDecisionsPath)
+		Expect(err).ToNot(HaveOccurred())
+		defer resp.Body.Close() //nolint:all
+		Expect(resp.StatusCode).To(Equal(http.StatusOK))
+
+		var decisions []RoutingDecisions
+		Expect(json.NewDecoder(resp.Body).Decode(&decisions)).To(Succeed())
+		Expect(decisions).To(HaveLen(1))
+		Expect(decisions[0].Decisions).To(HaveExactElements(
+			And(HaveField("Decision", routingDecodeOnly), HaveField("Reason", decodeOnlyMultipleChoices),
+				HaveField("Candidates", []string{prefiller}), HaveField("Prefiller", BeEmpty())),
+			And(HaveField("Decision", routingDisaggregated), HaveField("Reason", BeEmpty()),
+				HaveField("Route", CompletionsPath), HaveField("Model", "Qwen/Qwen2-0.5B"),
+				HaveField("Candidates", []string{prefiller, other}), HaveField("Strategy", PrefillerSelectionRoundRobin),
+				HaveField("Prefiller", BeElementOf(prefiller, other)), HaveField("Connector", ConnectorNIXLV2), HaveField("StatusCode", http.StatusOK),
+				HaveField("PrefillSeconds", BeNumerically(">", 0)), HaveField("DurationSeconds", BeNumerically(">", 0))),
+		))
+	})
+
+	It("should return the effective configuration", func() {
+		_, ctx := ktesting.NewTestContext(GinkgoT())
+		ctx, cancelFn := context.WithCancel(ctx)
+		defer cancelFn()
+
+		admin := NewAdminServer("0", AdminConfig{Configuration: func() any {
+			return []map[string]string{{"name": "port", "value": "9000", "source": "flag"}}
+		}})
+		go func() {
+			defer GinkgoRecover()
+			Expect(admin.Start(ctx)).To(Succeed())
+		}()
+		Eventually(func() net.Addr { return admin.Addr() }).ShouldNot(BeNil())
+
+		resp, err := http.Get("http://" + admin.Addr().String() + AdminConfigPath)
+		Expect(err).ToNot(HaveOccurred())
+		defer resp.Body.Close() //nolint:all
+		Expect(resp.StatusCode).To(Equal(http.StatusOK))
+
+		var settings []map[string]string
+		Expect(json.NewDecoder(resp.Body).Decode(&settings)).To(Succeed())
+		Expect(settings).To(Equal([]map[string]string{{"name": "port", "value": "9000", "source": "flag"}}))
+	})
+
+	It("should serve the pprof profiles", func() {
+		_, ctx := ktesting.NewTestContext(GinkgoT())
+		ctx, cancelFn := context.WithCancel(ctx)
+		defer cancelFn()
+
+		admin := NewAdminServer("0", AdminConfig{})
+		go func() {
+			defer GinkgoRecover()
+			Expect(admin.Start(ctx)).To(Succeed())
+		}()
+		Eventually(func() net.Addr { return admin.Addr() }).ShouldNot(BeNil())
+
+		resp, err := http.Get("http://" + admin.Addr().String() + AdminPprofPath + "heap?debug=1")
+		Expect(err).ToNot(HaveOccurred())
+		defer resp.Body.Close() //nolint:all
+		Expect(resp.StatusCode).To(Equal(http.StatusOK))
+
+		body, err := io.ReadAll(resp.Body)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(string(body)).To(ContainSubstring("heap profile"))
+	})
+})
@@ -0,0 +1,343 @@
+/*
+Copyright 2025 The llm-d Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package proxy
+
+import (
+	"container/list"
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/llm-d/llm-d-routing-sidecar/internal/metrics"
+)
+
+const (
+	// DefaultPriorityHeader is the default request header selecting the priority class
+	DefaultPriorityHeader = "x-request-priority"
+
+	// PriorityInteractive requests are admitted first
+	PriorityInteractive = "interactive"
+
+	// PriorityStandard is the priority of the requests without (valid) priority header
+	PriorityStandard = "standard"
+
+	// PriorityBatch requests yield to the others
+	PriorityBatch = "batch"
+
+	admissionRejectedFull      = "full"
+	admissionRejectedTimeout   = "timeout"
+	admissionRejectedPreempted = "preempted"
+
+	// admissionRetryAfter is the Retry-After delay of the rejected requests, in seconds
+	admissionRetryAfter = "1"
+)
+
+// priority classes, indexing priorities
+const (
+	classInteractive = iota
+	classStandard
+	classBatch
+)
+
+// priorities are the priority classes, by order of admission
+var priorities = []string{PriorityInteractive, PriorityStandard, PriorityBatch}
+
+var (
+	errAdmissionQueueFull    = errors.New("the admission queue is full")
+	errAdmissionQueueTimeout = errors.New("timed out in the admission queue")
+	errAdmissionPreempted    = errors.New("preempted by a higher priority request")
+)
+
+type admissionKey struct{}
+
+// admissionQueue bounds the requests served concurrently, queuing the others by priority class.
+// Within a class, the requests are admitted in arrival order.
+//
+// With preemption, an interactive request arriving in a saturated queue rejects the oldest
+// queued batch request when the queue is full, and otherwise cancels the prefill leg of the
+// oldest in-flight batch request to take over its slot.
+type admissionQueue struct {
+	rank        string
+	concurrency int           // requests served concurrently
+	size        int           // requests waiting at most, 0 for no limit
+	timeout     time.Duration // longest wait, 0 for no limit
+	preemption  bool          // interactive requests preempt batch ones
+
+	mu         sync.Mutex
+	running    int
+	queued     int
+	waiting    []*list.List // tickets by priority class
+	prefills   *list.List   // batch tickets in their prefill leg, oldest first
+	preempting int          // preempted tickets not released yet
+}
+
+// ticket is a request waiting in, or admitted by, the admission queue
+type ticket struct {
+	class     int
+	ready     chan struct{} // closed when admitted, or preempted while queued
+	admitted  bool
+	preempted bool
+
+	cancel  context.CancelCauseFunc // cancels the admitted request, nil when not preemptible
+	prefill *list.Element           // in prefills while the prefill leg runs, nil otherwise
+}
+
+// newAdmissionQueue creates an admission queue serving concurrency requests at once
+func newAdmissionQueue(rank string, concurrency int, size int, timeout time.Duration, preemption bool) *admissionQueue {
+	q := &admissionQueue{
+		rank:        rank,
+		concurrency: concurrency,
+		size:        size,
+		timeout:     timeout,
+		preemption:  preemption,
+		waiting:     make([]*list.List, len(priorities)),
+		prefills:    list.New(),
+	}
+	for i := range q.waiting {
+		q.waiting[i] = list.New()
+	}
+	return q
+}
+
+// acquire waits until the request of the given priority class is admitted. release must be
+// called with the returned ticket once the admitted request is served.
+func (q *admissionQueue) acquire(ctx context.Context, class int) (*ticket, error) {
+	t := &ticket{class: class}
+
+	q.mu.Lock()
+	if q.running < q.concurrency && q.queued == 0 {
+		q.running++
+		q.mu.Unlock()
+		metrics.RecordAdmissionWait(q.rank, priorities[class], 0)
+		return t, nil
+	}
+	if q.size > 0 && q.queued >= q.size && !q.preemptQueued(class) {
+		q.mu.Unlock()
+		metrics.RecordAdmissionRejected(q.rank, priorities[class], admissionRejectedFull)
+		return nil, errAdmissionQueueFull
+	}
+	t.ready = make(chan struct{})
+	element := q.waiting[class].PushBack(t)
+	q.queued++
+	metrics.SetAdmissionQueueDepth(q.rank, priorities[class], q.waiting[class].Len())
+	q.preemptPrefill(class)
+	q.mu.Unlock()
+
+	start := time.Now()
+	var timeout <-chan time.Time
+	if q.timeout > 0 {
+		timer := time.NewTimer(q.timeout)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+
+	var err error
+	select {
+	case <-t.ready:
+		if t.preempted {
+			return nil, errAdmissionPreempted
+		}
+		metrics.RecordAdmissionWait(q.rank, priorities[class], time.Since(start))
+		return t, nil
+	case <-timeout:
+		err = errAdmissionQueueTimeout
+		metrics.RecordAdmissionRejected(q.rank, priorities[class], admissionRejectedTimeout)
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	switch {
+	case t.admitted:
+		// admitted meanwhile, hand the slot over to the next request
+		q.next()
+	case t.preempted:
+		// already removed from the queue
+		err = errAdmissionPreempted
+	default:
+		q.waiting[class].Remove(element)
+		q.queued--
+		metrics.SetAdmissionQueueDepth(q.rank, priorities[class], q.waiting[class].Len())
+	}
+	return nil, err
+}
+
+// release ends an admitted request, admitting the next queued request if any
+func (q *admissionQueue) release(t *ticket) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if t.prefill != nil {
+		q.prefills.Remove(t.prefill)
+		t.prefill = nil
+	}
+	if t.preempted {
+		q.preempting--
+	}
+	q.next()
+}
+
+// startPrefill makes the prefill leg of the batch request of ctx preemptible, if it is. The
+// returned function must be called once the prefill leg is done.
+func (q *admissionQueue) startPrefill(ctx context.Context) func() {
+	t, ok := ctx.Value(admissionKey{}).(*ticket)
+	if !ok {
+		return func() {}
+	}
+
+	q.mu.Lock()
+	if !t.preempted {
+		t.prefill = q.prefills.PushBack(t)
+	}
+	q.mu.Unlock()
+
+	return func() {
+		q.mu.Lock()
+		defer q.mu.Unlock()
+		if t.prefill != nil {
+			q.prefills.Remove(t.prefill)
+			t.prefill = nil
+		}
+	}
+}
+
+// preemptQueued rejects the oldest queued batch request to make room for an interactive
+// request, reporting whether it did. It must be called with the lock held.
+func (q *admissionQueue) preemptQueued(class int) bool {
+	if !q.preemption || class != classInteractive {
+		return false
+	}
+	element := q.waiting[classBatch].Front()
+	if element == nil {
+		return false
+	}
+
+	t := q.waiting[classBatch].Remove(element).(*ticket)
+	q.queued--
+	metrics.SetAdmissionQueueDepth(q.rank, PriorityBatch, q.waiting[classBatch].Len())
+	metrics.RecordAdmissionRejected(q.rank, PriorityBatch, admissionRejectedPreempted)
+	t.preempted = true
+	close(t.ready)
+	return true
+}
+
+// preemptPrefill cancels the prefill leg of the oldest in-flight batch request, once per queued
+// interactive request, so that its slot is handed over to the interactive request. Canceling
+// the prefill request aborts it on the prefiller as well. It must be called with the lock held.
+func (q *admissionQueue) preemptPrefill(class int) {
+	if !q.preemption || class != classInteractive || q.waiting[classInteractive].Len() <= q.preempting {
+		return
+	}
+	element := q.prefills.Front()
+	if element == nil {
+		return
+	}
+
+	t := q.prefills.Remove(element).(*ticket)
+	t.prefill = nil
+	t.preempted = true
+	q.preempting++
+	metrics.RecordAdmissionRejected(q.rank, PriorityBatch, admissionRejectedPreempted)
+	t.cancel(errAdmissionPreempted)
+}
+
+// next hands the slot of an admitted request over to the first request of the highest
+// priority class waiting, or frees it. It must be called with the lock held.
+func (q *admissionQueue) next() {
+	for class, waiting := range q.waiting {
+		if element := waiting.Front(); element != nil {
+			t := waiting.Remove(element).(*ticket)
+			q.queued--
+			metrics.SetAdmissionQueueDepth(q.rank, priorities[class], waiting.Len())
+			t.admitted = true
+			close(t.ready)
+			return
+		}
+	}
+	q.running--
+}
+
+// priorityClass returns the index of the priority class of a request, standard when the
+// header is missing or unknown. The criticalities of the Gateway API Inference Extension
+// are accepted as well.
+func priorityClass(value string) int {
+	switch strings.ToLower(strings.TrimSpace(value)) {
+	case PriorityInteractive, "critical":
+		return classInteractive
+	case PriorityBatch, "sheddable":
+		return classBatch
+	default:
+		return classStandard
+	}
+}
+
+// admit serves the requests admitted by the admission queue, if enabled
+func (s *Server) admit(next http.Handler) http.Handler {
+	if s.admission == nil {
+		return next
+	}
+
+	header := s.config.PriorityHeader
+	if header == "" {
+		header = DefaultPriorityHeader
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		class := priorityClass(r.Header.Get(header))
+		setPhase(r.Context(), phaseQueued)
+		t, err := s.admission.acquire(r.Context(), class)
+		if err != nil {
+			s.logger.V(4).Info("request not admitted", "priority", priorities[class], "error", err.Error())
+			statusCode := http.StatusServiceUnavailable
+			if errors.Is(err, errAdmissionPreempted) {
+				statusCode = http.StatusTooManyRequests
+			}
+			w.Header().Set("Retry-After", admissionRetryAfter)
+			if err := errorStatus(statusCode, err.Error(), w); err != nil {
+				s.logger.Error(err, "failed to send error response to client")
+			}
+			return
+		}
+		defer s.admission.release(t)
+		setPhase(r.Context(), stageDecode)
+
+		if s.admission.preemption && class == classBatch {
+			ctx, cancelFn := context.WithCancelCause(r.Context())
+			defer cancelFn(nil)
+			t.cancel = cancelFn
+			r = r.WithContext(context.WithValue(ctx, admissionKey{}, t))
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// preempted answers 429 to a request whose prefill leg was preempted by a higher priority
+// request, reporting whether it was
+func (s *Server) preempted(w http.ResponseWriter, r *http.Request) bool {
+	if !errors.Is(context.Cause(r.Context()), errAdmissionPreempted) {
+		return false
+	}
+
+	s.logger.V(4).Info("prefill preempted by a higher priority request")
+	w.Header().Set("Retry-After", admissionRetryAfter)
+	if err := errorStatus(http.StatusTooManyRequests, errAdmissionPreempted.Error(), w); err != nil {
+		s.logger.Error(err, "failed to send error response to client")
+	}
+	return true
+}
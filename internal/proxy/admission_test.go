@@ -0,0 +1,259 @@
+/*
+Copyright 2025 The llm-d Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package proxy
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	"github.com/go-logr/logr"
+	. "github.com/onsi/ginkgo/v2" // nolint:revive
+	. "github.com/onsi/gomega"    // nolint:revive
+)
+
+var _ = Describe("Admission queue", func() {
+	// admit acquires a slot, which must be free
+	admit := func(q *admissionQueue, class int) *ticket {
+		t, err := q.acquire(context.Background(), class)
+		Expect(err).ToNot(HaveOccurred())
+		return t
+	}
+
+	// enqueue waits in the background for the admission of a request of the given class
+	enqueue := func(q *admissionQueue, class int) <-chan error {
+		admitted := make(chan error, 1)
+		go func() {
+			_, err := q.acquire(context.Background(), class)
+			admitted <- err
+		}()
+		return admitted
+	}
+
+	// queued returns the number of requests waiting in the queue
+	queued := func(q *admissionQueue) func() int {
+		return func() int {
+			q.mu.Lock()
+			defer q.mu.Unlock()
+			return q.queued
+		}
+	}
+
+	It("should admit requests up to the concurrency", func() {
+		q := newAdmissionQueue("0", 2, 0, 0, false)
+		first := admit(q, classStandard)
+		admit(q, classStandard)
+
+		third := enqueue(q, classStandard)
+		Consistently(third, 100*time.Millisecond).ShouldNot(Receive())
+
+		q.release(first)
+		Eventually(third).Should(Receive(BeNil()))
+	})
+
+	It("should admit the interactive requests before the batch ones", func() {
+		q := newAdmissionQueue("0", 1, 0, 0, false)
+		t := admit(q, classStandard)
+
+		batch := enqueue(q, priorityClass(PriorityBatch))
+		Eventually(queued(q)).Should(Equal(1))
+		interactive := enqueue(q, priorityClass(PriorityInteractive))
+		Eventually(queued(q)).Should(Equal(2))
+
+		q.release(t)
+		Eventually(interactive).Should(Receive(BeNil()))
+		Consistently(batch, 100*time.Millisecond).ShouldNot(Receive())
+	})
+
+	It("should reject the requests when the queue is full", func() {
+		q := newAdmissionQueue("0", 1, 1, 0, false)
+		t := admit(q, classStandard)
+		waiting := enqueue(q, classBatch)
+		Eventually(queued(q)).Should(Equal(1))
+
+		// without preemption, interactive requests are rejected as well
+		Expect(q.acquire(context.Background(), classInteractive)).Error().To(MatchError(errAdmissionQueueFull))
+
+		q.release(t)
+		Eventually(waiting).Should(Receive(BeNil()))
+	})
+
+	It("should reject the requests waiting longer than the timeout", func() {
+		q := newAdmissionQueue("0", 1, 0, 100*time.Millisecond, false)
+		t := admit(q, classStandard)
+
+		Expect(q.acquire(context.Background(), classStandard)).Error().To(MatchError(errAdmissionQueueTimeout))
+		Expect(q.queued).To(BeZero())
+
+		// the slot is freed once released
+		q.release(t)
+		admit(q, classStandard)
+	})
+
+	It("should remove the canceled requests from the queue", func() {
+		q := newAdmissionQueue("0", 1, 0, 0, false)
+		admit(q, classStandard)
+
+		ctx, cancelFn := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancelFn()
+		Expect(q.acquire(ctx, classStandard)).Error().To(MatchError(context.DeadlineExceeded))
+		Expect(q.queued).To(BeZero())
+		Expect(q.running).To(Equal(1))
+	})
+
+	It("should map the priority header to a class", func() {
+		Expect(priorityClass("Interactive")).To(Equal(classInteractive))
+		Expect(priorityClass("critical")).To(Equal(classInteractive))
+		Expect(priorityClass("")).To(Equal(classStandard))
+		Expect(priorityClass("unknown")).To(Equal(classStandard))
+		Expect(priorityClass(" batch ")).To(Equal(classBatch))
+		Expect(priorityClass("sheddable")).To(Equal(classBatch))
+	})
+
+	Context("with preemption", func() {
+		It("should reject the oldest queued batch request when the queue is full", func() {
+			q := newAdmissionQueue("0", 1, 2, 0, true)
+			t := admit(q, classStandard)
+			oldest := enqueue(q, classBatch)
+			Eventually(queued(q)).Should(Equal(1))
+			newest := enqueue(q, classBatch)
+			Eventually(queued(q)).Should(Equal(2))
+
+			interactive := enqueue(q, classInteractive)
+			Eventually(oldest).Should(Receive(MatchError(errAdmissionPreempted)))
+			Eventually(queued(q)).Should(Equal(2))
+
+			// standard requests do not preempt
+			Expect(q.acquire(context.Background(), classStandard)).Error().To(MatchError(errAdmissionQueueFull))
+
+			q.release(t)
+			Eventually(interactive).Should(Receive(BeNil()))
+			Consistently(newest, 100*time.Millisecond).ShouldNot(Receive())
+		})
+
+		It("should cancel the prefill leg of the oldest batch request", func() {
+			q := newAdmissionQueue("0", 2, 0, 0, true)
+
+			prefill := func() (*ticket, context.Context, func()) {
+				t := admit(q, classBatch)
+				ctx, cancelFn := context.WithCancelCause(context.Background())
+				DeferCleanup(func() { cancelFn(nil) })
+				t.cancel = cancelFn
+				ctx = context.WithValue(ctx, admissionKey{}, t)
+				return t, ctx, q.startPrefill(ctx)
+			}
+			oldest, oldestCtx, _ := prefill()
+			_, newestCtx, _ := prefill()
+
+			interactive := enqueue(q, classInteractive)
+			Eventually(oldestCtx.Done()).Should(BeClosed())
+			Expect(context.Cause(oldestCtx)).To(MatchError(errAdmissionPreempted))
+			Expect(newestCtx.Err()).ToNot(HaveOccurred())
+
+			// the slot is handed over once the preempted request is released
+			Consistently(interactive, 100*time.Millisecond).ShouldNot(Receive())
+			q.release(oldest)
+			Eventually(interactive).Should(Receive(BeNil()))
+			Expect(q.preempting).To(BeZero())
+			Expect(newestCtx.Err()).ToNot(HaveOccurred())
+		})
+
+		It("should not cancel the batch requests past their prefill leg", func() {
+			q := newAdmissionQueue("0", 1, 0, 0, true)
+			t := admit(q, classBatch)
+			ctx, cancelFn := context.WithCancelCause(context.Background())
+			defer cancelFn(nil)
+			t.cancel = cancelFn
+			ctx = context.WithValue(ctx, admissionKey{}, t)
+			q.startPrefill(ctx)()
+
+			interactive := enqueue(q, classInteractive)
+			Consistently(interactive, 100*time.Millisecond).ShouldNot(Receive())
+			Expect(ctx.Err()).ToNot(HaveOccurred())
+
+			q.release(t)
+			Eventually(interactive).Should(Receive(BeNil()))
+		})
+	})
+
+	It("should answer 503 with Retry-After to the rejected requests", func() {
+		s := &Server{
+			config:    Config{PriorityHeader: "x-priority"},
+			admission: newAdmissionQueue("0", 1, 1, 0, false),
+			logger:    logr.Discard(),
+		}
+		t := admit(s.admission, classStandard)
+		waiting := enqueue(s.admission, classStandard)
+		Eventually(queued(s.admission)).Should(Equal(1))
+
+		handler := s.admit(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+			w.WriteHeader(http.StatusOK)
+		}))
+
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, CompletionsPath, nil)
+		req.Header.Set("x-priority", PriorityInteractive)
+		handler.ServeHTTP(rec, req)
+		Expect(rec.Code).To(Equal(http.StatusServiceUnavailable))
+		Expect(rec.Header().Get("Retry-After")).To(Equal("1"))
+
+		s.admission.release(t)
+		Eventually(waiting).Should(Receive(BeNil()))
+	})
+
+	It("should answer 429 with Retry-After to the preempted requests", func() {
+		s := &Server{
+			config:    Config{},
+			admission: newAdmissionQueue("0", 1, 0, 0, true),
+			logger:    logr.Discard(),
+		}
+		prefilling := make(chan struct{})
+		handler := s.admit(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			// a prefill leg lasting until canceled
+			done := s.admission.startPrefill(r.Context())
+			close(prefilling)
+			<-r.Context().Done()
+			done()
+			if !s.preempted(w, r) {
+				w.WriteHeader(http.StatusOK)
+			}
+		}))
+
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, CompletionsPath, nil)
+		req.Header.Set(DefaultPriorityHeader, PriorityBatch)
+		served := make(chan struct{})
+		go func() {
+			defer close(served)
+			handler.ServeHTTP(rec, req)
+		}()
+		Eventually(prefilling).Should(BeClosed())
+
+		interactive := enqueue(s.admission, classInteractive)
+		Eventually(served).Should(BeClosed())
+		Expect(rec.Code).To(Equal(http.StatusTooManyRequests))
+		Expect(rec.Header().Get("Retry-After")).To(Equal("1"))
+		Eventually(interactive).Should(Receive(BeNil()))
+	})
+
+	It("should not wrap the handler when disabled", func() {
+		s := &Server{}
+		handler := http.HandlerFunc(func(http.ResponseWriter, *http.Request) {})
+		Expect(s.admit(handler)).To(BeAssignableToTypeOf(handler))
+	})
+})
@@ -18,17 +18,24 @@ package proxy
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"net"
+	"os"
+	"path/filepath"
+	"strings"
 	"sync"
 	"time"
 
 	"github.com/go-logr/logr"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/runtime/schema"
+	utilnet "k8s.io/apimachinery/pkg/util/net"
 	"k8s.io/apimachinery/pkg/watch"
 	"k8s.io/client-go/dynamic"
 	"k8s.io/client-go/tools/cache"
@@ -38,12 +45,30 @@ import (
 )
 
 const (
-	inferencePoolGroup    = "inference.networking.x-k8s.io"
-	inferencePoolVersion  = "v1alpha2"
-	inferencePoolResource = "inferencepools"
-	resyncPeriod          = 30 * time.Second
+	inferencePoolGroup        = "inference.networking.k8s.io"
+	inferencePoolVersion      = "v1"
+	inferencePoolAlphaGroup   = "inference.networking.x-k8s.io"
+	inferencePoolAlphaVersion = "v1alpha2"
+	inferencePoolResource     = "inferencepools"
+	resyncPeriod              = 30 * time.Second
+
+	// defaultStartupTimeout is how long the API server is waited for at startup
+	defaultStartupTimeout = 2 * time.Minute
+	startupRetryDelay     = 1 * time.Second
+	maxStartupRetryDelay  = 30 * time.Second
 )
 
+// inferencePoolAPIs are the supported InferencePool APIs, by order of preference
+var inferencePoolAPIs = []schema.GroupVersionResource{
+	{Group: inferencePoolGroup, Version: inferencePoolVersion, Resource: inferencePoolResource},
+	{Group: inferencePoolAlphaGroup, Version: inferencePoolAlphaVersion, Resource: inferencePoolResource},
+}
+
+// metadataIPs are the cloud metadata endpoints outside of the link-local ranges
+var metadataIPs = []net.IP{
+	net.ParseIP("fd00:ec2::254"), // AWS IMDS over IPv6
+}
+
 // AllowlistValidator manages allowed prefill targets based on InferencePool resources
 type AllowlistValidator struct {
 	logger        logr.Logger
@@ -52,6 +77,13 @@ type AllowlistValidator struct {
 	poolName      string
 	enabled       bool
 
+	// poolAPI is the InferencePool API served by the API server
+	poolAPI schema.GroupVersionResource
+
+	// strict denies the loopback, link-local and local targets, even when allowlisted
+	strict     bool
+	localHosts set.Set[string]
+
 	// allowedTargets maps hostport -> bool for allowed prefill targets
 	allowedTargets   set.Set[string]
 	allowedTargetsMu sync.RWMutex
@@ -62,6 +94,26 @@ type AllowlistValidator struct {
 	podStopChans   map[string]chan struct{} // individual stop channels for pod informers
 	podInformersMu sync.RWMutex
 	stopCh         chan struct{}
+
+	// startup retries of the transient API server errors
+	startupTimeout time.Duration
+	retryDelay     time.Duration
+
+	// snapshotPath is the file the allowlist is persisted to, to warm start before the
+	// informers sync
+	snapshotPath string
+	snapshotMu   sync.Mutex
+
+	// staleSince is when the allowlist got out of sync with the API server, zero while the
+	// InferencePool is watched. Past the grace period, the degraded mode decides the targets.
+	staleSince          time.Time
+	degraded            bool
+	degradedMode        string
+	degradedGracePeriod time.Duration
+	syncMu              sync.Mutex
+
+	// rank is the data parallel rank of the metrics
+	rank string
 }
 
 // NewAllowlistValidator creates a new SSRF protection validator
@@ -96,6 +148,8 @@ func NewAllowlistValidator(enabled bool, namespace string, poolName string) (*Al
 		podInformers:   make(map[string]cache.SharedInformer),
 		podStopChans:   make(map[string]chan struct{}),
 		stopCh:         make(chan struct{}),
+		startupTimeout: defaultStartupTimeout,
+		retryDelay:     startupRetryDelay,
 	}, nil
 }
 
@@ -108,11 +162,44 @@ func (av *AllowlistValidator) Start(ctx context.Context) error {
 	av.logger = klog.FromContext(ctx).WithName("allowlist-validator")
 	av.logger.Info("starting SSRF protection allowlist validator", "namespace", av.namespace, "poolName", av.poolName)
 
-	gvr := schema.GroupVersionResource{
-		Group:    inferencePoolGroup,
-		Version:  inferencePoolVersion,
-		Resource: inferencePoolResource,
+	// The allowlist is stale until the InferencePool is listed
+	av.markStale()
+
+	// With a snapshot, serve its allowlist and keep waiting for the API server in the background
+	if av.loadSnapshot() {
+		go func() {
+			for {
+				err := av.watch(ctx)
+				if err == nil || ctx.Err() != nil {
+					return
+				}
+				if !isTransientAPIError(err) {
+					av.logger.Error(err, "failed to watch the InferencePool, keeping the allowlist snapshot")
+					return
+				}
+				av.logger.Info("Warning: the Kubernetes API server is still unavailable, keeping the allowlist snapshot", "error", err.Error())
+			}
+		}()
+		return nil
 	}
+	return av.watch(ctx)
+}
+
+// watch waits for the API server and starts watching the InferencePool
+func (av *AllowlistValidator) watch(ctx context.Context) error {
+	// Fail fast on permanent errors (e.g. missing RBAC permissions), but wait for the API
+	// server while it is unavailable
+	var gvr schema.GroupVersionResource
+	err := av.waitForAPIServer(ctx, func(ctx context.Context) error {
+		var err error
+		gvr, err = av.detectPoolAPI(ctx)
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("failed to list InferencePool %s/%s: %w", av.namespace, av.poolName, err)
+	}
+	av.poolAPI = gvr
+	av.logger.Info("watching InferencePool", "apiVersion", gvr.GroupVersion().String())
 
 	// Create informer for the specific InferencePool resource
 	lw := &cache.ListWatch{
@@ -128,7 +215,8 @@ func (av *AllowlistValidator) Start(ctx context.Context) error {
 		},
 	}
 
-	av.poolInformer = cache.NewSharedInformer(lw, &unstructured.Unstructured{}, resyncPeriod)
+	av.poolInformer = cache.NewSharedInformer(av.monitor(lw), &unstructured.Unstructured{}, resyncPeriod)
+	_ = av.poolInformer.SetWatchErrorHandler(av.onWatchError)
 
 	// Add event handlers
 	_, _ = av.poolInformer.AddEventHandler(cache.ResourceEventHandlerFuncs{
@@ -141,14 +229,79 @@ func (av *AllowlistValidator) Start(ctx context.Context) error {
 	go av.poolInformer.Run(av.stopCh)
 
 	// Wait for cache sync
-	if !cache.WaitForCacheSync(av.stopCh, av.poolInformer.HasSynced) {
-		return fmt.Errorf("failed to sync InferencePool cache within timeout (check RBAC permissions for inferencepools.%s and that pool '%s' exists)", inferencePoolGroup, av.poolName)
+	syncCtx, cancelFn := context.WithTimeout(ctx, av.startupTimeout)
+	defer cancelFn()
+	if !cache.WaitForCacheSync(syncCtx.Done(), av.poolInformer.HasSynced) {
+		return fmt.Errorf("failed to sync InferencePool cache within timeout (check RBAC permissions for inferencepools.%s and that pool '%s' exists)", gvr.Group, av.poolName)
 	}
 
 	av.logger.Info("allowlist validator started successfully")
 	return nil
 }
 
+// detectPoolAPI returns the preferred InferencePool API served by the API server, preferring the
+// one holding the pool when several are served
+func (av *AllowlistValidator) detectPoolAPI(ctx context.Context) (schema.GroupVersionResource, error) {
+	var (
+		served []schema.GroupVersionResource
+		err    error
+	)
+	for _, gvr := range inferencePoolAPIs {
+		list, listErr := av.dynamicClient.Resource(gvr).Namespace(av.namespace).List(ctx, metav1.ListOptions{
+			FieldSelector: "metadata.name=" + av.poolName,
+			Limit:         1,
+		})
+		switch {
+		case listErr == nil && len(list.Items) > 0:
+			return gvr, nil
+		case listErr == nil:
+			served = append(served, gvr)
+		case apierrors.IsNotFound(listErr) || apierrors.IsForbidden(listErr):
+			// Not served, or not allowed by the RBAC permissions, report the latter first
+			if err == nil || apierrors.IsNotFound(err) {
+				err = listErr
+			}
+		default:
+			return gvr, listErr
+		}
+	}
+	if len(served) > 0 {
+		return served[0], nil
+	}
+	return schema.GroupVersionResource{}, err
+}
+
+// waitForAPIServer calls list until it succeeds or fails with a permanent error, retrying the
+// transient errors with an exponential backoff until the startup timeout
+func (av *AllowlistValidator) waitForAPIServer(ctx context.Context, list func(context.Context) error) error {
+	ctx, cancelFn := context.WithTimeout(ctx, av.startupTimeout)
+	defer cancelFn()
+
+	delay := av.retryDelay
+	for {
+		err := list(ctx)
+		if err == nil || !isTransientAPIError(err) {
+			return err
+		}
+		av.logger.Info("waiting for the Kubernetes API server", "error", err.Error(), "retryIn", delay)
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("the Kubernetes API server was unavailable for %v: %w", av.startupTimeout, err)
+		case <-time.After(delay):
+		}
+		delay = min(2*delay, maxStartupRetryDelay)
+	}
+}
+
+// isTransientAPIError returns whether a Kubernetes API call may succeed when retried
+func isTransientAPIError(err error) bool {
+	return apierrors.IsServerTimeout(err) || apierrors.IsTimeout(err) || apierrors.IsTooManyRequests(err) ||
+		apierrors.IsServiceUnavailable(err) || apierrors.IsInternalError(err) ||
+		apierrors.IsUnexpectedServerError(err) || utilnet.IsConnectionRefused(err) ||
+		utilnet.IsConnectionReset(err) || utilnet.IsProbableEOF(err) || utilnet.IsTimeout(err)
+}
+
 // Stop stops all watchers and cleans up resources
 func (av *AllowlistValidator) Stop() {
 	if !av.enabled {
@@ -182,6 +335,16 @@ func (av *AllowlistValidator) IsAllowed(hostPort string) bool {
 	// Clean up the hostPort input
 	hostPort = av.normalizeHostPort(hostPort)
 
+	if av.strict && av.isLocal(hostPort) {
+		av.logger.V(4).Info("allowlist check", "hostPort", hostPort, "allowed", false, "reason", "local target")
+		return false
+	}
+
+	if degraded, allowed := av.degradedDecision(); degraded {
+		av.logger.V(4).Info("allowlist check", "hostPort", hostPort, "allowed", allowed, "reason", "stale allowlist")
+		return allowed
+	}
+
 	av.allowedTargetsMu.RLock()
 	defer av.allowedTargetsMu.RUnlock()
 
@@ -190,6 +353,112 @@ func (av *AllowlistValidator) IsAllowed(hostPort string) bool {
 	return allowed
 }
 
+// EnableStrict additionally denies the loopback and link-local (e.g. cloud metadata) targets,
+// as well as the addresses and host name of the sidecar's own pod
+func (av *AllowlistValidator) EnableStrict() error {
+	if !av.enabled {
+		return nil
+	}
+
+	hosts, err := localHosts()
+	if err != nil {
+		return err
+	}
+	av.strict = true
+	av.localHosts = hosts
+	return nil
+}
+
+// localHosts returns the IP addresses of the network interfaces and the host name of the pod
+func localHosts() (set.Set[string], error) {
+	addrs, err := net.InterfaceAddrs()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list the local addresses: %w", err)
+	}
+	hosts := set.New[string]()
+	for _, addr := range addrs {
+		if prefix, ok := addr.(*net.IPNet); ok {
+			hosts.Insert(prefix.IP.String())
+		}
+	}
+	if hostname, err := os.Hostname(); err == nil && hostname != "" {
+		hosts.Insert(strings.ToLower(hostname))
+	}
+	return hosts, nil
+}
+
+// isLocal returns whether host is a loopback, link-local or metadata address, or one of the local hosts
+func (av *AllowlistValidator) isLocal(host string) bool {
+	host = strings.TrimSuffix(strings.ToLower(host), ".")
+	if host == "localhost" || strings.HasSuffix(host, ".localhost") {
+		return true
+	}
+	if zone := strings.IndexByte(host, '%'); zone >= 0 {
+		host = host[:zone]
+	}
+
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return av.localHosts.Has(host)
+	}
+	if ip.IsLoopback() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsUnspecified() {
+		return true
+	}
+	for _, metadataIP := range metadataIPs {
+		if ip.Equal(metadataIP) {
+			return true
+		}
+	}
+	return av.localHosts.Has(ip.String())
+}
+
+// Rebuild rebuilds the allowlist from the pods currently known to the watchers, dropping
+// any stale target. It returns the number of allowed targets.
+func (av *AllowlistValidator) Rebuild() int {
+	if !av.enabled {
+		return 0
+	}
+
+	av.rebuildAllowlist()
+
+	av.allowedTargetsMu.RLock()
+	defer av.allowedTargetsMu.RUnlock()
+	return av.allowedTargets.Len()
+}
+
+// AllowlistSnapshot is a point-in-time copy of the SSRF protection allowlist
+type AllowlistSnapshot struct {
+	Enabled   bool     `json:"enabled"`
+	Strict    bool     `json:"strict,omitempty"`
+	StaleFor  string   `json:"staleFor,omitempty"`
+	Namespace string   `json:"namespace,omitempty"`
+	PoolName  string   `json:"poolName,omitempty"`
+	Targets   []string `json:"targets"`
+}
+
+// Snapshot returns a copy of the current allowlist
+func (av *AllowlistValidator) Snapshot() AllowlistSnapshot {
+	snapshot := AllowlistSnapshot{
+		Enabled:   av.enabled,
+		Strict:    av.strict,
+		Namespace: av.namespace,
+		PoolName:  av.poolName,
+		Targets:   []string{},
+	}
+	if !av.enabled {
+		return snapshot
+	}
+
+	av.allowedTargetsMu.RLock()
+	defer av.allowedTargetsMu.RUnlock()
+
+	snapshot.Targets = av.allowedTargets.SortedList()
+	if age := av.SyncAge(); age > 0 {
+		snapshot.StaleFor = age.Round(time.Second).String()
+	}
+	return snapshot
+}
+
 // normalizeHostPort extracts the host part from a host:port string
 func (av *AllowlistValidator) normalizeHostPort(hostPort string) string {
 	// Use net.SplitHostPort to handle IPv6 addresses and ports
@@ -248,7 +517,12 @@ func (av *AllowlistValidator) updatePodsForPool(poolObj *unstructured.Unstructur
 		return
 	}
 
-	selectorData, found, err := unstructured.NestedMap(spec, "selector")
+	// The v1 API selects the pods with the matchLabels of a label selector
+	selectorField := []string{"selector"}
+	if av.poolAPI.Group == inferencePoolGroup {
+		selectorField = append(selectorField, "matchLabels")
+	}
+	selectorData, found, err := unstructured.NestedMap(spec, selectorField...)
 	if err != nil || !found {
 		av.logger.Error(err, "InferencePool missing or invalid selector field", "name", poolName, "found", found)
 		return
@@ -298,7 +572,8 @@ func (av *AllowlistValidator) createPodInformer(poolName string, selector labels
 		},
 	}
 
-	podInformer := cache.NewSharedInformer(podLW, &unstructured.Unstructured{}, resyncPeriod)
+	podInformer := cache.NewSharedInformer(av.monitor(podLW), &unstructured.Unstructured{}, resyncPeriod)
+	_ = podInformer.SetWatchErrorHandler(av.onWatchError)
 
 	// Add event handlers
 	_, _ = podInformer.AddEventHandler(cache.ResourceEventHandlerFuncs{
@@ -340,8 +615,86 @@ func (av *AllowlistValidator) onPodDelete(obj interface{}) {
 	av.rebuildAllowlist()
 }
 
-// rebuildAllowlist rebuilds the entire allowlist from current pod state
+// loadSnapshot loads the allowlist snapshot of the InferencePool, and returns whether it was loaded
+func (av *AllowlistValidator) loadSnapshot() bool {
+	if av.snapshotPath == "" {
+		return false
+	}
+
+	data, err := os.ReadFile(av.snapshotPath)
+	if errors.Is(err, os.ErrNotExist) {
+		av.logger.Info("no allowlist snapshot to warm start from", "path", av.snapshotPath)
+		return false
+	}
+	var snapshot AllowlistSnapshot
+	if err == nil {
+		err = json.Unmarshal(data, &snapshot)
+	}
+	if err != nil {
+		av.logger.Error(err, "failed to load the allowlist snapshot", "path", av.snapshotPath)
+		return false
+	}
+	if snapshot.Namespace != av.namespace || snapshot.PoolName != av.poolName {
+		av.logger.Info("Warning: ignoring the allowlist snapshot of another InferencePool", "path", av.snapshotPath,
+			"namespace", snapshot.Namespace, "poolName", snapshot.PoolName)
+		return false
+	}
+
+	av.allowedTargetsMu.Lock()
+	defer av.allowedTargetsMu.Unlock()
+	av.allowedTargets = set.New(snapshot.Targets...)
+	av.logger.Info("loaded the allowlist snapshot", "path", av.snapshotPath, "targetCount", len(snapshot.Targets))
+	return true
+}
+
+// saveSnapshot persists the allowlist, replacing the snapshot file atomically
+func (av *AllowlistValidator) saveSnapshot(targets []string) {
+	if av.snapshotPath == "" {
+		return
+	}
+
+	data, err := json.Marshal(AllowlistSnapshot{
+		Enabled:   true,
+		Namespace: av.namespace,
+		PoolName:  av.poolName,
+		Targets:   targets,
+	})
+	if err == nil {
+		err = writeFileAtomic(av.snapshotPath, data)
+	}
+	if err != nil {
+		av.logger.Error(err, "failed to save the allowlist snapshot", "path", av.snapshotPath)
+	}
+}
+
+// writeFileAtomic writes data to a temporary file renamed to path, so that path is never partially written
+func writeFileAtomic(path string, data []byte) error {
+	file, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(file.Name()) //nolint:all
+
+	_, err = file.Write(data)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	return os.Rename(file.Name(), path)
+}
+
+// rebuildAllowlist rebuilds the entire allowlist from current pod state, and persists it to the snapshot
 func (av *AllowlistValidator) rebuildAllowlist() {
+	av.snapshotMu.Lock()
+	defer av.snapshotMu.Unlock()
+
+	av.saveSnapshot(av.rebuildTargets())
+}
+
+// rebuildTargets rebuilds the allowlist from current pod state and returns its targets
+func (av *AllowlistValidator) rebuildTargets() []string {
 	av.allowedTargetsMu.Lock()
 	defer av.allowedTargetsMu.Unlock()
 
@@ -368,6 +721,7 @@ func (av *AllowlistValidator) rebuildAllowlist() {
 	}
 
 	av.logger.Info("rebuilt allowlist", "targetCount", len(av.allowedTargets), "targets", av.allowedTargets)
+	return av.allowedTargets.SortedList()
 }
 
 // addPodToAllowlist adds a pod's endpoints to the allowlist
@@ -0,0 +1,117 @@
+/*
+Copyright 2025 The llm-d Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package proxy
+
+import (
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/tools/cache"
+
+	"github.com/llm-d/llm-d-routing-sidecar/internal/metrics"
+)
+
+const (
+	// SSRFDegradedFailClosed denies all prefill targets once the allowlist is stale for the grace period
+	SSRFDegradedFailClosed = "fail-closed"
+
+	// SSRFDegradedFailOpen allows all prefill targets once the allowlist is stale for the grace period
+	SSRFDegradedFailOpen = "fail-open"
+)
+
+// monitor wraps the list and watch calls of an informer to track whether the allowlist is in
+// sync with the API server
+func (av *AllowlistValidator) monitor(lw *cache.ListWatch) *cache.ListWatch {
+	list, watchFn := lw.ListFunc, lw.WatchFunc
+	lw.ListFunc = func(options metav1.ListOptions) (runtime.Object, error) {
+		obj, err := list(options)
+		av.markSynced(err)
+		return obj, err
+	}
+	lw.WatchFunc = func(options metav1.ListOptions) (watch.Interface, error) {
+		w, err := watchFn(options)
+		av.markSynced(err)
+		return w, err
+	}
+	return lw
+}
+
+// onWatchError is called when an informer fails to list or watch, before reconnecting
+func (av *AllowlistValidator) onWatchError(_ *cache.Reflector, err error) {
+	metrics.RecordAllowlistWatchReconnect(av.rank)
+	av.logger.Info("Warning: the InferencePool watch failed, reconnecting", "error", err.Error())
+	av.markStale()
+}
+
+// markSynced marks the allowlist in sync with the API server after a successful list or watch
+func (av *AllowlistValidator) markSynced(err error) {
+	if err != nil {
+		av.markStale()
+		return
+	}
+
+	av.syncMu.Lock()
+	defer av.syncMu.Unlock()
+	if !av.staleSince.IsZero() {
+		av.logger.Info("allowlist in sync with the API server", "staleFor", time.Since(av.staleSince).Round(time.Millisecond))
+		av.staleSince = time.Time{}
+		av.degraded = false
+	}
+}
+
+// markStale marks the allowlist out of sync with the API server, unless it already is
+func (av *AllowlistValidator) markStale() {
+	av.syncMu.Lock()
+	defer av.syncMu.Unlock()
+	if av.staleSince.IsZero() {
+		av.staleSince = time.Now()
+	}
+}
+
+// SyncAge returns how long the allowlist has been out of sync with the API server, 0 while
+// the InferencePool is watched
+func (av *AllowlistValidator) SyncAge() time.Duration {
+	av.syncMu.Lock()
+	defer av.syncMu.Unlock()
+	if av.staleSince.IsZero() {
+		return 0
+	}
+	return time.Since(av.staleSince)
+}
+
+// degradedDecision returns whether the allowlist is stale for longer than the grace period and,
+// if so, whether the degraded mode allows the prefill targets
+func (av *AllowlistValidator) degradedDecision() (degraded bool, allowed bool) {
+	if av.degradedGracePeriod <= 0 {
+		return false, false
+	}
+
+	av.syncMu.Lock()
+	defer av.syncMu.Unlock()
+	if av.staleSince.IsZero() || time.Since(av.staleSince) < av.degradedGracePeriod {
+		return false, false
+	}
+	allowed = av.degradedMode == SSRFDegradedFailOpen
+	if !av.degraded {
+		av.degraded = true
+		av.logger.Info("Warning: the allowlist is stale, SSRF protection is degraded", "mode", av.degradedMode,
+			"staleFor", time.Since(av.staleSince).Round(time.Second), "gracePeriod", av.degradedGracePeriod)
+	}
+	return true, allowed
+}
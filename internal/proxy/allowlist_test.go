@@ -17,8 +17,27 @@ limitations under the License.
 package proxy
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"syscall"
+	"time"
+
+	"github.com/go-logr/logr"
 	. "github.com/onsi/ginkgo/v2" // nolint:revive
 	. "github.com/onsi/gomega"    // nolint:revive
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	k8stesting "k8s.io/client-go/testing"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/klog/v2"
+	"k8s.io/klog/v2/ktesting"
 	"k8s.io/utils/set"
 )
 
@@ -89,4 +108,301 @@ var _ = Describe("AllowlistValidator", func() {
 			Expect(normalized).To(Equal("::1"))
 		})
 	})
+
+	Context("when strict SSRF protection is enabled", func() {
+		var validator *AllowlistValidator
+
+		BeforeEach(func() {
+			validator = &AllowlistValidator{
+				enabled:   true,
+				strict:    true,
+				namespace: "test-namespace",
+				allowedTargets: set.New(
+					"10.244.1.100",
+					"10.244.1.101",
+					"127.0.0.1",
+					"169.254.169.254",
+					"decode-pod",
+				),
+				localHosts: set.New("10.244.1.101", "decode-pod"),
+			}
+		})
+
+		It("should allow the other allowlisted targets", func() {
+			Expect(validator.IsAllowed("10.244.1.100:8000")).To(BeTrue())
+		})
+
+		It("should deny the loopback, link-local and metadata targets", func() {
+			Expect(validator.IsAllowed("127.0.0.1:8000")).To(BeFalse())
+			Expect(validator.IsAllowed("169.254.169.254:80")).To(BeFalse())
+			Expect(validator.isLocal("localhost")).To(BeTrue())
+			Expect(validator.isLocal("::ffff:127.0.0.1")).To(BeTrue())
+			Expect(validator.isLocal("0.0.0.0")).To(BeTrue())
+			Expect(validator.isLocal("fe80::1%eth0")).To(BeTrue())
+			Expect(validator.isLocal("fd00:ec2::254")).To(BeTrue())
+		})
+
+		It("should deny the own pod", func() {
+			Expect(validator.IsAllowed("10.244.1.101:8000")).To(BeFalse())
+			Expect(validator.IsAllowed("decode-pod:8000")).To(BeFalse())
+			Expect(validator.IsAllowed("Decode-Pod.:8000")).To(BeFalse())
+		})
+	})
+
+	Context("when waiting for the API server", func() {
+		var (
+			validator *AllowlistValidator
+			calls     int
+		)
+
+		BeforeEach(func() {
+			validator = &AllowlistValidator{
+				logger:         ktesting.NewLogger(GinkgoT(), ktesting.NewConfig()),
+				startupTimeout: 500 * time.Millisecond,
+				retryDelay:     10 * time.Millisecond,
+			}
+			calls = 0
+		})
+
+		listFailing := func(errs ...error) func(context.Context) error {
+			return func(context.Context) error {
+				calls++
+				if calls > len(errs) {
+					return nil
+				}
+				return errs[calls-1]
+			}
+		}
+
+		It("should retry transient errors", func() {
+			err := validator.waitForAPIServer(context.Background(), listFailing(
+				apierrors.NewServiceUnavailable("starting"),
+				apierrors.NewTooManyRequests("slow down", 1),
+				&net.OpError{Op: "dial", Err: syscall.ECONNREFUSED},
+			))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(calls).To(Equal(4))
+		})
+
+		It("should fail fast on permanent errors", func() {
+			forbidden := apierrors.NewForbidden(schema.GroupResource{Group: inferencePoolGroup, Resource: inferencePoolResource}, "pool", errors.New("RBAC"))
+			err := validator.waitForAPIServer(context.Background(), listFailing(forbidden))
+			Expect(apierrors.IsForbidden(err)).To(BeTrue())
+			Expect(calls).To(Equal(1))
+		})
+
+		It("should fail when the API server stays unavailable", func() {
+			err := validator.waitForAPIServer(context.Background(), func(context.Context) error {
+				calls++
+				return apierrors.NewServiceUnavailable("down")
+			})
+			Expect(apierrors.IsServiceUnavailable(err)).To(BeTrue())
+			Expect(err.Error()).To(ContainSubstring("unavailable for 500ms"))
+			Expect(calls).To(BeNumerically(">", 2))
+		})
+	})
+
+	Context("with an allowlist snapshot", func() {
+		var (
+			validator *AllowlistValidator
+			path      string
+		)
+
+		BeforeEach(func() {
+			path = filepath.Join(GinkgoT().TempDir(), "allowlist.json")
+			validator = &AllowlistValidator{
+				logger:         ktesting.NewLogger(GinkgoT(), ktesting.NewConfig()),
+				enabled:        true,
+				namespace:      "test-namespace",
+				poolName:       "test-pool",
+				allowedTargets: set.New[string](),
+				podInformers:   map[string]cache.SharedInformer{},
+				stopCh:         make(chan struct{}),
+				startupTimeout: 50 * time.Millisecond,
+				retryDelay:     10 * time.Millisecond,
+				snapshotPath:   path,
+			}
+		})
+
+		writeSnapshot := func(snapshot AllowlistSnapshot) {
+			data, err := json.Marshal(snapshot)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(os.WriteFile(path, data, 0o600)).To(Succeed())
+		}
+
+		It("should persist the allowlist when it is rebuilt", func() {
+			validator.rebuildAllowlist()
+
+			data, err := os.ReadFile(path)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(string(data)).To(MatchJSON(`{"enabled":true,"namespace":"test-namespace","poolName":"test-pool","targets":[]}`))
+		})
+
+		It("should serve the snapshot while the API server is unavailable", func() {
+			writeSnapshot(AllowlistSnapshot{Enabled: true, Namespace: "test-namespace", PoolName: "test-pool", Targets: []string{"10.244.1.100", "prefill-pod"}})
+			client := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(), map[schema.GroupVersionResource]string{
+				inferencePoolAPIs[0]: "InferencePoolList",
+				inferencePoolAPIs[1]: "InferencePoolList",
+			})
+			client.PrependReactor("list", "*", func(k8stesting.Action) (bool, runtime.Object, error) {
+				return true, nil, apierrors.NewServiceUnavailable("down")
+			})
+			validator.dynamicClient = client
+
+			// The watch keeps retrying in the background, after the test logger is done
+			ctx, cancelFn := context.WithCancel(klog.NewContext(context.Background(), logr.Discard()))
+			defer cancelFn()
+			Expect(validator.Start(ctx)).To(Succeed())
+			Expect(validator.IsAllowed("10.244.1.100:8000")).To(BeTrue())
+			Expect(validator.IsAllowed("prefill-pod:8000")).To(BeTrue())
+			Expect(validator.IsAllowed("10.244.1.200:8000")).To(BeFalse())
+		})
+
+		It("should ignore the snapshot of another InferencePool", func() {
+			writeSnapshot(AllowlistSnapshot{Enabled: true, Namespace: "test-namespace", PoolName: "other-pool", Targets: []string{"10.244.1.100"}})
+			Expect(validator.loadSnapshot()).To(BeFalse())
+			Expect(validator.IsAllowed("10.244.1.100:8000")).To(BeFalse())
+		})
+
+		It("should start cold without a snapshot", func() {
+			Expect(validator.loadSnapshot()).To(BeFalse())
+		})
+	})
+
+	Context("when the allowlist is stale", func() {
+		var validator *AllowlistValidator
+
+		BeforeEach(func() {
+			validator = &AllowlistValidator{
+				logger:              ktesting.NewLogger(GinkgoT(), ktesting.NewConfig()),
+				enabled:             true,
+				allowedTargets:      set.New("10.244.1.100"),
+				degradedMode:        SSRFDegradedFailClosed,
+				degradedGracePeriod: time.Minute,
+			}
+		})
+
+		It("should report the sync age", func() {
+			Expect(validator.SyncAge()).To(BeZero())
+			validator.staleSince = time.Now().Add(-time.Minute)
+			Expect(validator.SyncAge()).To(BeNumerically(">=", time.Minute))
+
+			validator.markSynced(nil)
+			Expect(validator.SyncAge()).To(BeZero())
+		})
+
+		It("should keep the stale allowlist during the grace period", func() {
+			validator.markStale()
+			Expect(validator.IsAllowed("10.244.1.100:8000")).To(BeTrue())
+			Expect(validator.IsAllowed("10.244.1.200:8000")).To(BeFalse())
+		})
+
+		It("should deny all targets past the grace period when failing closed", func() {
+			validator.staleSince = time.Now().Add(-2 * time.Minute)
+			Expect(validator.IsAllowed("10.244.1.100:8000")).To(BeFalse())
+
+			validator.markSynced(nil)
+			Expect(validator.IsAllowed("10.244.1.100:8000")).To(BeTrue())
+		})
+
+		It("should allow all targets past the grace period when failing open", func() {
+			validator.degradedMode = SSRFDegradedFailOpen
+			validator.staleSince = time.Now().Add(-2 * time.Minute)
+			Expect(validator.IsAllowed("10.244.1.200:8000")).To(BeTrue())
+		})
+
+		It("should keep the stale allowlist without grace period", func() {
+			validator.degradedGracePeriod = 0
+			validator.staleSince = time.Now().Add(-time.Hour)
+			Expect(validator.IsAllowed("10.244.1.100:8000")).To(BeTrue())
+			Expect(validator.IsAllowed("10.244.1.200:8000")).To(BeFalse())
+		})
+
+		It("should get stale when a watch fails", func() {
+			validator.markSynced(errors.New("connection refused"))
+			Expect(validator.SyncAge()).To(BeNumerically(">", 0))
+
+			validator.onWatchError(nil, errors.New("watch closed"))
+			Expect(validator.SyncAge()).To(BeNumerically(">", 0))
+		})
+	})
+
+	Context("with the InferencePool API versions", func() {
+		var validator *AllowlistValidator
+
+		pod := func(name string, app string, ip string) runtime.Object {
+			return &unstructured.Unstructured{Object: map[string]interface{}{
+				"apiVersion": "v1",
+				"kind":       "Pod",
+				"metadata":   map[string]interface{}{"name": name, "namespace": "test-namespace", "labels": map[string]interface{}{"app": app}},
+				"status":     map[string]interface{}{"podIP": ip},
+			}}
+		}
+		pool := func(gvr schema.GroupVersionResource, selector map[string]interface{}) runtime.Object {
+			return &unstructured.Unstructured{Object: map[string]interface{}{
+				"apiVersion": gvr.GroupVersion().String(),
+				"kind":       "InferencePool",
+				"metadata":   map[string]interface{}{"name": "test-pool", "namespace": "test-namespace"},
+				"spec":       map[string]interface{}{"selector": selector},
+			}}
+		}
+		start := func(objects ...runtime.Object) *dynamicfake.FakeDynamicClient {
+			client := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(), map[schema.GroupVersionResource]string{
+				inferencePoolAPIs[0]:              "InferencePoolList",
+				inferencePoolAPIs[1]:              "InferencePoolList",
+				{Version: "v1", Resource: "pods"}: "PodList",
+			}, append(objects, pod("vllm-0", "vllm", "10.244.1.10"), pod("other-0", "other", "10.244.1.11"))...)
+			validator = &AllowlistValidator{
+				enabled:        true,
+				dynamicClient:  client,
+				namespace:      "test-namespace",
+				poolName:       "test-pool",
+				allowedTargets: set.New[string](),
+				podInformers:   map[string]cache.SharedInformer{},
+				podStopChans:   map[string]chan struct{}{},
+				stopCh:         make(chan struct{}),
+				startupTimeout: 5 * time.Second,
+				retryDelay:     10 * time.Millisecond,
+			}
+			return client
+		}
+
+		AfterEach(func() {
+			validator.Stop()
+		})
+
+		// The informers keep logging in the background, after the test logger is done
+		ctx := klog.NewContext(context.Background(), logr.Discard())
+
+		It("should watch the v1 API", func() {
+			start(pool(inferencePoolAPIs[0], map[string]interface{}{"matchLabels": map[string]interface{}{"app": "vllm"}}))
+			Expect(validator.Start(ctx)).To(Succeed())
+
+			Expect(validator.poolAPI).To(Equal(inferencePoolAPIs[0]))
+			Eventually(func() bool { return validator.IsAllowed("10.244.1.10:8000") }).Should(BeTrue())
+			Expect(validator.IsAllowed("10.244.1.11:8000")).To(BeFalse())
+		})
+
+		It("should fall back to the v1alpha2 API", func() {
+			client := start(pool(inferencePoolAPIs[1], map[string]interface{}{"app": "vllm"}))
+			client.PrependReactor("list", inferencePoolResource, func(action k8stesting.Action) (bool, runtime.Object, error) {
+				if action.GetResource().Group != inferencePoolGroup {
+					return false, nil, nil
+				}
+				return true, nil, apierrors.NewNotFound(action.GetResource().GroupResource(), "")
+			})
+			Expect(validator.Start(ctx)).To(Succeed())
+
+			Expect(validator.poolAPI).To(Equal(inferencePoolAPIs[1]))
+			Eventually(func() bool { return validator.IsAllowed("10.244.1.10:8000") }).Should(BeTrue())
+			Expect(validator.IsAllowed("10.244.1.11:8000")).To(BeFalse())
+		})
+
+		It("should prefer the API holding the pool", func() {
+			start(pool(inferencePoolAPIs[1], map[string]interface{}{"app": "vllm"}))
+			Expect(validator.Start(ctx)).To(Succeed())
+
+			Expect(validator.poolAPI).To(Equal(inferencePoolAPIs[1]))
+		})
+	})
 })
@@ -0,0 +1,118 @@
+/*
+Copyright 2025 The llm-d Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package proxy
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"strings"
+)
+
+var (
+	// AudioTranscriptionsPath is the OpenAI audio transcriptions path
+	AudioTranscriptionsPath = "/v1/audio/transcriptions"
+
+	// AudioSpeechPath is the OpenAI text to speech path
+	AudioSpeechPath = "/v1/audio/speech"
+)
+
+// createAudioProxies creates the handlers forwarding audio requests to the engines serving each model
+func createAudioProxies(routes map[string]string) (map[string]http.Handler, error) {
+	proxies := make(map[string]http.Handler, len(routes))
+	for model, target := range routes {
+		if !strings.Contains(target, "://") {
+			target = "http://" + target
+		}
+		u, err := url.Parse(target)
+		if err != nil {
+			return nil, fmt.Errorf("invalid audio route for model %q: %w", model, err)
+		}
+		proxies[model] = httputil.NewSingleHostReverseProxy(u)
+	}
+	return proxies, nil
+}
+
+// audioHandler routes audio requests decode-only, or to the engine serving the
+// requested model when audio model routes are configured
+func (s *Server) audioHandler(w http.ResponseWriter, r *http.Request) {
+	if len(s.audioProxies) == 0 {
+		s.decoderProxy.ServeHTTP(w, r)
+		return
+	}
+
+	body, err := readRequestBody(w, r, s.config.MaxRequestBodyBytes)
+	r.Body.Close() //nolint:all
+	if err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			if err := errorRequestTooLarge(err, w); err != nil {
+				s.logger.Error(err, "failed to send error response to client")
+			}
+			return
+		}
+		// TODO: check FastAPI error code when failing to read body
+		if err := errorStatus(http.StatusBadRequest, err.Error(), w); err != nil {
+			s.logger.Error(err, "failed to send error response to client")
+		}
+		return
+	}
+	setRequestBody(r, io.NopCloser(bytes.NewReader(body)), len(body))
+
+	model := audioRequestModel(r.Header.Get("Content-Type"), body)
+	if audioProxy, ok := s.audioProxies[model]; ok {
+		s.logger.V(4).Info("routing audio request", "model", model)
+		audioProxy.ServeHTTP(w, r)
+		return
+	}
+
+	s.logger.V(4).Info("no audio route for model, sending to decoder", "model", model)
+	s.decoderProxy.ServeHTTP(w, r)
+}
+
+// audioRequestModel returns the model of a multipart (transcriptions) or JSON (speech) audio request
+func audioRequestModel(contentType string, body []byte) string {
+	mediaType, params, err := mime.ParseMediaType(contentType)
+	if err == nil && mediaType == "multipart/form-data" {
+		reader := multipart.NewReader(bytes.NewReader(body), params["boundary"])
+		for {
+			part, err := reader.NextPart()
+			if err != nil {
+				return ""
+			}
+			if part.FormName() == requestFieldModel {
+				model, _ := io.ReadAll(part) //nolint:all
+				return strings.TrimSpace(string(model))
+			}
+		}
+	}
+
+	var request struct {
+		Model string `json:"model"`
+	}
+	if err := json.Unmarshal(body, &request); err != nil {
+		return ""
+	}
+	return request.Model
+}
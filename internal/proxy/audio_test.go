@@ -0,0 +1,129 @@
+/*
+Copyright 2025 The llm-d Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package proxy
+
+import (
+	"bytes"
+	"context"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/llm-d/llm-d-routing-sidecar/test/mock"
+	. "github.com/onsi/ginkgo/v2" // nolint:revive
+	. "github.com/onsi/gomega"    // nolint:revive
+	"k8s.io/klog/v2/ktesting"
+)
+
+var _ = Describe("Audio endpoints", func() {
+	var (
+		ctx           context.Context
+		decodeHandler *mock.GenericHandler
+		audioHandler  *mock.GenericHandler
+		audioHostPort string
+		decodeURL     *url.URL
+		transcription *bytes.Buffer
+		multipartType string
+	)
+
+	BeforeEach(func() {
+		_, ctx = ktesting.NewTestContext(GinkgoT())
+		var cancelFn context.CancelFunc
+		ctx, cancelFn = context.WithCancel(ctx)
+		DeferCleanup(cancelFn)
+
+		decodeHandler = &mock.GenericHandler{}
+		decodeBackend := httptest.NewServer(decodeHandler)
+		DeferCleanup(decodeBackend.Close)
+
+		audioHandler = &mock.GenericHandler{}
+		audioBackend := httptest.NewServer(audioHandler)
+		DeferCleanup(audioBackend.Close)
+		audioHostPort = audioBackend.URL[len("http://"):]
+
+		var err error
+		decodeURL, err = url.Parse(decodeBackend.URL)
+		Expect(err).ToNot(HaveOccurred())
+
+		transcription = &bytes.Buffer{}
+		writer := multipart.NewWriter(transcription)
+		Expect(writer.WriteField("model", "openai/whisper-large-v3")).To(Succeed())
+		file, err := writer.CreateFormFile("file", "audio.wav")
+		Expect(err).ToNot(HaveOccurred())
+		_, err = file.Write([]byte("RIFF....WAVE"))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(writer.Close()).To(Succeed())
+		multipartType = writer.FormDataContentType()
+	})
+
+	startProxy := func(config Config) string {
+		proxy, err := NewProxy("0", decodeURL, config)
+		Expect(err).ToNot(HaveOccurred())
+
+		go func() {
+			defer GinkgoRecover()
+			Expect(proxy.Start(ctx)).To(Succeed())
+		}()
+		time.Sleep(1 * time.Second)
+		Expect(proxy.Addr()).ToNot(BeNil())
+		return "http://" + proxy.Addr().String()
+	}
+
+	post := func(u string, contentType string, body string) {
+		resp, err := http.Post(u, contentType, strings.NewReader(body))
+		Expect(err).ToNot(HaveOccurred())
+		resp.Body.Close() //nolint:all
+		Expect(resp.StatusCode).To(Equal(http.StatusOK))
+	}
+
+	It("should send audio requests decode-only by default", func() {
+		proxyBaseURL := startProxy(Config{Connector: ConnectorNIXLV2})
+
+		post(proxyBaseURL+AudioTranscriptionsPath, multipartType, transcription.String())
+		post(proxyBaseURL+AudioSpeechPath, "application/json", `{"model": "tts", "input": "Hello"}`)
+
+		Expect(decodeHandler.RequestCount.Load()).To(BeNumerically("==", 2))
+		Expect(audioHandler.RequestCount.Load()).To(BeNumerically("==", 0))
+	})
+
+	It("should route audio requests to the engine serving the model", func() {
+		proxyBaseURL := startProxy(Config{
+			Connector: ConnectorNIXLV2,
+			AudioModelRoutes: map[string]string{
+				"openai/whisper-large-v3": audioHostPort,
+				"tts":                     audioHostPort,
+			},
+		})
+
+		post(proxyBaseURL+AudioTranscriptionsPath, multipartType, transcription.String())
+		post(proxyBaseURL+AudioSpeechPath, "application/json", `{"model": "tts", "input": "Hello"}`)
+		Expect(audioHandler.RequestCount.Load()).To(BeNumerically("==", 2))
+		Expect(decodeHandler.RequestCount.Load()).To(BeNumerically("==", 0))
+
+		By("sending the models without route to the decoder")
+		post(proxyBaseURL+AudioSpeechPath, "application/json", `{"model": "other-tts", "input": "Hello"}`)
+		Expect(decodeHandler.RequestCount.Load()).To(BeNumerically("==", 1))
+	})
+
+	It("should reject invalid audio routes", func() {
+		_, err := NewProxy("0", decodeURL, Config{AudioModelRoutes: map[string]string{"tts": "http://[::1"}})
+		Expect(err).To(HaveOccurred())
+	})
+})
@@ -0,0 +1,76 @@
+/*
+Copyright 2025 The llm-d Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package proxy
+
+import (
+	"net"
+	"net/http"
+
+	"github.com/spiffe/go-spiffe/v2/svid/x509svid"
+
+	"github.com/llm-d/llm-d-routing-sidecar/internal/audit"
+)
+
+const (
+	auditEventSSRF = "ssrf"
+	auditAllow     = "allow"
+	auditDeny      = "deny"
+)
+
+// auditSSRF writes the SSRF protection decision on a prefill target to the audit log.
+// Allowed targets are only audited with SSRFAuditAllowed.
+func (s *Server) auditSSRF(r *http.Request, target string, allowed bool) {
+	if s.config.SSRFAuditLog == nil || !s.allowlistValidator.enabled || (allowed && !s.config.SSRFAuditAllowed) {
+		return
+	}
+
+	decision := auditDeny
+	if allowed {
+		decision = auditAllow
+	}
+	clientIP, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		clientIP = r.RemoteAddr
+	}
+	err = s.config.SSRFAuditLog.Write(audit.Record{
+		Event:        auditEventSSRF,
+		Decision:     decision,
+		Target:       target,
+		ClientIP:     clientIP,
+		ForwardedFor: r.Header.Get("X-Forwarded-For"),
+		Identity:     peerIdentity(r),
+		Method:       r.Method,
+		Path:         r.URL.Path,
+		UserAgent:    r.Header.Get("User-Agent"),
+		Rank:         s.config.DataParallelRank,
+	})
+	if err != nil {
+		s.logger.Error(err, "failed to write the SSRF audit record", "target", target, "decision", decision)
+	}
+}
+
+// peerIdentity returns the SPIFFE ID of the client authenticated with mTLS, if any
+func peerIdentity(r *http.Request) string {
+	if r.TLS == nil || len(r.TLS.PeerCertificates) == 0 {
+		return ""
+	}
+	id, err := x509svid.IDFromCert(r.TLS.PeerCertificates[0])
+	if err != nil {
+		return ""
+	}
+	return id.String()
+}
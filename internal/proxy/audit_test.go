@@ -0,0 +1,121 @@
+/*
+Copyright 2025 The llm-d Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package proxy
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+
+	"github.com/llm-d/llm-d-routing-sidecar/internal/audit"
+	"github.com/llm-d/llm-d-routing-sidecar/test/mock"
+	. "github.com/onsi/ginkgo/v2" // nolint:revive
+	. "github.com/onsi/gomega"    // nolint:revive
+	"k8s.io/utils/set"
+)
+
+var _ = Describe("SSRF audit", func() {
+	var (
+		decodeURL   *url.URL
+		prefillHost string
+		auditLog    *bytes.Buffer
+	)
+
+	BeforeEach(func() {
+		decodeBackend := httptest.NewServer(&mock.ChatCompletionHandler{Connector: ConnectorNIXLV2, Role: mock.RoleDecode})
+		DeferCleanup(decodeBackend.Close)
+		prefillBackend := httptest.NewServer(&mock.ChatCompletionHandler{Connector: ConnectorNIXLV2, Role: mock.RolePrefill})
+		DeferCleanup(prefillBackend.Close)
+		prefillHost = prefillBackend.URL[len("http://"):]
+
+		var err error
+		decodeURL, err = url.Parse(decodeBackend.URL)
+		Expect(err).ToNot(HaveOccurred())
+		auditLog = &bytes.Buffer{}
+	})
+
+	newServer := func(auditAllowed bool) *Server {
+		server, err := NewProxy("0", decodeURL, Config{
+			Connector:        ConnectorNIXLV2,
+			SSRFAuditLog:     audit.New(auditLog),
+			SSRFAuditAllowed: auditAllowed,
+		})
+		Expect(err).ToNot(HaveOccurred())
+		server.allowlistValidator = &AllowlistValidator{enabled: true, allowedTargets: set.New("127.0.0.1")}
+		return server
+	}
+
+	sendRequest := func(server *Server, prefiller string) int {
+		body := `{"model": "llama", "prompt": "Hello", "max_tokens": 10}`
+		req := httptest.NewRequest(http.MethodPost, CompletionsPath, strings.NewReader(body))
+		req.Header.Set(requestHeaderPrefillHostPort, prefiller)
+		req.Header.Set("X-Forwarded-For", "203.0.113.7")
+		req.Header.Set("User-Agent", "gateway")
+		rw := httptest.NewRecorder()
+		server.chatCompletionsHandler(rw, req)
+		return rw.Code
+	}
+
+	records := func() []audit.Record {
+		var records []audit.Record
+		decoder := json.NewDecoder(auditLog)
+		for decoder.More() {
+			var record audit.Record
+			Expect(decoder.Decode(&record)).To(Succeed())
+			records = append(records, record)
+		}
+		return records
+	}
+
+	It("should audit the denied prefill targets", func() {
+		server := newServer(false)
+		Expect(sendRequest(server, "10.1.2.3:8000")).To(Equal(http.StatusForbidden))
+		Expect(sendRequest(server, prefillHost)).To(Equal(http.StatusOK))
+
+		Expect(records()).To(ConsistOf(And(
+			HaveField("Event", "ssrf"),
+			HaveField("Decision", "deny"),
+			HaveField("Target", "10.1.2.3:8000"),
+			HaveField("ClientIP", "192.0.2.1"),
+			HaveField("ForwardedFor", "203.0.113.7"),
+			HaveField("Method", http.MethodPost),
+			HaveField("Path", CompletionsPath),
+			HaveField("UserAgent", "gateway"),
+			HaveField("Identity", ""),
+		)))
+	})
+
+	It("should audit the allowed prefill targets when enabled", func() {
+		server := newServer(true)
+		Expect(sendRequest(server, prefillHost)).To(Equal(http.StatusOK))
+
+		Expect(records()).To(ConsistOf(And(
+			HaveField("Decision", "allow"),
+			HaveField("Target", prefillHost),
+		)))
+	})
+
+	It("should not audit without SSRF protection", func() {
+		server := newServer(true)
+		server.allowlistValidator = &AllowlistValidator{}
+		Expect(sendRequest(server, prefillHost)).To(Equal(http.StatusOK))
+		Expect(records()).To(BeEmpty())
+	})
+})
@@ -0,0 +1,387 @@
+/*
+Copyright 2025 The llm-d Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package proxy
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/llm-d/llm-d-routing-sidecar/internal/metrics"
+)
+
+var (
+	// FilesPath is the OpenAI files path
+	FilesPath = "/v1/files"
+
+	// BatchesPath is the OpenAI batches path
+	BatchesPath = "/v1/batches"
+)
+
+const (
+	batchStatusInProgress = "in_progress"
+	batchStatusCompleted  = "completed"
+	batchStatusFailed     = "failed"
+
+	filePurposeBatch       = "batch"
+	filePurposeBatchOutput = "batch_output"
+
+	maxBatchFileBytes = 100 << 20
+)
+
+// BatchFile is an OpenAI file object
+type BatchFile struct {
+	ID        string `json:"id"`
+	Object    string `json:"object"`
+	Bytes     int    `json:"bytes"`
+	CreatedAt int64  `json:"created_at"`
+	Filename  string `json:"filename"`
+	Purpose   string `json:"purpose"`
+
+	content  []byte
+	storedAt time.Time
+}
+
+// BatchRequestCounts counts the requests of a batch by outcome
+type BatchRequestCounts struct {
+	Total     int `json:"total"`
+	Completed int `json:"completed"`
+	Failed    int `json:"failed"`
+}
+
+// Batch is an OpenAI batch object
+type Batch struct {
+	ID               string             `json:"id"`
+	Object           string             `json:"object"`
+	Endpoint         string             `json:"endpoint"`
+	InputFileID      string             `json:"input_file_id"`
+	CompletionWindow string             `json:"completion_window"`
+	Status           string             `json:"status"`
+	OutputFileID     string             `json:"output_file_id,omitempty"`
+	CreatedAt        int64              `json:"created_at"`
+	InProgressAt     int64              `json:"in_progress_at,omitempty"`
+	CompletedAt      int64              `json:"completed_at,omitempty"`
+	FailedAt         int64              `json:"failed_at,omitempty"`
+	RequestCounts    BatchRequestCounts `json:"request_counts"`
+	Metadata         map[string]string  `json:"metadata,omitempty"`
+
+	finishedAt time.Time // when the batch completed or failed, zero while in progress
+}
+
+// batchItem is a line of a batch input file
+type batchItem struct {
+	CustomID string          `json:"custom_id"`
+	Method   string          `json:"method"`
+	URL      string          `json:"url"`
+	Body     json.RawMessage `json:"body"`
+}
+
+// batchItemResult is a line of a batch output file
+type batchItemResult struct {
+	ID       string             `json:"id"`
+	CustomID string             `json:"custom_id"`
+	Response *batchItemResponse `json:"response"`
+	Error    *batchItemError    `json:"error"`
+}
+
+type batchItemResponse struct {
+	StatusCode int             `json:"status_code"`
+	RequestID  string          `json:"request_id"`
+	Body       json.RawMessage `json:"body"`
+}
+
+type batchItemError struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+func (s *Server) createBatchRoutes(mux *methodRoutes) {
+	mux.HandleFunc("POST "+FilesPath, s.createFileHandler)
+	mux.HandleFunc("GET "+FilesPath+"/{id}", s.getFileHandler)
+	mux.HandleFunc("DELETE "+FilesPath+"/{id}", s.deleteFileHandler)
+	mux.HandleFunc("GET "+FilesPath+"/{id}/content", s.getFileContentHandler)
+	mux.HandleFunc("POST "+BatchesPath, s.createBatchHandler)
+	mux.HandleFunc("GET "+BatchesPath+"/{id}", s.getBatchHandler)
+}
+
+func (s *Server) createFileHandler(w http.ResponseWriter, r *http.Request) {
+	r.Body = http.MaxBytesReader(w, r.Body, maxBatchFileBytes)
+	file, header, err := r.FormFile("file")
+	if err != nil {
+		s.sendBatchError(w, http.StatusBadRequest, fmt.Sprintf("missing file: %v", err))
+		return
+	}
+	defer file.Close() //nolint:all
+
+	purpose := r.FormValue("purpose")
+	if purpose != filePurposeBatch {
+		s.sendBatchError(w, http.StatusBadRequest, "'purpose' must be 'batch'")
+		return
+	}
+
+	content, err := io.ReadAll(file)
+	if err != nil {
+		s.sendBatchError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	f, err := s.batches.addFile(header.Filename, purpose, content)
+	if err != nil {
+		s.sendBatchError(w, http.StatusTooManyRequests, "the batch store is full, delete files or retry later")
+		return
+	}
+	s.sendBatchJSON(w, http.StatusOK, f)
+}
+
+func (s *Server) getFileHandler(w http.ResponseWriter, r *http.Request) {
+	f, ok := s.batches.file(r.PathValue("id"))
+	if !ok {
+		s.sendBatchError(w, http.StatusNotFound, "file not found")
+		return
+	}
+	s.sendBatchJSON(w, http.StatusOK, f)
+}
+
+func (s *Server) deleteFileHandler(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	if !s.batches.removeFile(id) {
+		s.sendBatchError(w, http.StatusNotFound, "file not found")
+		return
+	}
+	s.sendBatchJSON(w, http.StatusOK, map[string]any{"id": id, "object": "file", "deleted": true})
+}
+
+func (s *Server) getFileContentHandler(w http.ResponseWriter, r *http.Request) {
+	f, ok := s.batches.file(r.PathValue("id"))
+	if !ok {
+		s.sendBatchError(w, http.StatusNotFound, "file not found")
+		return
+	}
+	w.Header().Set("Content-Type", "application/jsonl")
+	if _, err := w.Write(f.content); err != nil {
+		s.logger.Error(err, "failed to send file content to client")
+	}
+}
+
+func (s *Server) createBatchHandler(w http.ResponseWriter, r *http.Request) {
+	var request struct {
+		InputFileID      string            `json:"input_file_id"`
+		Endpoint         string            `json:"endpoint"`
+		CompletionWindow string            `json:"completion_window"`
+		Metadata         map[string]string `json:"metadata"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		s.sendBatchError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	input, ok := s.batches.file(request.InputFileID)
+	if !ok {
+		s.sendBatchError(w, http.StatusBadRequest, "input file not found")
+		return
+	}
+	if !batchEndpoint(request.Endpoint) {
+		s.sendBatchError(w, http.StatusBadRequest, "'endpoint' must be "+ChatCompletionsPath+" or "+CompletionsPath)
+		return
+	}
+
+	batch := &Batch{
+		ID:               "batch_" + uuid.NewString(),
+		Object:           "batch",
+		Endpoint:         request.Endpoint,
+		InputFileID:      request.InputFileID,
+		CompletionWindow: request.CompletionWindow,
+		Status:           batchStatusInProgress,
+		CreatedAt:        time.Now().Unix(),
+		InProgressAt:     time.Now().Unix(),
+		Metadata:         request.Metadata,
+	}
+	// The P/D routing headers of the batch creation request apply to every item
+	header := r.Header.Clone()
+	if err := s.batches.addBatch(batch); err != nil {
+		s.sendBatchError(w, http.StatusTooManyRequests, "the batch store is full, retry later")
+		return
+	}
+	if !s.dispatchBatch(func() { s.runBatch(batch.ID, batch.Endpoint, input.content, header) }) {
+		s.batches.removeBatch(batch.ID)
+		s.sendBatchError(w, http.StatusTooManyRequests, "too many batches queued, retry later")
+		return
+	}
+
+	snapshot, _ := s.batches.batchSnapshot(batch.ID)
+	s.sendBatchJSON(w, http.StatusOK, snapshot)
+}
+
+func (s *Server) getBatchHandler(w http.ResponseWriter, r *http.Request) {
+	batch, ok := s.batches.batchSnapshot(r.PathValue("id"))
+	if !ok {
+		s.sendBatchError(w, http.StatusNotFound, "batch not found")
+		return
+	}
+	s.sendBatchJSON(w, http.StatusOK, batch)
+}
+
+// batchEndpoint returns whether the items of a batch can be sent to an endpoint, the
+// completion endpoints run through the P/D protocol
+func batchEndpoint(path string) bool {
+	return path == ChatCompletionsPath || path == CompletionsPath
+}
+
+// runBatch runs the items of a batch one at a time, through the P/D protocol of the batch
+// endpoint, and stores their responses in the output file
+func (s *Server) runBatch(batchID string, endpoint string, input []byte, header http.Header) {
+	logger := s.logger.WithValues("batch", batchID)
+	logger.Info("running batch")
+
+	items := []batchItem{}
+	scanner := bufio.NewScanner(bytes.NewReader(input))
+	scanner.Buffer(make([]byte, 0, 64*1024), maxBatchFileBytes)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		var item batchItem
+		if err := json.Unmarshal([]byte(line), &item); err != nil {
+			logger.Error(err, "invalid batch input line")
+			s.batches.updateBatch(batchID, func(b *Batch) {
+				b.Status = batchStatusFailed
+				b.FailedAt = time.Now().Unix()
+			})
+			return
+		}
+		items = append(items, item)
+	}
+	s.batches.updateBatch(batchID, func(b *Batch) { b.RequestCounts.Total = len(items) })
+
+	var output bytes.Buffer
+	for _, item := range items {
+		result := s.runBatchItem(item, endpoint, header)
+		b, err := json.Marshal(result)
+		if err != nil {
+			logger.Error(err, "failed to encode batch result", "customID", item.CustomID)
+			continue
+		}
+		output.Write(b)
+		output.WriteByte('\n')
+
+		s.batches.updateBatch(batchID, func(b *Batch) {
+			if result.Error == nil && result.Response.StatusCode < 300 {
+				b.RequestCounts.Completed++
+			} else {
+				b.RequestCounts.Failed++
+			}
+		})
+	}
+
+	outputFile, err := s.batches.addFile(batchID+"_output.jsonl", filePurposeBatchOutput, output.Bytes())
+	if err != nil {
+		logger.Error(err, "failed to store the batch output")
+		s.batches.updateBatch(batchID, func(b *Batch) {
+			b.Status = batchStatusFailed
+			b.FailedAt = time.Now().Unix()
+		})
+		return
+	}
+	s.batches.updateBatch(batchID, func(b *Batch) {
+		b.Status = batchStatusCompleted
+		b.OutputFileID = outputFile.ID
+		b.CompletedAt = time.Now().Unix()
+	})
+	logger.Info("batch completed")
+}
+
+// runBatchItem sends a batch item through the proxy routes, so it is authenticated, gated,
+// admitted and routed like the requests of the clients
+func (s *Server) runBatchItem(item batchItem, endpoint string, header http.Header) *batchItemResult {
+	result := &batchItemResult{
+		ID:       "batch_req_" + uuid.NewString(),
+		CustomID: item.CustomID,
+	}
+	if item.URL != endpoint {
+		metrics.RecordBatchItemFailure(s.rank(), batchFailureError)
+		result.Error = &batchItemError{Code: "invalid_url", Message: fmt.Sprintf("the url %q is not the endpoint of the batch, %s", item.URL, endpoint)}
+		return result
+	}
+
+	method := item.Method
+	if method == "" {
+		method = http.MethodPost
+	}
+	ctx := context.Background()
+	if s.config.BatchItemTimeout > 0 {
+		var cancelFn context.CancelFunc
+		ctx, cancelFn = context.WithTimeout(ctx, s.config.BatchItemTimeout)
+		defer cancelFn()
+	}
+	req, err := http.NewRequestWithContext(ctx, method, item.URL, bytes.NewReader(item.Body))
+	if err != nil {
+		metrics.RecordBatchItemFailure(s.rank(), batchFailureError)
+		result.Error = &batchItemError{Code: "invalid_request", Message: err.Error()}
+		return result
+	}
+	req.Header = header.Clone()
+	req.Header.Set("Content-Type", "application/json")
+	req.ContentLength = int64(len(item.Body))
+
+	rw := &bufferedResponseWriter{}
+	s.routed.ServeHTTP(rw, req)
+
+	body := json.RawMessage(rw.buffer.String())
+	if !json.Valid(body) {
+		body, _ = json.Marshal(rw.buffer.String()) //nolint:all
+	}
+	result.Response = &batchItemResponse{
+		StatusCode: rw.statusCode,
+		RequestID:  rw.Header().Get(requestHeaderRequestID),
+		Body:       body,
+	}
+	switch {
+	case errors.Is(ctx.Err(), context.DeadlineExceeded):
+		metrics.RecordBatchItemFailure(s.rank(), batchFailureTimeout)
+	case rw.statusCode >= http.StatusMultipleChoices:
+		metrics.RecordBatchItemFailure(s.rank(), batchFailureError)
+	}
+	return result
+}
+
+func (s *Server) sendBatchJSON(w http.ResponseWriter, statusCode int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		s.logger.Error(err, "failed to send response to client")
+	}
+}
+
+func (s *Server) sendBatchError(w http.ResponseWriter, statusCode int, message string) {
+	s.sendBatchJSON(w, statusCode, errorResponse{
+		Object:    "error",
+		Message:   message,
+		Type:      http.StatusText(statusCode),
+		RequestID: w.Header().Get(responseHeaderRequestID),
+		Code:      statusCode,
+	})
+}
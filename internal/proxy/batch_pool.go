@@ -0,0 +1,88 @@
+/*
+Copyright 2025 The llm-d Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package proxy
+
+import (
+	"sync/atomic"
+
+	"github.com/llm-d/llm-d-routing-sidecar/internal/metrics"
+)
+
+const (
+	batchStateQueued = "queued"
+	batchStateActive = "active"
+
+	batchFailureTimeout = "timeout"
+	batchFailureError   = "error"
+)
+
+// batchPool bounds the batches running at once and waiting to run, so the batch creations
+// cannot leak goroutines and upstream connections under load
+type batchPool struct {
+	rank    string
+	slots   chan struct{} // running batches
+	limit   int64         // running and waiting batches, no limit when zero
+	pending atomic.Int64
+}
+
+// newBatchPool returns a pool running concurrency batches at once, with queueSize others
+// waiting at most (no limit when zero), or nil when concurrency is zero
+func newBatchPool(rank string, concurrency int, queueSize int) *batchPool {
+	if concurrency <= 0 {
+		return nil
+	}
+	p := &batchPool{rank: rank, slots: make(chan struct{}, concurrency)}
+	if queueSize > 0 {
+		p.limit = int64(concurrency + queueSize)
+	}
+	return p
+}
+
+// submit runs a batch once a slot is free, reporting false when the queue is full
+func (p *batchPool) submit(run func()) bool {
+	if pending := p.pending.Add(1); p.limit > 0 && pending > p.limit {
+		p.pending.Add(-1)
+		return false
+	}
+	metrics.AddBatches(p.rank, batchStateQueued, 1)
+	go func() {
+		p.slots <- struct{}{}
+		metrics.AddBatches(p.rank, batchStateQueued, -1)
+		metrics.AddBatches(p.rank, batchStateActive, 1)
+		defer func() {
+			metrics.AddBatches(p.rank, batchStateActive, -1)
+			<-p.slots
+			p.pending.Add(-1)
+		}()
+		run()
+	}()
+	return true
+}
+
+// dispatchBatch runs a batch in the background, on the batch pool if any, reporting false
+// when the pool is full
+func (s *Server) dispatchBatch(run func()) bool {
+	if s.batchPool == nil {
+		metrics.AddBatches(s.rank(), batchStateActive, 1)
+		go func() {
+			defer metrics.AddBatches(s.rank(), batchStateActive, -1)
+			run()
+		}()
+		return true
+	}
+	return s.batchPool.submit(run)
+}
@@ -0,0 +1,213 @@
+/*
+Copyright 2025 The llm-d Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package proxy
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// errBatchStoreFull is returned when a file or a batch does not fit in the batch store, even
+// after evicting the finished batches
+var errBatchStoreFull = errors.New("the batch store is full")
+
+// batchStore keeps the batch files and batches in memory. They are lost when the sidecar restarts.
+// The store is bounded by its number of files and batches and the size of its files: the oldest
+// finished batches are evicted with their files to make room, and the files and finished batches
+// expire after the retention.
+type batchStore struct {
+	maxFiles   int           // the files kept at most, zero for no limit
+	maxBatches int           // the batches kept at most, zero for no limit
+	maxBytes   int64         // the size of the files kept at most, zero for no limit
+	retention  time.Duration // how long the files and finished batches are kept, zero for no expiry
+
+	mu      sync.Mutex
+	files   map[string]*BatchFile
+	batches map[string]*Batch
+	bytes   int64 // the size of the files
+}
+
+func newBatchStore(config Config) *batchStore {
+	return &batchStore{
+		maxFiles:   config.BatchStoreMaxFiles,
+		maxBatches: config.BatchStoreMaxBatches,
+		maxBytes:   config.BatchStoreMaxBytes,
+		retention:  config.BatchRetention,
+		files:      make(map[string]*BatchFile),
+		batches:    make(map[string]*Batch),
+	}
+}
+
+func (b *batchStore) addFile(filename string, purpose string, content []byte) (*BatchFile, error) {
+	now := time.Now()
+	f := &BatchFile{
+		ID:        "file-" + uuid.NewString(),
+		Object:    "file",
+		Bytes:     len(content),
+		CreatedAt: now.Unix(),
+		Filename:  filename,
+		Purpose:   purpose,
+		content:   content,
+		storedAt:  now,
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.expire(now)
+	if !b.makeRoom(1, 0, int64(len(content))) {
+		return nil, errBatchStoreFull
+	}
+	b.files[f.ID] = f
+	b.bytes += int64(len(content))
+	return f, nil
+}
+
+func (b *batchStore) file(id string) (*BatchFile, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.expire(time.Now())
+	f, ok := b.files[id]
+	return f, ok
+}
+
+// removeFile deletes a file, returning false when not found
+func (b *batchStore) removeFile(id string) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.expire(time.Now())
+	return b.deleteFile(id)
+}
+
+func (b *batchStore) addBatch(batch *Batch) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.expire(time.Now())
+	if !b.makeRoom(0, 1, 0) {
+		return errBatchStoreFull
+	}
+	b.batches[batch.ID] = batch
+	return nil
+}
+
+func (b *batchStore) removeBatch(id string) {
+	b.mu.Lock()
+	delete(b.batches, id)
+	b.mu.Unlock()
+}
+
+// batchSnapshot returns a copy of a batch, safe to encode while the batch runs
+func (b *batchStore) batchSnapshot(id string) (Batch, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.expire(time.Now())
+	batch, ok := b.batches[id]
+	if !ok {
+		return Batch{}, false
+	}
+	return *batch, true
+}
+
+// updateBatch updates a batch, recording when it finished for its eviction
+func (b *batchStore) updateBatch(id string, update func(*Batch)) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	batch, ok := b.batches[id]
+	if !ok {
+		return
+	}
+	update(batch)
+	if batch.Status != batchStatusInProgress && batch.finishedAt.IsZero() {
+		batch.finishedAt = time.Now()
+	}
+}
+
+// makeRoom evicts the oldest finished batches until the files, batches and bytes fit in the
+// store, returning false when they do not fit. The lock must be held.
+func (b *batchStore) makeRoom(files int, batches int, bytes int64) bool {
+	if b.maxBytes > 0 && bytes > b.maxBytes {
+		return false
+	}
+	for (b.maxFiles > 0 && len(b.files)+files > b.maxFiles) ||
+		(b.maxBatches > 0 && len(b.batches)+batches > b.maxBatches) ||
+		(b.maxBytes > 0 && b.bytes+bytes > b.maxBytes) {
+		var oldest *Batch
+		for _, batch := range b.batches {
+			if !batch.finishedAt.IsZero() && (oldest == nil || batch.finishedAt.Before(oldest.finishedAt)) {
+				oldest = batch
+			}
+		}
+		if oldest == nil {
+			return false
+		}
+		b.evictBatch(oldest)
+	}
+	return true
+}
+
+// expire evicts the finished batches and the files older than the retention, except the
+// input files of the batches in progress. The lock must be held.
+func (b *batchStore) expire(now time.Time) {
+	if b.retention == 0 {
+		return
+	}
+	deadline := now.Add(-b.retention)
+	for _, batch := range b.batches {
+		if !batch.finishedAt.IsZero() && batch.finishedAt.Before(deadline) {
+			b.evictBatch(batch)
+		}
+	}
+	for id, f := range b.files {
+		if f.storedAt.Before(deadline) && !b.fileInput(id, true) {
+			b.deleteFile(id)
+		}
+	}
+}
+
+// evictBatch deletes a batch, its output file, and its input file unless another batch reads
+// it. The lock must be held.
+func (b *batchStore) evictBatch(batch *Batch) {
+	delete(b.batches, batch.ID)
+	b.deleteFile(batch.OutputFileID)
+	if !b.fileInput(batch.InputFileID, false) {
+		b.deleteFile(batch.InputFileID)
+	}
+}
+
+// fileInput returns whether a file is the input of a batch, only of the batches in progress
+// when running is true. The lock must be held.
+func (b *batchStore) fileInput(id string, running bool) bool {
+	for _, batch := range b.batches {
+		if batch.InputFileID == id && (!running || batch.finishedAt.IsZero()) {
+			return true
+		}
+	}
+	return false
+}
+
+// deleteFile deletes a file, returning false when not found. The lock must be held.
+func (b *batchStore) deleteFile(id string) bool {
+	f, ok := b.files[id]
+	if !ok {
+		return false
+	}
+	delete(b.files, id)
+	b.bytes -= int64(len(f.content))
+	return true
+}
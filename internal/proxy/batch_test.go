@@ -0,0 +1,396 @@
+/*
+Copyright 2025 The llm-d Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package proxy
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/llm-d/llm-d-routing-sidecar/internal/metrics"
+	"github.com/llm-d/llm-d-routing-sidecar/test/mock"
+	. "github.com/onsi/ginkgo/v2" // nolint:revive
+	. "github.com/onsi/gomega"    // nolint:revive
+	"k8s.io/klog/v2/ktesting"
+)
+
+var _ = Describe("Batch API", func() {
+	It("should run each batch item through the P/D protocol", func() {
+		_, ctx := ktesting.NewTestContext(GinkgoT())
+		ctx, cancelFn := context.WithCancel(ctx)
+		defer cancelFn()
+
+		decodeHandler := &mock.ChatCompletionHandler{Connector: ConnectorNIXLV2, Role: mock.RoleDecode}
+		decodeBackend := httptest.NewServer(decodeHandler)
+		DeferCleanup(decodeBackend.Close)
+
+		prefillHandler := &mock.ChatCompletionHandler{Connector: ConnectorNIXLV2, Role: mock.RolePrefill}
+		prefillBackend := httptest.NewServer(prefillHandler)
+		DeferCleanup(prefillBackend.Close)
+
+		decodeURL, err := url.Parse(decodeBackend.URL)
+		Expect(err).ToNot(HaveOccurred())
+		proxy, err := NewProxy("0", decodeURL, Config{Connector: ConnectorNIXLV2, EnableBatchAPI: true})
+		Expect(err).ToNot(HaveOccurred())
+
+		go func() {
+			defer GinkgoRecover()
+			Expect(proxy.Start(ctx)).To(Succeed())
+		}()
+		time.Sleep(1 * time.Second)
+		Expect(proxy.Addr()).ToNot(BeNil())
+		proxyURL := "http://" + proxy.Addr().String()
+
+		// 1. Upload the input file
+		input := `{"custom_id": "a", "method": "POST", "url": "/v1/chat/completions", "body": {"model": "food-review", "messages": [{"role": "user", "content": "hello"}]}}
+{"custom_id": "b", "method": "GET", "url": "/v1/chat/completions", "body": {"model": "food-review", "messages": [{"role": "user", "content": "hello"}]}}
+{"custom_id": "c", "method": "POST", "url": "/v1/completions", "body": {"model": "food-review", "prompt": "hello"}}
+{"custom_id": "d", "method": "POST", "url": "/metrics", "body": {}}
+`
+		var form bytes.Buffer
+		mw := multipart.NewWriter(&form)
+		Expect(mw.WriteField("purpose", "batch")).To(Succeed())
+		fw, err := mw.CreateFormFile("file", "input.jsonl")
+		Expect(err).ToNot(HaveOccurred())
+		_, err = fw.Write([]byte(input))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(mw.Close()).To(Succeed())
+
+		resp, err := http.Post(proxyURL+FilesPath, mw.FormDataContentType(), &form)
+		Expect(err).ToNot(HaveOccurred())
+		var file BatchFile
+		Expect(json.NewDecoder(resp.Body).Decode(&file)).To(Succeed())
+		resp.Body.Close() //nolint:all
+		Expect(resp.StatusCode).To(Equal(http.StatusOK))
+		Expect(file.Bytes).To(Equal(len(input)))
+
+		// 2. Create the batch, routed to the prefiller
+		body := `{"input_file_id": "` + file.ID + `", "endpoint": "/v1/chat/completions", "completion_window": "24h"}`
+		req, err := http.NewRequest(http.MethodPost, proxyURL+BatchesPath, strings.NewReader(body))
+		Expect(err).ToNot(HaveOccurred())
+		req.Header.Add(requestHeaderPrefillHostPort, prefillBackend.URL[len("http://"):])
+		resp, err = http.DefaultClient.Do(req)
+		Expect(err).ToNot(HaveOccurred())
+		var batch Batch
+		Expect(json.NewDecoder(resp.Body).Decode(&batch)).To(Succeed())
+		resp.Body.Close() //nolint:all
+		Expect(resp.StatusCode).To(Equal(http.StatusOK))
+
+		// 3. Wait for completion
+		Eventually(func() string {
+			resp, err := http.Get(proxyURL + BatchesPath + "/" + batch.ID)
+			Expect(err).ToNot(HaveOccurred())
+			defer resp.Body.Close() //nolint:all
+			Expect(json.NewDecoder(resp.Body).Decode(&batch)).To(Succeed())
+			return batch.Status
+		}, 5*time.Second, 100*time.Millisecond).Should(Equal(batchStatusCompleted))
+
+		Expect(batch.RequestCounts).To(Equal(BatchRequestCounts{Total: 4, Completed: 1, Failed: 3}))
+		Expect(prefillHandler.RequestCount.Load()).To(BeNumerically("==", 1))
+		Expect(decodeHandler.RequestCount.Load()).To(BeNumerically("==", 1))
+
+		// 4. Read the results
+		resp, err = http.Get(proxyURL + FilesPath + "/" + batch.OutputFileID + "/content")
+		Expect(err).ToNot(HaveOccurred())
+		output, err := io.ReadAll(resp.Body)
+		Expect(err).ToNot(HaveOccurred())
+		resp.Body.Close() //nolint:all
+
+		lines := strings.Split(strings.TrimSpace(string(output)), "\n")
+		Expect(lines).To(HaveLen(4))
+		results := make([]batchItemResult, len(lines))
+		for i, line := range lines {
+			Expect(json.Unmarshal([]byte(line), &results[i])).To(Succeed())
+		}
+		Expect(results[0].CustomID).To(Equal("a"))
+		Expect(results[0].Response.StatusCode).To(Equal(http.StatusOK))
+		// the items go through the method gating of the routes
+		Expect(results[1].CustomID).To(Equal("b"))
+		Expect(results[1].Response.StatusCode).To(Equal(http.StatusMethodNotAllowed))
+		// the items of another endpoint are rejected
+		for _, result := range results[2:] {
+			Expect(result.Response).To(BeNil())
+			Expect(result.Error.Code).To(Equal("invalid_url"))
+		}
+	})
+
+	DescribeTable("should only accept the completion endpoints",
+		func(endpoint string, expected int) {
+			decodeURL, err := url.Parse("http://localhost:8000")
+			Expect(err).ToNot(HaveOccurred())
+			proxy, err := NewProxy("0", decodeURL, Config{Connector: ConnectorNIXLV2, EnableBatchAPI: true, BatchMaxConcurrency: 1})
+			Expect(err).ToNot(HaveOccurred())
+			handler := proxy.routes()
+			file, err := proxy.batches.addFile("input.jsonl", filePurposeBatch, nil)
+			Expect(err).ToNot(HaveOccurred())
+
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, BatchesPath,
+				strings.NewReader(`{"input_file_id": "`+file.ID+`", "endpoint": "`+endpoint+`"}`)))
+			Expect(rec.Code).To(Equal(expected))
+		},
+		Entry("chat completions", ChatCompletionsPath, http.StatusOK),
+		Entry("completions", CompletionsPath, http.StatusOK),
+		Entry("embeddings", "/v1/embeddings", http.StatusBadRequest),
+		Entry("passthrough", "/metrics", http.StatusBadRequest),
+		Entry("missing", "", http.StatusBadRequest),
+	)
+
+	It("should pass batch requests to the decoder when disabled", func() {
+		_, ctx := ktesting.NewTestContext(GinkgoT())
+		ctx, cancelFn := context.WithCancel(ctx)
+		defer cancelFn()
+
+		decodeHandler := &mock.GenericHandler{}
+		decodeBackend := httptest.NewServer(decodeHandler)
+		DeferCleanup(decodeBackend.Close)
+
+		decodeURL, err := url.Parse(decodeBackend.URL)
+		Expect(err).ToNot(HaveOccurred())
+		proxy, err := NewProxy("0", decodeURL, Config{Connector: ConnectorNIXLV2})
+		Expect(err).ToNot(HaveOccurred())
+
+		go func() {
+			defer GinkgoRecover()
+			Expect(proxy.Start(ctx)).To(Succeed())
+		}()
+		time.Sleep(1 * time.Second)
+		Expect(proxy.Addr()).ToNot(BeNil())
+
+		resp, err := http.Post("http://"+proxy.Addr().String()+BatchesPath, "application/json", strings.NewReader(`{}`))
+		Expect(err).ToNot(HaveOccurred())
+		resp.Body.Close() //nolint:all
+		Expect(resp.StatusCode).To(Equal(http.StatusOK))
+		Expect(decodeHandler.RequestCount.Load()).To(BeNumerically("==", 1))
+	})
+})
+
+var _ = Describe("Batch pool", func() {
+	const rank = 51
+
+	batchMetric := func(name string, label string, value string) float64 {
+		families, err := metrics.Registry.Gather()
+		Expect(err).ToNot(HaveOccurred())
+		for _, family := range families {
+			if family.GetName() != name {
+				continue
+			}
+			for _, metric := range family.Metric {
+				labels := map[string]string{}
+				for _, l := range metric.Label {
+					labels[l.GetName()] = l.GetValue()
+				}
+				if labels[metrics.RankLabel] == fmt.Sprint(rank) && labels[label] == value {
+					return metric.GetGauge().GetValue() + metric.GetCounter().GetValue()
+				}
+			}
+		}
+		return 0
+	}
+
+	It("should bound the batches running and queued", func() {
+		pool := newBatchPool(fmt.Sprint(rank), 1, 1)
+		release := make(chan struct{})
+		var ran atomic.Int32
+		run := func() {
+			<-release
+			ran.Add(1)
+		}
+
+		Expect(pool.submit(run)).To(BeTrue())
+		Expect(pool.submit(run)).To(BeTrue())
+		Expect(pool.submit(run)).To(BeFalse())
+		Eventually(func() float64 { return batchMetric("llm_d_routing_sidecar_batches", "state", batchStateActive) }).Should(Equal(1.0))
+		Expect(batchMetric("llm_d_routing_sidecar_batches", "state", batchStateQueued)).To(Equal(1.0))
+
+		close(release)
+		Eventually(ran.Load).Should(BeNumerically("==", 2))
+		Eventually(pool.pending.Load).Should(BeZero())
+		Expect(batchMetric("llm_d_routing_sidecar_batches", "state", batchStateActive)).To(BeZero())
+		Expect(pool.submit(func() {})).To(BeTrue())
+	})
+
+	It("should not bound the batches without concurrency", func() {
+		Expect(newBatchPool(fmt.Sprint(rank), 0, 1)).To(BeNil())
+	})
+
+	It("should fail the batch items exceeding their deadline", func() {
+		_, ctx := ktesting.NewTestContext(GinkgoT())
+		ctx, cancelFn := context.WithCancel(ctx)
+		defer cancelFn()
+
+		decodeBackend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			io.Copy(io.Discard, r.Body) //nolint:all
+			<-r.Context().Done()
+		}))
+		DeferCleanup(decodeBackend.Close)
+
+		decodeURL, err := url.Parse(decodeBackend.URL)
+		Expect(err).ToNot(HaveOccurred())
+		proxy, err := NewProxy("0", decodeURL, Config{
+			Connector:           ConnectorNIXLV2,
+			EnableBatchAPI:      true,
+			DataParallelRank:    rank,
+			BatchMaxConcurrency: 1,
+			BatchItemTimeout:    200 * time.Millisecond,
+		})
+		Expect(err).ToNot(HaveOccurred())
+		go func() {
+			defer GinkgoRecover()
+			Expect(proxy.Start(ctx)).To(Succeed())
+		}()
+		Eventually(func() net.Addr { return proxy.Addr() }).ShouldNot(BeNil())
+		before := batchMetric("llm_d_routing_sidecar_batch_item_failures_total", "reason", batchFailureTimeout)
+
+		file, err := proxy.batches.addFile("input.jsonl", "batch", []byte(`{"custom_id": "a", "url": "/v1/completions", "body": {"model": "m", "prompt": "hello"}}`))
+		Expect(err).ToNot(HaveOccurred())
+		resp, err := http.Post("http://"+proxy.Addr().String()+BatchesPath, "application/json",
+			strings.NewReader(`{"input_file_id": "`+file.ID+`", "endpoint": "/v1/completions"}`))
+		Expect(err).ToNot(HaveOccurred())
+		var batch Batch
+		Expect(json.NewDecoder(resp.Body).Decode(&batch)).To(Succeed())
+		resp.Body.Close() //nolint:all
+
+		Eventually(func() string {
+			snapshot, _ := proxy.batches.batchSnapshot(batch.ID)
+			return snapshot.Status
+		}, 5*time.Second).Should(Equal(batchStatusCompleted))
+		snapshot, _ := proxy.batches.batchSnapshot(batch.ID)
+		Expect(snapshot.RequestCounts).To(Equal(BatchRequestCounts{Total: 1, Failed: 1}))
+		Expect(batchMetric("llm_d_routing_sidecar_batch_item_failures_total", "reason", batchFailureTimeout)).To(Equal(before + 1))
+	})
+})
+
+var _ = Describe("Batch store", func() {
+	finish := func(store *batchStore, batch *Batch, output *BatchFile) {
+		store.updateBatch(batch.ID, func(b *Batch) {
+			b.Status = batchStatusCompleted
+			b.OutputFileID = output.ID
+		})
+	}
+
+	newBatch := func(store *batchStore, input *BatchFile) *Batch {
+		batch := &Batch{ID: "batch_" + input.ID, InputFileID: input.ID, Status: batchStatusInProgress}
+		Expect(store.addBatch(batch)).To(Succeed())
+		return batch
+	}
+
+	addFile := func(store *batchStore, content string) *BatchFile {
+		f, err := store.addFile("input.jsonl", filePurposeBatch, []byte(content))
+		Expect(err).ToNot(HaveOccurred())
+		return f
+	}
+
+	It("should evict the oldest finished batch and its files to make room", func() {
+		store := newBatchStore(Config{BatchStoreMaxFiles: 4})
+		first, second := addFile(store, "a"), addFile(store, "b")
+		firstBatch, secondBatch := newBatch(store, first), newBatch(store, second)
+		finish(store, firstBatch, addFile(store, "first output"))
+		finish(store, secondBatch, addFile(store, "second output"))
+
+		addFile(store, "c")
+		_, ok := store.batchSnapshot(firstBatch.ID)
+		Expect(ok).To(BeFalse())
+		_, ok = store.file(first.ID)
+		Expect(ok).To(BeFalse())
+		_, ok = store.batchSnapshot(secondBatch.ID)
+		Expect(ok).To(BeTrue())
+		Expect(store.files).To(HaveLen(3))
+	})
+
+	It("should not evict the batches in progress", func() {
+		store := newBatchStore(Config{BatchStoreMaxBatches: 1})
+		input := addFile(store, "a")
+		newBatch(store, input)
+
+		Expect(store.addBatch(&Batch{ID: "batch_b", InputFileID: input.ID, Status: batchStatusInProgress})).To(MatchError(errBatchStoreFull))
+	})
+
+	It("should bound the size of the files", func() {
+		store := newBatchStore(Config{BatchStoreMaxBytes: 10})
+		input := addFile(store, "12345")
+		batch := newBatch(store, input)
+
+		_, err := store.addFile("large.jsonl", filePurposeBatch, []byte("12345678901"))
+		Expect(err).To(MatchError(errBatchStoreFull))
+		_, err = store.addFile("output.jsonl", filePurposeBatchOutput, []byte("123456"))
+		Expect(err).To(MatchError(errBatchStoreFull))
+
+		finish(store, batch, addFile(store, "12345"))
+		addFile(store, "123456")
+		Expect(store.bytes).To(BeNumerically("==", 6))
+		Expect(store.batches).To(BeEmpty())
+	})
+
+	It("should expire the files and finished batches after the retention", func() {
+		store := newBatchStore(Config{BatchRetention: time.Minute})
+		running, finished, unused := addFile(store, "a"), addFile(store, "b"), addFile(store, "c")
+		runningBatch, finishedBatch := newBatch(store, running), newBatch(store, finished)
+		output := addFile(store, "output")
+		finish(store, finishedBatch, output)
+
+		expired := time.Now().Add(-2 * time.Minute)
+		for _, f := range store.files {
+			f.storedAt = expired
+		}
+		finishedBatch.finishedAt = expired
+
+		_, ok := store.batchSnapshot(finishedBatch.ID)
+		Expect(ok).To(BeFalse())
+		for _, f := range []*BatchFile{finished, unused, output} {
+			_, ok = store.file(f.ID)
+			Expect(ok).To(BeFalse())
+		}
+		_, ok = store.batchSnapshot(runningBatch.ID)
+		Expect(ok).To(BeTrue())
+		_, ok = store.file(running.ID)
+		Expect(ok).To(BeTrue())
+		Expect(store.bytes).To(BeNumerically("==", 1))
+	})
+
+	It("should delete the files", func() {
+		decodeURL, err := url.Parse("http://localhost:8000")
+		Expect(err).ToNot(HaveOccurred())
+		proxy, err := NewProxy("0", decodeURL, Config{Connector: ConnectorNIXLV2, EnableBatchAPI: true})
+		Expect(err).ToNot(HaveOccurred())
+		handler := proxy.routes()
+		f := addFile(proxy.batches, "a")
+
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodDelete, FilesPath+"/"+f.ID, nil))
+		Expect(rec.Code).To(Equal(http.StatusOK))
+		Expect(rec.Body.String()).To(MatchJSON(`{"id": "` + f.ID + `", "object": "file", "deleted": true}`))
+		Expect(proxy.batches.bytes).To(BeZero())
+
+		rec = httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, FilesPath+"/"+f.ID, nil))
+		Expect(rec.Code).To(Equal(http.StatusNotFound))
+		rec = httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodDelete, FilesPath+"/"+f.ID, nil))
+		Expect(rec.Code).To(Equal(http.StatusNotFound))
+	})
+})
@@ -0,0 +1,232 @@
+/*
+Copyright 2025 The llm-d Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package proxy
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"runtime"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/go-logr/logr"
+)
+
+const (
+	// BenchPassthrough names the benchmark of the requests without prefiller header
+	BenchPassthrough = "passthrough"
+
+	benchPrefillerHostPort = "prefiller.bench:8000"
+	benchModel             = "bench/model"
+)
+
+// benchPrefillResponse is the response of the stub prefiller, with the KV transfer fields of
+// every connector
+var benchPrefillResponse = []byte(`{"id":"cmpl-bench","choices":[{"index":0,"text":"","finish_reason":"length"}],` +
+	`"kv_transfer_params":{"do_remote_decode":false,"do_remote_prefill":true,"remote_block_ids":[1,2,3,4],"remote_engine_id":"bench","remote_host":"10.0.0.1","remote_port":5600},` +
+	`"remote_block_ids":[1,2,3,4],"remote_engine_id":"bench","remote_host":"10.0.0.1","remote_port":5600}`)
+
+// benchDecodeResponse is the response of the stub decoder
+var benchDecodeResponse = []byte(`{"id":"cmpl-bench","choices":[{"index":0,"text":"Hello","finish_reason":"length"}],` +
+	`"usage":{"prompt_tokens":1024,"completion_tokens":1,"total_tokens":1025}}`)
+
+// BenchConfig configures a benchmark of the overhead of the sidecar
+type BenchConfig struct {
+	// Connectors are the benchmarked connectors, and BenchPassthrough for the requests without
+	// prefiller header
+	Connectors []string
+
+	// Requests is the number of measured requests per connector, after as many warmup requests
+	Requests int
+
+	// PromptBytes is the size of the prompt of the requests
+	PromptBytes int
+}
+
+// BenchResult is the overhead of the sidecar on the requests of a connector
+type BenchResult struct {
+	Connector string
+	Requests  int
+	Errors    int
+
+	Mean time.Duration
+	P50  time.Duration
+	P99  time.Duration
+
+	AllocsPerRequest uint64
+	BytesPerRequest  uint64
+}
+
+// Bench drives synthetic completion requests through the handlers of an in-process proxy per
+// connector, the prefiller and decoder being in-process stubs answering immediately, so the
+// latency and allocations measured are the overhead of the sidecar, mostly parsing and
+// rewriting the request bodies. The requests are sent one at a time, for stable measures.
+func Bench(ctx context.Context, config BenchConfig) ([]BenchResult, error) {
+	if config.Requests <= 0 {
+		return nil, fmt.Errorf("invalid number of requests %d", config.Requests)
+	}
+	body, err := json.Marshal(map[string]any{
+		"model":               benchModel,
+		"prompt":              strings.Repeat("x", config.PromptBytes),
+		requestFieldMaxTokens: 16,
+		requestFieldStream:    false,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]BenchResult, 0, len(config.Connectors))
+	for _, connector := range config.Connectors {
+		handler, err := newBenchHandler(connector)
+		if err != nil {
+			return nil, err
+		}
+		newBenchRequests(ctx, connector, body, config.Requests, handler) // warmup
+		results = append(results, runBench(connector, handler, newBenchRequests(ctx, connector, body, config.Requests, nil)))
+	}
+	return results, ctx.Err()
+}
+
+// newBenchHandler returns the handlers of a proxy of the given connector, with stub upstreams
+func newBenchHandler(connector string) (http.Handler, error) {
+	config := Config{Connector: connector}
+	switch connector {
+	case BenchPassthrough:
+		config.Connector = ConnectorNIXLV2
+	case ConnectorNIXLV1, ConnectorNIXLV2, ConnectorLMCache:
+	default:
+		return nil, fmt.Errorf("unknown connector %q", connector)
+	}
+
+	s, err := NewProxy("0", &url.URL{Scheme: "http", Host: "localhost:8001"}, config)
+	if err != nil {
+		return nil, err
+	}
+	s.logger = logr.Discard()
+	s.decoderProxy = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		drainBenchRequest(r)
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(benchDecodeResponse) //nolint:all
+	})
+	s.prefillerProxies.Add(benchPrefillerHostPort, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		drainBenchRequest(r)
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(benchPrefillResponse) //nolint:all
+	}))
+	return s.inflight.middleware(instrumentHandler(s.rank(), nil, s.recoverPanics(s.createRoutes()))), nil
+}
+
+// drainBenchRequest reads the request body like a real upstream
+func drainBenchRequest(r *http.Request) {
+	var buffer [32 << 10]byte
+	for {
+		if _, err := r.Body.Read(buffer[:]); err != nil {
+			return
+		}
+	}
+}
+
+// newBenchRequests builds the requests of a connector ahead of the measures, sending them to
+// the handler when not nil, for the warmup
+func newBenchRequests(ctx context.Context, connector string, body []byte, n int, handler http.Handler) []*http.Request {
+	requests := make([]*http.Request, n)
+	for i := range requests {
+		req, _ := http.NewRequestWithContext(ctx, http.MethodPost, CompletionsPath, bytes.NewReader(body)) //nolint:all
+		req.Header.Set("Content-Type", "application/json")
+		if connector != BenchPassthrough {
+			req.Header.Set(requestHeaderPrefillHostPort, benchPrefillerHostPort)
+		}
+		if handler != nil {
+			handler.ServeHTTP(&benchResponseWriter{header: http.Header{}}, req)
+		}
+		requests[i] = req
+	}
+	return requests
+}
+
+// runBench measures the latency and allocations of the handler serving the requests
+func runBench(connector string, handler http.Handler, requests []*http.Request) BenchResult {
+	result := BenchResult{Connector: connector}
+	writers := make([]benchResponseWriter, len(requests))
+	for i := range writers {
+		writers[i].header = http.Header{}
+	}
+	durations := make([]time.Duration, 0, len(requests))
+
+	runtime.GC()
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+	for i, req := range requests {
+		if req.Context().Err() != nil {
+			break
+		}
+		start := time.Now()
+		handler.ServeHTTP(&writers[i], req)
+		durations = append(durations, time.Since(start))
+	}
+	runtime.ReadMemStats(&after)
+
+	result.Requests = len(durations)
+	if result.Requests == 0 {
+		return result
+	}
+	for _, w := range writers[:result.Requests] {
+		if w.statusCode != http.StatusOK {
+			result.Errors++
+		}
+	}
+
+	var total time.Duration
+	for _, d := range durations {
+		total += d
+	}
+	slices.Sort(durations)
+	result.Mean = total / time.Duration(result.Requests)
+	result.P50 = durations[result.Requests*50/100]
+	result.P99 = durations[result.Requests*99/100]
+	result.AllocsPerRequest = (after.Mallocs - before.Mallocs) / uint64(result.Requests)
+	result.BytesPerRequest = (after.TotalAlloc - before.TotalAlloc) / uint64(result.Requests)
+	return result
+}
+
+// benchResponseWriter discards the responses of the benchmarked requests, recording their status
+type benchResponseWriter struct {
+	header     http.Header
+	statusCode int
+}
+
+func (w *benchResponseWriter) Header() http.Header {
+	return w.header
+}
+
+func (w *benchResponseWriter) Write(b []byte) (int, error) {
+	if w.statusCode == 0 {
+		w.statusCode = http.StatusOK
+	}
+	return len(b), nil
+}
+
+func (w *benchResponseWriter) WriteHeader(statusCode int) {
+	if w.statusCode == 0 && statusCode >= 200 {
+		w.statusCode = statusCode
+	}
+}
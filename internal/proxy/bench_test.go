@@ -0,0 +1,47 @@
+/*
+Copyright 2025 The llm-d Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package proxy
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo/v2" //nolint:revive
+	. "github.com/onsi/gomega"    //nolint:revive
+)
+
+var _ = Describe("Bench", func() {
+	It("should measure the overhead of each connector", func() {
+		connectors := []string{BenchPassthrough, ConnectorNIXLV1, ConnectorNIXLV2, ConnectorLMCache}
+		results, err := Bench(context.Background(), BenchConfig{Connectors: connectors, Requests: 20, PromptBytes: 1024})
+		Expect(err).ToNot(HaveOccurred())
+
+		Expect(results).To(HaveLen(len(connectors)))
+		for i, result := range results {
+			Expect(result.Connector).To(Equal(connectors[i]))
+			Expect(result.Requests).To(Equal(20))
+			Expect(result.Errors).To(BeZero(), result.Connector)
+			Expect(result.P50).To(BeNumerically(">", 0))
+			Expect(result.P99).To(BeNumerically(">=", result.P50))
+			Expect(result.AllocsPerRequest).To(BeNumerically(">", 0))
+		}
+	})
+
+	It("should reject unknown connectors", func() {
+		_, err := Bench(context.Background(), BenchConfig{Connectors: []string{"mooncake"}, Requests: 1})
+		Expect(err).To(MatchError(ContainSubstring(`unknown connector "mooncake"`)))
+	})
+})
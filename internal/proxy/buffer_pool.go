@@ -0,0 +1,164 @@
+/*
+Copyright 2025 The llm-d Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package proxy
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// maxPooledBufferSize bounds the capacity of the buffers returned to the pools, so a
+// few very large (e.g. multimodal) bodies do not stay pinned in memory
+const maxPooledBufferSize = 4 << 20
+
+var (
+	bufferPool = sync.Pool{
+		New: func() any { return new(bytes.Buffer) },
+	}
+
+	responseWriterPool = sync.Pool{
+		New: func() any { return new(bufferedResponseWriter) },
+	}
+)
+
+// getBuffer returns an empty buffer from the pool
+func getBuffer() *bytes.Buffer {
+	buffer := bufferPool.Get().(*bytes.Buffer)
+	buffer.Reset()
+	return buffer
+}
+
+// putBuffer returns a buffer to the pool. Oversized buffers are left to the GC.
+func putBuffer(buffer *bytes.Buffer) {
+	if buffer.Cap() > maxPooledBufferSize {
+		return
+	}
+	bufferPool.Put(buffer)
+}
+
+// pooledBuffer is a pooled buffer shared by the handler which filled it and the request
+// bodies reading it. The transport may still be sending a body after the handler
+// returned, so the buffer goes back to the pool once the handler released it and every
+// body was read to the end. Bodies which are not fully read leave the buffer to the GC.
+type pooledBuffer struct {
+	buffer *bytes.Buffer
+	refs   atomic.Int32
+}
+
+func newPooledBuffer() *pooledBuffer {
+	p := &pooledBuffer{buffer: getBuffer()}
+	p.refs.Store(1)
+	return p
+}
+
+// Bytes returns the content of the buffer, valid until the buffer is released
+func (p *pooledBuffer) Bytes() []byte {
+	return p.buffer.Bytes()
+}
+
+func (p *pooledBuffer) Len() int {
+	return p.buffer.Len()
+}
+
+// replace replaces the content of the buffer, before any body reads it
+func (p *pooledBuffer) replace(content []byte) {
+	p.buffer.Reset()
+	p.buffer.Write(content)
+}
+
+// String returns a copy of the content, so the buffer can be logged lazily
+func (p *pooledBuffer) String() string {
+	return p.buffer.String()
+}
+
+// body returns a request body reading the buffer
+func (p *pooledBuffer) body() io.ReadCloser {
+	p.refs.Add(1)
+	return &pooledBody{Reader: bytes.NewReader(p.buffer.Bytes()), owner: p}
+}
+
+// release drops the reference held by the handler
+func (p *pooledBuffer) release() {
+	if p.refs.Add(-1) == 0 {
+		putBuffer(p.buffer)
+	}
+}
+
+// pooledBody is a request body reading a pooled buffer. Close does not release the
+// buffer: the reverse proxy closes request bodies while the transport may still be
+// writing them.
+type pooledBody struct {
+	*bytes.Reader
+	owner *pooledBuffer
+	done  atomic.Bool
+}
+
+func (b *pooledBody) Read(p []byte) (int, error) {
+	n, err := b.Reader.Read(p)
+	if err == io.EOF && b.done.CompareAndSwap(false, true) {
+		b.owner.release()
+	}
+	return n, err
+}
+
+func (b *pooledBody) Close() error {
+	return nil
+}
+
+// encodeRequestBody encodes a request body into a pooled buffer. The output is the same
+// as json.Marshal.
+func encodeRequestBody(v any) (*pooledBuffer, error) {
+	p := newPooledBuffer()
+	if err := json.NewEncoder(p.buffer).Encode(v); err != nil {
+		p.release()
+		return nil, err
+	}
+	p.buffer.Truncate(p.buffer.Len() - 1) // trailing newline added by the encoder
+	return p, nil
+}
+
+// getResponseWriter returns an empty buffered response writer from the pool
+func getResponseWriter() *bufferedResponseWriter {
+	return responseWriterPool.Get().(*bufferedResponseWriter)
+}
+
+// putResponseWriter resets a buffered response writer and returns it to the pool
+func putResponseWriter(w *bufferedResponseWriter) {
+	if w == nil || w.buffer.Cap() > maxPooledBufferSize {
+		return
+	}
+	w.buffer.Reset()
+	w.headers = nil
+	w.statusCode = 0
+	w.firstByte = time.Time{}
+	responseWriterPool.Put(w)
+}
+
+// readPooledRequestBody is readRequestBody reading into a pooled buffer
+func readPooledRequestBody(w http.ResponseWriter, r *http.Request, limit int64) (*pooledBuffer, error) {
+	p := newPooledBuffer()
+	if err := readRequestBodyInto(p.buffer, w, r, limit); err != nil {
+		p.release()
+		return nil, err
+	}
+	return p, nil
+}
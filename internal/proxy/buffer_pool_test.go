@@ -0,0 +1,186 @@
+/*
+Copyright 2025 The llm-d Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package proxy
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	. "github.com/onsi/ginkgo/v2" // nolint:revive
+	. "github.com/onsi/gomega"    // nolint:revive
+)
+
+var _ = Describe("Buffer pooling", func() {
+	It("should encode request bodies as json.Marshal does", func() {
+		request := map[string]any{
+			"model":  "m",
+			"prompt": "<b>tom & jerry</b>",
+			"stream": false,
+		}
+		expected, err := json.Marshal(request)
+		Expect(err).ToNot(HaveOccurred())
+
+		body, err := encodeRequestBody(request)
+		Expect(err).ToNot(HaveOccurred())
+		defer body.release()
+		Expect(body.Bytes()).To(Equal(expected))
+		Expect(body.String()).To(Equal(string(expected)))
+	})
+
+	It("should keep the buffer until released and read to the end", func() {
+		buffer := newPooledBuffer()
+		buffer.buffer.WriteString("hello")
+
+		body := buffer.body()
+		Expect(body.Close()).To(Succeed())
+		Expect(buffer.refs.Load()).To(Equal(int32(2)))
+
+		buffer.release()
+		Expect(buffer.refs.Load()).To(Equal(int32(1)))
+
+		data, err := io.ReadAll(body)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(string(data)).To(Equal("hello"))
+		Expect(buffer.refs.Load()).To(BeZero())
+
+		// reading again does not release twice
+		_, err = io.ReadAll(body)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(buffer.refs.Load()).To(BeZero())
+	})
+
+	It("should read request bodies into pooled buffers", func() {
+		req := httptest.NewRequest(http.MethodPost, ChatCompletionsPath, strings.NewReader(`{"model":"m"}`))
+		buffer, err := readPooledRequestBody(httptest.NewRecorder(), req, 0)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(buffer.String()).To(Equal(`{"model":"m"}`))
+		buffer.release()
+
+		req = httptest.NewRequest(http.MethodPost, ChatCompletionsPath, strings.NewReader(`{"model":"m"}`))
+		_, err = readPooledRequestBody(httptest.NewRecorder(), req, 4)
+		var maxBytesErr *http.MaxBytesError
+		Expect(err).To(BeAssignableToTypeOf(maxBytesErr))
+	})
+
+	It("should reset pooled response writers", func() {
+		rw := getResponseWriter()
+		rw.Header().Set("Content-Type", "application/json")
+		rw.Write([]byte("{}")) //nolint:all
+		putResponseWriter(rw)
+
+		Expect(rw.statusCode).To(BeZero())
+		Expect(rw.headers).To(BeNil())
+		Expect(rw.buffer.Len()).To(BeZero())
+
+		putResponseWriter(nil)
+	})
+})
+
+// benchmarkRequest is a chat completion request of about 8KB
+var benchmarkRequest = map[string]any{
+	"model": "Qwen/Qwen3-0.6B",
+	"messages": []map[string]any{
+		{"role": "system", "content": strings.Repeat("You are a helpful assistant. ", 100)},
+		{"role": "user", "content": strings.Repeat("Summarize the following text. ", 180)},
+	},
+	"max_tokens": 256,
+	"stream":     true,
+}
+
+func BenchmarkEncodeRequestBody(b *testing.B) {
+	b.Run("marshal", func(b *testing.B) {
+		b.ReportAllocs()
+		for b.Loop() {
+			body, err := json.Marshal(benchmarkRequest)
+			if err != nil {
+				b.Fatal(err)
+			}
+			io.Copy(io.Discard, io.NopCloser(strings.NewReader(string(body)))) //nolint:all
+		}
+	})
+
+	b.Run("pooled", func(b *testing.B) {
+		b.ReportAllocs()
+		for b.Loop() {
+			body, err := encodeRequestBody(benchmarkRequest)
+			if err != nil {
+				b.Fatal(err)
+			}
+			io.Copy(io.Discard, body.body()) //nolint:all
+			body.release()
+		}
+	})
+}
+
+func BenchmarkReadRequestBody(b *testing.B) {
+	data, err := json.Marshal(benchmarkRequest)
+	if err != nil {
+		b.Fatal(err)
+	}
+	w := httptest.NewRecorder()
+	newRequest := func() *http.Request {
+		return &http.Request{Body: io.NopCloser(bytes.NewReader(data)), ContentLength: int64(len(data))}
+	}
+
+	b.Run("unpooled", func(b *testing.B) {
+		b.ReportAllocs()
+		for b.Loop() {
+			if _, err := readRequestBody(w, newRequest(), 0); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+
+	b.Run("pooled", func(b *testing.B) {
+		b.ReportAllocs()
+		for b.Loop() {
+			body, err := readPooledRequestBody(w, newRequest(), 0)
+			if err != nil {
+				b.Fatal(err)
+			}
+			body.release()
+		}
+	})
+}
+
+func BenchmarkPrefillResponseWriter(b *testing.B) {
+	response := bytes.Repeat([]byte(`{"kv_transfer_params":{"remote_block_ids":[1,2,3]}}`), 64)
+
+	b.Run("unpooled", func(b *testing.B) {
+		b.ReportAllocs()
+		for b.Loop() {
+			rw := &bufferedResponseWriter{}
+			rw.Header().Set("Content-Type", "application/json")
+			rw.Write(response) //nolint:all
+		}
+	})
+
+	b.Run("pooled", func(b *testing.B) {
+		b.ReportAllocs()
+		for b.Loop() {
+			rw := getResponseWriter()
+			rw.Header().Set("Content-Type", "application/json")
+			rw.Write(response) //nolint:all
+			putResponseWriter(rw)
+		}
+	})
+}
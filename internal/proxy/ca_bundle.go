@@ -0,0 +1,112 @@
+/*
+Copyright 2025 The llm-d Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package proxy
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/x509"
+	"fmt"
+	"os"
+	"sync/atomic"
+	"time"
+)
+
+// caBundle is a CA bundle file trusted in addition to the system roots, reloaded when the
+// file changes, e.g. when the mounted secret is rotated
+type caBundle struct {
+	path   string
+	digest [sha256.Size]byte
+	pool   atomic.Pointer[x509.CertPool]
+}
+
+func loadCABundle(path string) (*caBundle, error) {
+	b := &caBundle{path: path}
+	if _, err := b.reload(); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+// reload reads the bundle file again, returning whether its content changed
+func (b *caBundle) reload() (bool, error) {
+	pem, err := os.ReadFile(b.path)
+	if err != nil {
+		return false, fmt.Errorf("failed to read CA bundle: %w", err)
+	}
+	digest := sha256.Sum256(pem)
+	if b.pool.Load() != nil && digest == b.digest {
+		return false, nil
+	}
+
+	pool, err := x509.SystemCertPool()
+	if err != nil {
+		pool = x509.NewCertPool()
+	}
+	if !pool.AppendCertsFromPEM(pem) {
+		return false, fmt.Errorf("no certificate found in CA bundle %s", b.path)
+	}
+	b.digest = digest
+	b.pool.Store(pool)
+	return true, nil
+}
+
+// certPool returns the system roots with the CAs of the bundle
+func (b *caBundle) certPool() *x509.CertPool {
+	return b.pool.Load()
+}
+
+// prefillerRootCAs returns the CAs verifying the prefiller certificates, nil for the system roots
+func (s *Server) prefillerRootCAs() *x509.CertPool {
+	if s.prefillerCA == nil {
+		return nil
+	}
+	return s.prefillerCA.certPool()
+}
+
+// decoderRootCAs returns the CAs verifying the decoder certificate, nil for the system roots
+func (s *Server) decoderRootCAs() *x509.CertPool {
+	if s.decoderCA == nil {
+		return nil
+	}
+	return s.decoderCA.certPool()
+}
+
+// watchPrefillerCA reloads the prefiller CA bundle when it changes. The cached prefiller
+// proxies are dropped, so new connections are verified with the new CAs.
+func (s *Server) watchPrefillerCA(ctx context.Context) {
+	ticker := time.NewTicker(s.config.PrefillerCAReloadInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		changed, err := s.prefillerCA.reload()
+		if err != nil {
+			s.logger.Error(err, "failed to reload the prefiller CA bundle, keeping the previous one")
+			continue
+		}
+		if changed {
+			s.logger.Info("prefiller CA bundle reloaded", "path", s.prefillerCA.path)
+			s.flushPrefillerProxies()
+		}
+	}
+}
@@ -0,0 +1,153 @@
+/*
+Copyright 2025 The llm-d Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package proxy
+
+import (
+	"context"
+	"encoding/pem"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/llm-d/llm-d-routing-sidecar/test/mock"
+	. "github.com/onsi/ginkgo/v2" // nolint:revive
+	. "github.com/onsi/gomega"    // nolint:revive
+	"k8s.io/klog/v2/ktesting"
+)
+
+var _ = Describe("Prefiller CA bundle", func() {
+	var (
+		prefillBackend *httptest.Server
+		caFile         string
+	)
+
+	BeforeEach(func() {
+		prefillBackend = httptest.NewTLSServer(&mock.GenericHandler{})
+		DeferCleanup(prefillBackend.Close)
+		caFile = filepath.Join(GinkgoT().TempDir(), "ca.crt")
+	})
+
+	writeCert := func(der []byte) {
+		Expect(os.WriteFile(caFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600)).To(Succeed())
+	}
+
+	// prefill sends a prefill request through the cached prefiller proxy
+	prefill := func(proxy *Server) int {
+		handler, err := proxy.prefillerProxyHandler(prefillBackend.Listener.Addr().String())
+		Expect(err).ToNot(HaveOccurred())
+
+		body := `{"model": "Qwen/Qwen2-0.5B", "prompt": "Hello", "max_tokens": 1}`
+		req := httptest.NewRequest(http.MethodPost, CompletionsPath, strings.NewReader(body))
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	newProxy := func(config Config) *Server {
+		decodeURL, err := url.Parse("http://localhost:8000")
+		Expect(err).ToNot(HaveOccurred())
+		config.Connector = ConnectorNIXLV2
+		config.PrefillerUseTLS = true
+		proxy, err := NewProxy("0", decodeURL, config)
+		Expect(err).ToNot(HaveOccurred())
+		return proxy
+	}
+
+	It("should verify the prefiller certificates with the CA bundle", func() {
+		writeCert(prefillBackend.Certificate().Raw)
+		Expect(prefill(newProxy(Config{PrefillerCAFile: caFile}))).To(Equal(http.StatusOK))
+		Expect(prefill(newProxy(Config{}))).To(Equal(http.StatusBadGateway))
+	})
+
+	It("should reject invalid CA bundles", func() {
+		decodeURL, err := url.Parse("http://localhost:8000")
+		Expect(err).ToNot(HaveOccurred())
+
+		_, err = NewProxy("0", decodeURL, Config{PrefillerCAFile: caFile})
+		Expect(err).To(HaveOccurred())
+
+		Expect(os.WriteFile(caFile, []byte("not a certificate"), 0o600)).To(Succeed())
+		_, err = NewProxy("0", decodeURL, Config{PrefillerCAFile: caFile})
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("should reload the CA bundle when it changes", func() {
+		_, ctx := ktesting.NewTestContext(GinkgoT())
+		ctx, cancelFn := context.WithCancel(ctx)
+		defer cancelFn()
+
+		other, err := CreateSelfSignedTLSCertificate()
+		Expect(err).ToNot(HaveOccurred())
+		writeCert(other.Certificate[0])
+
+		proxy := newProxy(Config{PrefillerCAFile: caFile, PrefillerCAReloadInterval: 100 * time.Millisecond})
+		go func() {
+			defer GinkgoRecover()
+			Expect(proxy.Start(ctx)).To(Succeed())
+		}()
+		Eventually(proxy.Addr).ShouldNot(BeNil())
+		Expect(prefill(proxy)).To(Equal(http.StatusBadGateway))
+
+		writeCert(prefillBackend.Certificate().Raw)
+		Eventually(func() int { return prefill(proxy) }).WithTimeout(5 * time.Second).Should(Equal(http.StatusOK))
+	})
+})
+
+var _ = Describe("Decoder CA bundle", func() {
+	var (
+		decodeBackend *httptest.Server
+		caFile        string
+	)
+
+	BeforeEach(func() {
+		decodeBackend = httptest.NewTLSServer(&mock.GenericHandler{})
+		DeferCleanup(decodeBackend.Close)
+		caFile = filepath.Join(GinkgoT().TempDir(), "ca.crt")
+		Expect(os.WriteFile(caFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: decodeBackend.Certificate().Raw}), 0o600)).To(Succeed())
+	})
+
+	// decode sends a request to the decoder at the given host, e.g. localhost, of the backend
+	decode := func(host string, config Config) int {
+		_, port, err := net.SplitHostPort(decodeBackend.Listener.Addr().String())
+		Expect(err).ToNot(HaveOccurred())
+		decodeURL, err := url.Parse("https://" + net.JoinHostPort(host, port))
+		Expect(err).ToNot(HaveOccurred())
+		proxy, err := NewProxy("0", decodeURL, config)
+		Expect(err).ToNot(HaveOccurred())
+
+		req := httptest.NewRequest(http.MethodGet, "/v1/models", nil)
+		rec := httptest.NewRecorder()
+		proxy.localDecoderProxy.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	It("should verify the decoder certificate with the CA bundle", func() {
+		Expect(decode("127.0.0.1", Config{DecoderCAFile: caFile})).To(Equal(http.StatusOK))
+		Expect(decode("127.0.0.1", Config{})).To(Equal(http.StatusBadGateway))
+	})
+
+	It("should verify the decoder certificate for the configured name", func() {
+		// The certificate is issued for example.com and the loopback addresses, not localhost
+		Expect(decode("localhost", Config{DecoderCAFile: caFile})).To(Equal(http.StatusBadGateway))
+		Expect(decode("localhost", Config{DecoderCAFile: caFile, DecoderTLSServerName: "example.com"})).To(Equal(http.StatusOK))
+	})
+})
@@ -0,0 +1,400 @@
+/*
+Copyright 2025 The llm-d Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package proxy
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/hashicorp/golang-lru/v2/expirable"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/tools/clientcmd"
+	"k8s.io/utils/set"
+)
+
+const (
+	// callerReviewCacheSize is the number of the caller tokens whose review is cached
+	callerReviewCacheSize = 1024
+	// callerReviewCacheTTL is how long a review is cached, bounding how long a revoked
+	// token is still accepted
+	callerReviewCacheTTL = time.Minute
+	// callerSignatureMaxAge bounds how far the time of a signature may be from the clock of
+	// the prefill side, either way, so its nonce is only remembered for that long
+	callerSignatureMaxAge = 5 * time.Minute
+	// callerNonceSweepInterval is how often the expired nonces are forgotten
+	callerNonceSweepInterval = time.Minute
+)
+
+// tokenReviewResource is the TokenReview API of the API server
+var tokenReviewResource = schema.GroupVersionResource{Group: "authentication.k8s.io", Version: "v1", Resource: "tokenreviews"}
+
+// errTokenRejected reports a token which is not valid, or not issued for the audience
+var errTokenRejected = errors.New("token rejected")
+
+// errSignatureRejected reports a signature which is malformed, too old or not valid
+var errSignatureRejected = errors.New("signature rejected")
+
+// TokenReviewer authenticates the ServiceAccount tokens of the callers
+type TokenReviewer interface {
+	// ReviewToken returns the subject of a token valid for the audience, e.g.
+	// system:serviceaccount:llm:decode, or an error wrapping errTokenRejected
+	ReviewToken(ctx context.Context, token string, audience string) (string, error)
+}
+
+// kubeTokenReviewer reviews the tokens with TokenReviews
+type kubeTokenReviewer struct {
+	client dynamic.Interface
+}
+
+// NewTokenReviewer creates a TokenReviewer sending TokenReviews to the API server, which
+// requires the permissions of the system:auth-delegator cluster role
+func NewTokenReviewer() (TokenReviewer, error) {
+	loadingRules := clientcmd.NewDefaultClientConfigLoadingRules()
+	overrides := &clientcmd.ConfigOverrides{}
+	config, err := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(
+		loadingRules,
+		overrides,
+	).ClientConfig()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get Kubernetes config (ensure running in a pod with proper RBAC): %w", err)
+	}
+
+	dynamicClient, err := dynamic.NewForConfig(config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create Kubernetes dynamic client: %w", err)
+	}
+	return &kubeTokenReviewer{client: dynamicClient}, nil
+}
+
+func (r *kubeTokenReviewer) ReviewToken(ctx context.Context, token string, audience string) (string, error) {
+	review := &unstructured.Unstructured{Object: map[string]any{
+		"apiVersion": "authentication.k8s.io/v1",
+		"kind":       "TokenReview",
+		"spec": map[string]any{
+			"token":     token,
+			"audiences": []any{audience},
+		},
+	}}
+	result, err := r.client.Resource(tokenReviewResource).Create(ctx, review, metav1.CreateOptions{})
+	if err != nil {
+		return "", fmt.Errorf("failed to review the token: %w", err)
+	}
+
+	if authenticated, _, _ := unstructured.NestedBool(result.Object, "status", "authenticated"); !authenticated {
+		message, _, _ := unstructured.NestedString(result.Object, "status", "error")
+		return "", fmt.Errorf("%w: %s", errTokenRejected, message)
+	}
+	// the audiences of the status are those of the token among the requested ones
+	audiences, _, _ := unstructured.NestedStringSlice(result.Object, "status", "audiences")
+	if !slices.Contains(audiences, audience) {
+		return "", fmt.Errorf("%w: not issued for audience %q", errTokenRejected, audience)
+	}
+	subject, _, _ := unstructured.NestedString(result.Object, "status", "user", "username")
+	return subject, nil
+}
+
+// callerReview is the cached review of a token
+type callerReview struct {
+	subject string
+	err     error
+}
+
+// callerAuthenticator authenticates the decode side sending prefill work, in prefill-side
+// mode, by the ServiceAccount token of the x-llm-d-caller-authorization header and/or the
+// HMAC signature of the x-llm-d-caller-signature header
+type callerAuthenticator struct {
+	reviewer TokenReviewer // nil when the tokens are not required
+	audience string
+	subjects set.Set[string] // any subject when empty
+
+	// reviews are keyed by the digest of the tokens. API errors are not cached.
+	reviews *expirable.LRU[[sha256.Size]byte, callerReview]
+
+	hmacKey *credentialFile // nil when the signatures are not required
+	nonces  *nonceCache     // the nonces of the signatures accepted, rejecting their replays
+}
+
+// nonceCache remembers the nonces of the signatures until their time is out of the skew
+// window, a replayed signature being rejected until then
+type nonceCache struct {
+	mu    sync.Mutex
+	seen  map[string]time.Time // expiry by nonce
+	swept time.Time
+}
+
+func newNonceCache() *nonceCache {
+	return &nonceCache{seen: map[string]time.Time{}}
+}
+
+// add remembers a nonce until its expiry, and reports whether it was not seen yet
+func (c *nonceCache) add(nonce string, expiry time.Time, now time.Time) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if now.Sub(c.swept) >= callerNonceSweepInterval {
+		for seen, seenExpiry := range c.seen {
+			if !seenExpiry.After(now) {
+				delete(c.seen, seen)
+			}
+		}
+		c.swept = now
+	}
+	if seenExpiry, ok := c.seen[nonce]; ok && seenExpiry.After(now) {
+		return false
+	}
+	c.seen[nonce] = expiry
+	return true
+}
+
+func newCallerAuthenticator(config Config) (*callerAuthenticator, error) {
+	a := &callerAuthenticator{}
+	if config.CallerTokenAudience != "" {
+		if config.CallerTokenReviewer == nil {
+			return nil, errors.New("authenticating the callers requires a token reviewer")
+		}
+		a.reviewer = config.CallerTokenReviewer
+		a.audience = config.CallerTokenAudience
+		a.subjects = set.New(config.CallerAuthorizedSubjects...)
+		a.reviews = expirable.NewLRU[[sha256.Size]byte, callerReview](callerReviewCacheSize, nil, callerReviewCacheTTL)
+	}
+	if config.CallerHMACKeyFile != "" {
+		var err error
+		a.hmacKey, err = loadCredentialFile(config.CallerHMACKeyFile, nil)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read the caller HMAC key: %w", err)
+		}
+		a.nonces = newNonceCache()
+	}
+	return a, nil
+}
+
+// verifySignature checks the signature of a request, t=<unix time>,n=<nonce>,v1=<signature>,
+// as sent by the decode side with the same key, and that its nonce was not seen yet. A key
+// failing to be read again is logged, the previous one being used.
+func (a *callerAuthenticator) verifySignature(logger logr.Logger, header string, method string, u *url.URL, body []byte, now time.Time) error {
+	var timestamp, nonce, signature string
+	for _, field := range strings.Split(header, ",") {
+		name, value, _ := strings.Cut(strings.TrimSpace(field), "=")
+		switch name {
+		case "t":
+			timestamp = value
+		case "n":
+			nonce = value
+		case "v1":
+			signature = value
+		}
+	}
+	unix, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil || nonce == "" || signature == "" {
+		return fmt.Errorf("%w: malformed signature", errSignatureRejected)
+	}
+	if age := now.Sub(time.Unix(unix, 0)).Abs(); age > callerSignatureMaxAge {
+		return fmt.Errorf("%w: signed %v away from the local time", errSignatureRejected, age)
+	}
+	mac, err := hex.DecodeString(signature)
+	if err != nil {
+		return fmt.Errorf("%w: malformed signature", errSignatureRejected)
+	}
+
+	key, err := a.hmacKey.get()
+	if err != nil {
+		logger.Error(err, "failed to refresh the caller HMAC key, verifying with the previous one")
+	}
+	digest := sha256.Sum256(body)
+	expected, _ := hex.DecodeString(prefillSignature(key, timestamp, nonce, method, u, digest[:])) //nolint:all
+	if !hmac.Equal(mac, expected) {
+		return fmt.Errorf("%w: invalid signature", errSignatureRejected)
+	}
+	if !a.nonces.add(nonce, time.Unix(unix, 0).Add(callerSignatureMaxAge), now) {
+		return fmt.Errorf("%w: replayed signature", errSignatureRejected)
+	}
+	return nil
+}
+
+// review returns the subject of a token
+func (a *callerAuthenticator) review(ctx context.Context, token string) (string, error) {
+	key := sha256.Sum256([]byte(token))
+	if review, ok := a.reviews.Get(key); ok {
+		return review.subject, review.err
+	}
+
+	subject, err := a.reviewer.ReviewToken(ctx, token, a.audience)
+	if err == nil || errors.Is(err, errTokenRejected) {
+		a.reviews.Add(key, callerReview{subject: subject, err: err})
+	}
+	return subject, err
+}
+
+// authorized reports whether a subject may send prefill work
+func (a *callerAuthenticator) authorized(subject string) bool {
+	return a.subjects.Len() == 0 || a.subjects.Has(subject)
+}
+
+// callerSubjectKey is the context key of the authenticated caller of a request
+type callerSubjectKey struct{}
+
+// callerSignatureKey is the context key of the caller signature of a completion request,
+// left to the handler to verify
+type callerSignatureKey struct{}
+
+// remoteDecodeRequested reports whether a request is prefill work, its KV cache being
+// pulled by a remote decoder
+func remoteDecodeRequested(p *parsedRequest) bool {
+	return remoteDecodeFields(p.fields)
+}
+
+// remoteDecodeFields reports whether the fields of a request ask for a remote decode. Any
+// value but false or null does, as the engines may coerce them.
+func remoteDecodeFields(fields map[string]json.RawMessage) bool {
+	requested := func(raw json.RawMessage) bool {
+		value := strings.TrimSpace(string(raw))
+		return value != "" && value != "false" && value != "null"
+	}
+	if requested(fields[requestFieldDoRemoteDecode]) {
+		return true // NIXL v1
+	}
+	var params map[string]json.RawMessage
+	return json.Unmarshal(fields[requestFieldKVTransferParams], &params) == nil && requested(params["do_remote_decode"])
+}
+
+// authenticateCallers authenticates the callers in prefill-side mode, on every route. The
+// credentials of a request are verified whatever its route, and the prefill work of the
+// completions without all the required ones is rejected once parsed: the other routes carry
+// no prefill work, so their bodies are not read. The credentials are not forwarded.
+func (s *Server) authenticateCallers(next http.Handler) http.Handler {
+	if s.callerAuth == nil {
+		return next
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r, ok := s.authenticateCaller(w, r); ok {
+			next.ServeHTTP(w, r)
+		}
+	})
+}
+
+// authenticateCaller verifies the credentials of a request, removing them, and returns the
+// request with the subject of its caller when it carries all the required ones. The
+// signature of a completion request is verified by the handler, against the body it reads,
+// and those of the other routes are ignored. The error response of invalid credentials is
+// written.
+func (s *Server) authenticateCaller(w http.ResponseWriter, r *http.Request) (*http.Request, bool) {
+	authorization := r.Header.Get(requestHeaderCallerAuthorization)
+	signature := r.Header.Get(requestHeaderCallerSignature)
+	r.Header.Del(requestHeaderCallerAuthorization)
+	r.Header.Del(requestHeaderCallerSignature)
+
+	var subject string
+	authenticated := true
+	if s.callerAuth.reviewer != nil {
+		if authorization == "" {
+			authenticated = false
+		} else if subject, authenticated = s.reviewCaller(w, r, authorization); !authenticated {
+			return r, false
+		}
+	}
+	if s.callerAuth.hmacKey != nil {
+		if signature == "" || !batchEndpoint(r.URL.Path) {
+			authenticated = false
+		} else {
+			r = r.WithContext(context.WithValue(r.Context(), callerSignatureKey{}, signature))
+		}
+	}
+	if authenticated {
+		r = r.WithContext(context.WithValue(r.Context(), callerSubjectKey{}, subject))
+	}
+	return r, true
+}
+
+// reviewCaller returns the subject of a caller token, writing the error response of a
+// caller which is not allowed
+func (s *Server) reviewCaller(w http.ResponseWriter, r *http.Request, authorization string) (string, bool) {
+	var err error
+	token, ok := strings.CutPrefix(authorization, "Bearer ")
+	if !ok || token == "" {
+		s.logger.V(4).Info("request with an invalid caller authorization")
+		err = errorUnauthorized(w)
+	} else if subject, rerr := s.callerAuth.review(r.Context(), token); errors.Is(rerr, errTokenRejected) {
+		s.logger.V(4).Info("request with an invalid caller token", "reason", rerr.Error())
+		err = errorUnauthorized(w)
+	} else if rerr != nil {
+		s.logger.Error(rerr, "caller authentication")
+		err = errorServiceUnavailable("failed to authenticate the caller", w)
+	} else if !s.callerAuth.authorized(subject) {
+		s.logger.V(4).Info("request from an unauthorized caller", "subject", subject)
+		err = errorStatus(http.StatusForbidden, fmt.Sprintf("caller %q is not authorized", subject), w)
+	} else {
+		return subject, true
+	}
+	if err != nil {
+		s.logger.Error(err, "failed to send error response to client")
+	}
+	return "", false
+}
+
+// verifyCallerSignature checks the caller signature of a completion request against the body
+// read by the handler, in prefill-side mode, writing the error response of an invalid one
+func (s *Server) verifyCallerSignature(w http.ResponseWriter, r *http.Request, body []byte) bool {
+	signature, ok := r.Context().Value(callerSignatureKey{}).(string)
+	if s.callerAuth == nil || !ok {
+		return true
+	}
+	if err := s.callerAuth.verifySignature(s.logger, signature, r.Method, r.URL, body, time.Now()); err != nil {
+		s.logger.V(4).Info("request with an invalid caller signature", "reason", err.Error())
+		if err := errorUnauthorized(w); err != nil {
+			s.logger.Error(err, "failed to send error response to client")
+		}
+		return false
+	}
+	return true
+}
+
+// requireCaller rejects the prefill work of a completion request without authenticated
+// caller, in prefill-side mode, e.g. a request of the batch API or without credentials
+func (s *Server) requireCaller(w http.ResponseWriter, r *http.Request, p *parsedRequest) bool {
+	if s.callerAuth == nil || !remoteDecodeRequested(p) {
+		return true
+	}
+	if _, ok := r.Context().Value(callerSubjectKey{}).(string); ok {
+		return true
+	}
+	s.rejectAnonymousCaller(w)
+	return false
+}
+
+// rejectAnonymousCaller writes the error response of prefill work without caller credentials
+func (s *Server) rejectAnonymousCaller(w http.ResponseWriter) {
+	s.logger.V(4).Info("prefill request without caller credentials")
+	if err := errorUnauthorized(w); err != nil {
+		s.logger.Error(err, "failed to send error response to client")
+	}
+}
@@ -0,0 +1,336 @@
+/*
+Copyright 2025 The llm-d Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package proxy
+
+import (
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2" // nolint:revive
+	. "github.com/onsi/gomega"    // nolint:revive
+)
+
+// fakeTokenReviewer authenticates the tokens named after their subject
+type fakeTokenReviewer struct {
+	reviews int
+	err     error
+}
+
+func (r *fakeTokenReviewer) ReviewToken(_ context.Context, token string, audience string) (string, error) {
+	r.reviews++
+	if r.err != nil {
+		return "", r.err
+	}
+	subject, ok := strings.CutPrefix(token, audience+":")
+	if !ok {
+		return "", fmt.Errorf("%w: invalid token", errTokenRejected)
+	}
+	return subject, nil
+}
+
+var _ = Describe("Caller authentication", func() {
+	const decode = "system:serviceaccount:llm:decode"
+
+	var (
+		reviewer *fakeTokenReviewer
+		proxy    *Server
+		handler  http.Handler
+		received http.Header
+	)
+
+	BeforeEach(func() {
+		reviewer = &fakeTokenReviewer{}
+		decodeURL, err := url.Parse("http://localhost:8000")
+		Expect(err).ToNot(HaveOccurred())
+		proxy, err = NewProxy("0", decodeURL, Config{
+			CallerTokenAudience:      "prefill",
+			CallerAuthorizedSubjects: []string{decode},
+			CallerTokenReviewer:      reviewer,
+		})
+		Expect(err).ToNot(HaveOccurred())
+
+		received = nil
+		proxy.decoderProxy = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			received = r.Header.Clone()
+			body, err := io.ReadAll(r.Body)
+			Expect(err).ToNot(HaveOccurred())
+			received.Set("x-test-body", string(body))
+			w.WriteHeader(http.StatusOK)
+		})
+		handler = proxy.routes()
+	})
+
+	sendTo := func(path string, body string, token string) int {
+		req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		if token != "" {
+			req.Header.Set(requestHeaderCallerAuthorization, "Bearer "+token)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	send := func(body string, token string) int {
+		return sendTo(CompletionsPath, body, token)
+	}
+
+	const prefillWork = `{"model":"llama","prompt":"hi","kv_transfer_params":{"do_remote_decode":true}}`
+
+	DescribeTable("should authenticate the prefill work",
+		func(body string, token string, expected int) {
+			Expect(send(body, token)).To(Equal(expected))
+			if expected == http.StatusOK {
+				Expect(received).ToNot(HaveKey(http.CanonicalHeaderKey(requestHeaderCallerAuthorization)))
+			} else {
+				Expect(received).To(BeNil())
+			}
+		},
+		Entry("with the token of an authorized subject", prefillWork, "prefill:"+decode, http.StatusOK),
+		Entry("with the NIXL v1 field", `{"model":"llama","prompt":"hi","do_remote_decode":true}`, "prefill:"+decode, http.StatusOK),
+		Entry("without token", prefillWork, "", http.StatusUnauthorized),
+		Entry("with the token of another audience", prefillWork, "decode:"+decode, http.StatusUnauthorized),
+		Entry("with the token of another subject", prefillWork, "prefill:system:serviceaccount:llm:client", http.StatusForbidden),
+		Entry("with a string value", `{"model":"llama","prompt":"hi","kv_transfer_params":{"do_remote_decode":"true"}}`, "", http.StatusUnauthorized),
+		Entry("unless the request is not prefill work", `{"model":"llama","prompt":"hi"}`, "", http.StatusOK),
+		Entry("unless remote decode is disabled", `{"model":"llama","prompt":"hi","kv_transfer_params":{"do_remote_decode":false}}`, "", http.StatusOK),
+	)
+
+	DescribeTable("should only verify the credentials of the other routes",
+		func(path string, body string, token string, expected int) {
+			Expect(sendTo(path, body, token)).To(Equal(expected))
+			if expected == http.StatusOK {
+				Expect(received).ToNot(HaveKey(http.CanonicalHeaderKey(requestHeaderCallerAuthorization)))
+				Expect(received.Get("x-test-body")).To(Equal(body))
+			} else {
+				Expect(received).To(BeNil())
+			}
+		},
+		Entry("passthrough with the token of an authorized subject", "/v1/responses", prefillWork, "prefill:"+decode, http.StatusOK),
+		Entry("passthrough without token", "/v1/responses", prefillWork, "", http.StatusOK),
+		Entry("pooling without token", "/pooling", prefillWork, "", http.StatusOK),
+		Entry("passthrough with an invalid token", "/score", `{"model":"llama"}`, "invalid", http.StatusUnauthorized),
+	)
+
+	It("should reject the prefill work dispatched internally", func() {
+		// e.g. a batch item, not sent by the decode side even with a token in its header
+		req := httptest.NewRequest(http.MethodPost, CompletionsPath, strings.NewReader(prefillWork))
+		req.Header.Set(requestHeaderCallerAuthorization, "Bearer prefill:"+decode)
+		rec := httptest.NewRecorder()
+		proxy.chatCompletionsHandler(rec, req)
+		Expect(rec.Code).To(Equal(http.StatusUnauthorized))
+		Expect(reviewer.reviews).To(BeZero())
+	})
+
+	It("should cache the reviews", func() {
+		Expect(send(prefillWork, "prefill:"+decode)).To(Equal(http.StatusOK))
+		Expect(send(prefillWork, "prefill:"+decode)).To(Equal(http.StatusOK))
+		Expect(send(prefillWork, "invalid")).To(Equal(http.StatusUnauthorized))
+		Expect(send(prefillWork, "invalid")).To(Equal(http.StatusUnauthorized))
+		Expect(reviewer.reviews).To(Equal(2))
+	})
+
+	It("should not cache the failed reviews", func() {
+		reviewer.err = errors.New("connection refused")
+		Expect(send(prefillWork, "prefill:"+decode)).To(Equal(http.StatusServiceUnavailable))
+
+		reviewer.err = nil
+		Expect(send(prefillWork, "prefill:"+decode)).To(Equal(http.StatusOK))
+		Expect(reviewer.reviews).To(Equal(2))
+	})
+
+	It("should require a token reviewer", func() {
+		decodeURL, err := url.Parse("http://localhost:8000")
+		Expect(err).ToNot(HaveOccurred())
+		_, err = NewProxy("0", decodeURL, Config{CallerTokenAudience: "prefill"})
+		Expect(err).To(MatchError(ContainSubstring("token reviewer")))
+	})
+})
+
+var _ = Describe("Caller signatures", func() {
+	const prefillWork = `{"model":"llama","prompt":"hi","kv_transfer_params":{"do_remote_decode":true}}`
+
+	var (
+		dir      string
+		handler  http.Handler
+		received http.Header
+	)
+
+	writeKey := func(name string, key string) string {
+		path := filepath.Join(dir, name)
+		Expect(os.WriteFile(path, []byte(key), 0o600)).To(Succeed())
+		return path
+	}
+
+	newPrefillSide := func(config Config) {
+		decodeURL, err := url.Parse("http://localhost:8000")
+		Expect(err).ToNot(HaveOccurred())
+		proxy, err := NewProxy("0", decodeURL, config)
+		Expect(err).ToNot(HaveOccurred())
+		proxy.decoderProxy = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			received = r.Header.Clone()
+			w.WriteHeader(http.StatusOK)
+		})
+		handler = proxy.routes()
+	}
+
+	// sign returns a prefill request signed by the decode side with the key
+	sign := func(key string, body string) *http.Request {
+		decodeURL, err := url.Parse("http://localhost:8000")
+		Expect(err).ToNot(HaveOccurred())
+		decodeSide, err := NewProxy("0", decodeURL, Config{PrefillerHMACKeyFile: writeKey("decode-key", key)})
+		Expect(err).ToNot(HaveOccurred())
+
+		pbody := newPooledBuffer()
+		pbody.replace([]byte(body))
+		defer pbody.release()
+		preq := httptest.NewRequest(http.MethodPost, CompletionsPath, nil)
+		preq.Header.Set("Content-Type", "application/json")
+		decodeSide.authenticatePrefill(preq, pbody)
+		setRequestBody(preq, io.NopCloser(strings.NewReader(body)), len(body))
+		return preq
+	}
+
+	send := func(r *http.Request) int {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, r)
+		return rec.Code
+	}
+
+	BeforeEach(func() {
+		dir = GinkgoT().TempDir()
+		received = nil
+		newPrefillSide(Config{CallerHMACKeyFile: writeKey("key", "secret")})
+	})
+
+	It("should accept the prefill work signed with the key", func() {
+		Expect(send(sign("secret", prefillWork))).To(Equal(http.StatusOK))
+		Expect(received).ToNot(HaveKey(http.CanonicalHeaderKey(requestHeaderCallerSignature)))
+	})
+
+	It("should reject the prefill work not signed with the key", func() {
+		Expect(send(sign("other", prefillWork))).To(Equal(http.StatusUnauthorized))
+		Expect(send(httptest.NewRequest(http.MethodPost, CompletionsPath, strings.NewReader(prefillWork)))).To(Equal(http.StatusUnauthorized))
+		Expect(received).To(BeNil())
+	})
+
+	It("should reject the requests modified after being signed", func() {
+		r := sign("secret", prefillWork)
+		tampered := strings.Replace(prefillWork, "hi", "ho", 1)
+		setRequestBody(r, io.NopCloser(strings.NewReader(tampered)), len(tampered))
+		Expect(send(r)).To(Equal(http.StatusUnauthorized))
+
+		r = sign("secret", prefillWork)
+		r.URL.Path = ChatCompletionsPath
+		Expect(send(r)).To(Equal(http.StatusUnauthorized))
+
+		r = sign("secret", prefillWork)
+		r.URL.RawQuery = "model=other"
+		Expect(send(r)).To(Equal(http.StatusUnauthorized))
+		Expect(received).To(BeNil())
+	})
+
+	It("should reject the replayed signatures", func() {
+		r := sign("secret", prefillWork)
+		signature := r.Header.Get(requestHeaderCallerSignature)
+		Expect(send(r)).To(Equal(http.StatusOK))
+
+		received = nil
+		replay := httptest.NewRequest(http.MethodPost, CompletionsPath, strings.NewReader(prefillWork))
+		replay.Header.Set(requestHeaderCallerSignature, signature)
+		Expect(send(replay)).To(Equal(http.StatusUnauthorized))
+		Expect(received).To(BeNil())
+	})
+
+	DescribeTable("should reject the invalid signatures",
+		func(signature func(timestamp int64) string) {
+			r := httptest.NewRequest(http.MethodPost, CompletionsPath, strings.NewReader(prefillWork))
+			r.Header.Set(requestHeaderCallerSignature, signature(time.Now().Unix()))
+			Expect(send(r)).To(Equal(http.StatusUnauthorized))
+		},
+		Entry("when malformed", func(int64) string { return "v1=abc" }),
+		Entry("when not hex", func(t int64) string { return fmt.Sprintf("t=%d,v1=xyz", t) }),
+		Entry("without nonce", func(t int64) string {
+			digest := sha256.Sum256([]byte(prefillWork))
+			timestamp := strconv.FormatInt(t, 10)
+			return "t=" + timestamp + ",v1=" + prefillSignature([]byte("secret"), timestamp, "", http.MethodPost, &url.URL{Path: CompletionsPath}, digest[:])
+		}),
+		Entry("when too old", func(t int64) string {
+			digest := sha256.Sum256([]byte(prefillWork))
+			timestamp := strconv.FormatInt(t-int64(callerSignatureMaxAge.Seconds())-60, 10)
+			return "t=" + timestamp + ",n=nonce,v1=" + prefillSignature([]byte("secret"), timestamp, "nonce", http.MethodPost, &url.URL{Path: CompletionsPath}, digest[:])
+		}),
+		Entry("when in the future", func(t int64) string {
+			digest := sha256.Sum256([]byte(prefillWork))
+			timestamp := strconv.FormatInt(t+int64(callerSignatureMaxAge.Seconds())+60, 10)
+			return "t=" + timestamp + ",n=nonce,v1=" + prefillSignature([]byte("secret"), timestamp, "nonce", http.MethodPost, &url.URL{Path: CompletionsPath}, digest[:])
+		}),
+	)
+
+	It("should forget the nonces out of the skew window", func() {
+		nonces := newNonceCache()
+		now := time.Now()
+		Expect(nonces.add("nonce", now.Add(callerSignatureMaxAge), now)).To(BeTrue())
+		Expect(nonces.add("nonce", now.Add(callerSignatureMaxAge), now.Add(time.Minute))).To(BeFalse())
+
+		Expect(nonces.add("nonce", now.Add(2*callerSignatureMaxAge), now.Add(callerSignatureMaxAge))).To(BeTrue())
+		Expect(nonces.add("other", now.Add(3*callerSignatureMaxAge), now.Add(2*callerSignatureMaxAge))).To(BeTrue())
+		Expect(nonces.seen).To(HaveLen(1))
+	})
+
+	It("should not verify the signatures of the other routes", func() {
+		r := httptest.NewRequest(http.MethodPost, "/v1/responses", strings.NewReader(prefillWork))
+		r.Header.Set(requestHeaderCallerSignature, "v1=abc")
+		Expect(send(r)).To(Equal(http.StatusOK))
+		Expect(received).ToNot(HaveKey(http.CanonicalHeaderKey(requestHeaderCallerSignature)))
+	})
+
+	It("should serve the requests which are not prefill work without signature", func() {
+		r := httptest.NewRequest(http.MethodPost, CompletionsPath, strings.NewReader(`{"model":"llama","prompt":"hi"}`))
+		Expect(send(r)).To(Equal(http.StatusOK))
+	})
+
+	It("should require both the token and the signature when both are configured", func() {
+		const decode = "system:serviceaccount:llm:decode"
+		newPrefillSide(Config{
+			CallerHMACKeyFile:   writeKey("key", "secret"),
+			CallerTokenAudience: "prefill",
+			CallerTokenReviewer: &fakeTokenReviewer{},
+		})
+
+		Expect(send(sign("secret", prefillWork))).To(Equal(http.StatusUnauthorized))
+
+		r := httptest.NewRequest(http.MethodPost, CompletionsPath, strings.NewReader(prefillWork))
+		r.Header.Set(requestHeaderCallerAuthorization, "Bearer prefill:"+decode)
+		Expect(send(r)).To(Equal(http.StatusUnauthorized))
+
+		r = sign("secret", prefillWork)
+		r.Header.Set(requestHeaderCallerAuthorization, "Bearer prefill:"+decode)
+		Expect(send(r)).To(Equal(http.StatusOK))
+	})
+})
@@ -0,0 +1,84 @@
+/*
+Copyright 2025 The llm-d Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package proxy
+
+import (
+	"hash/fnv"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/llm-d/llm-d-routing-sidecar/internal/metrics"
+)
+
+const (
+	decodeTargetStable = "stable"
+	decodeTargetCanary = "canary"
+)
+
+// canaryHandler splits the decode traffic between the stable decoder handler and the canary
+// engine, recording the requests and latency of each target
+func (s *Server) canaryHandler(stable http.Handler) http.Handler {
+	canaryURL := *s.decoderURL
+	canaryURL.Host = net.JoinHostPort(s.decoderURL.Hostname(), s.config.CanaryDecoderPort)
+	canary := s.createDecoderProxy(&canaryURL)
+	rank := s.rank()
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		target, handler := decodeTargetStable, stable
+		if s.selectCanary(r) {
+			target, handler = decodeTargetCanary, canary
+		}
+
+		start := time.Now()
+		rec := statusRecorderPool.Get().(*statusRecorder)
+		rec.ResponseWriter = w
+
+		handler.ServeHTTP(rec, r)
+
+		statusCode := rec.statusCode
+		if statusCode == 0 {
+			statusCode = http.StatusOK
+		}
+		*rec = statusRecorder{}
+		statusRecorderPool.Put(rec)
+		metrics.RecordDecodeTarget(rank, target, clientStatus(r, statusCode), time.Since(start))
+	})
+}
+
+// selectCanary returns whether a request is sent to the canary engine. The sessions are hashed
+// into the weight percentage so they stick to their target, and only move to the canary engine
+// as its weight grows.
+func (s *Server) selectCanary(r *http.Request) bool {
+	weight := s.config.CanaryWeight
+	if weight <= 0 {
+		return false
+	}
+	if weight >= 100 {
+		return true
+	}
+
+	if s.config.CanarySessionHeader != "" {
+		if session := r.Header.Get(s.config.CanarySessionHeader); session != "" {
+			h := fnv.New32a()
+			_, _ = h.Write([]byte(session))
+			return h.Sum32()%100 < uint32(weight)
+		}
+	}
+	return rand.IntN(100) < weight
+}
@@ -0,0 +1,147 @@
+/*
+Copyright 2025 The llm-d Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+
+	"github.com/go-logr/logr"
+	. "github.com/onsi/ginkgo/v2" // nolint:revive
+	. "github.com/onsi/gomega"    // nolint:revive
+
+	"github.com/llm-d/llm-d-routing-sidecar/internal/metrics"
+)
+
+var _ = Describe("Canary routing", func() {
+	var (
+		s       *Server
+		handler http.Handler
+	)
+
+	engine := func(target string) *httptest.Server {
+		engine := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+			w.Header().Set("X-Engine", target)
+			w.WriteHeader(http.StatusOK)
+		}))
+		DeferCleanup(engine.Close)
+		return engine
+	}
+
+	BeforeEach(func() {
+		stable := engine(decodeTargetStable)
+		canary := engine(decodeTargetCanary)
+		decoderURL, err := url.Parse(stable.URL)
+		Expect(err).ToNot(HaveOccurred())
+		canaryURL, err := url.Parse(canary.URL)
+		Expect(err).ToNot(HaveOccurred())
+
+		s = &Server{
+			decoderURL: decoderURL,
+			config: Config{
+				DataParallelRank:    44,
+				CanaryDecoderPort:   canaryURL.Port(),
+				CanarySessionHeader: "X-Session",
+			},
+			logger: logr.Discard(),
+		}
+		handler = s.canaryHandler(s.createDecoderProxy(s.decoderURL))
+	})
+
+	send := func(session string) string {
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, ChatCompletionsPath, nil)
+		if session != "" {
+			req.Header.Set("X-Session", session)
+		}
+		handler.ServeHTTP(rec, req)
+		Expect(rec.Code).To(Equal(http.StatusOK))
+		return rec.Header().Get("X-Engine")
+	}
+
+	It("should send the traffic by weight", func() {
+		s.config.CanaryWeight = 0
+		Expect(send("")).To(Equal(decodeTargetStable))
+		Expect(send("session")).To(Equal(decodeTargetStable))
+
+		s.config.CanaryWeight = 100
+		Expect(send("")).To(Equal(decodeTargetCanary))
+		Expect(send("session")).To(Equal(decodeTargetCanary))
+	})
+
+	It("should stick the sessions to their target", func() {
+		s.config.CanaryWeight = 50
+		targets := map[string]int{}
+		for i := range 100 {
+			session := "session-" + strconv.Itoa(i)
+			target := send(session)
+			for range 3 {
+				Expect(send(session)).To(Equal(target))
+			}
+			targets[target]++
+		}
+		Expect(targets).To(HaveKey(decodeTargetStable))
+		Expect(targets).To(HaveKey(decodeTargetCanary))
+	})
+
+	It("should keep the canary sessions on the canary engine as its weight grows", func() {
+		s.config.CanaryWeight = 10
+		var canary []string
+		for i := range 100 {
+			session := "session-" + strconv.Itoa(i)
+			if send(session) == decodeTargetCanary {
+				canary = append(canary, session)
+			}
+		}
+		Expect(canary).ToNot(BeEmpty())
+
+		s.config.CanaryWeight = 60
+		for _, session := range canary {
+			Expect(send(session)).To(Equal(decodeTargetCanary))
+		}
+	})
+
+	It("should record the requests of each target", func() {
+		s.config.CanaryWeight = 100
+		send("")
+		s.config.CanaryWeight = 0
+		send("")
+		send("")
+
+		counts := map[string]float64{}
+		families, err := metrics.Registry.Gather()
+		Expect(err).ToNot(HaveOccurred())
+		for _, family := range families {
+			if family.GetName() != "llm_d_routing_sidecar_decode_target_requests_total" {
+				continue
+			}
+			for _, metric := range family.Metric {
+				labels := map[string]string{}
+				for _, label := range metric.Label {
+					labels[label.GetName()] = label.GetValue()
+				}
+				if labels[metrics.RankLabel] == "44" && labels["code"] == "200" {
+					counts[labels["target"]] += metric.GetCounter().GetValue()
+				}
+			}
+		}
+		Expect(counts[decodeTargetCanary]).To(BeNumerically(">=", 1))
+		Expect(counts[decodeTargetStable]).To(BeNumerically(">=", 2))
+	})
+})
@@ -0,0 +1,119 @@
+/*
+Copyright 2025 The llm-d Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package proxy
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync/atomic"
+
+	"github.com/llm-d/llm-d-routing-sidecar/internal/metrics"
+)
+
+const (
+	// the phases of a canceled request, besides the prefill and decode stages
+	phaseQueued    = "queued"
+	phaseStreaming = "streaming"
+
+	// statusClientClosedRequest is the status code recorded for the requests canceled by the
+	// client, as nginx does, so they are not mistaken for upstream failures
+	statusClientClosedRequest = 499
+)
+
+type phaseKey struct{}
+
+// requestPhase tracks the phase of a completion request, for the cancellation metrics
+type requestPhase struct {
+	phase atomic.Value // the phase before the response started
+}
+
+// setPhase records the phase the completion request associated with ctx is in: queued, or the
+// prefill or decode stage
+func setPhase(ctx context.Context, phase string) {
+	if p, ok := ctx.Value(phaseKey{}).(*requestPhase); ok {
+		p.phase.Store(phase)
+	}
+}
+
+// clientCanceled reports whether the client canceled the request, e.g. by closing the connection
+func clientCanceled(r *http.Request) bool {
+	return errors.Is(context.Cause(r.Context()), context.Canceled)
+}
+
+// clientStatus returns the status code recorded for a response, statusClientClosedRequest
+// instead of the server errors caused by the client canceling the request
+func clientStatus(r *http.Request, statusCode int) int {
+	if statusCode >= http.StatusInternalServerError && clientCanceled(r) {
+		return statusClientClosedRequest
+	}
+	return statusCode
+}
+
+// phaseRecorder records whether the response started before the client canceled the request
+type phaseRecorder struct {
+	http.ResponseWriter
+	ctx     context.Context
+	started bool
+}
+
+func (r *phaseRecorder) WriteHeader(statusCode int) {
+	r.start()
+	r.ResponseWriter.WriteHeader(statusCode)
+}
+
+func (r *phaseRecorder) Write(b []byte) (int, error) {
+	r.start()
+	return r.ResponseWriter.Write(b)
+}
+
+func (r *phaseRecorder) start() {
+	if !r.started && r.ctx.Err() == nil {
+		r.started = true
+	}
+}
+
+// Unwrap allows http.ResponseController to flush the wrapped ResponseWriter
+func (r *phaseRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
+
+// countCancellations counts the completion requests canceled by the client, by the phase they
+// were in: waiting in the admission queue, in the prefill leg, in the decode leg before the
+// response started, or streaming the response
+func (s *Server) countCancellations(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		p := &requestPhase{}
+		p.phase.Store(stageDecode)
+		rec := &phaseRecorder{ResponseWriter: w, ctx: r.Context()}
+
+		// deferred as the reverse proxy panics when the client goes away while streaming
+		defer func() {
+			if !clientCanceled(r) {
+				return
+			}
+			phase := p.phase.Load().(string)
+			if rec.started {
+				phase = phaseStreaming
+			}
+			s.logger.V(4).Info("request canceled by the client", "phase", phase)
+			metrics.RecordClientCancellation(s.rank(), phase)
+		}()
+
+		next.ServeHTTP(rec, r.WithContext(context.WithValue(r.Context(), phaseKey{}, p)))
+	})
+}
@@ -0,0 +1,135 @@
+/*
+Copyright 2025 The llm-d Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package proxy
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	"github.com/go-logr/logr"
+	. "github.com/onsi/ginkgo/v2" // nolint:revive
+	. "github.com/onsi/gomega"    // nolint:revive
+
+	"github.com/llm-d/llm-d-routing-sidecar/internal/metrics"
+)
+
+var _ = Describe("Client cancellations", func() {
+	const rank = 42 // isolates the series of the tests
+
+	var s *Server
+
+	BeforeEach(func() {
+		s = &Server{
+			config:   Config{DataParallelRank: rank},
+			inflight: newInflightTracker(),
+			logger:   logr.Discard(),
+		}
+	})
+
+	// cancellations returns the number of requests canceled in each phase
+	cancellations := func() map[string]float64 {
+		counts := map[string]float64{}
+		families, err := metrics.Registry.Gather()
+		Expect(err).ToNot(HaveOccurred())
+		for _, family := range families {
+			if family.GetName() != "llm_d_routing_sidecar_client_cancellations_total" {
+				continue
+			}
+			for _, metric := range family.Metric {
+				labels := map[string]string{}
+				for _, label := range metric.Label {
+					labels[label.GetName()] = label.GetValue()
+				}
+				if labels[metrics.RankLabel] == "42" {
+					counts[labels["phase"]] = metric.GetCounter().GetValue()
+				}
+			}
+		}
+		return counts
+	}
+
+	// serve sends a request canceled by the client through the handler
+	serve := func(handler func(w http.ResponseWriter, r *http.Request, cancelFn context.CancelFunc)) {
+		ctx, cancelFn := context.WithCancel(context.Background())
+		defer cancelFn()
+		req := httptest.NewRequest(http.MethodPost, CompletionsPath, nil).WithContext(ctx)
+		s.countCancellations(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			handler(w, r, cancelFn)
+		})).ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	It("should count the requests canceled in the prefill leg", func() {
+		before := cancellations()
+		serve(func(w http.ResponseWriter, r *http.Request, cancelFn context.CancelFunc) {
+			s.inflight.setStage(r.Context(), stagePrefill)
+			cancelFn()
+			w.WriteHeader(http.StatusBadGateway)
+		})
+		Expect(cancellations()[stagePrefill]).To(Equal(before[stagePrefill] + 1))
+		Expect(cancellations()[phaseStreaming]).To(Equal(before[phaseStreaming]))
+	})
+
+	It("should count the requests canceled before the decoder responds", func() {
+		before := cancellations()
+		serve(func(w http.ResponseWriter, _ *http.Request, cancelFn context.CancelFunc) {
+			cancelFn()
+			w.WriteHeader(http.StatusBadGateway)
+		})
+		Expect(cancellations()[stageDecode]).To(Equal(before[stageDecode] + 1))
+	})
+
+	It("should count the requests canceled while streaming, even when aborted", func() {
+		before := cancellations()
+		Expect(func() {
+			serve(func(w http.ResponseWriter, _ *http.Request, cancelFn context.CancelFunc) {
+				w.WriteHeader(http.StatusOK)
+				_, _ = w.Write([]byte("data: {}\n\n"))
+				cancelFn()
+				// as the reverse proxy does when it fails to copy the response
+				panic(http.ErrAbortHandler)
+			})
+		}).To(PanicWith(http.ErrAbortHandler))
+		Expect(cancellations()[phaseStreaming]).To(Equal(before[phaseStreaming] + 1))
+	})
+
+	It("should count the requests canceled in the admission queue", func() {
+		s.admission = newAdmissionQueue("42", 1, 0, 0, false)
+		t, err := s.admission.acquire(context.Background(), classStandard)
+		Expect(err).ToNot(HaveOccurred())
+		defer s.admission.release(t)
+
+		before := cancellations()
+		ctx, cancelFn := context.WithCancel(context.Background())
+		time.AfterFunc(50*time.Millisecond, cancelFn)
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, CompletionsPath, nil).WithContext(ctx)
+		s.countCancellations(s.admit(http.NotFoundHandler())).ServeHTTP(rec, req)
+
+		Expect(cancellations()[phaseQueued]).To(Equal(before[phaseQueued] + 1))
+		Expect(clientStatus(req, rec.Code)).To(Equal(statusClientClosedRequest))
+	})
+
+	It("should not count the requests served", func() {
+		before := cancellations()
+		req := httptest.NewRequest(http.MethodPost, CompletionsPath, nil)
+		s.countCancellations(http.NotFoundHandler()).ServeHTTP(httptest.NewRecorder(), req)
+		Expect(cancellations()).To(Equal(before))
+		Expect(clientStatus(req, http.StatusBadGateway)).To(Equal(http.StatusBadGateway))
+	})
+})
@@ -17,7 +17,16 @@ limitations under the License.
 package proxy
 
 import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
 	"net/http"
+	"strings"
+	"time"
+
+	"github.com/llm-d/llm-d-routing-sidecar/internal/metrics"
 )
 
 var (
@@ -29,30 +38,292 @@ var (
 )
 
 func (s *Server) chatCompletionsHandler(w http.ResponseWriter, r *http.Request) {
-	prefillPodHostPort := r.Header.Get(requestHeaderPrefillHostPort)
+	if s.fastPassthrough(r) {
+		s.decoderProxy.ServeHTTP(w, r)
+		return
+	}
 
-	if prefillPodHostPort == "" {
+	if expectsContinue(r) && !s.checkContinue(w, r) {
+		return
+	}
+
+	// Read request body
+	buffer, err := readPooledRequestBody(w, r, s.config.MaxRequestBodyBytes)
+	r.Body.Close() //nolint:all
+	if err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			if err := errorRequestTooLarge(err, w); err != nil {
+				s.logger.Error(err, "failed to send error response to client")
+			}
+			return
+		}
+		// TODO: check FastAPI error code when failing to read body
+		if err := errorStatus(http.StatusBadRequest, err.Error(), w); err != nil {
+			s.logger.Error(err, "failed to send error response to client")
+		}
+		return
+	}
+	// The body returns to the pool once released and read by the decoder. Decode-only
+	// requests built from it get a copy, as the transport may outlive the handler.
+	defer func() {
+		if buffer != nil {
+			buffer.release()
+		}
+	}()
+	// The caller signature covers the body as received
+	if !s.verifyCallerSignature(w, r, buffer.Bytes()) {
+		return
+	}
+	// Reject malformed requests before any upstream call. The body is parsed once, and the
+	// parsed request shared by the stages below and the connectors.
+	p, verr := validateCompletionRequest(r.URL.Path, buffer.Bytes())
+	if verr != nil {
+		s.logger.V(4).Info("invalid request", "param", verr.param, "message", verr.message)
+		if err := errorValidation(verr, w); err != nil {
+			s.logger.Error(err, "failed to send error response to client")
+		}
+		return
+	}
+	// In prefill-side mode, only the authenticated decode side sends prefill work
+	if !s.requireCaller(w, r, p) {
+		return
+	}
+
+	// Ask the decoder for the usage of streamed completions, stripped unless the client asked
+	stripUsage := s.config.InjectStreamUsage && injectStreamUsage(p)
+	// Send the requests for an alias to its model
+	rewritten := s.rewriteModelAlias(p)
+	if stripUsage || rewritten {
+		if encoded, err := p.encode(); err != nil {
+			s.logger.Error(err, "failed to encode request body, forwarding it unchanged")
+			stripUsage = false
+		} else {
+			buffer.replace(encoded)
+		}
+	}
+	setRequestBody(r, buffer.body(), buffer.Len())
+	r.Header.Del(requestHeaderExpect) // the body is already read
+	body := buffer.Bytes()
+
+	// Bound the request by its deadline, or its stream by the idle timeout
+	stream := p.stream
+	w, r, stopTimer := s.boundRequest(w, r, stream)
+	defer stopTimer()
+
+	// Describe the request in the metrics and logs of the bodies sent to the prefiller,
+	// the decoder and the client
+	start := time.Now()
+	sw, r, info := describeRequest(w, r, p, len(body))
+	info.received = start
+	s.startTrace(sw, r, info, start)
+	defer func() {
+		s.recordResponse(r, info, sw, time.Since(start))
+	}()
+	w = sw
+	if s.config.InjectStreamUsage && stream {
+		uw := &usageWriter{ResponseWriter: sw, strip: stripUsage, record: func(promptTokens int, completionTokens int) {
+			metrics.RecordUsage(s.rank(), info.route, info.labels(), promptTokens, completionTokens)
+		}}
+		defer uw.finish()
+		w = uw
+	}
+
+	// Classify the request by prompt size and modality
+	promptSize := promptSizeBucket(p)
+	modality := requestModality(p)
+	disaggregated := false
+	defer func() {
+		metrics.RecordPromptSize(s.rank(), promptSize, disaggregated, time.Since(start), traceID(r.Header))
+		metrics.RecordModality(s.rank(), modality, disaggregated)
+		if s.stats != nil {
+			s.stats.recordCompletion(disaggregated)
+		}
+	}()
+
+	prefillPodHostPort, deprecated, err := s.prefillTarget(r.Header)
+	if deprecated {
 		// backward compatible behavior: to remove in next release
-		prefillPodHostPort = r.Header.Get(requestHeaderPrefillURL)
+		s.recordDeprecated(r, requestHeaderPrefillURL)
+	}
+	if err != nil {
+		s.logger.V(4).Info("invalid prefiller headers", "error", err.Error())
+		if err := errorStatus(http.StatusBadRequest, err.Error(), w); err != nil {
+			s.logger.Error(err, "failed to send error response to client")
+		}
+		return
+	}
+
+	if s.policy != nil {
+		requested, allowed := prefillPodHostPort, false
+		if prefillPodHostPort, allowed = s.applyRoutingPolicy(w, r, p, modality, prefillPodHostPort); !allowed {
+			return
+		}
+		if requested != "" && prefillPodHostPort == "" {
+			traceDecodeOnly(r.Context(), decodeOnlyRoutingPolicy)
+		}
 	}
 
 	if prefillPodHostPort == "" {
 		s.logger.V(4).Info("skip disaggregated prefill")
-		s.decoderProxy.ServeHTTP(w, r)
+		s.indexPrompt(p)
+		s.decodeWithHedging(w, r, body)
 		return
 	}
 
 	// SSRF Protection: Check if the prefill target is allowed
-	if !s.allowlistValidator.IsAllowed(prefillPodHostPort) {
-		s.logger.Error(nil, "SSRF protection: prefill target not in allowlist",
-			"target", prefillPodHostPort,
-			"clientIP", r.RemoteAddr,
-			"userAgent", r.Header.Get("User-Agent"),
-			"requestPath", r.URL.Path)
-		http.Error(w, "Forbidden: prefill target not allowed by SSRF protection", http.StatusForbidden)
+	allowed := s.allowlistValidator.IsAllowed(prefillPodHostPort)
+	s.auditSSRF(r, prefillPodHostPort, allowed)
+	if !allowed {
+		s.denyPrefillTarget(w, r, prefillPodHostPort)
 		return
 	}
 
 	s.logger.V(4).Info("SSRF protection: prefill target allowed", "target", prefillPodHostPort)
-	s.runConnectorProtocol(w, r, prefillPodHostPort)
+
+	// The KV transfer parameters only describe a single sequence
+	if field, ok := multipleChoicesField(p); ok {
+		s.logger.V(4).Info("multiple choices requested, skip disaggregated prefill", "field", field)
+		traceDecodeOnly(r.Context(), decodeOnlyMultipleChoices)
+		s.runDecodeOnly(w, r, bytes.Clone(body))
+		return
+	}
+
+	if modality != modalityText && s.config.MultimodalDecodeOnly {
+		s.logger.V(4).Info("multimodal request, skip disaggregated prefill", "modality", modality)
+		traceDecodeOnly(r.Context(), decodeOnlyMultimodal)
+		s.runDecodeOnly(w, r, bytes.Clone(body))
+		return
+	}
+
+	if s.config.PrefillBypassTokens > 0 {
+		count, err := s.promptTokenCount(r.Context(), p, r.Header)
+		if err != nil {
+			s.logger.V(4).Info("failed to count prompt tokens", "error", err.Error())
+		} else if count < s.config.PrefillBypassTokens {
+			s.logger.V(4).Info("short prompt, skip disaggregated prefill", "tokens", count)
+			traceDecodeOnly(r.Context(), decodeOnlyShortPrompt)
+			s.runDecodeOnly(w, r, bytes.Clone(body))
+			return
+		}
+	}
+
+	if s.prefixIndex != nil {
+		text := promptText(p)
+		ratio := s.prefixIndex.hitRatio(text)
+		s.prefixIndex.add(text)
+
+		local := ratio >= s.config.PrefixCacheSkipRatio
+		metrics.RecordPrefixCacheDecision(s.rank(), local)
+		if local {
+			s.logger.V(4).Info("prompt prefix cached by the decoder, skip disaggregated prefill", "ratio", ratio)
+			traceDecodeOnly(r.Context(), decodeOnlyPrefixCache)
+			s.runDecodeOnly(w, r, bytes.Clone(body))
+			return
+		}
+	}
+
+	disaggregated = true
+	info.prefiller = prefillPodHostPort
+	if s.spills(len(body)) {
+		// Hand the body to the connector from disk, so it is not held during the decode
+		if spilled, err := s.newSpilledBody(); err != nil {
+			s.logger.Error(err, "failed to spill request body, buffering it in memory")
+		} else if _, err := io.Copy(spilled, r.Body); err != nil {
+			s.logger.Error(err, "failed to spill request body, buffering it in memory")
+			spilled.release()
+			setRequestBody(r, buffer.body(), len(body))
+		} else {
+			defer spilled.release()
+			buffer.release()
+			buffer = nil
+			info.parsed = nil // the connector parses the body from disk
+			setRequestBody(r, spilled.body(), len(body))
+		}
+	}
+	s.runProtocol(w, r, prefillPodHostPort)
+}
+
+// denyPrefillTarget rejects a request whose prefill target is not allowed by SSRF protection
+func (s *Server) denyPrefillTarget(w http.ResponseWriter, r *http.Request, target string) {
+	s.logger.Error(nil, "SSRF protection: prefill target not in allowlist",
+		"target", target,
+		"clientIP", r.RemoteAddr,
+		"userAgent", r.Header.Get("User-Agent"),
+		"requestPath", r.URL.Path)
+	if err := errorStatus(http.StatusForbidden, "Forbidden: prefill target not allowed by SSRF protection", w); err != nil {
+		s.logger.Error(err, "failed to send error response to client")
+	}
+}
+
+// fastPassthrough reports whether the request is forwarded to the decoder as is, skipping
+// everything which needs the body
+func (s *Server) fastPassthrough(r *http.Request) bool {
+	return s.config.FastPassthrough &&
+		r.Header.Get(requestHeaderPrefillHostPort) == "" && r.Header.Get(requestHeaderPrefillURL) == ""
+}
+
+// validateFastPassthrough rejects the features needing the body of the requests without
+// prefiller header, which the fast passthrough does not read
+func (s *Server) validateFastPassthrough() error {
+	if !s.config.FastPassthrough {
+		return nil
+	}
+	var conflicts []string
+	for _, feature := range []struct {
+		name    string
+		enabled bool
+	}{
+		{"a request body limit", s.config.MaxRequestBodyBytes > 0},
+		{"data parallel hedging", s.config.DataParallelHedgeDelay > 0},
+		{"a routing policy", s.policy != nil},
+		{"middlewares", len(s.config.Middlewares) > 0},
+		{"stream usage injection", s.config.InjectStreamUsage},
+		{"model aliases", len(s.aliasedModels) > 0},
+		{"a request timeout", s.config.RequestTimeout > 0},
+		{"a stream idle timeout", s.config.StreamIdleTimeout > 0},
+		{"decode replay", s.config.DecodeReplay},
+		{"caller authentication", s.callerAuth != nil},
+		{"the prefix cache index", s.prefixIndex != nil},
+	} {
+		if feature.enabled {
+			conflicts = append(conflicts, feature.name)
+		}
+	}
+	if len(conflicts) > 0 {
+		return fmt.Errorf("fast passthrough does not read the request body needed by %s", strings.Join(conflicts, ", "))
+	}
+	return nil
+}
+
+// multipleChoices holds the fields requesting multiple sequences per prompt
+type multipleChoices struct {
+	n             float64
+	bestOf        float64
+	useBeamSearch bool
+}
+
+// multipleChoicesField returns the field requesting multiple sequences per prompt, if any.
+// These requests cannot be disaggregated and are sent decode-only. A field failing to decode
+// is left to the engine to reject, the others being still checked.
+func multipleChoicesField(p *parsedRequest) (string, bool) {
+	var choices multipleChoices
+	decode := func(field string, value any) {
+		if raw, ok := p.fields[field]; ok {
+			json.Unmarshal(raw, value) //nolint:all
+		}
+	}
+	decode(requestFieldN, &choices.n)
+	decode(requestFieldBestOf, &choices.bestOf)
+	decode(requestFieldUseBeamSearch, &choices.useBeamSearch)
+
+	switch {
+	case choices.n > 1:
+		return requestFieldN, true
+	case choices.bestOf > 1:
+		return requestFieldBestOf, true
+	case choices.useBeamSearch:
+		return requestFieldUseBeamSearch, true
+	}
+	return "", false
 }
@@ -0,0 +1,272 @@
+/*
+Copyright 2025 The llm-d Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package proxy
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/llm-d/llm-d-routing-sidecar/test/mock"
+	. "github.com/onsi/ginkgo/v2" // nolint:revive
+	. "github.com/onsi/gomega"    // nolint:revive
+	"k8s.io/klog/v2/ktesting"
+)
+
+var _ = Describe("Multiple choices", func() {
+	DescribeTable("should detect requests for multiple sequences",
+		func(body string, expectedField string, expected bool) {
+			field, ok := multipleChoicesField(mustParse(body))
+			Expect(ok).To(Equal(expected))
+			Expect(field).To(Equal(expectedField))
+		},
+		Entry("when n is missing", `{"prompt": "Hello"}`, "", false),
+		Entry("when n is 1", `{"prompt": "Hello", "n": 1}`, "", false),
+		Entry("when n is greater than 1", `{"prompt": "Hello", "n": 2}`, requestFieldN, true),
+		Entry("when best_of is greater than 1", `{"prompt": "Hello", "best_of": 3}`, requestFieldBestOf, true),
+		Entry("when beam search is used", `{"prompt": "Hello", "use_beam_search": true}`, requestFieldUseBeamSearch, true),
+		Entry("when another field is malformed", `{"prompt": "Hello", "n": 4, "best_of": "many"}`, requestFieldN, true),
+		Entry("when n is malformed", `{"prompt": "Hello", "n": "two", "use_beam_search": true}`, requestFieldUseBeamSearch, true),
+	)
+
+	It("should send streamed requests with n>1 decode-only and keep every choice intact", func() {
+		_, ctx := ktesting.NewTestContext(GinkgoT())
+		ctx, cancelFn := context.WithCancel(ctx)
+		defer cancelFn()
+
+		// Decoder streaming two interleaved choices
+		chunks := []string{}
+		for i := range 3 {
+			for choice := range 2 {
+				chunks = append(chunks, fmt.Sprintf(`{"choices":[{"index":%d,"text":"token-%d-%d"}]}`, choice, choice, i))
+			}
+		}
+		var decodeRequest map[string]any
+		decodeBackend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			b, _ := io.ReadAll(r.Body)        //nolint:all
+			json.Unmarshal(b, &decodeRequest) //nolint:all
+			w.Header().Set("Content-Type", "text/event-stream")
+			for _, chunk := range chunks {
+				fmt.Fprintf(w, "data: %s\n\n", chunk) //nolint:all
+				w.(http.Flusher).Flush()
+			}
+			fmt.Fprint(w, "data: [DONE]\n\n") //nolint:all
+		}))
+		DeferCleanup(decodeBackend.Close)
+
+		prefillHandler := &mock.ChatCompletionHandler{Connector: ConnectorNIXLV2, Role: mock.RolePrefill}
+		prefillBackend := httptest.NewServer(prefillHandler)
+		DeferCleanup(prefillBackend.Close)
+
+		decodeURL, err := url.Parse(decodeBackend.URL)
+		Expect(err).ToNot(HaveOccurred())
+		proxy, err := NewProxy("0", decodeURL, Config{Connector: ConnectorNIXLV2})
+		Expect(err).ToNot(HaveOccurred())
+
+		go func() {
+			defer GinkgoRecover()
+			Expect(proxy.Start(ctx)).To(Succeed())
+		}()
+		time.Sleep(1 * time.Second)
+		Expect(proxy.Addr()).ToNot(BeNil())
+
+		body := `{"model": "Qwen/Qwen2-0.5B", "prompt": "Hello", "max_tokens": 3, "n": 2, "stream": true}`
+		req, err := http.NewRequest(http.MethodPost, "http://"+proxy.Addr().String()+CompletionsPath, strings.NewReader(body))
+		Expect(err).ToNot(HaveOccurred())
+		req.Header.Add(requestHeaderPrefillHostPort, prefillBackend.URL[len("http://"):])
+
+		resp, err := http.DefaultClient.Do(req)
+		Expect(err).ToNot(HaveOccurred())
+		defer resp.Body.Close() //nolint:all
+		Expect(resp.StatusCode).To(Equal(http.StatusOK))
+
+		received, err := io.ReadAll(resp.Body)
+		Expect(err).ToNot(HaveOccurred())
+
+		expected := ""
+		for _, chunk := range chunks {
+			expected += "data: " + chunk + "\n\n"
+		}
+		expected += "data: [DONE]\n\n"
+		Expect(string(received)).To(Equal(expected))
+
+		Expect(prefillHandler.RequestCount.Load()).To(BeNumerically("==", 0))
+		Expect(decodeRequest).To(HaveKeyWithValue(requestFieldN, BeNumerically("==", 2)))
+		Expect(decodeRequest).ToNot(HaveKey(requestFieldKVTransferParams))
+	})
+})
+
+var _ = Describe("Fast passthrough", func() {
+	const invalidRequest = `{"model": "Qwen/Qwen2-0.5B", "messages": "Hello"}`
+
+	var (
+		decodeHandler *mock.ChatCompletionHandler
+		proxy         *Server
+	)
+
+	startProxy := func(config Config) string {
+		_, ctx := ktesting.NewTestContext(GinkgoT())
+		ctx, cancelFn := context.WithCancel(ctx)
+		DeferCleanup(cancelFn)
+
+		decodeHandler = &mock.ChatCompletionHandler{Connector: ConnectorNIXLV2, Role: mock.RoleDecode}
+		decodeBackend := httptest.NewServer(decodeHandler)
+		DeferCleanup(decodeBackend.Close)
+
+		decodeURL, err := url.Parse(decodeBackend.URL)
+		Expect(err).ToNot(HaveOccurred())
+		proxy, err = NewProxy("0", decodeURL, config)
+		Expect(err).ToNot(HaveOccurred())
+
+		go func() {
+			defer GinkgoRecover()
+			Expect(proxy.Start(ctx)).To(Succeed())
+		}()
+		time.Sleep(1 * time.Second)
+		Expect(proxy.Addr()).ToNot(BeNil())
+		return "http://" + proxy.Addr().String()
+	}
+
+	It("should forward requests without prefiller header without reading their body", func() {
+		proxyBaseURL := startProxy(Config{Connector: ConnectorNIXLV2, FastPassthrough: true})
+
+		resp, err := http.Post(proxyBaseURL+ChatCompletionsPath, "application/json", strings.NewReader(invalidRequest))
+		Expect(err).ToNot(HaveOccurred())
+		resp.Body.Close() //nolint:all
+
+		// left to the decoder to validate
+		Expect(decodeHandler.RequestCount.Load()).To(BeNumerically("==", 1))
+	})
+
+	It("should read the body of requests without prefiller header when disabled", func() {
+		proxyBaseURL := startProxy(Config{Connector: ConnectorNIXLV2})
+
+		resp, err := http.Post(proxyBaseURL+ChatCompletionsPath, "application/json", strings.NewReader(invalidRequest))
+		Expect(err).ToNot(HaveOccurred())
+		resp.Body.Close() //nolint:all
+
+		Expect(resp.StatusCode).To(Equal(http.StatusBadRequest))
+		Expect(decodeHandler.RequestCount.Load()).To(BeNumerically("==", 0))
+	})
+
+	It("should be rejected with the features needing the body", func() {
+		_, err := NewProxy("0", &url.URL{Scheme: "http", Host: "localhost:8001"}, Config{Connector: ConnectorNIXLV2, FastPassthrough: true,
+			MaxRequestBodyBytes: 16, ModelAliases: map[string]string{"Qwen/Qwen2-0.5B": "qwen"}, PrefixCacheSkipRatio: 0.5, PrefixCacheIndexSize: 64})
+		Expect(err).To(MatchError(ContainSubstring("a request body limit, model aliases, the prefix cache index")))
+	})
+
+	It("should be rejected when reloading a feature needing the body", func() {
+		proxyBaseURL := startProxy(Config{Connector: ConnectorNIXLV2, FastPassthrough: true})
+
+		Expect(proxy.Reload(Config{Connector: ConnectorNIXLV2, RoutingPolicy: `"decode"`})).
+			To(MatchError(ContainSubstring("a routing policy")))
+
+		resp, err := http.Post(proxyBaseURL+ChatCompletionsPath, "application/json", strings.NewReader(invalidRequest))
+		Expect(err).ToNot(HaveOccurred())
+		resp.Body.Close() //nolint:all
+		Expect(decodeHandler.RequestCount.Load()).To(BeNumerically("==", 1))
+	})
+})
+
+// discardResponseWriter is a response writer discarding the response
+type discardResponseWriter struct {
+	header http.Header
+}
+
+func (w *discardResponseWriter) Header() http.Header         { return w.header }
+func (w *discardResponseWriter) Write(b []byte) (int, error) { return len(b), nil }
+func (w *discardResponseWriter) WriteHeader(int)             {}
+
+// BenchmarkPassthrough measures the overhead of the sidecar handlers on requests without
+// prefiller header, the decoder being a no-op handler
+func BenchmarkPassthrough(b *testing.B) {
+	body := []byte(`{"model": "Qwen/Qwen2-0.5B", "messages": [{"role": "user", "content": "` +
+		strings.Repeat("Hello ", 1000) + `"}], "max_tokens": 256}`)
+
+	for _, fastPassthrough := range []bool{false, true} {
+		b.Run(fmt.Sprintf("fast=%t", fastPassthrough), func(b *testing.B) {
+			proxy, err := NewProxy("0", &url.URL{Scheme: "http", Host: "localhost:8001"}, Config{FastPassthrough: fastPassthrough})
+			if err != nil {
+				b.Fatal(err)
+			}
+			proxy.decoderProxy = http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+				w.WriteHeader(http.StatusOK)
+			})
+			handler := proxy.inflight.middleware(instrumentHandler(proxy.rank(), nil, proxy.createRoutes()))
+
+			reader := bytes.NewReader(body)
+			req := httptest.NewRequest(http.MethodPost, ChatCompletionsPath, io.NopCloser(reader))
+			w := &discardResponseWriter{header: http.Header{}}
+
+			b.ReportAllocs()
+			for b.Loop() {
+				reader.Reset(body)
+				handler.ServeHTTP(w, req)
+			}
+		})
+	}
+}
+
+// BenchmarkCompletionRequest measures the CPU and allocations of the sidecar handlers per chat
+// completion request, mostly parsing and rewriting its body, the prefiller and decoder being
+// stubs answering immediately
+func BenchmarkCompletionRequest(b *testing.B) {
+	body, err := json.Marshal(map[string]any{
+		"model": benchModel,
+		"messages": []map[string]any{
+			{"role": "system", "content": strings.Repeat("You are a helpful assistant. ", 100)},
+			{"role": "user", "content": strings.Repeat("Summarize the following text. ", 2000)},
+		},
+		"max_tokens": 256,
+		"stream":     false,
+	})
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	for _, connector := range []string{BenchPassthrough, ConnectorNIXLV2} {
+		b.Run(connector, func(b *testing.B) {
+			handler, err := newBenchHandler(connector)
+			if err != nil {
+				b.Fatal(err)
+			}
+			w := &benchResponseWriter{header: http.Header{}}
+
+			b.SetBytes(int64(len(body)))
+			b.ReportAllocs()
+			for b.Loop() {
+				req := httptest.NewRequest(http.MethodPost, ChatCompletionsPath, bytes.NewReader(body))
+				if connector != BenchPassthrough {
+					req.Header.Set(requestHeaderPrefillHostPort, benchPrefillerHostPort)
+				}
+				w.statusCode = 0
+				handler.ServeHTTP(w, req)
+				if w.statusCode != http.StatusOK {
+					b.Fatalf("unexpected status code %d", w.statusCode)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,76 @@
+/*
+Copyright 2025 The llm-d Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package proxy
+
+import (
+	"context"
+	"math/rand/v2"
+	"net/http"
+	"time"
+
+	"github.com/llm-d/llm-d-routing-sidecar/internal/metrics"
+)
+
+// responseHeaderConnector reports the connector followed by a disaggregated request when the
+// experiment connector is enabled
+const responseHeaderConnector = "x-connector"
+
+type connectorKey struct{}
+
+// runProtocol runs the P/D protocol of the connector assigned to the request: the experiment
+// connector for its weight percentage of the requests, the configured one otherwise
+func (s *Server) runProtocol(w http.ResponseWriter, r *http.Request, prefillPodHostPort string) {
+	s.reportPrefiller(w, prefillPodHostPort)
+	if s.runExperimentProtocol == nil {
+		traceRouting(r.Context(), func(d *RoutingDecision) { d.Connector = s.config.Connector })
+		s.recordDeprecatedConnector(r, s.config.Connector)
+		s.runConnectorProtocol(w, r, prefillPodHostPort)
+		return
+	}
+
+	connector, run := s.config.Connector, s.runConnectorProtocol
+	if rand.IntN(100) < s.config.ExperimentConnectorWeight {
+		connector, run = s.config.ExperimentConnector, s.runExperimentProtocol
+	}
+	s.logger.V(4).Info("connector assigned", "connector", connector)
+	traceRouting(r.Context(), func(d *RoutingDecision) { d.Connector = connector })
+	s.recordDeprecatedConnector(r, connector)
+	w.Header().Set(responseHeaderConnector, connector)
+	r = r.WithContext(context.WithValue(r.Context(), connectorKey{}, connector))
+
+	start := time.Now()
+	rec := statusRecorderPool.Get().(*statusRecorder)
+	rec.ResponseWriter = w
+
+	run(rec, r, prefillPodHostPort)
+
+	statusCode := rec.statusCode
+	if statusCode == 0 {
+		statusCode = http.StatusOK
+	}
+	*rec = statusRecorder{}
+	statusRecorderPool.Put(rec)
+	metrics.RecordConnectorRequest(s.rank(), connector, clientStatus(r, statusCode), time.Since(start))
+}
+
+// requestConnector returns the connector followed by a request
+func (s *Server) requestConnector(ctx context.Context) string {
+	if connector, ok := ctx.Value(connectorKey{}).(string); ok {
+		return connector
+	}
+	return s.config.Connector
+}
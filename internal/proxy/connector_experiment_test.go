@@ -0,0 +1,84 @@
+/*
+Copyright 2025 The llm-d Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+
+	"github.com/go-logr/logr"
+	. "github.com/onsi/ginkgo/v2" // nolint:revive
+	. "github.com/onsi/gomega"    // nolint:revive
+)
+
+var _ = Describe("Experiment connector", func() {
+	var (
+		s        *Server
+		followed []string
+	)
+
+	BeforeEach(func() {
+		followed = nil
+		s = &Server{
+			config: Config{
+				Connector:           ConnectorNIXLV2,
+				ExperimentConnector: ConnectorLMCache,
+			},
+			deprecations: newDeprecationTracker(),
+			logger:       logr.Discard(),
+		}
+		runner := func(name string) protocolRunner {
+			return func(w http.ResponseWriter, r *http.Request, _ string) {
+				followed = append(followed, name+"/"+s.requestConnector(r.Context()))
+				w.WriteHeader(http.StatusOK)
+			}
+		}
+		s.runConnectorProtocol = runner("configured")
+		s.runExperimentProtocol = runner("experiment")
+	})
+
+	run := func() *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		s.runProtocol(rec, httptest.NewRequest(http.MethodPost, ChatCompletionsPath, nil), "prefiller:8000")
+		return rec
+	}
+
+	It("should assign the requests to the connectors by weight", func() {
+		s.config.ExperimentConnectorWeight = 100
+		rec := run()
+		Expect(rec.Header().Get(responseHeaderConnector)).To(Equal(ConnectorLMCache))
+
+		s.config.ExperimentConnectorWeight = 0
+		rec = run()
+		Expect(rec.Header().Get(responseHeaderConnector)).To(Equal(ConnectorNIXLV2))
+
+		Expect(followed).To(Equal([]string{"experiment/" + ConnectorLMCache, "configured/" + ConnectorNIXLV2}))
+	})
+
+	It("should follow the configured connector without experiment", func() {
+		s.runExperimentProtocol = nil
+		rec := run()
+		Expect(rec.Header().Get(responseHeaderConnector)).To(BeEmpty())
+		Expect(followed).To(Equal([]string{"configured/" + ConnectorNIXLV2}))
+	})
+
+	It("should apply the prefill overrides of the assigned connector", func() {
+		completionRequest := map[string]any{requestFieldMaxTokens: 50}
+		s.applyPrefillOverrides(completionRequest, ConnectorNIXLV1)
+		Expect(completionRequest).To(Equal(map[string]any{requestFieldMaxTokens: 50}))
+	})
+})
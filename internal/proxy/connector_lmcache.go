@@ -17,10 +17,9 @@ limitations under the License.
 package proxy
 
 import (
-	"encoding/json"
+	"bytes"
 	"io"
 	"net/http"
-	"strings"
 )
 
 func (s *Server) runLMCacheProtocol(w http.ResponseWriter, r *http.Request, prefillPodHostPort string) {
@@ -30,37 +29,45 @@ func (s *Server) runLMCacheProtocol(w http.ResponseWriter, r *http.Request, pref
 	defer r.Body.Close() //nolint:all
 	original, err := io.ReadAll(r.Body)
 	if err != nil {
-		w.WriteHeader(http.StatusBadRequest) // TODO: check FastAPI error code when failing to read body
-		w.Write([]byte(err.Error()))         //nolint:all
+		// TODO: check FastAPI error code when failing to read body
+		if err := errorStatus(http.StatusBadRequest, err.Error(), w); err != nil {
+			s.logger.Error(err, "failed to send error response to client")
+		}
 		return
 	}
 
 	// Parse completion request
-	var completionRequest map[string]any
-	if err := json.Unmarshal(original, &completionRequest); err != nil {
+	completionRequest, err := requestFields(r, original)
+	if err != nil {
 		if err := errorJSONInvalid(err, w); err != nil {
 			s.logger.Error(err, "failed to send error response to client")
 		}
 		return
 	}
 
-	// Create prefiller request. Set max_tokens to 1.
+	// Create prefiller request
 
 	ctx := r.Context()
 	preq := r.Clone(ctx)
 
-	completionRequest[requestFieldMaxTokens] = 1
-	completionRequest[requestFieldMaxCompletionTokens] = 1
+	// the decode request is the original request
+	s.stripPrefillFields(completionRequest)
+	s.applyPrefillOverrides(completionRequest, ConnectorLMCache)
 
-	pbody, err := json.Marshal(completionRequest)
+	if !s.prePrefill(w, preq, completionRequest) {
+		return
+	}
+
+	pbody, err := s.newRequestBody(completionRequest, len(original))
 	if err != nil {
 		if err := errorJSONInvalid(err, w); err != nil {
 			s.logger.Error(err, "failed to send error response to client")
 		}
 		return
 	}
-	preq.Body = io.NopCloser(strings.NewReader(string(pbody)))
-	preq.ContentLength = int64(len(pbody))
+	defer pbody.release()
+	setRequestBody(preq, pbody.body(), pbody.Len())
+	s.authenticatePrefill(preq, pbody)
 
 	// Forward request to prefiller
 
@@ -72,17 +79,28 @@ func (s *Server) runLMCacheProtocol(w http.ResponseWriter, r *http.Request, pref
 		return
 	}
 
-	pw := &bufferedResponseWriter{}
-	prefillHandler.ServeHTTP(pw, preq)
+	s.inflight.setStage(ctx, stagePrefill)
+	pw, budgetExceeded := s.sendPrefillRequest(prefillHandler, preq)
+	defer putResponseWriter(pw)
+	if s.preempted(w, preq) {
+		return
+	}
+	if budgetExceeded {
+		s.runDecodeOnly(w, r, original)
+		return
+	}
 
 	if pw.statusCode < 200 || pw.statusCode >= 300 {
-		s.logger.Error(err, "request failed", "code", pw.statusCode)
-		w.WriteHeader(pw.statusCode)
+		s.prefillFailed(w, pw)
 		return
 	}
 
 	// Forward original request to local decoder
-
-	r.Body = io.NopCloser(strings.NewReader(string(original)))
-	s.decoderProxy.ServeHTTP(w, r)
+	dreq, dbody, ok := s.preDecodeBody(w, r, original)
+	if !ok {
+		return
+	}
+	s.inflight.setStage(ctx, stageDecode)
+	setRequestBody(dreq, io.NopCloser(bytes.NewReader(dbody)), len(dbody))
+	s.decoderProxy.ServeHTTP(w, dreq)
 }
@@ -17,10 +17,9 @@ limitations under the License.
 package proxy
 
 import (
-	"encoding/json"
 	"io"
+	"maps"
 	"net/http"
-	"strings"
 
 	"github.com/google/uuid"
 )
@@ -32,14 +31,16 @@ func (s *Server) runNIXLProtocolV1(w http.ResponseWriter, r *http.Request, prefi
 	defer r.Body.Close() //nolint:all
 	original, err := io.ReadAll(r.Body)
 	if err != nil {
-		w.WriteHeader(http.StatusBadRequest) // TODO: check FastAPI error code when failing to read body
-		w.Write([]byte(err.Error()))         //nolint:all
+		// TODO: check FastAPI error code when failing to read body
+		if err := errorStatus(http.StatusBadRequest, err.Error(), w); err != nil {
+			s.logger.Error(err, "failed to send error response to client")
+		}
 		return
 	}
 
 	// Parse completion request
-	var completionRequest map[string]any
-	if err := json.Unmarshal(original, &completionRequest); err != nil {
+	completionRequest, err := requestFields(r, original)
+	if err != nil {
 		if err := errorJSONInvalid(err, w); err != nil {
 			s.logger.Error(err, "failed to send error response to client")
 		}
@@ -70,16 +71,22 @@ func (s *Server) runNIXLProtocolV1(w http.ResponseWriter, r *http.Request, prefi
 	completionRequest[requestFieldDoRemoteDecode] = true
 	completionRequest[requestFieldStream] = false
 	delete(completionRequest, requestFieldStreamOptions)
+	stripped := s.stripPrefillFields(completionRequest)
+	s.applyPrefillOverrides(completionRequest, ConnectorNIXLV1)
 
-	pbody, err := json.Marshal(completionRequest)
+	if !s.prePrefill(w, preq, completionRequest) {
+		return
+	}
+	pbody, err := s.newRequestBody(completionRequest, len(original))
 	if err != nil {
 		if err := errorJSONInvalid(err, w); err != nil {
 			s.logger.Error(err, "failed to send error response to client")
 		}
 		return
 	}
-	preq.Body = io.NopCloser(strings.NewReader(string(pbody)))
-	preq.ContentLength = int64(len(pbody))
+	defer pbody.release()
+	setRequestBody(preq, pbody.body(), pbody.Len())
+	s.authenticatePrefill(preq, pbody)
 
 	prefillHandler, err := s.prefillerProxyHandler(prefillPodHostPort)
 	if err != nil {
@@ -90,22 +97,28 @@ func (s *Server) runNIXLProtocolV1(w http.ResponseWriter, r *http.Request, prefi
 	}
 
 	// 2. Forward request to prefiller
-	s.logger.V(5).Info("sending request to prefiller", "hostPort", prefillPodHostPort, "body", string(pbody))
-	pw := &bufferedResponseWriter{}
-	prefillHandler.ServeHTTP(pw, preq)
+	s.inflight.setStage(ctx, stagePrefill)
+	s.logger.V(5).Info("sending request to prefiller", "hostPort", prefillPodHostPort, "body", pbody)
+	pw, budgetExceeded := s.sendPrefillRequest(prefillHandler, preq)
+	defer putResponseWriter(pw)
+	if s.preempted(w, preq) {
+		return
+	}
+	if budgetExceeded {
+		s.runDecodeOnly(w, r, original)
+		return
+	}
 
 	if pw.statusCode < 200 || pw.statusCode >= 300 {
-		s.logger.Error(err, "request failed", "code", pw.statusCode)
-		w.WriteHeader(pw.statusCode)
+		s.prefillFailed(w, pw)
 		return
 	}
 
 	// Process response - extract p/d fields
-	var prefillerResponse map[string]any
-	if err := json.Unmarshal([]byte(pw.buffer.String()), &prefillerResponse); err != nil {
-		if err := errorJSONInvalid(err, w); err != nil {
-			s.logger.Error(err, "failed to send error response to client")
-		}
+	prefillerResponse, err := decodePrefillerResponse(pw.buffer.Bytes())
+	if err != nil {
+		s.logger.Error(err, "invalid prefiller response", "class", upstreamErrorProtocol)
+		s.failUpstream(w, upstreamPrefiller, upstreamErrorProtocol)
 		return
 	}
 
@@ -142,6 +155,8 @@ func (s *Server) runNIXLProtocolV1(w http.ResponseWriter, r *http.Request, prefi
 		requestFieldRemotePort, remotePort,
 	)
 
+	s.reportPrefillEngine(w, engineID)
+
 	// 2. Prepare decode request
 	dreq := r.Clone(ctx)
 
@@ -156,23 +171,29 @@ func (s *Server) runNIXLProtocolV1(w http.ResponseWriter, r *http.Request, prefi
 		completionRequest[requestFieldStreamOptions] = streamOptionsValue
 	}
 
+	maps.Copy(completionRequest, stripped)
 	completionRequest[requestFieldDoRemotePrefill] = true
 	completionRequest[requestFieldRemoteBlockIDs] = blockIDs
 	completionRequest[requestFieldRemoteEngineID] = engineID
 	completionRequest[requestFieldRemoteHost] = remoteHost
 	completionRequest[requestFieldRemotePort] = remotePort
 
-	dbody, err := json.Marshal(completionRequest)
+	if !s.preDecode(w, dreq, completionRequest) {
+		return
+	}
+
+	dbody, err := s.newRequestBody(completionRequest, len(original))
 	if err != nil {
 		if err := errorJSONInvalid(err, w); err != nil {
 			s.logger.Error(err, "failed to send error response to client")
 		}
 		return
 	}
-	dreq.Body = io.NopCloser(strings.NewReader(string(dbody)))
-	dreq.ContentLength = int64(len(dbody))
+	defer dbody.release()
+	setRequestBody(dreq, dbody.body(), dbody.Len())
 
 	// 3. Forward to local decoder.
-	s.logger.V(5).Info("sending request to decoder", "body", string(dbody))
+	s.inflight.setStage(ctx, stageDecode)
+	s.logger.V(5).Info("sending request to decoder", "body", dbody)
 	s.decoderProxy.ServeHTTP(w, dreq)
 }
@@ -17,12 +17,13 @@ limitations under the License.
 package proxy
 
 import (
-	"encoding/json"
 	"io"
+	"maps"
 	"net/http"
-	"strings"
 
 	"github.com/google/uuid"
+
+	"github.com/llm-d/llm-d-routing-sidecar/internal/metrics"
 )
 
 func (s *Server) runNIXLProtocolV2(w http.ResponseWriter, r *http.Request, prefillPodHostPort string) {
@@ -32,14 +33,16 @@ func (s *Server) runNIXLProtocolV2(w http.ResponseWriter, r *http.Request, prefi
 	defer r.Body.Close() //nolint:all
 	original, err := io.ReadAll(r.Body)
 	if err != nil {
-		w.WriteHeader(http.StatusBadRequest) // TODO: check FastAPI error code when failing to read body
-		w.Write([]byte(err.Error()))         //nolint:all
+		// TODO: check FastAPI error code when failing to read body
+		if err := errorStatus(http.StatusBadRequest, err.Error(), w); err != nil {
+			s.logger.Error(err, "failed to send error response to client")
+		}
 		return
 	}
 
 	// Parse completion request
-	var completionRequest map[string]any
-	if err := json.Unmarshal(original, &completionRequest); err != nil {
+	completionRequest, err := requestFields(r, original)
+	if err != nil {
 		if err := errorJSONInvalid(err, w); err != nil {
 			s.logger.Error(err, "failed to send error response to client")
 		}
@@ -80,55 +83,75 @@ func (s *Server) runNIXLProtocolV2(w http.ResponseWriter, r *http.Request, prefi
 
 	completionRequest[requestFieldStream] = false
 	delete(completionRequest, requestFieldStreamOptions)
-	completionRequest[requestFieldMaxTokens] = 1
-	completionRequest[requestFieldMaxCompletionTokens] = 1
+	stripped := s.stripPrefillFields(completionRequest)
+	s.applyPrefillOverrides(completionRequest, ConnectorNIXLV2)
 
-	pbody, err := json.Marshal(completionRequest)
-	if err != nil {
-		if err := errorJSONInvalid(err, w); err != nil {
-			s.logger.Error(err, "failed to send error response to client")
+	// 2. Forward request to prefiller, unless an identical request was recently prefilled there
+	cacheKey, pKVTransferParams, ok := s.lookupPrefill(prefillPodHostPort, original)
+	if !ok {
+		if !s.prePrefill(w, preq, completionRequest) {
+			return
 		}
-		return
-	}
-	preq.Body = io.NopCloser(strings.NewReader(string(pbody)))
-	preq.ContentLength = int64(len(pbody))
-
-	prefillHandler, err := s.prefillerProxyHandler(prefillPodHostPort)
-	if err != nil {
-		if err := errorBadGateway(err, w); err != nil {
-			s.logger.Error(err, "failed to send error response to client")
+		pbody, err := s.newRequestBody(completionRequest, len(original))
+		if err != nil {
+			if err := errorJSONInvalid(err, w); err != nil {
+				s.logger.Error(err, "failed to send error response to client")
+			}
+			return
+		}
+		defer pbody.release()
+		setRequestBody(preq, pbody.body(), pbody.Len())
+		s.authenticatePrefill(preq, pbody)
+
+		prefillHandler, err := s.prefillerProxyHandler(prefillPodHostPort)
+		if err != nil {
+			if err := errorBadGateway(err, w); err != nil {
+				s.logger.Error(err, "failed to send error response to client")
+			}
+			return
 		}
-		return
-	}
 
-	// 2. Forward request to prefiller
-	s.logger.V(5).Info("sending request to prefiller", "url", prefillPodHostPort, "body", string(pbody))
-	pw := &bufferedResponseWriter{}
-	prefillHandler.ServeHTTP(pw, preq)
+		s.inflight.setStage(ctx, stagePrefill)
+		s.logger.V(5).Info("sending request to prefiller", "url", prefillPodHostPort, "body", pbody)
+		pw, budgetExceeded := s.sendPrefillRequest(prefillHandler, preq)
+		defer putResponseWriter(pw)
+		if s.preempted(w, preq) {
+			return
+		}
+		if budgetExceeded {
+			s.runDecodeOnly(w, r, original)
+			return
+		}
 
-	if pw.statusCode < 200 || pw.statusCode >= 300 {
-		s.logger.Error(err, "request failed", "code", pw.statusCode)
-		w.WriteHeader(pw.statusCode)
-		return
-	}
+		if pw.statusCode < 200 || pw.statusCode >= 300 {
+			s.prefillFailed(w, pw)
+			return
+		}
 
-	// Process response - extract p/d fields
-	var prefillerResponse map[string]any
-	if err := json.Unmarshal([]byte(pw.buffer.String()), &prefillerResponse); err != nil {
-		if err := errorJSONInvalid(err, w); err != nil {
-			s.logger.Error(err, "failed to send error response to client")
+		// Process response - extract p/d fields
+		prefillerResponse, err := decodePrefillerResponse(pw.buffer.Bytes())
+		if err != nil {
+			s.logger.Error(err, "invalid prefiller response", "class", upstreamErrorProtocol)
+			s.failUpstream(w, upstreamPrefiller, upstreamErrorProtocol)
+			return
 		}
-		return
-	}
 
-	// 3. Verify response
+		// Verify response
 
-	pKVTransferParams, ok := prefillerResponse[requestFieldKVTransferParams]
-	if !ok {
-		s.logger.Info("warning: missing 'kv_transfer_params' field in prefiller response")
-	}
+		pKVTransferParams, ok = prefillerResponse[requestFieldKVTransferParams]
+		if !ok {
+			// the decoder then runs the prefill again
+			s.logger.Info("warning: missing 'kv_transfer_params' field in prefiller response", "class", upstreamErrorKVTransfer)
+			metrics.RecordUpstreamError(s.rank(), upstreamPrefiller, upstreamErrorKVTransfer)
+		} else {
+			s.storePrefill(cacheKey, prefillPodHostPort, pKVTransferParams)
+		}
 
-	s.logger.V(5).Info("received prefiller response", requestFieldKVTransferParams, pKVTransferParams)
+		s.logger.V(5).Info("received prefiller response", requestFieldKVTransferParams, pKVTransferParams)
+	}
+	if params, ok := pKVTransferParams.(map[string]any); ok {
+		s.reportPrefillEngine(w, params[requestFieldRemoteEngineID])
+	}
 
 	// Decode Stage
 
@@ -152,20 +175,40 @@ func (s *Server) runNIXLProtocolV2(w http.ResponseWriter, r *http.Request, prefi
 	if maxCompletionTokensOk {
 		completionRequest[requestFieldMaxCompletionTokens] = maxCompletionTokensValue
 	}
+	maps.Copy(completionRequest, stripped)
 	completionRequest[requestFieldKVTransferParams] = pKVTransferParams
 
-	dbody, err := json.Marshal(completionRequest)
+	if !s.preDecode(w, dreq, completionRequest) {
+		return
+	}
+
+	dbody, err := s.newRequestBody(completionRequest, len(original))
 	if err != nil {
 		if err := errorJSONInvalid(err, w); err != nil {
 			s.logger.Error(err, "failed to send error response to client")
 		}
 		return
 	}
-	dreq.Body = io.NopCloser(strings.NewReader(string(dbody)))
-	dreq.ContentLength = int64(len(dbody))
+	defer dbody.release()
+	setRequestBody(dreq, dbody.body(), dbody.Len())
 
 	// 2. Forward to local decoder.
-
-	s.logger.V(5).Info("sending request to decoder", "body", string(dbody))
-	s.decoderProxy.ServeHTTP(w, dreq)
+	s.inflight.setStage(ctx, stageDecode)
+	s.logger.V(5).Info("sending request to decoder", "body", dbody)
+	// The error responses are held back to detect the failures to pull the KV blocks
+	hw := newHeldErrorWriter(w)
+	s.decoderProxy.ServeHTTP(hw, dreq)
+	if cacheKey != "" && hw.statusCode >= http.StatusBadRequest {
+		// The cached prefill is useless when the decoder fails to pull the blocks
+		s.prefillCache.remove(cacheKey)
+	}
+	if hw.kvTransferFailed() {
+		s.logger.Info("Warning: decoder failed to pull the KV blocks", "class", upstreamErrorKVTransfer,
+			"code", hw.statusCode, "prefiller", prefillPodHostPort)
+		metrics.RecordUpstreamError(s.rank(), upstreamDecoder, upstreamErrorKVTransfer)
+		if s.retryKVTransfer(w, r, original, prefillPodHostPort) {
+			return
+		}
+	}
+	hw.release()
 }
@@ -19,6 +19,7 @@ package proxy
 import (
 	"context"
 	"io"
+	"net"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
@@ -80,8 +81,8 @@ var _ = Describe("NIXL Connector (v2)", func() {
 		}()
 
 		time.Sleep(1 * time.Second)
-		Expect(proxy.addr).ToNot(BeNil())
-		proxyBaseAddr := "http://" + proxy.addr.String()
+		Expect(proxy.Addr()).ToNot(BeNil())
+		proxyBaseAddr := "http://" + proxy.Addr().String()
 
 		By("sending a /v1/chat/completions request with prefill header")
 		body := `{
@@ -142,8 +143,8 @@ var _ = Describe("NIXL Connector (v2)", func() {
 		}()
 
 		time.Sleep(1 * time.Second)
-		Expect(proxy.addr).ToNot(BeNil())
-		proxyBaseAddr := "http://" + proxy.addr.String()
+		Expect(proxy.Addr()).ToNot(BeNil())
+		proxyBaseAddr := "http://" + proxy.Addr().String()
 
 		By("sending a /v1/chat/completions request with prefill header")
 		body := `{
@@ -193,4 +194,99 @@ var _ = Describe("NIXL Connector (v2)", func() {
 		Expect(decodeHandler.RequestCount.Load()).To(BeNumerically("==", 1))
 		Expect(decodeHandler.CompletionRequests).To(HaveLen(1))
 	})
+
+	It("should strip the client-only fields from the prefill request only", func() {
+		proxy.config.PrefillStripFields = DefaultPrefillStripFields
+
+		By("starting the proxy")
+		go func() {
+			defer GinkgoRecover()
+
+			err := proxy.Start(ctx)
+			Expect(err).ToNot(HaveOccurred())
+		}()
+		Eventually(func() net.Addr { return proxy.Addr() }).ShouldNot(BeNil())
+
+		body := `{
+				"model": "Qwen/Qwen2-0.5B",
+				"messages": [
+				  {"role": "user", "content": "Hello"}
+				],
+				"max_tokens": 50,
+				"logit_bias": {"50256": -100},
+				"user": "alice",
+				"temperature": 0.5
+			}`
+		req, err := http.NewRequest(http.MethodPost, "http://"+proxy.Addr().String()+ChatCompletionsPath, strings.NewReader(body))
+		Expect(err).ToNot(HaveOccurred())
+		req.Header.Add(requestHeaderPrefillHostPort, prefillBackend.URL[len("http://"):])
+
+		rp, err := http.DefaultClient.Do(req)
+		Expect(err).ToNot(HaveOccurred())
+		rp.Body.Close() //nolint:all
+		Expect(rp.StatusCode).To(Equal(http.StatusOK))
+
+		Expect(prefillHandler.CompletionRequests).To(HaveLen(1))
+		prq := prefillHandler.CompletionRequests[0]
+		Expect(prq).ToNot(HaveKey("logit_bias"))
+		Expect(prq).ToNot(HaveKey("user"))
+		Expect(prq).To(HaveKeyWithValue("temperature", 0.5))
+		Expect(prq).To(HaveKeyWithValue("max_tokens", BeNumerically("==", 1)))
+
+		Expect(decodeHandler.CompletionRequests).To(HaveLen(1))
+		drq := decodeHandler.CompletionRequests[0]
+		Expect(drq).To(HaveKeyWithValue("logit_bias", map[string]any{"50256": float64(-100)}))
+		Expect(drq).To(HaveKeyWithValue("user", "alice"))
+		Expect(drq).To(HaveKeyWithValue("max_tokens", BeNumerically("==", 50)))
+	})
+
+	It("should send the rewritten bodies of a chunked request with their Content-Length", func() {
+		// The upstreams are behind an ingress rejecting the chunked requests
+		lengths := make(chan int64, 2)
+		strict := func(next http.Handler) http.Handler {
+			return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if len(r.TransferEncoding) > 0 || r.ContentLength < 0 {
+					w.WriteHeader(http.StatusLengthRequired)
+					return
+				}
+				lengths <- r.ContentLength
+				next.ServeHTTP(w, r)
+			})
+		}
+		strictPrefill := httptest.NewServer(strict(prefillHandler))
+		DeferCleanup(strictPrefill.Close)
+		strictDecode := httptest.NewServer(strict(decodeHandler))
+		DeferCleanup(strictDecode.Close)
+
+		url, err := url.Parse(strictDecode.URL)
+		Expect(err).ToNot(HaveOccurred())
+		proxy, err = NewProxy("0", url, Config{Connector: ConnectorNIXLV2})
+		Expect(err).ToNot(HaveOccurred())
+
+		By("starting the proxy")
+		go func() {
+			defer GinkgoRecover()
+
+			err := proxy.Start(ctx)
+			Expect(err).ToNot(HaveOccurred())
+		}()
+		Eventually(func() net.Addr { return proxy.Addr() }).ShouldNot(BeNil())
+
+		body := `{"model": "Qwen/Qwen2-0.5B", "messages": [{"role": "user", "content": "Hello"}], "max_tokens": 50}`
+		req, err := http.NewRequest(http.MethodPost, "http://"+proxy.Addr().String()+ChatCompletionsPath, io.MultiReader(strings.NewReader(body)))
+		Expect(err).ToNot(HaveOccurred())
+		req.TransferEncoding = []string{"chunked"}
+		req.Header.Add(requestHeaderPrefillHostPort, strictPrefill.URL[len("http://"):])
+
+		rp, err := http.DefaultClient.Do(req)
+		Expect(err).ToNot(HaveOccurred())
+		rp.Body.Close() //nolint:all
+		Expect(rp.StatusCode).To(Equal(http.StatusOK))
+
+		Expect(prefillHandler.CompletionRequests).To(HaveLen(1))
+		Expect(decodeHandler.CompletionRequests).To(HaveLen(1))
+		Expect(lengths).To(HaveLen(2))
+		Expect(<-lengths).To(BeNumerically(">", len(body)-10)) // the prefill request, with its overrides
+		Expect(<-lengths).To(BeNumerically(">", len(body)))    // the decode request, with the KV transfer parameters
+	})
 })
@@ -0,0 +1,95 @@
+/*
+Copyright 2025 The llm-d Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package proxy
+
+import (
+	"context"
+	"net/http"
+	"time"
+)
+
+const (
+	decoderProbeMinInterval = 250 * time.Millisecond
+	decoderProbeMaxInterval = 5 * time.Second
+	decoderGateRetryAfter   = "1"
+)
+
+// tracksDecoderHealth reports whether the local decoder refusing connections is marked down
+func (s *Server) tracksDecoderHealth() bool {
+	return s.config.DataParallelFailover || s.config.DecoderHealthGating
+}
+
+// markDecoderDown fails over or turns away the traffic until the local decoder is healthy
+// again, probed with exponential backoff. It reports whether the decoder was up.
+func (s *Server) markDecoderDown() bool {
+	if !s.decoderDown.CompareAndSwap(false, true) {
+		return false
+	}
+	if s.config.DataParallelFailover {
+		s.logger.Info("local decoder down, failing over to sibling ranks")
+	} else {
+		s.logger.Info("local decoder down, rejecting requests until it is healthy")
+	}
+	if s.prefixIndex != nil {
+		s.prefixIndex.purge()
+	}
+
+	go func() {
+		interval := decoderProbeMinInterval
+		for {
+			time.Sleep(interval)
+			if s.Health(context.Background()).Healthy {
+				s.decoderDown.Store(false)
+				s.logger.Info("local decoder recovered")
+				return
+			}
+			interval = min(2*interval, decoderProbeMaxInterval)
+		}
+	}()
+	return true
+}
+
+// decoderGated reports whether the requests are turned away because the local decoder is down,
+// and no sibling rank can take over its traffic
+func (s *Server) decoderGated() bool {
+	if !s.config.DecoderHealthGating || !s.decoderDown.Load() {
+		return false
+	}
+	return !s.config.DataParallelFailover || s.healthySibling() == nil
+}
+
+// healthGate turns away the requests with 503 while the decoder is gated, rather than
+// forwarding them to an engine not listening yet. The proxy health reports it as not ready.
+func (s *Server) healthGate(mux *http.ServeMux, next http.Handler) http.Handler {
+	if !s.config.DecoderHealthGating {
+		return next
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !s.decoderGated() || r.URL.Path == "/health" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		// label the request metrics with the route, as if served
+		_, r.Pattern = mux.Handler(r)
+		w.Header().Set("Retry-After", decoderGateRetryAfter)
+		if err := errorServiceUnavailable("the engine is not ready", w); err != nil {
+			s.logger.Error(err, "failed to send error response to client")
+		}
+	})
+}
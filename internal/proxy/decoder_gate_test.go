@@ -0,0 +1,105 @@
+/*
+Copyright 2025 The llm-d Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package proxy
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/llm-d/llm-d-routing-sidecar/test/mock"
+	. "github.com/onsi/ginkgo/v2" // nolint:revive
+	. "github.com/onsi/gomega"    // nolint:revive
+	"k8s.io/klog/v2/ktesting"
+)
+
+var _ = Describe("Decoder health gating", func() {
+	It("should turn requests away until the decoder is healthy", func() {
+		_, ctx := ktesting.NewTestContext(GinkgoT())
+		ctx, cancelFn := context.WithCancel(ctx)
+		defer cancelFn()
+
+		// Nothing is listening on the decoder port yet
+		decoderListener, err := net.Listen("tcp", "127.0.0.1:0")
+		Expect(err).ToNot(HaveOccurred())
+		decoderAddr := decoderListener.Addr().String()
+		Expect(decoderListener.Close()).To(Succeed())
+
+		decodeURL, err := url.Parse("http://" + decoderAddr)
+		Expect(err).ToNot(HaveOccurred())
+		proxy, err := NewProxy("0", decodeURL, Config{Connector: ConnectorNIXLV2, DecoderHealthGating: true})
+		Expect(err).ToNot(HaveOccurred())
+		go func() {
+			defer GinkgoRecover()
+			Expect(proxy.Start(ctx)).To(Succeed())
+		}()
+		Eventually(func() net.Addr { return proxy.Addr() }).ShouldNot(BeNil())
+		proxyURL := "http://" + proxy.Addr().String()
+
+		status := func(method string, path string) int {
+			req, err := http.NewRequest(method, proxyURL+path, strings.NewReader(`{"model": "m", "prompt": "Hello"}`))
+			Expect(err).ToNot(HaveOccurred())
+			resp, err := http.DefaultClient.Do(req)
+			Expect(err).ToNot(HaveOccurred())
+			resp.Body.Close() //nolint:all
+			return resp.StatusCode
+		}
+
+		By("rejecting the requests and reporting not ready")
+		Expect(status(http.MethodPost, CompletionsPath)).To(Equal(http.StatusServiceUnavailable))
+		Expect(status(http.MethodGet, "/v1/models")).To(Equal(http.StatusServiceUnavailable))
+		Expect(status(http.MethodGet, "/health")).To(Equal(http.StatusServiceUnavailable))
+
+		By("serving the requests once the decoder listens")
+		decoderHandler := &mock.GenericHandler{}
+		decoderListener, err = net.Listen("tcp", decoderAddr)
+		Expect(err).ToNot(HaveOccurred())
+		decoder := httptest.NewUnstartedServer(decoderHandler)
+		decoder.Listener = decoderListener
+		decoder.Start()
+		DeferCleanup(decoder.Close)
+
+		Eventually(func() int { return status(http.MethodGet, "/health") }).
+			WithTimeout(10 * time.Second).Should(Equal(http.StatusOK))
+		Expect(status(http.MethodGet, "/v1/models")).To(Equal(http.StatusOK))
+	})
+
+	It("should let the traffic fail over to a healthy sibling rank", func() {
+		s := &Server{
+			config:      Config{DecoderHealthGating: true},
+			decoderDown: new(atomic.Bool),
+			logger:      logr.Discard(),
+		}
+		Expect(s.decoderGated()).To(BeFalse())
+
+		s.decoderDown.Store(true)
+		Expect(s.decoderGated()).To(BeTrue())
+
+		s.config.DataParallelFailover = true
+		s.siblings = []*Server{{decoderDown: new(atomic.Bool)}}
+		Expect(s.decoderGated()).To(BeFalse())
+
+		s.siblings[0].decoderDown.Store(true)
+		Expect(s.decoderGated()).To(BeTrue())
+	})
+})
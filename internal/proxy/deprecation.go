@@ -0,0 +1,94 @@
+/*
+Copyright 2025 The llm-d Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package proxy
+
+import (
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/llm-d/llm-d-routing-sidecar/internal/metrics"
+)
+
+// deprecationWarningInterval is the minimum interval between two warnings of a deprecated feature
+const deprecationWarningInterval = time.Minute
+
+// deprecatedFeatures are the replacements of the deprecated headers and connectors
+var deprecatedFeatures = map[string]string{
+	requestHeaderPrefillURL: requestHeaderPrefillHostPort + " header",
+	ConnectorNIXLV1:         ConnectorNIXLV2 + " connector",
+	ConnectorLMCache:        ConnectorNIXLV2 + " connector",
+}
+
+// deprecationTracker rate limits the warnings of the deprecated features used by the requests
+type deprecationTracker struct {
+	mu         sync.Mutex
+	warned     map[string]time.Time // the last warning, by feature
+	suppressed map[string]int       // the uses since the last warning, by feature
+}
+
+func newDeprecationTracker() *deprecationTracker {
+	return &deprecationTracker{
+		warned:     map[string]time.Time{},
+		suppressed: map[string]int{},
+	}
+}
+
+// warn returns whether a use of the feature is warned about, and the uses not warned about since
+// the previous warning
+func (t *deprecationTracker) warn(feature string, now time.Time) (bool, int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if last, ok := t.warned[feature]; ok && now.Sub(last) < deprecationWarningInterval {
+		t.suppressed[feature]++
+		return false, 0
+	}
+	suppressed := t.suppressed[feature]
+	t.warned[feature] = now
+	t.suppressed[feature] = 0
+	return true, suppressed
+}
+
+// recordDeprecated records a request using a deprecated header or connector, and warns about it
+// with the identity of the caller at most once per interval
+func (s *Server) recordDeprecated(r *http.Request, feature string) {
+	metrics.RecordDeprecatedUse(s.rank(), feature)
+	warn, suppressed := s.deprecations.warn(feature, time.Now())
+	if !warn {
+		return
+	}
+	clientIP, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		clientIP = r.RemoteAddr
+	}
+	s.logger.Info("Warning: deprecated feature used, it will be removed in a future release",
+		"feature", feature,
+		"replacement", deprecatedFeatures[feature],
+		"clientIP", clientIP,
+		"forwardedFor", r.Header.Get("X-Forwarded-For"),
+		"identity", peerIdentity(r),
+		"userAgent", r.Header.Get("User-Agent"),
+		"suppressed", suppressed)
+}
+
+// recordDeprecatedConnector records a request following a deprecated connector
+func (s *Server) recordDeprecatedConnector(r *http.Request, connector string) {
+	if _, ok := deprecatedFeatures[connector]; ok {
+		s.recordDeprecated(r, connector)
+	}
+}
@@ -0,0 +1,85 @@
+/*
+Copyright 2025 The llm-d Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	"github.com/go-logr/logr"
+	. "github.com/onsi/ginkgo/v2" // nolint:revive
+	. "github.com/onsi/gomega"    // nolint:revive
+
+	"github.com/llm-d/llm-d-routing-sidecar/internal/metrics"
+)
+
+var _ = Describe("Deprecation telemetry", func() {
+	It("should warn about a deprecated feature at most once per interval", func() {
+		t := newDeprecationTracker()
+		now := time.Now()
+
+		warn, suppressed := t.warn(requestHeaderPrefillURL, now)
+		Expect(warn).To(BeTrue())
+		Expect(suppressed).To(BeZero())
+
+		warn, _ = t.warn(requestHeaderPrefillURL, now.Add(time.Second))
+		Expect(warn).To(BeFalse())
+		warn, _ = t.warn(requestHeaderPrefillURL, now.Add(2*time.Second))
+		Expect(warn).To(BeFalse())
+
+		// the other features are warned about independently
+		warn, _ = t.warn(ConnectorLMCache, now.Add(2*time.Second))
+		Expect(warn).To(BeTrue())
+
+		warn, suppressed = t.warn(requestHeaderPrefillURL, now.Add(deprecationWarningInterval))
+		Expect(warn).To(BeTrue())
+		Expect(suppressed).To(Equal(2))
+	})
+
+	It("should count the requests using deprecated features", func() {
+		s := &Server{
+			config:       Config{DataParallelRank: 45},
+			deprecations: newDeprecationTracker(),
+			logger:       logr.Discard(),
+		}
+		r := httptest.NewRequest(http.MethodPost, ChatCompletionsPath, nil)
+		s.recordDeprecated(r, requestHeaderPrefillURL)
+		s.recordDeprecated(r, requestHeaderPrefillURL)
+		s.recordDeprecatedConnector(r, ConnectorNIXLV1)
+		s.recordDeprecatedConnector(r, ConnectorNIXLV2)
+
+		counts := map[string]float64{}
+		families, err := metrics.Registry.Gather()
+		Expect(err).ToNot(HaveOccurred())
+		for _, family := range families {
+			if family.GetName() != "llm_d_routing_sidecar_deprecated_uses_total" {
+				continue
+			}
+			for _, metric := range family.Metric {
+				labels := map[string]string{}
+				for _, label := range metric.Label {
+					labels[label.GetName()] = label.GetValue()
+				}
+				if labels[metrics.RankLabel] == "45" {
+					counts[labels["feature"]] = metric.GetCounter().GetValue()
+				}
+			}
+		}
+		Expect(counts).To(Equal(map[string]float64{requestHeaderPrefillURL: 2, ConnectorNIXLV1: 1}))
+	})
+})
@@ -0,0 +1,81 @@
+/*
+Copyright 2025 The llm-d Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package proxy
+
+import (
+	"net/http"
+	"net/url"
+	"strconv"
+)
+
+// The response headers attributing a response to the engines which produced it, with
+// EngineResponseHeaders
+const (
+	responseHeaderDecodePod       = "x-llm-d-decode-pod"
+	responseHeaderDecodePool      = "x-llm-d-decode-pool"
+	responseHeaderDecodeRank      = "x-llm-d-decode-rank"
+	responseHeaderDecodeTarget    = "x-llm-d-decode-target"
+	responseHeaderPrefiller       = "x-llm-d-prefiller"
+	responseHeaderPrefillEngineID = "x-llm-d-prefill-engine-id"
+)
+
+// engineResponses reports the decode engine in the headers of its responses, before modify, if
+// any. The responses of a sibling rank taking over the traffic report the sibling rank.
+func (s *Server) engineResponses(target *url.URL, modify func(*http.Response) error) func(*http.Response) error {
+	if !s.config.EngineResponseHeaders {
+		return modify
+	}
+
+	decodeTarget := ""
+	if s.config.CanaryDecoderPort != "" {
+		decodeTarget = decodeTargetStable
+		if target != s.decoderURL {
+			decodeTarget = decodeTargetCanary
+		}
+	}
+	return func(res *http.Response) error {
+		if s.config.Identity.Pod != "" {
+			res.Header.Set(responseHeaderDecodePod, s.config.Identity.Pod)
+		}
+		if s.config.Pool != "" {
+			res.Header.Set(responseHeaderDecodePool, s.config.Pool)
+		}
+		res.Header.Set(responseHeaderDecodeRank, strconv.Itoa(s.config.DataParallelRank))
+		if decodeTarget != "" {
+			res.Header.Set(responseHeaderDecodeTarget, decodeTarget)
+		}
+		if modify != nil {
+			return modify(res)
+		}
+		return nil
+	}
+}
+
+// reportPrefiller reports the prefiller of a disaggregated request in the response headers
+func (s *Server) reportPrefiller(w http.ResponseWriter, prefiller string) {
+	if s.config.EngineResponseHeaders {
+		w.Header().Set(responseHeaderPrefiller, prefiller)
+	}
+}
+
+// reportPrefillEngine reports the engine ID found in the KV transfer parameters of the
+// prefiller response in the response headers
+func (s *Server) reportPrefillEngine(w http.ResponseWriter, engineID any) {
+	if id, ok := engineID.(string); ok && id != "" && s.config.EngineResponseHeaders {
+		w.Header().Set(responseHeaderPrefillEngineID, id)
+	}
+}
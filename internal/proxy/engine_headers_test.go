@@ -0,0 +1,125 @@
+/*
+Copyright 2025 The llm-d Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package proxy
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/llm-d/llm-d-routing-sidecar/internal/identity"
+	"github.com/llm-d/llm-d-routing-sidecar/test/mock"
+	. "github.com/onsi/ginkgo/v2" // nolint:revive
+	. "github.com/onsi/gomega"    // nolint:revive
+	"k8s.io/klog/v2/ktesting"
+)
+
+var _ = Describe("Engine response headers", func() {
+	It("should report the decode engine of the responses", func() {
+		engine := func() *url.URL {
+			engine := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+				w.WriteHeader(http.StatusOK)
+			}))
+			DeferCleanup(engine.Close)
+			engineURL, err := url.Parse(engine.URL)
+			Expect(err).ToNot(HaveOccurred())
+			return engineURL
+		}
+		decoderURL := engine()
+
+		s := &Server{
+			decoderURL: decoderURL,
+			config: Config{
+				EngineResponseHeaders: true,
+				Identity:              identity.Identity{Pod: "decode-0"},
+				Pool:                  "pool-b",
+				DataParallelRank:      3,
+				CanaryDecoderPort:     engine().Port(),
+			},
+			logger: logr.Discard(),
+		}
+		handler := s.canaryHandler(s.createDecoderProxy(s.decoderURL))
+
+		send := func() http.Header {
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, ChatCompletionsPath, nil))
+			Expect(rec.Code).To(Equal(http.StatusOK))
+			return rec.Header()
+		}
+
+		header := send()
+		Expect(header.Get(responseHeaderDecodePod)).To(Equal("decode-0"))
+		Expect(header.Get(responseHeaderDecodePool)).To(Equal("pool-b"))
+		Expect(header.Get(responseHeaderDecodeRank)).To(Equal("3"))
+		Expect(header.Get(responseHeaderDecodeTarget)).To(Equal(decodeTargetStable))
+
+		s.config.CanaryWeight = 100
+		Expect(send().Get(responseHeaderDecodeTarget)).To(Equal(decodeTargetCanary))
+	})
+
+	DescribeTable("should report the prefiller of the disaggregated requests",
+		func(enabled bool) {
+			_, ctx := ktesting.NewTestContext(GinkgoT())
+			ctx, cancelFn := context.WithCancel(ctx)
+			DeferCleanup(cancelFn)
+
+			decodeBackend := httptest.NewServer(&mock.ChatCompletionHandler{Connector: ConnectorNIXLV2, Role: mock.RoleDecode})
+			DeferCleanup(decodeBackend.Close)
+			prefillBackend := httptest.NewServer(&mock.ChatCompletionHandler{Connector: ConnectorNIXLV2, Role: mock.RolePrefill})
+			DeferCleanup(prefillBackend.Close)
+			prefillHost := prefillBackend.URL[len("http://"):]
+
+			decodeURL, err := url.Parse(decodeBackend.URL)
+			Expect(err).ToNot(HaveOccurred())
+			proxy, err := NewProxy("0", decodeURL, Config{Connector: ConnectorNIXLV2, EngineResponseHeaders: enabled})
+			Expect(err).ToNot(HaveOccurred())
+			go func() {
+				defer GinkgoRecover()
+				Expect(proxy.Start(ctx)).To(Succeed())
+			}()
+			time.Sleep(1 * time.Second)
+			Expect(proxy.Addr()).ToNot(BeNil())
+
+			body := `{"model": "Qwen/Qwen2-0.5B", "messages": [{"role": "user", "content": "Hello"}]}`
+			req, err := http.NewRequest(http.MethodPost, "http://"+proxy.Addr().String()+ChatCompletionsPath, strings.NewReader(body))
+			Expect(err).ToNot(HaveOccurred())
+			req.Header.Set(requestHeaderPrefillHostPort, prefillHost)
+			resp, err := http.DefaultClient.Do(req)
+			Expect(err).ToNot(HaveOccurred())
+			resp.Body.Close() //nolint:all
+			Expect(resp.StatusCode).To(Equal(http.StatusOK))
+
+			if !enabled {
+				Expect(resp.Header.Values(responseHeaderPrefiller)).To(BeEmpty())
+				Expect(resp.Header.Values(responseHeaderPrefillEngineID)).To(BeEmpty())
+				Expect(resp.Header.Values(responseHeaderDecodeRank)).To(BeEmpty())
+				return
+			}
+			Expect(resp.Header.Get(responseHeaderPrefiller)).To(Equal(prefillHost))
+			Expect(resp.Header.Get(responseHeaderPrefillEngineID)).To(Equal("5b5fb28f-3f30-4bdd-9a36-958d52459200"))
+			Expect(resp.Header.Get(responseHeaderDecodeRank)).To(Equal("0"))
+			Expect(resp.Header.Values(responseHeaderDecodePod)).To(BeEmpty())
+			Expect(resp.Header.Values(responseHeaderDecodeTarget)).To(BeEmpty())
+		},
+		Entry("enabled", true),
+		Entry("disabled", false),
+	)
+})
@@ -19,6 +19,7 @@ package proxy
 import (
 	"encoding/json"
 	"net/http"
+	"strings"
 )
 
 // vLLM error response
@@ -28,6 +29,24 @@ type errorResponse struct {
 	Type    string `json:"type"`
 	Param   string `json:"param"`
 	Code    int    `json:"code"`
+	Class   string `json:"class,omitempty"` // class of the upstream error, if any
+
+	// RequestID references the request in bug reports, if any
+	RequestID string `json:"request_id,omitempty"`
+}
+
+// writeError sends an error response, with the reference of the request if any
+func writeError(er errorResponse, w http.ResponseWriter) error {
+	er.RequestID = w.Header().Get(responseHeaderRequestID)
+	b, err := json.Marshal(er)
+	if err != nil {
+		return err
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(er.Code)
+	_, err = w.Write(b)
+	return err
 }
 
 func errorJSONInvalid(err error, w http.ResponseWriter) error {
@@ -49,14 +68,7 @@ func errorJSONInvalid(err error, w http.ResponseWriter) error {
 		Code:    http.StatusBadRequest,
 	}
 
-	b, err := json.Marshal(er)
-	if err != nil {
-		return err
-	}
-
-	w.WriteHeader(http.StatusBadRequest)
-	_, err = w.Write(b)
-	return err
+	return writeError(er, w)
 }
 
 func errorBadGateway(err error, w http.ResponseWriter) error {
@@ -67,12 +79,77 @@ func errorBadGateway(err error, w http.ResponseWriter) error {
 		Code:    http.StatusBadGateway,
 	}
 
-	b, err := json.Marshal(er)
-	if err != nil {
-		return err
+	return writeError(er, w)
+}
+
+func errorValidation(verr *validationError, w http.ResponseWriter) error {
+	er := errorResponse{
+		Object:  "error",
+		Message: verr.message,
+		Type:    "BadRequestError",
+		Param:   verr.param,
+		Code:    http.StatusBadRequest,
 	}
 
-	w.WriteHeader(http.StatusBadGateway)
-	_, err = w.Write(b)
-	return err
+	return writeError(er, w)
+}
+
+func errorRequestTooLarge(err error, w http.ResponseWriter) error {
+	er := errorResponse{
+		Object:  "error",
+		Message: err.Error(),
+		Type:    "RequestEntityTooLarge",
+		Code:    http.StatusRequestEntityTooLarge,
+	}
+
+	return writeError(er, w)
+}
+
+func errorUnauthorized(w http.ResponseWriter) error {
+	er := errorResponse{
+		Object:  "error",
+		Message: "Unauthorized",
+		Type:    "Unauthorized",
+		Code:    http.StatusUnauthorized,
+	}
+
+	return writeError(er, w)
+}
+
+func errorServiceUnavailable(message string, w http.ResponseWriter) error {
+	er := errorResponse{
+		Object:  "error",
+		Message: message,
+		Type:    "ServiceUnavailable",
+		Code:    http.StatusServiceUnavailable,
+	}
+
+	return writeError(er, w)
+}
+
+func errorUpstream(upstream string, class string, w http.ResponseWriter) error {
+	return errorClassified(upstreamErrorStatus(class), upstreamClassMessage(upstream, class), class, w)
+}
+
+func errorClassified(statusCode int, message string, class string, w http.ResponseWriter) error {
+	er := errorResponse{
+		Object:  "error",
+		Message: message,
+		Type:    strings.ReplaceAll(http.StatusText(statusCode), " ", ""),
+		Code:    statusCode,
+		Class:   class,
+	}
+
+	return writeError(er, w)
+}
+
+func errorStatus(statusCode int, message string, w http.ResponseWriter) error {
+	er := errorResponse{
+		Object:  "error",
+		Message: message,
+		Type:    strings.ReplaceAll(http.StatusText(statusCode), " ", ""),
+		Code:    statusCode,
+	}
+
+	return writeError(er, w)
 }
@@ -0,0 +1,131 @@
+/*
+Copyright 2025 The llm-d Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package proxy
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/llm-d/llm-d-routing-sidecar/internal/metrics"
+)
+
+const eventStreamContentType = "text/event-stream"
+
+// eventStreamBody ends the event stream of the decoder with an error event when it fails, or
+// once no data arrived for the stall timeout: the decoder connection is then closed, canceling
+// the request upstream
+type eventStreamBody struct {
+	io.ReadCloser
+	s         *Server
+	ctx       context.Context
+	requestID string
+	timer     *time.Timer // nil without stall timeout
+	timeout   time.Duration
+	stalled   atomic.Bool
+	tail      io.Reader // the error event, once failed
+}
+
+// watchEventStreams watches the event streams of the decoder for failures and stalls
+func (s *Server) watchEventStreams(res *http.Response) error {
+	if !strings.HasPrefix(res.Header.Get("Content-Type"), eventStreamContentType) {
+		return nil
+	}
+
+	ctx := res.Request.Context()
+	body := &eventStreamBody{ReadCloser: res.Body, s: s, ctx: ctx, requestID: contextRequestID(ctx),
+		timeout: s.config.StreamStallTimeout}
+	if body.timeout > 0 {
+		path := res.Request.URL.Path
+		body.timer = time.AfterFunc(body.timeout, func() {
+			body.stalled.Store(true)
+			s.logger.Info("stream stalled, canceling it", "timeout", body.timeout, "path", path)
+			metrics.RecordStalledStream(s.rank())
+			body.ReadCloser.Close() //nolint:all
+		})
+	}
+	res.Body = body
+	return nil
+}
+
+func (b *eventStreamBody) Read(p []byte) (int, error) {
+	if b.tail != nil {
+		return b.tail.Read(p)
+	}
+	n, err := b.ReadCloser.Read(p)
+	if n > 0 && b.timer != nil {
+		b.timer.Reset(b.timeout)
+	}
+	if err == nil || err == io.EOF {
+		return n, err
+	}
+
+	switch {
+	case errors.Is(context.Cause(b.ctx), errShuttingDown):
+		b.tail = bytes.NewReader(b.s.sseErrorEvent(b.requestID, http.StatusServiceUnavailable,
+			"stream interrupted: the sidecar is shutting down"))
+	case b.stalled.Load():
+		b.tail = bytes.NewReader(b.s.sseErrorEvent(b.requestID, http.StatusGatewayTimeout,
+			fmt.Sprintf("stream stalled: no data from the decoder for %s", b.timeout)))
+	case b.s.config.StreamErrorEvents && !errors.Is(err, context.Canceled):
+		// the client is still there, unlike the canceled requests
+		b.s.logger.Info("stream interrupted by the decoder", "error", err.Error())
+		b.tail = bytes.NewReader(b.s.sseErrorEvent(b.requestID, http.StatusBadGateway,
+			fmt.Sprintf("stream interrupted by the decoder: %v", err)))
+	default:
+		return n, err
+	}
+	if n > 0 {
+		return n, nil
+	}
+	return b.tail.Read(p)
+}
+
+func (b *eventStreamBody) Close() error {
+	if b.timer != nil {
+		b.timer.Stop()
+	}
+	return b.ReadCloser.Close()
+}
+
+// sseErrorEvent returns the event ending a failed stream, an error in the format of vLLM
+// followed by the end of stream marker unless disabled
+func (s *Server) sseErrorEvent(requestID string, statusCode int, message string) []byte {
+	event := struct {
+		Error errorResponse `json:"error"`
+	}{
+		Error: errorResponse{
+			Object:    "error",
+			Message:   message,
+			Type:      strings.ReplaceAll(http.StatusText(statusCode), " ", ""),
+			Code:      statusCode,
+			RequestID: requestID,
+		},
+	}
+	b, _ := json.Marshal(event) // nolint:all
+	if s.config.StreamErrorOmitDone {
+		return fmt.Appendf(nil, "data: %s\n\n", b)
+	}
+	return fmt.Appendf(nil, "data: %s\n\ndata: [DONE]\n\n", b)
+}
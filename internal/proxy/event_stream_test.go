@@ -0,0 +1,157 @@
+/*
+Copyright 2025 The llm-d Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package proxy
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2" // nolint:revive
+	. "github.com/onsi/gomega"    // nolint:revive
+	"k8s.io/klog/v2/ktesting"
+)
+
+const firstEvent = "data: {\"choices\":[{\"text\":\"Hi\"}]}\n\n"
+
+var _ = Describe("Event streams", func() {
+	var (
+		config   Config
+		proxyURL string
+		stall    atomic.Bool
+		drop     atomic.Bool
+		canceled atomic.Bool
+	)
+
+	BeforeEach(func() {
+		config = Config{Connector: ConnectorNIXLV2}
+		stall.Store(false)
+		drop.Store(false)
+		canceled.Store(false)
+	})
+
+	JustBeforeEach(func() {
+		_, ctx := ktesting.NewTestContext(GinkgoT())
+		ctx, cancelFn := context.WithCancel(ctx)
+		DeferCleanup(cancelFn)
+
+		// The decoder streams a token, then stalls or drops the connection when asked to
+		decoder := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			io.Copy(io.Discard, r.Body) //nolint:all
+			w.Header().Set("Content-Type", "text/event-stream")
+			w.Write([]byte(firstEvent)) //nolint:all
+			w.(http.Flusher).Flush()
+			switch {
+			case stall.Load():
+				<-r.Context().Done()
+				canceled.Store(true)
+			case drop.Load():
+				conn, _, err := http.NewResponseController(w).Hijack()
+				Expect(err).ToNot(HaveOccurred())
+				conn.Close() //nolint:all
+			default:
+				w.Write([]byte("data: [DONE]\n\n")) //nolint:all
+			}
+		}))
+		DeferCleanup(decoder.Close)
+
+		decodeURL, err := url.Parse(decoder.URL)
+		Expect(err).ToNot(HaveOccurred())
+		proxy, err := NewProxy("0", decodeURL, config)
+		Expect(err).ToNot(HaveOccurred())
+		go func() {
+			defer GinkgoRecover()
+			Expect(proxy.Start(ctx)).To(Succeed())
+		}()
+		Eventually(func() net.Addr { return proxy.Addr() }).ShouldNot(BeNil())
+		proxyURL = "http://" + proxy.Addr().String()
+	})
+
+	stream := func() (string, error) {
+		resp, err := http.Post(proxyURL+CompletionsPath, "application/json",
+			strings.NewReader(`{"model": "m", "prompt": "Hello", "stream": true}`))
+		Expect(err).ToNot(HaveOccurred())
+		defer resp.Body.Close() //nolint:all
+		Expect(resp.StatusCode).To(Equal(http.StatusOK))
+		b, err := io.ReadAll(resp.Body)
+		return string(b), err
+	}
+
+	Context("with a stall timeout", func() {
+		BeforeEach(func() {
+			config.StreamStallTimeout = 100 * time.Millisecond
+		})
+
+		It("should end the stalled streams with an error event", func() {
+			stall.Store(true)
+			body, err := stream()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(body).To(HavePrefix(firstEvent))
+			Expect(body).To(ContainSubstring(`data: {"error":{"object":"error","message":"stream stalled: no data from the decoder for 100ms","type":"GatewayTimeout"`))
+			Expect(body).To(HaveSuffix("data: [DONE]\n\n"))
+			Eventually(canceled.Load).Should(BeTrue())
+		})
+
+		It("should leave the streams flowing as is", func() {
+			body, err := stream()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(body).To(Equal(firstEvent + "data: [DONE]\n\n"))
+		})
+	})
+
+	It("should truncate the failed streams by default", func() {
+		drop.Store(true)
+		body, err := stream()
+		Expect(err).To(HaveOccurred())
+		Expect(body).To(Equal(firstEvent))
+	})
+
+	Context("with error events", func() {
+		BeforeEach(func() {
+			config.StreamErrorEvents = true
+		})
+
+		It("should end the failed streams with an error event", func() {
+			drop.Store(true)
+			body, err := stream()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(body).To(HavePrefix(firstEvent))
+			Expect(body).To(ContainSubstring(`data: {"error":{"object":"error","message":"stream interrupted by the decoder`))
+			Expect(body).To(HaveSuffix("data: [DONE]\n\n"))
+		})
+
+		Context("without end of stream marker", func() {
+			BeforeEach(func() {
+				config.StreamErrorOmitDone = true
+			})
+
+			It("should only send the error event", func() {
+				drop.Store(true)
+				body, err := stream()
+				Expect(err).ToNot(HaveOccurred())
+				Expect(body).To(ContainSubstring(`"type":"BadGateway"`))
+				Expect(body).ToNot(ContainSubstring("[DONE]"))
+			})
+		})
+	})
+})
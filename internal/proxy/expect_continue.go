@@ -0,0 +1,54 @@
+/*
+Copyright 2025 The llm-d Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package proxy
+
+import (
+	"net/http"
+	"strings"
+)
+
+const requestHeaderExpect = "Expect"
+
+// expectsContinue reports whether the client waits for a 100 Continue interim response before
+// uploading the request body. The server sends it on the first read of the body.
+func expectsContinue(r *http.Request) bool {
+	return strings.EqualFold(r.Header.Get(requestHeaderExpect), "100-continue")
+}
+
+// checkContinue rejects the requests bound to fail before their body is read, so the clients
+// waiting for 100 Continue do not upload them. The admission queue and the tenant quotas have
+// already let the request through, and the bodies announced larger than the limit are rejected
+// without being read. The prefill target is only checked when no routing policy may replace it,
+// and the candidate targets of a prefiller selection only once selected.
+func (s *Server) checkContinue(w http.ResponseWriter, r *http.Request) bool {
+	targets, _, err := prefillTargets(r.Header)
+	if err == nil {
+		err = s.checkPrefillTargets(targets)
+	}
+	if err != nil {
+		if err := errorStatus(http.StatusBadRequest, err.Error(), w); err != nil {
+			s.logger.Error(err, "failed to send error response to client")
+		}
+		return false
+	}
+	if len(targets) == 1 && s.policy == nil && !s.allowlistValidator.IsAllowed(targets[0]) {
+		s.auditSSRF(r, targets[0], false)
+		s.denyPrefillTarget(w, r, targets[0])
+		return false
+	}
+	return true
+}
@@ -0,0 +1,115 @@
+/*
+Copyright 2025 The llm-d Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package proxy
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-logr/logr"
+	. "github.com/onsi/ginkgo/v2" // nolint:revive
+	. "github.com/onsi/gomega"    // nolint:revive
+	"k8s.io/utils/set"
+
+	"github.com/llm-d/llm-d-routing-sidecar/test/mock"
+)
+
+// trackedBody records whether the client uploaded the request body
+type trackedBody struct {
+	io.Reader
+	read *atomic.Bool
+}
+
+func (b trackedBody) Read(p []byte) (int, error) {
+	b.read.Store(true)
+	return b.Reader.Read(p)
+}
+
+var _ = Describe("Expect: 100-continue", func() {
+	const body = `{"model": "food-review", "messages": [{"role": "user", "content": "Hello"}]}`
+
+	var (
+		proxyURL    string
+		prefillHost string
+		read        *atomic.Bool
+	)
+
+	start := func(config Config, allowed ...string) {
+		decodeBackend := httptest.NewServer(&mock.ChatCompletionHandler{Connector: ConnectorNIXLV2, Role: mock.RoleDecode})
+		DeferCleanup(decodeBackend.Close)
+		prefillBackend := httptest.NewServer(&mock.ChatCompletionHandler{Connector: ConnectorNIXLV2, Role: mock.RolePrefill})
+		DeferCleanup(prefillBackend.Close)
+		prefillHost = prefillBackend.URL[len("http://"):]
+
+		decodeURL, err := url.Parse(decodeBackend.URL)
+		Expect(err).ToNot(HaveOccurred())
+		proxy, err := NewProxy("0", decodeURL, config)
+		Expect(err).ToNot(HaveOccurred())
+		proxy.logger = logr.Discard()
+		if len(allowed) > 0 {
+			proxy.allowlistValidator = &AllowlistValidator{enabled: true, allowedTargets: set.New(allowed...)}
+		}
+
+		server := httptest.NewServer(http.HandlerFunc(proxy.chatCompletionsHandler))
+		DeferCleanup(server.Close)
+		proxyURL = server.URL
+		read = new(atomic.Bool)
+	}
+
+	send := func(target string) int {
+		req, err := http.NewRequest(http.MethodPost, proxyURL+ChatCompletionsPath, trackedBody{strings.NewReader(body), read})
+		Expect(err).ToNot(HaveOccurred())
+		req.ContentLength = int64(len(body))
+		req.Header.Set(requestHeaderExpect, "100-continue")
+		req.Header.Set(requestHeaderPrefillHostPort, target)
+
+		client := &http.Client{Transport: &http.Transport{ExpectContinueTimeout: time.Minute}}
+		resp, err := client.Do(req)
+		Expect(err).ToNot(HaveOccurred())
+		resp.Body.Close() //nolint:all
+		return resp.StatusCode
+	}
+
+	It("should upload the body of the allowed requests", func() {
+		start(Config{Connector: ConnectorNIXLV2})
+		Expect(send(prefillHost)).To(Equal(http.StatusOK))
+		Expect(read.Load()).To(BeTrue())
+	})
+
+	It("should reject the bodies larger than the limit before their upload", func() {
+		start(Config{Connector: ConnectorNIXLV2, MaxRequestBodyBytes: 16})
+		Expect(send(prefillHost)).To(Equal(http.StatusRequestEntityTooLarge))
+		Expect(read.Load()).To(BeFalse())
+	})
+
+	It("should reject the prefill targets not allowed before the upload", func() {
+		start(Config{Connector: ConnectorNIXLV2}, "10.0.0.1")
+		Expect(send(prefillHost)).To(Equal(http.StatusForbidden))
+		Expect(read.Load()).To(BeFalse())
+	})
+
+	It("should reject the malformed prefill targets before the upload", func() {
+		start(Config{Connector: ConnectorNIXLV2})
+		Expect(send("https://" + prefillHost)).To(Equal(http.StatusBadRequest))
+		Expect(read.Load()).To(BeFalse())
+	})
+})
@@ -0,0 +1,59 @@
+/*
+Copyright 2025 The llm-d Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package proxy
+
+import (
+	"net/http"
+)
+
+// LinkDataParallelRanks makes the proxies of the data parallel ranks aware of
+// each other, so traffic can fail over to a sibling rank when enabled.
+func LinkDataParallelRanks(servers ...*Server) {
+	for i, s := range servers {
+		s.siblings = make([]*Server, 0, len(servers)-1)
+		// start with the next rank so failed over traffic is spread across ranks
+		for j := 1; j < len(servers); j++ {
+			s.siblings = append(s.siblings, servers[(i+j)%len(servers)])
+		}
+	}
+}
+
+// failoverHandler forwards requests to the local decoder, or to the decoder of
+// a healthy sibling rank while the local decoder is down.
+func (s *Server) failoverHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if s.decoderDown.Load() {
+			if sibling := s.healthySibling(); sibling != nil {
+				s.logger.V(4).Info("local decoder down, failing over", "siblingRank", sibling.config.DataParallelRank)
+				traceFallback(r.Context(), "local decoder down, failed over to "+traceRank(sibling))
+				sibling.localDecoderProxy.ServeHTTP(w, r)
+				return
+			}
+		}
+		s.localDecoderProxy.ServeHTTP(w, r)
+	})
+}
+
+// healthySibling returns the first sibling rank whose decoder is not known to be down
+func (s *Server) healthySibling() *Server {
+	for _, sibling := range s.siblings {
+		if !sibling.decoderDown.Load() {
+			return sibling
+		}
+	}
+	return nil
+}
@@ -0,0 +1,117 @@
+/*
+Copyright 2025 The llm-d Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package proxy
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+
+	"github.com/llm-d/llm-d-routing-sidecar/test/mock"
+	. "github.com/onsi/ginkgo/v2" // nolint:revive
+	. "github.com/onsi/gomega"    // nolint:revive
+	"k8s.io/klog/v2/ktesting"
+)
+
+var _ = Describe("Data parallel failover", func() {
+	It("should redirect the traffic of a crashed rank to a sibling rank", func() {
+		_, ctx := ktesting.NewTestContext(GinkgoT())
+		ctx, cancelFn := context.WithCancel(ctx)
+		defer cancelFn()
+
+		healthyHandler := &mock.GenericHandler{}
+		healthyBackend := httptest.NewServer(healthyHandler)
+		DeferCleanup(healthyBackend.Close)
+
+		// Crashed rank: nothing is listening on the decoder port anymore
+		crashedBackend := httptest.NewServer(&mock.GenericHandler{})
+		crashedBackend.Close()
+
+		servers := make([]*Server, 0, 2)
+		for rank, backend := range []*httptest.Server{healthyBackend, crashedBackend} {
+			decodeURL, err := url.Parse(backend.URL)
+			Expect(err).ToNot(HaveOccurred())
+
+			config := Config{Connector: ConnectorNIXLV2, DataParallelRank: rank, DataParallelFailover: true}
+			proxy, err := NewProxy("0", decodeURL, config)
+			Expect(err).ToNot(HaveOccurred())
+			servers = append(servers, proxy)
+		}
+		LinkDataParallelRanks(servers...)
+
+		crashed := servers[1]
+		go func() {
+			defer GinkgoRecover()
+			Expect(crashed.Start(ctx)).To(Succeed())
+		}()
+		Eventually(func() net.Addr { return crashed.Addr() }).ShouldNot(BeNil())
+
+		By("detecting the crashed decoder")
+		resp, err := http.Get("http://" + crashed.Addr().String() + "/v1/models")
+		Expect(err).ToNot(HaveOccurred())
+		resp.Body.Close() //nolint:all
+		Expect(resp.StatusCode).To(Equal(http.StatusBadGateway))
+
+		By("failing over to the sibling rank")
+		resp, err = http.Get("http://" + crashed.Addr().String() + "/v1/models")
+		Expect(err).ToNot(HaveOccurred())
+		resp.Body.Close() //nolint:all
+		Expect(resp.StatusCode).To(Equal(http.StatusOK))
+		Expect(healthyHandler.RequestCount.Load()).To(BeNumerically("==", 1))
+	})
+
+	It("should not fail over when disabled", func() {
+		_, ctx := ktesting.NewTestContext(GinkgoT())
+		ctx, cancelFn := context.WithCancel(ctx)
+		defer cancelFn()
+
+		healthyHandler := &mock.GenericHandler{}
+		healthyBackend := httptest.NewServer(healthyHandler)
+		DeferCleanup(healthyBackend.Close)
+
+		crashedBackend := httptest.NewServer(&mock.GenericHandler{})
+		crashedBackend.Close()
+
+		servers := make([]*Server, 0, 2)
+		for rank, backend := range []*httptest.Server{healthyBackend, crashedBackend} {
+			decodeURL, err := url.Parse(backend.URL)
+			Expect(err).ToNot(HaveOccurred())
+
+			proxy, err := NewProxy("0", decodeURL, Config{Connector: ConnectorNIXLV2, DataParallelRank: rank})
+			Expect(err).ToNot(HaveOccurred())
+			servers = append(servers, proxy)
+		}
+		LinkDataParallelRanks(servers...)
+
+		crashed := servers[1]
+		go func() {
+			defer GinkgoRecover()
+			Expect(crashed.Start(ctx)).To(Succeed())
+		}()
+		Eventually(func() net.Addr { return crashed.Addr() }).ShouldNot(BeNil())
+
+		for range 2 {
+			resp, err := http.Get("http://" + crashed.Addr().String() + "/v1/models")
+			Expect(err).ToNot(HaveOccurred())
+			resp.Body.Close() //nolint:all
+			Expect(resp.StatusCode).To(Equal(http.StatusBadGateway))
+		}
+		Expect(healthyHandler.RequestCount.Load()).To(BeNumerically("==", 0))
+	})
+})
@@ -0,0 +1,389 @@
+/*
+Copyright 2025 The llm-d Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package proxy
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/reflection"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+const (
+	// GRPCServiceName is the experimental gRPC service of the completions. Its messages are the
+	// OpenAI requests and responses as google.protobuf.Struct.
+	GRPCServiceName = "llmd.routing.v1.Completions"
+
+	grpcMethodChatCompletions       = "ChatCompletions"
+	grpcMethodStreamChatCompletions = "StreamChatCompletions"
+	grpcMethodCompletions           = "Completions"
+	grpcMethodStreamCompletions     = "StreamCompletions"
+
+	// maxExactInteger is the largest integer represented exactly by the numbers of a
+	// google.protobuf.Struct, doubles
+	maxExactInteger = 1<<53 - 1
+)
+
+// grpcMethodPaths are the completion paths of the gRPC methods
+var grpcMethodPaths = map[string]string{
+	grpcMethodChatCompletions:       ChatCompletionsPath,
+	grpcMethodStreamChatCompletions: ChatCompletionsPath,
+	grpcMethodCompletions:           CompletionsPath,
+	grpcMethodStreamCompletions:     CompletionsPath,
+}
+
+// registerGRPCService describes the gRPC service in the registry of the protobuf files, so it is
+// served by the reflection service without generated code
+var registerGRPCService = sync.OnceValue(func() error {
+	structType := ".google.protobuf.Struct"
+	method := func(name string, stream bool) *descriptorpb.MethodDescriptorProto {
+		return &descriptorpb.MethodDescriptorProto{
+			Name:            proto.String(name),
+			InputType:       proto.String(structType),
+			OutputType:      proto.String(structType),
+			ServerStreaming: proto.Bool(stream),
+		}
+	}
+	file := &descriptorpb.FileDescriptorProto{
+		Name:       proto.String("llmd/routing/v1/completions.proto"),
+		Package:    proto.String("llmd.routing.v1"),
+		Dependency: []string{structpb.File_google_protobuf_struct_proto.Path()},
+		Syntax:     proto.String("proto3"),
+		Service: []*descriptorpb.ServiceDescriptorProto{{
+			Name: proto.String("Completions"),
+			Method: []*descriptorpb.MethodDescriptorProto{
+				method(grpcMethodChatCompletions, false),
+				method(grpcMethodStreamChatCompletions, true),
+				method(grpcMethodCompletions, false),
+				method(grpcMethodStreamCompletions, true),
+			},
+		}},
+	}
+
+	descriptor, err := protodesc.NewFile(file, protoregistry.GlobalFiles)
+	if err != nil {
+		return err
+	}
+	return protoregistry.GlobalFiles.RegisterFile(descriptor)
+})
+
+// grpcCompletions serves the completions gRPC service
+type grpcCompletions interface {
+	complete(ctx context.Context, method string, request *structpb.Struct) (*structpb.Struct, error)
+	stream(method string, request *structpb.Struct, stream grpc.ServerStream) error
+}
+
+// grpcServiceDesc describes the completions gRPC service, as generated by protoc-gen-go-grpc
+var grpcServiceDesc = grpc.ServiceDesc{
+	ServiceName: GRPCServiceName,
+	HandlerType: (*grpcCompletions)(nil),
+	Methods: []grpc.MethodDesc{
+		{MethodName: grpcMethodChatCompletions, Handler: grpcUnaryHandler(grpcMethodChatCompletions)},
+		{MethodName: grpcMethodCompletions, Handler: grpcUnaryHandler(grpcMethodCompletions)},
+	},
+	Streams: []grpc.StreamDesc{
+		{StreamName: grpcMethodStreamChatCompletions, Handler: grpcStreamHandler(grpcMethodStreamChatCompletions), ServerStreams: true},
+		{StreamName: grpcMethodStreamCompletions, Handler: grpcStreamHandler(grpcMethodStreamCompletions), ServerStreams: true},
+	},
+	Metadata: "llmd/routing/v1/completions.proto",
+}
+
+func grpcUnaryHandler(method string) func(any, context.Context, func(any) error, grpc.UnaryServerInterceptor) (any, error) {
+	return func(srv any, ctx context.Context, dec func(any) error, interceptor grpc.UnaryServerInterceptor) (any, error) {
+		request := &structpb.Struct{}
+		if err := dec(request); err != nil {
+			return nil, err
+		}
+		handler := func(ctx context.Context, request any) (any, error) {
+			return srv.(grpcCompletions).complete(ctx, method, request.(*structpb.Struct))
+		}
+		if interceptor == nil {
+			return handler(ctx, request)
+		}
+		info := &grpc.UnaryServerInfo{Server: srv, FullMethod: "/" + GRPCServiceName + "/" + method}
+		return interceptor(ctx, request, info, handler)
+	}
+}
+
+func grpcStreamHandler(method string) grpc.StreamHandler {
+	return func(srv any, stream grpc.ServerStream) error {
+		request := &structpb.Struct{}
+		if err := stream.RecvMsg(request); err != nil {
+			return err
+		}
+		return srv.(grpcCompletions).stream(method, request, stream)
+	}
+}
+
+// grpcFrontend sends the completion RPCs through the handlers of the HTTP requests, so they are
+// routed and disaggregated like them
+type grpcFrontend struct {
+	handler http.Handler
+}
+
+// newGRPCServer returns the experimental gRPC server of the completions, with the reflection
+// service describing them, served with TLS when configured
+func (s *Server) newGRPCServer(tlsConfig *tls.Config) (*grpc.Server, error) {
+	if err := registerGRPCService(); err != nil {
+		return nil, err
+	}
+
+	var options []grpc.ServerOption
+	if tlsConfig != nil {
+		options = append(options, grpc.Creds(credentials.NewTLS(tlsConfig)))
+	}
+	if s.config.MaxRequestBodyBytes > 0 {
+		options = append(options, grpc.MaxRecvMsgSize(int(s.config.MaxRequestBodyBytes)))
+	}
+	server := grpc.NewServer(options...)
+	server.RegisterService(&grpcServiceDesc, &grpcFrontend{handler: s.handler()})
+	reflection.Register(server)
+	return server, nil
+}
+
+// serveGRPC serves the gRPC frontend until the context is done, then stops it gracefully
+func (s *Server) serveGRPC(ctx context.Context, server *grpc.Server, listeners []net.Listener) {
+	for _, listener := range listeners {
+		go func() {
+			if err := server.Serve(listener); err != nil {
+				s.logger.Error(err, "failed to serve gRPC", "addr", listener.Addr().String())
+			}
+		}()
+	}
+
+	<-ctx.Done()
+	stopped := make(chan struct{})
+	go func() {
+		server.GracefulStop()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-time.After(60 * time.Second):
+		server.Stop()
+	}
+}
+
+func (g *grpcFrontend) complete(ctx context.Context, method string, request *structpb.Struct) (*structpb.Struct, error) {
+	r, err := newGRPCRequest(ctx, method, request, false)
+	if err != nil {
+		return nil, err
+	}
+
+	rw := &bufferedResponseWriter{}
+	g.handler.ServeHTTP(rw, r)
+	if rw.statusCode < 200 || rw.statusCode >= 300 {
+		return nil, grpcError(rw.statusCode, rw.buffer.String())
+	}
+
+	response := &structpb.Struct{}
+	if err := protojson.Unmarshal(rw.buffer.Bytes(), response); err != nil {
+		return nil, status.Errorf(codes.Internal, "invalid completion response: %v", err)
+	}
+	return response, nil
+}
+
+func (g *grpcFrontend) stream(method string, request *structpb.Struct, stream grpc.ServerStream) error {
+	r, err := newGRPCRequest(stream.Context(), method, request, true)
+	if err != nil {
+		return err
+	}
+
+	sw := &grpcStreamWriter{stream: stream, header: make(http.Header)}
+	g.handler.ServeHTTP(sw, r)
+	if sw.statusCode != 0 && (sw.statusCode < 200 || sw.statusCode >= 300) {
+		return grpcError(sw.statusCode, sw.errorBody.String())
+	}
+	return sw.err
+}
+
+// newGRPCRequest returns the HTTP completion request of an RPC, with its metadata as headers
+func newGRPCRequest(ctx context.Context, method string, request *structpb.Struct, stream bool) (*http.Request, error) {
+	if request.Fields == nil {
+		request.Fields = map[string]*structpb.Value{}
+	}
+	for name, value := range request.Fields {
+		if err := checkExactIntegers(name, value); err != nil {
+			return nil, err
+		}
+	}
+	request.Fields["stream"] = structpb.NewBoolValue(stream)
+	body, err := protojson.Marshal(request)
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "invalid completion request: %v", err)
+	}
+
+	r, err := http.NewRequestWithContext(ctx, http.MethodPost, grpcMethodPaths[method], bytes.NewReader(body))
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	r.Header.Set("Content-Type", "application/json")
+	md, _ := metadata.FromIncomingContext(ctx)
+	for key, values := range md {
+		if strings.HasPrefix(key, ":") || strings.HasPrefix(key, "grpc-") || strings.HasSuffix(key, "-bin") ||
+			key == "content-type" || key == "te" {
+			continue
+		}
+		for _, value := range values {
+			r.Header.Add(key, value)
+		}
+	}
+	if p, ok := peer.FromContext(ctx); ok {
+		r.RemoteAddr = p.Addr.String()
+		if info, ok := p.AuthInfo.(credentials.TLSInfo); ok {
+			r.TLS = &info.State
+		}
+	}
+	return r, nil
+}
+
+// checkExactIntegers rejects the numbers of a request field too large to be exact integers, e.g.
+// seeds, which reached the proxy already rounded rather than as sent by the client
+func checkExactIntegers(path string, value *structpb.Value) error {
+	switch kind := value.GetKind().(type) {
+	case *structpb.Value_NumberValue:
+		if math.Abs(kind.NumberValue) > maxExactInteger {
+			return status.Errorf(codes.InvalidArgument, "%s: %v exceeds the integers represented exactly by a google.protobuf.Struct (2^53-1)", path, kind.NumberValue)
+		}
+	case *structpb.Value_StructValue:
+		for name, field := range kind.StructValue.GetFields() {
+			if err := checkExactIntegers(path+"."+name, field); err != nil {
+				return err
+			}
+		}
+	case *structpb.Value_ListValue:
+		for i, item := range kind.ListValue.GetValues() {
+			if err := checkExactIntegers(fmt.Sprintf("%s[%d]", path, i), item); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// grpcError returns the gRPC status of an HTTP error response
+func grpcError(statusCode int, body string) error {
+	code := codes.Unknown
+	switch statusCode {
+	case http.StatusBadRequest, http.StatusRequestEntityTooLarge:
+		code = codes.InvalidArgument
+	case http.StatusUnauthorized:
+		code = codes.Unauthenticated
+	case http.StatusForbidden:
+		code = codes.PermissionDenied
+	case http.StatusNotFound:
+		code = codes.NotFound
+	case http.StatusTooManyRequests:
+		code = codes.ResourceExhausted
+	case statusClientClosedRequest:
+		code = codes.Canceled
+	case http.StatusNotImplemented:
+		code = codes.Unimplemented
+	case http.StatusBadGateway, http.StatusServiceUnavailable:
+		code = codes.Unavailable
+	case http.StatusGatewayTimeout:
+		code = codes.DeadlineExceeded
+	case http.StatusInternalServerError:
+		code = codes.Internal
+	}
+	return status.Error(code, upstreamErrorMessage(body))
+}
+
+// grpcStreamWriter sends the chunks of a streamed completion response as gRPC messages as they
+// are written
+type grpcStreamWriter struct {
+	stream     grpc.ServerStream
+	header     http.Header
+	statusCode int
+	pending    []byte       // incomplete event line
+	errorBody  bytes.Buffer // body of an error response
+	err        error        // the failure to send a chunk
+}
+
+func (sw *grpcStreamWriter) Header() http.Header {
+	return sw.header
+}
+
+func (sw *grpcStreamWriter) WriteHeader(statusCode int) {
+	if sw.statusCode == 0 {
+		sw.statusCode = statusCode
+	}
+}
+
+func (sw *grpcStreamWriter) Write(b []byte) (int, error) {
+	if sw.statusCode == 0 {
+		sw.WriteHeader(http.StatusOK)
+	}
+	if sw.statusCode < 200 || sw.statusCode >= 300 {
+		return sw.errorBody.Write(b)
+	}
+
+	sw.pending = append(sw.pending, b...)
+	for {
+		i := bytes.IndexByte(sw.pending, '\n')
+		if i < 0 {
+			break
+		}
+		line := bytes.TrimSpace(sw.pending[:i])
+		sw.pending = sw.pending[i+1:]
+		if err := sw.processLine(line); err != nil {
+			sw.err = err
+			return 0, err
+		}
+	}
+	return len(b), nil
+}
+
+// Flush is a no-op, the chunks being sent as soon as written
+func (sw *grpcStreamWriter) Flush() {}
+
+func (sw *grpcStreamWriter) processLine(line []byte) error {
+	data, ok := bytes.CutPrefix(line, []byte("data:"))
+	if !ok {
+		return nil
+	}
+	data = bytes.TrimSpace(data)
+	if string(data) == "[DONE]" {
+		return nil
+	}
+
+	chunk := &structpb.Struct{}
+	if err := protojson.Unmarshal(data, chunk); err != nil {
+		return nil // not a completion chunk
+	}
+	return sw.stream.SendMsg(chunk)
+}
@@ -0,0 +1,221 @@
+/*
+Copyright 2025 The llm-d Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package proxy
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"time"
+
+	"github.com/llm-d/llm-d-routing-sidecar/test/mock"
+	. "github.com/onsi/ginkgo/v2" // nolint:revive
+	. "github.com/onsi/gomega"    // nolint:revive
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	reflectionpb "google.golang.org/grpc/reflection/grpc_reflection_v1"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/structpb"
+	"k8s.io/klog/v2/ktesting"
+)
+
+var _ = Describe("gRPC frontend", func() {
+	var (
+		ctx            context.Context
+		decodeBody     chan map[string]any
+		decodeResponse func(w http.ResponseWriter, stream bool)
+		prefillHandler *mock.ChatCompletionHandler
+		prefillHost    string
+		conn           *grpc.ClientConn
+	)
+
+	BeforeEach(func() {
+		_, ctx = ktesting.NewTestContext(GinkgoT())
+		var cancelFn context.CancelFunc
+		ctx, cancelFn = context.WithCancel(ctx)
+		DeferCleanup(cancelFn)
+
+		decodeBody = make(chan map[string]any, 1)
+		decodeBackend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			var body map[string]any
+			b, _ := io.ReadAll(r.Body) //nolint:all
+			json.Unmarshal(b, &body)   //nolint:all
+			decodeBody <- body
+			decodeResponse(w, body["stream"] == true)
+		}))
+		DeferCleanup(decodeBackend.Close)
+
+		prefillHandler = &mock.ChatCompletionHandler{Connector: ConnectorNIXLV2, Role: mock.RolePrefill}
+		prefillBackend := httptest.NewServer(prefillHandler)
+		DeferCleanup(prefillBackend.Close)
+		prefillHost = prefillBackend.URL[len("http://"):]
+
+		decodeURL, err := url.Parse(decodeBackend.URL)
+		Expect(err).ToNot(HaveOccurred())
+		proxy, err := NewProxy("0", decodeURL, Config{Connector: ConnectorNIXLV2, GRPCPort: "0"})
+		Expect(err).ToNot(HaveOccurred())
+
+		go func() {
+			defer GinkgoRecover()
+			Expect(proxy.Start(ctx)).To(Succeed())
+		}()
+		time.Sleep(1 * time.Second)
+		Expect(proxy.GRPCAddr()).ToNot(BeNil())
+
+		conn, err = grpc.NewClient(proxy.GRPCAddr().String(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+		Expect(err).ToNot(HaveOccurred())
+		DeferCleanup(conn.Close)
+	})
+
+	newRequest := func() *structpb.Struct {
+		request, err := structpb.NewStruct(map[string]any{
+			"model":    "Qwen/Qwen2-0.5B",
+			"messages": []any{map[string]any{"role": "user", "content": "Hello"}},
+		})
+		Expect(err).ToNot(HaveOccurred())
+		return request
+	}
+
+	prefillContext := func() context.Context {
+		return metadata.AppendToOutgoingContext(ctx, requestHeaderPrefillHostPort, prefillHost)
+	}
+
+	It("should route a unary chat completion through the P/D protocol", func() {
+		decodeResponse = func(w http.ResponseWriter, _ bool) {
+			w.Header().Set("Content-Type", "application/json")
+			fmt.Fprint(w, `{"id": "chatcmpl-1", "choices": [{"index": 0, "message": {"role": "assistant", "content": "Hi!"}, "finish_reason": "stop"}]}`) //nolint:all
+		}
+
+		response := &structpb.Struct{}
+		err := conn.Invoke(prefillContext(), "/"+GRPCServiceName+"/"+grpcMethodChatCompletions, newRequest(), response)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(response.AsMap()["id"]).To(Equal("chatcmpl-1"))
+
+		var body map[string]any
+		Eventually(decodeBody).Should(Receive(&body))
+		Expect(body["stream"]).To(BeFalse())
+		Expect(body["kv_transfer_params"]).ToNot(BeNil())
+		Expect(prefillHandler.RequestCount.Load()).To(BeNumerically("==", 1))
+	})
+
+	It("should stream the chunks of a completion", func() {
+		decodeResponse = func(w http.ResponseWriter, _ bool) {
+			w.Header().Set("Content-Type", "text/event-stream")
+			fmt.Fprint(w, "data: {\"id\": \"cmpl-1\", \"choices\": [{\"index\": 0, \"text\": \"Hi\"}]}\n\n")                             //nolint:all
+			fmt.Fprint(w, "data: {\"id\": \"cmpl-1\", \"choices\": [{\"index\": 0, \"text\": \"!\", \"finish_reason\": \"stop\"}]}\n\n") //nolint:all
+			fmt.Fprint(w, "data: [DONE]\n\n")                                                                                            //nolint:all
+		}
+
+		request, err := structpb.NewStruct(map[string]any{"model": "Qwen/Qwen2-0.5B", "prompt": "Hello"})
+		Expect(err).ToNot(HaveOccurred())
+		stream, err := conn.NewStream(prefillContext(), &grpcServiceDesc.Streams[1], "/"+GRPCServiceName+"/"+grpcMethodStreamCompletions)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(stream.SendMsg(request)).To(Succeed())
+		Expect(stream.CloseSend()).To(Succeed())
+
+		var texts []any
+		for {
+			chunk := &structpb.Struct{}
+			err := stream.RecvMsg(chunk)
+			if err == io.EOF {
+				break
+			}
+			Expect(err).ToNot(HaveOccurred())
+			texts = append(texts, chunk.AsMap()["choices"].([]any)[0].(map[string]any)["text"])
+		}
+		Expect(texts).To(Equal([]any{"Hi", "!"}))
+
+		var body map[string]any
+		Eventually(decodeBody).Should(Receive(&body))
+		Expect(body["stream"]).To(BeTrue())
+	})
+
+	It("should return the errors as gRPC status codes", func() {
+		decodeResponse = func(w http.ResponseWriter, _ bool) {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusTooManyRequests)
+			fmt.Fprint(w, `{"object": "error", "message": "too many requests", "type": "TooManyRequests", "code": 429}`) //nolint:all
+		}
+
+		err := conn.Invoke(ctx, "/"+GRPCServiceName+"/"+grpcMethodChatCompletions, newRequest(), &structpb.Struct{})
+		Expect(status.Code(err)).To(Equal(codes.ResourceExhausted))
+		Expect(status.Convert(err).Message()).To(Equal("too many requests"))
+
+		request := newRequest()
+		delete(request.Fields, "messages")
+		err = conn.Invoke(ctx, "/"+GRPCServiceName+"/"+grpcMethodChatCompletions, request, &structpb.Struct{})
+		Expect(status.Code(err)).To(Equal(codes.InvalidArgument))
+	})
+
+	It("should reject the integers not represented exactly", func() {
+		decodeResponse = func(w http.ResponseWriter, _ bool) {
+			w.Header().Set("Content-Type", "application/json")
+			fmt.Fprint(w, `{"id": "chatcmpl-1", "choices": []}`) //nolint:all
+		}
+
+		request := newRequest()
+		request.Fields["seed"] = structpb.NewNumberValue(1<<53 - 1)
+		err := conn.Invoke(prefillContext(), "/"+GRPCServiceName+"/"+grpcMethodChatCompletions, request, &structpb.Struct{})
+		Expect(err).ToNot(HaveOccurred())
+		var body map[string]any
+		Eventually(decodeBody).Should(Receive(&body))
+		Expect(body["seed"]).To(BeEquivalentTo(1<<53 - 1))
+
+		// 2^63-1 as a double, rounded to 2^63 by the client
+		request.Fields["seed"] = structpb.NewNumberValue(9223372036854775807)
+		err = conn.Invoke(prefillContext(), "/"+GRPCServiceName+"/"+grpcMethodChatCompletions, request, &structpb.Struct{})
+		Expect(status.Code(err)).To(Equal(codes.InvalidArgument))
+		Expect(status.Convert(err).Message()).To(HavePrefix("seed: "))
+
+		request = newRequest()
+		request.Fields["logit_bias"] = structpb.NewStructValue(&structpb.Struct{Fields: map[string]*structpb.Value{
+			"50256": structpb.NewListValue(&structpb.ListValue{Values: []*structpb.Value{structpb.NewNumberValue(-1e20)}}),
+		}})
+		err = conn.Invoke(prefillContext(), "/"+GRPCServiceName+"/"+grpcMethodChatCompletions, request, &structpb.Struct{})
+		Expect(status.Convert(err).Message()).To(HavePrefix("logit_bias.50256[0]: "))
+		Consistently(decodeBody, 100*time.Millisecond).ShouldNot(Receive())
+	})
+
+	It("should describe the service with reflection", func() {
+		client, err := reflectionpb.NewServerReflectionClient(conn).ServerReflectionInfo(ctx)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(client.Send(&reflectionpb.ServerReflectionRequest{
+			MessageRequest: &reflectionpb.ServerReflectionRequest_ListServices{},
+		})).To(Succeed())
+		response, err := client.Recv()
+		Expect(err).ToNot(HaveOccurred())
+
+		var services []string
+		for _, service := range response.GetListServicesResponse().GetService() {
+			services = append(services, service.GetName())
+		}
+		Expect(services).To(ContainElement(GRPCServiceName))
+
+		Expect(client.Send(&reflectionpb.ServerReflectionRequest{
+			MessageRequest: &reflectionpb.ServerReflectionRequest_FileContainingSymbol{FileContainingSymbol: GRPCServiceName},
+		})).To(Succeed())
+		response, err = client.Recv()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(response.GetFileDescriptorResponse().GetFileDescriptorProto()).ToNot(BeEmpty())
+	})
+})
@@ -0,0 +1,73 @@
+/*
+Copyright 2025 The llm-d Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package proxy
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+const (
+	decoderHealthPath    = "/health"
+	decoderHealthTimeout = 5 * time.Second
+)
+
+// RankHealth is the health of the vLLM engine handling a data parallel rank
+type RankHealth struct {
+	Rank    int    `json:"rank"`
+	Pool    string `json:"pool,omitempty"`
+	Port    string `json:"port"`
+	Decoder string `json:"decoder"`
+	Healthy bool   `json:"healthy"`
+	Message string `json:"message,omitempty"`
+}
+
+// Health checks the health of the decoder the proxy forwards requests to
+func (s *Server) Health(ctx context.Context) RankHealth {
+	health := RankHealth{
+		Rank:    s.config.DataParallelRank,
+		Pool:    s.config.Pool,
+		Port:    s.port,
+		Decoder: s.decoderAddress(),
+	}
+
+	if s.sleeping.Load() {
+		health.Message = "decoder sleeping"
+		return health
+	}
+
+	ctx, cancelFn := context.WithTimeout(ctx, decoderHealthTimeout)
+	defer cancelFn()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, decoderHealthPath, nil)
+	if err != nil {
+		health.Message = err.Error()
+		return health
+	}
+
+	rw := &bufferedResponseWriter{}
+	s.localDecoderProxy.ServeHTTP(rw, req)
+
+	if rw.statusCode != http.StatusOK {
+		health.Message = fmt.Sprintf("decoder returned status code %d", rw.statusCode)
+		return health
+	}
+	health.Healthy = true
+	return health
+}
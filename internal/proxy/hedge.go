@@ -0,0 +1,132 @@
+/*
+Copyright 2025 The llm-d Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package proxy
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/llm-d/llm-d-routing-sidecar/internal/metrics"
+)
+
+// hedgeResult is the buffered response of a hedged decode request
+type hedgeResult struct {
+	rw    *bufferedResponseWriter
+	hedge bool
+}
+
+// decodeWithHedging sends a decode-only request to the local decoder. When hedging is
+// enabled, a non-streaming request still running after the hedge delay is also sent to a
+// sibling rank: the first successful response is returned and the slower request canceled.
+// Disaggregated decodes are never hedged since the prefilled KV blocks are pulled once.
+func (s *Server) decodeWithHedging(w http.ResponseWriter, r *http.Request, body []byte) {
+	r, body, ok := s.preDecodeBody(w, r, body)
+	if !ok {
+		return
+	}
+
+	stream := s.isStreamRequest(r, body)
+	if s.config.DecodeReplay && !stream && !s.hedging() {
+		s.decodeWithReplay(w, r, body)
+		return
+	}
+	if !s.hedging() || stream {
+		s.decoderProxy.ServeHTTP(w, r)
+		return
+	}
+	body = bytes.Clone(body) // the slower request outlives the handler releasing pooled bodies
+
+	ctx, cancelFn := context.WithCancel(r.Context())
+	defer cancelFn() // cancels the slower request
+
+	results := make(chan hedgeResult, 2)
+	send := func(handler http.Handler, hedge bool) {
+		req := r.Clone(ctx)
+		setRequestBody(req, io.NopCloser(bytes.NewReader(body)), len(body))
+
+		rw := &bufferedResponseWriter{}
+		handler.ServeHTTP(rw, req)
+		results <- hedgeResult{rw: rw, hedge: hedge}
+	}
+	go send(s.decoderProxy, false)
+
+	timer := time.NewTimer(s.config.DataParallelHedgeDelay)
+	defer timer.Stop()
+
+	var result hedgeResult
+	select {
+	case result = <-results:
+	case <-timer.C:
+		sibling := s.healthySibling()
+		if sibling == nil {
+			result = <-results
+			break
+		}
+
+		s.logger.V(4).Info("decode request exceeded the hedge delay, hedging", "siblingRank", sibling.config.DataParallelRank)
+		go send(sibling.localDecoderProxy, true)
+		traceFallback(r.Context(), "decode exceeded the hedge delay, hedged on "+traceRank(sibling))
+
+		result = <-results
+		if result.rw.statusCode == 0 || result.rw.statusCode >= 500 {
+			// the other request may still succeed
+			if other := <-results; other.rw.statusCode > 0 && other.rw.statusCode < 500 {
+				result = other
+			}
+		}
+		metrics.RecordHedgedRequest(s.rank(), result.hedge)
+		if result.hedge {
+			traceFallback(r.Context(), "served by the hedged request")
+		}
+	}
+
+	for name, values := range result.rw.Header() {
+		w.Header()[name] = values
+	}
+	if result.rw.statusCode == 0 {
+		result.rw.statusCode = http.StatusBadGateway
+	}
+	w.WriteHeader(result.rw.statusCode)
+	if _, err := w.Write(result.rw.buffer.Bytes()); err != nil {
+		s.logger.Error(err, "failed to send response to client")
+	}
+}
+
+// hedging reports whether decode-only requests may be hedged
+func (s *Server) hedging() bool {
+	return s.config.DataParallelHedgeDelay > 0 && len(s.siblings) > 0
+}
+
+// isStreamRequest returns true when the request asks for a streamed response, as parsed by
+// the handler unless a middleware may have rewritten the body
+func (s *Server) isStreamRequest(r *http.Request, body []byte) bool {
+	if info := requestInfoFrom(r.Context()); info != nil && info.parsed != nil && len(s.config.Middlewares) == 0 {
+		return info.parsed.stream
+	}
+
+	var request struct {
+		Stream bool `json:"stream"`
+	}
+	if err := json.Unmarshal(body, &request); err != nil {
+		return false
+	}
+	return request.Stream
+}
@@ -0,0 +1,117 @@
+/*
+Copyright 2025 The llm-d Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package proxy
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2" // nolint:revive
+	. "github.com/onsi/gomega"    // nolint:revive
+	"k8s.io/klog/v2/ktesting"
+)
+
+var _ = Describe("Data parallel hedging", func() {
+	var (
+		slowCanceled atomic.Bool
+		fastCount    atomic.Int32
+		slowDelay    time.Duration
+		proxyBaseURL string
+	)
+
+	BeforeEach(func() {
+		_, ctx := ktesting.NewTestContext(GinkgoT())
+		ctx, cancelFn := context.WithCancel(ctx)
+		DeferCleanup(cancelFn)
+
+		slowCanceled.Store(false)
+		fastCount.Store(0)
+
+		slowBackend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			io.ReadAll(r.Body) //nolint:all
+			select {
+			case <-time.After(slowDelay):
+				w.Write([]byte(`{"rank": 0}`)) //nolint:all
+			case <-r.Context().Done():
+				slowCanceled.Store(true)
+			}
+		}))
+		DeferCleanup(slowBackend.Close)
+
+		fastBackend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			io.ReadAll(r.Body) //nolint:all
+			fastCount.Add(1)
+			w.Write([]byte(`{"rank": 1}`)) //nolint:all
+		}))
+		DeferCleanup(fastBackend.Close)
+
+		servers := make([]*Server, 0, 2)
+		for rank, backend := range []*httptest.Server{slowBackend, fastBackend} {
+			decodeURL, err := url.Parse(backend.URL)
+			Expect(err).ToNot(HaveOccurred())
+
+			config := Config{Connector: ConnectorNIXLV2, DataParallelRank: rank, DataParallelHedgeDelay: 100 * time.Millisecond}
+			proxy, err := NewProxy("0", decodeURL, config)
+			Expect(err).ToNot(HaveOccurred())
+			servers = append(servers, proxy)
+		}
+		LinkDataParallelRanks(servers...)
+
+		slow := servers[0]
+		go func() {
+			defer GinkgoRecover()
+			Expect(slow.Start(ctx)).To(Succeed())
+		}()
+		Eventually(func() net.Addr { return slow.Addr() }).ShouldNot(BeNil())
+		proxyBaseURL = "http://" + slow.Addr().String()
+	})
+
+	post := func(body string) string {
+		resp, err := http.Post(proxyBaseURL+ChatCompletionsPath, "application/json", strings.NewReader(body))
+		Expect(err).ToNot(HaveOccurred())
+		defer resp.Body.Close() //nolint:all
+		Expect(resp.StatusCode).To(Equal(http.StatusOK))
+
+		b, err := io.ReadAll(resp.Body)
+		Expect(err).ToNot(HaveOccurred())
+		return string(b)
+	}
+
+	It("should return the response of the sibling rank and cancel the slower request", func() {
+		slowDelay = 5 * time.Second
+
+		start := time.Now()
+		Expect(post(`{"model": "food-review", "messages": [{"role": "user", "content": "hello"}]}`)).To(Equal(`{"rank": 1}`))
+		Expect(time.Since(start)).To(BeNumerically("<", 2*time.Second))
+		Expect(fastCount.Load()).To(BeNumerically("==", 1))
+		Eventually(slowCanceled.Load).Should(BeTrue())
+	})
+
+	It("should not hedge streaming requests", func() {
+		slowDelay = 300 * time.Millisecond
+
+		Expect(post(`{"model": "food-review", "stream": true, "messages": [{"role": "user", "content": "hello"}]}`)).To(Equal(`{"rank": 0}`))
+		Expect(fastCount.Load()).To(BeNumerically("==", 0))
+	})
+})
@@ -0,0 +1,261 @@
+/*
+Copyright 2025 The llm-d Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package proxy
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/llm-d/llm-d-routing-sidecar/internal/metrics"
+)
+
+const (
+	stagePassthrough = "passthrough"
+	stagePrefill     = "prefill"
+	stageDecode      = "decode"
+)
+
+type inflightKey struct{}
+
+// InflightRequest summarizes a request currently handled by the proxy
+type InflightRequest struct {
+	ID         uint64    `json:"id"`
+	Method     string    `json:"method"`
+	Path       string    `json:"path"`
+	Prefiller  string    `json:"prefiller,omitempty"`
+	Stage      string    `json:"stage"`
+	Stream     bool      `json:"stream,omitempty"`
+	Started    time.Time `json:"started"`
+	AgeSeconds float64   `json:"ageSeconds"`
+
+	// cancel interrupts the request at shutdown, nil unless interruptible
+	cancel context.CancelCauseFunc
+}
+
+// inflightTracker keeps track of the requests currently handled by the proxy
+type inflightTracker struct {
+	mu       sync.Mutex
+	nextID   uint64
+	requests map[uint64]*InflightRequest
+
+	// draining is set once the proxy shuts down, waiting for the requests to complete
+	draining bool
+
+	// interruptible requests can be interrupted at shutdown, depending on the shutdown policy
+	interruptible bool
+}
+
+var streamRecorderPool = sync.Pool{
+	New: func() any { return new(streamRecorder) },
+}
+
+// streamRecorder marks the in-flight request as a stream once its response headers are
+// sent with the event stream content type. The response of a request interrupted at shutdown
+// before it started is replaced by a retryable error.
+type streamRecorder struct {
+	http.ResponseWriter
+	tracker  *inflightTracker
+	req      *InflightRequest
+	ctx      context.Context // the interruptible context, nil unless interruptible
+	sent     bool
+	replaced bool
+}
+
+func (r *streamRecorder) WriteHeader(statusCode int) {
+	if r.replaced {
+		return
+	}
+	if !r.headersSent(statusCode) {
+		r.ResponseWriter.WriteHeader(statusCode)
+	}
+}
+
+func (r *streamRecorder) Write(b []byte) (int, error) {
+	if !r.sent {
+		r.WriteHeader(http.StatusOK)
+	}
+	if r.replaced {
+		return len(b), nil
+	}
+	return r.ResponseWriter.Write(b)
+}
+
+// headersSent checks the final response headers, and returns whether the response is
+// replaced by a retryable error
+func (r *streamRecorder) headersSent(statusCode int) bool {
+	if r.sent || statusCode < http.StatusOK {
+		return false
+	}
+	r.sent = true
+	if r.ctx != nil && errors.Is(context.Cause(r.ctx), errShuttingDown) {
+		r.replaced = true
+		errorShuttingDown(r.ResponseWriter) //nolint:all
+		return true
+	}
+	if strings.HasPrefix(r.Header().Get("Content-Type"), eventStreamContentType) {
+		r.tracker.mu.Lock()
+		r.req.Stream = true
+		r.tracker.mu.Unlock()
+	}
+	return false
+}
+
+// finish answers with a retryable error the requests interrupted before writing anything
+func (r *streamRecorder) finish() {
+	if !r.sent && r.ctx != nil && errors.Is(context.Cause(r.ctx), errShuttingDown) {
+		r.WriteHeader(http.StatusServiceUnavailable)
+	}
+}
+
+// Unwrap allows http.ResponseController to flush and hijack the wrapped ResponseWriter
+func (r *streamRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
+
+func newInflightTracker() *inflightTracker {
+	return &inflightTracker{
+		requests: make(map[uint64]*InflightRequest),
+	}
+}
+
+// middleware registers each request for the duration of the wrapped handler
+func (t *inflightTracker) middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// the invalid prefiller headers are rejected by the handler
+		targets, _, _ := prefillTargets(r.Header)
+		prefiller := strings.Join(targets, ",")
+
+		req := &InflightRequest{
+			Method:    r.Method,
+			Path:      r.URL.Path,
+			Prefiller: prefiller,
+			Stage:     stagePassthrough,
+			Started:   time.Now(),
+		}
+		rec := streamRecorderPool.Get().(*streamRecorder)
+		rec.ResponseWriter, rec.tracker, rec.req = w, t, req
+		if t.interruptible {
+			var ctx context.Context
+			ctx, req.cancel = context.WithCancelCause(r.Context())
+			rec.ctx = ctx
+			r = r.WithContext(ctx)
+		}
+
+		t.mu.Lock()
+		t.nextID++
+		req.ID = t.nextID
+		t.requests[req.ID] = req
+		t.mu.Unlock()
+
+		defer func() {
+			if req.cancel != nil {
+				rec.finish()
+				req.cancel(nil)
+			}
+			t.mu.Lock()
+			delete(t.requests, req.ID)
+			t.mu.Unlock()
+
+			*rec = streamRecorder{}
+			streamRecorderPool.Put(rec)
+		}()
+
+		if prefiller == "" {
+			// the stage of requests without prefiller never changes: save the request copy
+			next.ServeHTTP(rec, r)
+			return
+		}
+		next.ServeHTTP(rec, r.WithContext(context.WithValue(r.Context(), inflightKey{}, req)))
+	})
+}
+
+// setStage records the protocol stage the request associated with ctx is in, also for the
+// cancellation metrics
+func (t *inflightTracker) setStage(ctx context.Context, stage string) {
+	setPhase(ctx, stage)
+
+	req, ok := ctx.Value(inflightKey{}).(*InflightRequest)
+	if !ok {
+		return
+	}
+
+	t.mu.Lock()
+	req.Stage = stage
+	t.mu.Unlock()
+}
+
+// drain records the proxy is shutting down, and returns the number of requests and streams
+// in flight
+func (t *inflightTracker) drain() (int, int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.draining = true
+	streams := 0
+	for _, req := range t.requests {
+		if req.Stream {
+			streams++
+		}
+	}
+	return len(t.requests), streams
+}
+
+// len returns the number of requests in flight
+func (t *inflightTracker) len() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return len(t.requests)
+}
+
+// connectionStats returns the ages of the streams in flight and the drain progress, for the
+// metrics
+func (t *inflightTracker) connectionStats() metrics.ConnectionStats {
+	now := time.Now()
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	stats := metrics.ConnectionStats{Draining: t.draining, Requests: len(t.requests)}
+	for _, req := range t.requests {
+		if req.Stream {
+			stats.StreamAges = append(stats.StreamAges, now.Sub(req.Started))
+		}
+	}
+	return stats
+}
+
+// snapshot returns the in-flight requests, oldest first
+func (t *inflightTracker) snapshot() []InflightRequest {
+	now := time.Now()
+
+	t.mu.Lock()
+	requests := make([]InflightRequest, 0, len(t.requests))
+	for _, req := range t.requests {
+		r := *req
+		r.AgeSeconds = now.Sub(r.Started).Seconds()
+		requests = append(requests, r)
+	}
+	t.mu.Unlock()
+
+	sort.Slice(requests, func(i, j int) bool {
+		return requests[i].ID < requests[j].ID
+	})
+	return requests
+}
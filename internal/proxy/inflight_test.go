@@ -0,0 +1,71 @@
+/*
+Copyright 2025 The llm-d Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+
+	. "github.com/onsi/ginkgo/v2" // nolint:revive
+	. "github.com/onsi/gomega"    // nolint:revive
+)
+
+var _ = Describe("In-flight requests", func() {
+	var tracker *inflightTracker
+
+	BeforeEach(func() {
+		tracker = newInflightTracker()
+	})
+
+	// serve sends a request through the tracker, checking the in-flight requests once the
+	// response headers are sent
+	serve := func(contentType string, check func()) {
+		handler := tracker.middleware(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+			w.Header().Set("Content-Type", contentType)
+			w.WriteHeader(http.StatusOK)
+			http.NewResponseController(w).Flush() //nolint:all
+			check()
+		}))
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, CompletionsPath, nil))
+	}
+
+	It("should mark the streamed responses", func() {
+		serve("text/event-stream; charset=utf-8", func() {
+			Expect(tracker.snapshot()).To(ConsistOf(HaveField("Stream", true)))
+			Expect(tracker.connectionStats().StreamAges).To(HaveLen(1))
+		})
+		serve("application/json", func() {
+			Expect(tracker.snapshot()).To(ConsistOf(HaveField("Stream", false)))
+			Expect(tracker.connectionStats().StreamAges).To(BeEmpty())
+		})
+		Expect(tracker.len()).To(BeZero())
+	})
+
+	It("should report the drain progress", func() {
+		Expect(tracker.connectionStats().Draining).To(BeFalse())
+		serve("text/event-stream", func() {
+			requests, streams := tracker.drain()
+			Expect(requests).To(Equal(1))
+			Expect(streams).To(Equal(1))
+
+			stats := tracker.connectionStats()
+			Expect(stats.Draining).To(BeTrue())
+			Expect(stats.Requests).To(Equal(1))
+		})
+		Expect(tracker.connectionStats().Requests).To(BeZero())
+	})
+})
@@ -0,0 +1,150 @@
+/*
+Copyright 2025 The llm-d Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package proxy
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/llm-d/llm-d-routing-sidecar/internal/metrics"
+)
+
+const (
+	decoderMetricsPath   = "/metrics"
+	decoderScrapeTimeout = 10 * time.Second
+	decoderMetricsLabel  = "decoder"
+	unmatchedRouteLabel  = "unmatched"
+)
+
+var statusRecorderPool = sync.Pool{
+	New: func() any { return new(statusRecorder) },
+}
+
+// statusRecorder records the status code written to the wrapped ResponseWriter
+type statusRecorder struct {
+	http.ResponseWriter
+	statusCode int
+}
+
+func (r *statusRecorder) WriteHeader(statusCode int) {
+	if r.statusCode == 0 && statusCode >= 200 {
+		r.statusCode = statusCode
+	}
+	r.ResponseWriter.WriteHeader(statusCode)
+}
+
+func (r *statusRecorder) Write(b []byte) (int, error) {
+	if r.statusCode == 0 {
+		r.statusCode = http.StatusOK
+	}
+	return r.ResponseWriter.Write(b)
+}
+
+// Hijack records upgraded connections as switching protocols
+func (r *statusRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	conn, rw, err := http.NewResponseController(r.ResponseWriter).Hijack()
+	if err == nil && r.statusCode == 0 {
+		r.statusCode = http.StatusSwitchingProtocols
+	}
+	return conn, rw, err
+}
+
+// Unwrap allows http.ResponseController to flush the wrapped ResponseWriter
+func (r *statusRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
+
+// instrumentHandler records the request metrics of the given data parallel rank, and the
+// request stats when not nil. It must directly wrap the mux so the matched route pattern is
+// available once the request is served.
+func instrumentHandler(rank string, stats *statsCollector, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rec := statusRecorderPool.Get().(*statusRecorder)
+		rec.ResponseWriter = w
+
+		next.ServeHTTP(rec, r)
+
+		statusCode := rec.statusCode
+		if statusCode == 0 {
+			statusCode = http.StatusOK
+		}
+		*rec = statusRecorder{}
+		statusRecorderPool.Put(rec)
+		statusCode = clientStatus(r, statusCode)
+		duration := time.Since(start)
+		metrics.RecordRequest(rank, routeLabel(r.Pattern), statusCode, duration, traceID(r.Header))
+		if stats != nil {
+			stats.recordRequest(statusCode, duration)
+		}
+	})
+}
+
+// identify attaches the identity of the sidecar to the span of the request, if any
+func (s *Server) identify(next http.Handler) http.Handler {
+	attributes := s.config.Identity.Attributes()
+	if len(attributes) == 0 {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		trace.SpanFromContext(r.Context()).SetAttributes(attributes...)
+		next.ServeHTTP(w, r)
+	})
+}
+
+// routeLabel returns the path of a mux pattern, without the method
+func routeLabel(pattern string) string {
+	if _, path, found := strings.Cut(pattern, " "); found {
+		pattern = path
+	}
+	if pattern == "" {
+		return unmatchedRouteLabel
+	}
+	return pattern
+}
+
+// scrapeDecoderMetrics fetches the Prometheus metrics exposed by the decoder
+func (s *Server) scrapeDecoderMetrics() (io.Reader, error) {
+	ctx, cancelFn := context.WithTimeout(context.Background(), decoderScrapeTimeout)
+	defer cancelFn()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, decoderMetricsPath, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	rw := &bufferedResponseWriter{}
+	s.localDecoderProxy.ServeHTTP(rw, req)
+
+	if rw.statusCode != http.StatusOK {
+		return nil, fmt.Errorf("decoder returned status code %d", rw.statusCode)
+	}
+	if rw.buffer.Len() == 0 {
+		return nil, errors.New("decoder returned no metrics")
+	}
+	return strings.NewReader(rw.buffer.String()), nil
+}
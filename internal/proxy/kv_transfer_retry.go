@@ -0,0 +1,181 @@
+/*
+Copyright 2025 The llm-d Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package proxy
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/llm-d/llm-d-routing-sidecar/internal/metrics"
+)
+
+const (
+	// KVTransferRetryPrefill retries the requests failing to pull their KV blocks with a fresh prefill
+	KVTransferRetryPrefill = "prefill"
+
+	// KVTransferRetryDecodeOnly retries the requests failing to pull their KV blocks decode-only
+	KVTransferRetryDecodeOnly = "decode-only"
+
+	// maxHeldErrorBytes bounds the error responses of the decoder held back to be inspected
+	maxHeldErrorBytes = 64 << 10
+)
+
+// kvTransferErrorMarkers are found in the error messages of the engines failing to pull the
+// KV blocks of a request from its prefiller
+var kvTransferErrorMarkers = []string{"kv transfer", "kv_transfer", "nixl", "remote block", "remote_block"}
+
+type kvTransferRetryKey struct{}
+
+// heldErrorWriter holds back the error response of the decoder, so the request can be retried
+// when it reports a KV transfer failure. Other responses are written through.
+type heldErrorWriter struct {
+	http.ResponseWriter
+	header     http.Header
+	statusCode int
+	held       bool
+	buffer     bytes.Buffer
+}
+
+func newHeldErrorWriter(w http.ResponseWriter) *heldErrorWriter {
+	// the headers already set, e.g. the request reference, are kept for the held responses
+	return &heldErrorWriter{ResponseWriter: w, header: w.Header().Clone()}
+}
+
+// Header returns the headers of the held response until the status is known
+func (w *heldErrorWriter) Header() http.Header {
+	if w.statusCode != 0 && !w.held {
+		return w.ResponseWriter.Header()
+	}
+	return w.header
+}
+
+func (w *heldErrorWriter) WriteHeader(statusCode int) {
+	if w.statusCode != 0 {
+		if !w.held {
+			w.ResponseWriter.WriteHeader(statusCode)
+		}
+		return
+	}
+	if statusCode < http.StatusOK {
+		// informational headers are not part of the final response
+		for key, values := range w.header {
+			w.ResponseWriter.Header()[key] = values
+		}
+		w.ResponseWriter.WriteHeader(statusCode)
+		for key := range w.header {
+			w.ResponseWriter.Header().Del(key)
+		}
+		return
+	}
+	w.statusCode = statusCode
+	if statusCode >= http.StatusBadRequest {
+		w.held = true
+		return
+	}
+	for key, values := range w.header {
+		w.ResponseWriter.Header()[key] = values
+	}
+	w.ResponseWriter.WriteHeader(statusCode)
+}
+
+func (w *heldErrorWriter) Write(b []byte) (int, error) {
+	if w.statusCode == 0 {
+		w.WriteHeader(http.StatusOK)
+	}
+	if w.held {
+		if w.buffer.Len() < maxHeldErrorBytes {
+			w.buffer.Write(b)
+		}
+		return len(b), nil
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+// FlushError flushes the responses written through, a held one would be committed otherwise
+func (w *heldErrorWriter) FlushError() error {
+	if w.held {
+		return nil
+	}
+	return http.NewResponseController(w.ResponseWriter).Flush()
+}
+
+// Unwrap allows http.ResponseController to reach the wrapped ResponseWriter
+func (w *heldErrorWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// release writes the held error response, if any
+func (w *heldErrorWriter) release() {
+	if !w.held {
+		return
+	}
+	for key, values := range w.header {
+		w.ResponseWriter.Header()[key] = values
+	}
+	w.ResponseWriter.WriteHeader(w.statusCode)
+	w.ResponseWriter.Write(w.buffer.Bytes()) //nolint:all
+}
+
+// kvTransferFailed reports whether the held error response of the decoder reports a failure
+// to pull the KV blocks from the prefiller
+func (w *heldErrorWriter) kvTransferFailed() bool {
+	if !w.held {
+		return false
+	}
+	var response struct {
+		Message string `json:"message"`
+		Error   struct {
+			Message string `json:"message"`
+		} `json:"error"`
+	}
+	message := w.buffer.String()
+	if err := json.Unmarshal(w.buffer.Bytes(), &response); err == nil {
+		message = response.Message + response.Error.Message
+	}
+	message = strings.ToLower(message)
+	for _, marker := range kvTransferErrorMarkers {
+		if strings.Contains(message, marker) {
+			return true
+		}
+	}
+	return false
+}
+
+// retryKVTransfer retries once a disaggregated request whose decoder failed to pull the KV
+// blocks, with a fresh prefill or decode-only. It reports whether the request was retried.
+func (s *Server) retryKVTransfer(w http.ResponseWriter, r *http.Request, original []byte, prefillPodHostPort string) bool {
+	retry := s.config.KVTransferRetry
+	if retry == "" || r.Context().Err() != nil || r.Context().Value(kvTransferRetryKey{}) != nil {
+		return false
+	}
+	s.logger.V(4).Info("decoder failed to pull the KV blocks, retrying the request", "retry", retry, "prefiller", prefillPodHostPort)
+	metrics.RecordKVTransferRetry(s.rank(), retry)
+	traceFallback(r.Context(), "KV transfer failed, retried "+retry)
+
+	if retry == KVTransferRetryDecodeOnly {
+		s.runDecodeOnly(w, r, original)
+		return true
+	}
+	req := r.Clone(context.WithValue(r.Context(), kvTransferRetryKey{}, true))
+	setRequestBody(req, io.NopCloser(bytes.NewReader(original)), len(original))
+	s.runNIXLProtocolV2(w, req, prefillPodHostPort)
+	return true
+}
@@ -0,0 +1,188 @@
+/*
+Copyright 2025 The llm-d Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package proxy
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync/atomic"
+
+	"github.com/llm-d/llm-d-routing-sidecar/internal/metrics"
+	"github.com/llm-d/llm-d-routing-sidecar/test/mock"
+	. "github.com/onsi/ginkgo/v2" // nolint:revive
+	. "github.com/onsi/gomega"    // nolint:revive
+	"k8s.io/klog/v2/ktesting"
+)
+
+var _ = Describe("KV transfer retries", func() {
+	const (
+		rank            = 49
+		kvTransferError = `{"object":"error","message":"NIXL transfer failed: remote blocks not found","type":"InternalServerError","code":500}`
+	)
+
+	var (
+		prefillHandler *mock.ChatCompletionHandler
+		decodeHandler  *mock.ChatCompletionHandler
+		decodeFailures atomic.Int32
+		decodeError    string
+		retry          string
+		proxyBaseURL   string
+		prefiller      string
+	)
+
+	sendRequest := func() (int, errorResponse) {
+		req, err := http.NewRequest(http.MethodPost, proxyBaseURL+CompletionsPath, strings.NewReader(`{"model": "m", "prompt": "Hello"}`))
+		Expect(err).ToNot(HaveOccurred())
+		req.Header.Add(requestHeaderPrefillHostPort, prefiller)
+
+		resp, err := http.DefaultClient.Do(req)
+		Expect(err).ToNot(HaveOccurred())
+		defer resp.Body.Close() //nolint:all
+
+		var er errorResponse
+		if resp.StatusCode != http.StatusOK {
+			Expect(json.NewDecoder(resp.Body).Decode(&er)).To(Succeed())
+		}
+		return resp.StatusCode, er
+	}
+
+	retries := func(retry string) float64 {
+		families, err := metrics.Registry.Gather()
+		Expect(err).ToNot(HaveOccurred())
+		for _, family := range families {
+			if family.GetName() != "llm_d_routing_sidecar_kv_transfer_retries_total" {
+				continue
+			}
+			for _, metric := range family.Metric {
+				labels := map[string]string{}
+				for _, label := range metric.Label {
+					labels[label.GetName()] = label.GetValue()
+				}
+				if labels[metrics.RankLabel] == "49" && labels["retry"] == retry {
+					return metric.GetCounter().GetValue()
+				}
+			}
+		}
+		return 0
+	}
+
+	BeforeEach(func() {
+		decodeFailures.Store(1)
+		decodeError = kvTransferError
+		retry = ""
+	})
+
+	JustBeforeEach(func() {
+		_, ctx := ktesting.NewTestContext(GinkgoT())
+		ctx, cancelFn := context.WithCancel(ctx)
+		DeferCleanup(cancelFn)
+
+		prefillHandler = &mock.ChatCompletionHandler{Connector: ConnectorNIXLV2, Role: mock.RolePrefill}
+		prefillBackend := httptest.NewServer(prefillHandler)
+		DeferCleanup(prefillBackend.Close)
+
+		decodeHandler = &mock.ChatCompletionHandler{Connector: ConnectorNIXLV2, Role: mock.RoleDecode}
+		decodeBackend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path == CompletionsPath && decodeFailures.Load() > 0 {
+				decodeFailures.Add(-1)
+				io.Copy(io.Discard, r.Body) //nolint:all
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(http.StatusInternalServerError)
+				w.Write([]byte(decodeError)) //nolint:all
+				return
+			}
+			decodeHandler.ServeHTTP(w, r)
+		}))
+		DeferCleanup(decodeBackend.Close)
+
+		decodeURL, err := url.Parse(decodeBackend.URL)
+		Expect(err).ToNot(HaveOccurred())
+		proxy, err := NewProxy("0", decodeURL, Config{Connector: ConnectorNIXLV2, KVTransferRetry: retry, DataParallelRank: rank})
+		Expect(err).ToNot(HaveOccurred())
+
+		go func() {
+			defer GinkgoRecover()
+			Expect(proxy.Start(ctx)).To(Succeed())
+		}()
+		Eventually(func() net.Addr { return proxy.Addr() }).ShouldNot(BeNil())
+		proxyBaseURL = "http://" + proxy.Addr().String()
+		prefiller = prefillBackend.Listener.Addr().String()
+	})
+
+	It("should relay the KV transfer failures when disabled", func() {
+		statusCode, er := sendRequest()
+		Expect(statusCode).To(Equal(http.StatusInternalServerError))
+		Expect(er.Message).To(Equal("NIXL transfer failed: remote blocks not found"))
+		Expect(prefillHandler.RequestCount.Load()).To(BeNumerically("==", 1))
+	})
+
+	Context("with fresh prefill retries", func() {
+		BeforeEach(func() {
+			retry = KVTransferRetryPrefill
+		})
+
+		It("should retry the request with a fresh prefill", func() {
+			before := retries(KVTransferRetryPrefill)
+
+			statusCode, _ := sendRequest()
+			Expect(statusCode).To(Equal(http.StatusOK))
+			Expect(prefillHandler.RequestCount.Load()).To(BeNumerically("==", 2))
+			Expect(decodeHandler.CompletionRequests[0]).To(HaveKey(requestFieldKVTransferParams))
+			Expect(retries(KVTransferRetryPrefill)).To(Equal(before + 1))
+		})
+
+		It("should retry the request once", func() {
+			decodeFailures.Store(2)
+
+			statusCode, er := sendRequest()
+			Expect(statusCode).To(Equal(http.StatusInternalServerError))
+			Expect(er.Message).To(Equal("NIXL transfer failed: remote blocks not found"))
+			Expect(prefillHandler.RequestCount.Load()).To(BeNumerically("==", 2))
+		})
+
+		It("should not retry the other decoder errors", func() {
+			decodeError = `{"object":"error","message":"out of memory","type":"InternalServerError","code":500}`
+
+			statusCode, er := sendRequest()
+			Expect(statusCode).To(Equal(http.StatusInternalServerError))
+			Expect(er.Message).To(Equal("out of memory"))
+			Expect(prefillHandler.RequestCount.Load()).To(BeNumerically("==", 1))
+		})
+	})
+
+	Context("with decode-only retries", func() {
+		BeforeEach(func() {
+			retry = KVTransferRetryDecodeOnly
+		})
+
+		It("should retry the request decode-only", func() {
+			before := retries(KVTransferRetryDecodeOnly)
+
+			statusCode, _ := sendRequest()
+			Expect(statusCode).To(Equal(http.StatusOK))
+			Expect(prefillHandler.RequestCount.Load()).To(BeNumerically("==", 1))
+			Expect(decodeHandler.CompletionRequests[0]).ToNot(HaveKey(requestFieldKVTransferParams))
+			Expect(retries(KVTransferRetryDecodeOnly)).To(Equal(before + 1))
+		})
+	})
+})
@@ -0,0 +1,75 @@
+/*
+Copyright 2025 The llm-d Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package proxy
+
+import (
+	"errors"
+	"net"
+	"net/http"
+)
+
+// listen listens on the port of each bind address, or of all the interfaces without bind address
+func listen(bindAddresses []string, port string) ([]net.Listener, error) {
+	if len(bindAddresses) == 0 {
+		bindAddresses = []string{""}
+	}
+
+	listeners := make([]net.Listener, 0, len(bindAddresses))
+	for _, address := range bindAddresses {
+		ln, err := net.Listen("tcp", net.JoinHostPort(address, port))
+		if err != nil {
+			for _, ln := range listeners {
+				ln.Close() //nolint:all
+			}
+			return nil, err
+		}
+		listeners = append(listeners, ln)
+	}
+	return listeners, nil
+}
+
+// serve serves the listeners until the server is shut down, or one of them fails
+func serve(server *http.Server, listeners []net.Listener, useTLS bool) error {
+	errs := make(chan error, len(listeners))
+	for _, ln := range listeners {
+		go func() {
+			if useTLS {
+				errs <- server.ServeTLS(ln, "", "")
+			} else {
+				errs <- server.Serve(ln)
+			}
+		}()
+	}
+
+	err := http.ErrServerClosed
+	for range listeners {
+		if serveErr := <-errs; !errors.Is(serveErr, http.ErrServerClosed) && errors.Is(err, http.ErrServerClosed) {
+			err = serveErr
+			server.Close() //nolint:all // stop serving the other listeners
+		}
+	}
+	return err
+}
+
+// listenerAddrs returns the addresses of the listeners, for logging
+func listenerAddrs(listeners []net.Listener) []string {
+	addrs := make([]string, 0, len(listeners))
+	for _, ln := range listeners {
+		addrs = append(addrs, ln.Addr().String())
+	}
+	return addrs
+}
@@ -0,0 +1,75 @@
+/*
+Copyright 2025 The llm-d Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package proxy
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"strconv"
+
+	. "github.com/onsi/ginkgo/v2" // nolint:revive
+	. "github.com/onsi/gomega"    // nolint:revive
+)
+
+var _ = Describe("Listeners", func() {
+	var port string
+
+	BeforeEach(func() {
+		ln, err := net.Listen("tcp", "127.0.0.1:0")
+		Expect(err).ToNot(HaveOccurred())
+		port = strconv.Itoa(ln.Addr().(*net.TCPAddr).Port)
+		Expect(ln.Close()).To(Succeed())
+	})
+
+	It("should serve each bind address until shut down", func() {
+		listeners, err := listen([]string{"127.0.0.1", "127.0.0.2"}, port)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(listenerAddrs(listeners)).To(Equal([]string{"127.0.0.1:" + port, "127.0.0.2:" + port}))
+
+		server := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+			w.WriteHeader(http.StatusNoContent)
+		})}
+		done := make(chan error, 1)
+		go func() {
+			done <- serve(server, listeners, false)
+		}()
+
+		for _, address := range []string{"127.0.0.1", "127.0.0.2"} {
+			Eventually(func() (int, error) {
+				resp, err := http.Get("http://" + net.JoinHostPort(address, port) + "/health")
+				if err != nil {
+					return 0, err
+				}
+				resp.Body.Close() //nolint:all
+				return resp.StatusCode, nil
+			}).Should(Equal(http.StatusNoContent))
+		}
+
+		Expect(server.Shutdown(context.Background())).To(Succeed())
+		Eventually(done).Should(Receive(Equal(http.ErrServerClosed)))
+	})
+
+	It("should release the listeners when an address fails", func() {
+		_, err := listen([]string{"127.0.0.1", "127.0.0.1"}, port)
+		Expect(err).To(HaveOccurred())
+
+		listeners, err := listen([]string{"127.0.0.1"}, port)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(listeners[0].Close()).To(Succeed())
+	})
+})
@@ -0,0 +1,797 @@
+/*
+Copyright 2025 The llm-d Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package proxy
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+var (
+	// MessagesPath is the Anthropic messages path
+	MessagesPath = "/v1/messages"
+)
+
+const (
+	requestHeaderAPIKey = "x-api-key"
+
+	anthropicBlockText       = "text"
+	anthropicBlockImage      = "image"
+	anthropicBlockToolUse    = "tool_use"
+	anthropicBlockToolResult = "tool_result"
+)
+
+// anthropicMessagesRequest is the subset of the Anthropic messages request translated to a chat completion request
+type anthropicMessagesRequest struct {
+	Model         string               `json:"model"`
+	MaxTokens     int                  `json:"max_tokens"`
+	System        json.RawMessage      `json:"system"`
+	Messages      []anthropicMessage   `json:"messages"`
+	StopSequences []string             `json:"stop_sequences"`
+	Stream        bool                 `json:"stream"`
+	Temperature   *float64             `json:"temperature"`
+	TopP          *float64             `json:"top_p"`
+	TopK          *int                 `json:"top_k"`
+	Tools         []anthropicTool      `json:"tools"`
+	ToolChoice    *anthropicToolChoice `json:"tool_choice"`
+}
+
+type anthropicMessage struct {
+	Role    string          `json:"role"`
+	Content json.RawMessage `json:"content"`
+}
+
+type anthropicContentBlock struct {
+	Type      string                `json:"type"`
+	Text      string                `json:"text,omitempty"`
+	Source    *anthropicImageSource `json:"source,omitempty"`
+	ID        string                `json:"id,omitempty"`
+	Name      string                `json:"name,omitempty"`
+	Input     json.RawMessage       `json:"input,omitempty"`
+	ToolUseID string                `json:"tool_use_id,omitempty"`
+	Content   json.RawMessage       `json:"content,omitempty"`
+}
+
+type anthropicImageSource struct {
+	Type      string `json:"type"`
+	MediaType string `json:"media_type"`
+	Data      string `json:"data"`
+	URL       string `json:"url"`
+}
+
+type anthropicTool struct {
+	Name        string          `json:"name"`
+	Description string          `json:"description"`
+	InputSchema json.RawMessage `json:"input_schema"`
+}
+
+type anthropicToolChoice struct {
+	Type string `json:"type"`
+	Name string `json:"name"`
+}
+
+type anthropicUsage struct {
+	InputTokens  int `json:"input_tokens"`
+	OutputTokens int `json:"output_tokens"`
+}
+
+// anthropicMessagesResponse is the Anthropic message translated from a chat completion response
+type anthropicMessagesResponse struct {
+	ID           string                  `json:"id"`
+	Type         string                  `json:"type"`
+	Role         string                  `json:"role"`
+	Model        string                  `json:"model"`
+	Content      []anthropicContentBlock `json:"content"`
+	StopReason   *string                 `json:"stop_reason"`
+	StopSequence *string                 `json:"stop_sequence"`
+	Usage        anthropicUsage          `json:"usage"`
+}
+
+// Anthropic error response
+type anthropicErrorResponse struct {
+	Type      string         `json:"type"`
+	Error     anthropicError `json:"error"`
+	RequestID string         `json:"request_id,omitempty"`
+}
+
+type anthropicError struct {
+	Type    string `json:"type"`
+	Message string `json:"message"`
+}
+
+type openAIChatRequest struct {
+	Model         string               `json:"model"`
+	Messages      []openAIMessage      `json:"messages"`
+	MaxTokens     int                  `json:"max_tokens,omitempty"`
+	Stop          []string             `json:"stop,omitempty"`
+	Stream        bool                 `json:"stream,omitempty"`
+	StreamOptions *openAIStreamOptions `json:"stream_options,omitempty"`
+	Temperature   *float64             `json:"temperature,omitempty"`
+	TopP          *float64             `json:"top_p,omitempty"`
+	TopK          *int                 `json:"top_k,omitempty"`
+	Tools         []openAITool         `json:"tools,omitempty"`
+	ToolChoice    any                  `json:"tool_choice,omitempty"`
+}
+
+type openAIStreamOptions struct {
+	IncludeUsage bool `json:"include_usage"`
+}
+
+type openAIMessage struct {
+	Role       string           `json:"role"`
+	Content    any              `json:"content,omitempty"`
+	ToolCalls  []openAIToolCall `json:"tool_calls,omitempty"`
+	ToolCallID string           `json:"tool_call_id,omitempty"`
+}
+
+type openAIContentPart struct {
+	Type     string          `json:"type"`
+	Text     string          `json:"text,omitempty"`
+	ImageURL *openAIImageURL `json:"image_url,omitempty"`
+}
+
+type openAIImageURL struct {
+	URL string `json:"url"`
+}
+
+type openAIToolCall struct {
+	Index    *int               `json:"index,omitempty"`
+	ID       string             `json:"id,omitempty"`
+	Type     string             `json:"type,omitempty"`
+	Function openAIFunctionCall `json:"function"`
+}
+
+type openAIFunctionCall struct {
+	Name      string `json:"name,omitempty"`
+	Arguments string `json:"arguments"`
+}
+
+type openAITool struct {
+	Type     string         `json:"type"`
+	Function openAIFunction `json:"function"`
+}
+
+type openAIFunction struct {
+	Name        string          `json:"name"`
+	Description string          `json:"description,omitempty"`
+	Parameters  json.RawMessage `json:"parameters,omitempty"`
+}
+
+type openAIUsage struct {
+	PromptTokens     int `json:"prompt_tokens"`
+	CompletionTokens int `json:"completion_tokens"`
+}
+
+// openAIChatResponse is a chat completion response, or a chunk of a streamed one
+type openAIChatResponse struct {
+	ID      string `json:"id"`
+	Model   string `json:"model"`
+	Choices []struct {
+		Message      openAIResponseMessage `json:"message"`
+		Delta        openAIResponseMessage `json:"delta"`
+		FinishReason string                `json:"finish_reason"`
+		StopReason   any                   `json:"stop_reason"`
+	} `json:"choices"`
+	Usage *openAIUsage `json:"usage"`
+}
+
+type openAIResponseMessage struct {
+	Content   string           `json:"content"`
+	ToolCalls []openAIToolCall `json:"tool_calls"`
+}
+
+// messagesHandler serves the Anthropic messages API by translating the requests to chat
+// completion requests, which go through the P/D protocol, and the responses back
+func (s *Server) messagesHandler(w http.ResponseWriter, r *http.Request) {
+	body, err := readRequestBody(w, r, s.config.MaxRequestBodyBytes)
+	r.Body.Close() //nolint:all
+	if err != nil {
+		statusCode := http.StatusBadRequest
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			statusCode = http.StatusRequestEntityTooLarge
+		}
+		s.sendAnthropicError(w, statusCode, err.Error())
+		return
+	}
+
+	var request anthropicMessagesRequest
+	if err := json.Unmarshal(body, &request); err != nil {
+		s.sendAnthropicError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	chatRequest, err := toChatCompletionRequest(&request)
+	if err != nil {
+		s.sendAnthropicError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	cbody, err := json.Marshal(chatRequest)
+	if err != nil {
+		s.sendAnthropicError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	creq := r.Clone(r.Context())
+	creq.URL.Path = ChatCompletionsPath
+	creq.URL.RawPath = ""
+	setRequestBody(creq, io.NopCloser(bytes.NewReader(cbody)), len(cbody))
+	if apiKey := creq.Header.Get(requestHeaderAPIKey); apiKey != "" && creq.Header.Get("Authorization") == "" {
+		creq.Header.Set("Authorization", "Bearer "+apiKey)
+	}
+
+	if request.Stream {
+		sw := newAnthropicStreamWriter(w, request.Model)
+		s.chatCompletionsHandler(sw, creq)
+		if err := sw.close(); err != nil {
+			s.logger.Error(err, "failed to send response to client")
+		}
+		return
+	}
+
+	rw := &bufferedResponseWriter{}
+	s.chatCompletionsHandler(rw, creq)
+	if rw.statusCode < 200 || rw.statusCode >= 300 {
+		s.sendAnthropicError(w, rw.statusCode, upstreamErrorMessage(rw.buffer.String()))
+		return
+	}
+
+	var chatResponse openAIChatResponse
+	if err := json.Unmarshal([]byte(rw.buffer.String()), &chatResponse); err != nil {
+		s.sendAnthropicError(w, http.StatusBadGateway, err.Error())
+		return
+	}
+
+	s.sendAnthropicJSON(w, http.StatusOK, toAnthropicResponse(&chatResponse, request.Model))
+}
+
+// toChatCompletionRequest translates an Anthropic messages request
+func toChatCompletionRequest(request *anthropicMessagesRequest) (*openAIChatRequest, error) {
+	chatRequest := &openAIChatRequest{
+		Model:       request.Model,
+		MaxTokens:   request.MaxTokens,
+		Stop:        request.StopSequences,
+		Stream:      request.Stream,
+		Temperature: request.Temperature,
+		TopP:        request.TopP,
+		TopK:        request.TopK,
+	}
+	if request.Stream {
+		chatRequest.StreamOptions = &openAIStreamOptions{IncludeUsage: true}
+	}
+
+	if len(request.System) > 0 && string(request.System) != "null" {
+		system, err := anthropicText(request.System)
+		if err != nil {
+			return nil, fmt.Errorf("invalid 'system': %w", err)
+		}
+		chatRequest.Messages = append(chatRequest.Messages, openAIMessage{Role: "system", Content: system})
+	}
+
+	for i, message := range request.Messages {
+		blocks, err := anthropicBlocks(message.Content)
+		if err != nil {
+			return nil, fmt.Errorf("invalid 'messages.%d.content': %w", i, err)
+		}
+
+		switch message.Role {
+		case "user":
+			messages, err := toUserMessages(blocks)
+			if err != nil {
+				return nil, fmt.Errorf("invalid 'messages.%d.content': %w", i, err)
+			}
+			chatRequest.Messages = append(chatRequest.Messages, messages...)
+		case "assistant":
+			chatRequest.Messages = append(chatRequest.Messages, toAssistantMessage(blocks))
+		default:
+			return nil, fmt.Errorf("invalid 'messages.%d.role': %q", i, message.Role)
+		}
+	}
+
+	for _, tool := range request.Tools {
+		chatRequest.Tools = append(chatRequest.Tools, openAITool{
+			Type: "function",
+			Function: openAIFunction{
+				Name:        tool.Name,
+				Description: tool.Description,
+				Parameters:  tool.InputSchema,
+			},
+		})
+	}
+
+	if request.ToolChoice != nil {
+		switch request.ToolChoice.Type {
+		case "auto", "none":
+			chatRequest.ToolChoice = request.ToolChoice.Type
+		case "any":
+			chatRequest.ToolChoice = "required"
+		case "tool":
+			chatRequest.ToolChoice = map[string]any{
+				"type":     "function",
+				"function": map[string]string{"name": request.ToolChoice.Name},
+			}
+		}
+	}
+	return chatRequest, nil
+}
+
+// toUserMessages translates the content of a user message. Tool results become tool messages.
+func toUserMessages(blocks []anthropicContentBlock) ([]openAIMessage, error) {
+	messages := []openAIMessage{}
+	parts := []openAIContentPart{}
+	hasImage := false
+
+	for _, block := range blocks {
+		switch block.Type {
+		case anthropicBlockText:
+			parts = append(parts, openAIContentPart{Type: "text", Text: block.Text})
+		case anthropicBlockImage:
+			if block.Source == nil {
+				return nil, errors.New("missing image 'source'")
+			}
+			url := block.Source.URL
+			if block.Source.Type == "base64" {
+				url = "data:" + block.Source.MediaType + ";base64," + block.Source.Data
+			}
+			parts = append(parts, openAIContentPart{Type: "image_url", ImageURL: &openAIImageURL{URL: url}})
+			hasImage = true
+		case anthropicBlockToolResult:
+			content := ""
+			if len(block.Content) > 0 {
+				text, err := anthropicText(block.Content)
+				if err != nil {
+					return nil, err
+				}
+				content = text
+			}
+			messages = append(messages, openAIMessage{Role: "tool", ToolCallID: block.ToolUseID, Content: content})
+		default:
+			return nil, fmt.Errorf("unsupported content block type %q", block.Type)
+		}
+	}
+
+	switch {
+	case hasImage:
+		messages = append(messages, openAIMessage{Role: "user", Content: parts})
+	case len(parts) > 0:
+		texts := make([]string, len(parts))
+		for i, part := range parts {
+			texts[i] = part.Text
+		}
+		messages = append(messages, openAIMessage{Role: "user", Content: strings.Join(texts, "\n")})
+	}
+	return messages, nil
+}
+
+// toAssistantMessage translates the content of an assistant message. Tool uses become tool calls.
+func toAssistantMessage(blocks []anthropicContentBlock) openAIMessage {
+	message := openAIMessage{Role: "assistant"}
+	texts := []string{}
+	for _, block := range blocks {
+		switch block.Type {
+		case anthropicBlockText:
+			texts = append(texts, block.Text)
+		case anthropicBlockToolUse:
+			arguments := string(block.Input)
+			if arguments == "" {
+				arguments = "{}"
+			}
+			message.ToolCalls = append(message.ToolCalls, openAIToolCall{
+				ID:       block.ID,
+				Type:     "function",
+				Function: openAIFunctionCall{Name: block.Name, Arguments: arguments},
+			})
+		}
+	}
+	if len(texts) > 0 {
+		message.Content = strings.Join(texts, "\n")
+	}
+	return message
+}
+
+// toAnthropicResponse translates a chat completion response
+func toAnthropicResponse(chatResponse *openAIChatResponse, model string) *anthropicMessagesResponse {
+	response := &anthropicMessagesResponse{
+		ID:      anthropicMessageID(chatResponse.ID),
+		Type:    "message",
+		Role:    "assistant",
+		Model:   model,
+		Content: []anthropicContentBlock{},
+	}
+	if chatResponse.Usage != nil {
+		response.Usage = anthropicUsage{
+			InputTokens:  chatResponse.Usage.PromptTokens,
+			OutputTokens: chatResponse.Usage.CompletionTokens,
+		}
+	}
+	if len(chatResponse.Choices) == 0 {
+		return response
+	}
+
+	choice := chatResponse.Choices[0]
+	if choice.Message.Content != "" {
+		response.Content = append(response.Content, anthropicContentBlock{Type: anthropicBlockText, Text: choice.Message.Content})
+	}
+	for _, toolCall := range choice.Message.ToolCalls {
+		input := json.RawMessage(toolCall.Function.Arguments)
+		if !json.Valid(input) {
+			input = json.RawMessage("{}")
+		}
+		response.Content = append(response.Content, anthropicContentBlock{
+			Type:  anthropicBlockToolUse,
+			ID:    toolCall.ID,
+			Name:  toolCall.Function.Name,
+			Input: input,
+		})
+	}
+	response.StopReason, response.StopSequence = anthropicStopReason(choice.FinishReason, choice.StopReason)
+	return response
+}
+
+// anthropicStopReason translates the finish reason of a choice. vLLM reports the matched
+// stop sequence in stop_reason.
+func anthropicStopReason(finishReason string, stopReason any) (*string, *string) {
+	var reason string
+	switch finishReason {
+	case "":
+		return nil, nil
+	case "length":
+		reason = "max_tokens"
+	case "tool_calls":
+		reason = "tool_use"
+	default:
+		reason = "end_turn"
+	}
+
+	if sequence, ok := stopReason.(string); ok && finishReason == "stop" {
+		reason = "stop_sequence"
+		return &reason, &sequence
+	}
+	return &reason, nil
+}
+
+// anthropicBlocks parses message content, either a string or a list of content blocks
+func anthropicBlocks(content json.RawMessage) ([]anthropicContentBlock, error) {
+	var text string
+	if err := json.Unmarshal(content, &text); err == nil {
+		return []anthropicContentBlock{{Type: anthropicBlockText, Text: text}}, nil
+	}
+
+	var blocks []anthropicContentBlock
+	if err := json.Unmarshal(content, &blocks); err != nil {
+		return nil, errors.New("content must be a string or a list of content blocks")
+	}
+	return blocks, nil
+}
+
+// anthropicText returns the text of content, either a string or a list of text blocks
+func anthropicText(content json.RawMessage) (string, error) {
+	blocks, err := anthropicBlocks(content)
+	if err != nil {
+		return "", err
+	}
+
+	texts := []string{}
+	for _, block := range blocks {
+		if block.Type == anthropicBlockText {
+			texts = append(texts, block.Text)
+		}
+	}
+	return strings.Join(texts, "\n"), nil
+}
+
+func anthropicMessageID(id string) string {
+	return "msg_" + strings.TrimPrefix(id, "chatcmpl-")
+}
+
+// upstreamErrorMessage extracts the message of a vLLM error response
+func upstreamErrorMessage(body string) string {
+	var er errorResponse
+	if err := json.Unmarshal([]byte(body), &er); err == nil && er.Message != "" {
+		return er.Message
+	}
+	return strings.TrimSpace(body)
+}
+
+func anthropicErrorType(statusCode int) string {
+	switch statusCode {
+	case http.StatusBadRequest:
+		return "invalid_request_error"
+	case http.StatusUnauthorized:
+		return "authentication_error"
+	case http.StatusForbidden:
+		return "permission_error"
+	case http.StatusNotFound:
+		return "not_found_error"
+	case http.StatusRequestEntityTooLarge:
+		return "request_too_large"
+	case http.StatusTooManyRequests:
+		return "rate_limit_error"
+	case http.StatusServiceUnavailable:
+		return "overloaded_error"
+	}
+	return "api_error"
+}
+
+func (s *Server) sendAnthropicError(w http.ResponseWriter, statusCode int, message string) {
+	s.sendAnthropicJSON(w, statusCode, anthropicErrorResponse{
+		Type:      "error",
+		Error:     anthropicError{Type: anthropicErrorType(statusCode), Message: message},
+		RequestID: w.Header().Get(responseHeaderRequestID),
+	})
+}
+
+func (s *Server) sendAnthropicJSON(w http.ResponseWriter, statusCode int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		s.logger.Error(err, "failed to send response to client")
+	}
+}
+
+// anthropicStreamWriter translates a streamed chat completion response to Anthropic
+// message events as the chunks are written
+type anthropicStreamWriter struct {
+	w          http.ResponseWriter
+	header     http.Header
+	model      string
+	statusCode int
+	pending    []byte       // incomplete event line
+	errorBody  bytes.Buffer // body of an error response
+
+	started      bool
+	done         bool
+	blockOpen    bool
+	blockIndex   int
+	blockType    string
+	stopReason   *string
+	stopSequence *string
+	usage        anthropicUsage
+}
+
+func newAnthropicStreamWriter(w http.ResponseWriter, model string) *anthropicStreamWriter {
+	return &anthropicStreamWriter{
+		w:          w,
+		header:     make(http.Header),
+		model:      model,
+		blockIndex: -1,
+	}
+}
+
+func (sw *anthropicStreamWriter) Header() http.Header {
+	return sw.header
+}
+
+func (sw *anthropicStreamWriter) WriteHeader(statusCode int) {
+	if sw.statusCode != 0 {
+		return
+	}
+	sw.statusCode = statusCode
+	if sw.failed() {
+		return
+	}
+
+	sw.w.Header().Set("Content-Type", "text/event-stream")
+	sw.w.Header().Set("Cache-Control", "no-cache")
+	sw.w.WriteHeader(statusCode)
+}
+
+func (sw *anthropicStreamWriter) Write(b []byte) (int, error) {
+	if sw.statusCode == 0 {
+		sw.WriteHeader(http.StatusOK)
+	}
+	if sw.failed() {
+		return sw.errorBody.Write(b)
+	}
+
+	sw.pending = append(sw.pending, b...)
+	for {
+		i := bytes.IndexByte(sw.pending, '\n')
+		if i < 0 {
+			break
+		}
+		line := strings.TrimSpace(string(sw.pending[:i]))
+		sw.pending = sw.pending[i+1:]
+		if err := sw.processLine(line); err != nil {
+			return 0, err
+		}
+	}
+	return len(b), nil
+}
+
+// Flush sends the translated events as soon as the decoder chunks are flushed
+func (sw *anthropicStreamWriter) Flush() {
+	http.NewResponseController(sw.w).Flush() //nolint:all
+}
+
+func (sw *anthropicStreamWriter) failed() bool {
+	return sw.statusCode < 200 || sw.statusCode >= 300
+}
+
+func (sw *anthropicStreamWriter) processLine(line string) error {
+	data, ok := strings.CutPrefix(line, "data:")
+	if !ok {
+		return nil
+	}
+	data = strings.TrimSpace(data)
+	if data == "[DONE]" {
+		return sw.finish()
+	}
+
+	var chunk openAIChatResponse
+	if err := json.Unmarshal([]byte(data), &chunk); err != nil {
+		return nil // not a chat completion chunk
+	}
+	return sw.processChunk(&chunk)
+}
+
+func (sw *anthropicStreamWriter) processChunk(chunk *openAIChatResponse) error {
+	if err := sw.start(chunk.ID); err != nil {
+		return err
+	}
+	if chunk.Usage != nil {
+		sw.usage = anthropicUsage{InputTokens: chunk.Usage.PromptTokens, OutputTokens: chunk.Usage.CompletionTokens}
+	}
+	if len(chunk.Choices) == 0 {
+		return nil
+	}
+
+	choice := chunk.Choices[0]
+	if choice.Delta.Content != "" {
+		if sw.blockType != anthropicBlockText {
+			if err := sw.startBlock(anthropicBlockText, map[string]any{"type": anthropicBlockText, "text": ""}); err != nil {
+				return err
+			}
+		}
+		if err := sw.event("content_block_delta", map[string]any{
+			"type":  "content_block_delta",
+			"index": sw.blockIndex,
+			"delta": map[string]any{"type": "text_delta", "text": choice.Delta.Content},
+		}); err != nil {
+			return err
+		}
+	}
+
+	for _, toolCall := range choice.Delta.ToolCalls {
+		if toolCall.ID != "" {
+			if err := sw.startBlock(anthropicBlockToolUse, map[string]any{
+				"type":  anthropicBlockToolUse,
+				"id":    toolCall.ID,
+				"name":  toolCall.Function.Name,
+				"input": map[string]any{},
+			}); err != nil {
+				return err
+			}
+		}
+		if toolCall.Function.Arguments != "" && sw.blockType == anthropicBlockToolUse {
+			if err := sw.event("content_block_delta", map[string]any{
+				"type":  "content_block_delta",
+				"index": sw.blockIndex,
+				"delta": map[string]any{"type": "input_json_delta", "partial_json": toolCall.Function.Arguments},
+			}); err != nil {
+				return err
+			}
+		}
+	}
+
+	if choice.FinishReason != "" {
+		sw.stopReason, sw.stopSequence = anthropicStopReason(choice.FinishReason, choice.StopReason)
+	}
+	return nil
+}
+
+func (sw *anthropicStreamWriter) start(id string) error {
+	if sw.started {
+		return nil
+	}
+	sw.started = true
+	return sw.event("message_start", map[string]any{
+		"type": "message_start",
+		"message": anthropicMessagesResponse{
+			ID:      anthropicMessageID(id),
+			Type:    "message",
+			Role:    "assistant",
+			Model:   sw.model,
+			Content: []anthropicContentBlock{},
+		},
+	})
+}
+
+func (sw *anthropicStreamWriter) startBlock(blockType string, block map[string]any) error {
+	if err := sw.stopBlock(); err != nil {
+		return err
+	}
+	sw.blockOpen = true
+	sw.blockIndex++
+	sw.blockType = blockType
+	return sw.event("content_block_start", map[string]any{
+		"type":          "content_block_start",
+		"index":         sw.blockIndex,
+		"content_block": block,
+	})
+}
+
+func (sw *anthropicStreamWriter) stopBlock() error {
+	if !sw.blockOpen {
+		return nil
+	}
+	sw.blockOpen = false
+	sw.blockType = ""
+	return sw.event("content_block_stop", map[string]any{
+		"type":  "content_block_stop",
+		"index": sw.blockIndex,
+	})
+}
+
+// finish closes the message, once the decoder has sent the last chunk
+func (sw *anthropicStreamWriter) finish() error {
+	if sw.done {
+		return nil
+	}
+	sw.done = true
+
+	if err := sw.start(""); err != nil {
+		return err
+	}
+	if err := sw.stopBlock(); err != nil {
+		return err
+	}
+	if err := sw.event("message_delta", map[string]any{
+		"type":  "message_delta",
+		"delta": map[string]any{"stop_reason": sw.stopReason, "stop_sequence": sw.stopSequence},
+		"usage": sw.usage,
+	}); err != nil {
+		return err
+	}
+	return sw.event("message_stop", map[string]any{"type": "message_stop"})
+}
+
+// close terminates the response, with an Anthropic error if the request failed
+func (sw *anthropicStreamWriter) close() error {
+	if sw.statusCode == 0 {
+		sw.statusCode = http.StatusBadGateway
+	}
+	if sw.failed() {
+		b, err := json.Marshal(anthropicErrorResponse{
+			Type:      "error",
+			Error:     anthropicError{Type: anthropicErrorType(sw.statusCode), Message: upstreamErrorMessage(sw.errorBody.String())},
+			RequestID: sw.w.Header().Get(responseHeaderRequestID),
+		})
+		if err != nil {
+			return err
+		}
+		sw.w.Header().Set("Content-Type", "application/json")
+		sw.w.WriteHeader(sw.statusCode)
+		_, err = sw.w.Write(b)
+		return err
+	}
+	return sw.finish()
+}
+
+func (sw *anthropicStreamWriter) event(name string, data any) error {
+	b, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(sw.w, "event: %s\ndata: %s\n\n", name, b)
+	return err
+}
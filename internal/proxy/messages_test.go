@@ -0,0 +1,205 @@
+/*
+Copyright 2025 The llm-d Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package proxy
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/llm-d/llm-d-routing-sidecar/test/mock"
+	. "github.com/onsi/ginkgo/v2" // nolint:revive
+	. "github.com/onsi/gomega"    // nolint:revive
+	"k8s.io/klog/v2/ktesting"
+)
+
+var _ = Describe("Messages API", func() {
+	const request = `{
+		"model": "Qwen/Qwen2-0.5B",
+		"max_tokens": 64,
+		"system": "You are a weather bot",
+		"stop_sequences": ["END"],
+		"tools": [{"name": "get_weather", "input_schema": {"type": "object", "properties": {"location": {"type": "string"}}}}],
+		"messages": [
+			{"role": "user", "content": "What's the weather in Paris?"},
+			{"role": "assistant", "content": [{"type": "tool_use", "id": "call_1", "name": "get_weather", "input": {"location": "Paris"}}]},
+			{"role": "user", "content": [{"type": "tool_result", "tool_use_id": "call_1", "content": "sunny"}, {"type": "text", "text": "And in Rome?"}]}
+		]`
+
+	var (
+		ctx            context.Context
+		decodeBody     chan map[string]any
+		decodeResponse func(w http.ResponseWriter, stream bool)
+		prefillHandler *mock.ChatCompletionHandler
+		prefillHost    string
+		proxyBaseURL   string
+	)
+
+	BeforeEach(func() {
+		_, ctx = ktesting.NewTestContext(GinkgoT())
+		var cancelFn context.CancelFunc
+		ctx, cancelFn = context.WithCancel(ctx)
+		DeferCleanup(cancelFn)
+
+		decodeBody = make(chan map[string]any, 1)
+		decodeBackend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			var body map[string]any
+			b, _ := io.ReadAll(r.Body) //nolint:all
+			json.Unmarshal(b, &body)   //nolint:all
+			decodeBody <- body
+			decodeResponse(w, body["stream"] == true)
+		}))
+		DeferCleanup(decodeBackend.Close)
+
+		prefillHandler = &mock.ChatCompletionHandler{Connector: ConnectorNIXLV2, Role: mock.RolePrefill}
+		prefillBackend := httptest.NewServer(prefillHandler)
+		DeferCleanup(prefillBackend.Close)
+		prefillHost = prefillBackend.URL[len("http://"):]
+
+		decodeURL, err := url.Parse(decodeBackend.URL)
+		Expect(err).ToNot(HaveOccurred())
+		proxy, err := NewProxy("0", decodeURL, Config{Connector: ConnectorNIXLV2, EnableMessagesAPI: true})
+		Expect(err).ToNot(HaveOccurred())
+
+		go func() {
+			defer GinkgoRecover()
+			Expect(proxy.Start(ctx)).To(Succeed())
+		}()
+		time.Sleep(1 * time.Second)
+		Expect(proxy.Addr()).ToNot(BeNil())
+		proxyBaseURL = "http://" + proxy.Addr().String()
+	})
+
+	post := func(body string) *http.Response {
+		req, err := http.NewRequest(http.MethodPost, proxyBaseURL+MessagesPath, strings.NewReader(body))
+		Expect(err).ToNot(HaveOccurred())
+		req.Header.Add(requestHeaderPrefillHostPort, prefillHost)
+		req.Header.Add(requestHeaderAPIKey, "secret")
+
+		resp, err := http.DefaultClient.Do(req)
+		Expect(err).ToNot(HaveOccurred())
+		return resp
+	}
+
+	It("should translate a request and its response through the P/D protocol", func() {
+		decodeResponse = func(w http.ResponseWriter, _ bool) {
+			w.Header().Set("Content-Type", "application/json")
+			fmt.Fprint(w, `{"id": "chatcmpl-1", "model": "Qwen/Qwen2-0.5B", "choices": [{"index": 0,
+				"message": {"role": "assistant", "content": "Let me check.", "tool_calls": [{"id": "call_2", "type": "function", "function": {"name": "get_weather", "arguments": "{\"location\": \"Rome\"}"}}]},
+				"finish_reason": "tool_calls"}], "usage": {"prompt_tokens": 42, "completion_tokens": 7}}`) //nolint:all
+		}
+
+		resp := post(request + `}`)
+		defer resp.Body.Close() //nolint:all
+		Expect(resp.StatusCode).To(Equal(http.StatusOK))
+
+		var body map[string]any
+		Eventually(decodeBody).Should(Receive(&body))
+		Expect(body["stop"]).To(Equal([]any{"END"}))
+		Expect(body["max_tokens"]).To(BeNumerically("==", 64))
+		Expect(body["tools"]).To(ConsistOf(HaveKeyWithValue("type", "function")))
+		messages := body["messages"].([]any)
+		Expect(messages).To(HaveLen(5))
+		Expect(messages[0]).To(Equal(map[string]any{"role": "system", "content": "You are a weather bot"}))
+		Expect(messages[2]).To(HaveKeyWithValue("tool_calls", ConsistOf(HaveKeyWithValue("function",
+			map[string]any{"name": "get_weather", "arguments": `{"location": "Paris"}`}))))
+		Expect(messages[3]).To(Equal(map[string]any{"role": "tool", "tool_call_id": "call_1", "content": "sunny"}))
+		Expect(messages[4]).To(Equal(map[string]any{"role": "user", "content": "And in Rome?"}))
+		Expect(prefillHandler.RequestCount.Load()).To(BeNumerically("==", 1))
+
+		var message anthropicMessagesResponse
+		Expect(json.NewDecoder(resp.Body).Decode(&message)).To(Succeed())
+		Expect(message.ID).To(Equal("msg_1"))
+		Expect(*message.StopReason).To(Equal("tool_use"))
+		Expect(message.Usage).To(Equal(anthropicUsage{InputTokens: 42, OutputTokens: 7}))
+		Expect(message.Content).To(HaveLen(2))
+		Expect(message.Content[0].Text).To(Equal("Let me check."))
+		Expect(message.Content[1].Name).To(Equal("get_weather"))
+		Expect(string(message.Content[1].Input)).To(MatchJSON(`{"location": "Rome"}`))
+	})
+
+	It("should translate a streamed response to message events", func() {
+		decodeResponse = func(w http.ResponseWriter, stream bool) {
+			Expect(stream).To(BeTrue())
+			w.Header().Set("Content-Type", "text/event-stream")
+			for _, chunk := range []string{
+				`{"id":"chatcmpl-1","choices":[{"index":0,"delta":{"role":"assistant","content":"Let me"}}]}`,
+				`{"id":"chatcmpl-1","choices":[{"index":0,"delta":{"content":" check."}}]}`,
+				`{"id":"chatcmpl-1","choices":[{"index":0,"delta":{"tool_calls":[{"index":0,"id":"call_2","type":"function","function":{"name":"get_weather","arguments":""}}]}}]}`,
+				`{"id":"chatcmpl-1","choices":[{"index":0,"delta":{"tool_calls":[{"index":0,"function":{"arguments":"{\"location\": \"Rome\"}"}}]}}]}`,
+				`{"id":"chatcmpl-1","choices":[{"index":0,"delta":{},"finish_reason":"tool_calls"}]}`,
+				`{"id":"chatcmpl-1","choices":[],"usage":{"prompt_tokens":42,"completion_tokens":7}}`,
+				`[DONE]`,
+			} {
+				fmt.Fprintf(w, "data: %s\n\n", chunk) //nolint:all
+				w.(http.Flusher).Flush()
+			}
+		}
+
+		resp := post(request + `, "stream": true}`)
+		defer resp.Body.Close() //nolint:all
+		Expect(resp.StatusCode).To(Equal(http.StatusOK))
+		Expect(resp.Header.Get("Content-Type")).To(Equal("text/event-stream"))
+
+		events := []string{}
+		data := []map[string]any{}
+		scanner := bufio.NewScanner(resp.Body)
+		for scanner.Scan() {
+			if name, ok := strings.CutPrefix(scanner.Text(), "event: "); ok {
+				events = append(events, name)
+			}
+			if payload, ok := strings.CutPrefix(scanner.Text(), "data: "); ok {
+				var event map[string]any
+				Expect(json.Unmarshal([]byte(payload), &event)).To(Succeed())
+				data = append(data, event)
+			}
+		}
+
+		Expect(events).To(Equal([]string{
+			"message_start",
+			"content_block_start", "content_block_delta", "content_block_delta", "content_block_stop",
+			"content_block_start", "content_block_delta", "content_block_stop",
+			"message_delta", "message_stop",
+		}))
+		Expect(data[6]).To(HaveKeyWithValue("delta", map[string]any{"type": "input_json_delta", "partial_json": `{"location": "Rome"}`}))
+		Expect(data[8]).To(HaveKeyWithValue("delta", HaveKeyWithValue("stop_reason", "tool_use")))
+		Expect(data[8]).To(HaveKeyWithValue("usage", map[string]any{"input_tokens": 42.0, "output_tokens": 7.0}))
+
+		var body map[string]any
+		Eventually(decodeBody).Should(Receive(&body))
+		Expect(body["stream_options"]).To(Equal(map[string]any{"include_usage": true}))
+	})
+
+	It("should return Anthropic errors", func() {
+		resp := post(`{"model": "Qwen/Qwen2-0.5B", "max_tokens": 64, "messages": []}`)
+		defer resp.Body.Close() //nolint:all
+		Expect(resp.StatusCode).To(Equal(http.StatusBadRequest))
+
+		var er anthropicErrorResponse
+		Expect(json.NewDecoder(resp.Body).Decode(&er)).To(Succeed())
+		Expect(er.Type).To(Equal("error"))
+		Expect(er.Error.Type).To(Equal("invalid_request_error"))
+		Expect(er.Error.Message).To(ContainSubstring("messages"))
+	})
+})
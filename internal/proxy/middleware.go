@@ -0,0 +1,147 @@
+/*
+Copyright 2025 The llm-d Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package proxy
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/llm-d/llm-d-routing-sidecar/pkg/middleware"
+)
+
+// middlewareHandler runs the pre-routing and post-response hooks of the middlewares
+func (s *Server) middlewareHandler(next http.Handler) http.Handler {
+	if len(s.config.Middlewares) == 0 {
+		return next
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		for _, m := range s.config.Middlewares {
+			if err := m.PreRouting(r); err != nil {
+				s.middlewareError(w, m, err)
+				return
+			}
+		}
+
+		rec := &statusRecorder{ResponseWriter: w}
+		next.ServeHTTP(rec, r)
+
+		statusCode := rec.statusCode
+		if statusCode == 0 {
+			statusCode = http.StatusOK
+		}
+		for _, m := range s.config.Middlewares {
+			m.PostResponse(r, statusCode, time.Since(start))
+		}
+	})
+}
+
+// prePrefill runs the pre-prefill hooks on a prefill request. The request is answered with
+// the error of a failing hook.
+func (s *Server) prePrefill(w http.ResponseWriter, r *http.Request, body map[string]any) bool {
+	if len(s.config.Middlewares) == 0 {
+		return true
+	}
+
+	decodeRawValues(body)
+	for _, m := range s.config.Middlewares {
+		if err := m.PrePrefill(r, body); err != nil {
+			s.middlewareError(w, m, err)
+			return false
+		}
+	}
+	return true
+}
+
+// preDecode runs the pre-decode hooks on a decode request. The request is answered with
+// the error of a failing hook.
+func (s *Server) preDecode(w http.ResponseWriter, r *http.Request, body map[string]any) bool {
+	if len(s.config.Middlewares) == 0 {
+		return true
+	}
+
+	decodeRawValues(body)
+	for _, m := range s.config.Middlewares {
+		if err := m.PreDecode(r, body); err != nil {
+			s.middlewareError(w, m, err)
+			return false
+		}
+	}
+	return true
+}
+
+// preDecodeBody runs the pre-decode hooks on a decode request forwarding the given body,
+// and returns the request with the body they rewrote
+func (s *Server) preDecodeBody(w http.ResponseWriter, r *http.Request, body []byte) (*http.Request, []byte, bool) {
+	if len(s.config.Middlewares) == 0 {
+		return r, body, true
+	}
+
+	request, err := decodeRequestBody(body)
+	if err != nil {
+		if err := errorJSONInvalid(err, w); err != nil {
+			s.logger.Error(err, "failed to send error response to client")
+		}
+		return nil, nil, false
+	}
+	if !s.preDecode(w, r, request) {
+		return nil, nil, false
+	}
+
+	body, err = json.Marshal(request)
+	if err != nil {
+		if err := errorJSONInvalid(err, w); err != nil {
+			s.logger.Error(err, "failed to send error response to client")
+		}
+		return nil, nil, false
+	}
+	dreq := r.Clone(r.Context())
+	setRequestBody(dreq, io.NopCloser(bytes.NewReader(body)), len(body))
+	return dreq, body, true
+}
+
+// decodeRawValues decodes the raw JSON values of a request body, so middlewares see plain values
+func decodeRawValues(body map[string]any) {
+	for name, value := range body {
+		if raw, ok := value.(json.RawMessage); ok {
+			var decoded any
+			if err := json.Unmarshal(raw, &decoded); err == nil {
+				body[name] = decoded
+			}
+		}
+	}
+}
+
+// middlewareError answers a request with the error returned by a middleware hook
+func (s *Server) middlewareError(w http.ResponseWriter, m middleware.Middleware, err error) {
+	var merr *middleware.Error
+	if !errors.As(err, &merr) {
+		s.logger.Error(err, "middleware failed", "middleware", m.Name())
+		merr = middleware.NewError(http.StatusInternalServerError, err.Error())
+	} else {
+		s.logger.V(4).Info("request rejected by middleware", "middleware", m.Name(), "code", merr.StatusCode, "message", merr.Message)
+	}
+
+	if err := errorStatus(merr.StatusCode, merr.Message, w); err != nil {
+		s.logger.Error(err, "failed to send error response to client")
+	}
+}
@@ -0,0 +1,172 @@
+/*
+Copyright 2025 The llm-d Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package proxy
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/llm-d/llm-d-routing-sidecar/pkg/middleware"
+	"github.com/llm-d/llm-d-routing-sidecar/test/mock"
+	. "github.com/onsi/ginkgo/v2" // nolint:revive
+	. "github.com/onsi/gomega"    // nolint:revive
+	"k8s.io/klog/v2/ktesting"
+)
+
+// tenantMiddleware rejects requests without a tenant and tags the prefill and decode requests
+type tenantMiddleware struct {
+	middleware.Base
+
+	mu       sync.Mutex
+	statuses []int
+}
+
+func (m *tenantMiddleware) Name() string {
+	return "tenant"
+}
+
+func (m *tenantMiddleware) PreRouting(r *http.Request) error {
+	switch r.Header.Get("X-Tenant") {
+	case "":
+		return middleware.NewError(http.StatusUnauthorized, "missing tenant")
+	case "broken":
+		return errors.New("tenant lookup failed")
+	}
+	return nil
+}
+
+func (m *tenantMiddleware) PrePrefill(r *http.Request, body map[string]any) error {
+	body["user"] = r.Header.Get("X-Tenant") + "-prefill"
+	return nil
+}
+
+func (m *tenantMiddleware) PreDecode(r *http.Request, body map[string]any) error {
+	if body["model"] != "llama" {
+		return middleware.NewError(http.StatusBadRequest, "unexpected model")
+	}
+	body["user"] = r.Header.Get("X-Tenant") + "-decode"
+	return nil
+}
+
+func (m *tenantMiddleware) PostResponse(_ *http.Request, statusCode int, _ time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.statuses = append(m.statuses, statusCode)
+}
+
+var _ = Describe("Middlewares", func() {
+	var (
+		ctx            context.Context
+		decodeHandler  *mock.ChatCompletionHandler
+		prefillHandler *mock.ChatCompletionHandler
+		prefillHost    string
+		decodeURL      *url.URL
+		tenant         *tenantMiddleware
+	)
+
+	BeforeEach(func() {
+		_, ctx = ktesting.NewTestContext(GinkgoT())
+		var cancelFn context.CancelFunc
+		ctx, cancelFn = context.WithCancel(ctx)
+		DeferCleanup(cancelFn)
+
+		decodeHandler = &mock.ChatCompletionHandler{Connector: ConnectorNIXLV2, Role: mock.RoleDecode}
+		decodeBackend := httptest.NewServer(decodeHandler)
+		DeferCleanup(decodeBackend.Close)
+
+		prefillHandler = &mock.ChatCompletionHandler{Connector: ConnectorNIXLV2, Role: mock.RolePrefill}
+		prefillBackend := httptest.NewServer(prefillHandler)
+		DeferCleanup(prefillBackend.Close)
+		prefillHost = prefillBackend.URL[len("http://"):]
+
+		var err error
+		decodeURL, err = url.Parse(decodeBackend.URL)
+		Expect(err).ToNot(HaveOccurred())
+
+		tenant = &tenantMiddleware{}
+	})
+
+	startProxy := func(connector string) string {
+		decodeHandler.Connector = connector
+		prefillHandler.Connector = connector
+		proxy, err := NewProxy("0", decodeURL, Config{Connector: connector, Middlewares: []middleware.Middleware{tenant}})
+		Expect(err).ToNot(HaveOccurred())
+
+		go func() {
+			defer GinkgoRecover()
+			Expect(proxy.Start(ctx)).To(Succeed())
+		}()
+		time.Sleep(1 * time.Second)
+		Expect(proxy.Addr()).ToNot(BeNil())
+		return "http://" + proxy.Addr().String()
+	}
+
+	sendRequest := func(proxyBaseURL string, tenant string, prefiller string) int {
+		body := `{"model": "llama", "prompt": "Hello", "max_tokens": 10}`
+		req, err := http.NewRequest(http.MethodPost, proxyBaseURL+CompletionsPath, strings.NewReader(body))
+		Expect(err).ToNot(HaveOccurred())
+		if tenant != "" {
+			req.Header.Set("X-Tenant", tenant)
+		}
+		if prefiller != "" {
+			req.Header.Add(requestHeaderPrefillHostPort, prefiller)
+		}
+
+		resp, err := http.DefaultClient.Do(req)
+		Expect(err).ToNot(HaveOccurred())
+		resp.Body.Close() //nolint:all
+		return resp.StatusCode
+	}
+
+	It("should reject requests failing the pre-routing hooks", func() {
+		proxyBaseURL := startProxy(ConnectorNIXLV2)
+
+		Expect(sendRequest(proxyBaseURL, "", prefillHost)).To(Equal(http.StatusUnauthorized))
+		Expect(sendRequest(proxyBaseURL, "broken", prefillHost)).To(Equal(http.StatusInternalServerError))
+		Expect(decodeHandler.RequestCount.Load()).To(BeNumerically("==", 0))
+		Expect(prefillHandler.RequestCount.Load()).To(BeNumerically("==", 0))
+		Expect(tenant.statuses).To(BeEmpty())
+	})
+
+	DescribeTable("should rewrite the prefill and decode requests",
+		func(connector string) {
+			proxyBaseURL := startProxy(connector)
+
+			Expect(sendRequest(proxyBaseURL, "acme", prefillHost)).To(Equal(http.StatusOK))
+			Expect(prefillHandler.CompletionRequests).To(HaveLen(1))
+			Expect(prefillHandler.CompletionRequests[0]).To(HaveKeyWithValue("user", "acme-prefill"))
+			Expect(decodeHandler.CompletionRequests).To(HaveLen(1))
+			Expect(decodeHandler.CompletionRequests[0]).To(HaveKeyWithValue("user", "acme-decode"))
+
+			Expect(sendRequest(proxyBaseURL, "acme", "")).To(Equal(http.StatusOK))
+			Expect(decodeHandler.CompletionRequests).To(HaveLen(2))
+			Expect(decodeHandler.CompletionRequests[1]).To(HaveKeyWithValue("user", "acme-decode"))
+
+			tenant.mu.Lock()
+			defer tenant.mu.Unlock()
+			Expect(tenant.statuses).To(Equal([]int{http.StatusOK, http.StatusOK}))
+		},
+		Entry("with the NIXL v2 connector", ConnectorNIXLV2),
+		Entry("with the NIXL v1 connector", ConnectorNIXLV1),
+	)
+})
@@ -0,0 +1,136 @@
+/*
+Copyright 2025 The llm-d Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package proxy
+
+import (
+	"encoding/json"
+	"fmt"
+	"maps"
+	"net/http"
+	"slices"
+)
+
+const modelsOwner = "llm-d"
+
+// modelList is the response of the OpenAI models endpoint. The entries are kept as is, but
+// for their ID.
+type modelList struct {
+	Object string           `json:"object"`
+	Data   []map[string]any `json:"data"`
+}
+
+// resolveModelAliases returns the served models by alias
+func resolveModelAliases(aliases map[string]string) (map[string]string, error) {
+	models := make(map[string]string, len(aliases))
+	for model, alias := range aliases {
+		if other, ok := models[alias]; ok {
+			return nil, fmt.Errorf("models %q and %q have the same alias %q", model, other, alias)
+		}
+		models[alias] = model
+	}
+	return models, nil
+}
+
+// rewriteModelAlias replaces the model alias of a completion request by the served model. It
+// reports whether the request used an alias.
+func (s *Server) rewriteModelAlias(p *parsedRequest) bool {
+	model, ok := s.aliasedModels[p.model]
+	if !ok || p.setField(requestFieldModel, model) != nil {
+		return false
+	}
+	p.model = model
+	return true
+}
+
+// modelEntitled reports whether the tenant of a request may see a model. The
+// TenantQuotaWildcard entry applies to the tenants without their own entry, and the requests
+// without tenant see all the models.
+func (s *Server) modelEntitled(r *http.Request, model string) bool {
+	if len(s.config.TenantModels) == 0 || s.config.TenantHeader == "" {
+		return true
+	}
+	tenant := r.Header.Get(s.config.TenantHeader)
+	if tenant == "" {
+		return true
+	}
+	models, ok := s.config.TenantModels[tenant]
+	if !ok {
+		if models, ok = s.config.TenantModels[TenantQuotaWildcard]; !ok {
+			return true
+		}
+	}
+	return slices.Contains(models, model)
+}
+
+// modelsHandler lists the models served by the decoder under their alias, along with the
+// models of the audio routes, keeping the models the tenant of the request is entitled to
+func (s *Server) modelsHandler(w http.ResponseWriter, r *http.Request) {
+	if len(s.config.ModelAliases) == 0 && len(s.config.TenantModels) == 0 && len(s.audioProxies) == 0 {
+		s.passthroughHandler(w, r)
+		return
+	}
+	if !s.passthroughAllowed(r.URL.Path) {
+		s.denyPassthrough(w, r)
+		return
+	}
+
+	rw := &bufferedResponseWriter{}
+	s.decoderProxy.ServeHTTP(rw, r)
+
+	var list modelList
+	if rw.statusCode != http.StatusOK || json.Unmarshal(rw.buffer.Bytes(), &list) != nil {
+		// relay the decoder errors as is
+		maps.Copy(w.Header(), rw.Header())
+		if rw.statusCode != 0 {
+			w.WriteHeader(rw.statusCode)
+		}
+		w.Write(rw.buffer.Bytes()) //nolint:all
+		return
+	}
+
+	listed := make(map[string]bool, len(list.Data))
+	data := make([]map[string]any, 0, len(list.Data)+len(s.audioProxies))
+	for _, entry := range list.Data {
+		id, _ := entry["id"].(string)
+		if alias, ok := s.config.ModelAliases[id]; ok {
+			id = alias
+			entry["id"] = alias
+		}
+		listed[id] = true
+		if s.modelEntitled(r, id) {
+			data = append(data, entry)
+		}
+	}
+	for _, model := range slices.Sorted(maps.Keys(s.audioProxies)) {
+		if !listed[model] && s.modelEntitled(r, model) {
+			data = append(data, map[string]any{"id": model, "object": "model", "owned_by": modelsOwner})
+		}
+	}
+	list.Data = data
+
+	b, err := json.Marshal(list)
+	if err != nil {
+		s.logger.Error(err, "failed to encode the models")
+		if err := errorStatus(http.StatusInternalServerError, "failed to encode the models", w); err != nil {
+			s.logger.Error(err, "failed to send error response to client")
+		}
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(b) //nolint:all
+}
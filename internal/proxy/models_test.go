@@ -0,0 +1,143 @@
+/*
+Copyright 2025 The llm-d Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package proxy
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+
+	"github.com/go-logr/logr"
+	. "github.com/onsi/ginkgo/v2" // nolint:revive
+	. "github.com/onsi/gomega"    // nolint:revive
+)
+
+const decoderModels = `{"object":"list","data":[
+	{"id":"meta-llama/Llama-3.1-8B","object":"model","owned_by":"vllm","max_model_len":8192},
+	{"id":"meta-llama/Llama-3.1-70B","object":"model","owned_by":"vllm"}]}`
+
+var _ = Describe("Models", func() {
+	var s *Server
+
+	BeforeEach(func() {
+		s = &Server{
+			config: Config{
+				TenantHeader: "X-Tenant",
+				ModelAliases: map[string]string{"meta-llama/Llama-3.1-8B": "llama-8b"},
+			},
+			decoderProxy: http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+				w.Header().Set("Content-Type", "application/json")
+				w.Write([]byte(decoderModels)) //nolint:all
+			}),
+			audioProxies: map[string]http.Handler{"whisper": http.NotFoundHandler()},
+			logger:       logr.Discard(),
+		}
+	})
+
+	listModels := func(tenant string) (int, []map[string]any) {
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, ModelsPath, nil)
+		if tenant != "" {
+			req.Header.Set("X-Tenant", tenant)
+		}
+		s.modelsHandler(rec, req)
+		var list modelList
+		Expect(json.Unmarshal(rec.Body.Bytes(), &list)).To(Succeed())
+		return rec.Code, list.Data
+	}
+
+	ids := func(data []map[string]any) []string {
+		ids := make([]string, 0, len(data))
+		for _, entry := range data {
+			ids = append(ids, entry["id"].(string))
+		}
+		return ids
+	}
+
+	It("should rename the aliased models and list the audio models", func() {
+		code, data := listModels("")
+		Expect(code).To(Equal(http.StatusOK))
+		Expect(ids(data)).To(Equal([]string{"llama-8b", "meta-llama/Llama-3.1-70B", "whisper"}))
+		Expect(data[0]).To(HaveKeyWithValue("max_model_len", float64(8192)))
+		Expect(data[2]).To(HaveKeyWithValue("owned_by", modelsOwner))
+	})
+
+	It("should list the models the tenant is entitled to", func() {
+		s.config.TenantModels = map[string][]string{
+			"acme":              {"llama-8b", "whisper"},
+			TenantQuotaWildcard: {"meta-llama/Llama-3.1-70B"},
+		}
+		_, data := listModels("acme")
+		Expect(ids(data)).To(Equal([]string{"llama-8b", "whisper"}))
+		_, data = listModels("other")
+		Expect(ids(data)).To(Equal([]string{"meta-llama/Llama-3.1-70B"}))
+		_, data = listModels("")
+		Expect(data).To(HaveLen(3))
+
+		delete(s.config.TenantModels, TenantQuotaWildcard)
+		_, data = listModels("other")
+		Expect(data).To(HaveLen(3))
+	})
+
+	It("should relay the decoder errors", func() {
+		s.decoderProxy = http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			w.Write([]byte("loading")) //nolint:all
+		})
+		rec := httptest.NewRecorder()
+		s.modelsHandler(rec, httptest.NewRequest(http.MethodGet, ModelsPath, nil))
+		Expect(rec.Code).To(Equal(http.StatusServiceUnavailable))
+		Expect(rec.Body.String()).To(Equal("loading"))
+	})
+
+	It("should send the completion requests for an alias to its model", func() {
+		var err error
+		s.aliasedModels, err = resolveModelAliases(s.config.ModelAliases)
+		Expect(err).ToNot(HaveOccurred())
+
+		p := mustParse(`{"model":"llama-8b","prompt":"hi"}`)
+		Expect(s.rewriteModelAlias(p)).To(BeTrue())
+		Expect(p.model).To(Equal("meta-llama/Llama-3.1-8B"))
+		Expect(p.encode()).To(MatchJSON(`{"model":"meta-llama/Llama-3.1-8B","prompt":"hi"}`))
+
+		Expect(s.rewriteModelAlias(mustParse(`{"model":"meta-llama/Llama-3.1-70B","prompt":"hi"}`))).To(BeFalse())
+	})
+
+	It("should forward the rewritten completion requests", func() {
+		var received string
+		s.decoderProxy = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			b, _ := io.ReadAll(r.Body)
+			received = string(b)
+			w.WriteHeader(http.StatusOK)
+		})
+		s.aliasedModels, _ = resolveModelAliases(s.config.ModelAliases)
+		s.deprecations = newDeprecationTracker()
+
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, CompletionsPath, strings.NewReader(`{"model":"llama-8b","prompt":"hi"}`))
+		s.chatCompletionsHandler(rec, req)
+		Expect(rec.Code).To(Equal(http.StatusOK))
+		Expect(received).To(MatchJSON(`{"model":"meta-llama/Llama-3.1-8B","prompt":"hi"}`))
+	})
+
+	It("should reject duplicate aliases", func() {
+		_, err := resolveModelAliases(map[string]string{"a": "llama", "b": "llama"})
+		Expect(err).To(MatchError(ContainSubstring(`same alias "llama"`)))
+	})
+})
@@ -0,0 +1,64 @@
+/*
+Copyright 2025 The llm-d Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package proxy
+
+const (
+	modalityText  = "text"
+	modalityImage = "image"
+	modalityAudio = "audio"
+	modalityVideo = "video"
+	modalityMixed = "mixed"
+)
+
+// contentPartModalities maps the chat content part types to their modality
+var contentPartModalities = map[string]string{
+	"image_url":    modalityImage,
+	"input_image":  modalityImage,
+	"image_embeds": modalityImage,
+	"input_audio":  modalityAudio,
+	"audio_url":    modalityAudio,
+	"video_url":    modalityVideo,
+}
+
+// requestModality returns the modality of a chat completion request: text, the modality
+// of its non-text content parts, or mixed when they have different modalities
+func requestModality(p *parsedRequest) string {
+	modality := modalityText
+	for _, message := range p.chat {
+		parts, ok := message.content.([]any)
+		if !ok {
+			continue
+		}
+		for _, part := range parts {
+			p, ok := part.(map[string]any)
+			if !ok {
+				continue
+			}
+			partType, _ := p["type"].(string)
+			partModality, ok := contentPartModalities[partType]
+			if !ok {
+				continue
+			}
+			if modality == modalityText {
+				modality = partModality
+			} else if modality != partModality {
+				return modalityMixed
+			}
+		}
+	}
+	return modality
+}
@@ -0,0 +1,132 @@
+/*
+Copyright 2025 The llm-d Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package proxy
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/llm-d/llm-d-routing-sidecar/test/mock"
+	. "github.com/onsi/ginkgo/v2" // nolint:revive
+	. "github.com/onsi/gomega"    // nolint:revive
+	"k8s.io/klog/v2/ktesting"
+)
+
+const imageRequest = `{"model": "Qwen/Qwen2-VL-2B", "messages": [{"role": "user", "content": [
+	{"type": "text", "text": "What is in this image?"},
+	{"type": "image_url", "image_url": {"url": "data:image/png;base64,iVBORw0KGgo="}}]}]}`
+
+var _ = Describe("Multimodal requests", func() {
+	DescribeTable("should detect the request modality",
+		func(body string, expected string) {
+			Expect(requestModality(mustParse(body))).To(Equal(expected))
+		},
+		Entry("when the content is a string", `{"messages": [{"role": "user", "content": "Hello"}]}`, modalityText),
+		Entry("when the content parts are text", `{"messages": [{"role": "user", "content": [{"type": "text", "text": "Hello"}]}]}`, modalityText),
+		Entry("when a content part is an image", imageRequest, modalityImage),
+		Entry("when a content part is an audio", `{"messages": [{"role": "user", "content": [{"type": "input_audio", "input_audio": {"data": "", "format": "wav"}}]}]}`, modalityAudio),
+		Entry("when a content part is a video", `{"messages": [{"role": "user", "content": [{"type": "video_url", "video_url": {"url": "http://video"}}]}]}`, modalityVideo),
+		Entry("when the content parts have different modalities", `{"messages": [{"role": "user", "content": [{"type": "image_url"}, {"type": "audio_url"}]}]}`, modalityMixed),
+		Entry("when the request is a completion", `{"prompt": "Hello"}`, modalityText),
+	)
+
+	var (
+		ctx            context.Context
+		decodeHandler  *mock.ChatCompletionHandler
+		prefillHandler *mock.ChatCompletionHandler
+		prefillHost    string
+		decodeURL      *url.URL
+	)
+
+	BeforeEach(func() {
+		_, ctx = ktesting.NewTestContext(GinkgoT())
+		var cancelFn context.CancelFunc
+		ctx, cancelFn = context.WithCancel(ctx)
+		DeferCleanup(cancelFn)
+
+		decodeHandler = &mock.ChatCompletionHandler{Connector: ConnectorNIXLV2, Role: mock.RoleDecode}
+		decodeBackend := httptest.NewServer(decodeHandler)
+		DeferCleanup(decodeBackend.Close)
+
+		prefillHandler = &mock.ChatCompletionHandler{Connector: ConnectorNIXLV2, Role: mock.RolePrefill}
+		prefillBackend := httptest.NewServer(prefillHandler)
+		DeferCleanup(prefillBackend.Close)
+		prefillHost = prefillBackend.URL[len("http://"):]
+
+		var err error
+		decodeURL, err = url.Parse(decodeBackend.URL)
+		Expect(err).ToNot(HaveOccurred())
+	})
+
+	startProxy := func(config Config) string {
+		proxy, err := NewProxy("0", decodeURL, config)
+		Expect(err).ToNot(HaveOccurred())
+
+		go func() {
+			defer GinkgoRecover()
+			Expect(proxy.Start(ctx)).To(Succeed())
+		}()
+		time.Sleep(1 * time.Second)
+		Expect(proxy.Addr()).ToNot(BeNil())
+		return "http://" + proxy.Addr().String()
+	}
+
+	sendRequest := func(proxyBaseURL string, body string) int {
+		req, err := http.NewRequest(http.MethodPost, proxyBaseURL+ChatCompletionsPath, strings.NewReader(body))
+		Expect(err).ToNot(HaveOccurred())
+		req.Header.Add(requestHeaderPrefillHostPort, prefillHost)
+
+		resp, err := http.DefaultClient.Do(req)
+		Expect(err).ToNot(HaveOccurred())
+		resp.Body.Close() //nolint:all
+		return resp.StatusCode
+	}
+
+	It("should disaggregate multimodal requests by default", func() {
+		proxyBaseURL := startProxy(Config{Connector: ConnectorNIXLV2})
+
+		Expect(sendRequest(proxyBaseURL, imageRequest)).To(Equal(http.StatusOK))
+		Expect(prefillHandler.RequestCount.Load()).To(BeNumerically("==", 1))
+		Expect(decodeHandler.RequestCount.Load()).To(BeNumerically("==", 1))
+	})
+
+	It("should send multimodal requests decode-only when configured", func() {
+		proxyBaseURL := startProxy(Config{Connector: ConnectorNIXLV2, MultimodalDecodeOnly: true})
+
+		Expect(sendRequest(proxyBaseURL, imageRequest)).To(Equal(http.StatusOK))
+		Expect(prefillHandler.RequestCount.Load()).To(BeNumerically("==", 0))
+		Expect(decodeHandler.RequestCount.Load()).To(BeNumerically("==", 1))
+		Expect(decodeHandler.CompletionRequests[0]).ToNot(HaveKey(requestFieldKVTransferParams))
+
+		By("still disaggregating text requests")
+		textRequest := `{"model": "Qwen/Qwen2-VL-2B", "messages": [{"role": "user", "content": "Hello"}]}`
+		Expect(sendRequest(proxyBaseURL, textRequest)).To(Equal(http.StatusOK))
+		Expect(prefillHandler.RequestCount.Load()).To(BeNumerically("==", 1))
+	})
+
+	It("should reject request bodies larger than the limit", func() {
+		proxyBaseURL := startProxy(Config{Connector: ConnectorNIXLV2, MaxRequestBodyBytes: 64})
+
+		Expect(sendRequest(proxyBaseURL, imageRequest)).To(Equal(http.StatusRequestEntityTooLarge))
+		Expect(prefillHandler.RequestCount.Load()).To(BeNumerically("==", 0))
+		Expect(decodeHandler.RequestCount.Load()).To(BeNumerically("==", 0))
+	})
+})
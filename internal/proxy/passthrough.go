@@ -0,0 +1,75 @@
+/*
+Copyright 2025 The llm-d Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package proxy
+
+import (
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+)
+
+const (
+	// PassthroughAll forwards all the requests not intercepted by the proxy to the decoder
+	PassthroughAll = "all"
+
+	// PassthroughOpenAIOnly only forwards the OpenAI API requests, under /v1/, to the decoder
+	PassthroughOpenAIOnly = "openai-only"
+
+	// PassthroughList only forwards the requests of the PassthroughPaths to the decoder
+	PassthroughList = "list"
+
+	openAIPathPrefix = "/v1/"
+)
+
+// validatePassthrough checks the passthrough policy of the configuration
+func (s *Server) validatePassthrough() error {
+	switch s.config.Passthrough {
+	case "", PassthroughAll, PassthroughOpenAIOnly:
+		return nil
+	case PassthroughList:
+		if len(s.config.PassthroughPaths) == 0 {
+			return fmt.Errorf("the %s passthrough policy requires paths", PassthroughList)
+		}
+		return nil
+	default:
+		return fmt.Errorf("unknown passthrough policy %q", s.config.Passthrough)
+	}
+}
+
+// passthroughAllowed reports whether a request not intercepted by the proxy is forwarded to
+// the decoder. The paths of the list ending with / allow the paths under them.
+func (s *Server) passthroughAllowed(path string) bool {
+	switch s.config.Passthrough {
+	case PassthroughOpenAIOnly:
+		return strings.HasPrefix(path, openAIPathPrefix)
+	case PassthroughList:
+		return slices.ContainsFunc(s.config.PassthroughPaths, func(allowed string) bool {
+			return path == allowed || (strings.HasSuffix(allowed, "/") && strings.HasPrefix(path, allowed))
+		})
+	default:
+		return true
+	}
+}
+
+// denyPassthrough rejects a request not allowed by the passthrough policy
+func (s *Server) denyPassthrough(w http.ResponseWriter, r *http.Request) {
+	s.logger.V(4).Info("path not allowed by the passthrough policy", "path", r.URL.Path, "policy", s.config.Passthrough)
+	if err := errorStatus(http.StatusForbidden, "path not allowed by the passthrough policy", w); err != nil {
+		s.logger.Error(err, "failed to send error response to client")
+	}
+}
@@ -0,0 +1,74 @@
+/*
+Copyright 2025 The llm-d Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+
+	"github.com/go-logr/logr"
+	. "github.com/onsi/ginkgo/v2" // nolint:revive
+	. "github.com/onsi/gomega"    // nolint:revive
+)
+
+var _ = Describe("Passthrough policy", func() {
+	DescribeTable("should decide which paths are forwarded to the decoder",
+		func(policy string, paths []string, path string, allowed bool) {
+			s := &Server{config: Config{Passthrough: policy, PassthroughPaths: paths}}
+			Expect(s.passthroughAllowed(path)).To(Equal(allowed))
+		},
+		Entry("all by default", "", nil, "/collective_rpc", true),
+		Entry("all", PassthroughAll, nil, "/invocations", true),
+		Entry("OpenAI path with openai-only", PassthroughOpenAIOnly, nil, "/v1/models", true),
+		Entry("engine path with openai-only", PassthroughOpenAIOnly, nil, "/invocations", false),
+		Entry("path of the list", PassthroughList, []string{"/version", "/v1/"}, "/version", true),
+		Entry("path under a list prefix", PassthroughList, []string{"/version", "/v1/"}, "/v1/embeddings", true),
+		Entry("path under a list path", PassthroughList, []string{"/version", "/v1/"}, "/version/details", false),
+		Entry("path out of the list", PassthroughList, []string{"/version", "/v1/"}, "/start_profile", false),
+	)
+
+	It("should reject the requests not allowed", func() {
+		forwarded := 0
+		s := &Server{
+			config: Config{Passthrough: PassthroughOpenAIOnly},
+			decoderProxy: http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+				forwarded++
+				w.WriteHeader(http.StatusOK)
+			}),
+			logger: logr.Discard(),
+		}
+
+		rec := httptest.NewRecorder()
+		s.passthroughHandler(rec, httptest.NewRequest(http.MethodPost, "/collective_rpc", nil))
+		Expect(rec.Code).To(Equal(http.StatusForbidden))
+		Expect(rec.Body.String()).To(ContainSubstring("passthrough policy"))
+
+		rec = httptest.NewRecorder()
+		s.passthroughHandler(rec, httptest.NewRequest(http.MethodGet, "/v1/models", nil))
+		Expect(rec.Code).To(Equal(http.StatusOK))
+		Expect(forwarded).To(Equal(1))
+	})
+
+	It("should validate the policy", func() {
+		s := &Server{config: Config{Passthrough: "none"}}
+		Expect(s.validatePassthrough()).To(MatchError(ContainSubstring("unknown passthrough policy")))
+		s.config.Passthrough = PassthroughList
+		Expect(s.validatePassthrough()).To(MatchError(ContainSubstring("requires paths")))
+		s.config.PassthroughPaths = []string{"/v1/"}
+		Expect(s.validatePassthrough()).To(Succeed())
+	})
+})
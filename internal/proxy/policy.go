@@ -0,0 +1,221 @@
+/*
+Copyright 2025 The llm-d Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package proxy
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/google/cel-go/cel"
+
+	"github.com/llm-d/llm-d-routing-sidecar/internal/metrics"
+)
+
+const (
+	// Routing policy decisions. Any other decision is the host:port of the prefiller to use.
+	policyAllow  = "allow"
+	policyDeny   = "deny"
+	policyDecode = "decode"
+
+	policyTimeout = 2 * time.Second
+)
+
+// policyInput is what the routing policies decide on
+type policyInput struct {
+	Headers      map[string]string `json:"headers"`
+	Path         string            `json:"path"`
+	Model        string            `json:"model"`
+	PromptTokens int               `json:"prompt_tokens"`
+	Modality     string            `json:"modality"`
+	Target       string            `json:"target"`
+}
+
+// routingPolicy decides how a completion request is routed: allowed as is, denied, sent
+// decode-only or prefilled by another prefiller
+type routingPolicy interface {
+	decide(ctx context.Context, input policyInput) (string, error)
+}
+
+func newRoutingPolicy(expression string, url string) (routingPolicy, error) {
+	switch {
+	case expression != "" && url != "":
+		return nil, errors.New("a routing policy is either a CEL expression or an OPA endpoint")
+	case expression != "":
+		return newCELPolicy(expression)
+	case url != "":
+		return &opaPolicy{url: url, client: &http.Client{Timeout: policyTimeout}}, nil
+	}
+	return nil, nil
+}
+
+// celPolicy evaluates a CEL expression returning the decision, or a bool allowing or denying
+// the request
+type celPolicy struct {
+	program cel.Program
+}
+
+func newCELPolicy(expression string) (*celPolicy, error) {
+	env, err := cel.NewEnv(
+		cel.Variable("headers", cel.MapType(cel.StringType, cel.StringType)),
+		cel.Variable("path", cel.StringType),
+		cel.Variable("model", cel.StringType),
+		cel.Variable("prompt_tokens", cel.IntType),
+		cel.Variable("modality", cel.StringType),
+		cel.Variable("target", cel.StringType),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	ast, issues := env.Compile(expression)
+	if issues != nil && issues.Err() != nil {
+		return nil, fmt.Errorf("invalid routing policy: %w", issues.Err())
+	}
+	if t := ast.OutputType(); !t.IsExactType(cel.StringType) && !t.IsExactType(cel.BoolType) && !t.IsExactType(cel.DynType) {
+		return nil, fmt.Errorf("the routing policy must return a string or a bool, not %s", t)
+	}
+
+	program, err := env.Program(ast)
+	if err != nil {
+		return nil, fmt.Errorf("invalid routing policy: %w", err)
+	}
+	return &celPolicy{program: program}, nil
+}
+
+func (p *celPolicy) decide(ctx context.Context, input policyInput) (string, error) {
+	out, _, err := p.program.ContextEval(ctx, map[string]any{
+		"headers":       input.Headers,
+		"path":          input.Path,
+		"model":         input.Model,
+		"prompt_tokens": input.PromptTokens,
+		"modality":      input.Modality,
+		"target":        input.Target,
+	})
+	if err != nil {
+		return "", err
+	}
+	return policyDecision(out.Value())
+}
+
+// opaPolicy queries an OPA decision endpoint, e.g. http://localhost:8181/v1/data/llmd/routing,
+// whose result is the decision or a bool allowing or denying the request
+type opaPolicy struct {
+	url    string
+	client *http.Client
+}
+
+func (p *opaPolicy) decide(ctx context.Context, input policyInput) (string, error) {
+	body, err := json.Marshal(map[string]any{"input": input})
+	if err != nil {
+		return "", err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.url, bytes.NewReader(body))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close() //nolint:all
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("OPA returned status code %d", resp.StatusCode)
+	}
+
+	var response struct {
+		Result any `json:"result"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+		return "", err
+	}
+	if response.Result == nil {
+		return "", errors.New("the OPA routing policy is undefined")
+	}
+	return policyDecision(response.Result)
+}
+
+// policyDecision returns the decision of a policy result
+func policyDecision(result any) (string, error) {
+	switch decision := result.(type) {
+	case bool:
+		if decision {
+			return policyAllow, nil
+		}
+		return policyDeny, nil
+	case string:
+		if decision == "" {
+			return policyAllow, nil
+		}
+		return decision, nil
+	}
+	return "", fmt.Errorf("unexpected routing policy result %v", result)
+}
+
+// applyRoutingPolicy returns the prefill target of a completion request decided by the
+// routing policy, empty for decode-only. Denied requests are answered with 403, and so are
+// requests the policy fails to decide on.
+func (s *Server) applyRoutingPolicy(w http.ResponseWriter, r *http.Request, p *parsedRequest, modality string, target string) (string, bool) {
+	input := policyInput{
+		Headers:      make(map[string]string, len(r.Header)),
+		Path:         r.URL.Path,
+		Model:        p.model,
+		PromptTokens: estimatePromptTokens(p),
+		Modality:     modality,
+		Target:       target,
+	}
+	for name, values := range r.Header {
+		input.Headers[strings.ToLower(name)] = values[0]
+	}
+
+	decision, err := s.policy.decide(r.Context(), input)
+	if err != nil {
+		s.logger.Error(err, "failed to evaluate routing policy, denying request")
+		metrics.RecordPolicyDecision(s.rank(), "error")
+		if err := errorStatus(http.StatusForbidden, "Forbidden: routing policy failed", w); err != nil {
+			s.logger.Error(err, "failed to send error response to client")
+		}
+		return "", false
+	}
+
+	switch decision {
+	case policyAllow:
+		metrics.RecordPolicyDecision(s.rank(), policyAllow)
+		return target, true
+	case policyDeny:
+		s.logger.V(4).Info("request denied by routing policy", "target", target, "model", input.Model)
+		metrics.RecordPolicyDecision(s.rank(), policyDeny)
+		if err := errorStatus(http.StatusForbidden, "Forbidden: denied by routing policy", w); err != nil {
+			s.logger.Error(err, "failed to send error response to client")
+		}
+		return "", false
+	case policyDecode:
+		s.logger.V(4).Info("routing policy forces decode-only", "target", target)
+		metrics.RecordPolicyDecision(s.rank(), policyDecode)
+		return "", true
+	}
+	s.logger.V(4).Info("routing policy rewrites prefill target", "target", target, "rewritten", decision)
+	metrics.RecordPolicyDecision(s.rank(), "rewrite")
+	return decision, true
+}
@@ -0,0 +1,175 @@
+/*
+Copyright 2025 The llm-d Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package proxy
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/llm-d/llm-d-routing-sidecar/test/mock"
+	. "github.com/onsi/ginkgo/v2" // nolint:revive
+	. "github.com/onsi/gomega"    // nolint:revive
+	"k8s.io/klog/v2/ktesting"
+)
+
+var _ = Describe("Routing policy", func() {
+	DescribeTable("should evaluate CEL expressions",
+		func(expression string, expected string) {
+			policy, err := newCELPolicy(expression)
+			Expect(err).ToNot(HaveOccurred())
+			decision, err := policy.decide(context.Background(), policyInput{
+				Headers:      map[string]string{"x-tenant": "free"},
+				Path:         ChatCompletionsPath,
+				Model:        "llama",
+				PromptTokens: 2000,
+				Modality:     modalityText,
+				Target:       "10.0.0.1:8000",
+			})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(decision).To(Equal(expected))
+		},
+		Entry("returning true", `model == "llama"`, policyAllow),
+		Entry("returning false", `headers["x-tenant"] != "free"`, policyDeny),
+		Entry("forcing decode-only", `prompt_tokens < 4096 ? "decode" : "allow"`, policyDecode),
+		Entry("rewriting the target", `target.startsWith("10.0.") ? "prefill-b:8000" : "allow"`, "prefill-b:8000"),
+		Entry("returning an empty string", `""`, policyAllow),
+	)
+
+	It("should reject invalid CEL expressions", func() {
+		_, err := newCELPolicy(`model ==`)
+		Expect(err).To(HaveOccurred())
+		_, err = newCELPolicy(`prompt_tokens + 1`)
+		Expect(err).To(HaveOccurred())
+		_, err = newRoutingPolicy(`true`, "http://localhost:8181/v1/data/llmd/routing")
+		Expect(err).To(HaveOccurred())
+	})
+
+	Describe("on completion requests", func() {
+		var (
+			ctx            context.Context
+			decodeHandler  *mock.ChatCompletionHandler
+			prefillHandler *mock.ChatCompletionHandler
+			prefillHost    string
+			decodeURL      *url.URL
+		)
+
+		BeforeEach(func() {
+			_, ctx = ktesting.NewTestContext(GinkgoT())
+			var cancelFn context.CancelFunc
+			ctx, cancelFn = context.WithCancel(ctx)
+			DeferCleanup(cancelFn)
+
+			decodeHandler = &mock.ChatCompletionHandler{Connector: ConnectorNIXLV2, Role: mock.RoleDecode}
+			decodeBackend := httptest.NewServer(decodeHandler)
+			DeferCleanup(decodeBackend.Close)
+
+			prefillHandler = &mock.ChatCompletionHandler{Connector: ConnectorNIXLV2, Role: mock.RolePrefill}
+			prefillBackend := httptest.NewServer(prefillHandler)
+			DeferCleanup(prefillBackend.Close)
+			prefillHost = prefillBackend.URL[len("http://"):]
+
+			var err error
+			decodeURL, err = url.Parse(decodeBackend.URL)
+			Expect(err).ToNot(HaveOccurred())
+		})
+
+		startProxy := func(config Config) string {
+			config.Connector = ConnectorNIXLV2
+			proxy, err := NewProxy("0", decodeURL, config)
+			Expect(err).ToNot(HaveOccurred())
+
+			go func() {
+				defer GinkgoRecover()
+				Expect(proxy.Start(ctx)).To(Succeed())
+			}()
+			time.Sleep(1 * time.Second)
+			Expect(proxy.Addr()).ToNot(BeNil())
+			return "http://" + proxy.Addr().String()
+		}
+
+		sendRequest := func(proxyBaseURL string, tenant string, prefiller string) int {
+			body := `{"model": "llama", "prompt": "Hello", "max_tokens": 10}`
+			req, err := http.NewRequest(http.MethodPost, proxyBaseURL+CompletionsPath, strings.NewReader(body))
+			Expect(err).ToNot(HaveOccurred())
+			req.Header.Set("X-Tenant", tenant)
+			if prefiller != "" {
+				req.Header.Add(requestHeaderPrefillHostPort, prefiller)
+			}
+
+			resp, err := http.DefaultClient.Do(req)
+			Expect(err).ToNot(HaveOccurred())
+			resp.Body.Close() //nolint:all
+			return resp.StatusCode
+		}
+
+		It("should deny, send decode-only or allow requests", func() {
+			proxyBaseURL := startProxy(Config{RoutingPolicy: `headers["x-tenant"] == "blocked" ? "deny" : headers["x-tenant"] == "free" ? "decode" : "allow"`})
+
+			Expect(sendRequest(proxyBaseURL, "blocked", prefillHost)).To(Equal(http.StatusForbidden))
+			Expect(decodeHandler.RequestCount.Load()).To(BeNumerically("==", 0))
+
+			Expect(sendRequest(proxyBaseURL, "free", prefillHost)).To(Equal(http.StatusOK))
+			Expect(prefillHandler.RequestCount.Load()).To(BeNumerically("==", 0))
+			Expect(decodeHandler.RequestCount.Load()).To(BeNumerically("==", 1))
+
+			Expect(sendRequest(proxyBaseURL, "paid", prefillHost)).To(Equal(http.StatusOK))
+			Expect(prefillHandler.RequestCount.Load()).To(BeNumerically("==", 1))
+			Expect(decodeHandler.RequestCount.Load()).To(BeNumerically("==", 2))
+		})
+
+		It("should rewrite the prefill target", func() {
+			proxyBaseURL := startProxy(Config{RoutingPolicy: `headers["x-tenant"] == "paid" ? "` + prefillHost + `" : "allow"`})
+
+			Expect(sendRequest(proxyBaseURL, "paid", "")).To(Equal(http.StatusOK))
+			Expect(prefillHandler.RequestCount.Load()).To(BeNumerically("==", 1))
+		})
+
+		It("should query an OPA endpoint and deny requests when it fails", func() {
+			var inputs []policyInput
+			decision := "decode"
+			opa := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				var request struct {
+					Input policyInput `json:"input"`
+				}
+				Expect(json.NewDecoder(r.Body).Decode(&request)).To(Succeed())
+				inputs = append(inputs, request.Input)
+				if decision == "" {
+					w.WriteHeader(http.StatusInternalServerError)
+					return
+				}
+				json.NewEncoder(w).Encode(map[string]any{"result": decision}) //nolint:all
+			}))
+			DeferCleanup(opa.Close)
+
+			proxyBaseURL := startProxy(Config{RoutingPolicyURL: opa.URL})
+			Expect(sendRequest(proxyBaseURL, "free", prefillHost)).To(Equal(http.StatusOK))
+			Expect(prefillHandler.RequestCount.Load()).To(BeNumerically("==", 0))
+			Expect(inputs).To(HaveLen(1))
+			Expect(inputs[0].Model).To(Equal("llama"))
+			Expect(inputs[0].Target).To(Equal(prefillHost))
+			Expect(inputs[0].Headers).To(HaveKeyWithValue("x-tenant", "free"))
+
+			decision = ""
+			Expect(sendRequest(proxyBaseURL, "free", prefillHost)).To(Equal(http.StatusForbidden))
+		})
+	})
+})
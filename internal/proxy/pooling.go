@@ -0,0 +1,32 @@
+/*
+Copyright 2025 The llm-d Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package proxy
+
+var (
+	// ScorePath is the vLLM score path
+	ScorePath = "/score"
+
+	// RerankPath is the vLLM (Jina and Cohere compatible) rerank path
+	RerankPath = "/v1/rerank"
+
+	// PoolingPath is the vLLM pooling path
+	PoolingPath = "/pooling"
+
+	// poolingPaths are the paths of the pooling model endpoints, including their aliases.
+	// These never need a remote prefill and are sent decode-only.
+	poolingPaths = []string{ScorePath, "/v1/score", "/rerank", RerankPath, "/v2/rerank", PoolingPath}
+)
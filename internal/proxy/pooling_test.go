@@ -0,0 +1,92 @@
+/*
+Copyright 2025 The llm-d Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package proxy
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/llm-d/llm-d-routing-sidecar/internal/metrics"
+	"github.com/llm-d/llm-d-routing-sidecar/test/mock"
+	. "github.com/onsi/ginkgo/v2" // nolint:revive
+	. "github.com/onsi/gomega"    // nolint:revive
+	"k8s.io/klog/v2/ktesting"
+)
+
+var _ = Describe("Pooling endpoints", func() {
+	It("should send score, rerank and pooling requests decode-only with their own metrics", func() {
+		_, ctx := ktesting.NewTestContext(GinkgoT())
+		ctx, cancelFn := context.WithCancel(ctx)
+		defer cancelFn()
+
+		decodeHandler := &mock.GenericHandler{}
+		decodeBackend := httptest.NewServer(decodeHandler)
+		DeferCleanup(decodeBackend.Close)
+
+		prefillHandler := &mock.GenericHandler{}
+		prefillBackend := httptest.NewServer(prefillHandler)
+		DeferCleanup(prefillBackend.Close)
+
+		decodeURL, err := url.Parse(decodeBackend.URL)
+		Expect(err).ToNot(HaveOccurred())
+		proxy, err := NewProxy("0", decodeURL, Config{Connector: ConnectorNIXLV2})
+		Expect(err).ToNot(HaveOccurred())
+
+		go func() {
+			defer GinkgoRecover()
+			Expect(proxy.Start(ctx)).To(Succeed())
+		}()
+		time.Sleep(1 * time.Second)
+		Expect(proxy.Addr()).ToNot(BeNil())
+
+		for _, path := range []string{ScorePath, RerankPath, PoolingPath} {
+			body := `{"model": "BAAI/bge-reranker-base", "query": "a", "documents": ["b"]}`
+			req, err := http.NewRequest(http.MethodPost, "http://"+proxy.Addr().String()+path, strings.NewReader(body))
+			Expect(err).ToNot(HaveOccurred())
+			req.Header.Add(requestHeaderPrefillHostPort, prefillBackend.URL[len("http://"):])
+
+			resp, err := http.DefaultClient.Do(req)
+			Expect(err).ToNot(HaveOccurred())
+			resp.Body.Close() //nolint:all
+			Expect(resp.StatusCode).To(Equal(http.StatusOK))
+		}
+
+		Expect(decodeHandler.RequestCount.Load()).To(BeNumerically("==", 3))
+		Expect(prefillHandler.RequestCount.Load()).To(BeNumerically("==", 0))
+
+		families, err := metrics.Registry.Gather()
+		Expect(err).ToNot(HaveOccurred())
+		routes := []string{}
+		for _, family := range families {
+			if family.GetName() != "llm_d_routing_sidecar_requests_total" {
+				continue
+			}
+			for _, metric := range family.Metric {
+				for _, label := range metric.Label {
+					if label.GetName() == "route" {
+						routes = append(routes, label.GetValue())
+					}
+				}
+			}
+		}
+		Expect(routes).To(ContainElements(ScorePath, RerankPath, PoolingPath))
+	})
+})
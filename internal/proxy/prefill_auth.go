@@ -0,0 +1,216 @@
+/*
+Copyright 2025 The llm-d Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package proxy
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	// requestHeaderCallerAuthorization carries the bearer token of the decode side, leaving
+	// the Authorization header of the client to the prefiller
+	requestHeaderCallerAuthorization = "x-llm-d-caller-authorization"
+	// requestHeaderCallerSignature carries the HMAC signature of a prefill request
+	requestHeaderCallerSignature = "x-llm-d-caller-signature"
+
+	// prefillCredentialsRefreshInterval is how often the token and the HMAC key are read
+	// again, well within the rotation of projected ServiceAccount tokens
+	prefillCredentialsRefreshInterval = time.Minute
+)
+
+// credentialFile is a secret read from a file, read again once refreshed, e.g. when the
+// kubelet rotates a projected token. A file failing to be read again keeps the previous
+// content.
+type credentialFile struct {
+	path     string
+	validate func([]byte) error
+
+	mu      sync.Mutex
+	content []byte
+	read    time.Time
+}
+
+func loadCredentialFile(path string, validate func([]byte) error) (*credentialFile, error) {
+	f := &credentialFile{path: path, validate: validate}
+	content, err := f.load()
+	if err != nil {
+		return nil, err
+	}
+	f.content, f.read = content, time.Now()
+	return f, nil
+}
+
+func (f *credentialFile) load() ([]byte, error) {
+	content, err := os.ReadFile(f.path)
+	if err != nil {
+		return nil, err
+	}
+	content = bytes.TrimSpace(content)
+	if len(content) == 0 {
+		return nil, fmt.Errorf("%s is empty", f.path)
+	}
+	if f.validate != nil {
+		if err := f.validate(content); err != nil {
+			return nil, fmt.Errorf("%s: %w", f.path, err)
+		}
+	}
+	return content, nil
+}
+
+// get returns the content of the file, read again when refreshed
+func (f *credentialFile) get() ([]byte, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if time.Since(f.read) >= prefillCredentialsRefreshInterval {
+		content, err := f.load()
+		f.read = time.Now() // retried at the next refresh
+		if err != nil {
+			return f.content, err
+		}
+		f.content = content
+	}
+	return f.content, nil
+}
+
+// prefillAuthenticator authenticates the prefill requests to the prefillers, with a bearer
+// token and/or an HMAC signature
+type prefillAuthenticator struct {
+	token   *credentialFile
+	hmacKey *credentialFile
+}
+
+func newPrefillAuthenticator(config Config) (*prefillAuthenticator, error) {
+	a := &prefillAuthenticator{}
+	var err error
+	if config.PrefillerTokenFile != "" {
+		a.token, err = loadCredentialFile(config.PrefillerTokenFile, func(token []byte) error {
+			return checkTokenAudience(token, config.PrefillerTokenAudience)
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to read the prefiller token: %w", err)
+		}
+	}
+	if config.PrefillerHMACKeyFile != "" {
+		a.hmacKey, err = loadCredentialFile(config.PrefillerHMACKeyFile, nil)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read the prefiller HMAC key: %w", err)
+		}
+	}
+	return a, nil
+}
+
+// checkTokenAudience checks a JWT is issued for the audience, if any. The signature is left
+// to the prefiller side.
+func checkTokenAudience(token []byte, audience string) error {
+	if audience == "" {
+		return nil
+	}
+
+	parts := bytes.Split(token, []byte("."))
+	if len(parts) != 3 {
+		return errors.New("the token is not a JWT")
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(string(parts[1]))
+	if err != nil {
+		return fmt.Errorf("invalid JWT payload: %w", err)
+	}
+	var claims struct {
+		Audience json.RawMessage `json:"aud"`
+	}
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return fmt.Errorf("invalid JWT claims: %w", err)
+	}
+
+	// the audience is a string or a list of strings
+	var audiences []string
+	if err := json.Unmarshal(claims.Audience, &audiences); err != nil {
+		var aud string
+		if err := json.Unmarshal(claims.Audience, &aud); err != nil {
+			return errors.New("the token has no audience")
+		}
+		audiences = []string{aud}
+	}
+	if !slices.Contains(audiences, audience) {
+		return fmt.Errorf("the token is not issued for audience %q, got %q", audience, audiences)
+	}
+	return nil
+}
+
+// authenticate sets the credentials of a prefill request with the given body. The signature
+// covers the time, a random nonce, the method, the path, the query and the digest of the body.
+func (a *prefillAuthenticator) authenticate(r *http.Request, body requestBody) error {
+	var errs []error
+	if a.token != nil {
+		token, err := a.token.get()
+		if err != nil {
+			errs = append(errs, fmt.Errorf("failed to refresh the prefiller token, sending the previous one: %w", err))
+		}
+		r.Header.Set(requestHeaderCallerAuthorization, "Bearer "+string(token))
+	}
+
+	if a.hmacKey != nil {
+		key, err := a.hmacKey.get()
+		if err != nil {
+			errs = append(errs, fmt.Errorf("failed to refresh the prefiller HMAC key, signing with the previous one: %w", err))
+		}
+		digest := sha256.New()
+		if _, err := io.Copy(digest, body.body()); err != nil {
+			return errors.Join(append(errs, fmt.Errorf("failed to sign the prefill request: %w", err))...)
+		}
+		timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+		nonce := rand.Text()
+		r.Header.Set(requestHeaderCallerSignature, "t="+timestamp+",n="+nonce+",v1="+
+			prefillSignature(key, timestamp, nonce, r.Method, r.URL, digest.Sum(nil)))
+	}
+	return errors.Join(errs...)
+}
+
+// prefillSignature returns the HMAC-SHA256 of a prefill request, in hex. The escaped path
+// has no '?', so it is told apart from the query.
+func prefillSignature(key []byte, timestamp string, nonce string, method string, u *url.URL, bodyDigest []byte) string {
+	mac := hmac.New(sha256.New, key)
+	fmt.Fprintf(mac, "%s.%s.%s.%s?%s.%x", timestamp, nonce, method, u.EscapedPath(), u.RawQuery, bodyDigest)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// authenticatePrefill sets the credentials of a prefill request, if configured. A credential
+// failing to refresh is reported, the previous one being sent.
+func (s *Server) authenticatePrefill(r *http.Request, body requestBody) {
+	if s.prefillAuth == nil {
+		return
+	}
+	if err := s.prefillAuth.authenticate(r, body); err != nil {
+		s.logger.Error(err, "prefill request authentication")
+	}
+}
@@ -0,0 +1,148 @@
+/*
+Copyright 2025 The llm-d Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package proxy
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	. "github.com/onsi/ginkgo/v2" // nolint:revive
+	. "github.com/onsi/gomega"    // nolint:revive
+)
+
+// fakeJWT returns an unsigned JWT with the given claims
+func fakeJWT(claims string) string {
+	encode := base64.RawURLEncoding.EncodeToString
+	return encode([]byte(`{"alg":"RS256"}`)) + "." + encode([]byte(claims)) + ".c2lnbmF0dXJl"
+}
+
+var _ = Describe("Prefill authentication", func() {
+	var dir string
+
+	BeforeEach(func() {
+		dir = GinkgoT().TempDir()
+	})
+
+	writeFile := func(name string, content string) string {
+		path := filepath.Join(dir, name)
+		Expect(os.WriteFile(path, []byte(content), 0o600)).To(Succeed())
+		return path
+	}
+
+	newProxy := func(config Config) (*Server, error) {
+		decodeURL, err := url.Parse("http://localhost:8000")
+		Expect(err).ToNot(HaveOccurred())
+		return NewProxy("0", decodeURL, config)
+	}
+
+	// prefill returns a prefill request with its credentials
+	prefill := func(proxy *Server, body string) *http.Request {
+		pbody, err := encodeRequestBody(map[string]any{"prompt": body})
+		Expect(err).ToNot(HaveOccurred())
+		defer pbody.release()
+
+		preq := httptest.NewRequest(http.MethodPost, CompletionsPath, nil)
+		setRequestBody(preq, pbody.body(), pbody.Len())
+		proxy.authenticatePrefill(preq, pbody)
+		return preq
+	}
+
+	It("should send the token issued for the audience", func() {
+		token := fakeJWT(`{"aud": ["prefill", "other"], "sub": "system:serviceaccount:llm:decode"}`)
+		proxy, err := newProxy(Config{PrefillerTokenFile: writeFile("token", token+"\n"), PrefillerTokenAudience: "prefill"})
+		Expect(err).ToNot(HaveOccurred())
+
+		preq := prefill(proxy, "Hello")
+		Expect(preq.Header.Get(requestHeaderCallerAuthorization)).To(Equal("Bearer " + token))
+		Expect(preq.Header.Get(requestHeaderCallerSignature)).To(BeEmpty())
+	})
+
+	DescribeTable("should reject the tokens of other audiences",
+		func(token string, expected string) {
+			_, err := newProxy(Config{PrefillerTokenFile: writeFile("token", token), PrefillerTokenAudience: "prefill"})
+			Expect(err).To(MatchError(ContainSubstring(expected)))
+		},
+		Entry("when the audience differs", fakeJWT(`{"aud": "decode"}`), `not issued for audience "prefill"`),
+		Entry("when there is no audience", fakeJWT(`{"sub": "decode"}`), "no audience"),
+		Entry("when the token is not a JWT", "opaque-token", "not a JWT"),
+	)
+
+	It("should keep the previous token when it cannot be read again", func() {
+		path := writeFile("token", "first")
+		proxy, err := newProxy(Config{PrefillerTokenFile: path})
+		Expect(err).ToNot(HaveOccurred())
+
+		writeFile("token", "second")
+		Expect(prefill(proxy, "Hello").Header.Get(requestHeaderCallerAuthorization)).To(Equal("Bearer first"))
+
+		proxy.prefillAuth.token.read = proxy.prefillAuth.token.read.Add(-prefillCredentialsRefreshInterval)
+		Expect(prefill(proxy, "Hello").Header.Get(requestHeaderCallerAuthorization)).To(Equal("Bearer second"))
+
+		Expect(os.Remove(path)).To(Succeed())
+		proxy.prefillAuth.token.read = proxy.prefillAuth.token.read.Add(-prefillCredentialsRefreshInterval)
+		Expect(prefill(proxy, "Hello").Header.Get(requestHeaderCallerAuthorization)).To(Equal("Bearer second"))
+	})
+
+	It("should sign the prefill requests", func() {
+		proxy, err := newProxy(Config{PrefillerHMACKeyFile: writeFile("key", "secret")})
+		Expect(err).ToNot(HaveOccurred())
+
+		parse := func(signature string) (string, string, string) {
+			var timestamp, nonce, v1 string
+			for _, part := range strings.Split(signature, ",") {
+				name, value, _ := strings.Cut(part, "=")
+				switch name {
+				case "t":
+					timestamp = value
+				case "n":
+					nonce = value
+				case "v1":
+					v1 = value
+				}
+			}
+			return timestamp, nonce, v1
+		}
+		timestamp, nonce, v1 := parse(prefill(proxy, "Hello").Header.Get(requestHeaderCallerSignature))
+		Expect(timestamp).ToNot(BeEmpty())
+		Expect(nonce).ToNot(BeEmpty())
+
+		digest := sha256.Sum256([]byte(`{"prompt":"Hello"}`))
+		mac := hmac.New(sha256.New, []byte("secret"))
+		fmt.Fprintf(mac, "%s.%s.POST.%s?.%x", timestamp, nonce, CompletionsPath, digest)
+		Expect(v1).To(Equal(hex.EncodeToString(mac.Sum(nil))))
+
+		_, other, _ := parse(prefill(proxy, "Hello").Header.Get(requestHeaderCallerSignature))
+		Expect(other).ToNot(Equal(nonce))
+	})
+
+	It("should require readable credentials", func() {
+		_, err := newProxy(Config{PrefillerHMACKeyFile: filepath.Join(dir, "missing")})
+		Expect(err).To(MatchError(ContainSubstring("prefiller HMAC key")))
+
+		_, err = newProxy(Config{PrefillerTokenFile: writeFile("token", "\n")})
+		Expect(err).To(MatchError(ContainSubstring("is empty")))
+	})
+})
@@ -0,0 +1,131 @@
+/*
+Copyright 2025 The llm-d Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package proxy
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/golang-lru/v2/expirable"
+
+	"github.com/llm-d/llm-d-routing-sidecar/internal/metrics"
+)
+
+// prefillCacheEntry is the prefill response of a request
+type prefillCacheEntry struct {
+	prefiller        string
+	kvTransferParams any
+}
+
+// prefillCache keeps the KV transfer parameters returned by prefillers for a short time,
+// so identical back-to-back requests (retries, duplicated fan-outs) are not prefilled again.
+// The entries of a prefiller are dropped when its engine ID changes, e.g. on restart.
+type prefillCache struct {
+	entries *expirable.LRU[string, *prefillCacheEntry]
+
+	mu        sync.Mutex
+	engineIDs map[string]string // last engine ID returned by each prefiller
+}
+
+func newPrefillCache(size int, ttl time.Duration) *prefillCache {
+	return &prefillCache{
+		entries:   expirable.NewLRU[string, *prefillCacheEntry](size, nil, ttl),
+		engineIDs: make(map[string]string),
+	}
+}
+
+// get returns the cached KV transfer parameters
+func (c *prefillCache) get(key string) (any, bool) {
+	entry, ok := c.entries.Get(key)
+	if !ok {
+		return nil, false
+	}
+	return entry.kvTransferParams, true
+}
+
+// add caches the KV transfer parameters returned by a prefiller
+func (c *prefillCache) add(key string, prefiller string, kvTransferParams any) {
+	engineID := ""
+	if params, ok := kvTransferParams.(map[string]any); ok {
+		engineID, _ = params[requestFieldRemoteEngineID].(string)
+	}
+
+	c.mu.Lock()
+	previous, known := c.engineIDs[prefiller]
+	c.engineIDs[prefiller] = engineID
+	c.mu.Unlock()
+
+	if known && previous != engineID {
+		c.removePrefiller(prefiller)
+	}
+	c.entries.Add(key, &prefillCacheEntry{prefiller: prefiller, kvTransferParams: kvTransferParams})
+}
+
+func (c *prefillCache) remove(key string) {
+	c.entries.Remove(key)
+}
+
+// removePrefiller drops the entries of a prefiller
+func (c *prefillCache) removePrefiller(prefiller string) {
+	for _, key := range c.entries.Keys() {
+		if entry, ok := c.entries.Peek(key); ok && entry.prefiller == prefiller {
+			c.entries.Remove(key)
+		}
+	}
+}
+
+// purge drops all the entries and returns their number
+func (c *prefillCache) purge() int {
+	count := c.entries.Len()
+	c.entries.Purge()
+
+	c.mu.Lock()
+	clear(c.engineIDs)
+	c.mu.Unlock()
+	return count
+}
+
+// lookupPrefill returns the cache key of a request to be prefilled by the given prefiller
+// and, when it was recently prefilled there, the KV transfer parameters of the prefill.
+// The key is empty when the cache is disabled.
+func (s *Server) lookupPrefill(prefiller string, body []byte) (string, any, bool) {
+	if s.prefillCache == nil {
+		return "", nil, false
+	}
+
+	hash := sha256.New()
+	hash.Write([]byte(prefiller + "\n"))
+	hash.Write(body)
+	key := hex.EncodeToString(hash.Sum(nil))
+
+	kvTransferParams, ok := s.prefillCache.get(key)
+	metrics.RecordPrefillCacheLookup(s.rank(), ok)
+	if ok {
+		s.logger.V(4).Info("prefill cache hit, skipping prefill", "prefiller", prefiller)
+	}
+	return key, kvTransferParams, ok
+}
+
+// storePrefill caches the KV transfer parameters returned by a prefiller
+func (s *Server) storePrefill(key string, prefiller string, kvTransferParams any) {
+	if key == "" || kvTransferParams == nil {
+		return
+	}
+	s.prefillCache.add(key, prefiller, kvTransferParams)
+}
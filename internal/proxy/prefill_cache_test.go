@@ -0,0 +1,147 @@
+/*
+Copyright 2025 The llm-d Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package proxy
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/llm-d/llm-d-routing-sidecar/test/mock"
+	. "github.com/onsi/ginkgo/v2" // nolint:revive
+	. "github.com/onsi/gomega"    // nolint:revive
+	"k8s.io/klog/v2/ktesting"
+)
+
+var _ = Describe("Prefill cache", func() {
+	params := func(engineID string) map[string]any {
+		return map[string]any{requestFieldRemoteEngineID: engineID, requestFieldRemoteBlockIDs: []any{1, 2}}
+	}
+
+	It("should drop the entries of a prefiller whose engine changed", func() {
+		cache := newPrefillCache(16, time.Minute)
+		cache.add("a", "prefiller-1:8000", params("engine-1"))
+		cache.add("b", "prefiller-2:8000", params("engine-2"))
+		cache.add("c", "prefiller-1:8000", params("engine-1"))
+
+		kvTransferParams, ok := cache.get("a")
+		Expect(ok).To(BeTrue())
+		Expect(kvTransferParams).To(Equal(params("engine-1")))
+
+		// prefiller-1 restarted
+		cache.add("d", "prefiller-1:8000", params("engine-3"))
+		_, ok = cache.get("a")
+		Expect(ok).To(BeFalse())
+		_, ok = cache.get("c")
+		Expect(ok).To(BeFalse())
+		_, ok = cache.get("b")
+		Expect(ok).To(BeTrue())
+		_, ok = cache.get("d")
+		Expect(ok).To(BeTrue())
+	})
+
+	It("should expire the entries", func() {
+		cache := newPrefillCache(16, 50*time.Millisecond)
+		cache.add("a", "prefiller-1:8000", params("engine-1"))
+		Eventually(func() bool {
+			_, ok := cache.get("a")
+			return ok
+		}).Should(BeFalse())
+	})
+
+	Describe("with the nixlv2 connector", func() {
+		var (
+			prefillHandler *mock.ChatCompletionHandler
+			decodeHandler  *mock.ChatCompletionHandler
+			decodeFailures atomic.Int32
+			proxyBaseURL   string
+			prefiller      string
+		)
+
+		sendRequest := func(body string) int {
+			req, err := http.NewRequest(http.MethodPost, proxyBaseURL+CompletionsPath, strings.NewReader(body))
+			Expect(err).ToNot(HaveOccurred())
+			req.Header.Add(requestHeaderPrefillHostPort, prefiller)
+
+			resp, err := http.DefaultClient.Do(req)
+			Expect(err).ToNot(HaveOccurred())
+			resp.Body.Close() //nolint:all
+			return resp.StatusCode
+		}
+
+		BeforeEach(func() {
+			_, ctx := ktesting.NewTestContext(GinkgoT())
+			ctx, cancelFn := context.WithCancel(ctx)
+			DeferCleanup(cancelFn)
+
+			prefillHandler = &mock.ChatCompletionHandler{Connector: ConnectorNIXLV2, Role: mock.RolePrefill}
+			prefillBackend := httptest.NewServer(prefillHandler)
+			DeferCleanup(prefillBackend.Close)
+
+			decodeHandler = &mock.ChatCompletionHandler{Connector: ConnectorNIXLV2, Role: mock.RoleDecode}
+			decodeFailures.Store(0)
+			decodeBackend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if decodeFailures.Load() > 0 {
+					decodeFailures.Add(-1)
+					io.Copy(io.Discard, r.Body) //nolint:all
+					w.WriteHeader(http.StatusInternalServerError)
+					return
+				}
+				decodeHandler.ServeHTTP(w, r)
+			}))
+			DeferCleanup(decodeBackend.Close)
+
+			decodeURL, err := url.Parse(decodeBackend.URL)
+			Expect(err).ToNot(HaveOccurred())
+			proxy, err := NewProxy("0", decodeURL, Config{Connector: ConnectorNIXLV2, PrefillCacheSize: 16, PrefillCacheTTL: time.Minute})
+			Expect(err).ToNot(HaveOccurred())
+
+			go func() {
+				defer GinkgoRecover()
+				Expect(proxy.Start(ctx)).To(Succeed())
+			}()
+			time.Sleep(1 * time.Second)
+			Expect(proxy.Addr()).ToNot(BeNil())
+			proxyBaseURL = "http://" + proxy.Addr().String()
+			prefiller = prefillBackend.URL[len("http://"):]
+		})
+
+		It("should skip the prefill of identical back-to-back requests", func() {
+			Expect(sendRequest(`{"model": "m", "prompt": "Hello"}`)).To(Equal(http.StatusOK))
+			Expect(sendRequest(`{"model": "m", "prompt": "Hello"}`)).To(Equal(http.StatusOK))
+			Expect(prefillHandler.RequestCount.Load()).To(BeNumerically("==", 1))
+			Expect(decodeHandler.RequestCount.Load()).To(BeNumerically("==", 2))
+			Expect(decodeHandler.CompletionRequests[1][requestFieldKVTransferParams]).
+				To(Equal(decodeHandler.CompletionRequests[0][requestFieldKVTransferParams]))
+
+			Expect(sendRequest(`{"model": "m", "prompt": "Bye"}`)).To(Equal(http.StatusOK))
+			Expect(prefillHandler.RequestCount.Load()).To(BeNumerically("==", 2))
+		})
+
+		It("should prefill again after a failed decode", func() {
+			decodeFailures.Store(1)
+			Expect(sendRequest(`{"model": "m", "prompt": "Hello"}`)).To(Equal(http.StatusInternalServerError))
+			Expect(sendRequest(`{"model": "m", "prompt": "Hello"}`)).To(Equal(http.StatusOK))
+			Expect(prefillHandler.RequestCount.Load()).To(BeNumerically("==", 2))
+		})
+	})
+})
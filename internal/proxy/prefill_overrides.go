@@ -0,0 +1,92 @@
+/*
+Copyright 2025 The llm-d Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package proxy
+
+const (
+	// PrefillBodyFull sends the prefill requests with all the fields of the client requests
+	PrefillBodyFull = "full"
+
+	// PrefillBodyMinimal strips the client-only fields the prefillers ignore from the prefill
+	// requests, e.g. to halve the bytes on the wire of large requests sent twice
+	PrefillBodyMinimal = "minimal"
+)
+
+// DefaultPrefillStripFields are the fields stripped from the prefill requests by
+// PrefillBodyMinimal. They only change the generated tokens, which the prefill discards, or the
+// response, but not the prompt.
+var DefaultPrefillStripFields = []string{
+	"logit_bias",
+	"logprobs",
+	"top_logprobs",
+	"stop",
+	"stop_token_ids",
+	"response_format",
+	"guided_json",
+	"guided_regex",
+	"guided_choice",
+	"guided_grammar",
+	"structured_outputs",
+	"user",
+	"metadata",
+	requestFieldStreamOptions,
+}
+
+// defaultPrefillOverrides returns the fields set in the prefill requests of a connector
+// when no overrides are configured. The prefill only needs to produce the KV cache.
+func defaultPrefillOverrides(connector string) map[string]any {
+	switch connector {
+	case ConnectorNIXLV1:
+		return map[string]any{}
+	default:
+		return map[string]any{
+			requestFieldMaxTokens:           1,
+			requestFieldMaxCompletionTokens: 1,
+		}
+	}
+}
+
+// applyPrefillOverrides sets the configured fields, or the defaults of the connector, in a
+// prefill request. Fields overridden with null are removed from the request.
+func (s *Server) applyPrefillOverrides(completionRequest map[string]any, connector string) {
+	overrides := s.prefillOverrides
+	if overrides == nil {
+		overrides = defaultPrefillOverrides(connector)
+	}
+	for field, value := range overrides {
+		if value == nil {
+			delete(completionRequest, field)
+			continue
+		}
+		completionRequest[field] = value
+	}
+}
+
+// stripPrefillFields removes the configured client-only fields from a prefill request, and
+// returns them to be restored in the decode request
+func (s *Server) stripPrefillFields(completionRequest map[string]any) map[string]any {
+	var stripped map[string]any
+	for _, field := range s.config.PrefillStripFields {
+		if value, ok := completionRequest[field]; ok {
+			if stripped == nil {
+				stripped = make(map[string]any)
+			}
+			stripped[field] = value
+			delete(completionRequest, field)
+		}
+	}
+	return stripped
+}
@@ -0,0 +1,92 @@
+/*
+Copyright 2025 The llm-d Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package proxy
+
+import (
+	"net/url"
+
+	. "github.com/onsi/ginkgo/v2" // nolint:revive
+	. "github.com/onsi/gomega"    // nolint:revive
+)
+
+var _ = Describe("Prefill overrides", func() {
+	decodeURL, _ := url.Parse("http://localhost:8001") //nolint:all
+
+	It("should limit the prefill to one token by default", func() {
+		proxy, err := NewProxy("0", decodeURL, Config{Connector: ConnectorNIXLV2})
+		Expect(err).ToNot(HaveOccurred())
+
+		completionRequest := map[string]any{requestFieldMaxTokens: 50, "temperature": 0.7}
+		proxy.applyPrefillOverrides(completionRequest, ConnectorNIXLV2)
+
+		Expect(completionRequest).To(Equal(map[string]any{
+			requestFieldMaxTokens:           1,
+			requestFieldMaxCompletionTokens: 1,
+			"temperature":                   0.7,
+		}))
+	})
+
+	It("should not change the NIXL v1 prefill request by default", func() {
+		proxy, err := NewProxy("0", decodeURL, Config{Connector: ConnectorNIXLV1})
+		Expect(err).ToNot(HaveOccurred())
+
+		completionRequest := map[string]any{requestFieldMaxTokens: 50}
+		proxy.applyPrefillOverrides(completionRequest, ConnectorNIXLV1)
+
+		Expect(completionRequest).To(Equal(map[string]any{requestFieldMaxTokens: 50}))
+	})
+
+	It("should apply the configured overrides and remove null fields", func() {
+		overrides := map[string]any{
+			requestFieldMaxTokens: 1,
+			"temperature":         0,
+			"logprobs":            nil,
+		}
+		proxy, err := NewProxy("0", decodeURL, Config{Connector: ConnectorNIXLV2, PrefillOverrides: overrides})
+		Expect(err).ToNot(HaveOccurred())
+
+		completionRequest := map[string]any{
+			requestFieldMaxTokens: 50,
+			"temperature":         0.7,
+			"logprobs":            5,
+		}
+		proxy.applyPrefillOverrides(completionRequest, ConnectorNIXLV2)
+
+		Expect(completionRequest).To(Equal(map[string]any{
+			requestFieldMaxTokens: 1,
+			"temperature":         0,
+		}))
+	})
+
+	It("should strip the configured fields", func() {
+		proxy, err := NewProxy("0", decodeURL, Config{Connector: ConnectorNIXLV2, PrefillStripFields: DefaultPrefillStripFields})
+		Expect(err).ToNot(HaveOccurred())
+
+		completionRequest := map[string]any{
+			requestFieldMaxTokens: 50,
+			"logit_bias":          map[string]any{"50256": -100},
+			"metadata":            map[string]any{"session": "42"},
+		}
+		stripped := proxy.stripPrefillFields(completionRequest)
+
+		Expect(completionRequest).To(Equal(map[string]any{requestFieldMaxTokens: 50}))
+		Expect(stripped).To(Equal(map[string]any{
+			"logit_bias": map[string]any{"50256": -100},
+			"metadata":   map[string]any{"session": "42"},
+		}))
+	})
+})
@@ -0,0 +1,131 @@
+/*
+Copyright 2025 The llm-d Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package proxy
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/llm-d/llm-d-routing-sidecar/internal/metrics"
+)
+
+// prefillTarget returns the prefill target of a request and whether the deprecated
+// x-prefiller-url header was sent. Several candidate targets may be sent when a prefiller
+// selection strategy is set, which selects one of them.
+func (s *Server) prefillTarget(header http.Header) (target string, deprecated bool, err error) {
+	targets, deprecated, err := prefillTargets(header)
+	if err == nil {
+		err = s.checkPrefillTargets(targets)
+	}
+	if err != nil || len(targets) == 0 {
+		return "", deprecated, err
+	}
+	if s.prefillerSelector == nil {
+		return targets[0], deprecated, nil
+	}
+
+	target = s.prefillerSelector.selectTarget(targets)
+	metrics.RecordPrefillerSelection(s.rank(), s.prefillerSelector.strategy, target)
+	return target, deprecated, nil
+}
+
+// checkPrefillTargets rejects the candidate targets of a request without selection strategy
+func (s *Server) checkPrefillTargets(targets []string) error {
+	if len(targets) > 1 && s.prefillerSelector == nil {
+		return fmt.Errorf("conflicting %s headers: %q and %q", requestHeaderPrefillHostPort, targets[0], targets[1])
+	}
+	return nil
+}
+
+// prefillTargets returns the candidate prefill targets of a request from the
+// x-prefiller-host-port header, or else the target of the deprecated x-prefiller-url header,
+// and whether the latter was sent. Both headers may be sent, e.g. while clients migrate, but
+// must then name the same single target. The targets are host:port, optionally prefixed by
+// http://, returned without the prefix and duplicates.
+func prefillTargets(header http.Header) (targets []string, deprecated bool, err error) {
+	targets, err = prefillHeaderTargets(header, requestHeaderPrefillHostPort)
+	if err != nil {
+		return nil, false, err
+	}
+	legacy, err := prefillHeaderTargets(header, requestHeaderPrefillURL)
+	if err != nil {
+		return nil, true, err
+	}
+
+	switch {
+	case len(legacy) == 0:
+		return targets, false, nil
+	case len(legacy) > 1:
+		return nil, true, fmt.Errorf("conflicting %s headers: %q and %q", requestHeaderPrefillURL, legacy[0], legacy[1])
+	case len(targets) == 0:
+		return legacy, true, nil
+	case len(targets) > 1 || targets[0] != legacy[0]:
+		return nil, true, fmt.Errorf("conflicting %s and %s headers: %q and %q",
+			requestHeaderPrefillHostPort, requestHeaderPrefillURL, strings.Join(targets, ", "), legacy[0])
+	default:
+		return targets, true, nil
+	}
+}
+
+// prefillHeaderTargets returns the distinct targets of a prefiller header
+func prefillHeaderTargets(header http.Header, name string) ([]string, error) {
+	var targets []string
+	for _, values := range header.Values(name) {
+		for _, value := range strings.Split(values, ",") {
+			if value = strings.TrimSpace(value); value == "" {
+				continue
+			}
+			target, err := parsePrefillTarget(value)
+			if err != nil {
+				return nil, fmt.Errorf("invalid %s header %q: %w", name, value, err)
+			}
+			if !slices.Contains(targets, target) {
+				targets = append(targets, target)
+			}
+		}
+	}
+	return targets, nil
+}
+
+// parsePrefillTarget checks a prefill target is host:port, optionally prefixed by http://
+func parsePrefillTarget(value string) (string, error) {
+	if strings.ContainsFunc(value, func(r rune) bool { return r <= ' ' || r == 0x7f }) {
+		return "", fmt.Errorf("must not contain spaces or control characters")
+	}
+	if scheme, hostPort, found := strings.Cut(value, "://"); found {
+		if !strings.EqualFold(scheme, "http") {
+			return "", fmt.Errorf("unsupported scheme %q, expected host:port", scheme)
+		}
+		value = hostPort
+	}
+
+	host, port, err := net.SplitHostPort(value)
+	if err != nil {
+		return "", fmt.Errorf("expected host:port")
+	}
+	if host == "" || strings.ContainsAny(host, "/?#@[]") {
+		return "", fmt.Errorf("invalid host %q", host)
+	}
+	if p, err := strconv.Atoi(port); err != nil || p < 1 || p > 65535 {
+		return "", fmt.Errorf("invalid port %q, expected 1-65535", port)
+	}
+	return value, nil
+}
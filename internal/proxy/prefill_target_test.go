@@ -0,0 +1,76 @@
+/*
+Copyright 2025 The llm-d Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package proxy
+
+import (
+	"net/http"
+
+	. "github.com/onsi/ginkgo/v2" // nolint:revive
+	. "github.com/onsi/gomega"    // nolint:revive
+)
+
+var _ = Describe("Prefill target", func() {
+	header := func(keysAndValues ...string) http.Header {
+		h := http.Header{}
+		for i := 0; i < len(keysAndValues); i += 2 {
+			h.Add(keysAndValues[i], keysAndValues[i+1])
+		}
+		return h
+	}
+
+	DescribeTable("should parse the prefill targets",
+		func(h http.Header, targets []string, deprecated bool) {
+			t, d, err := prefillTargets(h)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(t).To(Equal(targets))
+			Expect(d).To(Equal(deprecated))
+		},
+		Entry("none", header(), nil, false),
+		Entry("blank", header(requestHeaderPrefillHostPort, " "), nil, false),
+		Entry("host port", header(requestHeaderPrefillHostPort, "10.0.0.1:8000"), []string{"10.0.0.1:8000"}, false),
+		Entry("http scheme", header(requestHeaderPrefillHostPort, "http://prefill:8000"), []string{"prefill:8000"}, false),
+		Entry("ipv6", header(requestHeaderPrefillHostPort, "[fd00::1]:8000"), []string{"[fd00::1]:8000"}, false),
+		Entry("deprecated url", header(requestHeaderPrefillURL, "http://prefill:8000"), []string{"prefill:8000"}, true),
+		Entry("same targets", header(requestHeaderPrefillHostPort, "prefill:8000", requestHeaderPrefillURL, "http://prefill:8000"), []string{"prefill:8000"}, true),
+		Entry("repeated header", header(requestHeaderPrefillHostPort, "prefill:8000", requestHeaderPrefillHostPort, "prefill:8000"), []string{"prefill:8000"}, false),
+		Entry("list", header(requestHeaderPrefillHostPort, "prefill:8000, http://prefill:8000"), []string{"prefill:8000"}, false),
+		Entry("candidates", header(requestHeaderPrefillHostPort, "prefill-a:8000, prefill-b:8000", requestHeaderPrefillHostPort, "prefill-c:8000"),
+			[]string{"prefill-a:8000", "prefill-b:8000", "prefill-c:8000"}, false),
+	)
+
+	DescribeTable("should reject the malformed or conflicting headers",
+		func(h http.Header, message string) {
+			_, _, err := (&Server{}).prefillTarget(h)
+			Expect(err).To(MatchError(ContainSubstring(message)))
+		},
+		Entry("space", header(requestHeaderPrefillHostPort, "prefill :8000"), "spaces"),
+		Entry("https scheme", header(requestHeaderPrefillHostPort, "https://prefill:8000"), `unsupported scheme "https"`),
+		Entry("no port", header(requestHeaderPrefillHostPort, "prefill"), "expected host:port"),
+		Entry("no host", header(requestHeaderPrefillHostPort, ":8000"), "invalid host"),
+		Entry("path", header(requestHeaderPrefillURL, "http://prefill:8000/v1"), "invalid port"),
+		Entry("user info", header(requestHeaderPrefillHostPort, "user@prefill:8000"), "invalid host"),
+		Entry("port zero", header(requestHeaderPrefillHostPort, "prefill:0"), "invalid port"),
+		Entry("port too large", header(requestHeaderPrefillHostPort, "prefill:65536"), "invalid port"),
+		Entry("named port", header(requestHeaderPrefillHostPort, "prefill:http"), "invalid port"),
+		Entry("conflicting headers", header(requestHeaderPrefillHostPort, "prefill-a:8000", requestHeaderPrefillURL, "http://prefill-b:8000"),
+			"conflicting x-prefiller-host-port and x-prefiller-url headers"),
+		Entry("conflicting values", header(requestHeaderPrefillHostPort, "prefill-a:8000", requestHeaderPrefillHostPort, "prefill-b:8000"),
+			"conflicting x-prefiller-host-port headers"),
+		Entry("candidates with deprecated url", header(requestHeaderPrefillHostPort, "prefill-a:8000,prefill-b:8000", requestHeaderPrefillURL, "prefill-a:8000"),
+			"conflicting x-prefiller-host-port and x-prefiller-url headers"),
+	)
+})
@@ -0,0 +1,73 @@
+/*
+Copyright 2025 The llm-d Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package proxy
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// maxPrefillerResponseBytes bounds the prefiller responses parsed by the connectors, which
+// only generate a token
+const maxPrefillerResponseBytes = 16 << 20
+
+// prefillerResponseFields are the KV transfer fields of the prefiller responses used by the
+// connectors, with the check of their JSON types. The other fields are not decoded.
+var prefillerResponseFields = map[string]func(value any) bool{
+	requestFieldKVTransferParams: func(value any) bool { _, ok := value.(map[string]any); return ok },
+	requestFieldRemoteBlockIDs:   func(value any) bool { _, ok := value.([]any); return ok },
+	requestFieldRemoteEngineID:   func(value any) bool { _, ok := value.(string); return ok },
+	requestFieldRemoteHost:       func(value any) bool { _, ok := value.(string); return ok },
+	requestFieldRemotePort:       func(value any) bool { _, ok := value.(float64); return ok },
+}
+
+// decodePrefillerResponse parses the KV transfer fields of a prefiller response. Like the
+// request bodies, the responses other than objects, too large or nested too deep are
+// rejected, as are the KV transfer fields of unexpected types. The fields may be null.
+func decodePrefillerResponse(body []byte) (map[string]any, error) {
+	if len(body) > maxPrefillerResponseBytes {
+		return nil, fmt.Errorf("prefiller response larger than %d bytes", maxPrefillerResponseBytes)
+	}
+	if jsonKind(body) != '{' {
+		return nil, errors.New("prefiller response must be a JSON object")
+	}
+	if err := checkJSONDepth(body, maxJSONDepth); err != nil {
+		return nil, err
+	}
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(body, &fields); err != nil {
+		return nil, err
+	}
+
+	response := make(map[string]any, len(prefillerResponseFields))
+	for name, valid := range prefillerResponseFields {
+		raw, ok := fields[name]
+		if !ok {
+			continue
+		}
+		var value any
+		if err := json.Unmarshal(raw, &value); err != nil {
+			return nil, err
+		}
+		if value != nil && !valid(value) {
+			return nil, fmt.Errorf("unexpected type of %q in prefiller response", name)
+		}
+		response[name] = value
+	}
+	return response, nil
+}
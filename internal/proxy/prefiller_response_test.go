@@ -0,0 +1,86 @@
+/*
+Copyright 2025 The llm-d Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package proxy
+
+import (
+	"strings"
+	"testing"
+
+	. "github.com/onsi/ginkgo/v2" // nolint:revive
+	. "github.com/onsi/gomega"    // nolint:revive
+)
+
+var _ = Describe("Prefiller responses", func() {
+	It("should only decode the KV transfer fields", func() {
+		response, err := decodePrefillerResponse([]byte(`{"id": "cmpl-1", "choices": [{"text": ""}],
+			"kv_transfer_params": {"remote_engine_id": "e1", "remote_block_ids": [1, 2]},
+			"remote_block_ids": [1, 2], "remote_engine_id": "e1", "remote_host": "10.0.0.1", "remote_port": 5600}`))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(response).To(HaveLen(5))
+		Expect(response).To(HaveKeyWithValue(requestFieldRemotePort, 5600.0))
+		Expect(response).ToNot(HaveKey("choices"))
+	})
+
+	It("should keep the null fields", func() {
+		response, err := decodePrefillerResponse([]byte(`{"kv_transfer_params": null}`))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(response).To(HaveKeyWithValue(requestFieldKVTransferParams, BeNil()))
+	})
+
+	DescribeTable("should reject the invalid responses",
+		func(body string, message string) {
+			_, err := decodePrefillerResponse([]byte(body))
+			Expect(err).To(MatchError(ContainSubstring(message)))
+		},
+		Entry("when the response is a list", `[]`, "must be a JSON object"),
+		Entry("when the response is nested too deep", `{"choices": `+nestedJSON(maxJSONDepth)+`}`, "nested deeper"),
+		Entry("when the response is too large", `{"text": "`+strings.Repeat("x", maxPrefillerResponseBytes)+`"}`, "larger than"),
+		Entry("when the KV transfer parameters are not an object", `{"kv_transfer_params": [1]}`, `"kv_transfer_params"`),
+		Entry("when the block IDs are not a list", `{"remote_block_ids": "1,2"}`, `"remote_block_ids"`),
+		Entry("when the port is not a number", `{"remote_port": "5600"}`, `"remote_port"`),
+	)
+})
+
+// FuzzDecodePrefillerResponse checks the crafted prefiller responses are rejected without
+// panics, and the decoded fields have the expected types
+func FuzzDecodePrefillerResponse(f *testing.F) {
+	for _, seed := range []string{
+		`{"kv_transfer_params": {"do_remote_prefill": true, "remote_block_ids": [1], "remote_engine_id": "e1"}}`,
+		`{"remote_block_ids": [1, 2], "remote_engine_id": "e1", "remote_host": "h", "remote_port": 1}`,
+		`{"kv_transfer_params": null, "remote_port": "1"}`,
+		`{"choices": ` + nestedJSON(maxJSONDepth+1) + `}`,
+		`"kv_transfer_params"`,
+	} {
+		f.Add([]byte(seed))
+	}
+
+	f.Fuzz(func(t *testing.T, body []byte) {
+		response, err := decodePrefillerResponse(body)
+		if err != nil {
+			return
+		}
+		for name, value := range response {
+			valid, ok := prefillerResponseFields[name]
+			if !ok {
+				t.Fatalf("unexpected field %q decoded from %q", name, body)
+			}
+			if value != nil && !valid(value) {
+				t.Fatalf("unexpected type of %q decoded from %q", name, body)
+			}
+		}
+	})
+}
@@ -0,0 +1,163 @@
+/*
+Copyright 2025 The llm-d Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package proxy
+
+import (
+	"math"
+	"math/rand/v2"
+	"slices"
+	"time"
+)
+
+const (
+	// prefillerLatencySamples is the number of last prefills of a prefiller in its p95 latency
+	prefillerLatencySamples = 100
+
+	// prefillerScoreWeight is the weight of the last prefill in the moving averages of a prefiller
+	prefillerScoreWeight = 0.2
+
+	// prefillerSlowFactor is how much slower than the fastest candidate a prefiller is avoided
+	prefillerSlowFactor = 4
+
+	// prefillerMaxErrorRate is the error rate from which a prefiller is avoided
+	prefillerMaxErrorRate = 0.5
+
+	// prefillerProbeRatio is the ratio of the selections ignoring the avoided prefillers, so
+	// their scores recover once they are fast and healthy again
+	prefillerProbeRatio = 0.05
+)
+
+// PrefillerScores are the scores of the prefillers selected by a proxy, to audit the selections
+type PrefillerScores struct {
+	DataParallelRank int              `json:"dataParallelRank"`
+	Pool             string           `json:"pool,omitempty"`
+	Strategy         string           `json:"strategy"`
+	Prefillers       []PrefillerScore `json:"prefillers"`
+}
+
+// PrefillerScore is the recent latency and error rate of a prefiller
+type PrefillerScore struct {
+	Target string `json:"target"`
+	// LatencySeconds is the moving average of the prefill latency, the failures counting as slow
+	LatencySeconds float64 `json:"latencySeconds"`
+	// P95Seconds is the 95th percentile of the latency of the last prefills
+	P95Seconds float64 `json:"p95Seconds"`
+	// ErrorRate is the moving average of the failed prefills
+	ErrorRate float64 `json:"errorRate"`
+	Samples   int     `json:"samples"`
+	// Avoided reports whether the prefiller is avoided by the selections among all the prefillers
+	Avoided      bool      `json:"avoided"`
+	LastSelected time.Time `json:"lastSelected,omitzero"`
+}
+
+// PrefillerScores returns the scores of the prefillers selected among candidates
+func (s *Server) PrefillerScores() PrefillerScores {
+	scores := PrefillerScores{
+		DataParallelRank: s.config.DataParallelRank,
+		Pool:             s.config.Pool,
+		Strategy:         s.config.PrefillerSelectionStrategy,
+		Prefillers:       []PrefillerScore{},
+	}
+	if s.prefillerSelector != nil {
+		scores.Prefillers = s.prefillerSelector.scores()
+	}
+	return scores
+}
+
+// scores returns the scores of the prefillers tracked, by target
+func (p *prefillerSelector) scores() []PrefillerScore {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	targets := p.usages.Keys()
+	slices.Sort(targets)
+	fastest := p.fastest(targets)
+	scores := make([]PrefillerScore, 0, len(targets))
+	for _, target := range targets {
+		usage, _ := p.usages.Peek(target)
+		scores = append(scores, PrefillerScore{
+			Target:         target,
+			LatencySeconds: usage.latency.Seconds(),
+			P95Seconds:     usage.p95().Seconds(),
+			ErrorRate:      usage.errorRate,
+			Samples:        usage.samples,
+			Avoided:        usage.avoided(fastest),
+			LastSelected:   usage.selected,
+		})
+	}
+	return scores
+}
+
+// preferred returns the candidates which are not much slower than the fastest one nor failing,
+// or all of them when every candidate is avoided or the avoided candidates are probed. The
+// lock must be held.
+func (p *prefillerSelector) preferred(candidates []string) []string {
+	if len(candidates) == 1 || rand.Float64() < prefillerProbeRatio {
+		return candidates
+	}
+
+	fastest := p.fastest(candidates)
+	preferred := make([]string, 0, len(candidates))
+	for _, candidate := range candidates {
+		if !p.usage(candidate).avoided(fastest) {
+			preferred = append(preferred, candidate)
+		}
+	}
+	if len(preferred) == 0 {
+		return candidates
+	}
+	return preferred
+}
+
+// fastest returns the lowest latency of the prefillers measured. The lock must be held.
+func (p *prefillerSelector) fastest(targets []string) time.Duration {
+	fastest := time.Duration(math.MaxInt64)
+	for _, target := range targets {
+		if usage, ok := p.usages.Peek(target); ok && usage.samples > 0 {
+			fastest = min(fastest, usage.latency)
+		}
+	}
+	return fastest
+}
+
+// observe adds a prefill to the moving averages and the last latencies
+func (u *prefillerUsage) observe(latency time.Duration, failure float64) {
+	u.recent[u.samples%len(u.recent)] = latency
+	u.samples++
+	if u.samples == 1 {
+		u.latency, u.errorRate = latency, failure
+		return
+	}
+	u.latency += time.Duration(prefillerScoreWeight * float64(latency-u.latency))
+	u.errorRate += prefillerScoreWeight * (failure - u.errorRate)
+}
+
+// avoided reports whether the prefiller is failing or much slower than the fastest prefiller
+func (u *prefillerUsage) avoided(fastest time.Duration) bool {
+	return u.samples > 0 && (u.errorRate >= prefillerMaxErrorRate || u.latency > prefillerSlowFactor*fastest)
+}
+
+// p95 returns the 95th percentile of the last latencies, zero until measured
+func (u *prefillerUsage) p95() time.Duration {
+	n := min(u.samples, len(u.recent))
+	if n == 0 {
+		return 0
+	}
+	recent := slices.Clone(u.recent[:n])
+	slices.Sort(recent)
+	return recent[int(math.Ceil(0.95*float64(n)))-1]
+}
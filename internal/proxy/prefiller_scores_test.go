@@ -0,0 +1,117 @@
+/*
+Copyright 2025 The llm-d Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package proxy
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo/v2" // nolint:revive
+	. "github.com/onsi/gomega"    // nolint:revive
+)
+
+var _ = Describe("Prefiller scores", func() {
+	candidates := []string{"prefill-a:8000", "prefill-b:8000", "prefill-c:8000"}
+
+	var p *prefillerSelector
+	BeforeEach(func() {
+		var err error
+		p, err = newPrefillerSelector(PrefillerSelectionRandom)
+		Expect(err).ToNot(HaveOccurred())
+	})
+
+	count := func(n int) map[string]int {
+		counts := map[string]int{}
+		for range n {
+			counts[p.selectTarget(candidates)]++
+		}
+		return counts
+	}
+
+	It("should avoid the slow prefillers but probe them", func() {
+		p.observe("prefill-a:8000", 100*time.Millisecond, false)
+		p.observe("prefill-b:8000", 200*time.Millisecond, false)
+		p.observe("prefill-c:8000", time.Second, false)
+
+		counts := count(3000)
+		Expect(counts["prefill-c:8000"]).To(BeNumerically("~", 3000*prefillerProbeRatio/3, 30))
+		Expect(counts["prefill-a:8000"]).To(BeNumerically("~", counts["prefill-b:8000"], 250))
+
+		// the scores recover with the fast prefills
+		for range 20 {
+			p.observe("prefill-c:8000", 100*time.Millisecond, false)
+		}
+		Expect(count(3000)["prefill-c:8000"]).To(BeNumerically("~", 1000, 200))
+	})
+
+	It("should avoid the failing prefillers", func() {
+		p.observe("prefill-a:8000", time.Second, false)
+		p.observe("prefill-b:8000", time.Second, false)
+		p.observe("prefill-c:8000", time.Second, false)
+		for range 5 {
+			p.observe("prefill-c:8000", time.Second, true)
+		}
+		Expect(p.usage("prefill-c:8000").errorRate).To(BeNumerically(">", prefillerMaxErrorRate))
+		Expect(count(3000)["prefill-c:8000"]).To(BeNumerically("<", 3000*prefillerProbeRatio))
+	})
+
+	It("should select among all the candidates when every candidate is avoided", func() {
+		for _, candidate := range candidates {
+			p.observe(candidate, time.Second, true)
+		}
+		Expect(count(300)).To(HaveLen(3))
+	})
+
+	It("should keep the candidates not measured yet", func() {
+		p.observe("prefill-a:8000", time.Second, true)
+		p.observe("prefill-b:8000", time.Second, false)
+		Expect(count(300)).To(HaveKey("prefill-c:8000"))
+	})
+
+	It("should compute the p95 latency of the last prefills", func() {
+		usage := &prefillerUsage{}
+		Expect(usage.p95()).To(BeZero())
+		for i := range 200 {
+			usage.observe(time.Duration(i)*time.Millisecond, 0)
+		}
+		// the last 100 prefills, from 100ms to 199ms
+		Expect(usage.p95()).To(Equal(194 * time.Millisecond))
+		Expect(usage.samples).To(Equal(200))
+	})
+
+	It("should return the scores by target", func() {
+		p.observe("prefill-b:8000", time.Second, false)
+		p.observe("prefill-a:8000", 100*time.Millisecond, false)
+		p.observe("prefill-a:8000", 200*time.Millisecond, true)
+
+		s := &Server{config: Config{PrefillerSelectionStrategy: PrefillerSelectionRandom}, prefillerSelector: p}
+		scores := s.PrefillerScores()
+		Expect(scores.Strategy).To(Equal(PrefillerSelectionRandom))
+		Expect(scores.Prefillers).To(HaveLen(2))
+		Expect(scores.Prefillers[0]).To(And(
+			HaveField("Target", "prefill-a:8000"),
+			HaveField("Samples", 2),
+			HaveField("ErrorRate", BeNumerically("~", prefillerScoreWeight, 1e-9)),
+			HaveField("P95Seconds", prefillerFailureLatency.Seconds()),
+			HaveField("Avoided", false),
+		))
+		Expect(scores.Prefillers[1]).To(And(HaveField("Target", "prefill-b:8000"), HaveField("Avoided", false)))
+	})
+
+	It("should return no scores without selection", func() {
+		Expect((&Server{}).PrefillerScores().Prefillers).To(BeEmpty())
+	})
+})
@@ -0,0 +1,152 @@
+/*
+Copyright 2025 The llm-d Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package proxy
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"sync"
+	"time"
+
+	lru "github.com/hashicorp/golang-lru/v2/simplelru"
+)
+
+const (
+	// PrefillerSelectionRandom selects a candidate prefiller uniformly at random
+	PrefillerSelectionRandom = "random"
+
+	// PrefillerSelectionRoundRobin rotates the requests among the candidate prefillers
+	PrefillerSelectionRoundRobin = "round-robin"
+
+	// PrefillerSelectionLeastRecentlyUsed selects the candidate prefiller selected the longest ago
+	PrefillerSelectionLeastRecentlyUsed = "least-recently-used"
+
+	// PrefillerSelectionPowerOfTwo draws two candidate prefillers at random and selects the one
+	// with the lower recent prefill latency
+	PrefillerSelectionPowerOfTwo = "power-of-two"
+
+	// maxTrackedPrefillers bounds the prefillers whose selections and latencies are remembered
+	maxTrackedPrefillers = 1024
+
+	// prefillerFailureLatency is the latency recorded for the failed prefills, so the failing
+	// prefillers are avoided instead of looking fast
+	prefillerFailureLatency = 10 * time.Second
+)
+
+// PrefillerSelectionStrategies are the strategies selecting a prefiller among the candidates
+var PrefillerSelectionStrategies = []string{
+	PrefillerSelectionRandom,
+	PrefillerSelectionRoundRobin,
+	PrefillerSelectionLeastRecentlyUsed,
+	PrefillerSelectionPowerOfTwo,
+}
+
+// prefillerSelector selects the prefiller of the requests naming several candidates
+type prefillerSelector struct {
+	strategy string
+
+	mu     sync.Mutex
+	next   uint64                            // the next round-robin turn
+	usages *lru.LRU[string, *prefillerUsage] // the recent usage of the prefillers
+}
+
+// prefillerUsage is the recent usage of a prefiller
+type prefillerUsage struct {
+	selected  time.Time                              // when the prefiller was last selected
+	latency   time.Duration                          // moving average of the prefill latency, zero until measured
+	errorRate float64                                // moving average of the failed prefills
+	recent    [prefillerLatencySamples]time.Duration // the latencies of the last prefills
+	samples   int                                    // the prefills measured
+}
+
+// newPrefillerSelector returns the selector of a strategy, nil when the strategy is empty
+func newPrefillerSelector(strategy string) (*prefillerSelector, error) {
+	switch strategy {
+	case "":
+		return nil, nil
+	case PrefillerSelectionRandom, PrefillerSelectionRoundRobin, PrefillerSelectionLeastRecentlyUsed, PrefillerSelectionPowerOfTwo:
+	default:
+		return nil, fmt.Errorf("unknown prefiller selection strategy %q, expected one of %q", strategy, PrefillerSelectionStrategies)
+	}
+
+	usages, err := lru.NewLRU[string, *prefillerUsage](maxTrackedPrefillers, nil)
+	if err != nil {
+		return nil, err
+	}
+	return &prefillerSelector{strategy: strategy, usages: usages}, nil
+}
+
+// selectTarget returns the prefill target selected among the candidates
+func (p *prefillerSelector) selectTarget(candidates []string) string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	candidates = p.preferred(candidates)
+	target := candidates[0]
+	switch {
+	case len(candidates) == 1:
+	case p.strategy == PrefillerSelectionRandom:
+		target = candidates[rand.IntN(len(candidates))]
+	case p.strategy == PrefillerSelectionRoundRobin:
+		target = candidates[p.next%uint64(len(candidates))]
+		p.next++
+	case p.strategy == PrefillerSelectionLeastRecentlyUsed:
+		// the prefillers never selected come first, in the order of the candidates
+		selected := p.usage(target).selected
+		for _, candidate := range candidates[1:] {
+			if usage := p.usage(candidate); usage.selected.Before(selected) {
+				target, selected = candidate, usage.selected
+			}
+		}
+	case p.strategy == PrefillerSelectionPowerOfTwo:
+		i := rand.IntN(len(candidates))
+		j := rand.IntN(len(candidates) - 1)
+		if j >= i {
+			j++
+		}
+		// the prefillers not measured yet look fastest, so they get measured
+		target = candidates[i]
+		if p.usage(candidates[j]).latency < p.usage(target).latency {
+			target = candidates[j]
+		}
+	}
+	p.usage(target).selected = time.Now()
+	return target
+}
+
+// observe records the latency of a prefill sent to a prefiller, the failures counting as slow
+func (p *prefillerSelector) observe(target string, latency time.Duration, failed bool) {
+	failure := 0.0
+	if failed {
+		latency = max(latency, prefillerFailureLatency)
+		failure = 1
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.usage(target).observe(latency, failure)
+}
+
+// usage returns the usage of a prefiller, tracking it if needed. The lock must be held.
+func (p *prefillerSelector) usage(target string) *prefillerUsage {
+	usage, ok := p.usages.Get(target)
+	if !ok {
+		usage = &prefillerUsage{}
+		p.usages.Add(target, usage)
+	}
+	return usage
+}
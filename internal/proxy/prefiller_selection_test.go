@@ -0,0 +1,132 @@
+/*
+Copyright 2025 The llm-d Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package proxy
+
+import (
+	"net/http"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2" // nolint:revive
+	. "github.com/onsi/gomega"    // nolint:revive
+
+	"github.com/llm-d/llm-d-routing-sidecar/internal/metrics"
+)
+
+var _ = Describe("Prefiller selection", func() {
+	candidates := []string{"prefill-a:8000", "prefill-b:8000", "prefill-c:8000"}
+
+	newSelector := func(strategy string) *prefillerSelector {
+		p, err := newPrefillerSelector(strategy)
+		Expect(err).ToNot(HaveOccurred())
+		return p
+	}
+
+	count := func(p *prefillerSelector, candidates []string, n int) map[string]int {
+		counts := map[string]int{}
+		for range n {
+			counts[p.selectTarget(candidates)]++
+		}
+		return counts
+	}
+
+	It("should be disabled without strategy", func() {
+		Expect(newSelector("")).To(BeNil())
+	})
+
+	It("should reject the unknown strategies", func() {
+		_, err := newPrefillerSelector("fastest")
+		Expect(err).To(MatchError(ContainSubstring(`unknown prefiller selection strategy "fastest"`)))
+	})
+
+	It("should select the candidates uniformly at random", func() {
+		counts := count(newSelector(PrefillerSelectionRandom), candidates, 3000)
+		Expect(counts).To(HaveLen(3))
+		for _, n := range counts {
+			Expect(n).To(BeNumerically("~", 1000, 200))
+		}
+	})
+
+	It("should rotate among the candidates", func() {
+		p := newSelector(PrefillerSelectionRoundRobin)
+		var selected []string
+		for range 4 {
+			selected = append(selected, p.selectTarget(candidates))
+		}
+		Expect(selected).To(Equal([]string{"prefill-a:8000", "prefill-b:8000", "prefill-c:8000", "prefill-a:8000"}))
+	})
+
+	It("should select the least recently used candidate", func() {
+		p := newSelector(PrefillerSelectionLeastRecentlyUsed)
+		Expect(p.selectTarget(candidates[1:2])).To(Equal("prefill-b:8000"))
+
+		// the candidates never selected come first
+		Expect(p.selectTarget(candidates)).To(Equal("prefill-a:8000"))
+		Expect(p.selectTarget(candidates)).To(Equal("prefill-c:8000"))
+		Expect(p.selectTarget(candidates)).To(Equal("prefill-b:8000"))
+		Expect(p.selectTarget(candidates)).To(Equal("prefill-a:8000"))
+	})
+
+	It("should select the candidate with the lower recent latency of two", func() {
+		p := newSelector(PrefillerSelectionPowerOfTwo)
+		p.observe("prefill-a:8000", 100*time.Millisecond, false)
+		p.observe("prefill-b:8000", time.Second, false)
+		Expect(count(p, candidates[:2], 100)).To(Equal(map[string]int{"prefill-a:8000": 100}))
+
+		// the recent latencies prevail
+		for range 20 {
+			p.observe("prefill-a:8000", 2*time.Second, false)
+		}
+		Expect(count(p, candidates[:2], 100)).To(Equal(map[string]int{"prefill-b:8000": 100}))
+
+		// the failed prefills count as slow
+		p.observe("prefill-b:8000", time.Millisecond, true)
+		Expect(p.usage("prefill-b:8000").latency).To(BeNumerically(">", 2*time.Second))
+
+		// the candidates not measured yet are tried
+		Expect(count(p, candidates, 300)).To(HaveKey("prefill-c:8000"))
+	})
+
+	It("should record the selections by strategy and prefiller", func() {
+		s := &Server{config: Config{DataParallelRank: 52}, prefillerSelector: newSelector(PrefillerSelectionRoundRobin)}
+		header := http.Header{}
+		header.Set(requestHeaderPrefillHostPort, "prefill-a:8000, prefill-b:8000")
+		for range 3 {
+			_, _, err := s.prefillTarget(header)
+			Expect(err).ToNot(HaveOccurred())
+		}
+
+		counts := map[string]float64{}
+		families, err := metrics.Registry.Gather()
+		Expect(err).ToNot(HaveOccurred())
+		for _, family := range families {
+			if family.GetName() != "llm_d_routing_sidecar_prefiller_selections_total" {
+				continue
+			}
+			for _, metric := range family.Metric {
+				labels := map[string]string{}
+				for _, label := range metric.Label {
+					labels[label.GetName()] = label.GetValue()
+				}
+				if labels[metrics.RankLabel] == "52" {
+					Expect(labels["strategy"]).To(Equal(PrefillerSelectionRoundRobin))
+					counts[labels["prefiller"]] = metric.GetCounter().GetValue()
+				}
+			}
+		}
+		Expect(counts).To(Equal(map[string]float64{"prefill-a:8000": 2, "prefill-b:8000": 1}))
+	})
+})
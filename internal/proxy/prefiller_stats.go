@@ -0,0 +1,140 @@
+/*
+Copyright 2025 The llm-d Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package proxy
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"slices"
+	"time"
+)
+
+const (
+	// prefillerStatsSaveInterval is how often the prefiller statistics are persisted
+	prefillerStatsSaveInterval = 30 * time.Second
+
+	// prefillerStatsMaxAge is the age of the persisted prefiller statistics beyond which they are
+	// not loaded, the prefill fleet having likely changed since
+	prefillerStatsMaxAge = time.Hour
+)
+
+// prefillerStatsSnapshot is the file persisting the statistics of the prefillers
+type prefillerStatsSnapshot struct {
+	Saved      time.Time        `json:"saved"`
+	Prefillers []prefillerStats `json:"prefillers"`
+}
+
+// prefillerStats is the persisted usage of a prefiller
+type prefillerStats struct {
+	Target    string          `json:"target"`
+	Selected  time.Time       `json:"selected,omitzero"`
+	Latency   time.Duration   `json:"latency"`
+	ErrorRate float64         `json:"errorRate"`
+	Recent    []time.Duration `json:"recent"`
+	Samples   int             `json:"samples"`
+}
+
+// snapshot returns the statistics of the prefillers tracked
+func (p *prefillerSelector) snapshot() prefillerStatsSnapshot {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	snapshot := prefillerStatsSnapshot{Saved: time.Now(), Prefillers: make([]prefillerStats, 0, p.usages.Len())}
+	for _, target := range p.usages.Keys() {
+		usage, _ := p.usages.Peek(target)
+		snapshot.Prefillers = append(snapshot.Prefillers, prefillerStats{
+			Target:    target,
+			Selected:  usage.selected,
+			Latency:   usage.latency,
+			ErrorRate: usage.errorRate,
+			Recent:    slices.Clone(usage.recent[:min(usage.samples, len(usage.recent))]),
+			Samples:   usage.samples,
+		})
+	}
+	return snapshot
+}
+
+// restore tracks the persisted statistics of the prefillers, in the order they were tracked
+func (p *prefillerSelector) restore(snapshot prefillerStatsSnapshot) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for _, stats := range snapshot.Prefillers {
+		usage := &prefillerUsage{
+			selected:  stats.Selected,
+			latency:   stats.Latency,
+			errorRate: stats.ErrorRate,
+		}
+		n := copy(usage.recent[:], stats.Recent)
+		usage.samples = max(stats.Samples, n)
+		p.usages.Add(stats.Target, usage)
+	}
+}
+
+// loadPrefillerStats loads the persisted statistics of the prefillers, so they are not learnt again
+func (s *Server) loadPrefillerStats() {
+	path := s.config.PrefillerStatsFile
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		s.logger.Info("no prefiller statistics to warm start from", "path", path)
+		return
+	}
+	var snapshot prefillerStatsSnapshot
+	if err == nil {
+		err = json.Unmarshal(data, &snapshot)
+	}
+	if err != nil {
+		s.logger.Error(err, "failed to load the prefiller statistics", "path", path)
+		return
+	}
+	if age := time.Since(snapshot.Saved); age > prefillerStatsMaxAge {
+		s.logger.Info("Warning: ignoring stale prefiller statistics", "path", path, "age", age.Round(time.Second).String())
+		return
+	}
+
+	s.prefillerSelector.restore(snapshot)
+	s.logger.Info("loaded the prefiller statistics", "path", path, "prefillerCount", len(snapshot.Prefillers))
+}
+
+// savePrefillerStats persists the statistics of the prefillers, replacing the file atomically
+func (s *Server) savePrefillerStats() {
+	data, err := json.Marshal(s.prefillerSelector.snapshot())
+	if err == nil {
+		err = writeFileAtomic(s.config.PrefillerStatsFile, data)
+	}
+	if err != nil {
+		s.logger.Error(err, "failed to save the prefiller statistics", "path", s.config.PrefillerStatsFile)
+	}
+}
+
+// persistPrefillerStats saves the statistics of the prefillers periodically, and once stopping
+func (s *Server) persistPrefillerStats(ctx context.Context) {
+	ticker := time.NewTicker(prefillerStatsSaveInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			s.savePrefillerStats()
+			return
+		case <-ticker.C:
+			s.savePrefillerStats()
+		}
+	}
+}
@@ -0,0 +1,114 @@
+/*
+Copyright 2025 The llm-d Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package proxy
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/go-logr/logr"
+	. "github.com/onsi/ginkgo/v2" // nolint:revive
+	. "github.com/onsi/gomega"    // nolint:revive
+)
+
+var _ = Describe("Prefiller statistics", func() {
+	var path string
+
+	newServer := func() *Server {
+		selector, err := newPrefillerSelector(PrefillerSelectionPowerOfTwo)
+		Expect(err).ToNot(HaveOccurred())
+		return &Server{
+			logger:            logr.Discard(),
+			prefillerSelector: selector,
+			config:            Config{PrefillerSelectionStrategy: PrefillerSelectionPowerOfTwo, PrefillerStatsFile: path},
+		}
+	}
+
+	BeforeEach(func() {
+		path = filepath.Join(GinkgoT().TempDir(), "prefillers.json")
+	})
+
+	It("should warm start from the persisted statistics", func() {
+		s := newServer()
+		s.prefillerSelector.selectTarget([]string{"prefill-a:8000"})
+		for i := range 150 {
+			s.prefillerSelector.observe("prefill-a:8000", time.Duration(i)*time.Millisecond, false)
+		}
+		s.prefillerSelector.observe("prefill-b:8000", time.Second, true)
+		s.savePrefillerStats()
+
+		restarted := newServer()
+		restarted.loadPrefillerStats()
+		scores, restored := s.PrefillerScores().Prefillers, restarted.PrefillerScores().Prefillers
+		Expect(restored).To(HaveLen(2))
+		for i := range restored {
+			// the monotonic clock readings are not persisted
+			Expect(restored[i].LastSelected).To(BeTemporally("==", scores[i].LastSelected))
+			restored[i].LastSelected, scores[i].LastSelected = time.Time{}, time.Time{}
+		}
+		Expect(restored).To(Equal(scores))
+		Expect(restarted.prefillerSelector.usage("prefill-a:8000").p95()).To(Equal(144 * time.Millisecond))
+
+		// the last latencies keep rolling from where they were
+		restarted.prefillerSelector.observe("prefill-a:8000", 10*time.Second, false)
+		Expect(restarted.prefillerSelector.usage("prefill-a:8000").recent[50]).To(Equal(10 * time.Second))
+	})
+
+	It("should ignore the stale statistics", func() {
+		data, err := json.Marshal(prefillerStatsSnapshot{
+			Saved:      time.Now().Add(-2 * prefillerStatsMaxAge),
+			Prefillers: []prefillerStats{{Target: "prefill-a:8000", Latency: time.Second, Samples: 1}},
+		})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(os.WriteFile(path, data, 0o600)).To(Succeed())
+
+		s := newServer()
+		s.loadPrefillerStats()
+		Expect(s.PrefillerScores().Prefillers).To(BeEmpty())
+	})
+
+	It("should start cold without statistics", func() {
+		s := newServer()
+		s.loadPrefillerStats()
+		Expect(s.PrefillerScores().Prefillers).To(BeEmpty())
+
+		Expect(os.WriteFile(path, []byte("{"), 0o600)).To(Succeed())
+		s.loadPrefillerStats()
+		Expect(s.PrefillerScores().Prefillers).To(BeEmpty())
+	})
+
+	It("should save the statistics when stopping", func() {
+		s := newServer()
+		s.prefillerSelector.observe("prefill-a:8000", time.Second, false)
+
+		ctx, cancelFn := context.WithCancel(context.Background())
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			s.persistPrefillerStats(ctx)
+		}()
+		cancelFn()
+		Eventually(done).Should(BeClosed())
+
+		restarted := newServer()
+		restarted.loadPrefillerStats()
+		Expect(restarted.PrefillerScores().Prefillers).To(ConsistOf(HaveField("Target", "prefill-a:8000")))
+	})
+})
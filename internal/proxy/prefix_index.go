@@ -0,0 +1,206 @@
+/*
+Copyright 2025 The llm-d Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package proxy
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"hash/maphash"
+	"strconv"
+	"time"
+
+	lru "github.com/hashicorp/golang-lru/v2"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
+)
+
+// prefixChunkChars is the number of prompt characters per indexed chunk, about 4 KV blocks
+// of 16 tokens
+const prefixChunkChars = 256
+
+// decoderPrefixCacheQueries are the names of the vLLM counter of prefix cache lookups, with
+// and without the suffix depending on the exposition
+var decoderPrefixCacheQueries = []string{"vllm:prefix_cache_queries_total", "vllm:prefix_cache_queries"}
+
+// prefixIndex approximates the prefix cache of the decoder, which vLLM does not expose per
+// prompt. It holds the chained hashes of the prompt chunks recently sent to the decoder,
+// whether prefilled locally or pulled from a prefiller.
+type prefixIndex struct {
+	seed   maphash.Seed
+	chunks *lru.Cache[uint64, struct{}]
+}
+
+func newPrefixIndex(size int) (*prefixIndex, error) {
+	chunks, err := lru.New[uint64, struct{}](size)
+	if err != nil {
+		return nil, err
+	}
+	return &prefixIndex{seed: maphash.MakeSeed(), chunks: chunks}, nil
+}
+
+// hashes returns the chained hashes of the full chunks of a prompt: like vLLM block hashes,
+// each hash covers the whole prefix up to its chunk
+func (x *prefixIndex) hashes(text []byte) []uint64 {
+	hashes := make([]uint64, 0, len(text)/prefixChunkChars)
+	var h maphash.Hash
+	h.SetSeed(x.seed)
+	var previous [8]byte
+	for i := 0; i+prefixChunkChars <= len(text); i += prefixChunkChars {
+		h.Reset()
+		h.Write(previous[:])                  //nolint:all
+		h.Write(text[i : i+prefixChunkChars]) //nolint:all
+		sum := h.Sum64()
+		binary.LittleEndian.PutUint64(previous[:], sum)
+		hashes = append(hashes, sum)
+	}
+	return hashes
+}
+
+// hitRatio returns the fraction of the prompt chunks whose prefix is in the index.
+// Prompts shorter than a chunk have no hit.
+func (x *prefixIndex) hitRatio(text []byte) float64 {
+	hashes := x.hashes(text)
+	if len(hashes) == 0 {
+		return 0
+	}
+
+	hits := 0
+	for _, hash := range hashes {
+		if !x.chunks.Contains(hash) {
+			break
+		}
+		hits++
+	}
+	return float64(hits) / float64(len(hashes))
+}
+
+// add indexes the chunks of a prompt sent to the decoder
+func (x *prefixIndex) add(text []byte) {
+	for _, hash := range x.hashes(text) {
+		x.chunks.Add(hash, struct{}{})
+	}
+}
+
+// purge empties the index, e.g. when the decoder restarted
+func (x *prefixIndex) purge() {
+	x.chunks.Purge()
+}
+
+// promptText returns the text of the prompt of a completion or chat completion request, in
+// order, with the message roles since they are part of the chat template
+func promptText(p *parsedRequest) []byte {
+	text := appendPromptText(nil, p.prompt)
+	for _, message := range p.chat {
+		text = append(text, message.role...)
+		text = append(text, '\n')
+		text = appendPromptText(text, message.content)
+		text = append(text, '\n')
+	}
+	return text
+}
+
+// appendPromptText appends the text of a prompt, token IDs and content parts included
+func appendPromptText(text []byte, prompt any) []byte {
+	switch p := prompt.(type) {
+	case string:
+		text = append(text, p...)
+	case float64:
+		text = strconv.AppendFloat(text, p, 'f', -1, 64)
+		text = append(text, ' ')
+	case []any:
+		for _, item := range p {
+			text = appendPromptText(text, item)
+		}
+	case map[string]any:
+		for _, field := range []string{"text", "image_url", "input_audio", "video_url"} {
+			if value, ok := p[field]; ok {
+				data, _ := json.Marshal(value) //nolint:all
+				text = append(text, data...)
+			}
+		}
+	}
+	return text
+}
+
+// indexPrompt indexes the prompt of a request sent to the decoder
+func (s *Server) indexPrompt(p *parsedRequest) {
+	if s.prefixIndex != nil {
+		s.prefixIndex.add(promptText(p))
+	}
+}
+
+// watchDecoderPrefixCache probes the prefix cache counters of the decoder, purging the index
+// when they go backwards: the decoder restarted with an empty cache
+func (s *Server) watchDecoderPrefixCache(ctx context.Context) {
+	ticker := time.NewTicker(s.config.PrefixCacheProbeInterval)
+	defer ticker.Stop()
+
+	last := -1.0
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		queries, err := s.decoderPrefixCacheQueries()
+		if err != nil {
+			s.logger.V(4).Info("failed to probe the decoder prefix cache", "error", err.Error())
+			continue
+		}
+		if queries < last {
+			s.logger.V(4).Info("decoder prefix cache reset, purging the prefix index")
+			s.prefixIndex.purge()
+		}
+		last = queries
+	}
+}
+
+// decoderPrefixCacheQueries returns the number of prefix cache lookups of the decoder
+func (s *Server) decoderPrefixCacheQueries() (float64, error) {
+	r, err := s.scrapeDecoderMetrics()
+	if err != nil {
+		return 0, err
+	}
+
+	var parser expfmt.TextParser
+	families, err := parser.TextToMetricFamilies(r)
+	if err != nil {
+		return 0, err
+	}
+
+	total := 0.0
+	for _, name := range decoderPrefixCacheQueries {
+		family, ok := families[name]
+		if !ok {
+			continue
+		}
+		for _, metric := range family.Metric {
+			total += counterValue(metric)
+		}
+	}
+	return total, nil
+}
+
+// counterValue returns the value of a counter, exposed as such or untyped
+func counterValue(metric *dto.Metric) float64 {
+	if metric.Counter != nil {
+		return metric.Counter.GetValue()
+	}
+	return metric.Untyped.GetValue()
+}
@@ -0,0 +1,153 @@
+/*
+Copyright 2025 The llm-d Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package proxy
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/llm-d/llm-d-routing-sidecar/test/mock"
+	. "github.com/onsi/ginkgo/v2" // nolint:revive
+	. "github.com/onsi/gomega"    // nolint:revive
+	"k8s.io/klog/v2/ktesting"
+)
+
+var _ = Describe("Prefix index", func() {
+	conversation := strings.Repeat("The quick brown fox jumps over the lazy dog. ", 40)
+
+	It("should estimate the cached fraction of the prompt prefix", func() {
+		index, err := newPrefixIndex(1024)
+		Expect(err).ToNot(HaveOccurred())
+
+		prompt := []byte(conversation)
+		Expect(index.hitRatio(prompt)).To(BeZero())
+		index.add(prompt)
+		Expect(index.hitRatio(prompt)).To(Equal(1.0))
+
+		// the next turn of the conversation
+		Expect(index.hitRatio([]byte(conversation + conversation))).To(BeNumerically("~", 0.5, 0.1))
+
+		// same suffix, different prefix
+		Expect(index.hitRatio([]byte("Hi! " + conversation))).To(BeZero())
+
+		// shorter than a chunk
+		index.add([]byte("Hello"))
+		Expect(index.hitRatio([]byte("Hello"))).To(BeZero())
+
+		index.purge()
+		Expect(index.hitRatio(prompt)).To(BeZero())
+	})
+
+	It("should extract the prompt text with the message roles", func() {
+		Expect(string(promptText(mustParse(`{"prompt": "Hello"}`)))).To(Equal("Hello"))
+		Expect(string(promptText(mustParse(`{"prompt": [1, 2]}`)))).To(Equal("1 2 "))
+		Expect(string(promptText(mustParse(`{"messages": [{"role": "system", "content": "Be brief"}, {"role": "user", "content": [{"type": "text", "text": "Hi"}]}]}`)))).
+			To(Equal("system\nBe brief\nuser\n\"Hi\"\n"))
+	})
+
+	Describe("with the nixlv2 connector", func() {
+		var (
+			prefillHandler *mock.ChatCompletionHandler
+			decodeHandler  *mock.ChatCompletionHandler
+			decoderQueries atomic.Int64
+			proxy          *Server
+			prefiller      string
+		)
+
+		sendRequest := func(prompt string) {
+			body := `{"model": "m", "prompt": "` + prompt + `"}`
+			req, err := http.NewRequest(http.MethodPost, "http://"+proxy.Addr().String()+CompletionsPath, strings.NewReader(body))
+			Expect(err).ToNot(HaveOccurred())
+			req.Header.Add(requestHeaderPrefillHostPort, prefiller)
+
+			resp, err := http.DefaultClient.Do(req)
+			Expect(err).ToNot(HaveOccurred())
+			resp.Body.Close() //nolint:all
+			Expect(resp.StatusCode).To(Equal(http.StatusOK))
+		}
+
+		BeforeEach(func() {
+			_, ctx := ktesting.NewTestContext(GinkgoT())
+			ctx, cancelFn := context.WithCancel(ctx)
+			DeferCleanup(cancelFn)
+
+			prefillHandler = &mock.ChatCompletionHandler{Connector: ConnectorNIXLV2, Role: mock.RolePrefill}
+			prefillBackend := httptest.NewServer(prefillHandler)
+			DeferCleanup(prefillBackend.Close)
+			prefiller = prefillBackend.URL[len("http://"):]
+
+			decodeHandler = &mock.ChatCompletionHandler{Connector: ConnectorNIXLV2, Role: mock.RoleDecode}
+			decoderQueries.Store(100)
+			decodeBackend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path == decoderMetricsPath {
+					fmt.Fprintf(w, "# TYPE vllm:prefix_cache_queries counter\nvllm:prefix_cache_queries_total{engine=\"0\"} %d\n", decoderQueries.Load()) //nolint:all
+					return
+				}
+				decodeHandler.ServeHTTP(w, r)
+			}))
+			DeferCleanup(decodeBackend.Close)
+
+			decodeURL, err := url.Parse(decodeBackend.URL)
+			Expect(err).ToNot(HaveOccurred())
+			proxy, err = NewProxy("0", decodeURL, Config{
+				Connector:                ConnectorNIXLV2,
+				PrefixCacheSkipRatio:     0.8,
+				PrefixCacheIndexSize:     1024,
+				PrefixCacheProbeInterval: 100 * time.Millisecond,
+			})
+			Expect(err).ToNot(HaveOccurred())
+
+			go func() {
+				defer GinkgoRecover()
+				Expect(proxy.Start(ctx)).To(Succeed())
+			}()
+			time.Sleep(1 * time.Second)
+			Expect(proxy.Addr()).ToNot(BeNil())
+		})
+
+		It("should skip the remote prefill of prompts cached by the decoder", func() {
+			sendRequest(conversation)
+			Expect(prefillHandler.RequestCount.Load()).To(BeNumerically("==", 1))
+
+			sendRequest(conversation)
+			Expect(prefillHandler.RequestCount.Load()).To(BeNumerically("==", 1))
+			Expect(decodeHandler.RequestCount.Load()).To(BeNumerically("==", 2))
+			Expect(decodeHandler.CompletionRequests[1]).ToNot(HaveKey(requestFieldKVTransferParams))
+
+			// mostly new prompt
+			sendRequest(conversation + conversation + conversation)
+			Expect(prefillHandler.RequestCount.Load()).To(BeNumerically("==", 2))
+		})
+
+		It("should purge the index when the decoder restarts", func() {
+			sendRequest(conversation)
+			Expect(proxy.prefixIndex.chunks.Len()).ToNot(BeZero())
+
+			decoderQueries.Store(0)
+			Eventually(proxy.prefixIndex.chunks.Len).Should(BeZero())
+
+			sendRequest(conversation)
+			Expect(prefillHandler.RequestCount.Load()).To(BeNumerically("==", 2))
+		})
+	})
+})
@@ -0,0 +1,80 @@
+/*
+Copyright 2025 The llm-d Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package proxy
+
+const (
+	// charsPerToken is the average number of characters per token used to estimate prompt sizes
+	charsPerToken = 4
+)
+
+// promptSizeBuckets are the upper bounds, in estimated tokens, of the prompt size buckets
+var promptSizeBuckets = []struct {
+	limit int
+	label string
+}{
+	{256, "0-256"},
+	{1024, "256-1k"},
+	{4096, "1k-4k"},
+	{16384, "4k-16k"},
+}
+
+const promptSizeOverflowLabel = "16k+"
+
+// promptSizeBucket returns the prompt size bucket of a completion or chat completion request
+func promptSizeBucket(p *parsedRequest) string {
+	tokens := estimatePromptTokens(p)
+	for _, bucket := range promptSizeBuckets {
+		if tokens < bucket.limit {
+			return bucket.label
+		}
+	}
+	return promptSizeOverflowLabel
+}
+
+// estimatePromptTokens estimates the number of tokens of the prompt. Token IDs
+// are counted as is, text is counted as charsPerToken characters per token.
+func estimatePromptTokens(p *parsedRequest) int {
+	chars, tokens := countPrompt(p.prompt)
+	for _, message := range p.chat {
+		c, t := countPrompt(message.content)
+		chars += c
+		tokens += t
+	}
+	return tokens + chars/charsPerToken
+}
+
+// countPrompt returns the number of characters and token IDs of a prompt, which is either
+// a string, a list of strings or token IDs, or a list of chat content parts
+func countPrompt(prompt any) (chars int, tokens int) {
+	switch p := prompt.(type) {
+	case string:
+		chars += len(p)
+	case float64:
+		tokens++
+	case []any:
+		for _, item := range p {
+			c, t := countPrompt(item)
+			chars += c
+			tokens += t
+		}
+	case map[string]any:
+		if text, ok := p["text"].(string); ok {
+			chars += len(text)
+		}
+	}
+	return chars, tokens
+}
@@ -0,0 +1,51 @@
+/*
+Copyright 2025 The llm-d Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package proxy
+
+import (
+	"strings"
+
+	. "github.com/onsi/ginkgo/v2" // nolint:revive
+	. "github.com/onsi/gomega"    // nolint:revive
+)
+
+var _ = Describe("Prompt size", func() {
+	DescribeTable("should estimate the prompt tokens",
+		func(body string, expected int) {
+			Expect(estimatePromptTokens(mustParse(body))).To(Equal(expected))
+		},
+		Entry("when the prompt is a string", `{"prompt": "`+strings.Repeat("a", 400)+`"}`, 100),
+		Entry("when the prompt is a list of strings", `{"prompt": ["aaaa", "aaaa"]}`, 2),
+		Entry("when the prompt is a list of token IDs", `{"prompt": [1, 2, 3]}`, 3),
+		Entry("when the prompt is a list of token ID lists", `{"prompt": [[1, 2], [3]]}`, 3),
+		Entry("when the messages have string contents", `{"messages": [{"role": "system", "content": "aaaa"}, {"role": "user", "content": "aaaa"}]}`, 2),
+		Entry("when the messages have content parts", `{"messages": [{"role": "user", "content": [{"type": "text", "text": "aaaaaaaa"}]}]}`, 2),
+		Entry("when there is no prompt", `{"model": "m"}`, 0),
+	)
+
+	DescribeTable("should bucket the requests",
+		func(tokens int, expected string) {
+			body := `{"prompt": "` + strings.Repeat("a", tokens*charsPerToken) + `"}`
+			Expect(promptSizeBucket(mustParse(body))).To(Equal(expected))
+		},
+		Entry("when the prompt is small", 10, "0-256"),
+		Entry("when the prompt is at a bucket boundary", 256, "256-1k"),
+		Entry("when the prompt is medium", 2000, "1k-4k"),
+		Entry("when the prompt is large", 10000, "4k-16k"),
+		Entry("when the prompt is very large", 20000, "16k+"),
+	)
+})
@@ -25,13 +25,21 @@ import (
 	"net/http"
 	"net/http/httputil"
 	"net/url"
+	"strconv"
 	"strings"
+	"sync/atomic"
 	"syscall"
 	"time"
 
 	"github.com/go-logr/logr"
 	lru "github.com/hashicorp/golang-lru/v2"
+	"github.com/spiffe/go-spiffe/v2/spiffetls/tlsconfig"
 	"k8s.io/klog/v2"
+
+	"github.com/llm-d/llm-d-routing-sidecar/internal/audit"
+	"github.com/llm-d/llm-d-routing-sidecar/internal/identity"
+	"github.com/llm-d/llm-d-routing-sidecar/internal/metrics"
+	"github.com/llm-d/llm-d-routing-sidecar/pkg/middleware"
 )
 
 const (
@@ -50,6 +58,9 @@ const (
 	requestFieldRemotePort          = "remote_port"
 	requestFieldStream              = "stream"
 	requestFieldStreamOptions       = "stream_options"
+	requestFieldN                   = "n"
+	requestFieldBestOf              = "best_of"
+	requestFieldUseBeamSearch       = "use_beam_search"
 
 	// ConnectorNIXLV1 enables the (now deprecated) P/D NIXL v1 protocol
 	ConnectorNIXLV1 = "nixl"
@@ -66,6 +77,14 @@ type Config struct {
 	// Connector is the name of the P/D protocol the proxy must follow.
 	Connector string
 
+	// ExperimentConnector is a second P/D protocol followed by ExperimentConnectorWeight percent
+	// of the disaggregated requests, e.g. to roll out a new protocol. Empty disables it.
+	ExperimentConnector string
+
+	// ExperimentConnectorWeight is the percentage of the disaggregated requests following the
+	// experiment connector
+	ExperimentConnectorWeight int
+
 	// PrefillerUseTLS indicates whether to use TLS when sending requests to prefillers.
 	PrefillerUseTLS bool
 
@@ -75,12 +94,68 @@ type Config struct {
 	// CertPath is the location of the TLS certificates
 	CertPath string
 
+	// PrefillerCAFile is a PEM bundle of the CAs trusted, in addition to the system roots, to
+	// verify the prefiller certificates
+	PrefillerCAFile string
+
+	// PrefillerCAReloadInterval is how often PrefillerCAFile is checked for changes. Zero
+	// disables the reload.
+	PrefillerCAReloadInterval time.Duration
+
+	// SPIFFESource enables mTLS with SPIFFE identities, for both the proxy listener when
+	// SecureProxy is set and the connections to prefillers when PrefillerUseTLS is set. It
+	// replaces CertPath, PrefillerCAFile and PrefillerInsecureSkipVerify.
+	SPIFFESource SPIFFESource
+
+	// SPIFFEAuthorizedIDs are the SPIFFE IDs of the peers allowed to connect to the proxy and to
+	// serve prefill requests. Defaults to any workload of the trust domain of the proxy.
+	SPIFFEAuthorizedIDs []string
+
 	// PrefillerInsecureSkipVerify configure the proxy to skip TLS verification for requests to prefiller.
 	PrefillerInsecureSkipVerify bool
 
 	// DecoderInsecureSkipVerify configure the proxy to skip TLS verification for requests to decoder.
 	DecoderInsecureSkipVerify bool
 
+	// DecoderCAFile is a PEM bundle of the CAs trusted, in addition to the system roots, to
+	// verify the decoder certificate. It is read once, when the proxy is created.
+	DecoderCAFile string
+
+	// DecoderTLSServerName is the name verified in the decoder certificate, instead of the
+	// host of the decoder URL
+	DecoderTLSServerName string
+
+	// DecoderSocket is the path of the Unix domain socket the decoder listens on, dialed
+	// instead of the host of the decoder URL
+	DecoderSocket string
+
+	// PrefillerTokenFile is a bearer token, e.g. a projected ServiceAccount token, sent with
+	// the prefill requests so the prefiller side authenticates the decode side. It is read
+	// again every minute, as the kubelet rotates it.
+	PrefillerTokenFile string
+
+	// PrefillerTokenAudience is the audience the token must be issued for, checked when read
+	PrefillerTokenAudience string
+
+	// PrefillerHMACKeyFile is a shared key signing the prefill requests with HMAC-SHA256
+	PrefillerHMACKeyFile string
+
+	// CallerTokenAudience enables the prefill-side mode, where the requests for prefill work
+	// must carry a ServiceAccount token of the decode side, issued for this audience
+	CallerTokenAudience string
+
+	// CallerAuthorizedSubjects are the subjects allowed to send prefill work, e.g.
+	// system:serviceaccount:llm:decode. Defaults to any subject with a valid token.
+	CallerAuthorizedSubjects []string
+
+	// CallerTokenReviewer authenticates the tokens of the callers, required with
+	// CallerTokenAudience
+	CallerTokenReviewer TokenReviewer
+
+	// CallerHMACKeyFile enables the prefill-side mode, where the requests for prefill work
+	// must carry an HMAC-SHA256 signature with the key shared with PrefillerHMACKeyFile
+	CallerHMACKeyFile string
+
 	// EnableSSRFProtection enables SSRF protection.
 	EnableSSRFProtection bool
 
@@ -89,22 +164,376 @@ type Config struct {
 
 	// InferencePoolName InferencePool object name.
 	InferencePoolName string
+
+	// SSRFStartupTimeout is how long the Kubernetes API server is waited for when SSRF
+	// protection starts. Defaults to 2 minutes.
+	SSRFStartupTimeout time.Duration
+
+	// SSRFAllowlistSnapshot is the file the SSRF protection allowlist is persisted to, and loaded
+	// from at startup to serve prefill requests before the InferencePool is watched
+	SSRFAllowlistSnapshot string
+
+	// Identity is the identity of the sidecar pod, attached to the spans of the requests
+	Identity identity.Identity
+
+	// SSRFDegradedMode decides the prefill targets once the SSRF protection allowlist is out of
+	// sync with the API server for SSRFDegradedGracePeriod: SSRFDegradedFailClosed or
+	// SSRFDegradedFailOpen. The stale allowlist is used indefinitely without grace period.
+	SSRFDegradedMode        string
+	SSRFDegradedGracePeriod time.Duration
+
+	// SSRFStrict additionally denies the loopback, link-local (e.g. cloud metadata) and own pod
+	// targets, even when allowlisted
+	SSRFStrict bool
+
+	// SSRFAuditLog receives a security audit record for each prefill target denied by the
+	// SSRF protection, nil to disable the audit
+	SSRFAuditLog *audit.Log
+
+	// SSRFAuditAllowed also audits the prefill targets allowed by the SSRF protection
+	SSRFAuditAllowed bool
+
+	// PrefillOverrides are the fields set in the requests sent to prefillers, e.g. to pin
+	// sampling parameters. A null value removes the field. Defaults to the connector overrides.
+	PrefillOverrides map[string]any
+
+	// PrefillStripFields are the client-only fields removed from the prefill requests, before the
+	// prefill overrides, and kept in the decode requests, e.g. DefaultPrefillStripFields
+	PrefillStripFields []string
+
+	// MaxRequestBodyBytes limits the size of the completion request bodies. Zero means no limit.
+	MaxRequestBodyBytes int64
+
+	// SpillThresholdBytes is the size above which the bodies of disaggregated requests are
+	// buffered in temp files rather than memory while rewritten. Zero disables the spill.
+	SpillThresholdBytes int64
+
+	// SpillDir is the directory of the spilled bodies. Defaults to the OS temp directory.
+	SpillDir string
+
+	// FastPassthrough sends the completion requests without prefiller header straight to the
+	// decoder, without reading their body: they are neither validated, counted in the prompt
+	// size and modality metrics nor added to the prefix index. It is rejected together with the
+	// features needing the body: MaxRequestBodyBytes, hedging, a routing policy, middlewares,
+	// stream usage injection, model aliases, the request and stream idle timeouts, decode replay,
+	// caller authentication and the prefix cache index.
+	FastPassthrough bool
+
+	// MultimodalDecodeOnly sends the requests with image, audio or video content decode-only.
+	MultimodalDecodeOnly bool
+
+	// AudioModelRoutes maps models to the URL of the engine serving their audio requests.
+	// Audio requests are sent decode-only when empty, or when the model has no route.
+	AudioModelRoutes map[string]string
+
+	// TokenizeCacheSize is the number of tokenize and detokenize responses cached. Zero disables the cache.
+	TokenizeCacheSize int
+
+	// PrefillCacheSize is the number of prefill responses cached, so identical requests sent
+	// to the same prefiller within PrefillCacheTTL are not prefilled again. Only supported by
+	// the nixlv2 connector. Zero disables the cache.
+	PrefillCacheSize int
+
+	// PrefillCacheTTL is how long the prefill responses are cached
+	PrefillCacheTTL time.Duration
+
+	// PrefixCacheSkipRatio sends decode-only the requests whose prompt prefix is estimated to be
+	// cached by the decoder for at least this fraction of the prompt. Zero disables the estimate.
+	PrefixCacheSkipRatio float64
+
+	// PrefixCacheIndexSize is the number of prompt chunks indexed to estimate the decoder prefix cache
+	PrefixCacheIndexSize int
+
+	// PrefixCacheProbeInterval is how often the decoder prefix cache counters are probed to detect
+	// restarts. Zero disables the probe.
+	PrefixCacheProbeInterval time.Duration
+
+	// PrefillBypassTokens sends the prompts with fewer tokens decode-only, as counted by the
+	// decoder tokenizer. Zero disables the bypass.
+	PrefillBypassTokens int
+
+	// RoutingPolicy is a CEL expression deciding how each completion request is routed, from
+	// its headers, path, model, estimated prompt_tokens, modality and prefill target. It returns
+	// "allow", "deny", "decode" for decode-only, or the host:port of another prefiller. The
+	// rewritten target is still checked against the SSRF protection allowlist.
+	RoutingPolicy string
+
+	// RoutingPolicyURL is the OPA decision endpoint deciding how each completion request is
+	// routed, as RoutingPolicy does. Exclusive with RoutingPolicy.
+	RoutingPolicyURL string
+
+	// Passthrough decides which requests not intercepted by the proxy are forwarded to the
+	// decoder: PassthroughAll (by default), PassthroughOpenAIOnly or PassthroughList. The
+	// others are rejected with 403, e.g. to block the engine admin endpoints.
+	Passthrough string
+
+	// PassthroughPaths are the paths forwarded to the decoder with PassthroughList. The paths
+	// ending with / allow the paths under them.
+	PassthroughPaths []string
+
+	// Middlewares hook custom logic into the request handling, run in order
+	Middlewares []middleware.Middleware
+
+	// EnableBatchAPI serves the OpenAI files and batches endpoints, running each batch item
+	// through the P/D protocol. Batches are kept in memory.
+	EnableBatchAPI bool
+
+	// BatchMaxConcurrency bounds the batches run at once, the others waiting their turn.
+	// Zero runs every batch right away.
+	BatchMaxConcurrency int
+
+	// BatchQueueSize bounds the batches waiting to run, the creation of the others being
+	// rejected with 429. Zero means no limit.
+	BatchQueueSize int
+
+	// BatchItemTimeout is the deadline of each batch item, the items exceeding it failing
+	// with 504. Zero means no deadline.
+	BatchItemTimeout time.Duration
+
+	// BatchStoreMaxFiles bounds the input and output files of the batch API kept in memory.
+	// Zero means no limit.
+	BatchStoreMaxFiles int
+
+	// BatchStoreMaxBatches bounds the batches kept in memory. Zero means no limit.
+	BatchStoreMaxBatches int
+
+	// BatchStoreMaxBytes bounds the size of the files of the batch API kept in memory.
+	// Zero means no limit.
+	BatchStoreMaxBytes int64
+
+	// BatchRetention is how long the files and the finished batches are kept. The oldest
+	// finished batches are evicted sooner to make room. Zero keeps them until evicted.
+	BatchRetention time.Duration
+
+	// EnableMessagesAPI serves the Anthropic messages API, translated to the OpenAI chat
+	// completions API of the decoder
+	EnableMessagesAPI bool
+
+	// PrefillerSelectionStrategy selects the prefill target among the candidates sent in the
+	// x-prefiller-host-port header: random, round-robin, least-recently-used or power-of-two.
+	// The requests naming several targets are rejected when empty.
+	PrefillerSelectionStrategy string
+
+	// PrefillerStatsFile is the file the statistics of the selected prefillers are persisted to,
+	// and loaded from at startup, so the selections do not learn them again after a restart.
+	// Disabled when empty.
+	PrefillerStatsFile string
+
+	// GRPCPort is the port of the experimental gRPC frontend, serving the chat completions and
+	// completions as unary and server-streaming RPCs. Disabled when empty.
+	GRPCPort string
+
+	// PrefillerDNSRefreshInterval is how often the DNS names of prefillers are re-resolved.
+	// Requests are rotated among the resolved addresses. Zero disables the re-resolution.
+	PrefillerDNSRefreshInterval time.Duration
+
+	// EnableSleepMode serves the vLLM sleep and wake up endpoints, authenticated with
+	// SleepControlToken. Requests are turned away with 503 while the engine sleeps.
+	EnableSleepMode bool
+
+	// SleepControlToken is the bearer token of the sleep and wake up requests
+	SleepControlToken string
+
+	// SleepRetryAfter is the delay advertised to the clients turned away while the engine sleeps
+	SleepRetryAfter time.Duration
+
+	// DataParallelRank is the data parallel rank of the vLLM engine the proxy forwards requests to.
+	DataParallelRank int
+
+	// DataParallelFailover redirects the traffic to a sibling rank while the local vLLM engine is down.
+	DataParallelFailover bool
+
+	// RequestTimeout cancels the non-streaming completion requests not answered in time, with
+	// 504. Zero for no deadline.
+	RequestTimeout time.Duration
+
+	// StreamIdleTimeout cancels the streaming completion requests when no token was streamed
+	// for the timeout, e.g. a hung engine. Zero for no timeout.
+	StreamIdleTimeout time.Duration
+
+	// StreamStallTimeout cancels the event streams of the decoder when no data arrived for the
+	// timeout, ending them with an error event. Zero disables the watchdog.
+	StreamStallTimeout time.Duration
+
+	// StreamErrorEvents ends the event streams of the decoder failing midway with an error
+	// event, so clients can tell them from complete streams, instead of truncating them
+	StreamErrorEvents bool
+
+	// StreamErrorOmitDone omits the end of stream marker after the error events
+	StreamErrorOmitDone bool
+
+	// ShutdownPolicy decides what happens to the requests in flight at shutdown: ShutdownWait
+	// (the default), ShutdownClose or ShutdownHandoff
+	ShutdownPolicy string
+
+	// DrainTimeout is how long the requests in flight are waited for at shutdown. Defaults to
+	// a minute.
+	DrainTimeout time.Duration
+
+	// DecodeReplay replays once the non-streaming decode-only requests whose decoder connection
+	// is reset before any response, on a healthy sibling rank if any
+	DecodeReplay bool
+
+	// KVTransferRetry retries once the disaggregated requests whose decoder failed to pull the
+	// KV blocks, with a fresh prefill or decode-only. Empty disables the retries.
+	KVTransferRetry string
+
+	// Pool is the virtual pool served by the proxy, empty for the main pool. It prefixes the data
+	// parallel rank in the logs and the metrics, e.g. pool-b/0.
+	Pool string
+
+	// DecoderHealthGating turns away the requests with 503, and reports the proxy as not ready,
+	// while the local vLLM engine is down, e.g. until it listens at startup.
+	DecoderHealthGating bool
+
+	// DataParallelHedgeDelay is the latency after which non-streaming decode-only requests are
+	// also sent to a sibling rank, the slower request being canceled. Zero disables hedging.
+	DataParallelHedgeDelay time.Duration
+
+	// CanaryDecoderPort is the port of a canary engine on the host of the decoder, e.g. a new
+	// vLLM version, receiving CanaryWeight percent of the decode traffic. Empty disables it.
+	CanaryDecoderPort string
+
+	// CanaryWeight is the percentage of the decode traffic sent to the canary engine
+	CanaryWeight int
+
+	// CanarySessionHeader is the request header holding the session of a request, the requests
+	// of a session sticking to the same engine. Requests without session are split at random.
+	CanarySessionHeader string
+
+	// SlowPrefillThreshold logs a warning for the prefills slower than this threshold. Zero
+	// disables the warning.
+	SlowPrefillThreshold time.Duration
+
+	// SlowRequestThreshold logs a warning for the completion requests slower than this
+	// threshold end to end. Zero disables the warning.
+	SlowRequestThreshold time.Duration
+
+	// AccessLog logs every completion request served, with the wall-clock times of its protocol
+	// stages, and sends the time of the prefill requests in the x-llm-d-sent-at header
+	AccessLog bool
+
+	// StatsLogInterval is how often the request rate, error rate, latency percentiles and
+	// prefill bypass rate since the previous interval are logged. Zero disables the log.
+	StatsLogInterval time.Duration
+
+	// RoutingDecisionsSize is the number of last routing decisions of the completion requests
+	// kept for the admin API. Zero disables the decisions.
+	RoutingDecisionsSize int
+
+	// InjectStreamUsage asks the decoder for the usage of the streamed completions, recorded in
+	// the token metrics. The final usage chunk is stripped when the client did not ask for it.
+	InjectStreamUsage bool
+
+	// EngineResponseHeaders reports the engines which produced a response in its headers: the
+	// pod, pool, data parallel rank and canary target of the decoder, and the prefiller and its
+	// engine ID for the disaggregated requests
+	EngineResponseHeaders bool
+
+	// AdmissionMaxConcurrency bounds the completion requests served concurrently, queuing the
+	// others by the priority class of their PriorityHeader. Zero disables the admission queue.
+	AdmissionMaxConcurrency int
+
+	// AdmissionQueueSize bounds the requests waiting in the admission queue, the others being
+	// rejected with 503. Zero for no limit.
+	AdmissionQueueSize int
+
+	// AdmissionQueueTimeout rejects with 503 the requests waiting longer in the admission queue.
+	// Zero for no limit.
+	AdmissionQueueTimeout time.Duration
+
+	// AdmissionPreemption lets the interactive requests arriving in a saturated admission queue
+	// preempt the batch requests: the oldest queued one when the queue is full, otherwise the
+	// oldest in its prefill leg. The preempted requests are rejected with a retryable 429.
+	AdmissionPreemption bool
+
+	// TenantHeader is the request header holding the tenant of the concurrency quotas and of the
+	// model entitlements
+	TenantHeader string
+
+	// TenantConcurrencyQuotas bounds the completion requests served concurrently by tenant, the
+	// others being rejected with 429. The TenantQuotaWildcard quota applies to the tenants
+	// without their own quota.
+	TenantConcurrencyQuotas map[string]int
+
+	// TenantModels lists the models each tenant sees in GET /v1/models, by their alias if any.
+	// The TenantQuotaWildcard entry applies to the tenants without their own entry, the others
+	// seeing all the models.
+	TenantModels map[string][]string
+
+	// ModelAliases exposes the models served by the decoder under another name, by model. The
+	// completion requests for an alias are sent to its model.
+	ModelAliases map[string]string
+
+	// PriorityHeader selects the priority class of a request: interactive, standard or batch.
+	// Defaults to DefaultPriorityHeader.
+	PriorityHeader string
+
+	// BindAddresses are the addresses the proxy listens on, e.g. the pod IP to restrict it to the
+	// pod network interface. The proxy listens on all the interfaces when empty.
+	BindAddresses []string
+
+	// Listener serves the proxy instead of listening on its port, e.g. to embed the proxy
+	Listener net.Listener
+
+	// DecoderTransport sends the requests to the decoder instead of the default transport. It
+	// replaces the decoder TLS options.
+	DecoderTransport http.RoundTripper
+
+	// PrefillerTransport sends the requests to the prefillers instead of the default transport.
+	// It replaces the prefiller TLS options.
+	PrefillerTransport http.RoundTripper
 }
 
 type protocolRunner func(http.ResponseWriter, *http.Request, string)
 
 // Server is the reverse proxy server
 type Server struct {
-	logger               logr.Logger
-	addr                 net.Addr       // the proxy TCP address
-	port                 string         // the proxy TCP port
-	decoderURL           *url.URL       // the local decoder URL
-	decoderProxy         http.Handler   // decoder proxy handler
-	runConnectorProtocol protocolRunner // the handler for running the protocol
-	prefillerURLPrefix   string
-	allowlistValidator   *AllowlistValidator // SSRF protection validator
+	logger                logr.Logger
+	addr                  net.Addr       // the proxy TCP address, read once listening
+	grpcAddr              net.Addr       // the gRPC frontend TCP address, nil when disabled
+	listening             chan struct{}  // closed once the addresses are set
+	port                  string         // the proxy TCP port
+	decoderURL            *url.URL       // the local decoder URL
+	decoderProxy          http.Handler   // decoder proxy handler
+	localDecoderProxy     http.Handler   // local decoder proxy handler, bypassing failover
+	runConnectorProtocol  protocolRunner // the handler for running the protocol
+	runExperimentProtocol protocolRunner // the handler for running the experiment protocol, nil when disabled
+	prefillerURLPrefix    string
+	prefillOverrides      map[string]any          // fields set in prefill requests, the connector defaults when nil
+	audioProxies          map[string]http.Handler // audio proxy handlers, by model
+	allowlistValidator    *AllowlistValidator     // SSRF protection validator
+
+	prefillerProxies  *lru.Cache[string, http.Handler] // cached prefiller proxy handlers
+	prefillerSelector *prefillerSelector               // selects among the candidate prefillers, nil when disabled
+	decisions         *routingDecisions                // the last routing decisions, nil when disabled
+	lookupHost        lookupHostFunc                   // resolves prefiller DNS names
+	inflight          *inflightTracker                 // requests currently handled
+
+	tokenizeCache *lru.Cache[string, *tokenizeResponse] // cached tokenize responses, nil when disabled
+	prefillCache  *prefillCache                         // cached prefill responses, nil when disabled
+	prefillerCA   *caBundle                             // CAs of the prefiller certificates, nil for the system roots
+	decoderCA     *caBundle                             // CAs of the decoder certificate, nil for the system roots
+	prefillAuth   *prefillAuthenticator                 // the credentials of the prefill requests, nil when not authenticated
+	callerAuth    *callerAuthenticator                  // the authentication of the prefill work received, nil when not authenticated
+	prefixIndex   *prefixIndex                          // estimated decoder prefix cache, nil when disabled
+	batches       *batchStore                           // batch files and batches
+	stats         *statsCollector                       // requests aggregated for the stats log, nil when disabled
+	admission     *admissionQueue                       // requests waiting for the decoder, nil when disabled
+	batchPool     *batchPool                            // batches running and waiting to run, nil when unbounded
+	tenants       *tenantCounter                        // requests in flight by tenant, for the quotas
+	deprecations  *deprecationTracker                   // warnings of the deprecated features used
+	aliasedModels map[string]string                     // models served by the decoder, by alias
 
-	prefillerProxies *lru.Cache[string, http.Handler] // cached prefiller proxy handlers
+	spiffeAuthorizer tlsconfig.Authorizer // authorizes the peer SVIDs, nil without SPIFFE
+	policy           routingPolicy        // decides how completion requests are routed, nil when disabled
+
+	siblings    []*Server    // the proxies of the other data parallel ranks
+	decoderDown *atomic.Bool // whether the local decoder is refusing connections
+	sleeping    *atomic.Bool // whether the local decoder is put to sleep
+
+	routing *atomic.Pointer[generation] // the request routing of the current configuration
+	routed  http.Handler                // the routes of the configuration, running the batch items
 
 	config Config
 }
@@ -118,6 +547,21 @@ func NewProxy(port string, decodeURL *url.URL, config Config) (*Server, error) {
 	if err != nil {
 		return nil, fmt.Errorf("failed to create SSRF protection validator: %w", err)
 	}
+	if config.SSRFStartupTimeout > 0 {
+		validator.startupTimeout = config.SSRFStartupTimeout
+	}
+	validator.snapshotPath = config.SSRFAllowlistSnapshot
+	validator.degradedMode = config.SSRFDegradedMode
+	validator.degradedGracePeriod = config.SSRFDegradedGracePeriod
+	validator.rank = rankLabel(config)
+	if validator.enabled {
+		metrics.RegisterAllowlistSyncAge(validator.rank, validator.SyncAge)
+	}
+	if config.SSRFStrict {
+		if err := validator.EnableStrict(); err != nil {
+			return nil, fmt.Errorf("failed to enable strict SSRF protection: %w", err)
+		}
+	}
 
 	server := &Server{
 		port:               port,
@@ -125,29 +569,169 @@ func NewProxy(port string, decodeURL *url.URL, config Config) (*Server, error) {
 		prefillerProxies:   cache,
 		prefillerURLPrefix: "http://",
 		allowlistValidator: validator,
+		inflight:           newInflightTracker(),
+		batches:            newBatchStore(config),
+		tenants:            newTenantCounter(),
+		deprecations:       newDeprecationTracker(),
+		lookupHost:         net.DefaultResolver.LookupHost,
+		decoderDown:        new(atomic.Bool),
+		sleeping:           new(atomic.Bool),
+		listening:          make(chan struct{}),
+		routing:            new(atomic.Pointer[generation]),
 		config:             config,
 	}
-	switch config.Connector {
-	case ConnectorLMCache:
-		server.runConnectorProtocol = server.runLMCacheProtocol
-	case ConnectorNIXLV1:
-		server.runConnectorProtocol = server.runNIXLProtocolV1
-	case ConnectorNIXLV2:
-		fallthrough
-	default:
-		server.runConnectorProtocol = server.runNIXLProtocolV2
-	}
 
 	if config.PrefillerUseTLS {
 		server.prefillerURLPrefix = "https://"
 	}
+	switch config.ShutdownPolicy {
+	case "", ShutdownWait, ShutdownClose, ShutdownHandoff:
+		server.inflight.interruptible = server.interruptible()
+	default:
+		return nil, fmt.Errorf("unknown shutdown policy %q", config.ShutdownPolicy)
+	}
+
+	if config.StatsLogInterval > 0 {
+		server.stats = newStatsCollector()
+	}
+	server.decisions = newRoutingDecisions(config.RoutingDecisionsSize)
+
+	server.prefillerSelector, err = newPrefillerSelector(config.PrefillerSelectionStrategy)
+	if err != nil {
+		return nil, err
+	}
+
+	server.batchPool = newBatchPool(rankLabel(config), config.BatchMaxConcurrency, config.BatchQueueSize)
+
+	if config.AdmissionMaxConcurrency > 0 {
+		server.admission = newAdmissionQueue(rankLabel(config), config.AdmissionMaxConcurrency,
+			config.AdmissionQueueSize, config.AdmissionQueueTimeout, config.AdmissionPreemption)
+	}
+
+	if config.TokenizeCacheSize > 0 {
+		server.tokenizeCache, err = lru.New[string, *tokenizeResponse](config.TokenizeCacheSize)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create tokenize cache: %w", err)
+		}
+	}
 
+	if config.PrefillCacheSize > 0 {
+		server.prefillCache = newPrefillCache(config.PrefillCacheSize, config.PrefillCacheTTL)
+	}
+
+	if config.PrefixCacheSkipRatio > 0 {
+		server.prefixIndex, err = newPrefixIndex(config.PrefixCacheIndexSize)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create prefix index: %w", err)
+		}
+	}
+
+	if config.PrefillerCAFile != "" {
+		server.prefillerCA, err = loadCABundle(config.PrefillerCAFile)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if config.DecoderCAFile != "" {
+		server.decoderCA, err = loadCABundle(config.DecoderCAFile)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if config.PrefillerTokenFile != "" || config.PrefillerHMACKeyFile != "" {
+		server.prefillAuth, err = newPrefillAuthenticator(config)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if config.CallerTokenAudience != "" || config.CallerHMACKeyFile != "" {
+		server.callerAuth, err = newCallerAuthenticator(config)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if config.SPIFFESource != nil {
+		server.spiffeAuthorizer, err = newSPIFFEAuthorizer(config.SPIFFESource, config.SPIFFEAuthorizedIDs)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if err := server.configureRouting(); err != nil {
+		return nil, err
+	}
 	return server, nil
 }
 
+// configureRouting sets up the request routing from the settings of the configuration that
+// can be reloaded
+func (s *Server) configureRouting() error {
+	s.runConnectorProtocol = s.connectorProtocol(s.config.Connector)
+	s.runExperimentProtocol = nil
+	if s.config.ExperimentConnector != "" {
+		s.runExperimentProtocol = s.connectorProtocol(s.config.ExperimentConnector)
+	}
+
+	var err error
+	s.audioProxies, err = createAudioProxies(s.config.AudioModelRoutes)
+	if err != nil {
+		return err
+	}
+
+	s.policy, err = newRoutingPolicy(s.config.RoutingPolicy, s.config.RoutingPolicyURL)
+	if err != nil {
+		return err
+	}
+
+	if err := s.validatePassthrough(); err != nil {
+		return err
+	}
+
+	s.aliasedModels, err = resolveModelAliases(s.config.ModelAliases)
+	if err != nil {
+		return err
+	}
+
+	if s.config.EnableSleepMode && s.config.SleepControlToken == "" {
+		return errors.New("sleep mode requires a sleep control token")
+	}
+
+	if err := s.validateFastPassthrough(); err != nil {
+		return err
+	}
+
+	s.prefillOverrides = s.config.PrefillOverrides
+
+	s.localDecoderProxy = s.createDecoderProxy(s.decoderURL)
+	s.decoderProxy = s.localDecoderProxy
+	if s.config.DataParallelFailover {
+		s.decoderProxy = s.failoverHandler()
+	}
+	if s.config.CanaryDecoderPort != "" {
+		s.decoderProxy = s.canaryHandler(s.decoderProxy)
+	}
+	s.decoderProxy = s.measureDecodeRequests(s.decoderProxy)
+	return nil
+}
+
+// connectorProtocol returns the handler running the protocol of a connector
+func (s *Server) connectorProtocol(connector string) protocolRunner {
+	switch connector {
+	case ConnectorLMCache:
+		return s.runLMCacheProtocol
+	case ConnectorNIXLV1:
+		return s.runNIXLProtocolV1
+	case ConnectorNIXLV2:
+		fallthrough
+	default:
+		return s.runNIXLProtocolV2
+	}
+}
+
 // Start the HTTP reverse proxy.
 func (s *Server) Start(ctx context.Context) error {
-	logger := klog.FromContext(ctx).WithName("proxy server")
+	logger := klog.FromContext(ctx).WithName("proxy server").WithValues(metrics.RankLabel, s.rank())
 	s.logger = logger
 
 	// Start SSRF protection validator
@@ -156,18 +740,45 @@ func (s *Server) Start(ctx context.Context) error {
 		return err
 	}
 
-	ln, err := net.Listen("tcp", ":"+s.port)
-	if err != nil {
-		logger.Error(err, "Failed to start")
-		return err
+	var err error
+	listeners := []net.Listener{s.config.Listener}
+	if s.config.Listener == nil {
+		listeners, err = listen(s.config.BindAddresses, s.port)
+		if err != nil {
+			logger.Error(err, "Failed to start")
+			return err
+		}
 	}
-	s.addr = ln.Addr()
+	s.addr = listeners[0].Addr()
 
-	// Configure handlers
-	mux := s.createRoutes()
+	// Turn requests away until the decoder is healthy, rather than waiting for them to fail
+	if s.config.DecoderHealthGating && !s.Health(ctx).Healthy {
+		s.markDecoderDown()
+	}
+
+	if s.prefixIndex != nil && s.config.PrefixCacheProbeInterval > 0 {
+		go s.watchDecoderPrefixCache(ctx)
+	}
+
+	if s.prefillerCA != nil && s.config.PrefillerCAReloadInterval > 0 {
+		go s.watchPrefillerCA(ctx)
+	}
+
+	if s.stats != nil {
+		go s.logStats(ctx)
+	}
+	metrics.RegisterConnections(s.rank(), s.inflight.connectionStats)
+
+	if s.prefillerSelector != nil && s.config.PrefillerStatsFile != "" {
+		s.loadPrefillerStats()
+		go s.persistPrefillerStats(ctx)
+	}
+
+	// Configure handlers, unless the configuration was reloaded
+	s.routing.CompareAndSwap(nil, &generation{server: s, handler: s.routes()})
 
 	server := &http.Server{
-		Handler: mux,
+		Handler: s.handler(),
 		// No ReadTimeout/WriteTimeout for LLM inference - can take hours for large contexts
 		IdleTimeout:       300 * time.Second, // 5 minutes for keep-alive connections
 		ReadHeaderTimeout: 30 * time.Second,  // Reasonable for headers only
@@ -175,7 +786,10 @@ func (s *Server) Start(ctx context.Context) error {
 	}
 
 	// Create TLS certificates
-	if s.config.SecureProxy {
+	if s.config.SecureProxy && s.spiffeAuthorizer != nil {
+		server.TLSConfig = s.spiffeServerTLSConfig()
+		logger.Info("server mTLS configured with SPIFFE identities")
+	} else if s.config.SecureProxy {
 		var cert tls.Certificate
 		if s.config.CertPath != "" {
 			cert, err = tls.LoadX509KeyPair(s.config.CertPath+"/tls.crt", s.config.CertPath+"/tls.key")
@@ -201,81 +815,219 @@ func (s *Server) Start(ctx context.Context) error {
 		logger.Info("server TLS configured")
 	}
 
+	if s.config.GRPCPort != "" {
+		grpcServer, err := s.newGRPCServer(server.TLSConfig)
+		if err != nil {
+			logger.Error(err, "failed to create the gRPC frontend")
+			return err
+		}
+		grpcListeners, err := listen(s.config.BindAddresses, s.config.GRPCPort)
+		if err != nil {
+			logger.Error(err, "failed to start the gRPC frontend")
+			return err
+		}
+		s.grpcAddr = grpcListeners[0].Addr()
+		logger.Info("starting the gRPC frontend", "addr", listenerAddrs(grpcListeners))
+		go s.serveGRPC(ctx, grpcServer, grpcListeners)
+	}
+
 	// Setup graceful termination (not strictly needed for sidecars)
+	shutdownDone := make(chan struct{})
 	go func() {
+		defer close(shutdownDone)
 		<-ctx.Done()
 		logger.Info("shutting down")
 
 		// Stop allowlist validator
 		s.allowlistValidator.Stop()
 
-		ctx, cancelFn := context.WithTimeout(context.Background(), 60*time.Second)
-		defer cancelFn()
-		if err := server.Shutdown(ctx); err != nil {
-			logger.Error(err, "failed to gracefully shutdown")
-		}
+		s.shutdown(server, logger)
 	}()
 
-	logger.Info("starting", "addr", s.addr.String())
-	if s.config.SecureProxy {
-		if err := server.ServeTLS(ln, "", ""); err != nil && err != http.ErrServerClosed {
-			logger.Error(err, "failed to start")
-			return err
-		}
-	} else {
-		if err := server.Serve(ln); err != nil && err != http.ErrServerClosed {
-			logger.Error(err, "failed to start")
-			return err
-		}
+	close(s.listening)
+	logger.Info("starting", "addr", listenerAddrs(listeners))
+	err = serve(server, listeners, s.config.SecureProxy)
+	if err != http.ErrServerClosed {
+		logger.Error(err, "failed to start")
+		return err
 	}
 
+	// wait for the in-flight requests to complete
+	<-shutdownDone
 	return nil
 }
 
+// Addr returns the TCP address of the proxy, nil until it is listening
+func (s *Server) Addr() net.Addr {
+	select {
+	case <-s.listening:
+		return s.addr
+	default:
+		return nil
+	}
+}
+
+// GRPCAddr returns the TCP address of the gRPC frontend, nil until the proxy is listening or
+// when disabled
+func (s *Server) GRPCAddr() net.Addr {
+	select {
+	case <-s.listening:
+		return s.grpcAddr
+	default:
+		return nil
+	}
+}
+
+// handler returns the handler of the proxy requests
+func (s *Server) handler() http.Handler {
+	return s.inflight.middleware(s.identify(referenceRequests(instrumentHandler(s.rank(), s.stats, s.recoverPanics(s.routingHandler())))))
+}
+
+// rank returns the data parallel rank handled by the proxy, as a label value
+func (s *Server) rank() string {
+	return rankLabel(s.config)
+}
+
+// rankLabel returns the data parallel rank of a configuration, prefixed by its pool if any
+func rankLabel(config Config) string {
+	if config.Pool != "" {
+		return config.Pool + "/" + strconv.Itoa(config.DataParallelRank)
+	}
+	return strconv.Itoa(config.DataParallelRank)
+}
+
 func (s *Server) createRoutes() *http.ServeMux {
 	// Configure handlers
-	mux := http.NewServeMux()
+	mux := newMethodRoutes()
 
 	// Intercept chat requests
 	mux.HandleFunc("GET /health", func(w http.ResponseWriter, _ *http.Request) {
+		// not ready while the engine sleeps or is gated
+		if s.sleeping.Load() || s.decoderGated() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
 		w.WriteHeader(http.StatusOK)
 	})
-	mux.HandleFunc("POST "+ChatCompletionsPath, s.chatCompletionsHandler) // /v1/chat/completions (openai)
-	mux.HandleFunc("POST "+CompletionsPath, s.chatCompletionsHandler)     // /v1/completions (legacy)
+	completions := s.countCancellations(s.limitTenant(s.admit(http.HandlerFunc(s.chatCompletionsHandler))))
+	mux.Handle("POST "+ChatCompletionsPath, completions)            // /v1/chat/completions (openai)
+	mux.Handle("POST "+CompletionsPath, completions)                // /v1/completions (legacy)
+	mux.HandleFunc("POST "+AudioTranscriptionsPath, s.audioHandler) // /v1/audio/transcriptions
+	mux.HandleFunc("POST "+AudioSpeechPath, s.audioHandler)         // /v1/audio/speech
+	mux.HandleFunc("POST "+TokenizePath, s.tokenizeHandler)         // /tokenize
+	mux.HandleFunc("POST "+DetokenizePath, s.tokenizeHandler)       // /detokenize
+	mux.HandleFunc("GET "+ModelsPath, s.modelsHandler)              // /v1/models
+
+	// Batch API, running each item through the P/D protocol
+	if s.config.EnableBatchAPI {
+		s.createBatchRoutes(mux)
+	}
+
+	// Anthropic messages API, translated to chat completions
+	if s.config.EnableMessagesAPI {
+		messages := s.countCancellations(s.limitTenant(s.admit(http.HandlerFunc(s.messagesHandler))))
+		mux.Handle("POST "+MessagesPath, messages) // /v1/messages (anthropic)
+	}
+
+	// Sleep control endpoints, authenticated as they free the engine GPU memory
+	if s.config.EnableSleepMode {
+		mux.HandleFunc("POST "+SleepPath, s.sleepControlHandler(true))   // /sleep
+		mux.HandleFunc("POST "+WakeUpPath, s.sleepControlHandler(false)) // /wake_up
+	}
+
+	// Pooling endpoints, decode-only with their own metrics
+	for _, path := range poolingPaths {
+		mux.Handle("POST "+path, s.decoderProxy)
+	}
 
-	// Passthrough decoder handler
-	decoderProxy := httputil.NewSingleHostReverseProxy(s.decoderURL)
-	if s.decoderURL.Scheme == "https" {
+	// Passthrough decoder handler, including upgraded (e.g. WebSocket) connections
+	mux.HandleFunc("/", s.passthroughHandler)
+
+	return mux.mux()
+}
+
+// createDecoderProxy creates the handler forwarding requests to the local decoder, or to the
+// canary engine
+func (s *Server) createDecoderProxy(target *url.URL) http.Handler {
+	decoderProxy := httputil.NewSingleHostReverseProxy(target)
+	// Flush each chunk as soon as it is received, whatever the content type, so
+	// streamed deltas (e.g. tool call arguments) are never delayed or merged
+	decoderProxy.FlushInterval = -1
+	if s.config.DecoderTransport != nil {
+		decoderProxy.Transport = s.config.DecoderTransport
+	} else if s.config.DecoderSocket != "" && target == s.decoderURL {
 		decoderProxy.Transport = &http.Transport{
-			TLSClientConfig: &tls.Config{
-				InsecureSkipVerify: s.config.DecoderInsecureSkipVerify,
-				MinVersion:         tls.VersionTLS12,
-				CipherSuites: []uint16{
-					tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256,
-					tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384,
-					tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256,
-					tls.TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384,
-					tls.TLS_ECDHE_RSA_WITH_CHACHA20_POLY1305,
-					tls.TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305,
-				},
-			},
+			DialContext: s.dialDecoderSocket,
+		}
+	} else if target.Scheme == "https" {
+		decoderProxy.Transport = &http.Transport{
+			TLSClientConfig: s.decoderTLSConfig(),
 		}
 	}
-	decoderProxy.ErrorHandler = func(res http.ResponseWriter, _ *http.Request, err error) {
+	if s.config.StreamStallTimeout > 0 || s.config.StreamErrorEvents || s.interruptible() {
+		decoderProxy.ModifyResponse = s.watchEventStreams
+	}
+	decoderProxy.ModifyResponse = s.engineResponses(target, decoderProxy.ModifyResponse)
+	decoderProxy.ErrorHandler = func(res http.ResponseWriter, req *http.Request, err error) {
+		if replayConnectionReset(req, err) {
+			return
+		}
 
 		// Log errors from the decoder proxy
+		class := classifyUpstreamError(req.Context(), err)
 		switch {
+		case errors.Is(context.Cause(req.Context()), errRequestTimeout):
+			s.logger.V(4).Info("request timed out", "error", err.Error())
+		case errors.Is(err, context.Canceled):
+			s.logger.V(4).Info("request canceled by the client", "error", err.Error())
+			res.WriteHeader(http.StatusBadGateway)
+			return
 		case errors.Is(err, syscall.ECONNREFUSED):
-			s.logger.Error(err, "waiting for vLLM to be ready")
+			// the canary engine being down does not mark the decoder down, and the decoder
+			// already known to be down is not logged again
+			if s.tracksDecoderHealth() && target == s.decoderURL && !s.markDecoderDown() {
+				s.logger.V(4).Info("local decoder still down", "error", err.Error())
+			} else {
+				s.logger.Error(err, "waiting for vLLM to be ready", "target", target.Host)
+			}
 		default:
-			s.logger.Error(err, "http: proxy error")
+			s.logger.Error(err, "decoder request failed", "class", class, "target", target.Host)
 		}
-		res.WriteHeader(http.StatusBadGateway)
+		s.failUpstream(res, upstreamDecoder, class)
 	}
-	s.decoderProxy = decoderProxy
-	mux.Handle("/", s.decoderProxy)
+	return decoderProxy
+}
 
-	return mux
+// decoderAddress returns the address of the decoder in the health reports and the metrics
+func (s *Server) decoderAddress() string {
+	if s.config.DecoderSocket != "" {
+		return "unix:" + s.config.DecoderSocket
+	}
+	return s.decoderURL.Host
+}
+
+// dialDecoderSocket connects to the Unix domain socket of the decoder, whatever the address
+func (s *Server) dialDecoderSocket(ctx context.Context, _ string, _ string) (net.Conn, error) {
+	dialer := &net.Dialer{Timeout: 30 * time.Second}
+	return dialer.DialContext(ctx, "unix", s.config.DecoderSocket)
+}
+
+// decoderTLSConfig returns the TLS configuration of the connections to the decoder
+func (s *Server) decoderTLSConfig() *tls.Config {
+	return &tls.Config{
+		InsecureSkipVerify: s.config.DecoderInsecureSkipVerify,
+		RootCAs:            s.decoderRootCAs(),
+		ServerName:         s.config.DecoderTLSServerName,
+		MinVersion:         tls.VersionTLS12,
+		CipherSuites: []uint16{
+			tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256,
+			tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384,
+			tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256,
+			tls.TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384,
+			tls.TLS_ECDHE_RSA_WITH_CHACHA20_POLY1305,
+			tls.TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305,
+		},
+	}
 }
 
 func (s *Server) prefillerProxyHandler(hostPort string) (http.Handler, error) {
@@ -294,10 +1046,27 @@ func (s *Server) prefillerProxyHandler(hostPort string) (http.Handler, error) {
 	}
 
 	newProxy := httputil.NewSingleHostReverseProxy(u)
-	if u.Scheme == "https" {
+	newProxy.ErrorHandler = s.prefillerErrorHandler
+	if s.config.PrefillerDNSRefreshInterval > 0 && net.ParseIP(u.Hostname()) == nil {
+		resolver := newHostResolver(u.Hostname(), u.Port(), s.config.PrefillerDNSRefreshInterval, s.lookupHost)
+		director := newProxy.Director
+		newProxy.Director = func(req *http.Request) {
+			director(req)
+			req.URL.Host = resolver.next(req.Context())
+		}
+	}
+	if s.config.PrefillerTransport != nil {
+		newProxy.Transport = s.config.PrefillerTransport
+	} else if u.Scheme == "https" && s.spiffeAuthorizer != nil {
+		newProxy.Transport = &http.Transport{
+			TLSClientConfig: s.spiffeClientTLSConfig(),
+		}
+	} else if u.Scheme == "https" {
 		newProxy.Transport = &http.Transport{
 			TLSClientConfig: &tls.Config{
 				InsecureSkipVerify: s.config.PrefillerInsecureSkipVerify,
+				RootCAs:            s.prefillerRootCAs(),
+				ServerName:         u.Hostname(),
 				MinVersion:         tls.VersionTLS12,
 				CipherSuites: []uint16{
 					tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256,
@@ -314,3 +1083,57 @@ func (s *Server) prefillerProxyHandler(hostPort string) (http.Handler, error) {
 
 	return newProxy, nil
 }
+
+// PrefillerFlush reports what was flushed from the prefiller caches of a proxy
+type PrefillerFlush struct {
+	Rank             int `json:"rank"`
+	PrefillerProxies int `json:"prefillerProxies"`
+	PrefillCache     int `json:"prefillCache"`
+	AllowlistTargets int `json:"allowlistTargets"`
+}
+
+// FlushPrefillers drops the cached prefiller proxies with their idle connections and DNS
+// resolutions, and the cached prefill responses, then rebuilds the allowlist. Otherwise
+// stale connections to replaced prefillers persist until evicted.
+func (s *Server) FlushPrefillers() PrefillerFlush {
+	flush := PrefillerFlush{
+		Rank:             s.config.DataParallelRank,
+		PrefillerProxies: s.flushPrefillerProxies(),
+	}
+	if s.prefillCache != nil {
+		flush.PrefillCache = s.prefillCache.purge()
+	}
+	flush.AllowlistTargets = s.allowlistValidator.Rebuild()
+	return flush
+}
+
+// flushPrefillerProxies drops the cached prefiller proxies and closes their idle connections.
+// It returns the number of proxies dropped.
+func (s *Server) flushPrefillerProxies() int {
+	count := 0
+	closeDefaultTransport := false
+	for _, hostPort := range s.prefillerProxies.Keys() {
+		handler, ok := s.prefillerProxies.Peek(hostPort)
+		if !ok || !s.prefillerProxies.Remove(hostPort) {
+			continue
+		}
+		count++
+
+		proxy, ok := handler.(*httputil.ReverseProxy)
+		if !ok {
+			continue
+		}
+		if proxy.Transport == nil {
+			closeDefaultTransport = true
+		} else if transport, ok := proxy.Transport.(interface{ CloseIdleConnections() }); ok {
+			transport.CloseIdleConnections()
+		}
+	}
+	// the plain HTTP prefiller proxies share the default transport
+	if closeDefaultTransport {
+		if transport, ok := http.DefaultTransport.(*http.Transport); ok {
+			transport.CloseIdleConnections()
+		}
+	}
+	return count
+}
@@ -20,9 +20,11 @@ import (
 	"context"
 	"crypto/tls"
 	"io"
+	"net"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
+	"path/filepath"
 	"strings"
 	"time"
 
@@ -34,76 +36,97 @@ import (
 
 var _ = Describe("Reverse Proxy", func() {
 	When("x-prefiller-url is not present", func() {
-		DescribeTable("should forward requests to decode server",
+		serve := func(method string, path string, secureProxy bool) int {
+			_, ctx := ktesting.NewTestContext(GinkgoT())
 
-			func(path string, secureProxy bool) {
-				_, ctx := ktesting.NewTestContext(GinkgoT())
+			ackHandlerFn := http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+				w.WriteHeader(200)
+			})
 
-				ackHandlerFn := http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
-					w.WriteHeader(200)
-				})
+			decodeBackend := httptest.NewServer(ackHandlerFn)
+			defer decodeBackend.Close()
 
-				decodeBackend := httptest.NewServer(ackHandlerFn)
-				defer decodeBackend.Close()
+			targetURL, err := url.Parse(decodeBackend.URL)
+			Expect(err).ToNot(HaveOccurred())
 
-				targetURL, err := url.Parse(decodeBackend.URL)
-				Expect(err).ToNot(HaveOccurred())
+			cfg := Config{SecureProxy: secureProxy}
+			proxy, err := NewProxy("0", targetURL, cfg) // port 0 to automatically choose one that's available.
+			Expect(err).ToNot(HaveOccurred())
 
-				cfg := Config{SecureProxy: secureProxy}
-				proxy, err := NewProxy("0", targetURL, cfg) // port 0 to automatically choose one that's available.
+			ctx, cancelFn := context.WithCancel(ctx)
+			defer cancelFn()
+
+			go func() {
+				defer GinkgoRecover()
+
+				err := proxy.Start(ctx)
 				Expect(err).ToNot(HaveOccurred())
+			}()
 
-				ctx, cancelFn := context.WithCancel(ctx)
-				defer cancelFn()
+			// the TLS certificate is generated before listening
+			Eventually(proxy.Addr).WithTimeout(10 * time.Second).ShouldNot(BeNil())
 
-				go func() {
-					defer GinkgoRecover()
+			tr := &http.Transport{
+				TLSClientConfig: &tls.Config{
+					InsecureSkipVerify: true, // Skip certificate verification
+				},
+			}
+			client := &http.Client{
+				Transport: tr,
+				Timeout:   10 * time.Second,
+			}
 
-					err := proxy.Start(ctx)
-					Expect(err).ToNot(HaveOccurred())
-				}()
+			proxyAddr := proxy.Addr().String() + path
+			if secureProxy {
+				proxyAddr = "https://" + proxyAddr
+			} else {
+				proxyAddr = "http://" + proxyAddr
+			}
+			req, err := http.NewRequest(method, proxyAddr, nil)
+			Expect(err).ToNot(HaveOccurred())
+			resp, err := client.Do(req)
+			Expect(err).ToNot(HaveOccurred())
 
-				time.Sleep(1 * time.Second)
-				Expect(proxy.addr).ToNot(BeNil())
-
-				tr := &http.Transport{
-					TLSClientConfig: &tls.Config{
-						InsecureSkipVerify: true, // Skip certificate verification
-					},
-				}
-				client := &http.Client{
-					Transport: tr,
-					Timeout:   10 * time.Second,
-				}
-
-				proxyAddr := proxy.addr.String() + path
-				if secureProxy {
-					proxyAddr = "https://" + proxyAddr
-				} else {
-					proxyAddr = "http://" + proxyAddr
-				}
-				resp, err := client.Get(proxyAddr)
-				Expect(err).ToNot(HaveOccurred())
+			_, err = io.ReadAll(resp.Body)
+			Expect(err).ToNot(HaveOccurred())
+			err = resp.Body.Close()
+			Expect(err).ToNot(HaveOccurred())
 
-				_, err = io.ReadAll(resp.Body)
-				Expect(err).ToNot(HaveOccurred())
-				err = resp.Body.Close()
-				Expect(err).ToNot(HaveOccurred())
+			return resp.StatusCode
+		}
 
-				Expect(resp.StatusCode).To(BeNumerically("==", 200))
+		DescribeTable("should forward requests to decode server",
+
+			func(method string, path string, secureProxy bool) {
+				Expect(serve(method, path, secureProxy)).To(BeNumerically("==", 200))
 			},
 
-			Entry("when the path is /v1/chat/completions and secure proxy is false", "/v1/chat/completions", false),
-			Entry("when the path is /v1/completions and secure proxy is false", "/v1/completions", false),
-			Entry("when the path is /v1/embeddings and secure proxy is false", "/v1/embeddings", false),
-			Entry("when the path is /score and secure proxy is false", "/score", false),
-			Entry("when the path is /healthz and secure proxy is false", "/healthz", false),
-
-			Entry("when the path is /v1/chat/completions and secure proxy is true", "/v1/chat/completions", true),
-			Entry("when the path is /v1/completions and secure proxy is true", "/v1/completions", true),
-			Entry("when the path is /v1/embeddings and secure proxy is true", "/v1/embeddings", true),
-			Entry("when the path is /score and secure proxy is true", "/score", true),
-			Entry("when the path is /healthz and secure proxy is true", "/healthz", true),
+			Entry("when the path is /v1/models and secure proxy is false", http.MethodGet, "/v1/models", false),
+			Entry("when the path is /v1/embeddings and secure proxy is false", http.MethodGet, "/v1/embeddings", false),
+			Entry("when the path is /score and secure proxy is false", http.MethodPost, "/score", false),
+			Entry("when the path is /healthz and secure proxy is false", http.MethodGet, "/healthz", false),
+
+			Entry("when the path is /v1/models and secure proxy is true", http.MethodGet, "/v1/models", true),
+			Entry("when the path is /v1/embeddings and secure proxy is true", http.MethodGet, "/v1/embeddings", true),
+			Entry("when the path is /score and secure proxy is true", http.MethodPost, "/score", true),
+			Entry("when the path is /healthz and secure proxy is true", http.MethodGet, "/healthz", true),
+		)
+
+		DescribeTable("should answer the other methods of the intercepted routes",
+
+			func(method string, path string, secureProxy bool, status int) {
+				Expect(serve(method, path, secureProxy)).To(Equal(status))
+			},
+
+			Entry("when GET is sent to /v1/chat/completions and secure proxy is false", http.MethodGet, "/v1/chat/completions", false, http.StatusMethodNotAllowed),
+			Entry("when OPTIONS is sent to /v1/chat/completions and secure proxy is false", http.MethodOptions, "/v1/chat/completions", false, http.StatusNoContent),
+			Entry("when GET is sent to /v1/completions and secure proxy is false", http.MethodGet, "/v1/completions", false, http.StatusMethodNotAllowed),
+			Entry("when OPTIONS is sent to /v1/completions and secure proxy is false", http.MethodOptions, "/v1/completions", false, http.StatusNoContent),
+
+			Entry("when GET is sent to /v1/chat/completions and secure proxy is true", http.MethodGet, "/v1/chat/completions", true, http.StatusMethodNotAllowed),
+			Entry("when OPTIONS is sent to /v1/chat/completions and secure proxy is true", http.MethodOptions, "/v1/chat/completions", true, http.StatusNoContent),
+			Entry("when GET is sent to /v1/completions and secure proxy is true", http.MethodGet, "/v1/completions", true, http.StatusMethodNotAllowed),
+			Entry("when OPTIONS is sent to /v1/completions and secure proxy is true", http.MethodOptions, "/v1/completions", true, http.StatusNoContent),
 		)
 	})
 
@@ -160,9 +183,8 @@ var _ = Describe("Reverse Proxy", func() {
 					Expect(err).ToNot(HaveOccurred())
 				}()
 
-				time.Sleep(1 * time.Second)
-				Expect(proxy.addr).ToNot(BeNil())
-				proxyBaseAddr := "http://" + proxy.addr.String()
+				Eventually(proxy.Addr).WithTimeout(10 * time.Second).ShouldNot(BeNil())
+				proxyBaseAddr := "http://" + proxy.Addr().String()
 
 				By("sending a /v1/chat/completions request with prefill header")
 				body := `{
@@ -211,9 +233,8 @@ var _ = Describe("Reverse Proxy", func() {
 					Expect(err).ToNot(HaveOccurred())
 				}()
 
-				time.Sleep(1 * time.Second)
-				Expect(proxy.addr).ToNot(BeNil())
-				proxyBaseAddr := "http://" + proxy.addr.String()
+				Eventually(proxy.Addr).WithTimeout(10 * time.Second).ShouldNot(BeNil())
+				proxyBaseAddr := "http://" + proxy.Addr().String()
 
 				By("sending a /v1/chat/completions request with prefill header")
 				body := `{
@@ -255,3 +276,23 @@ var _ = Describe("Reverse Proxy", func() {
 		})
 	})
 })
+
+var _ = Describe("Decoder socket", func() {
+	It("should forward requests to a decoder listening on a Unix domain socket", func() {
+		socket := filepath.Join(GinkgoT().TempDir(), "vllm.sock")
+		listener, err := net.Listen("unix", socket)
+		Expect(err).ToNot(HaveOccurred())
+		decodeBackend := httptest.NewUnstartedServer(&mock.GenericHandler{})
+		decodeBackend.Listener = listener
+		decodeBackend.Start()
+		DeferCleanup(decodeBackend.Close)
+
+		proxy, err := NewProxy("0", &url.URL{Scheme: "http", Host: "localhost"}, Config{DecoderSocket: socket})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(proxy.decoderAddress()).To(Equal("unix:" + socket))
+
+		rec := httptest.NewRecorder()
+		proxy.localDecoderProxy.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/v1/models", nil))
+		Expect(rec.Code).To(Equal(http.StatusOK))
+	})
+})
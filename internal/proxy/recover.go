@@ -0,0 +1,86 @@
+/*
+Copyright 2025 The llm-d Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package proxy
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"runtime"
+	"runtime/debug"
+	"strings"
+	"sync"
+
+	"github.com/llm-d/llm-d-routing-sidecar/internal/metrics"
+)
+
+// panicSites are the locations of the panics already logged with their stack trace
+var panicSites sync.Map
+
+// recoverPanics turns the panics of the handlers into 500 responses quoting the request ID,
+// so a malformed request cannot crash the sidecar and the streams in flight. The panics are
+// counted and logged with the stack trace the first time they occur at a location. Responses
+// already started are aborted instead.
+func (s *Server) recoverPanics(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer func() {
+			p := recover()
+			if p == nil {
+				return
+			}
+			if err, ok := p.(error); ok && errors.Is(err, http.ErrAbortHandler) {
+				panic(p) // aborted response, e.g. a failed stream
+			}
+
+			route := routeLabel(r.Pattern)
+			metrics.RecordPanic(s.rank(), route)
+			logger := s.logger.WithValues("route", route, "requestID", contextRequestID(r.Context()))
+			if site := panicSite(); site != "" {
+				if _, logged := panicSites.LoadOrStore(site, true); !logged {
+					logger = logger.WithValues("stack", string(debug.Stack()))
+				}
+			}
+			logger.Error(fmt.Errorf("%v", p), "recovered panic in request handler")
+
+			if rec, ok := w.(*statusRecorder); ok && rec.statusCode != 0 {
+				panic(http.ErrAbortHandler)
+			}
+			if err := errorStatus(http.StatusInternalServerError, "internal server error", w); err != nil {
+				s.logger.Error(err, "failed to send error response to client")
+			}
+		}()
+		next.ServeHTTP(w, r)
+	})
+}
+
+// panicSite returns the location of the function which panicked, called by the deferred
+// function recovering the panic
+func panicSite() string {
+	pcs := make([]uintptr, 32)
+	frames := runtime.CallersFrames(pcs[:runtime.Callers(2, pcs)])
+	panicked := false
+	for {
+		frame, more := frames.Next()
+		if panicked && !strings.HasPrefix(frame.Function, "runtime.") {
+			return fmt.Sprintf("%s:%d", frame.File, frame.Line)
+		}
+		panicked = panicked || frame.Function == "runtime.gopanic"
+		if !more {
+			return ""
+		}
+	}
+}
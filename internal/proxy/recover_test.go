@@ -0,0 +1,133 @@
+/*
+Copyright 2025 The llm-d Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package proxy
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+
+	"github.com/go-logr/logr/funcr"
+	. "github.com/onsi/ginkgo/v2" // nolint:revive
+	. "github.com/onsi/gomega"    // nolint:revive
+
+	"github.com/llm-d/llm-d-routing-sidecar/internal/metrics"
+)
+
+var _ = Describe("Panic recovery", func() {
+	const rank = 50
+
+	var (
+		mu      sync.Mutex
+		logs    []string
+		handler http.Handler
+		panics  func() float64
+	)
+
+	BeforeEach(func() {
+		logs = nil
+		panicSites.Clear()
+		s, err := NewProxy("0", &url.URL{Scheme: "http", Host: "localhost:8001"}, Config{DataParallelRank: rank})
+		Expect(err).ToNot(HaveOccurred())
+		s.logger = funcr.New(func(prefix, args string) {
+			mu.Lock()
+			defer mu.Unlock()
+			logs = append(logs, args)
+		}, funcr.Options{})
+
+		mux := http.NewServeMux()
+		mux.HandleFunc("POST "+CompletionsPath, func(http.ResponseWriter, *http.Request) {
+			var choices []string
+			_ = choices[1] // a malformed request
+		})
+		mux.HandleFunc("POST "+ChatCompletionsPath, func(w http.ResponseWriter, _ *http.Request) {
+			w.WriteHeader(http.StatusOK)
+			w.Write([]byte("data: {}\n\n")) //nolint:all
+			panic("stream failed")
+		})
+		mux.HandleFunc("GET /abort", func(http.ResponseWriter, *http.Request) {
+			panic(http.ErrAbortHandler)
+		})
+		handler = referenceRequests(instrumentHandler(s.rank(), nil, s.recoverPanics(mux)))
+
+		panics = func() float64 {
+			families, err := metrics.Registry.Gather()
+			Expect(err).ToNot(HaveOccurred())
+			for _, family := range families {
+				if family.GetName() != "llm_d_routing_sidecar_panics_total" {
+					continue
+				}
+				for _, metric := range family.Metric {
+					labels := map[string]string{}
+					for _, label := range metric.Label {
+						labels[label.GetName()] = label.GetValue()
+					}
+					if labels[metrics.RankLabel] == "50" && labels["route"] == CompletionsPath {
+						return metric.GetCounter().GetValue()
+					}
+				}
+			}
+			return 0
+		}
+	})
+
+	serve := func(method string, path string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(`{}`))
+		req.Header.Set(requestHeaderRequestID, "req-1")
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		return w
+	}
+
+	It("should answer 500 with the request ID", func() {
+		before := panics()
+
+		w := serve(http.MethodPost, CompletionsPath)
+		Expect(w.Code).To(Equal(http.StatusInternalServerError))
+		var er errorResponse
+		Expect(json.Unmarshal(w.Body.Bytes(), &er)).To(Succeed())
+		Expect(er.Code).To(Equal(http.StatusInternalServerError))
+		Expect(er.RequestID).To(Equal("req-1"))
+		Expect(er.Message).ToNot(ContainSubstring("index out of range"))
+
+		Expect(panics()).To(Equal(before + 1))
+	})
+
+	It("should log the stack trace of a panic location once", func() {
+		serve(http.MethodPost, CompletionsPath)
+		serve(http.MethodPost, CompletionsPath)
+
+		Expect(logs).To(HaveLen(2))
+		Expect(logs[0]).To(ContainSubstring("index out of range"))
+		Expect(logs[0]).To(ContainSubstring(`"requestID"="req-1"`))
+		Expect(logs[0]).To(ContainSubstring(`"stack"`))
+		Expect(logs[1]).To(ContainSubstring("index out of range"))
+		Expect(logs[1]).ToNot(ContainSubstring(`"stack"`))
+	})
+
+	It("should abort the responses already started", func() {
+		Expect(func() { serve(http.MethodPost, ChatCompletionsPath) }).To(PanicWith(http.ErrAbortHandler))
+	})
+
+	It("should keep aborting the aborted responses", func() {
+		Expect(func() { serve(http.MethodGet, "/abort") }).To(PanicWith(http.ErrAbortHandler))
+		Expect(logs).To(BeEmpty())
+	})
+})
@@ -0,0 +1,137 @@
+/*
+Copyright 2025 The llm-d Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package proxy
+
+import (
+	"errors"
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+// drainPollInterval is how often a replaced configuration is checked for requests still in flight
+const drainPollInterval = time.Second
+
+// generation is the request routing of a configuration, replaced when the configuration is reloaded
+type generation struct {
+	server   *Server      // the proxy configured with the routing settings
+	handler  http.Handler // the routes of the configuration
+	inflight atomic.Int64 // requests still handled with the configuration
+}
+
+func (g *generation) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	g.inflight.Add(1)
+	defer g.inflight.Add(-1)
+	g.handler.ServeHTTP(w, r)
+}
+
+// routes returns the handler of the proxy routes, also running the batch items
+func (s *Server) routes() http.Handler {
+	mux := s.createRoutes()
+	s.routed = s.authenticateCallers(s.middlewareHandler(s.healthGate(mux, s.sleepGate(mux))))
+	return s.routed
+}
+
+// routingHandler routes each request with the current configuration
+func (s *Server) routingHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.routing.Load().ServeHTTP(w, r)
+	})
+}
+
+// current returns the proxy configured with the current routing settings
+func (s *Server) current() *Server {
+	if g := s.routing.Load(); g != nil {
+		return g.server
+	}
+	return s
+}
+
+// Reload replaces the routing settings of the proxy, listed by routingSettings, such as the
+// connector, the prefill overrides, the routing policy, the middlewares and the timeouts. New requests are
+// routed with the new configuration while the requests in flight complete with the previous
+// one. The other settings, applied when the proxy started, such as the listeners, TLS, SPIFFE,
+// SSRF protection and the caches, are kept. The previous configuration is kept on error.
+func (s *Server) Reload(config Config) error {
+	if s.routing.Load() == nil {
+		return errors.New("the proxy is not started")
+	}
+
+	// the new configuration shares the state of the proxy
+	server := *s
+	server.config = routingSettings(s.config, config)
+	if err := server.configureRouting(); err != nil {
+		return err
+	}
+
+	previous := s.routing.Swap(&generation{server: &server, handler: server.routes()})
+	s.logger.Info("configuration reloaded", "connector", server.config.Connector)
+	if previous != nil {
+		go s.drain(previous)
+	}
+	return nil
+}
+
+// routingSettings returns the startup configuration with the routing settings of a reloaded
+// configuration, the only settings applied by a reload
+func routingSettings(startup Config, reloaded Config) Config {
+	config := startup
+	config.Connector = reloaded.Connector
+	config.ExperimentConnector = reloaded.ExperimentConnector
+	config.ExperimentConnectorWeight = reloaded.ExperimentConnectorWeight
+	config.Passthrough = reloaded.Passthrough
+	config.PassthroughPaths = reloaded.PassthroughPaths
+	config.PrefillOverrides = reloaded.PrefillOverrides
+	config.PrefillStripFields = reloaded.PrefillStripFields
+	config.PrefillBypassTokens = reloaded.PrefillBypassTokens
+	config.RoutingPolicy = reloaded.RoutingPolicy
+	config.RoutingPolicyURL = reloaded.RoutingPolicyURL
+	config.Middlewares = reloaded.Middlewares
+	config.MaxRequestBodyBytes = reloaded.MaxRequestBodyBytes
+	config.SpillThresholdBytes = reloaded.SpillThresholdBytes
+	config.MultimodalDecodeOnly = reloaded.MultimodalDecodeOnly
+	config.AudioModelRoutes = reloaded.AudioModelRoutes
+	config.ModelAliases = reloaded.ModelAliases
+	config.EnableSleepMode = reloaded.EnableSleepMode
+	config.SleepControlToken = reloaded.SleepControlToken
+	config.SleepRetryAfter = reloaded.SleepRetryAfter
+	config.DataParallelFailover = reloaded.DataParallelFailover
+	config.DataParallelHedgeDelay = reloaded.DataParallelHedgeDelay
+	config.CanaryDecoderPort = reloaded.CanaryDecoderPort
+	config.CanaryWeight = reloaded.CanaryWeight
+	config.CanarySessionHeader = reloaded.CanarySessionHeader
+	config.SlowPrefillThreshold = reloaded.SlowPrefillThreshold
+	config.SlowRequestThreshold = reloaded.SlowRequestThreshold
+	config.TenantHeader = reloaded.TenantHeader
+	config.TenantConcurrencyQuotas = reloaded.TenantConcurrencyQuotas
+	config.TenantModels = reloaded.TenantModels
+	config.RequestTimeout = reloaded.RequestTimeout
+	config.StreamIdleTimeout = reloaded.StreamIdleTimeout
+	config.StreamStallTimeout = reloaded.StreamStallTimeout
+	config.BatchItemTimeout = reloaded.BatchItemTimeout
+	return config
+}
+
+// drain waits for the requests handled with a replaced configuration to complete
+func (s *Server) drain(previous *generation) {
+	ticker := time.NewTicker(drainPollInterval)
+	defer ticker.Stop()
+	for previous.inflight.Load() > 0 {
+		<-ticker.C
+	}
+	s.logger.Info("previous configuration drained")
+}
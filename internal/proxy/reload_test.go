@@ -0,0 +1,241 @@
+/*
+Copyright 2025 The llm-d Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package proxy
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/llm-d/llm-d-routing-sidecar/pkg/middleware"
+	"github.com/llm-d/llm-d-routing-sidecar/test/mock"
+	. "github.com/onsi/ginkgo/v2" // nolint:revive
+	. "github.com/onsi/gomega"    // nolint:revive
+	"k8s.io/klog/v2/ktesting"
+)
+
+var _ = Describe("Configuration reload", func() {
+	var (
+		ctx            context.Context
+		decodeHandler  *mock.ChatCompletionHandler
+		prefillHandler *mock.ChatCompletionHandler
+		prefillHost    string
+		decodeURL      *url.URL
+		release        chan struct{} // holds the decode requests until closed, when set
+	)
+
+	BeforeEach(func() {
+		_, ctx = ktesting.NewTestContext(GinkgoT())
+		var cancelFn context.CancelFunc
+		ctx, cancelFn = context.WithCancel(ctx)
+		DeferCleanup(cancelFn)
+
+		release = nil
+		decodeHandler = &mock.ChatCompletionHandler{Connector: ConnectorNIXLV2, Role: mock.RoleDecode}
+		decodeBackend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if release != nil {
+				<-release
+			}
+			decodeHandler.ServeHTTP(w, r)
+		}))
+		DeferCleanup(decodeBackend.Close)
+
+		prefillHandler = &mock.ChatCompletionHandler{Connector: ConnectorNIXLV2, Role: mock.RolePrefill}
+		prefillBackend := httptest.NewServer(prefillHandler)
+		DeferCleanup(prefillBackend.Close)
+		prefillHost = prefillBackend.URL[len("http://"):]
+
+		var err error
+		decodeURL, err = url.Parse(decodeBackend.URL)
+		Expect(err).ToNot(HaveOccurred())
+	})
+
+	startProxy := func(config Config) *Server {
+		proxy, err := NewProxy("0", decodeURL, config)
+		Expect(err).ToNot(HaveOccurred())
+
+		go func() {
+			defer GinkgoRecover()
+			Expect(proxy.Start(ctx)).To(Succeed())
+		}()
+		time.Sleep(1 * time.Second)
+		Expect(proxy.Addr()).ToNot(BeNil())
+		return proxy
+	}
+
+	sendRequest := func(proxy *Server, tenant string) int {
+		body := `{"model": "llama", "prompt": "Hello", "max_tokens": 10}`
+		req, err := http.NewRequest(http.MethodPost, "http://"+proxy.Addr().String()+CompletionsPath, strings.NewReader(body))
+		Expect(err).ToNot(HaveOccurred())
+		req.Header.Add(requestHeaderPrefillHostPort, prefillHost)
+		if tenant != "" {
+			req.Header.Set("X-Tenant", tenant)
+		}
+
+		resp, err := http.DefaultClient.Do(req)
+		Expect(err).ToNot(HaveOccurred())
+		resp.Body.Close() //nolint:all
+		return resp.StatusCode
+	}
+
+	It("should route new requests with the reloaded configuration", func() {
+		proxy := startProxy(Config{Connector: ConnectorNIXLV2})
+		Expect(sendRequest(proxy, "")).To(Equal(http.StatusOK))
+		Expect(prefillHandler.RequestCount.Load()).To(BeNumerically("==", 1))
+
+		Expect(proxy.Reload(Config{
+			Connector:     ConnectorNIXLV2,
+			RoutingPolicy: `"decode"`,
+			Middlewares:   []middleware.Middleware{&tenantMiddleware{}},
+		})).To(Succeed())
+
+		Expect(sendRequest(proxy, "")).To(Equal(http.StatusUnauthorized))
+		Expect(sendRequest(proxy, "acme")).To(Equal(http.StatusOK))
+		Expect(prefillHandler.RequestCount.Load()).To(BeNumerically("==", 1))
+	})
+
+	It("should keep the settings applied at startup", func() {
+		proxy := startProxy(Config{Connector: ConnectorNIXLV2, EnableSSRFProtection: false, TokenizeCacheSize: 8})
+
+		Expect(proxy.Reload(Config{Connector: ConnectorNIXLV1, TokenizeCacheSize: 0, DataParallelRank: 3})).To(Succeed())
+
+		current := proxy.current()
+		Expect(current).ToNot(BeIdenticalTo(proxy))
+		Expect(current.config.Connector).To(Equal(ConnectorNIXLV1))
+		Expect(current.config.TokenizeCacheSize).To(Equal(8))
+		Expect(current.config.DataParallelRank).To(Equal(0))
+		Expect(current.tokenizeCache).To(BeIdenticalTo(proxy.tokenizeCache))
+		Expect(current.sleeping).To(BeIdenticalTo(proxy.sleeping))
+		Expect(proxy.State().Connector).To(Equal(ConnectorNIXLV1))
+	})
+
+	It("should only reload the routing settings", func() {
+		proxy := startProxy(Config{
+			Connector:             ConnectorNIXLV2,
+			SpillDir:              GinkgoT().TempDir(),
+			RequestTimeout:        time.Minute,
+			StreamErrorEvents:     true,
+			DecodeReplay:          true,
+			AccessLog:             true,
+			InjectStreamUsage:     true,
+			EngineResponseHeaders: true,
+			EnableBatchAPI:        true,
+			BatchItemTimeout:      time.Minute,
+			PrefillCacheSize:      8,
+			PrefillCacheTTL:       time.Minute,
+		})
+
+		Expect(proxy.Reload(Config{
+			Connector:          ConnectorNIXLV1,
+			RoutingPolicy:      `"decode"`,
+			CanaryWeight:       10,
+			TenantHeader:       "X-Tenant",
+			RequestTimeout:     2 * time.Minute,
+			StreamStallTimeout: time.Minute,
+		})).To(Succeed())
+
+		expected := proxy.config
+		expected.Connector = ConnectorNIXLV1
+		expected.RoutingPolicy = `"decode"`
+		expected.CanaryWeight = 10
+		expected.TenantHeader = "X-Tenant"
+		expected.RequestTimeout = 2 * time.Minute
+		expected.StreamStallTimeout = time.Minute
+		expected.BatchItemTimeout = 0
+		current := proxy.current()
+		Expect(current.config).To(Equal(expected))
+		Expect(current.prefillCache).To(BeIdenticalTo(proxy.prefillCache))
+		Expect(current.batches).To(BeIdenticalTo(proxy.batches))
+		Expect(current.inflight).To(BeIdenticalTo(proxy.inflight))
+		Expect(current.Addr()).To(Equal(proxy.Addr()))
+		Expect(current.policy).ToNot(BeNil())
+	})
+
+	It("should apply the reloaded timeouts to new requests", func() {
+		release = make(chan struct{})
+		DeferCleanup(func() { close(release) })
+		proxy := startProxy(Config{Connector: ConnectorNIXLV2})
+
+		Expect(proxy.Reload(Config{Connector: ConnectorNIXLV2, RequestTimeout: 200 * time.Millisecond})).To(Succeed())
+
+		Expect(sendRequest(proxy, "")).To(Equal(http.StatusGatewayTimeout))
+	})
+
+	It("should keep the previous configuration when the reload fails", func() {
+		proxy := startProxy(Config{Connector: ConnectorNIXLV2})
+
+		Expect(proxy.Reload(Config{Connector: ConnectorNIXLV2, RoutingPolicy: `"decode" +`})).ToNot(Succeed())
+		Expect(proxy.Reload(Config{Connector: ConnectorNIXLV2, EnableSleepMode: true})).ToNot(Succeed())
+
+		Expect(proxy.current()).To(BeIdenticalTo(proxy))
+		Expect(sendRequest(proxy, "")).To(Equal(http.StatusOK))
+		Expect(prefillHandler.RequestCount.Load()).To(BeNumerically("==", 1))
+	})
+
+	It("should complete the requests in flight with the previous configuration", func() {
+		proxy := startProxy(Config{Connector: ConnectorNIXLV2})
+		release = make(chan struct{})
+
+		done := make(chan int)
+		go func() {
+			defer GinkgoRecover()
+			done <- sendRequest(proxy, "")
+		}()
+		Eventually(prefillHandler.RequestCount.Load).Should(BeNumerically("==", 1))
+
+		Expect(proxy.Reload(Config{
+			Connector:   ConnectorNIXLV2,
+			Middlewares: []middleware.Middleware{&tenantMiddleware{}},
+		})).To(Succeed())
+		Expect(sendRequest(proxy, "")).To(Equal(http.StatusUnauthorized))
+
+		close(release)
+		Eventually(done).Should(Receive(Equal(http.StatusOK)))
+	})
+
+	It("should apply the reloaded tenant quotas to the requests in flight", func() {
+		proxy := startProxy(Config{Connector: ConnectorNIXLV2, TenantHeader: "X-Tenant"})
+		release = make(chan struct{})
+
+		done := make(chan int)
+		go func() {
+			defer GinkgoRecover()
+			done <- sendRequest(proxy, "acme")
+		}()
+		Eventually(prefillHandler.RequestCount.Load).Should(BeNumerically("==", 1))
+
+		Expect(proxy.Reload(Config{
+			Connector:               ConnectorNIXLV2,
+			TenantHeader:            "X-Tenant",
+			TenantConcurrencyQuotas: map[string]int{"acme": 1},
+		})).To(Succeed())
+		Expect(sendRequest(proxy, "acme")).To(Equal(http.StatusTooManyRequests))
+
+		close(release)
+		Eventually(done).Should(Receive(Equal(http.StatusOK)))
+		Expect(sendRequest(proxy, "acme")).To(Equal(http.StatusOK))
+	})
+
+	It("should fail to reload a proxy not started", func() {
+		proxy, err := NewProxy("0", decodeURL, Config{Connector: ConnectorNIXLV2})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(proxy.Reload(Config{Connector: ConnectorNIXLV1})).ToNot(Succeed())
+	})
+})
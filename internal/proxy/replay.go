@@ -0,0 +1,88 @@
+/*
+Copyright 2025 The llm-d Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package proxy
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"syscall"
+
+	"github.com/llm-d/llm-d-routing-sidecar/internal/metrics"
+)
+
+// Decoders a request is replayed on, as metrics label values
+const (
+	replayTargetLocal   = "local"
+	replayTargetSibling = "sibling"
+)
+
+type replayKey struct{}
+
+// replayAttempt is the first attempt of a replayable decode request
+type replayAttempt struct {
+	reset error // the connection reset answered by the decoder, nil otherwise
+}
+
+// decodeWithReplay sends a non-streaming decode-only request to the decoder, and replays it
+// once, on a healthy sibling rank if any, when the decoder connection is reset before any
+// response. Disaggregated decodes are never replayed since the prefilled KV blocks are pulled
+// once.
+func (s *Server) decodeWithReplay(w http.ResponseWriter, r *http.Request, body []byte) {
+	attempt := &replayAttempt{}
+	s.decoderProxy.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), replayKey{}, attempt)))
+	if attempt.reset == nil {
+		return
+	}
+
+	// bounded by the request deadline
+	if r.Context().Err() != nil {
+		s.failUpstream(w, upstreamDecoder, classifyUpstreamError(r.Context(), attempt.reset))
+		return
+	}
+
+	target, label, replayed := s.decoderProxy, replayTargetLocal, traceRank(s)
+	if sibling := s.healthySibling(); sibling != nil {
+		target, label, replayed = sibling.localDecoderProxy, replayTargetSibling, traceRank(sibling)
+	}
+	traceFallback(r.Context(), "decoder connection reset, replayed on "+replayed)
+	s.logger.V(4).Info("decoder connection reset, replaying the request", "error", attempt.reset.Error(), "target", label)
+	metrics.RecordDecodeReplay(s.rank(), label)
+
+	req := r.Clone(r.Context())
+	setRequestBody(req, io.NopCloser(bytes.NewReader(body)), len(body))
+	target.ServeHTTP(w, req)
+}
+
+// replayConnectionReset reports whether the error of a decoder request is a connection reset
+// to be replayed, in which case nothing is written to the client
+func replayConnectionReset(req *http.Request, err error) bool {
+	attempt, ok := req.Context().Value(replayKey{}).(*replayAttempt)
+	if !ok || !isConnectionReset(err) {
+		return false
+	}
+	attempt.reset = err
+	return true
+}
+
+// isConnectionReset reports whether the decoder closed the connection before answering
+func isConnectionReset(err error) bool {
+	return errors.Is(err, syscall.ECONNRESET) || errors.Is(err, syscall.EPIPE) ||
+		errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF)
+}
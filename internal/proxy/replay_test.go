@@ -0,0 +1,140 @@
+/*
+Copyright 2025 The llm-d Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package proxy
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync/atomic"
+
+	"github.com/llm-d/llm-d-routing-sidecar/internal/metrics"
+	. "github.com/onsi/ginkgo/v2" // nolint:revive
+	. "github.com/onsi/gomega"    // nolint:revive
+	"k8s.io/klog/v2/ktesting"
+)
+
+var _ = Describe("Decode replay", func() {
+	// resettingDecoder resets the connection of the first requests, then answers them
+	resettingDecoder := func(resets int32) (*httptest.Server, *atomic.Int32) {
+		calls := new(atomic.Int32)
+		decoder := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+			if calls.Add(1) <= resets {
+				conn, _, err := http.NewResponseController(w).Hijack()
+				Expect(err).ToNot(HaveOccurred())
+				conn.Close() //nolint:all
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte(`{"choices":[{"text":"Hi"}]}`)) //nolint:all
+		}))
+		DeferCleanup(decoder.Close)
+		return decoder, calls
+	}
+
+	startProxies := func(decoders ...*httptest.Server) []*Server {
+		_, ctx := ktesting.NewTestContext(GinkgoT())
+		ctx, cancelFn := context.WithCancel(ctx)
+		DeferCleanup(cancelFn)
+
+		servers := make([]*Server, 0, len(decoders))
+		for rank, decoder := range decoders {
+			decodeURL, err := url.Parse(decoder.URL)
+			Expect(err).ToNot(HaveOccurred())
+			proxy, err := NewProxy("0", decodeURL, Config{Connector: ConnectorNIXLV2, DecodeReplay: true, DataParallelRank: 46 + rank})
+			Expect(err).ToNot(HaveOccurred())
+			servers = append(servers, proxy)
+		}
+		LinkDataParallelRanks(servers...)
+		for _, proxy := range servers {
+			go func() {
+				defer GinkgoRecover()
+				Expect(proxy.Start(ctx)).To(Succeed())
+			}()
+			Eventually(func() net.Addr { return proxy.Addr() }).ShouldNot(BeNil())
+		}
+		return servers
+	}
+
+	post := func(proxy *Server, body string) int {
+		resp, err := http.Post("http://"+proxy.Addr().String()+CompletionsPath, "application/json", strings.NewReader(body))
+		Expect(err).ToNot(HaveOccurred())
+		resp.Body.Close() //nolint:all
+		return resp.StatusCode
+	}
+
+	replays := func(target string) float64 {
+		families, err := metrics.Registry.Gather()
+		Expect(err).ToNot(HaveOccurred())
+		for _, family := range families {
+			if family.GetName() != "llm_d_routing_sidecar_decode_replays_total" {
+				continue
+			}
+			for _, metric := range family.Metric {
+				labels := map[string]string{}
+				for _, label := range metric.Label {
+					labels[label.GetName()] = label.GetValue()
+				}
+				if labels[metrics.RankLabel] == "46" && labels["target"] == target {
+					return metric.GetCounter().GetValue()
+				}
+			}
+		}
+		return 0
+	}
+
+	It("should replay the reset requests once on the decoder", func() {
+		decoder, calls := resettingDecoder(1)
+		proxies := startProxies(decoder)
+		before := replays(replayTargetLocal)
+
+		Expect(post(proxies[0], `{"model": "m", "prompt": "Hello"}`)).To(Equal(http.StatusOK))
+		Expect(calls.Load()).To(Equal(int32(2)))
+		Expect(replays(replayTargetLocal)).To(Equal(before + 1))
+	})
+
+	It("should fail the requests reset twice", func() {
+		decoder, calls := resettingDecoder(2)
+		proxies := startProxies(decoder)
+
+		Expect(post(proxies[0], `{"model": "m", "prompt": "Hello"}`)).To(Equal(http.StatusBadGateway))
+		Expect(calls.Load()).To(Equal(int32(2)))
+	})
+
+	It("should not replay the streaming requests", func() {
+		decoder, calls := resettingDecoder(1)
+		proxies := startProxies(decoder)
+
+		Expect(post(proxies[0], `{"model": "m", "prompt": "Hello", "stream": true}`)).To(Equal(http.StatusBadGateway))
+		Expect(calls.Load()).To(Equal(int32(1)))
+	})
+
+	It("should replay the reset requests on a sibling rank", func() {
+		decoder, calls := resettingDecoder(1)
+		sibling, siblingCalls := resettingDecoder(0)
+		proxies := startProxies(decoder, sibling)
+		before := replays(replayTargetSibling)
+
+		Expect(post(proxies[0], `{"model": "m", "prompt": "Hello"}`)).To(Equal(http.StatusOK))
+		Expect(calls.Load()).To(Equal(int32(1)))
+		Expect(siblingCalls.Load()).To(Equal(int32(1)))
+		Expect(replays(replayTargetSibling)).To(Equal(before + 1))
+	})
+})
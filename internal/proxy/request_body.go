@@ -0,0 +1,227 @@
+/*
+Copyright 2025 The llm-d Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package proxy
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+const (
+	// maxJSONDepth bounds the nesting of the parsed JSON bodies, far beyond the JSON schemas
+	// of structured outputs
+	maxJSONDepth = 128
+
+	// maxRequestFields bounds the number of top-level fields of the request bodies
+	maxRequestFields = 1024
+)
+
+var errNotJSONObject = errors.New("request body must be a JSON object")
+
+// decodeRequestBody parses the top-level fields of a request body. The values are kept
+// as raw JSON so nested objects are forwarded byte for byte: re-encoding them would sort
+// the keys of JSON schemas (changing the order of structured outputs and tool call
+// arguments) and round large integers such as seeds. Bodies other than objects, nested
+// deeper than maxJSONDepth or with more than maxRequestFields fields are rejected.
+func decodeRequestBody(body []byte) (map[string]any, error) {
+	fields, err := decodeFields(body)
+	if err != nil {
+		return nil, err
+	}
+	return copyFields(fields)
+}
+
+// decodeFields parses the top-level fields of a JSON object, nested at most maxJSONDepth deep
+func decodeFields(body []byte) (map[string]json.RawMessage, error) {
+	if jsonKind(body) != '{' {
+		return nil, errNotJSONObject
+	}
+	if err := checkJSONDepth(body, maxJSONDepth); err != nil {
+		return nil, err
+	}
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(body, &fields); err != nil {
+		return nil, err
+	}
+	return fields, nil
+}
+
+// copyFields returns the top-level fields of a request body as a request the connectors and
+// the middlewares can change, rejecting the bodies with more than maxRequestFields fields
+func copyFields(fields map[string]json.RawMessage) (map[string]any, error) {
+	if len(fields) > maxRequestFields {
+		return nil, fmt.Errorf("request body has more than %d fields", maxRequestFields)
+	}
+	request := make(map[string]any, len(fields))
+	for name, value := range fields {
+		request[name] = value
+	}
+	return request, nil
+}
+
+// parsedRequest is a completion or chat completion request body parsed once by the handler,
+// and shared by its validation, its classification and the connectors, instead of each of them
+// parsing the body again. The top-level fields are kept as raw JSON, and the fields the proxy
+// reads are decoded.
+type parsedRequest struct {
+	fields map[string]json.RawMessage
+
+	model    string
+	stream   bool
+	prompt   any           // the prompt of a completion request
+	messages []any         // the messages of a chat completion request
+	chat     []chatMessage // the messages which are objects
+}
+
+// chatMessage is the role and content of a message of a chat completion request
+type chatMessage struct {
+	role    string
+	content any
+}
+
+// parseRequest parses the body of a completion or chat completion request. Bodies other than
+// objects or nested deeper than maxJSONDepth are rejected. The fields of unexpected types are
+// left empty, for the validation to report.
+func parseRequest(body []byte) (*parsedRequest, error) {
+	fields, err := decodeFields(body)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &parsedRequest{fields: fields}
+	p.model, _ = decodeString(fields[requestFieldModel])
+	p.stream = string(bytes.TrimSpace(fields[requestFieldStream])) == "true"
+	if raw, ok := fields[requestFieldPrompt]; ok {
+		json.Unmarshal(raw, &p.prompt) //nolint:all // valid JSON, as part of the body
+	}
+	if raw, ok := fields[requestFieldMessages]; ok && jsonKind(raw) == '[' {
+		json.Unmarshal(raw, &p.messages) //nolint:all
+	}
+	p.chat = make([]chatMessage, 0, len(p.messages))
+	for _, item := range p.messages {
+		if message, ok := item.(map[string]any); ok {
+			role, _ := message["role"].(string)
+			p.chat = append(p.chat, chatMessage{role: role, content: message["content"]})
+		}
+	}
+	return p, nil
+}
+
+// setField sets a top-level field of the request, to encode it again
+func (p *parsedRequest) setField(name string, value any) error {
+	raw, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	p.fields[name] = raw
+	return nil
+}
+
+// encode returns the request body with the fields set since it was parsed
+func (p *parsedRequest) encode() ([]byte, error) {
+	return json.Marshal(p.fields)
+}
+
+// requestFields returns the top-level fields of a completion request body for the connectors
+// and the middlewares to change, copied from the request parsed by the handler when available
+// rather than parsing the body again
+func requestFields(r *http.Request, body []byte) (map[string]any, error) {
+	if info := requestInfoFrom(r.Context()); info != nil && info.parsed != nil {
+		return copyFields(info.parsed.fields)
+	}
+	return decodeRequestBody(body)
+}
+
+// jsonKind returns the first byte of a JSON value, telling its type, or 0 when empty
+func jsonKind(data []byte) byte {
+	for _, c := range data {
+		switch c {
+		case ' ', '\t', '\n', '\r':
+		default:
+			return c
+		}
+	}
+	return 0
+}
+
+// checkJSONDepth rejects the JSON values nested deeper than limit, without decoding them,
+// so crafted bodies do not exhaust the memory or the stack of the decoders
+func checkJSONDepth(data []byte, limit int) error {
+	depth, inString, escaped := 0, false, false
+	for _, c := range data {
+		switch {
+		case escaped:
+			escaped = false
+		case inString:
+			escaped = c == '\\'
+			inString = c != '"'
+		case c == '"':
+			inString = true
+		case c == '{' || c == '[':
+			if depth++; depth > limit {
+				return fmt.Errorf("JSON value nested deeper than %d levels", limit)
+			}
+		case c == '}' || c == ']':
+			depth--
+		}
+	}
+	return nil
+}
+
+// readRequestBody reads a request body into a buffer sized from the content length, so
+// large (e.g. multimodal) bodies are not copied while growing. Bodies larger than
+// limit are rejected with an *http.MaxBytesError, unless limit is zero.
+func readRequestBody(w http.ResponseWriter, r *http.Request, limit int64) ([]byte, error) {
+	var buffer bytes.Buffer
+	if err := readRequestBodyInto(&buffer, w, r, limit); err != nil {
+		return nil, err
+	}
+	return buffer.Bytes(), nil
+}
+
+// setRequestBody sets the body of a request to an upstream, of known length. The request is
+// sent with its Content-Length even when the client request was chunked, as some ingress
+// proxies in front of the upstreams reject the chunked requests with 411 or 400.
+func setRequestBody(r *http.Request, body io.ReadCloser, length int) {
+	r.Body = body
+	r.ContentLength = int64(length)
+	r.TransferEncoding = nil
+}
+
+// readRequestBodyInto reads a request body as readRequestBody does, into the given buffer.
+// Bodies announced larger than limit are rejected without being read, so the clients waiting
+// for 100 Continue do not upload them.
+func readRequestBodyInto(buffer *bytes.Buffer, w http.ResponseWriter, r *http.Request, limit int64) error {
+	if limit > 0 && r.ContentLength > limit {
+		return &http.MaxBytesError{Limit: limit}
+	}
+
+	body := r.Body
+	if limit > 0 {
+		body = http.MaxBytesReader(w, r.Body, limit)
+	}
+
+	if r.ContentLength > 0 && (limit <= 0 || r.ContentLength <= limit) {
+		buffer.Grow(int(r.ContentLength) + bytes.MinRead)
+	}
+	_, err := buffer.ReadFrom(body)
+	return err
+}
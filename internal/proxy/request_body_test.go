@@ -0,0 +1,118 @@
+/*
+Copyright 2025 The llm-d Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package proxy
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+
+	. "github.com/onsi/ginkgo/v2" // nolint:revive
+	. "github.com/onsi/gomega"    // nolint:revive
+)
+
+// nestedJSON returns a JSON array nested depth times
+func nestedJSON(depth int) string {
+	return strings.Repeat("[", depth) + strings.Repeat("]", depth)
+}
+
+// mustParse parses a request body
+func mustParse(body string) *parsedRequest {
+	p, err := parseRequest([]byte(body))
+	Expect(err).ToNot(HaveOccurred())
+	return p
+}
+
+var _ = Describe("Request body limits", func() {
+	It("should decode the top-level fields of the requests", func() {
+		request, err := decodeRequestBody([]byte(` {"model": "m", "response_format": {"schema": ` + nestedJSON(maxJSONDepth-2) + `}}`))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(request).To(HaveKey("response_format"))
+	})
+
+	It("should parse the fields shared by the stages of a request", func() {
+		p := mustParse(`{"model": "m", "stream": true, "messages": [{"role": "user", "content": "Hello"}, "invalid"]}`)
+		Expect(p.model).To(Equal("m"))
+		Expect(p.stream).To(BeTrue())
+		Expect(p.messages).To(HaveLen(2))
+		Expect(p.chat).To(Equal([]chatMessage{{role: "user", content: "Hello"}}))
+
+		Expect(p.setField("model", "n")).To(Succeed())
+		Expect(p.encode()).To(MatchJSON(`{"model": "n", "stream": true, "messages": [{"role": "user", "content": "Hello"}, "invalid"]}`))
+	})
+
+	DescribeTable("should reject the crafted requests",
+		func(body string, message string) {
+			_, err := decodeRequestBody([]byte(body))
+			Expect(err).To(MatchError(ContainSubstring(message)))
+		},
+		Entry("when the body is null", `null`, "must be a JSON object"),
+		Entry("when the body is a list", `[{"model": "m"}]`, "must be a JSON object"),
+		Entry("when the body is empty", ``, "must be a JSON object"),
+		Entry("when the body is nested too deep", `{"model": `+nestedJSON(maxJSONDepth)+`}`, "nested deeper than 128 levels"),
+	)
+
+	It("should reject the requests with too many distinct fields", func() {
+		fields := make([]string, maxRequestFields+1)
+		for i := range fields {
+			fields[i] = fmt.Sprintf(`"f%d":0`, i)
+		}
+		_, err := decodeRequestBody([]byte("{" + strings.Join(fields, ",") + "}"))
+		Expect(err).To(MatchError("request body has more than 1024 fields"))
+	})
+
+	It("should ignore the brackets in strings", func() {
+		Expect(checkJSONDepth([]byte(`{"prompt": "`+nestedJSON(maxJSONDepth+1)+`\"[["}`), maxJSONDepth)).To(Succeed())
+	})
+})
+
+// FuzzDecodeRequestBody checks the crafted request bodies are rejected without panics, and the
+// decoded ones are encoded again with the same fields
+func FuzzDecodeRequestBody(f *testing.F) {
+	for _, seed := range []string{
+		`{"model": "m", "prompt": "Hello", "max_tokens": 16, "stream": true}`,
+		`{"model": "m", "messages": [{"role": "user", "content": [{"type": "text", "text": "Hello"}]}]}`,
+		`{"model": "m", "seed": 12345678901234567890, "response_format": {"type": "json_schema"}}`,
+		`{"a": "\"}]{["}`,
+		`null`,
+		`[]`,
+		`{"model": ` + nestedJSON(maxJSONDepth+1) + `}`,
+	} {
+		f.Add([]byte(seed))
+	}
+
+	f.Fuzz(func(t *testing.T, body []byte) {
+		request, err := decodeRequestBody(body)
+		if err != nil {
+			return
+		}
+		encoded, err := encodeRequestBody(request)
+		if err != nil {
+			t.Fatalf("failed to encode decoded request %q: %v", body, err)
+		}
+		defer encoded.release()
+
+		var fields map[string]json.RawMessage
+		if err := json.Unmarshal([]byte(encoded.String()), &fields); err != nil {
+			t.Fatalf("invalid encoded request %q: %v", encoded.String(), err)
+		}
+		if len(fields) != len(request) {
+			t.Fatalf("encoded request %q has %d fields, expected %d", encoded.String(), len(fields), len(request))
+		}
+	})
+}
@@ -0,0 +1,127 @@
+/*
+Copyright 2025 The llm-d Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package proxy
+
+import (
+	"context"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	resolveTimeout = 5 * time.Second
+)
+
+// lookupHostFunc resolves a host name to its addresses
+type lookupHostFunc func(ctx context.Context, host string) ([]string, error)
+
+// hostResolver periodically re-resolves a DNS name and rotates among its
+// addresses, so traffic is spread across all the pods of a headless service.
+// The lookups run one at a time, in the background once the name was resolved.
+type hostResolver struct {
+	host     string
+	port     string
+	interval time.Duration
+	lookup   lookupHostFunc
+
+	mu         sync.Mutex
+	addrs      []string
+	resolvedAt time.Time
+	resolving  chan struct{} // closed when the lookup in progress ends, nil when none
+
+	counter atomic.Uint64
+}
+
+func newHostResolver(host string, port string, interval time.Duration, lookup lookupHostFunc) *hostResolver {
+	return &hostResolver{
+		host:     host,
+		port:     port,
+		interval: interval,
+		lookup:   lookup,
+	}
+}
+
+// next returns the host:port of the next address to send a request to. It
+// falls back to the DNS name when the name cannot be resolved.
+func (r *hostResolver) next(ctx context.Context) string {
+	addrs := r.resolve(ctx)
+	if len(addrs) == 0 {
+		return r.hostPort(r.host)
+	}
+
+	i := r.counter.Add(1) - 1
+	return r.hostPort(addrs[i%uint64(len(addrs))])
+}
+
+func (r *hostResolver) hostPort(host string) string {
+	if r.port == "" {
+		if ip := net.ParseIP(host); ip != nil && ip.To4() == nil {
+			return "[" + host + "]"
+		}
+		return host
+	}
+	return net.JoinHostPort(host, r.port)
+}
+
+// resolve returns the addresses of the host, re-resolving them once the refresh interval elapsed.
+// The previous addresses are served while they are re-resolved, and kept when the resolution
+// fails. Only the requests finding no address at all wait for the lookup.
+func (r *hostResolver) resolve(ctx context.Context) []string {
+	r.mu.Lock()
+	addrs := r.addrs
+	if addrs != nil && time.Since(r.resolvedAt) < r.interval {
+		r.mu.Unlock()
+		return addrs
+	}
+	done := r.resolving
+	if done == nil {
+		done = make(chan struct{})
+		r.resolving = done
+		go r.refresh(done)
+	}
+	r.mu.Unlock()
+
+	if addrs != nil {
+		return addrs
+	}
+	select {
+	case <-done:
+	case <-ctx.Done():
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.addrs
+}
+
+// refresh looks the host up and closes done. The lookup is shared by the requests, so it is
+// not bound to the context of the request which started it.
+func (r *hostResolver) refresh(done chan struct{}) {
+	ctx, cancelFn := context.WithTimeout(context.Background(), resolveTimeout)
+	defer cancelFn()
+	addrs, err := r.lookup(ctx, r.host)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.resolvedAt = time.Now()
+	if err == nil && len(addrs) > 0 {
+		r.addrs = addrs
+	}
+	r.resolving = nil
+	close(done)
+}
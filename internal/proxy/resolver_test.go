@@ -0,0 +1,143 @@
+/*
+Copyright 2025 The llm-d Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package proxy
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2" // nolint:revive
+	. "github.com/onsi/gomega"    // nolint:revive
+)
+
+var _ = Describe("Host resolver", func() {
+	var (
+		mu      sync.Mutex
+		records []string
+		lookups *atomic.Int32
+		lookup  lookupHostFunc
+	)
+
+	setRecords := func(addrs []string) {
+		mu.Lock()
+		defer mu.Unlock()
+		records = addrs
+	}
+
+	BeforeEach(func() {
+		setRecords([]string{"10.0.0.1", "10.0.0.2"})
+		// not shared with the background lookups of the previous specs
+		counter := &atomic.Int32{}
+		lookups = counter
+		lookup = func(_ context.Context, host string) ([]string, error) {
+			defer GinkgoRecover()
+			Expect(host).To(Equal("prefill.default.svc"))
+			counter.Add(1)
+			mu.Lock()
+			defer mu.Unlock()
+			if records == nil {
+				return nil, errors.New("no such host")
+			}
+			return records, nil
+		}
+	})
+
+	It("should rotate among the resolved addresses", func() {
+		resolver := newHostResolver("prefill.default.svc", "8000", time.Hour, lookup)
+
+		Expect(resolver.next(context.Background())).To(Equal("10.0.0.1:8000"))
+		Expect(resolver.next(context.Background())).To(Equal("10.0.0.2:8000"))
+		Expect(resolver.next(context.Background())).To(Equal("10.0.0.1:8000"))
+		Expect(lookups.Load()).To(BeEquivalentTo(1))
+	})
+
+	It("should re-resolve once the refresh interval elapsed", func() {
+		resolver := newHostResolver("prefill.default.svc", "8000", 10*time.Millisecond, lookup)
+		Expect(resolver.next(context.Background())).To(Equal("10.0.0.1:8000"))
+
+		setRecords([]string{"10.0.0.3"})
+		time.Sleep(20 * time.Millisecond)
+		// served from the previous addresses while re-resolving
+		Expect(resolver.next(context.Background())).To(Equal("10.0.0.2:8000"))
+		Eventually(func() string { return resolver.next(context.Background()) }).Should(Equal("10.0.0.3:8000"))
+		Expect(lookups.Load()).To(BeEquivalentTo(2))
+	})
+
+	It("should keep the previous addresses when the resolution fails", func() {
+		resolver := newHostResolver("prefill.default.svc", "8000", time.Millisecond, lookup)
+		Expect(resolver.next(context.Background())).To(Equal("10.0.0.1:8000"))
+
+		setRecords(nil)
+		time.Sleep(5 * time.Millisecond)
+		Expect(resolver.next(context.Background())).To(Equal("10.0.0.2:8000"))
+		Eventually(lookups.Load).Should(BeEquivalentTo(2))
+		Expect(resolver.next(context.Background())).To(Equal("10.0.0.1:8000"))
+	})
+
+	It("should not block the requests on a re-resolution", func() {
+		release := make(chan struct{})
+		blocking := func(ctx context.Context, host string) ([]string, error) {
+			if lookups.Load() > 0 {
+				<-release
+			}
+			return lookup(ctx, host)
+		}
+		resolver := newHostResolver("prefill.default.svc", "8000", time.Millisecond, blocking)
+		Expect(resolver.next(context.Background())).To(Equal("10.0.0.1:8000"))
+
+		time.Sleep(5 * time.Millisecond)
+		for range 10 {
+			done := make(chan string)
+			go func() { done <- resolver.next(context.Background()) }()
+			Eventually(done).Should(Receive(HavePrefix("10.0.0.")))
+		}
+		close(release)
+		Eventually(lookups.Load).Should(BeEquivalentTo(2))
+	})
+
+	It("should share the first lookup among the concurrent requests", func() {
+		release := make(chan struct{})
+		blocking := func(ctx context.Context, host string) ([]string, error) {
+			<-release
+			return lookup(ctx, host)
+		}
+		resolver := newHostResolver("prefill.default.svc", "8000", time.Hour, blocking)
+
+		var wg sync.WaitGroup
+		for range 10 {
+			wg.Add(1)
+			go func() {
+				defer GinkgoRecover()
+				defer wg.Done()
+				Expect(resolver.next(context.Background())).To(HavePrefix("10.0.0."))
+			}()
+		}
+		time.Sleep(10 * time.Millisecond)
+		close(release)
+		wg.Wait()
+		Expect(lookups.Load()).To(BeEquivalentTo(1))
+	})
+
+	It("should fall back to the DNS name when it cannot be resolved", func() {
+		setRecords(nil)
+		resolver := newHostResolver("prefill.default.svc", "8000", time.Hour, lookup)
+		Expect(resolver.next(context.Background())).To(Equal("prefill.default.svc:8000"))
+	})
+})
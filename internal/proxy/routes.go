@@ -0,0 +1,92 @@
+/*
+Copyright 2025 The llm-d Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package proxy
+
+import (
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+)
+
+var (
+	// ModelsPath is the OpenAI models path
+	ModelsPath = "/v1/models"
+)
+
+// methodRoutes registers the routes intercepted by the proxy by method. The other methods of
+// their paths are answered by the proxy rather than forwarded to the decoder: OPTIONS with the
+// allowed methods, and the others with 405.
+type methodRoutes struct {
+	*http.ServeMux
+	paths   []string            // the paths of the routes, in registration order
+	methods map[string][]string // the methods of the routes, by path
+}
+
+func newMethodRoutes() *methodRoutes {
+	return &methodRoutes{
+		ServeMux: http.NewServeMux(),
+		methods:  map[string][]string{},
+	}
+}
+
+// Handle registers the handler of a pattern, recording its method if any
+func (m *methodRoutes) Handle(pattern string, handler http.Handler) {
+	if method, path, found := strings.Cut(pattern, " "); found {
+		if _, ok := m.methods[path]; !ok {
+			m.paths = append(m.paths, path)
+		}
+		m.methods[path] = append(m.methods[path], method)
+	}
+	m.ServeMux.Handle(pattern, handler)
+}
+
+// HandleFunc registers the handler function of a pattern, recording its method if any
+func (m *methodRoutes) HandleFunc(pattern string, handler func(http.ResponseWriter, *http.Request)) {
+	m.Handle(pattern, http.HandlerFunc(handler))
+}
+
+// mux registers the handlers of the other methods of the routes, and returns the mux
+func (m *methodRoutes) mux() *http.ServeMux {
+	for _, path := range m.paths {
+		m.ServeMux.Handle(path, otherMethodsHandler(allowedMethods(m.methods[path])))
+	}
+	return m.ServeMux
+}
+
+// allowedMethods returns the Allow header of the methods of a route, GET implying HEAD
+func allowedMethods(methods []string) string {
+	allowed := slices.Clone(methods)
+	if slices.Contains(allowed, http.MethodGet) && !slices.Contains(allowed, http.MethodHead) {
+		allowed = append(allowed, http.MethodHead)
+	}
+	allowed = append(allowed, http.MethodOptions)
+	return strings.Join(allowed, ", ")
+}
+
+// otherMethodsHandler answers OPTIONS with the allowed methods of a route, and the other
+// methods with 405
+func otherMethodsHandler(allow string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Allow", allow)
+		if r.Method == http.MethodOptions {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		errorStatus(http.StatusMethodNotAllowed, fmt.Sprintf("method %s not allowed", r.Method), w) //nolint:all
+	})
+}
@@ -0,0 +1,82 @@
+/*
+Copyright 2025 The llm-d Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+
+	"github.com/go-logr/logr"
+	"github.com/llm-d/llm-d-routing-sidecar/test/mock"
+	. "github.com/onsi/ginkgo/v2" // nolint:revive
+	. "github.com/onsi/gomega"    // nolint:revive
+)
+
+var _ = Describe("Method-aware routes", func() {
+	var (
+		handler        http.Handler
+		decoderHandler *mock.GenericHandler
+	)
+
+	BeforeEach(func() {
+		decoderHandler = &mock.GenericHandler{}
+		decoder := httptest.NewServer(decoderHandler)
+		DeferCleanup(decoder.Close)
+
+		decodeURL, err := url.Parse(decoder.URL)
+		Expect(err).ToNot(HaveOccurred())
+		proxy, err := NewProxy("0", decodeURL, Config{Connector: ConnectorNIXLV2, EnableSleepMode: true, SleepControlToken: "token"})
+		Expect(err).ToNot(HaveOccurred())
+		proxy.logger = logr.Discard()
+		handler = proxy.createRoutes()
+	})
+
+	serve := func(method string, path string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(method, path, nil))
+		return rec
+	}
+
+	DescribeTable("should reject the other methods of the intercepted routes with 405",
+		func(method string, path string, allow string) {
+			rec := serve(method, path)
+			Expect(rec.Code).To(Equal(http.StatusMethodNotAllowed))
+			Expect(rec.Header().Get("Allow")).To(Equal(allow))
+			Expect(rec.Body.String()).To(ContainSubstring("method " + method + " not allowed"))
+			Expect(decoderHandler.RequestCount.Load()).To(BeZero())
+		},
+		Entry("GET of the chat completions", http.MethodGet, ChatCompletionsPath, "POST, OPTIONS"),
+		Entry("PUT of the tokenizer", http.MethodPut, TokenizePath, "POST, OPTIONS"),
+		Entry("GET of the sleep endpoint", http.MethodGet, SleepPath, "POST, OPTIONS"),
+		Entry("DELETE of the health", http.MethodDelete, "/health", "GET, HEAD, OPTIONS"),
+		Entry("POST of the models", http.MethodPost, ModelsPath, "GET, HEAD, OPTIONS"),
+	)
+
+	It("should answer OPTIONS with the allowed methods", func() {
+		rec := serve(http.MethodOptions, CompletionsPath)
+		Expect(rec.Code).To(Equal(http.StatusNoContent))
+		Expect(rec.Header().Get("Allow")).To(Equal("POST, OPTIONS"))
+		Expect(decoderHandler.RequestCount.Load()).To(BeZero())
+	})
+
+	It("should forward the models and the other paths to the decoder", func() {
+		Expect(serve(http.MethodGet, ModelsPath).Code).To(Equal(http.StatusOK))
+		Expect(serve(http.MethodPut, "/v1/unknown").Code).To(Equal(http.StatusOK))
+		Expect(decoderHandler.RequestCount.Load()).To(BeNumerically("==", 2))
+	})
+})
@@ -0,0 +1,201 @@
+/*
+Copyright 2025 The llm-d Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package proxy
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Routing decisions of the completion requests
+const (
+	routingDisaggregated = "disaggregated"
+	routingDecodeOnly    = "decode-only"
+)
+
+// Reasons of the decode-only routing decisions
+const (
+	decodeOnlyNoPrefiller     = "no-prefiller"
+	decodeOnlyRoutingPolicy   = "routing-policy"
+	decodeOnlyMultipleChoices = "multiple-choices"
+	decodeOnlyMultimodal      = "multimodal"
+	decodeOnlyShortPrompt     = "short-prompt"
+	decodeOnlyPrefixCache     = "prefix-cache"
+)
+
+// RoutingDecisions are the last routing decisions of a proxy, newest first
+type RoutingDecisions struct {
+	DataParallelRank int               `json:"dataParallelRank"`
+	Pool             string            `json:"pool,omitempty"`
+	Decisions        []RoutingDecision `json:"decisions"`
+}
+
+// RoutingDecision describes why a completion request went where it did
+type RoutingDecision struct {
+	Time      time.Time `json:"time"`
+	RequestID string    `json:"requestId,omitempty"`
+	Route     string    `json:"route"`
+	Model     string    `json:"model,omitempty"`
+	// Candidates are the prefill targets sent by the client, selected with Strategy
+	Candidates []string `json:"candidates,omitempty"`
+	Strategy   string   `json:"strategy,omitempty"`
+	// Decision is disaggregated or decode-only, for the given Reason
+	Decision  string `json:"decision"`
+	Reason    string `json:"reason,omitempty"`
+	Prefiller string `json:"prefiller,omitempty"`
+	Connector string `json:"connector,omitempty"`
+	// Fallbacks are the changes of route while serving the request, e.g. a failover
+	Fallbacks       []string `json:"fallbacks,omitempty"`
+	StatusCode      int      `json:"statusCode"`
+	PrefillSeconds  float64  `json:"prefillSeconds,omitempty"`
+	DurationSeconds float64  `json:"durationSeconds"`
+}
+
+// RoutingDecisions returns the last routing decisions of the proxy
+func (s *Server) RoutingDecisions() RoutingDecisions {
+	decisions := RoutingDecisions{
+		DataParallelRank: s.config.DataParallelRank,
+		Pool:             s.config.Pool,
+		Decisions:        []RoutingDecision{},
+	}
+	if s.decisions != nil {
+		decisions.Decisions = s.decisions.last()
+	}
+	return decisions
+}
+
+// routingDecisions is the ring buffer of the last routing decisions of a proxy
+type routingDecisions struct {
+	mu        sync.Mutex
+	decisions []RoutingDecision
+	next      int
+	full      bool
+}
+
+// newRoutingDecisions returns a ring buffer of the given size, nil when disabled
+func newRoutingDecisions(size int) *routingDecisions {
+	if size <= 0 {
+		return nil
+	}
+	return &routingDecisions{decisions: make([]RoutingDecision, size)}
+}
+
+func (d *routingDecisions) add(decision RoutingDecision) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.decisions[d.next] = decision
+	d.next = (d.next + 1) % len(d.decisions)
+	d.full = d.full || d.next == 0
+}
+
+// last returns the decisions, newest first
+func (d *routingDecisions) last() []RoutingDecision {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	count := d.next
+	if d.full {
+		count = len(d.decisions)
+	}
+	last := make([]RoutingDecision, 0, count)
+	for i := range count {
+		last = append(last, d.decisions[(d.next-1-i+len(d.decisions))%len(d.decisions)])
+	}
+	return last
+}
+
+// routingTrace collects the routing decision of a request while it is served, also by the
+// goroutines of its hedged requests
+type routingTrace struct {
+	mu       sync.Mutex
+	decision RoutingDecision
+}
+
+// traceRouting updates the routing decision of the request of the given context, if traced
+func traceRouting(ctx context.Context, update func(*RoutingDecision)) {
+	info := requestInfoFrom(ctx)
+	if info == nil || info.trace == nil {
+		return
+	}
+	info.trace.mu.Lock()
+	defer info.trace.mu.Unlock()
+	update(&info.trace.decision)
+}
+
+// traceDecodeOnly records the reason of a request going decode-only
+func traceDecodeOnly(ctx context.Context, reason string) {
+	traceRouting(ctx, func(d *RoutingDecision) {
+		d.Decision, d.Reason = routingDecodeOnly, reason
+	})
+}
+
+// traceFallback records a change of route of a request
+func traceFallback(ctx context.Context, fallback string) {
+	traceRouting(ctx, func(d *RoutingDecision) {
+		d.Fallbacks = append(d.Fallbacks, fallback)
+	})
+}
+
+// traceRank names a data parallel rank in the fallbacks
+func traceRank(sibling *Server) string {
+	return "rank " + strconv.Itoa(sibling.config.DataParallelRank)
+}
+
+// startTrace starts tracing the routing decision of a completion request, when the decisions
+// are kept
+func (s *Server) startTrace(w http.ResponseWriter, r *http.Request, info *requestInfo, start time.Time) {
+	if s.decisions == nil {
+		return
+	}
+	info.trace = &routingTrace{decision: RoutingDecision{
+		Time:      start,
+		RequestID: w.Header().Get(responseHeaderRequestID),
+		Route:     info.route,
+		Model:     info.model,
+		Decision:  routingDecodeOnly,
+	}}
+	if candidates, _, err := prefillTargets(r.Header); err == nil {
+		info.trace.decision.Candidates = candidates
+		if s.prefillerSelector != nil {
+			info.trace.decision.Strategy = s.prefillerSelector.strategy
+		}
+	}
+}
+
+// finishTrace keeps the routing decision of a completion request once served
+func (s *Server) finishTrace(info *requestInfo, statusCode int, duration time.Duration) {
+	if s.decisions == nil || info.trace == nil {
+		return
+	}
+	info.trace.mu.Lock()
+	decision := info.trace.decision
+	info.trace.mu.Unlock()
+
+	decision.Prefiller = info.prefiller
+	if decision.Prefiller != "" {
+		decision.Decision, decision.Reason = routingDisaggregated, ""
+	} else if decision.Reason == "" {
+		decision.Reason = decodeOnlyNoPrefiller
+	}
+	decision.StatusCode = statusCode
+	decision.DurationSeconds = duration.Seconds()
+	s.decisions.add(decision)
+}
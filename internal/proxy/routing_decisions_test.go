@@ -0,0 +1,76 @@
+/*
+Copyright 2025 The llm-d Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package proxy
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2" // nolint:revive
+	. "github.com/onsi/gomega"    // nolint:revive
+)
+
+var _ = Describe("Routing decisions", func() {
+	It("should keep the last decisions, newest first", func() {
+		Expect(newRoutingDecisions(0)).To(BeNil())
+
+		decisions := newRoutingDecisions(3)
+		Expect(decisions.last()).To(BeEmpty())
+		for _, model := range []string{"a", "b", "c", "d"} {
+			decisions.add(RoutingDecision{Model: model})
+		}
+		Expect(decisions.last()).To(HaveExactElements(
+			HaveField("Model", "d"), HaveField("Model", "c"), HaveField("Model", "b"),
+		))
+	})
+
+	It("should trace the reasons and fallbacks of a request", func() {
+		s := &Server{decisions: newRoutingDecisions(2)}
+		trace := func(update func(ctx context.Context)) RoutingDecision {
+			r := httptest.NewRequest(http.MethodPost, ChatCompletionsPath, nil)
+			r.Header.Set(requestHeaderPrefillHostPort, "10.0.0.1:8000")
+			info := &requestInfo{route: ChatCompletionsPath}
+			s.startTrace(httptest.NewRecorder(), r, info, time.Now())
+			update(context.WithValue(r.Context(), requestInfoKey{}, info))
+			s.finishTrace(info, http.StatusOK, time.Second)
+			return s.decisions.last()[0]
+		}
+
+		decision := trace(func(ctx context.Context) {
+			traceDecodeOnly(ctx, decodeOnlyMultimodal)
+			traceFallback(ctx, "local decoder down, failed over to rank 1")
+		})
+		Expect(decision.Decision).To(Equal(routingDecodeOnly))
+		Expect(decision.Reason).To(Equal(decodeOnlyMultimodal))
+		Expect(decision.Candidates).To(Equal([]string{"10.0.0.1:8000"}))
+		Expect(decision.Fallbacks).To(Equal([]string{"local decoder down, failed over to rank 1"}))
+		Expect(decision.DurationSeconds).To(Equal(1.0))
+
+		decision = trace(func(ctx context.Context) {
+			requestInfoFrom(ctx).prefiller = "10.0.0.1:8000"
+			traceFallback(ctx, "TTFT budget exceeded by the prefill, decode-only")
+		})
+		Expect(decision.Decision).To(Equal(routingDisaggregated))
+		Expect(decision.Prefiller).To(Equal("10.0.0.1:8000"))
+		Expect(decision.Fallbacks).To(HaveLen(1))
+
+		// the requests without routing decisions are not traced
+		traceFallback(context.Background(), "ignored")
+	})
+})
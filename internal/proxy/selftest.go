@@ -0,0 +1,298 @@
+/*
+Copyright 2025 The llm-d Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package proxy
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"reflect"
+
+	"k8s.io/klog/v2"
+
+	"github.com/llm-d/llm-d-routing-sidecar/internal/metrics"
+)
+
+const (
+	selfTestStageModels  = "models"
+	selfTestStagePrefill = "prefill"
+	selfTestStageDecode  = "decode"
+
+	selfTestPrompt    = "Hello"
+	selfTestMaxTokens = 8
+)
+
+// SelfTestStage reports the outcome of a single stage of a self-test run
+type SelfTestStage struct {
+	// Name of the stage (models, prefill or decode)
+	Name string
+
+	// Passed is true when the stage completed and its output was valid
+	Passed bool
+
+	// StatusCode is the HTTP status code returned by the upstream, if any
+	StatusCode int
+
+	// Message describes the outcome of the stage
+	Message string
+}
+
+// SelfTestReport is the result of a self-test run
+type SelfTestReport struct {
+	Connector string
+	Prefiller string
+	Model     string
+	Stages    []SelfTestStage
+}
+
+// Passed returns true when every stage of the self-test passed
+func (r *SelfTestReport) Passed() bool {
+	for _, stage := range r.Stages {
+		if !stage.Passed {
+			return false
+		}
+	}
+	return len(r.Stages) > 0
+}
+
+func (r *SelfTestReport) addStage(name string, passed bool, statusCode int, format string, args ...any) {
+	r.Stages = append(r.Stages, SelfTestStage{
+		Name:       name,
+		Passed:     passed,
+		StatusCode: statusCode,
+		Message:    fmt.Sprintf(format, args...),
+	})
+}
+
+// recordingHandler captures the request body and the response of the handler it wraps
+type recordingHandler struct {
+	next http.Handler
+
+	called       bool
+	requestBody  []byte
+	statusCode   int
+	responseBody []byte
+}
+
+func (h *recordingHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.called = true
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	r.Body = io.NopCloser(bytes.NewReader(body))
+	h.requestBody = body
+
+	rw := &bufferedResponseWriter{}
+	h.next.ServeHTTP(rw, r)
+
+	h.statusCode = rw.statusCode
+	h.responseBody = []byte(rw.buffer.String())
+
+	for k, v := range rw.Header() {
+		w.Header()[k] = v
+	}
+	if rw.statusCode != 0 {
+		w.WriteHeader(rw.statusCode)
+	}
+	w.Write(h.responseBody) //nolint:all
+}
+
+// SelfTest sends a small synthetic completion request through the configured connector
+// protocol against the given prefiller and the local decoder, and reports, for each stage,
+// whether the KV transfer parameters round-tripped correctly.
+// When model is empty, the first model served by the decoder is used.
+// SelfTest must not be called while the server is serving requests.
+func (s *Server) SelfTest(ctx context.Context, prefillHostPort string, model string) (*SelfTestReport, error) {
+	s.logger = klog.FromContext(ctx).WithName("selftest").WithValues(metrics.RankLabel, s.rank())
+
+	report := &SelfTestReport{
+		Connector: s.config.Connector,
+		Prefiller: prefillHostPort,
+		Model:     model,
+	}
+
+	if report.Model == "" {
+		discovered, code, err := s.discoverModel(ctx)
+		if err != nil {
+			report.addStage(selfTestStageModels, false, code, "failed to discover model served by the decoder: %v", err)
+			return report, nil
+		}
+		report.Model = discovered
+		report.addStage(selfTestStageModels, true, code, "decoder serves model %q", discovered)
+	}
+
+	prefillHandler, err := s.prefillerProxyHandler(prefillHostPort)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create prefiller proxy: %w", err)
+	}
+
+	// Run the real protocol with the upstream handlers wrapped with recorders
+	prefillRecorder := &recordingHandler{next: prefillHandler}
+	decodeRecorder := &recordingHandler{next: s.decoderProxy}
+
+	s.prefillerProxies.Add(prefillHostPort, prefillRecorder)
+	s.decoderProxy = decodeRecorder
+	defer func() {
+		s.prefillerProxies.Add(prefillHostPort, prefillHandler)
+		s.decoderProxy = decodeRecorder.next
+	}()
+
+	body, err := json.Marshal(map[string]any{
+		"model":               report.Model,
+		"prompt":              selfTestPrompt,
+		requestFieldMaxTokens: selfTestMaxTokens,
+		requestFieldStream:    false,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, CompletionsPath, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	rw := &bufferedResponseWriter{}
+	s.runConnectorProtocol(rw, req, prefillHostPort)
+
+	prefillParams, ok := s.checkSelfTestPrefill(report, prefillRecorder)
+	if !ok {
+		return report, nil
+	}
+	s.checkSelfTestDecode(report, decodeRecorder, prefillParams, rw)
+
+	return report, nil
+}
+
+// discoverModel returns the first model listed by the decoder
+func (s *Server) discoverModel(ctx context.Context) (string, int, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, "/v1/models", nil)
+	if err != nil {
+		return "", 0, err
+	}
+	rw := &bufferedResponseWriter{}
+	s.decoderProxy.ServeHTTP(rw, req)
+
+	if rw.statusCode < 200 || rw.statusCode >= 300 {
+		return "", rw.statusCode, fmt.Errorf("unexpected status code %d", rw.statusCode)
+	}
+
+	var models struct {
+		Data []struct {
+			ID string `json:"id"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal([]byte(rw.buffer.String()), &models); err != nil {
+		return "", rw.statusCode, err
+	}
+	if len(models.Data) == 0 || models.Data[0].ID == "" {
+		return "", rw.statusCode, errors.New("no model listed")
+	}
+	return models.Data[0].ID, rw.statusCode, nil
+}
+
+// checkSelfTestPrefill verifies the prefiller was called and returned the fields the
+// connector expects. It returns the KV transfer fields the decoder must receive.
+func (s *Server) checkSelfTestPrefill(report *SelfTestReport, rec *recordingHandler) (map[string]any, bool) {
+	if !rec.called {
+		report.addStage(selfTestStagePrefill, false, 0, "prefiller was not called")
+		return nil, false
+	}
+	if rec.statusCode < 200 || rec.statusCode >= 300 {
+		report.addStage(selfTestStagePrefill, false, rec.statusCode, "prefiller returned an error: %s", rec.responseBody)
+		return nil, false
+	}
+
+	var response map[string]any
+	if err := json.Unmarshal(rec.responseBody, &response); err != nil {
+		report.addStage(selfTestStagePrefill, false, rec.statusCode, "prefiller response is not valid JSON: %v", err)
+		return nil, false
+	}
+
+	var expected map[string]any
+	switch s.config.Connector {
+	case ConnectorLMCache:
+		report.addStage(selfTestStagePrefill, true, rec.statusCode, "prefiller accepted the request")
+		return nil, true
+
+	case ConnectorNIXLV1:
+		for _, field := range []string{requestFieldRemoteBlockIDs, requestFieldRemoteEngineID} {
+			if value, ok := response[field]; !ok || value == nil {
+				report.addStage(selfTestStagePrefill, false, rec.statusCode, "prefiller response is missing %q", field)
+				return nil, false
+			}
+		}
+		expected = map[string]any{
+			requestFieldRemoteBlockIDs: response[requestFieldRemoteBlockIDs],
+			requestFieldRemoteEngineID: response[requestFieldRemoteEngineID],
+			requestFieldRemoteHost:     response[requestFieldRemoteHost],
+			requestFieldRemotePort:     response[requestFieldRemotePort],
+		}
+
+	default:
+		params, ok := response[requestFieldKVTransferParams].(map[string]any)
+		if !ok {
+			report.addStage(selfTestStagePrefill, false, rec.statusCode, "prefiller response is missing %q", requestFieldKVTransferParams)
+			return nil, false
+		}
+		for _, field := range []string{requestFieldRemoteBlockIDs, requestFieldRemoteEngineID} {
+			if value, ok := params[field]; !ok || value == nil {
+				report.addStage(selfTestStagePrefill, false, rec.statusCode, "prefiller %q is missing %q", requestFieldKVTransferParams, field)
+				return nil, false
+			}
+		}
+		expected = map[string]any{requestFieldKVTransferParams: params}
+	}
+
+	report.addStage(selfTestStagePrefill, true, rec.statusCode, "prefiller returned KV transfer parameters")
+	return expected, true
+}
+
+// checkSelfTestDecode verifies the decoder received the KV transfer fields returned by the prefiller
+// and that the client received a successful response
+func (s *Server) checkSelfTestDecode(report *SelfTestReport, rec *recordingHandler, expected map[string]any, rw *bufferedResponseWriter) {
+	if !rec.called {
+		report.addStage(selfTestStageDecode, false, rw.statusCode, "decoder was not called: %s", rw.buffer.String())
+		return
+	}
+
+	var request map[string]any
+	if err := json.Unmarshal(rec.requestBody, &request); err != nil {
+		report.addStage(selfTestStageDecode, false, rec.statusCode, "decode request is not valid JSON: %v", err)
+		return
+	}
+	for field, value := range expected {
+		if !reflect.DeepEqual(request[field], value) {
+			report.addStage(selfTestStageDecode, false, rec.statusCode, "decode request %q does not match the prefiller response", field)
+			return
+		}
+	}
+
+	if rec.statusCode < 200 || rec.statusCode >= 300 {
+		report.addStage(selfTestStageDecode, false, rec.statusCode, "decoder returned an error: %s", rec.responseBody)
+		return
+	}
+
+	report.addStage(selfTestStageDecode, true, rec.statusCode, "decoder accepted the KV transfer parameters")
+}
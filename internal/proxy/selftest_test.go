@@ -0,0 +1,88 @@
+/*
+Copyright 2025 The llm-d Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package proxy
+
+import (
+	"context"
+	"net/http/httptest"
+	"net/url"
+
+	"github.com/llm-d/llm-d-routing-sidecar/test/mock"
+	. "github.com/onsi/ginkgo/v2" // nolint:revive
+	. "github.com/onsi/gomega"    // nolint:revive
+	"k8s.io/klog/v2/ktesting"
+)
+
+var _ = Describe("Self-test", func() {
+	var (
+		ctx           context.Context
+		decodeHandler *mock.ChatCompletionHandler
+		proxy         *Server
+	)
+
+	BeforeEach(func() {
+		_, ctx = ktesting.NewTestContext(GinkgoT())
+
+		decodeHandler = &mock.ChatCompletionHandler{
+			Connector: ConnectorNIXLV2,
+			Role:      mock.RoleDecode,
+		}
+		decodeBackend := httptest.NewServer(decodeHandler)
+		DeferCleanup(decodeBackend.Close)
+
+		decodeURL, err := url.Parse(decodeBackend.URL)
+		Expect(err).ToNot(HaveOccurred())
+
+		proxy, err = NewProxy("0", decodeURL, Config{Connector: ConnectorNIXLV2})
+		Expect(err).ToNot(HaveOccurred())
+	})
+
+	It("should pass when the KV transfer parameters round-trip", func() {
+		prefillHandler := &mock.ChatCompletionHandler{
+			Connector: ConnectorNIXLV2,
+			Role:      mock.RolePrefill,
+		}
+		prefillBackend := httptest.NewServer(prefillHandler)
+		DeferCleanup(prefillBackend.Close)
+
+		report, err := proxy.SelfTest(ctx, prefillBackend.URL[len("http://"):], "Qwen/Qwen2-0.5B")
+		Expect(err).ToNot(HaveOccurred())
+
+		Expect(report.Stages).To(HaveLen(2))
+		Expect(report.Stages[0].Name).To(Equal(selfTestStagePrefill))
+		Expect(report.Stages[1].Name).To(Equal(selfTestStageDecode))
+		Expect(report.Passed()).To(BeTrue(), "%+v", report.Stages)
+
+		Expect(prefillHandler.RequestCount.Load()).To(BeNumerically("==", 1))
+		Expect(decodeHandler.RequestCount.Load()).To(BeNumerically("==", 1))
+		Expect(decodeHandler.CompletionRequests[0]).To(HaveKeyWithValue(requestFieldKVTransferParams,
+			prefillHandler.CompletionResponses[0][requestFieldKVTransferParams]))
+	})
+
+	It("should fail the prefill stage when the prefiller returns no KV transfer parameters", func() {
+		prefillBackend := httptest.NewServer(&mock.GenericHandler{})
+		DeferCleanup(prefillBackend.Close)
+
+		report, err := proxy.SelfTest(ctx, prefillBackend.URL[len("http://"):], "Qwen/Qwen2-0.5B")
+		Expect(err).ToNot(HaveOccurred())
+
+		Expect(report.Passed()).To(BeFalse())
+		Expect(report.Stages).To(HaveLen(1))
+		Expect(report.Stages[0].Name).To(Equal(selfTestStagePrefill))
+		Expect(decodeHandler.RequestCount.Load()).To(BeNumerically("==", 0))
+	})
+})
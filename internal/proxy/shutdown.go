@@ -0,0 +1,118 @@
+/*
+Copyright 2025 The llm-d Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package proxy
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/go-logr/logr"
+)
+
+const (
+	// ShutdownWait waits for the requests in flight at shutdown, up to the drain timeout
+	ShutdownWait = "wait"
+
+	// ShutdownClose waits for the requests in flight at shutdown, then interrupts those left
+	// after the drain timeout: the streams end with an error event
+	ShutdownClose = "close"
+
+	// ShutdownHandoff interrupts the requests in flight at shutdown, the requests not answered
+	// yet getting a retryable status so they are retried on another endpoint
+	ShutdownHandoff = "handoff"
+
+	// defaultDrainTimeout is how long the requests in flight are waited for at shutdown
+	defaultDrainTimeout = 60 * time.Second
+
+	// interruptGracePeriod is how long the interrupted requests are given to send their
+	// final response
+	interruptGracePeriod = 5 * time.Second
+
+	// shutdownRetryAfter is the Retry-After delay of the requests interrupted at shutdown,
+	// in seconds
+	shutdownRetryAfter = "1"
+)
+
+// errShuttingDown is the cause of the requests interrupted at shutdown
+var errShuttingDown = errors.New("the sidecar is shutting down")
+
+// errorShuttingDown answers a request interrupted at shutdown with a retryable status
+func errorShuttingDown(w http.ResponseWriter) error {
+	w.Header().Set("Retry-After", shutdownRetryAfter)
+	return errorServiceUnavailable("the sidecar is shutting down, retry the request", w)
+}
+
+// interrupt interrupts the requests in flight, and returns their number
+func (t *inflightTracker) interrupt() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for _, req := range t.requests {
+		if req.cancel != nil {
+			req.cancel(errShuttingDown)
+		}
+	}
+	return len(t.requests)
+}
+
+// interruptible reports whether the requests in flight may be interrupted at shutdown
+func (s *Server) interruptible() bool {
+	return s.config.ShutdownPolicy == ShutdownClose || s.config.ShutdownPolicy == ShutdownHandoff
+}
+
+// drainTimeout returns how long the requests in flight are waited for at shutdown
+func (s *Server) drainTimeout() time.Duration {
+	if s.config.DrainTimeout > 0 {
+		return s.config.DrainTimeout
+	}
+	return defaultDrainTimeout
+}
+
+// shutdownTimeout returns how long the proxy takes to shut down at most
+func (s *Server) shutdownTimeout() time.Duration {
+	if s.interruptible() {
+		return s.drainTimeout() + interruptGracePeriod
+	}
+	return s.drainTimeout()
+}
+
+// shutdown stops the proxy server following the shutdown policy
+func (s *Server) shutdown(server *http.Server, logger logr.Logger) {
+	requests, streams := s.inflight.drain()
+	logger.Info("draining the requests in flight", "requests", requests, "streams", streams,
+		"policy", s.config.ShutdownPolicy, "timeout", s.drainTimeout())
+
+	drainTimeout := s.drainTimeout()
+	if s.config.ShutdownPolicy == ShutdownHandoff {
+		logger.Info("handing off the requests in flight", "requests", s.inflight.interrupt())
+		drainTimeout = interruptGracePeriod
+	}
+	ctx, cancelFn := context.WithTimeout(context.Background(), drainTimeout)
+	defer cancelFn()
+	err := server.Shutdown(ctx)
+
+	if errors.Is(err, context.DeadlineExceeded) && s.config.ShutdownPolicy == ShutdownClose {
+		logger.Info("drain timeout reached, closing the requests in flight", "requests", s.inflight.interrupt())
+		ctx, cancelFn := context.WithTimeout(context.Background(), interruptGracePeriod)
+		defer cancelFn()
+		err = server.Shutdown(ctx)
+	}
+	if err != nil {
+		logger.Error(err, "failed to gracefully shutdown")
+	}
+}
@@ -0,0 +1,150 @@
+/*
+Copyright 2025 The llm-d Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package proxy
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"time"
+
+	"k8s.io/klog/v2/ktesting"
+
+	. "github.com/onsi/ginkgo/v2" // nolint:revive
+	. "github.com/onsi/gomega"    // nolint:revive
+)
+
+var _ = Describe("Shutdown", func() {
+	var (
+		release chan struct{}
+		started chan struct{}
+	)
+
+	BeforeEach(func() {
+		release = make(chan struct{})
+		started = make(chan struct{}, 1)
+	})
+
+	// decoder returns a decoder streaming one event, unless it blocks before the response
+	decoder := func(stream bool) *httptest.Server {
+		backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			io.Copy(io.Discard, r.Body) //nolint:all
+			started <- struct{}{}
+			if stream {
+				w.Header().Set("Content-Type", eventStreamContentType)
+				w.Write([]byte("data: {\"choices\":[{\"text\":\"Hello\"}]}\n\n")) //nolint:all
+				w.(http.Flusher).Flush()
+			}
+			select {
+			case <-release:
+			case <-r.Context().Done():
+			}
+		}))
+		DeferCleanup(backend.Close)
+		DeferCleanup(func() { close(release) })
+		return backend
+	}
+
+	// start starts a proxy of the decoder, stopped by the returned function
+	start := func(backend *httptest.Server, config Config) (*Server, context.CancelFunc) {
+		_, ctx := ktesting.NewTestContext(GinkgoT())
+		ctx, cancelFn := context.WithCancel(ctx)
+		DeferCleanup(cancelFn)
+
+		decodeURL, err := url.Parse(backend.URL)
+		Expect(err).ToNot(HaveOccurred())
+		proxy, err := NewProxy("0", decodeURL, config)
+		Expect(err).ToNot(HaveOccurred())
+		go func() {
+			defer GinkgoRecover()
+			Expect(proxy.Start(ctx)).To(Succeed())
+		}()
+		Eventually(func() net.Addr { return proxy.Addr() }).ShouldNot(BeNil())
+		return proxy, cancelFn
+	}
+
+	send := func(proxy *Server, stream bool) *http.Response {
+		body := `{"model": "Qwen/Qwen2-0.5B", "prompt": "Hello", "stream": false}`
+		if stream {
+			body = strings.Replace(body, "false", "true", 1)
+		}
+		resp, err := http.Post("http://"+proxy.Addr().String()+CompletionsPath, "application/json", strings.NewReader(body))
+		Expect(err).ToNot(HaveOccurred())
+		DeferCleanup(resp.Body.Close)
+		return resp
+	}
+
+	It("should hand off the requests not answered yet with a retryable status", func() {
+		proxy, stop := start(decoder(false), Config{ShutdownPolicy: ShutdownHandoff})
+
+		responses := make(chan *http.Response, 1)
+		go func() {
+			defer GinkgoRecover()
+			responses <- send(proxy, false)
+		}()
+		Eventually(started).Should(Receive())
+		stop()
+
+		var resp *http.Response
+		Eventually(responses).WithTimeout(5 * time.Second).Should(Receive(&resp))
+		Expect(resp.StatusCode).To(Equal(http.StatusServiceUnavailable))
+		Expect(resp.Header.Get("Retry-After")).To(Equal(shutdownRetryAfter))
+	})
+
+	It("should close the streams left after the drain timeout with an error event", func() {
+		proxy, stop := start(decoder(true), Config{ShutdownPolicy: ShutdownClose, DrainTimeout: 200 * time.Millisecond})
+
+		resp := send(proxy, true)
+		Expect(resp.StatusCode).To(Equal(http.StatusOK))
+		Eventually(started).Should(Receive())
+		Eventually(func() []InflightRequest { return proxy.inflight.snapshot() }).Should(ConsistOf(HaveField("Stream", true)))
+		stop()
+
+		done := make(chan []string)
+		go func() {
+			defer GinkgoRecover()
+			var events []string
+			scanner := bufio.NewScanner(resp.Body)
+			for scanner.Scan() {
+				if line := scanner.Text(); line != "" {
+					events = append(events, line)
+				}
+			}
+			Expect(scanner.Err()).ToNot(HaveOccurred())
+			done <- events
+		}()
+
+		var events []string
+		Eventually(done).WithTimeout(5 * time.Second).Should(Receive(&events))
+		Expect(events).To(HaveLen(3))
+		Expect(events[1]).To(ContainSubstring(`"code":503`))
+		Expect(events[1]).To(ContainSubstring("shutting down"))
+		Expect(events[2]).To(Equal("data: [DONE]"))
+	})
+
+	It("should reject an unknown shutdown policy", func() {
+		decodeURL, err := url.Parse("http://localhost:8000")
+		Expect(err).ToNot(HaveOccurred())
+		_, err = NewProxy("0", decodeURL, Config{ShutdownPolicy: "abort"})
+		Expect(err).To(MatchError(ContainSubstring("shutdown policy")))
+	})
+})
@@ -0,0 +1,134 @@
+/*
+Copyright 2025 The llm-d Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package proxy
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/llm-d/llm-d-routing-sidecar/internal/metrics"
+)
+
+const (
+	legPrefill = "prefill"
+	legDecode  = "decode"
+)
+
+// requestInfoKey is the context key of the description of a completion request
+type requestInfoKey struct{}
+
+// requestInfo describes a completion request in its metrics and logs
+type requestInfo struct {
+	route     string
+	model     string
+	tenant    string // the tenant of the metrics, empty unless the tenant label is attached
+	prefiller string // the prefill target, empty when decode-only
+	size      int64  // the size of the request body
+
+	parsed *parsedRequest // the parsed request body, nil once spilled to disk
+	trace  *routingTrace  // the routing decision, nil unless kept
+
+	received time.Time  // when the request was read
+	stages   stageTimes // when the proxy legs were sent and answered
+}
+
+// labels returns the optional labels of the completion request metrics
+func (i *requestInfo) labels() metrics.CompletionLabels {
+	return metrics.CompletionLabels{Model: i.model, Tenant: i.tenant, Prefiller: i.prefiller}
+}
+
+// requestInfoFrom returns the description of the completion request of the context, if any
+func requestInfoFrom(ctx context.Context) *requestInfo {
+	info, _ := ctx.Value(requestInfoKey{}).(*requestInfo)
+	return info
+}
+
+// sizeRecorder counts the bytes and records the status code written to the wrapped ResponseWriter
+type sizeRecorder struct {
+	http.ResponseWriter
+	statusCode int
+	size       int64
+	firstByte  time.Time // when the first byte of the body was written, e.g. the first token
+}
+
+func (r *sizeRecorder) WriteHeader(statusCode int) {
+	if r.statusCode == 0 && statusCode >= 200 {
+		r.statusCode = statusCode
+	}
+	r.ResponseWriter.WriteHeader(statusCode)
+}
+
+func (r *sizeRecorder) Write(b []byte) (int, error) {
+	if r.statusCode == 0 {
+		r.statusCode = http.StatusOK
+	}
+	if r.firstByte.IsZero() && len(b) > 0 {
+		r.firstByte = time.Now()
+	}
+	n, err := r.ResponseWriter.Write(b)
+	r.size += int64(n)
+	return n, err
+}
+
+// Unwrap allows http.ResponseController to flush the wrapped ResponseWriter
+func (r *sizeRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
+
+// describeRequest attaches the description of the completion request to its context, so
+// the bodies sent to the prefiller and the decoder are measured, and returns the writer
+// measuring the response
+func describeRequest(w http.ResponseWriter, r *http.Request, p *parsedRequest, size int) (*sizeRecorder, *http.Request, *requestInfo) {
+	info := &requestInfo{route: routeLabel(r.Pattern), model: p.model, size: int64(size), parsed: p}
+	if header := metrics.TenantHeader(); header != "" {
+		info.tenant = r.Header.Get(header)
+	}
+	r = r.WithContext(context.WithValue(r.Context(), requestInfoKey{}, info))
+	return &sizeRecorder{ResponseWriter: w}, r, info
+}
+
+// recordResponse records the completion request served, and warns when it was slow
+func (s *Server) recordResponse(r *http.Request, info *requestInfo, rec *sizeRecorder, duration time.Duration) {
+	statusCode := rec.statusCode
+	if statusCode == 0 {
+		statusCode = http.StatusOK
+	}
+	statusCode = clientStatus(r, statusCode)
+	metrics.RecordCompletion(s.rank(), info.route, info.labels(), statusCode, rec.size, duration, traceID(r.Header))
+	s.checkSlowRequest(r, info, rec.size, duration)
+	s.finishTrace(info, statusCode, duration)
+	s.recordStages(r, info, rec, statusCode, duration)
+}
+
+// recordRequestSize records the size of the body of a request sent to the given leg
+func (s *Server) recordRequestSize(r *http.Request, leg string) {
+	info := requestInfoFrom(r.Context())
+	if info == nil || r.ContentLength < 0 {
+		return
+	}
+	metrics.RecordRequestSize(s.rank(), info.route, info.labels(), leg, r.ContentLength)
+}
+
+// measureDecodeRequests records the size of the completion requests sent to the decoder
+func (s *Server) measureDecodeRequests(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.recordRequestSize(r, legDecode)
+		recordStage(r.Context(), timeDecodeSent, time.Now())
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,179 @@
+/*
+Copyright 2025 The llm-d Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package proxy
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/llm-d/llm-d-routing-sidecar/internal/metrics"
+	"github.com/llm-d/llm-d-routing-sidecar/test/mock"
+	. "github.com/onsi/ginkgo/v2" // nolint:revive
+	. "github.com/onsi/gomega"    // nolint:revive
+	dto "github.com/prometheus/client_model/go"
+	"k8s.io/klog/v2/ktesting"
+)
+
+var _ = Describe("Request and response sizes", func() {
+	var (
+		proxyBaseURL string
+		prefillHost  string
+	)
+
+	BeforeEach(func() {
+		_, ctx := ktesting.NewTestContext(GinkgoT())
+		ctx, cancelFn := context.WithCancel(ctx)
+		DeferCleanup(cancelFn)
+
+		decodeBackend := httptest.NewServer(&mock.ChatCompletionHandler{Connector: ConnectorNIXLV2, Role: mock.RoleDecode})
+		DeferCleanup(decodeBackend.Close)
+		prefillBackend := httptest.NewServer(&mock.ChatCompletionHandler{Connector: ConnectorNIXLV2, Role: mock.RolePrefill})
+		DeferCleanup(prefillBackend.Close)
+		prefillHost = prefillBackend.URL[len("http://"):]
+
+		decodeURL, err := url.Parse(decodeBackend.URL)
+		Expect(err).ToNot(HaveOccurred())
+		proxy, err := NewProxy("0", decodeURL, Config{Connector: ConnectorNIXLV2})
+		Expect(err).ToNot(HaveOccurred())
+
+		go func() {
+			defer GinkgoRecover()
+			Expect(proxy.Start(ctx)).To(Succeed())
+		}()
+		time.Sleep(1 * time.Second)
+		Expect(proxy.Addr()).ToNot(BeNil())
+		proxyBaseURL = "http://" + proxy.Addr().String()
+	})
+
+	// histograms returns the size histograms of the given metric and model, by leg
+	histograms := func(name string, model string) map[string]*dto.Histogram {
+		histograms := map[string]*dto.Histogram{}
+		families, err := metrics.Registry.Gather()
+		Expect(err).ToNot(HaveOccurred())
+		for _, family := range families {
+			if family.GetName() != name {
+				continue
+			}
+			for _, metric := range family.Metric {
+				labels := map[string]string{}
+				for _, label := range metric.Label {
+					labels[label.GetName()] = label.GetValue()
+				}
+				if labels["model"] == model && labels["route"] == CompletionsPath {
+					histograms[labels["leg"]] = metric.GetHistogram()
+				}
+			}
+		}
+		return histograms
+	}
+
+	sendRequest := func(model string, prefiller string) int {
+		body := `{"model": "` + model + `", "prompt": "Hello", "max_tokens": 10}`
+		req, err := http.NewRequest(http.MethodPost, proxyBaseURL+CompletionsPath, strings.NewReader(body))
+		Expect(err).ToNot(HaveOccurred())
+		if prefiller != "" {
+			req.Header.Add(requestHeaderPrefillHostPort, prefiller)
+		}
+
+		resp, err := http.DefaultClient.Do(req)
+		Expect(err).ToNot(HaveOccurred())
+		defer resp.Body.Close() //nolint:all
+		Expect(resp.StatusCode).To(Equal(http.StatusOK))
+		data, err := io.ReadAll(resp.Body)
+		Expect(err).ToNot(HaveOccurred())
+		return len(data)
+	}
+
+	It("should measure the prefill and decode legs of disaggregated requests", func() {
+		size := sendRequest("size-disaggregated", prefillHost)
+
+		requests := histograms("llm_d_routing_sidecar_request_size_bytes", "size-disaggregated")
+		Expect(requests).To(HaveKey(legPrefill))
+		Expect(requests).To(HaveKey(legDecode))
+		Expect(requests[legPrefill].GetSampleCount()).To(BeNumerically("==", 1))
+		Expect(requests[legPrefill].GetSampleSum()).To(BeNumerically(">", 0))
+		Expect(requests[legDecode].GetSampleCount()).To(BeNumerically("==", 1))
+		Expect(requests[legDecode].GetSampleSum()).To(BeNumerically(">", 0))
+
+		responses := histograms("llm_d_routing_sidecar_response_size_bytes", "size-disaggregated")
+		Expect(responses).To(HaveKey(""))
+		Expect(responses[""].GetSampleCount()).To(BeNumerically("==", 1))
+		Expect(responses[""].GetSampleSum()).To(BeNumerically("==", size))
+	})
+
+	It("should label the completion requests as configured", func() {
+		metrics.ConfigureLabels(metrics.LabelConfig{
+			Model:        metrics.LabelOptions{Enabled: true, Allowlist: []string{"llama"}},
+			Tenant:       metrics.LabelOptions{Enabled: true},
+			TenantHeader: "X-Tenant",
+			Prefiller:    metrics.LabelOptions{Enabled: true},
+		})
+		DeferCleanup(metrics.ConfigureLabels, metrics.LabelConfig{Model: metrics.LabelOptions{Enabled: true}})
+
+		body := `{"model": "size-labels", "prompt": "Hello", "max_tokens": 10}`
+		req, err := http.NewRequest(http.MethodPost, proxyBaseURL+CompletionsPath, strings.NewReader(body))
+		Expect(err).ToNot(HaveOccurred())
+		req.Header.Add(requestHeaderPrefillHostPort, prefillHost)
+		req.Header.Set("X-Tenant", "acme-labels")
+		resp, err := http.DefaultClient.Do(req)
+		Expect(err).ToNot(HaveOccurred())
+		resp.Body.Close() //nolint:all
+		Expect(resp.StatusCode).To(Equal(http.StatusOK))
+
+		Eventually(func() []map[string]string {
+			var series []map[string]string
+			families, err := metrics.Registry.Gather()
+			Expect(err).ToNot(HaveOccurred())
+			for _, family := range families {
+				if family.GetName() != "llm_d_routing_sidecar_completion_requests_total" {
+					continue
+				}
+				for _, metric := range family.Metric {
+					labels := map[string]string{}
+					for _, label := range metric.Label {
+						labels[label.GetName()] = label.GetValue()
+					}
+					if labels["tenant"] == "acme-labels" {
+						series = append(series, labels)
+					}
+				}
+			}
+			return series
+		}).Should(ConsistOf(And(
+			HaveKeyWithValue("model", "other"),
+			HaveKeyWithValue("prefiller", prefillHost),
+			HaveKeyWithValue("code", "200"),
+		)))
+	})
+
+	It("should only measure the decode leg of decode-only requests", func() {
+		size := sendRequest("size-decode-only", "")
+
+		requests := histograms("llm_d_routing_sidecar_request_size_bytes", "size-decode-only")
+		Expect(requests).ToNot(HaveKey(legPrefill))
+		Expect(requests).To(HaveKey(legDecode))
+		Expect(requests[legDecode].GetSampleSum()).To(BeNumerically("==", len(`{"model": "size-decode-only", "prompt": "Hello", "max_tokens": 10}`)))
+
+		responses := histograms("llm_d_routing_sidecar_response_size_bytes", "size-decode-only")
+		Expect(responses[""].GetSampleSum()).To(BeNumerically("==", size))
+	})
+})
@@ -0,0 +1,110 @@
+/*
+Copyright 2025 The llm-d Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package proxy
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	// SleepPath is the vLLM endpoint putting the engine to sleep, releasing its GPU memory
+	SleepPath = "/sleep"
+
+	// WakeUpPath is the vLLM endpoint waking the engine up
+	WakeUpPath = "/wake_up"
+
+	// IsSleepingPath is the vLLM endpoint reporting whether the engine sleeps
+	IsSleepingPath = "/is_sleeping"
+)
+
+// sleepControlHandler returns the handler forwarding a sleep control request to the local
+// decoder, tracking whether the engine sleeps from the outcome
+func (s *Server) sleepControlHandler(sleep bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !s.sleepControlAuthorized(r) {
+			s.logger.Info("unauthorized sleep control request", "path", r.URL.Path, "clientIP", r.RemoteAddr)
+			if err := errorUnauthorized(w); err != nil {
+				s.logger.Error(err, "failed to send error response to client")
+			}
+			return
+		}
+
+		// Requests are turned away as soon as the engine starts falling asleep, since
+		// those still reaching it would fail
+		wasSleeping := s.sleeping.Load()
+		if sleep {
+			s.sleeping.Store(true)
+		}
+
+		rec := &statusRecorder{ResponseWriter: w}
+		s.localDecoderProxy.ServeHTTP(rec, r)
+
+		succeeded := rec.statusCode >= 200 && rec.statusCode < 300
+		switch {
+		case sleep && !succeeded:
+			s.sleeping.Store(wasSleeping)
+		case sleep:
+			s.logger.Info("decoder sleeping", "level", r.URL.Query().Get("level"))
+			// the KV cache is discarded while sleeping
+			if s.prefixIndex != nil {
+				s.prefixIndex.purge()
+			}
+		case succeeded:
+			s.sleeping.Store(false)
+			s.logger.Info("decoder woken up")
+		}
+	}
+}
+
+// sleepControlAuthorized checks the bearer token of a sleep control request
+func (s *Server) sleepControlAuthorized(r *http.Request) bool {
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	return ok && subtle.ConstantTimeCompare([]byte(token), []byte(s.config.SleepControlToken)) == 1
+}
+
+// sleepGate turns the requests away with 503 while the decoder sleeps, except the health
+// and sleep control requests
+func (s *Server) sleepGate(mux *http.ServeMux) http.Handler {
+	if !s.config.EnableSleepMode {
+		return mux
+	}
+
+	retryAfter := strconv.Itoa(int(s.config.SleepRetryAfter.Round(time.Second) / time.Second))
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !s.sleeping.Load() {
+			mux.ServeHTTP(w, r)
+			return
+		}
+
+		switch r.URL.Path {
+		case "/health", SleepPath, WakeUpPath, IsSleepingPath:
+			mux.ServeHTTP(w, r)
+			return
+		}
+
+		// label the request metrics with the route, as if served
+		_, r.Pattern = mux.Handler(r)
+		w.Header().Set("Retry-After", retryAfter)
+		if err := errorServiceUnavailable("the engine is sleeping", w); err != nil {
+			s.logger.Error(err, "failed to send error response to client")
+		}
+	})
+}
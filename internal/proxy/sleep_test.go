@@ -0,0 +1,126 @@
+/*
+Copyright 2025 The llm-d Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package proxy
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2" // nolint:revive
+	. "github.com/onsi/gomega"    // nolint:revive
+	"k8s.io/klog/v2/ktesting"
+)
+
+var _ = Describe("Sleep mode", func() {
+	var (
+		proxy       *Server
+		sleepStatus atomic.Int32
+		wakeUps     atomic.Int32
+	)
+
+	BeforeEach(func() {
+		_, ctx := ktesting.NewTestContext(GinkgoT())
+		ctx, cancelFn := context.WithCancel(ctx)
+		DeferCleanup(cancelFn)
+
+		sleepStatus.Store(http.StatusOK)
+		wakeUps.Store(0)
+		decodeBackend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			switch r.URL.Path {
+			case SleepPath:
+				w.WriteHeader(int(sleepStatus.Load()))
+			case WakeUpPath:
+				wakeUps.Add(1)
+			}
+		}))
+		DeferCleanup(decodeBackend.Close)
+
+		decodeURL, err := url.Parse(decodeBackend.URL)
+		Expect(err).ToNot(HaveOccurred())
+		proxy, err = NewProxy("0", decodeURL, Config{
+			EnableSleepMode:   true,
+			SleepControlToken: "secret",
+			SleepRetryAfter:   20 * time.Second,
+		})
+		Expect(err).ToNot(HaveOccurred())
+
+		go func() {
+			defer GinkgoRecover()
+			Expect(proxy.Start(ctx)).To(Succeed())
+		}()
+		time.Sleep(1 * time.Second)
+		Expect(proxy.Addr()).ToNot(BeNil())
+	})
+
+	send := func(method string, path string, token string) *http.Response {
+		req, err := http.NewRequest(method, "http://"+proxy.Addr().String()+path, strings.NewReader(`{"model": "m", "prompt": "hello"}`))
+		Expect(err).ToNot(HaveOccurred())
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		Expect(err).ToNot(HaveOccurred())
+		resp.Body.Close() //nolint:all
+		return resp
+	}
+
+	It("should require the sleep control token", func() {
+		Expect(send(http.MethodPost, SleepPath, "").StatusCode).To(Equal(http.StatusUnauthorized))
+		Expect(send(http.MethodPost, SleepPath, "wrong").StatusCode).To(Equal(http.StatusUnauthorized))
+		Expect(send(http.MethodPost, WakeUpPath, "").StatusCode).To(Equal(http.StatusUnauthorized))
+		Expect(wakeUps.Load()).To(BeZero())
+		Expect(proxy.sleeping.Load()).To(BeFalse())
+	})
+
+	It("should turn requests away and fail readiness while the engine sleeps", func() {
+		Expect(send(http.MethodPost, SleepPath+"?level=1", "secret").StatusCode).To(Equal(http.StatusOK))
+		Expect(proxy.State().Sleeping).To(BeTrue())
+
+		resp := send(http.MethodPost, CompletionsPath, "")
+		Expect(resp.StatusCode).To(Equal(http.StatusServiceUnavailable))
+		Expect(resp.Header.Get("Retry-After")).To(Equal("20"))
+		Expect(send(http.MethodGet, "/health", "").StatusCode).To(Equal(http.StatusServiceUnavailable))
+		Expect(proxy.Health(context.Background()).Healthy).To(BeFalse())
+		Expect(send(http.MethodGet, IsSleepingPath, "").StatusCode).To(Equal(http.StatusOK))
+
+		Expect(send(http.MethodPost, WakeUpPath, "secret").StatusCode).To(Equal(http.StatusOK))
+		Expect(wakeUps.Load()).To(BeNumerically("==", 1))
+		Expect(send(http.MethodGet, "/health", "").StatusCode).To(Equal(http.StatusOK))
+		Expect(send(http.MethodPost, CompletionsPath, "").StatusCode).To(Equal(http.StatusOK))
+	})
+
+	It("should keep serving when the engine fails to sleep", func() {
+		sleepStatus.Store(http.StatusInternalServerError)
+		Expect(send(http.MethodPost, SleepPath, "secret").StatusCode).To(Equal(http.StatusInternalServerError))
+		Expect(proxy.sleeping.Load()).To(BeFalse())
+		Expect(send(http.MethodGet, "/health", "").StatusCode).To(Equal(http.StatusOK))
+	})
+})
+
+var _ = Describe("Sleep mode configuration", func() {
+	It("should require a sleep control token", func() {
+		decodeURL, err := url.Parse("http://localhost:8000")
+		Expect(err).ToNot(HaveOccurred())
+		_, err = NewProxy("0", decodeURL, Config{EnableSleepMode: true})
+		Expect(err).To(HaveOccurred())
+	})
+})
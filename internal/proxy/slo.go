@@ -0,0 +1,104 @@
+/*
+Copyright 2025 The llm-d Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package proxy
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/llm-d/llm-d-routing-sidecar/internal/metrics"
+)
+
+const (
+	requestHeaderSLOTTFT = "x-slo-ttft-ms"
+)
+
+// ttftBudget returns the time to first token budget of the request, if any
+func ttftBudget(r *http.Request) (time.Duration, bool) {
+	value := r.Header.Get(requestHeaderSLOTTFT)
+	if value == "" {
+		return 0, false
+	}
+	ms, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return 0, false
+	}
+	return time.Duration(ms) * time.Millisecond, true
+}
+
+// sendPrefillRequest forwards the prefill request, bounded by the TTFT budget of the
+// request. It reports whether the prefill was skipped or canceled because the budget
+// was exceeded, in which case the request must go straight to decode.
+func (s *Server) sendPrefillRequest(prefillHandler http.Handler, preq *http.Request) (*bufferedResponseWriter, bool) {
+	budget, hasBudget := ttftBudget(preq)
+	if hasBudget {
+		if budget <= 0 {
+			s.logger.V(4).Info("TTFT budget exhausted, skipping prefill")
+			traceFallback(preq.Context(), "TTFT budget exhausted, decode-only")
+			metrics.RecordSLOBudgetExceeded(s.rank(), s.requestConnector(preq.Context()))
+			return nil, true
+		}
+
+		ctx, cancelFn := context.WithTimeout(preq.Context(), budget)
+		defer cancelFn()
+		preq = preq.WithContext(ctx)
+	}
+
+	if s.admission != nil {
+		defer s.admission.startPrefill(preq.Context())()
+	}
+
+	s.recordRequestSize(preq, legPrefill)
+	pw := getResponseWriter()
+	prefillStart := time.Now()
+	recordStage(preq.Context(), timePrefillSent, prefillStart)
+	if s.config.AccessLog {
+		preq.Header.Set(requestHeaderSentAt, prefillStart.UTC().Format(time.RFC3339Nano))
+	}
+	prefillHandler.ServeHTTP(pw, preq)
+	recordStage(preq.Context(), timePrefillFirstByte, pw.firstByte)
+	prefillDuration := time.Since(prefillStart)
+	metrics.RecordPrefill(s.rank(), s.requestConnector(preq.Context()), pw.statusCode, prefillDuration, traceID(preq.Header))
+	if info := requestInfoFrom(preq.Context()); s.prefillerSelector != nil && info != nil {
+		s.prefillerSelector.observe(info.prefiller, prefillDuration, pw.statusCode != http.StatusOK)
+	}
+	s.checkSlowPrefill(preq, pw, prefillDuration)
+	traceRouting(preq.Context(), func(d *RoutingDecision) { d.PrefillSeconds += prefillDuration.Seconds() })
+
+	if hasBudget && errors.Is(preq.Context().Err(), context.DeadlineExceeded) {
+		s.logger.V(4).Info("TTFT budget exceeded, canceled prefill", "budget", budget)
+		traceFallback(preq.Context(), "TTFT budget exceeded by the prefill, decode-only")
+		metrics.RecordSLOBudgetExceeded(s.rank(), s.requestConnector(preq.Context()))
+		return pw, true
+	}
+	return pw, false
+}
+
+// runDecodeOnly forwards the original request to the local decoder, which
+// then runs the prefill itself
+func (s *Server) runDecodeOnly(w http.ResponseWriter, r *http.Request, original []byte) {
+	dreq := r.Clone(r.Context())
+	setRequestBody(dreq, io.NopCloser(bytes.NewReader(original)), len(original))
+
+	s.inflight.setStage(r.Context(), stageDecode)
+	s.decodeWithHedging(w, dreq, original)
+}
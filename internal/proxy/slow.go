@@ -0,0 +1,69 @@
+/*
+Copyright 2025 The llm-d Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package proxy
+
+import (
+	"net/http"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// checkSlowPrefill warns when a prefill exceeded the slow prefill threshold
+func (s *Server) checkSlowPrefill(preq *http.Request, pw *bufferedResponseWriter, duration time.Duration) {
+	threshold := s.config.SlowPrefillThreshold
+	if threshold <= 0 || duration <= threshold {
+		return
+	}
+	info := requestInfoFrom(preq.Context())
+	if info == nil {
+		info = &requestInfo{}
+	}
+	s.warnSlow(preq, "slow prefill", info, preq.ContentLength, int64(pw.buffer.Len()), duration, threshold)
+}
+
+// checkSlowRequest warns when a completion request exceeded the slow request threshold
+func (s *Server) checkSlowRequest(r *http.Request, info *requestInfo, responseSize int64, duration time.Duration) {
+	threshold := s.config.SlowRequestThreshold
+	if threshold <= 0 || duration <= threshold {
+		return
+	}
+	s.warnSlow(r, "slow request", info, info.size, responseSize, duration, threshold)
+}
+
+// warnSlow logs a slow prefill or request, and adds it as event to the span of the request, if any
+func (s *Server) warnSlow(r *http.Request, event string, info *requestInfo, requestSize int64, responseSize int64, duration time.Duration, threshold time.Duration) {
+	s.logger.Info("Warning: "+event,
+		"route", info.route,
+		"model", info.model,
+		"target", info.prefiller,
+		"requestBytes", requestSize,
+		"responseBytes", responseSize,
+		"duration", duration,
+		"threshold", threshold,
+		"traceID", traceID(r.Header))
+
+	trace.SpanFromContext(r.Context()).AddEvent(event, trace.WithAttributes(
+		attribute.String("route", info.route),
+		attribute.String("model", info.model),
+		attribute.String("target", info.prefiller),
+		attribute.Int64("request_bytes", requestSize),
+		attribute.Int64("response_bytes", responseSize),
+		attribute.Int64("duration_ms", duration.Milliseconds()),
+	))
+}
@@ -0,0 +1,153 @@
+/*
+Copyright 2025 The llm-d Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package proxy
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/llm-d/llm-d-routing-sidecar/test/mock"
+	. "github.com/onsi/ginkgo/v2" // nolint:revive
+	. "github.com/onsi/gomega"    // nolint:revive
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"k8s.io/klog/v2"
+	"k8s.io/klog/v2/ktesting"
+)
+
+var _ = Describe("Slow requests", func() {
+	var (
+		ctx          context.Context
+		logs         ktesting.Buffer
+		decodeURL    *url.URL
+		prefillHost  string
+		prefillDelay time.Duration
+		decodeDelay  time.Duration
+	)
+
+	BeforeEach(func() {
+		logger := ktesting.NewLogger(GinkgoT(), ktesting.NewConfig(ktesting.BufferLogs(true)))
+		logs = logger.GetSink().(ktesting.Underlier).GetBuffer()
+		var cancelFn context.CancelFunc
+		ctx, cancelFn = context.WithCancel(klog.NewContext(context.Background(), logger))
+		DeferCleanup(cancelFn)
+
+		prefillDelay, decodeDelay = 0, 0
+		decodeHandler := &mock.ChatCompletionHandler{Connector: ConnectorNIXLV2, Role: mock.RoleDecode}
+		decodeBackend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			time.Sleep(decodeDelay)
+			decodeHandler.ServeHTTP(w, r)
+		}))
+		DeferCleanup(decodeBackend.Close)
+
+		prefillHandler := &mock.ChatCompletionHandler{Connector: ConnectorNIXLV2, Role: mock.RolePrefill}
+		prefillBackend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			time.Sleep(prefillDelay)
+			prefillHandler.ServeHTTP(w, r)
+		}))
+		DeferCleanup(prefillBackend.Close)
+		prefillHost = prefillBackend.URL[len("http://"):]
+
+		var err error
+		decodeURL, err = url.Parse(decodeBackend.URL)
+		Expect(err).ToNot(HaveOccurred())
+	})
+
+	body := `{"model": "llama", "prompt": "Hello", "max_tokens": 10}`
+
+	sendRequest := func(config Config) {
+		config.Connector = ConnectorNIXLV2
+		proxy, err := NewProxy("0", decodeURL, config)
+		Expect(err).ToNot(HaveOccurred())
+
+		go func() {
+			defer GinkgoRecover()
+			Expect(proxy.Start(ctx)).To(Succeed())
+		}()
+		time.Sleep(1 * time.Second)
+		Expect(proxy.Addr()).ToNot(BeNil())
+
+		req, err := http.NewRequest(http.MethodPost, "http://"+proxy.Addr().String()+CompletionsPath, strings.NewReader(body))
+		Expect(err).ToNot(HaveOccurred())
+		req.Header.Add(requestHeaderPrefillHostPort, prefillHost)
+
+		resp, err := http.DefaultClient.Do(req)
+		Expect(err).ToNot(HaveOccurred())
+		resp.Body.Close() //nolint:all
+		Expect(resp.StatusCode).To(Equal(http.StatusOK))
+	}
+
+	It("should warn about requests slower than the threshold", func() {
+		decodeDelay = 300 * time.Millisecond
+		sendRequest(Config{SlowPrefillThreshold: 200 * time.Millisecond, SlowRequestThreshold: 200 * time.Millisecond})
+
+		// logged once the response is sent
+		Eventually(logs.String).Should(ContainSubstring("Warning: slow request"))
+		Expect(logs.String()).To(ContainSubstring(`model="llama"`))
+		Expect(logs.String()).To(ContainSubstring(`target="` + prefillHost + `"`))
+		Expect(logs.String()).To(ContainSubstring(fmt.Sprintf("requestBytes=%d", len(body))))
+		Expect(logs.String()).ToNot(ContainSubstring("slow prefill"))
+	})
+
+	It("should warn about prefills slower than the threshold", func() {
+		prefillDelay = 300 * time.Millisecond
+		sendRequest(Config{SlowPrefillThreshold: 200 * time.Millisecond})
+
+		Expect(logs.String()).To(ContainSubstring("Warning: slow prefill"))
+		Expect(logs.String()).To(ContainSubstring(`target="` + prefillHost + `"`))
+		Consistently(logs.String, 100*time.Millisecond).ShouldNot(ContainSubstring("slow request"))
+	})
+
+	It("should not warn without thresholds", func() {
+		prefillDelay, decodeDelay = 200*time.Millisecond, 200*time.Millisecond
+		sendRequest(Config{})
+
+		Consistently(logs.String, 100*time.Millisecond).ShouldNot(ContainSubstring("Warning: slow"))
+	})
+
+	It("should add the slow request as event to the span of the request", func() {
+		recorder := tracetest.NewSpanRecorder()
+		provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+		spanCtx, span := provider.Tracer("test").Start(ctx, "request")
+
+		server := &Server{logger: klog.FromContext(ctx), config: Config{SlowRequestThreshold: time.Second}}
+		r := httptest.NewRequest(http.MethodPost, CompletionsPath, nil).WithContext(spanCtx)
+		info := &requestInfo{route: CompletionsPath, model: "llama", prefiller: "prefiller:8000", size: 100}
+		server.checkSlowRequest(r, info, 10, 500*time.Millisecond)
+		server.checkSlowRequest(r, info, 20, 2*time.Second)
+		span.End()
+
+		Expect(recorder.Ended()).To(HaveLen(1))
+		events := recorder.Ended()[0].Events()
+		Expect(events).To(HaveLen(1))
+		Expect(events[0].Name).To(Equal("slow request"))
+		attributes := map[string]any{}
+		for _, attribute := range events[0].Attributes {
+			attributes[string(attribute.Key)] = attribute.Value.AsInterface()
+		}
+		Expect(attributes).To(HaveKeyWithValue("model", "llama"))
+		Expect(attributes).To(HaveKeyWithValue("target", "prefiller:8000"))
+		Expect(attributes).To(HaveKeyWithValue("request_bytes", int64(100)))
+		Expect(attributes).To(HaveKeyWithValue("response_bytes", int64(20)))
+		Expect(attributes).To(HaveKeyWithValue("duration_ms", int64(2000)))
+	})
+})
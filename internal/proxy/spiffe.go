@@ -0,0 +1,81 @@
+/*
+Copyright 2025 The llm-d Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package proxy
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+
+	"github.com/spiffe/go-spiffe/v2/bundle/x509bundle"
+	"github.com/spiffe/go-spiffe/v2/spiffeid"
+	"github.com/spiffe/go-spiffe/v2/spiffetls/tlsconfig"
+	"github.com/spiffe/go-spiffe/v2/svid/x509svid"
+)
+
+// SPIFFESource provides the X.509 SVID of the sidecar and the trust bundles verifying its
+// peers, e.g. a workloadapi.X509Source rotating them as the SPIRE agent pushes updates
+type SPIFFESource interface {
+	x509svid.Source
+	x509bundle.Source
+}
+
+// newSPIFFEAuthorizer returns the authorizer of the peer SVIDs: the given SPIFFE IDs, or
+// any workload of the trust domain of the sidecar when none is given
+func newSPIFFEAuthorizer(source SPIFFESource, authorizedIDs []string) (tlsconfig.Authorizer, error) {
+	if len(authorizedIDs) == 0 {
+		svid, err := source.GetX509SVID()
+		if err != nil {
+			return nil, fmt.Errorf("failed to get the SVID: %w", err)
+		}
+		return tlsconfig.AuthorizeMemberOf(svid.ID.TrustDomain()), nil
+	}
+
+	ids := make([]spiffeid.ID, 0, len(authorizedIDs))
+	for _, authorizedID := range authorizedIDs {
+		id, err := spiffeid.FromString(authorizedID)
+		if err != nil {
+			return nil, fmt.Errorf("invalid authorized SPIFFE ID %q: %w", authorizedID, err)
+		}
+		ids = append(ids, id)
+	}
+	return tlsconfig.AuthorizeOneOf(ids...), nil
+}
+
+// spiffeServerTLSConfig returns the mTLS configuration of the proxy listener, serving the
+// SVID and requiring an authorized client SVID
+func (s *Server) spiffeServerTLSConfig() *tls.Config {
+	config := tlsconfig.MTLSServerConfig(s.config.SPIFFESource, s.config.SPIFFESource, s.spiffeAuthorizer)
+	config.MinVersion = tls.VersionTLS12
+	return config
+}
+
+// spiffeClientTLSConfig returns the mTLS configuration of the connections to prefillers,
+// presenting the SVID and requiring an authorized server SVID
+func (s *Server) spiffeClientTLSConfig() *tls.Config {
+	config := tlsconfig.MTLSClientConfig(s.config.SPIFFESource, s.config.SPIFFESource, s.spiffeAuthorizer)
+	config.MinVersion = tls.VersionTLS12
+	// reported as a certificate verification error, like the failures of the default verification
+	verify := config.VerifyPeerCertificate
+	config.VerifyPeerCertificate = func(rawCerts [][]byte, verifiedChains [][]*x509.Certificate) error {
+		if err := verify(rawCerts, verifiedChains); err != nil {
+			return &tls.CertificateVerificationError{Err: err}
+		}
+		return nil
+	}
+	return config
+}
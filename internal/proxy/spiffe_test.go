@@ -0,0 +1,199 @@
+/*
+Copyright 2025 The llm-d Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package proxy
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/spiffe/go-spiffe/v2/bundle/x509bundle"
+	"github.com/spiffe/go-spiffe/v2/spiffeid"
+	"github.com/spiffe/go-spiffe/v2/spiffetls/tlsconfig"
+	"github.com/spiffe/go-spiffe/v2/svid/x509svid"
+
+	"github.com/llm-d/llm-d-routing-sidecar/test/mock"
+	. "github.com/onsi/ginkgo/v2" // nolint:revive
+	. "github.com/onsi/gomega"    // nolint:revive
+	"k8s.io/klog/v2/ktesting"
+)
+
+// staticSPIFFESource serves a fixed SVID and the bundle of its trust domain
+type staticSPIFFESource struct {
+	svid   *x509svid.SVID
+	bundle *x509bundle.Bundle
+}
+
+func (s *staticSPIFFESource) GetX509SVID() (*x509svid.SVID, error) {
+	return s.svid, nil
+}
+
+func (s *staticSPIFFESource) GetX509BundleForTrustDomain(td spiffeid.TrustDomain) (*x509bundle.Bundle, error) {
+	return s.bundle.GetX509BundleForTrustDomain(td)
+}
+
+// testSPIFFECA issues the SVIDs of a trust domain
+type testSPIFFECA struct {
+	cert   *x509.Certificate
+	key    crypto.Signer
+	bundle *x509bundle.Bundle
+}
+
+func newTestSPIFFECA(trustDomain string) *testSPIFFECA {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	Expect(err).ToNot(HaveOccurred())
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		NotBefore:             time.Now().Add(-time.Minute),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, key.Public(), key)
+	Expect(err).ToNot(HaveOccurred())
+	cert, err := x509.ParseCertificate(der)
+	Expect(err).ToNot(HaveOccurred())
+
+	td := spiffeid.RequireTrustDomainFromString(trustDomain)
+	return &testSPIFFECA{cert: cert, key: key, bundle: x509bundle.FromX509Authorities(td, []*x509.Certificate{cert})}
+}
+
+// source issues an SVID for the given SPIFFE ID
+func (ca *testSPIFFECA) source(id string) *staticSPIFFESource {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	Expect(err).ToNot(HaveOccurred())
+	uri, err := url.Parse(id)
+	Expect(err).ToNot(HaveOccurred())
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		NotBefore:    time.Now().Add(-time.Minute),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		URIs:         []*url.URL{uri},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.cert, key.Public(), ca.key)
+	Expect(err).ToNot(HaveOccurred())
+	cert, err := x509.ParseCertificate(der)
+	Expect(err).ToNot(HaveOccurred())
+
+	return &staticSPIFFESource{
+		svid:   &x509svid.SVID{ID: spiffeid.RequireFromString(id), Certificates: []*x509.Certificate{cert}, PrivateKey: key},
+		bundle: ca.bundle,
+	}
+}
+
+var _ = Describe("SPIFFE identities", func() {
+	var (
+		ca             *testSPIFFECA
+		prefillBackend *httptest.Server
+	)
+
+	BeforeEach(func() {
+		ca = newTestSPIFFECA("example.org")
+
+		prefillSource := ca.source("spiffe://example.org/prefill")
+		// StartTLS would serve the httptest certificate rather than the SVID
+		prefillBackend = httptest.NewUnstartedServer(&mock.GenericHandler{})
+		prefillBackend.Listener = tls.NewListener(prefillBackend.Listener,
+			tlsconfig.MTLSServerConfig(prefillSource, prefillSource, tlsconfig.AuthorizeMemberOf(spiffeid.RequireTrustDomainFromString("example.org"))))
+		prefillBackend.Start()
+		DeferCleanup(prefillBackend.Close)
+	})
+
+	newProxy := func(config Config) *Server {
+		decodeURL, err := url.Parse("http://localhost:8000")
+		Expect(err).ToNot(HaveOccurred())
+		config.Connector = ConnectorNIXLV2
+		proxy, err := NewProxy("0", decodeURL, config)
+		Expect(err).ToNot(HaveOccurred())
+		return proxy
+	}
+
+	// prefill sends a prefill request through the cached prefiller proxy
+	prefill := func(proxy *Server) int {
+		handler, err := proxy.prefillerProxyHandler(prefillBackend.Listener.Addr().String())
+		Expect(err).ToNot(HaveOccurred())
+
+		req := httptest.NewRequest(http.MethodPost, CompletionsPath, strings.NewReader(`{"prompt": "Hello"}`))
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	It("should connect to the prefillers with the SVID", func() {
+		source := ca.source("spiffe://example.org/decode")
+		Expect(prefill(newProxy(Config{PrefillerUseTLS: true, SPIFFESource: source}))).To(Equal(http.StatusOK))
+		Expect(prefill(newProxy(Config{PrefillerUseTLS: true, SPIFFESource: source,
+			SPIFFEAuthorizedIDs: []string{"spiffe://example.org/prefill"}}))).To(Equal(http.StatusOK))
+	})
+
+	It("should reject the prefillers not authorized", func() {
+		source := ca.source("spiffe://example.org/decode")
+		Expect(prefill(newProxy(Config{PrefillerUseTLS: true, SPIFFESource: source,
+			SPIFFEAuthorizedIDs: []string{"spiffe://example.org/other"}}))).To(Equal(http.StatusBadGateway))
+		Expect(prefill(newProxy(Config{PrefillerUseTLS: true, SPIFFESource: newTestSPIFFECA("example.org").source("spiffe://example.org/decode")}))).
+			To(Equal(http.StatusBadGateway))
+	})
+
+	It("should require an authorized client SVID on the listener", func() {
+		_, ctx := ktesting.NewTestContext(GinkgoT())
+		ctx, cancelFn := context.WithCancel(ctx)
+		defer cancelFn()
+
+		proxy := newProxy(Config{SecureProxy: true, SPIFFESource: ca.source("spiffe://example.org/decode")})
+		go func() {
+			defer GinkgoRecover()
+			Expect(proxy.Start(ctx)).To(Succeed())
+		}()
+		Eventually(proxy.Addr).WithTimeout(10 * time.Second).ShouldNot(BeNil())
+
+		get := func(client *http.Client) error {
+			resp, err := client.Get("https://" + proxy.Addr().String() + "/health")
+			if err == nil {
+				resp.Body.Close() //nolint:all
+			}
+			return err
+		}
+
+		gateway := ca.source("spiffe://example.org/gateway")
+		td := spiffeid.RequireTrustDomainFromString("example.org")
+		client := &http.Client{Transport: &http.Transport{TLSClientConfig: tlsconfig.MTLSClientConfig(gateway, gateway, tlsconfig.AuthorizeMemberOf(td))}}
+		Expect(get(client)).To(Succeed())
+
+		anonymous := &http.Client{Transport: &http.Transport{TLSClientConfig: tlsconfig.TLSClientConfig(gateway, tlsconfig.AuthorizeMemberOf(td))}}
+		Expect(get(anonymous)).ToNot(Succeed())
+	})
+
+	It("should reject invalid authorized SPIFFE IDs", func() {
+		decodeURL, err := url.Parse("http://localhost:8000")
+		Expect(err).ToNot(HaveOccurred())
+		_, err = NewProxy("0", decodeURL, Config{SPIFFESource: ca.source("spiffe://example.org/decode"), SPIFFEAuthorizedIDs: []string{"https://example.org"}})
+		Expect(err).To(HaveOccurred())
+	})
+})
@@ -0,0 +1,170 @@
+/*
+Copyright 2025 The llm-d Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package proxy
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"sync/atomic"
+)
+
+// requestBody is an encoded request body shared by the handler which encoded it and the
+// requests sending it, released by both
+type requestBody interface {
+	// body returns a request body reading the encoded body
+	body() io.ReadCloser
+
+	// release drops the reference held by the handler
+	release()
+
+	Len() int
+	String() string
+}
+
+// spills reports whether a request body of the given size is spilled to disk
+func (s *Server) spills(size int) bool {
+	return s.config.SpillThresholdBytes > 0 && int64(size) > s.config.SpillThresholdBytes
+}
+
+// newRequestBody encodes a request body, built from an original body of the given size,
+// into a pooled buffer or, beyond the spill threshold, into a temp file. The spill falls
+// back to memory when the file cannot be written.
+func (s *Server) newRequestBody(request map[string]any, size int) (requestBody, error) {
+	if s.spills(size) {
+		body, err := s.newSpilledBody()
+		if err == nil {
+			err = body.encode(request)
+			if err == nil {
+				return body, nil
+			}
+			body.release()
+		}
+		s.logger.Error(err, "failed to spill request body, buffering it in memory")
+	}
+	return encodeRequestBody(request)
+}
+
+// spilledBody is a request body spilled to a temp file, bounding the memory held by large
+// (e.g. long context) requests while they are prefilled and decoded. The file is unlinked
+// once created, so it is removed when closed, including when the sidecar crashes. Like
+// pooled buffers, it is closed once the handler released it and every body was read to
+// the end; the file finalizer closes it otherwise.
+type spilledBody struct {
+	file *os.File
+	size int64
+	refs atomic.Int32
+}
+
+func (s *Server) newSpilledBody() (*spilledBody, error) {
+	file, err := os.CreateTemp(s.config.SpillDir, "llm-d-routing-sidecar-*.json")
+	if err != nil {
+		return nil, err
+	}
+	if err := os.Remove(file.Name()); err != nil {
+		file.Close() //nolint:all
+		return nil, err
+	}
+
+	b := &spilledBody{file: file}
+	b.refs.Store(1)
+	return b, nil
+}
+
+func (b *spilledBody) Write(p []byte) (int, error) {
+	n, err := b.file.Write(p)
+	b.size += int64(n)
+	return n, err
+}
+
+// encode writes the JSON encoding of a request body. Like json.Marshal, the keys are
+// sorted, but raw values are written as is to avoid copying them.
+func (b *spilledBody) encode(request map[string]any) error {
+	w := bufio.NewWriterSize(b, 64<<10) // write errors are sticky, returned by Flush
+
+	keys := make([]string, 0, len(request))
+	for key := range request {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+
+	w.WriteByte('{') //nolint:all
+	for i, key := range keys {
+		if i > 0 {
+			w.WriteByte(',') //nolint:all
+		}
+		encodedKey, err := json.Marshal(key)
+		if err != nil {
+			return err
+		}
+		w.Write(encodedKey) //nolint:all
+		w.WriteByte(':')    //nolint:all
+
+		value, ok := request[key].(json.RawMessage)
+		if !ok {
+			if value, err = json.Marshal(request[key]); err != nil {
+				return err
+			}
+		}
+		w.Write(value) //nolint:all
+	}
+	w.WriteByte('}') //nolint:all
+	return w.Flush()
+}
+
+func (b *spilledBody) body() io.ReadCloser {
+	b.refs.Add(1)
+	return &spilledReader{SectionReader: io.NewSectionReader(b.file, 0, b.size), owner: b}
+}
+
+func (b *spilledBody) release() {
+	if b.refs.Add(-1) == 0 {
+		b.file.Close() //nolint:all
+	}
+}
+
+func (b *spilledBody) Len() int {
+	return int(b.size)
+}
+
+// String describes the body, which is not read back for logging
+func (b *spilledBody) String() string {
+	return fmt.Sprintf("<%d bytes spilled to disk>", b.size)
+}
+
+// spilledReader is a request body reading a spilled body. As for pooled bodies, Close
+// does not release the file.
+type spilledReader struct {
+	*io.SectionReader
+	owner *spilledBody
+	done  atomic.Bool
+}
+
+func (r *spilledReader) Read(p []byte) (int, error) {
+	n, err := r.SectionReader.Read(p)
+	if err == io.EOF && r.done.CompareAndSwap(false, true) {
+		r.owner.release()
+	}
+	return n, err
+}
+
+func (r *spilledReader) Close() error {
+	return nil
+}
@@ -0,0 +1,143 @@
+/*
+Copyright 2025 The llm-d Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package proxy
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/llm-d/llm-d-routing-sidecar/test/mock"
+	. "github.com/onsi/ginkgo/v2" // nolint:revive
+	. "github.com/onsi/gomega"    // nolint:revive
+	"k8s.io/klog/v2/ktesting"
+)
+
+var _ = Describe("Spill to disk", func() {
+	It("should encode request bodies as json.Marshal does", func() {
+		request, err := decodeRequestBody([]byte(`{"stream":true,"model":"m","messages":[{"role":"user","content":"Hello"}]}`))
+		Expect(err).ToNot(HaveOccurred())
+		request[requestFieldMaxTokens] = 1
+		request[requestFieldStreamOptions] = map[string]any{"include_usage": true}
+		expected, err := json.Marshal(request)
+		Expect(err).ToNot(HaveOccurred())
+
+		server := &Server{config: Config{SpillDir: GinkgoT().TempDir()}}
+		body, err := server.newSpilledBody()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(body.encode(request)).To(Succeed())
+		Expect(body.Len()).To(Equal(len(expected)))
+
+		data, err := io.ReadAll(body.body())
+		Expect(err).ToNot(HaveOccurred())
+		Expect(string(data)).To(Equal(string(expected)))
+
+		// unlinked on creation
+		entries, err := os.ReadDir(server.config.SpillDir)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(entries).To(BeEmpty())
+
+		body.release()
+		_, err = body.file.Stat()
+		Expect(err).To(MatchError(os.ErrClosed))
+	})
+
+	It("should keep the file open until released and read to the end", func() {
+		server := &Server{config: Config{SpillDir: GinkgoT().TempDir()}}
+		body, err := server.newSpilledBody()
+		Expect(err).ToNot(HaveOccurred())
+		_, err = body.Write([]byte("hello"))
+		Expect(err).ToNot(HaveOccurred())
+
+		reader := body.body()
+		body.release()
+		Expect(reader.Close()).To(Succeed())
+		_, err = body.file.Stat()
+		Expect(err).ToNot(HaveOccurred())
+
+		data, err := io.ReadAll(reader)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(string(data)).To(Equal("hello"))
+		_, err = body.file.Stat()
+		Expect(err).To(MatchError(os.ErrClosed))
+	})
+
+	It("should buffer large requests in memory when the spill is disabled", func() {
+		server := &Server{}
+		body, err := server.newRequestBody(map[string]any{"model": "m"}, 1<<30)
+		Expect(err).ToNot(HaveOccurred())
+		defer body.release()
+		Expect(body).To(BeAssignableToTypeOf(&pooledBuffer{}))
+	})
+
+	It("should run the P/D protocol with the bodies spilled", func() {
+		_, ctx := ktesting.NewTestContext(GinkgoT())
+		ctx, cancelFn := context.WithCancel(ctx)
+		defer cancelFn()
+
+		decodeHandler := &mock.ChatCompletionHandler{Connector: ConnectorNIXLV2, Role: mock.RoleDecode}
+		decodeBackend := httptest.NewServer(decodeHandler)
+		DeferCleanup(decodeBackend.Close)
+
+		prefillHandler := &mock.ChatCompletionHandler{Connector: ConnectorNIXLV2, Role: mock.RolePrefill}
+		prefillBackend := httptest.NewServer(prefillHandler)
+		DeferCleanup(prefillBackend.Close)
+
+		spillDir := GinkgoT().TempDir()
+		decodeURL, err := url.Parse(decodeBackend.URL)
+		Expect(err).ToNot(HaveOccurred())
+		proxy, err := NewProxy("0", decodeURL, Config{Connector: ConnectorNIXLV2, SpillThresholdBytes: 64, SpillDir: spillDir})
+		Expect(err).ToNot(HaveOccurred())
+
+		go func() {
+			defer GinkgoRecover()
+			Expect(proxy.Start(ctx)).To(Succeed())
+		}()
+		time.Sleep(1 * time.Second)
+		Expect(proxy.Addr()).ToNot(BeNil())
+
+		prompt := strings.Repeat("Hello ", 1000)
+		body := `{"model": "Qwen/Qwen2-0.5B", "messages": [{"role": "user", "content": "` + prompt + `"}], "max_tokens": 16, "stream": false}`
+		req, err := http.NewRequest(http.MethodPost, "http://"+proxy.Addr().String()+ChatCompletionsPath, strings.NewReader(body))
+		Expect(err).ToNot(HaveOccurred())
+		req.Header.Add(requestHeaderPrefillHostPort, prefillBackend.URL[len("http://"):])
+
+		resp, err := http.DefaultClient.Do(req)
+		Expect(err).ToNot(HaveOccurred())
+		defer resp.Body.Close() //nolint:all
+		Expect(resp.StatusCode).To(Equal(http.StatusOK))
+
+		Expect(prefillHandler.CompletionRequests).To(HaveLen(1))
+		Expect(prefillHandler.CompletionRequests[0]).To(HaveKeyWithValue(requestFieldMaxTokens, BeNumerically("==", 1)))
+
+		Expect(decodeHandler.CompletionRequests).To(HaveLen(1))
+		decodeRequest := decodeHandler.CompletionRequests[0]
+		Expect(decodeRequest).To(HaveKeyWithValue(requestFieldMaxTokens, BeNumerically("==", 16)))
+		Expect(decodeRequest).To(HaveKey(requestFieldKVTransferParams))
+		Expect(decodeRequest[requestFieldMessages]).To(ConsistOf(HaveKeyWithValue("content", prompt)))
+
+		entries, err := os.ReadDir(spillDir)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(entries).To(BeEmpty())
+	})
+})
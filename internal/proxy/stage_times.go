@@ -0,0 +1,130 @@
+/*
+Copyright 2025 The llm-d Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package proxy
+
+import (
+	"context"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+// requestHeaderSentAt carries the wall-clock time a prefill request was sent, so the prefill
+// side measures the network delay and clock skew between the pods
+const requestHeaderSentAt = "x-llm-d-sent-at"
+
+// The protocol stages of the completion requests timed by the proxy legs
+const (
+	timePrefillSent = iota
+	timePrefillFirstByte
+	timeDecodeSent
+	timedStages
+)
+
+// stageTimes are the wall-clock times of the protocol stages of a completion request, in
+// Unix nanoseconds, zero when the stage did not happen. A stage run again, e.g. a retried
+// prefill or a hedged decode, records its last attempt.
+type stageTimes [timedStages]atomic.Int64
+
+// recordStage records the time of a stage of the completion request of the context, if any.
+// A zero time, e.g. a prefill failing before its first byte, records nothing.
+func recordStage(ctx context.Context, stage int, t time.Time) {
+	if t.IsZero() {
+		return
+	}
+	if info := requestInfoFrom(ctx); info != nil {
+		info.stages[stage].Store(t.UnixNano())
+	}
+}
+
+// time returns the time of a stage, zero when the stage did not happen
+func (s *stageTimes) time(stage int) time.Time {
+	nanos := s[stage].Load()
+	if nanos == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, nanos)
+}
+
+// stageEvent is a protocol stage of a completion request at its time
+type stageEvent struct {
+	name string
+	key  string
+	time time.Time
+}
+
+// stageEvents returns the protocol stages a completion request went through, in order
+func stageEvents(info *requestInfo, rec *sizeRecorder) []stageEvent {
+	events := make([]stageEvent, 0, 5)
+	for _, event := range []stageEvent{
+		{"received", "received", info.received},
+		{"prefill sent", "prefillSent", info.stages.time(timePrefillSent)},
+		{"prefill first byte", "prefillFirstByte", info.stages.time(timePrefillFirstByte)},
+		{"decode sent", "decodeSent", info.stages.time(timeDecodeSent)},
+		{"first token", "firstToken", rec.firstByte},
+	} {
+		if !event.time.IsZero() {
+			events = append(events, event)
+		}
+	}
+	return events
+}
+
+// recordStages adds the protocol stages of a completion request as events to its span, if
+// recording, and logs them with -access-log
+func (s *Server) recordStages(r *http.Request, info *requestInfo, rec *sizeRecorder, statusCode int, duration time.Duration) {
+	span := trace.SpanFromContext(r.Context())
+	if !span.IsRecording() && !s.config.AccessLog {
+		return
+	}
+
+	events := stageEvents(info, rec)
+	if span.IsRecording() {
+		for _, event := range events {
+			span.AddEvent(event.name, trace.WithTimestamp(event.time))
+		}
+	}
+	if !s.config.AccessLog {
+		return
+	}
+
+	values := []any{
+		"route", info.route,
+		"model", info.model,
+		"target", info.prefiller,
+		"code", statusCode,
+		"requestBytes", info.size,
+		"responseBytes", rec.size,
+		"duration", duration,
+		"requestID", contextRequestID(r.Context()),
+		"traceID", traceID(r.Header),
+	}
+	for _, event := range events {
+		values = append(values, event.key, event.time.UTC().Format(time.RFC3339Nano))
+	}
+	if !rec.firstByte.IsZero() {
+		values = append(values, "ttft", rec.firstByte.Sub(info.received))
+	}
+	// on the prefill side, the delay since the decode side sent the request: the network
+	// delay plus the clock skew between the pods
+	if sentAt, err := time.Parse(time.RFC3339Nano, r.Header.Get(requestHeaderSentAt)); err == nil {
+		values = append(values, "callerSentAt", sentAt.UTC().Format(time.RFC3339Nano), "callerDelay", info.received.Sub(sentAt))
+	}
+	s.logger.Info("request served", values...)
+}
@@ -0,0 +1,143 @@
+/*
+Copyright 2025 The llm-d Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package proxy
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/llm-d/llm-d-routing-sidecar/test/mock"
+	. "github.com/onsi/ginkgo/v2" // nolint:revive
+	. "github.com/onsi/gomega"    // nolint:revive
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"k8s.io/klog/v2"
+	"k8s.io/klog/v2/ktesting"
+)
+
+var _ = Describe("Stage times", func() {
+	It("should log the stages of the requests served and send the prefill time", func() {
+		logger := ktesting.NewLogger(GinkgoT(), ktesting.NewConfig(ktesting.BufferLogs(true)))
+		logs := logger.GetSink().(ktesting.Underlier).GetBuffer()
+		ctx, cancelFn := context.WithCancel(klog.NewContext(context.Background(), logger))
+		DeferCleanup(cancelFn)
+
+		decodeBackend := httptest.NewServer(&mock.ChatCompletionHandler{Connector: ConnectorNIXLV2, Role: mock.RoleDecode})
+		DeferCleanup(decodeBackend.Close)
+		sentAt := make(chan string, 1)
+		prefillHandler := &mock.ChatCompletionHandler{Connector: ConnectorNIXLV2, Role: mock.RolePrefill}
+		prefillBackend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			sentAt <- r.Header.Get(requestHeaderSentAt)
+			prefillHandler.ServeHTTP(w, r)
+		}))
+		DeferCleanup(prefillBackend.Close)
+
+		decodeURL, err := url.Parse(decodeBackend.URL)
+		Expect(err).ToNot(HaveOccurred())
+		proxy, err := NewProxy("0", decodeURL, Config{Connector: ConnectorNIXLV2, AccessLog: true})
+		Expect(err).ToNot(HaveOccurred())
+		go func() {
+			defer GinkgoRecover()
+			Expect(proxy.Start(ctx)).To(Succeed())
+		}()
+		time.Sleep(1 * time.Second)
+		Expect(proxy.Addr()).ToNot(BeNil())
+
+		body := `{"model": "llama", "prompt": "Hello", "max_tokens": 10}`
+		req, err := http.NewRequest(http.MethodPost, "http://"+proxy.Addr().String()+CompletionsPath, strings.NewReader(body))
+		Expect(err).ToNot(HaveOccurred())
+		req.Header.Add(requestHeaderPrefillHostPort, prefillBackend.URL[len("http://"):])
+		resp, err := http.DefaultClient.Do(req)
+		Expect(err).ToNot(HaveOccurred())
+		resp.Body.Close() //nolint:all
+		Expect(resp.StatusCode).To(Equal(http.StatusOK))
+
+		var header string
+		Eventually(sentAt).Should(Receive(&header))
+		_, err = time.Parse(time.RFC3339Nano, header)
+		Expect(err).ToNot(HaveOccurred())
+
+		Eventually(logs.String).Should(ContainSubstring("request served"))
+		for _, key := range []string{"received", "prefillSent", "prefillFirstByte", "decodeSent", "firstToken", "ttft"} {
+			Expect(logs.String()).To(ContainSubstring(key + "="))
+		}
+		Expect(logs.String()).To(ContainSubstring(`model="llama"`))
+	})
+
+	It("should add the stages as events to the span of the request", func() {
+		recorder := tracetest.NewSpanRecorder()
+		provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+		spanCtx, span := provider.Tracer("test").Start(context.Background(), "request")
+
+		server := &Server{logger: klog.Background()}
+		r := httptest.NewRequest(http.MethodPost, CompletionsPath, nil).WithContext(spanCtx)
+		received := time.Now().Add(-time.Second)
+		info := &requestInfo{route: CompletionsPath, model: "llama", received: received}
+		r = r.WithContext(context.WithValue(r.Context(), requestInfoKey{}, info))
+		recordStage(r.Context(), timeDecodeSent, received.Add(100*time.Millisecond))
+		rec := &sizeRecorder{firstByte: received.Add(200 * time.Millisecond)}
+		server.recordStages(r, info, rec, http.StatusOK, time.Second)
+		span.End()
+
+		Expect(recorder.Ended()).To(HaveLen(1))
+		events := recorder.Ended()[0].Events()
+		Expect(events).To(HaveLen(3))
+		Expect(events[0].Name).To(Equal("received"))
+		Expect(events[0].Time).To(BeTemporally("==", received))
+		Expect(events[1].Name).To(Equal("decode sent"))
+		Expect(events[1].Time).To(BeTemporally("==", received.Add(100*time.Millisecond)))
+		Expect(events[2].Name).To(Equal("first token"))
+		Expect(events[2].Time).To(BeTemporally("==", received.Add(200*time.Millisecond)))
+	})
+
+	It("should log the delay since the caller sent the request", func() {
+		logger := ktesting.NewLogger(GinkgoT(), ktesting.NewConfig(ktesting.BufferLogs(true)))
+		logs := logger.GetSink().(ktesting.Underlier).GetBuffer()
+
+		server := &Server{logger: logger, config: Config{AccessLog: true}}
+		received := time.Now()
+		r := httptest.NewRequest(http.MethodPost, CompletionsPath, nil)
+		r.Header.Set(requestHeaderSentAt, received.Add(-250*time.Millisecond).UTC().Format(time.RFC3339Nano))
+		server.recordStages(r, &requestInfo{route: CompletionsPath, received: received}, &sizeRecorder{}, http.StatusOK, time.Second)
+
+		Expect(logs.String()).To(ContainSubstring(`callerDelay="250ms"`))
+		Expect(logs.String()).ToNot(ContainSubstring("ttft"))
+	})
+
+	It("should not record the first byte of a prefill failing before it", func() {
+		logger := ktesting.NewLogger(GinkgoT(), ktesting.NewConfig(ktesting.BufferLogs(true)))
+		logs := logger.GetSink().(ktesting.Underlier).GetBuffer()
+
+		server := &Server{logger: logger, config: Config{AccessLog: true}}
+		info := &requestInfo{route: CompletionsPath, received: time.Now()}
+		r := httptest.NewRequest(http.MethodPost, CompletionsPath, nil)
+		r = r.WithContext(context.WithValue(r.Context(), requestInfoKey{}, info))
+		// the prefill is canceled before the prefiller writes its headers
+		pw, _ := server.sendPrefillRequest(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}), r)
+		Expect(pw.firstByte.IsZero()).To(BeTrue())
+
+		Expect(info.stages.time(timePrefillSent).IsZero()).To(BeFalse())
+		Expect(info.stages.time(timePrefillFirstByte).IsZero()).To(BeTrue())
+		server.recordStages(r, info, &sizeRecorder{}, http.StatusBadGateway, time.Second)
+		Expect(logs.String()).To(ContainSubstring("prefillSent="))
+		Expect(logs.String()).ToNot(ContainSubstring("prefillFirstByte"))
+	})
+})
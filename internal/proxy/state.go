@@ -0,0 +1,71 @@
+/*
+Copyright 2025 The llm-d Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package proxy
+
+import (
+	"github.com/go-logr/logr"
+)
+
+// State is a snapshot of the proxy runtime state, used for post-incident analysis
+type State struct {
+	Port             string            `json:"port"`
+	DataParallelRank int               `json:"dataParallelRank"`
+	Pool             string            `json:"pool,omitempty"`
+	Connector        string            `json:"connector"`
+	Sleeping         bool              `json:"sleeping"`
+	InflightRequests []InflightRequest `json:"inflightRequests"`
+	PrefillerProxies []string          `json:"prefillerProxies"`
+	Allowlist        AllowlistSnapshot `json:"allowlist"`
+}
+
+// State returns a snapshot of the in-flight requests, the cached prefiller proxies and the allowlist
+func (s *Server) State() State {
+	return State{
+		Port:             s.port,
+		DataParallelRank: s.config.DataParallelRank,
+		Pool:             s.config.Pool,
+		Connector:        s.current().config.Connector,
+		Sleeping:         s.sleeping.Load(),
+		InflightRequests: s.inflight.snapshot(),
+		PrefillerProxies: s.prefillerProxies.Keys(),
+		Allowlist:        s.allowlistValidator.Snapshot(),
+	}
+}
+
+// LogState writes a snapshot of the proxy runtime state to the given logger
+func (s *Server) LogState(logger logr.Logger) {
+	state := s.State()
+
+	logger.Info("state dump",
+		"port", state.Port,
+		"dataParallelRank", state.DataParallelRank,
+		"pool", state.Pool,
+		"connector", state.Connector,
+		"inflightCount", len(state.InflightRequests),
+		"prefillerProxies", state.PrefillerProxies,
+		"allowlist", state.Allowlist)
+
+	for _, req := range state.InflightRequests {
+		logger.Info("in-flight request",
+			"id", req.ID,
+			"method", req.Method,
+			"path", req.Path,
+			"prefiller", req.Prefiller,
+			"stage", req.Stage,
+			"ageSeconds", req.AgeSeconds)
+	}
+}
@@ -0,0 +1,141 @@
+/*
+Copyright 2025 The llm-d Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package proxy
+
+import (
+	"context"
+	"math"
+	"math/rand/v2"
+	"slices"
+	"sync"
+	"time"
+)
+
+// maxStatsSamples bounds the latencies sampled per interval to estimate the percentiles
+const maxStatsSamples = 10000
+
+// statsCollector aggregates the requests handled since the last stats log
+type statsCollector struct {
+	mu          sync.Mutex
+	requests    int64
+	errors      int64
+	completions int64
+	bypassed    int64
+	latencies   []time.Duration // uniform sample of the request latencies
+}
+
+// stats summarizes the requests handled during an interval
+type stats struct {
+	requests    int64
+	errors      int64
+	completions int64
+	bypassed    int64
+	p50         time.Duration
+	p99         time.Duration
+}
+
+func newStatsCollector() *statsCollector {
+	return &statsCollector{}
+}
+
+// recordRequest records a request handled by the proxy. Server errors count as errors.
+func (c *statsCollector) recordRequest(statusCode int, duration time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.requests++
+	if statusCode >= 500 {
+		c.errors++
+	}
+
+	// reservoir sampling, so the percentiles cost the same at any rate
+	if len(c.latencies) < maxStatsSamples {
+		c.latencies = append(c.latencies, duration)
+	} else if i := rand.Int64N(c.requests); i < maxStatsSamples {
+		c.latencies[i] = duration
+	}
+}
+
+// recordCompletion records a completion request, bypassing the disaggregated prefill or not
+func (c *statsCollector) recordCompletion(disaggregated bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.completions++
+	if !disaggregated {
+		c.bypassed++
+	}
+}
+
+// reset returns the stats of the requests recorded since the last reset
+func (c *statsCollector) reset() stats {
+	c.mu.Lock()
+	st := stats{requests: c.requests, errors: c.errors, completions: c.completions, bypassed: c.bypassed}
+	latencies := c.latencies
+	c.requests, c.errors, c.completions, c.bypassed = 0, 0, 0, 0
+	c.latencies = make([]time.Duration, 0, len(latencies))
+	c.mu.Unlock()
+
+	slices.Sort(latencies)
+	st.p50 = percentile(latencies, 0.5)
+	st.p99 = percentile(latencies, 0.99)
+	return st
+}
+
+// percentile returns the nearest-rank percentile of the sorted latencies
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	return sorted[int(math.Ceil(p*float64(len(sorted))))-1]
+}
+
+// logStats logs the stats of the requests handled during each interval, until ctx is done
+func (s *Server) logStats(ctx context.Context) {
+	interval := s.config.StatsLogInterval
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		st := s.stats.reset()
+		s.logger.Info("stats",
+			"interval", interval,
+			"requests", st.requests,
+			"rps", round(float64(st.requests)/interval.Seconds()),
+			"errorRate", ratio(st.errors, st.requests),
+			"p50", st.p50.Round(time.Microsecond),
+			"p99", st.p99.Round(time.Microsecond),
+			"prefillBypassRate", ratio(st.bypassed, st.completions))
+	}
+}
+
+// ratio returns n/total rounded for logging, zero when total is zero
+func ratio(n int64, total int64) float64 {
+	if total == 0 {
+		return 0
+	}
+	return round(float64(n) / float64(total))
+}
+
+// round rounds a logged value to 3 decimals
+func round(v float64) float64 {
+	return math.Round(v*1000) / 1000
+}
@@ -0,0 +1,102 @@
+/*
+Copyright 2025 The llm-d Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package proxy
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/llm-d/llm-d-routing-sidecar/test/mock"
+	. "github.com/onsi/ginkgo/v2" // nolint:revive
+	. "github.com/onsi/gomega"    // nolint:revive
+	"k8s.io/klog/v2"
+	"k8s.io/klog/v2/ktesting"
+)
+
+var _ = Describe("Stats", func() {
+	It("should summarize the requests since the last reset", func() {
+		collector := newStatsCollector()
+		for i := 1; i <= 100; i++ {
+			statusCode := http.StatusOK
+			if i%10 == 0 {
+				statusCode = http.StatusBadGateway
+			}
+			collector.recordRequest(statusCode, time.Duration(i)*time.Millisecond)
+		}
+		collector.recordCompletion(true)
+		collector.recordCompletion(false)
+		collector.recordCompletion(true)
+		collector.recordCompletion(true)
+
+		st := collector.reset()
+		Expect(st.requests).To(BeNumerically("==", 100))
+		Expect(st.errors).To(BeNumerically("==", 10))
+		Expect(st.completions).To(BeNumerically("==", 4))
+		Expect(st.bypassed).To(BeNumerically("==", 1))
+		Expect(st.p50).To(Equal(50 * time.Millisecond))
+		Expect(st.p99).To(Equal(99 * time.Millisecond))
+
+		Expect(collector.reset()).To(Equal(stats{}))
+	})
+
+	It("should bound the sampled latencies", func() {
+		collector := newStatsCollector()
+		for range 3 * maxStatsSamples {
+			collector.recordRequest(http.StatusOK, time.Second)
+		}
+		Expect(collector.latencies).To(HaveLen(maxStatsSamples))
+
+		st := collector.reset()
+		Expect(st.requests).To(BeNumerically("==", 3*maxStatsSamples))
+		Expect(st.p99).To(Equal(time.Second))
+	})
+
+	It("should log the stats of each interval", func() {
+		logger := ktesting.NewLogger(GinkgoT(), ktesting.NewConfig(ktesting.BufferLogs(true)))
+		logs := logger.GetSink().(ktesting.Underlier).GetBuffer()
+		ctx, cancelFn := context.WithCancel(klog.NewContext(context.Background(), logger))
+		DeferCleanup(cancelFn)
+
+		decodeBackend := httptest.NewServer(&mock.ChatCompletionHandler{Connector: ConnectorNIXLV2, Role: mock.RoleDecode})
+		DeferCleanup(decodeBackend.Close)
+		decodeURL, err := url.Parse(decodeBackend.URL)
+		Expect(err).ToNot(HaveOccurred())
+
+		proxy, err := NewProxy("0", decodeURL, Config{Connector: ConnectorNIXLV2, StatsLogInterval: 500 * time.Millisecond})
+		Expect(err).ToNot(HaveOccurred())
+		go func() {
+			defer GinkgoRecover()
+			Expect(proxy.Start(ctx)).To(Succeed())
+		}()
+		time.Sleep(1 * time.Second)
+		Expect(proxy.Addr()).ToNot(BeNil())
+
+		// decode-only request, bypassing the disaggregated prefill
+		body := `{"model": "llama", "prompt": "Hello", "max_tokens": 10}`
+		resp, err := http.Post("http://"+proxy.Addr().String()+CompletionsPath, "application/json", strings.NewReader(body))
+		Expect(err).ToNot(HaveOccurred())
+		resp.Body.Close() //nolint:all
+		Expect(resp.StatusCode).To(Equal(http.StatusOK))
+
+		Eventually(logs.String, 2*time.Second).Should(ContainSubstring("requests=1 rps=2 errorRate=0"))
+		Expect(logs.String()).To(ContainSubstring("prefillBypassRate=1"))
+	})
+})
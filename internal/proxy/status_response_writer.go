@@ -17,15 +17,17 @@ limitations under the License.
 package proxy
 
 import (
+	"bytes"
 	"net/http"
-	"strings"
+	"time"
 )
 
 // bufferedResponseWriter receives responses from prefillers
 type bufferedResponseWriter struct {
 	headers    http.Header
-	buffer     strings.Builder
+	buffer     bytes.Buffer
 	statusCode int
+	firstByte  time.Time // when the response headers were written
 }
 
 func (w *bufferedResponseWriter) Header() http.Header {
@@ -37,11 +39,14 @@ func (w *bufferedResponseWriter) Header() http.Header {
 
 func (w *bufferedResponseWriter) Write(b []byte) (int, error) {
 	if w.statusCode == 0 {
-		w.statusCode = http.StatusOK
+		w.WriteHeader(http.StatusOK)
 	}
 	return w.buffer.Write(b)
 }
 
 func (w *bufferedResponseWriter) WriteHeader(statusCode int) {
+	if w.firstByte.IsZero() {
+		w.firstByte = time.Now()
+	}
 	w.statusCode = statusCode
 }
@@ -0,0 +1,144 @@
+/*
+Copyright 2025 The llm-d Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package proxy
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/llm-d/llm-d-routing-sidecar/test/mock"
+	. "github.com/onsi/ginkgo/v2" // nolint:revive
+	. "github.com/onsi/gomega"    // nolint:revive
+	"k8s.io/klog/v2/ktesting"
+)
+
+var _ = Describe("Stream integrity", func() {
+	const (
+		tools          = `[{"type":"function","function":{"name":"get_weather","parameters":{"type":"object","properties":{"location":{"type":"string"},"unit":{"enum":["celsius","fahrenheit"]}},"required":["location"]}}}]`
+		responseFormat = `{"type":"json_schema","json_schema":{"name":"weather","schema":{"type":"object","properties":{"zeta":{"type":"string"},"alpha":{"type":"integer","maximum":12345678901234567890}}}}}`
+		seed           = `12345678901234567890`
+	)
+
+	var (
+		ctx          context.Context
+		decodeBody   chan string
+		chunks       []string
+		ack          chan struct{}
+		proxy        *Server
+		prefillHost  string
+		proxyBaseURL string
+	)
+
+	BeforeEach(func() {
+		_, ctx = ktesting.NewTestContext(GinkgoT())
+		var cancelFn context.CancelFunc
+		ctx, cancelFn = context.WithCancel(ctx)
+		DeferCleanup(cancelFn)
+
+		// Tool call arguments split across deltas, as streamed by vLLM
+		chunks = []string{
+			`{"choices":[{"index":0,"delta":{"role":"assistant","tool_calls":[{"index":0,"id":"call_1","type":"function","function":{"name":"get_weather","arguments":""}}]}}]}`,
+			`{"choices":[{"index":0,"delta":{"tool_calls":[{"index":0,"function":{"arguments":"{\"loc"}}]}}]}`,
+			`{"choices":[{"index":0,"delta":{"tool_calls":[{"index":0,"function":{"arguments":"ation\": \"Par"}}]}}]}`,
+			`{"choices":[{"index":0,"delta":{"tool_calls":[{"index":0,"function":{"arguments":"is\"}"}}]}}]}`,
+			`{"choices":[{"index":0,"delta":{},"finish_reason":"tool_calls"}]}`,
+		}
+
+		// Decoder waiting for the client to receive each chunk before sending the next one
+		decodeBody = make(chan string, 1)
+		ack = make(chan struct{})
+		decodeBackend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			b, _ := io.ReadAll(r.Body) //nolint:all
+			decodeBody <- string(b)
+
+			w.Header().Set("Content-Type", "text/event-stream")
+			for _, chunk := range chunks {
+				fmt.Fprintf(w, "data: %s\n\n", chunk) //nolint:all
+				w.(http.Flusher).Flush()
+				select {
+				case <-ack:
+				case <-r.Context().Done():
+					return
+				}
+			}
+		}))
+		DeferCleanup(decodeBackend.Close)
+
+		prefillBackend := httptest.NewServer(&mock.ChatCompletionHandler{
+			Connector: ConnectorNIXLV2,
+			Role:      mock.RolePrefill,
+		})
+		DeferCleanup(prefillBackend.Close)
+		prefillHost = prefillBackend.URL[len("http://"):]
+
+		decodeURL, err := url.Parse(decodeBackend.URL)
+		Expect(err).ToNot(HaveOccurred())
+		proxy, err = NewProxy("0", decodeURL, Config{Connector: ConnectorNIXLV2})
+		Expect(err).ToNot(HaveOccurred())
+
+		go func() {
+			defer GinkgoRecover()
+			Expect(proxy.Start(ctx)).To(Succeed())
+		}()
+		time.Sleep(1 * time.Second)
+		Expect(proxy.Addr()).ToNot(BeNil())
+		proxyBaseURL = "http://" + proxy.Addr().String()
+	})
+
+	It("should forward each tool call delta unchanged and as soon as it is streamed", func() {
+		body := `{"model": "Qwen/Qwen2-0.5B", "stream": true, "seed": ` + seed + `,
+			"messages": [{"role": "user", "content": "What's the weather in Paris?"}],
+			"tools": ` + tools + `, "response_format": ` + responseFormat + `}`
+
+		req, err := http.NewRequest(http.MethodPost, proxyBaseURL+ChatCompletionsPath, strings.NewReader(body))
+		Expect(err).ToNot(HaveOccurred())
+		req.Header.Add(requestHeaderPrefillHostPort, prefillHost)
+
+		resp, err := http.DefaultClient.Do(req)
+		Expect(err).ToNot(HaveOccurred())
+		defer resp.Body.Close() //nolint:all
+		Expect(resp.StatusCode).To(Equal(http.StatusOK))
+
+		By("receiving each chunk before the decoder sends the next one")
+		reader := bufio.NewReader(resp.Body)
+		for _, chunk := range chunks {
+			line, err := reader.ReadString('\n')
+			Expect(err).ToNot(HaveOccurred())
+			Expect(line).To(Equal("data: " + chunk + "\n"))
+
+			line, err = reader.ReadString('\n')
+			Expect(err).ToNot(HaveOccurred())
+			Expect(line).To(Equal("\n"))
+
+			Eventually(ack).WithTimeout(5 * time.Second).Should(BeSent(struct{}{}))
+		}
+
+		By("forwarding the nested request fields byte for byte")
+		var decoded string
+		Eventually(decodeBody).Should(Receive(&decoded))
+		Expect(decoded).To(ContainSubstring(`"tools":` + tools))
+		Expect(decoded).To(ContainSubstring(`"response_format":` + responseFormat))
+		Expect(decoded).To(ContainSubstring(`"seed":` + seed))
+	})
+})
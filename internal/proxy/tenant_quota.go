@@ -0,0 +1,107 @@
+/*
+Copyright 2025 The llm-d Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package proxy
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"sync"
+)
+
+// TenantQuotaWildcard is the tenant of the quota applying to the tenants without their own quota
+const TenantQuotaWildcard = "*"
+
+// tenantCounter counts the requests in flight by tenant. It is shared by the configurations
+// so that reloaded quotas apply to the requests already in flight.
+type tenantCounter struct {
+	mu       sync.Mutex
+	inflight map[string]int // the tenants with requests in flight
+}
+
+// newTenantCounter creates a counter without requests in flight
+func newTenantCounter() *tenantCounter {
+	return &tenantCounter{
+		inflight: make(map[string]int),
+	}
+}
+
+// acquire counts a request of the tenant, unless the tenant already has quota requests in flight
+func (c *tenantCounter) acquire(tenant string, quota int) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.inflight[tenant] >= quota {
+		return false
+	}
+	c.inflight[tenant]++
+	return true
+}
+
+// release ends a request of the tenant
+func (c *tenantCounter) release(tenant string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.inflight[tenant] <= 1 {
+		delete(c.inflight, tenant)
+		return
+	}
+	c.inflight[tenant]--
+}
+
+// tenantQuota returns the concurrency quota of a tenant, if any
+func tenantQuota(quotas map[string]int, tenant string) (int, bool) {
+	if quota, ok := quotas[tenant]; ok {
+		return quota, true
+	}
+	quota, ok := quotas[TenantQuotaWildcard]
+	return quota, ok
+}
+
+// limitTenant rejects with 429 the requests of the tenants exceeding their concurrency quota.
+// The requests of the tenants without quota are counted nonetheless, for the quotas of a
+// reloaded configuration. The requests without tenant header are not limited.
+func (s *Server) limitTenant(next http.Handler) http.Handler {
+	if s.config.TenantHeader == "" {
+		return next
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		tenant := r.Header.Get(s.config.TenantHeader)
+		if tenant == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		quota, ok := tenantQuota(s.config.TenantConcurrencyQuotas, tenant)
+		if !ok {
+			quota = math.MaxInt
+		}
+
+		if !s.tenants.acquire(tenant, quota) {
+			s.logger.V(4).Info("tenant concurrency quota exceeded", "tenant", tenant, "quota", quota)
+			w.Header().Set("Retry-After", admissionRetryAfter)
+			message := fmt.Sprintf("tenant %q exceeded its quota of %d concurrent requests", tenant, quota)
+			if err := errorStatus(http.StatusTooManyRequests, message, w); err != nil {
+				s.logger.Error(err, "failed to send error response to client")
+			}
+			return
+		}
+		defer s.tenants.release(tenant)
+
+		next.ServeHTTP(w, r)
+	})
+}
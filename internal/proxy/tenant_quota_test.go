@@ -0,0 +1,120 @@
+/*
+Copyright 2025 The llm-d Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+
+	"github.com/go-logr/logr"
+	. "github.com/onsi/ginkgo/v2" // nolint:revive
+	. "github.com/onsi/gomega"    // nolint:revive
+)
+
+var _ = Describe("Tenant concurrency quotas", func() {
+	var (
+		s       *Server
+		release chan struct{}
+		served  chan struct{}
+	)
+
+	BeforeEach(func() {
+		s = &Server{
+			config: Config{
+				TenantHeader:            "X-Tenant",
+				TenantConcurrencyQuotas: map[string]int{"acme": 2, TenantQuotaWildcard: 1},
+			},
+			tenants: newTenantCounter(),
+			logger:  logr.Discard(),
+		}
+		release = make(chan struct{})
+		served = make(chan struct{}, 8)
+		DeferCleanup(func() { close(release) })
+	})
+
+	handler := func() http.Handler {
+		release, served := release, served
+		return s.limitTenant(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+			served <- struct{}{}
+			<-release
+			w.WriteHeader(http.StatusOK)
+		}))
+	}
+
+	// hold sends a request held until release is closed
+	hold := func(h http.Handler, tenant string) {
+		req := httptest.NewRequest(http.MethodPost, CompletionsPath, nil)
+		req.Header.Set("X-Tenant", tenant)
+		go h.ServeHTTP(httptest.NewRecorder(), req)
+		Eventually(served).Should(Receive())
+	}
+
+	send := func(h http.Handler, tenant string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, CompletionsPath, nil)
+		if tenant != "" {
+			req.Header.Set("X-Tenant", tenant)
+		}
+		h.ServeHTTP(rec, req)
+		return rec
+	}
+
+	It("should reject the requests of the tenants exceeding their quota", func() {
+		h := handler()
+		hold(h, "acme")
+		hold(h, "acme")
+
+		rec := send(h, "acme")
+		Expect(rec.Code).To(Equal(http.StatusTooManyRequests))
+		Expect(rec.Header().Get("Retry-After")).To(Equal("1"))
+		Expect(rec.Body.String()).To(ContainSubstring(`tenant \"acme\" exceeded its quota of 2 concurrent requests`))
+
+		// the other tenants get the wildcard quota
+		hold(h, "globex")
+		Expect(send(h, "globex").Code).To(Equal(http.StatusTooManyRequests))
+		hold(h, "initech")
+	})
+
+	It("should not limit the requests without tenant", func() {
+		h := handler()
+		go func() {
+			defer GinkgoRecover()
+			send(h, "")
+		}()
+		Eventually(served).Should(Receive())
+		go func() {
+			defer GinkgoRecover()
+			send(h, "")
+		}()
+		Eventually(served).Should(Receive())
+	})
+
+	It("should free the quota once the requests are served", func() {
+		c := newTenantCounter()
+		Expect(c.acquire("acme", 1)).To(BeTrue())
+		Expect(c.acquire("acme", 1)).To(BeFalse())
+		c.release("acme")
+		Expect(c.inflight).To(BeEmpty())
+		Expect(c.acquire("acme", 1)).To(BeTrue())
+	})
+
+	It("should not wrap the handler without tenant header", func() {
+		s.config.TenantHeader = ""
+		next := http.HandlerFunc(func(http.ResponseWriter, *http.Request) {})
+		Expect(s.limitTenant(next)).To(BeAssignableToTypeOf(next))
+	})
+})
@@ -0,0 +1,126 @@
+/*
+Copyright 2025 The llm-d Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package proxy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/llm-d/llm-d-routing-sidecar/internal/metrics"
+)
+
+// Timeouts of the completion requests, as metrics label values
+const (
+	timeoutDeadline = "deadline"
+	timeoutIdle     = "idle"
+)
+
+// errRequestTimeout is the cause of the completion requests canceled by a timeout
+var errRequestTimeout = errors.New("request timed out")
+
+// timeoutWriter cancels a completion request when its timer expires, and then replaces its
+// response by a 504 unless already started. The timer is reset on each write for streams.
+type timeoutWriter struct {
+	http.ResponseWriter
+	ctx     context.Context
+	timer   *time.Timer
+	timeout time.Duration
+	idle    bool
+	message string
+
+	wroteHeader bool
+	timedOut    bool // whether the response is replaced
+}
+
+// boundRequest bounds a completion request by RequestTimeout, or a streamed one by
+// StreamIdleTimeout. The returned function stops the timer once the request is served.
+func (s *Server) boundRequest(w http.ResponseWriter, r *http.Request, stream bool) (http.ResponseWriter, *http.Request, func()) {
+	timeout, kind := s.config.RequestTimeout, timeoutDeadline
+	if stream {
+		timeout, kind = s.config.StreamIdleTimeout, timeoutIdle
+	}
+	if timeout <= 0 {
+		return w, r, func() {}
+	}
+
+	// canceled rather than past a deadline, which would read as an exceeded TTFT budget
+	ctx, cancelFn := context.WithCancelCause(r.Context())
+	tw := &timeoutWriter{
+		ResponseWriter: w,
+		ctx:            ctx,
+		timeout:        timeout,
+		idle:           stream,
+		message:        fmt.Sprintf("request timed out after %s", timeout),
+	}
+	if stream {
+		tw.message = fmt.Sprintf("no token streamed for %s", timeout)
+	}
+	tw.timer = time.AfterFunc(timeout, func() {
+		s.logger.Info("completion request timed out", "timeout", kind, "duration", timeout, "path", r.URL.Path)
+		metrics.RecordRequestTimeout(s.rank(), kind)
+		cancelFn(errRequestTimeout)
+	})
+	return tw, r.WithContext(ctx), func() {
+		tw.timer.Stop()
+		tw.finish()
+		cancelFn(nil)
+	}
+}
+
+func (w *timeoutWriter) WriteHeader(statusCode int) {
+	if w.wroteHeader || statusCode < http.StatusOK {
+		if !w.timedOut {
+			w.ResponseWriter.WriteHeader(statusCode)
+		}
+		return
+	}
+	w.wroteHeader = true
+	if errors.Is(context.Cause(w.ctx), errRequestTimeout) {
+		w.timedOut = true
+		errorStatus(http.StatusGatewayTimeout, w.message, w.ResponseWriter) //nolint:all
+		return
+	}
+	w.ResponseWriter.WriteHeader(statusCode)
+}
+
+func (w *timeoutWriter) Write(b []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	if w.timedOut {
+		return len(b), nil
+	}
+	if w.idle {
+		w.timer.Reset(w.timeout)
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+// Unwrap allows http.ResponseController to flush the wrapped ResponseWriter
+func (w *timeoutWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// finish answers with a 504 the requests canceled before writing anything
+func (w *timeoutWriter) finish() {
+	if !w.wroteHeader && errors.Is(context.Cause(w.ctx), errRequestTimeout) {
+		w.WriteHeader(http.StatusGatewayTimeout)
+	}
+}
@@ -0,0 +1,106 @@
+/*
+Copyright 2025 The llm-d Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package proxy
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/go-logr/logr"
+	. "github.com/onsi/ginkgo/v2" // nolint:revive
+	. "github.com/onsi/gomega"    // nolint:revive
+	"k8s.io/klog/v2/ktesting"
+)
+
+var _ = Describe("Request timeouts", func() {
+	It("should answer the hung non-streaming requests with 504", func() {
+		_, ctx := ktesting.NewTestContext(GinkgoT())
+		ctx, cancelFn := context.WithCancel(ctx)
+		defer cancelFn()
+
+		// The decoder hangs until the request is canceled
+		decoder := httptest.NewServer(http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+			io.Copy(io.Discard, r.Body) //nolint:all
+			<-r.Context().Done()
+		}))
+		DeferCleanup(decoder.Close)
+
+		decodeURL, err := url.Parse(decoder.URL)
+		Expect(err).ToNot(HaveOccurred())
+		proxy, err := NewProxy("0", decodeURL, Config{Connector: ConnectorNIXLV2, RequestTimeout: 100 * time.Millisecond})
+		Expect(err).ToNot(HaveOccurred())
+		go func() {
+			defer GinkgoRecover()
+			Expect(proxy.Start(ctx)).To(Succeed())
+		}()
+		Eventually(func() net.Addr { return proxy.Addr() }).ShouldNot(BeNil())
+
+		resp, err := http.Post("http://"+proxy.Addr().String()+CompletionsPath, "application/json",
+			strings.NewReader(`{"model": "m", "prompt": "Hello"}`))
+		Expect(err).ToNot(HaveOccurred())
+		defer resp.Body.Close() //nolint:all
+		Expect(resp.StatusCode).To(Equal(http.StatusGatewayTimeout))
+		b, err := io.ReadAll(resp.Body)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(string(b)).To(ContainSubstring("request timed out after 100ms"))
+	})
+
+	It("should cancel the streams once idle", func() {
+		s := &Server{config: Config{StreamIdleTimeout: 250 * time.Millisecond}, logger: logr.Discard()}
+		rec := httptest.NewRecorder()
+		w, r, stop := s.boundRequest(rec, httptest.NewRequest(http.MethodPost, CompletionsPath, nil), true)
+		defer stop()
+
+		// each token resets the timer
+		for range 5 {
+			_, err := w.Write([]byte("data: {}\n\n"))
+			Expect(err).ToNot(HaveOccurred())
+			time.Sleep(50 * time.Millisecond)
+		}
+		Expect(r.Context().Err()).ToNot(HaveOccurred())
+
+		Eventually(r.Context().Done()).Should(BeClosed())
+		Expect(context.Cause(r.Context())).To(MatchError(errRequestTimeout))
+		Expect(rec.Code).To(Equal(http.StatusOK))
+		Expect(strings.Count(rec.Body.String(), "data:")).To(Equal(5))
+	})
+
+	It("should answer the requests canceled before any response with 504", func() {
+		s := &Server{config: Config{RequestTimeout: 10 * time.Millisecond}, logger: logr.Discard()}
+		rec := httptest.NewRecorder()
+		_, r, stop := s.boundRequest(rec, httptest.NewRequest(http.MethodPost, CompletionsPath, nil), false)
+		<-r.Context().Done()
+		stop()
+		Expect(rec.Code).To(Equal(http.StatusGatewayTimeout))
+	})
+
+	It("should not bound the requests without timeout", func() {
+		s := &Server{config: Config{RequestTimeout: time.Minute}, logger: logr.Discard()}
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, CompletionsPath, nil)
+		w, r, stop := s.boundRequest(rec, req, true)
+		stop()
+		Expect(w).To(BeIdenticalTo(rec))
+		Expect(r).To(BeIdenticalTo(req))
+	})
+})
@@ -0,0 +1,172 @@
+/*
+Copyright 2025 The llm-d Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package proxy
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+var (
+	// TokenizePath is the vLLM tokenize path
+	TokenizePath = "/tokenize"
+
+	// DetokenizePath is the vLLM detokenize path
+	DetokenizePath = "/detokenize"
+)
+
+// tokenizeResponse is a cached tokenize or detokenize response
+type tokenizeResponse struct {
+	statusCode  int
+	contentType string
+	body        []byte
+}
+
+// tokenizeHandler forwards tokenize and detokenize requests to the decoder, serving
+// repeated requests from the cache when enabled
+func (s *Server) tokenizeHandler(w http.ResponseWriter, r *http.Request) {
+	body, err := readRequestBody(w, r, s.config.MaxRequestBodyBytes)
+	r.Body.Close() //nolint:all
+	if err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			if err := errorRequestTooLarge(err, w); err != nil {
+				s.logger.Error(err, "failed to send error response to client")
+			}
+			return
+		}
+		// TODO: check FastAPI error code when failing to read body
+		if err := errorStatus(http.StatusBadRequest, err.Error(), w); err != nil {
+			s.logger.Error(err, "failed to send error response to client")
+		}
+		return
+	}
+
+	resp := s.tokenize(r.Context(), r.URL.Path, body, r.Header)
+	if resp.contentType != "" {
+		w.Header().Set("Content-Type", resp.contentType)
+	}
+	w.WriteHeader(resp.statusCode)
+	if _, err := w.Write(resp.body); err != nil {
+		s.logger.Error(err, "failed to send response to client")
+	}
+}
+
+// tokenize sends a tokenize or detokenize request to the decoder. Successful
+// responses are cached, keyed by the path, the body and the authorization header.
+func (s *Server) tokenize(ctx context.Context, path string, body []byte, header http.Header) *tokenizeResponse {
+	key := ""
+	if s.tokenizeCache != nil {
+		hash := sha256.New()
+		hash.Write([]byte(path + "\n" + header.Get("Authorization") + "\n"))
+		hash.Write(body)
+		key = hex.EncodeToString(hash.Sum(nil))
+
+		if resp, ok := s.tokenizeCache.Get(key); ok {
+			return resp
+		}
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, path, bytes.NewReader(body))
+	if err != nil {
+		return &tokenizeResponse{statusCode: http.StatusInternalServerError, body: []byte(err.Error())}
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if auth := header.Get("Authorization"); auth != "" {
+		req.Header.Set("Authorization", auth)
+	}
+
+	rw := &bufferedResponseWriter{}
+	s.decoderProxy.ServeHTTP(rw, req)
+
+	resp := &tokenizeResponse{
+		statusCode:  rw.statusCode,
+		contentType: rw.Header().Get("Content-Type"),
+		body:        []byte(rw.buffer.String()),
+	}
+	if s.tokenizeCache != nil && resp.statusCode == http.StatusOK {
+		s.tokenizeCache.Add(key, resp)
+	}
+	return resp
+}
+
+// promptTokenCount returns the number of tokens of the prompt of a completion or chat
+// completion request. Each message is tokenized separately, so repeated system prompts
+// are served from the tokenize cache. The chat template tokens are not counted.
+func (s *Server) promptTokenCount(ctx context.Context, p *parsedRequest, header http.Header) (int, error) {
+	texts, count := promptTexts(p.prompt)
+	for _, message := range p.chat {
+		t, c := promptTexts(message.content)
+		texts = append(texts, t...)
+		count += c
+	}
+
+	for _, text := range texts {
+		tbody, err := json.Marshal(map[string]any{
+			requestFieldModel:    p.model,
+			requestFieldPrompt:   text,
+			"add_special_tokens": false,
+		})
+		if err != nil {
+			return 0, err
+		}
+
+		resp := s.tokenize(ctx, TokenizePath, tbody, header)
+		if resp.statusCode != http.StatusOK {
+			return 0, fmt.Errorf("decoder returned status code %d", resp.statusCode)
+		}
+
+		var tokens struct {
+			Count int `json:"count"`
+		}
+		if err := json.Unmarshal(resp.body, &tokens); err != nil {
+			return 0, err
+		}
+		count += tokens.Count
+	}
+	return count, nil
+}
+
+// promptTexts returns the texts of a prompt to tokenize, and its number of token IDs
+func promptTexts(prompt any) ([]string, int) {
+	switch p := prompt.(type) {
+	case string:
+		return []string{p}, 0
+	case float64:
+		return nil, 1
+	case []any:
+		texts := []string{}
+		count := 0
+		for _, item := range p {
+			t, c := promptTexts(item)
+			texts = append(texts, t...)
+			count += c
+		}
+		return texts, count
+	case map[string]any:
+		if text, ok := p["text"].(string); ok {
+			return []string{text}, 0
+		}
+	}
+	return nil, 0
+}
@@ -0,0 +1,153 @@
+/*
+Copyright 2025 The llm-d Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package proxy
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/llm-d/llm-d-routing-sidecar/test/mock"
+	. "github.com/onsi/ginkgo/v2" // nolint:revive
+	. "github.com/onsi/gomega"    // nolint:revive
+	"k8s.io/klog/v2/ktesting"
+)
+
+var _ = Describe("Tokenize", func() {
+	var (
+		ctx            context.Context
+		tokenizeCount  atomic.Int32
+		decodeHandler  *mock.ChatCompletionHandler
+		prefillHandler *mock.ChatCompletionHandler
+		prefillHost    string
+		decodeURL      *url.URL
+	)
+
+	BeforeEach(func() {
+		_, ctx = ktesting.NewTestContext(GinkgoT())
+		var cancelFn context.CancelFunc
+		ctx, cancelFn = context.WithCancel(ctx)
+		DeferCleanup(cancelFn)
+
+		// Decoder tokenizing prompts into words
+		tokenizeCount.Store(0)
+		decodeHandler = &mock.ChatCompletionHandler{Connector: ConnectorNIXLV2, Role: mock.RoleDecode}
+		decodeMux := http.NewServeMux()
+		decodeMux.HandleFunc("POST "+TokenizePath, func(w http.ResponseWriter, r *http.Request) {
+			tokenizeCount.Add(1)
+			var request struct {
+				Prompt string `json:"prompt"`
+			}
+			b, _ := io.ReadAll(r.Body)  //nolint:all
+			json.Unmarshal(b, &request) //nolint:all
+			w.Header().Set("Content-Type", "application/json")
+			fmt.Fprintf(w, `{"count": %d}`, len(strings.Fields(request.Prompt))) //nolint:all
+		})
+		decodeMux.Handle("/", decodeHandler)
+		decodeBackend := httptest.NewServer(decodeMux)
+		DeferCleanup(decodeBackend.Close)
+
+		prefillHandler = &mock.ChatCompletionHandler{Connector: ConnectorNIXLV2, Role: mock.RolePrefill}
+		prefillBackend := httptest.NewServer(prefillHandler)
+		DeferCleanup(prefillBackend.Close)
+		prefillHost = prefillBackend.URL[len("http://"):]
+
+		var err error
+		decodeURL, err = url.Parse(decodeBackend.URL)
+		Expect(err).ToNot(HaveOccurred())
+	})
+
+	startProxy := func(config Config) string {
+		proxy, err := NewProxy("0", decodeURL, config)
+		Expect(err).ToNot(HaveOccurred())
+
+		go func() {
+			defer GinkgoRecover()
+			Expect(proxy.Start(ctx)).To(Succeed())
+		}()
+		time.Sleep(1 * time.Second)
+		Expect(proxy.Addr()).ToNot(BeNil())
+		return "http://" + proxy.Addr().String()
+	}
+
+	post := func(u string, body string, prefill bool) string {
+		req, err := http.NewRequest(http.MethodPost, u, strings.NewReader(body))
+		Expect(err).ToNot(HaveOccurred())
+		if prefill {
+			req.Header.Add(requestHeaderPrefillHostPort, prefillHost)
+		}
+
+		resp, err := http.DefaultClient.Do(req)
+		Expect(err).ToNot(HaveOccurred())
+		defer resp.Body.Close() //nolint:all
+		Expect(resp.StatusCode).To(Equal(http.StatusOK))
+
+		b, err := io.ReadAll(resp.Body)
+		Expect(err).ToNot(HaveOccurred())
+		return string(b)
+	}
+
+	It("should forward tokenize requests without caching by default", func() {
+		proxyBaseURL := startProxy(Config{Connector: ConnectorNIXLV2})
+
+		for range 2 {
+			Expect(post(proxyBaseURL+TokenizePath, `{"model": "m", "prompt": "a b c"}`, false)).To(Equal(`{"count": 3}`))
+		}
+		Expect(tokenizeCount.Load()).To(BeNumerically("==", 2))
+	})
+
+	It("should serve repeated tokenize requests from the cache", func() {
+		proxyBaseURL := startProxy(Config{Connector: ConnectorNIXLV2, TokenizeCacheSize: 8})
+
+		for range 2 {
+			Expect(post(proxyBaseURL+TokenizePath, `{"model": "m", "prompt": "a b c"}`, false)).To(Equal(`{"count": 3}`))
+		}
+		Expect(tokenizeCount.Load()).To(BeNumerically("==", 1))
+
+		Expect(post(proxyBaseURL+TokenizePath, `{"model": "m", "prompt": "a b"}`, false)).To(Equal(`{"count": 2}`))
+		Expect(tokenizeCount.Load()).To(BeNumerically("==", 2))
+	})
+
+	It("should send short prompts decode-only", func() {
+		proxyBaseURL := startProxy(Config{Connector: ConnectorNIXLV2, TokenizeCacheSize: 8, PrefillBypassTokens: 10})
+
+		request := func(question string) string {
+			return `{"model": "m", "messages": [
+				{"role": "system", "content": "You are a helpful assistant"},
+				{"role": "user", "content": "` + question + `"}]}`
+		}
+
+		By("sending a short prompt")
+		post(proxyBaseURL+ChatCompletionsPath, request("Hello"), true)
+		Expect(prefillHandler.RequestCount.Load()).To(BeNumerically("==", 0))
+		Expect(decodeHandler.RequestCount.Load()).To(BeNumerically("==", 1))
+		Expect(tokenizeCount.Load()).To(BeNumerically("==", 2))
+
+		By("sending a long prompt with the same system prompt")
+		post(proxyBaseURL+ChatCompletionsPath, request("What is the weather like in Paris this week?"), true)
+		Expect(prefillHandler.RequestCount.Load()).To(BeNumerically("==", 1))
+		Expect(decodeHandler.RequestCount.Load()).To(BeNumerically("==", 2))
+		Expect(tokenizeCount.Load()).To(BeNumerically("==", 3))
+	})
+})
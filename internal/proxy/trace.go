@@ -0,0 +1,95 @@
+/*
+Copyright 2025 The llm-d Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package proxy
+
+import (
+	"context"
+	"net/http"
+	"strings"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	requestHeaderTraceParent = "traceparent"
+
+	// responseHeaderRequestID references the request in bug reports, also quoted by the error
+	// responses of the sidecar
+	responseHeaderRequestID = "x-llm-d-request-id"
+
+	// maxRequestIDLength bounds the request IDs of the clients echoed in the responses
+	maxRequestIDLength = 128
+)
+
+type requestIDKey struct{}
+
+// traceID returns the ID of the W3C trace context propagated with the request, if any.
+// The header is forwarded as is to the prefiller and the decoder, so the exemplars of the
+// sidecar latencies lead to the traces of both stages.
+func traceID(header http.Header) string {
+	// version-traceid-parentid-flags, parsed without allocating as it runs on every request
+	version, rest, _ := strings.Cut(header.Get(requestHeaderTraceParent), "-")
+	id, rest, _ := strings.Cut(rest, "-")
+	if len(version) != 2 || version == "ff" || !strings.Contains(rest, "-") {
+		return ""
+	}
+
+	if len(id) != 32 || strings.Trim(id, "0") == "" {
+		return ""
+	}
+	for _, c := range id {
+		if (c < '0' || c > '9') && (c < 'a' || c > 'f') && (c < 'A' || c > 'F') {
+			return ""
+		}
+	}
+	return strings.ToLower(id)
+}
+
+// requestReference returns the ID referencing a request in bug reports: its trace ID, or the
+// request ID of the client when not traced
+func requestReference(r *http.Request) string {
+	if sc := trace.SpanContextFromContext(r.Context()); sc.HasTraceID() {
+		return sc.TraceID().String()
+	}
+	if id := traceID(r.Header); id != "" {
+		return id
+	}
+	if id := r.Header.Get(requestHeaderRequestID); len(id) <= maxRequestIDLength {
+		return id
+	}
+	return ""
+}
+
+// referenceRequests returns the reference of each request in a response header, and keeps it
+// in the request context for the error events of the streams
+func referenceRequests(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := requestReference(r)
+		if id == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		w.Header().Set(responseHeaderRequestID, id)
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), requestIDKey{}, id)))
+	})
+}
+
+// contextRequestID returns the reference of the request of the given context, if any
+func contextRequestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
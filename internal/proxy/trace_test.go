@@ -0,0 +1,191 @@
+/*
+Copyright 2025 The llm-d Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package proxy
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/llm-d/llm-d-routing-sidecar/internal/identity"
+	"github.com/llm-d/llm-d-routing-sidecar/internal/metrics"
+	"github.com/llm-d/llm-d-routing-sidecar/test/mock"
+	. "github.com/onsi/ginkgo/v2" // nolint:revive
+	. "github.com/onsi/gomega"    // nolint:revive
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"k8s.io/klog/v2/ktesting"
+)
+
+var _ = Describe("Trace exemplars", func() {
+	const traceParent = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+
+	DescribeTable("should extract the trace ID of the W3C trace context",
+		func(value string, expected string) {
+			header := http.Header{}
+			if value != "" {
+				header.Set(requestHeaderTraceParent, value)
+			}
+			Expect(traceID(header)).To(Equal(expected))
+		},
+		Entry("sampled trace", traceParent, "4bf92f3577b34da6a3ce929d0e0e4736"),
+		Entry("upper case trace ID", "00-4BF92F3577B34DA6A3CE929D0E0E4736-00f067aa0ba902b7-00", "4bf92f3577b34da6a3ce929d0e0e4736"),
+		Entry("no trace context", "", ""),
+		Entry("all zero trace ID", "00-00000000000000000000000000000000-00f067aa0ba902b7-01", ""),
+		Entry("invalid trace ID", "00-4bf92f3577b34da6a3ce929d0e0e47zz-00f067aa0ba902b7-01", ""),
+		Entry("invalid version", "ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", ""),
+		Entry("truncated", "00-4bf92f3577b34da6a3ce929d0e0e4736", ""),
+	)
+
+	It("should attach the trace ID to the request latency as exemplar", func() {
+		_, ctx := ktesting.NewTestContext(GinkgoT())
+		ctx, cancelFn := context.WithCancel(ctx)
+		defer cancelFn()
+
+		decodeBackend := httptest.NewServer(&mock.GenericHandler{})
+		DeferCleanup(decodeBackend.Close)
+
+		decodeURL, err := url.Parse(decodeBackend.URL)
+		Expect(err).ToNot(HaveOccurred())
+		proxy, err := NewProxy("0", decodeURL, Config{Connector: ConnectorNIXLV2, DataParallelRank: 7})
+		Expect(err).ToNot(HaveOccurred())
+
+		go func() {
+			defer GinkgoRecover()
+			Expect(proxy.Start(ctx)).To(Succeed())
+		}()
+		time.Sleep(1 * time.Second)
+		Expect(proxy.Addr()).ToNot(BeNil())
+
+		req, err := http.NewRequest(http.MethodGet, "http://"+proxy.Addr().String()+"/v1/models", nil)
+		Expect(err).ToNot(HaveOccurred())
+		req.Header.Set(requestHeaderTraceParent, traceParent)
+		resp, err := http.DefaultClient.Do(req)
+		Expect(err).ToNot(HaveOccurred())
+		resp.Body.Close() //nolint:all
+
+		Eventually(func() []string {
+			traceIDs := []string{}
+			families, err := metrics.Registry.Gather()
+			Expect(err).ToNot(HaveOccurred())
+			for _, family := range families {
+				if family.GetName() != "llm_d_routing_sidecar_request_duration_seconds" {
+					continue
+				}
+				for _, metric := range family.Metric {
+					rank := ""
+					for _, label := range metric.Label {
+						if label.GetName() == metrics.RankLabel {
+							rank = label.GetValue()
+						}
+					}
+					if rank != "7" {
+						continue
+					}
+					for _, bucket := range metric.GetHistogram().GetBucket() {
+						for _, label := range bucket.GetExemplar().GetLabel() {
+							if label.GetName() == metrics.TraceIDLabel {
+								traceIDs = append(traceIDs, label.GetValue())
+							}
+						}
+					}
+				}
+			}
+			return traceIDs
+		}).Should(ContainElement("4bf92f3577b34da6a3ce929d0e0e4736"))
+	})
+
+	It("should attach the identity of the sidecar to the span of the request", func() {
+		recorder := tracetest.NewSpanRecorder()
+		provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+		spanCtx, span := provider.Tracer("test").Start(context.Background(), "request")
+
+		server := &Server{config: Config{Identity: identity.Identity{Pod: "decode-0", InferencePool: "pool"}}}
+		handler := server.identify(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+			w.WriteHeader(http.StatusOK)
+		}))
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, CompletionsPath, nil).WithContext(spanCtx))
+		span.End()
+
+		Expect(recorder.Ended()).To(HaveLen(1))
+		Expect(recorder.Ended()[0].Attributes()).To(ConsistOf(
+			attribute.String("k8s.pod.name", "decode-0"),
+			attribute.String("k8s.inferencepool.name", "pool"),
+		))
+	})
+})
+
+var _ = Describe("Request references", func() {
+	const traceParent = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+
+	It("should reference the requests by trace ID, or by request ID when not traced", func() {
+		provider := sdktrace.NewTracerProvider()
+		spanCtx, span := provider.Tracer("test").Start(context.Background(), "request")
+		defer span.End()
+		req := httptest.NewRequest(http.MethodPost, CompletionsPath, nil).WithContext(spanCtx)
+		Expect(requestReference(req)).To(Equal(span.SpanContext().TraceID().String()))
+
+		req = httptest.NewRequest(http.MethodPost, CompletionsPath, nil)
+		req.Header.Set(requestHeaderTraceParent, traceParent)
+		req.Header.Set(requestHeaderRequestID, "req-1")
+		Expect(requestReference(req)).To(Equal("4bf92f3577b34da6a3ce929d0e0e4736"))
+
+		req.Header.Del(requestHeaderTraceParent)
+		Expect(requestReference(req)).To(Equal("req-1"))
+
+		req.Header.Set(requestHeaderRequestID, strings.Repeat("x", maxRequestIDLength+1))
+		Expect(requestReference(req)).To(BeEmpty())
+	})
+
+	It("should quote the reference in the response header and the error responses", func() {
+		handler := referenceRequests(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+			Expect(errorStatus(http.StatusForbidden, "denied", w)).To(Succeed())
+		}))
+		req := httptest.NewRequest(http.MethodPost, CompletionsPath, nil)
+		req.Header.Set(requestHeaderRequestID, "req-1")
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+
+		Expect(rec.Header().Get(responseHeaderRequestID)).To(Equal("req-1"))
+		var er errorResponse
+		Expect(json.Unmarshal(rec.Body.Bytes(), &er)).To(Succeed())
+		Expect(er.RequestID).To(Equal("req-1"))
+		Expect(er.Code).To(Equal(http.StatusForbidden))
+	})
+
+	It("should not reference the requests without trace or request ID", func() {
+		handler := referenceRequests(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+			Expect(errorStatus(http.StatusForbidden, "denied", w)).To(Succeed())
+		}))
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, CompletionsPath, nil))
+
+		Expect(rec.Header().Values(responseHeaderRequestID)).To(BeEmpty())
+		Expect(rec.Body.String()).ToNot(ContainSubstring("request_id"))
+	})
+
+	It("should quote the reference in the error events of the streams", func() {
+		server := &Server{}
+		Expect(string(server.sseErrorEvent("req-1", http.StatusBadGateway, "stream interrupted"))).
+			To(HavePrefix(`data: {"error":{"object":"error","message":"stream interrupted","type":"BadGateway","param":"","code":502,"request_id":"req-1"}}`))
+	})
+})
@@ -0,0 +1,235 @@
+/*
+Copyright 2025 The llm-d Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package proxy
+
+import (
+	"bufio"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/llm-d/llm-d-routing-sidecar/internal/metrics"
+)
+
+// Hop-by-hop headers, not forwarded to the decoder
+var hopHeaders = []string{
+	"Connection",
+	"Proxy-Connection",
+	"Keep-Alive",
+	"Proxy-Authenticate",
+	"Proxy-Authorization",
+	"Te",
+	"Trailer",
+	"Transfer-Encoding",
+	"Upgrade",
+}
+
+// passthroughHandler forwards requests to the decoder, relaying upgraded connections
+func (s *Server) passthroughHandler(w http.ResponseWriter, r *http.Request) {
+	if !s.passthroughAllowed(r.URL.Path) {
+		s.denyPassthrough(w, r)
+		return
+	}
+	if isUpgradeRequest(r) {
+		s.upgradeHandler(w, r)
+		return
+	}
+	s.decoderProxy.ServeHTTP(w, r)
+}
+
+// isUpgradeRequest returns true when the client asks to switch protocols (e.g. to WebSocket)
+func isUpgradeRequest(r *http.Request) bool {
+	if r.Header.Get("Upgrade") == "" {
+		return false
+	}
+	for _, value := range r.Header.Values("Connection") {
+		for _, token := range strings.Split(value, ",") {
+			if strings.EqualFold(strings.TrimSpace(token), "upgrade") {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// upgradeHandler relays an upgraded connection between the client and the decoder.
+// Unlike httputil.ReverseProxy, which closes both connections as soon as one side stops
+// sending, each direction is half-closed independently so responses still in flight
+// are delivered after the client is done sending.
+func (s *Server) upgradeHandler(w http.ResponseWriter, r *http.Request) {
+	target := s
+	if s.config.DataParallelFailover && s.decoderDown.Load() {
+		if sibling := s.healthySibling(); sibling != nil {
+			target = sibling
+		}
+	}
+
+	backend, err := target.dialDecoder(r)
+	if err != nil {
+		s.logger.Error(err, "failed to connect to the decoder for upgrade")
+		if errors.Is(err, syscall.ECONNREFUSED) && target.tracksDecoderHealth() {
+			target.markDecoderDown()
+		}
+		if err := errorBadGateway(err, w); err != nil {
+			s.logger.Error(err, "failed to send error response to client")
+		}
+		return
+	}
+	defer backend.Close() //nolint:all
+
+	upgrade := r.Header.Get("Upgrade")
+	outreq := r.Clone(r.Context())
+	outreq.URL.Scheme = target.decoderURL.Scheme
+	outreq.URL.Host = target.decoderURL.Host
+	outreq.URL.Path = strings.TrimSuffix(target.decoderURL.Path, "/") + r.URL.Path
+	outreq.URL.RawPath = ""
+	outreq.RequestURI = ""
+	for _, header := range hopHeaders {
+		outreq.Header.Del(header)
+	}
+	outreq.Header.Set("Connection", "Upgrade")
+	outreq.Header.Set("Upgrade", upgrade)
+	if clientIP, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		if prior := outreq.Header.Get("X-Forwarded-For"); prior != "" {
+			clientIP = prior + ", " + clientIP
+		}
+		outreq.Header.Set("X-Forwarded-For", clientIP)
+	}
+
+	if err := outreq.Write(backend); err != nil {
+		s.logger.Error(err, "failed to send upgrade request to the decoder")
+		if err := errorBadGateway(err, w); err != nil {
+			s.logger.Error(err, "failed to send error response to client")
+		}
+		return
+	}
+
+	backendReader := bufio.NewReader(backend)
+	resp, err := http.ReadResponse(backendReader, outreq)
+	if err != nil {
+		s.logger.Error(err, "failed to read upgrade response from the decoder")
+		if err := errorBadGateway(err, w); err != nil {
+			s.logger.Error(err, "failed to send error response to client")
+		}
+		return
+	}
+	defer resp.Body.Close() //nolint:all
+
+	// The decoder refused to switch protocols: forward its response as is
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		for name, values := range resp.Header {
+			w.Header()[name] = values
+		}
+		w.WriteHeader(resp.StatusCode)
+		io.Copy(w, resp.Body) //nolint:all
+		return
+	}
+
+	protocol := strings.ToLower(resp.Header.Get("Upgrade"))
+	if !strings.EqualFold(protocol, upgrade) {
+		err := fmt.Errorf("decoder switched to protocol %q instead of %q", protocol, upgrade)
+		s.logger.Error(err, "invalid upgrade response")
+		if err := errorBadGateway(err, w); err != nil {
+			s.logger.Error(err, "failed to send error response to client")
+		}
+		return
+	}
+
+	client, clientRW, err := http.NewResponseController(w).Hijack()
+	if err != nil {
+		s.logger.Error(err, "failed to hijack client connection")
+		if err := errorBadGateway(err, w); err != nil {
+			s.logger.Error(err, "failed to send error response to client")
+		}
+		return
+	}
+	defer client.Close()            //nolint:all
+	client.SetDeadline(time.Time{}) //nolint:all
+
+	fmt.Fprint(clientRW, "HTTP/1.1 101 Switching Protocols\r\n") //nolint:all
+	resp.Header.Write(clientRW)                                  //nolint:all
+	clientRW.WriteString("\r\n")                                 //nolint:all
+	if err := clientRW.Flush(); err != nil {
+		s.logger.Error(err, "failed to send upgrade response to client")
+		return
+	}
+
+	start := time.Now()
+	metrics.RecordUpgradedConnectionOpened(s.rank(), protocol)
+	s.logger.V(4).Info("connection upgraded", "protocol", protocol, "path", r.URL.Path)
+
+	var sent, received int64
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		sent, _ = io.Copy(backend, clientRW.Reader) //nolint:all
+		closeWrite(backend)
+	}()
+	go func() {
+		defer wg.Done()
+		received, _ = io.Copy(client, backendReader) //nolint:all
+		closeWrite(client)
+	}()
+	wg.Wait()
+
+	metrics.RecordUpgradedConnectionClosed(s.rank(), protocol, sent, received, time.Since(start))
+	s.logger.V(4).Info("upgraded connection closed", "protocol", protocol, "sent", sent, "received", received)
+}
+
+// dialDecoder opens a connection to the decoder
+func (s *Server) dialDecoder(r *http.Request) (net.Conn, error) {
+	if s.config.DecoderSocket != "" {
+		return s.dialDecoderSocket(r.Context(), "unix", s.config.DecoderSocket)
+	}
+
+	host := s.decoderURL.Host
+	if s.decoderURL.Port() == "" {
+		port := "80"
+		if s.decoderURL.Scheme == "https" {
+			port = "443"
+		}
+		host = net.JoinHostPort(s.decoderURL.Hostname(), port)
+	}
+
+	dialer := &net.Dialer{Timeout: 30 * time.Second}
+	if s.decoderURL.Scheme == "https" {
+		config := s.decoderTLSConfig()
+		if config.ServerName == "" {
+			config.ServerName = s.decoderURL.Hostname()
+		}
+		return (&tls.Dialer{NetDialer: dialer, Config: config}).DialContext(r.Context(), "tcp", host)
+	}
+	return dialer.DialContext(r.Context(), "tcp", host)
+}
+
+// closeWrite signals the end of the stream to the peer while still reading its data,
+// falling back to closing the connection when half-close is not supported
+func closeWrite(conn net.Conn) {
+	if c, ok := conn.(interface{ CloseWrite() error }); ok {
+		c.CloseWrite() //nolint:all
+		return
+	}
+	conn.Close() //nolint:all
+}
@@ -0,0 +1,133 @@
+/*
+Copyright 2025 The llm-d Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package proxy
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/llm-d/llm-d-routing-sidecar/internal/metrics"
+	. "github.com/onsi/ginkgo/v2" // nolint:revive
+	. "github.com/onsi/gomega"    // nolint:revive
+	"k8s.io/klog/v2/ktesting"
+)
+
+var _ = Describe("Upgraded connections", func() {
+	var proxyAddr string
+
+	BeforeEach(func() {
+		_, ctx := ktesting.NewTestContext(GinkgoT())
+		ctx, cancelFn := context.WithCancel(ctx)
+		DeferCleanup(cancelFn)
+
+		// Decoder answering in upper case once the client is done sending
+		decodeBackend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path == "/reject" {
+				w.WriteHeader(http.StatusUpgradeRequired)
+				return
+			}
+			Expect(r.Header.Get("Upgrade")).To(Equal("shout"))
+
+			conn, rw, err := http.NewResponseController(w).Hijack()
+			Expect(err).ToNot(HaveOccurred())
+			defer conn.Close() //nolint:all
+
+			switched := "HTTP/1.1 101 Switching Protocols\r\nConnection: Upgrade\r\nUpgrade: shout\r\n\r\n"
+			rw.WriteString(switched) //nolint:all
+			rw.Flush()               //nolint:all
+
+			data, _ := io.ReadAll(rw)                     //nolint:all
+			rw.WriteString(strings.ToUpper(string(data))) //nolint:all
+			rw.Flush()                                    //nolint:all
+		}))
+		DeferCleanup(decodeBackend.Close)
+
+		decodeURL, err := url.Parse(decodeBackend.URL)
+		Expect(err).ToNot(HaveOccurred())
+		proxy, err := NewProxy("0", decodeURL, Config{Connector: ConnectorNIXLV2})
+		Expect(err).ToNot(HaveOccurred())
+
+		go func() {
+			defer GinkgoRecover()
+			Expect(proxy.Start(ctx)).To(Succeed())
+		}()
+		time.Sleep(1 * time.Second)
+		Expect(proxy.Addr()).ToNot(BeNil())
+		proxyAddr = proxy.Addr().String()
+	})
+
+	upgrade := func(path string) (net.Conn, *bufio.Reader, *http.Response) {
+		conn, err := net.Dial("tcp", proxyAddr)
+		Expect(err).ToNot(HaveOccurred())
+		DeferCleanup(conn.Close)
+
+		_, err = conn.Write([]byte("GET " + path + " HTTP/1.1\r\nHost: localhost\r\nConnection: Upgrade\r\nUpgrade: shout\r\n\r\n"))
+		Expect(err).ToNot(HaveOccurred())
+
+		reader := bufio.NewReader(conn)
+		resp, err := http.ReadResponse(reader, nil)
+		Expect(err).ToNot(HaveOccurred())
+		return conn, reader, resp
+	}
+
+	It("should relay the responses sent after the client half-closed the connection", func() {
+		conn, reader, resp := upgrade("/v1/realtime")
+		Expect(resp.StatusCode).To(Equal(http.StatusSwitchingProtocols))
+		Expect(resp.Header.Get("Upgrade")).To(Equal("shout"))
+
+		_, err := conn.Write([]byte("hello"))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(conn.(*net.TCPConn).CloseWrite()).To(Succeed())
+
+		data, err := io.ReadAll(reader)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(string(data)).To(Equal("HELLO"))
+
+		Eventually(func() map[string]float64 {
+			bytes := map[string]float64{}
+			families, err := metrics.Registry.Gather()
+			Expect(err).ToNot(HaveOccurred())
+			for _, family := range families {
+				if family.GetName() != "llm_d_routing_sidecar_upgraded_connection_bytes_total" {
+					continue
+				}
+				for _, metric := range family.Metric {
+					labels := map[string]string{}
+					for _, label := range metric.Label {
+						labels[label.GetName()] = label.GetValue()
+					}
+					if labels["protocol"] == "shout" {
+						bytes[labels["direction"]] = metric.GetCounter().GetValue()
+					}
+				}
+			}
+			return bytes
+		}).Should(Equal(map[string]float64{"sent": 5, "received": 5}))
+	})
+
+	It("should forward the response of a decoder refusing to switch protocols", func() {
+		_, _, resp := upgrade("/reject")
+		Expect(resp.StatusCode).To(Equal(http.StatusUpgradeRequired))
+	})
+})
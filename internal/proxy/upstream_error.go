@@ -0,0 +1,172 @@
+/*
+Copyright 2025 The llm-d Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package proxy
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"syscall"
+
+	"github.com/llm-d/llm-d-routing-sidecar/internal/metrics"
+)
+
+// Upstreams of the proxy, as metrics label values
+const (
+	upstreamDecoder   = "decoder"
+	upstreamPrefiller = "prefiller"
+)
+
+// Classes of the upstream errors, as metrics label values and in the error responses
+const (
+	upstreamErrorDial            = "dial-error"
+	upstreamErrorTLS             = "tls"
+	upstreamErrorTimeout         = "timeout"
+	upstreamErrorConnectionReset = "connection-reset"
+	upstreamErrorEngine4xx       = "4xx-from-engine"
+	upstreamErrorEngine5xx       = "5xx-from-engine"
+	upstreamErrorProtocol        = "protocol-violation"
+	upstreamErrorKVTransfer      = "kv-transfer-failure"
+	upstreamErrorUnknown         = "unknown"
+)
+
+// classifyUpstreamError returns the class of the error of a request to an upstream
+func classifyUpstreamError(ctx context.Context, err error) string {
+	var (
+		netErr       net.Error
+		opErr        *net.OpError
+		dnsErr       *net.DNSError
+		recordErr    tls.RecordHeaderError
+		alertErr     tls.AlertError
+		verifyErr    *tls.CertificateVerificationError
+		authorityErr x509.UnknownAuthorityError
+		hostnameErr  x509.HostnameError
+		invalidErr   x509.CertificateInvalidError
+	)
+	switch {
+	case errors.Is(context.Cause(ctx), errRequestTimeout), errors.Is(err, context.DeadlineExceeded),
+		errors.As(err, &netErr) && netErr.Timeout():
+		return upstreamErrorTimeout
+	case errors.As(err, &recordErr), errors.As(err, &alertErr), errors.As(err, &verifyErr),
+		errors.As(err, &authorityErr), errors.As(err, &hostnameErr), errors.As(err, &invalidErr):
+		return upstreamErrorTLS
+	case errors.Is(err, syscall.ECONNREFUSED), errors.As(err, &dnsErr),
+		errors.As(err, &opErr) && opErr.Op == "dial":
+		return upstreamErrorDial
+	case isConnectionReset(err):
+		return upstreamErrorConnectionReset
+	case strings.Contains(err.Error(), "malformed HTTP"), strings.Contains(err.Error(), "malformed chunked encoding"):
+		return upstreamErrorProtocol
+	}
+	return upstreamErrorUnknown
+}
+
+// classifyEngineStatus returns the class of an error status answered by an engine
+func classifyEngineStatus(statusCode int) string {
+	switch {
+	case statusCode >= http.StatusInternalServerError:
+		return upstreamErrorEngine5xx
+	case statusCode >= http.StatusBadRequest:
+		return upstreamErrorEngine4xx
+	}
+	return upstreamErrorProtocol
+}
+
+// upstreamErrorStatus returns the status code answered to the client for an upstream error
+func upstreamErrorStatus(class string) int {
+	if class == upstreamErrorTimeout {
+		return http.StatusGatewayTimeout
+	}
+	return http.StatusBadGateway
+}
+
+// upstreamClassMessage returns the message answered to the client for an upstream error. The
+// error itself is only logged, not to leak the addresses of the upstreams.
+func upstreamClassMessage(upstream string, class string) string {
+	switch class {
+	case upstreamErrorDial:
+		return fmt.Sprintf("failed to connect to the %s", upstream)
+	case upstreamErrorTLS:
+		return fmt.Sprintf("TLS handshake with the %s failed", upstream)
+	case upstreamErrorTimeout:
+		return fmt.Sprintf("%s request timed out", upstream)
+	case upstreamErrorConnectionReset:
+		return fmt.Sprintf("connection reset by the %s", upstream)
+	case upstreamErrorProtocol:
+		return fmt.Sprintf("invalid response from the %s", upstream)
+	case upstreamErrorKVTransfer:
+		return fmt.Sprintf("KV cache transfer from the %s failed", upstream)
+	}
+	return fmt.Sprintf("%s request failed", upstream)
+}
+
+// failUpstream counts a failed request to an upstream, and answers the client with the error
+// response of its class
+func (s *Server) failUpstream(w http.ResponseWriter, upstream string, class string) {
+	metrics.RecordUpstreamError(s.rank(), upstream, class)
+	if err := errorUpstream(upstream, class, w); err != nil {
+		s.logger.Error(err, "failed to send error response to client")
+	}
+}
+
+// prefillFailed relays the error answered to a prefill request, with its class. The errors of
+// the engine are classified by status code, keeping their message.
+func (s *Server) prefillFailed(w http.ResponseWriter, pw *bufferedResponseWriter) {
+	var er errorResponse
+	if err := json.Unmarshal(pw.buffer.Bytes(), &er); err == nil && er.Class != "" {
+		// already classified by the prefiller proxy
+		if err := errorClassified(pw.statusCode, er.Message, er.Class, w); err != nil {
+			s.logger.Error(err, "failed to send error response to client")
+		}
+		return
+	}
+
+	class, statusCode := classifyEngineStatus(pw.statusCode), pw.statusCode
+	s.logger.Error(nil, "prefill request failed", "class", class, "code", statusCode)
+	metrics.RecordUpstreamError(s.rank(), upstreamPrefiller, class)
+	if class == upstreamErrorProtocol {
+		statusCode, er.Message = http.StatusBadGateway, ""
+	}
+	if er.Message == "" {
+		er.Message = upstreamClassMessage(upstreamPrefiller, class)
+	}
+	if err := errorClassified(statusCode, er.Message, class, w); err != nil {
+		s.logger.Error(err, "failed to send error response to client")
+	}
+}
+
+// prefillerErrorHandler classifies and logs the errors of the requests to prefillers
+func (s *Server) prefillerErrorHandler(res http.ResponseWriter, req *http.Request, err error) {
+	class := classifyUpstreamError(req.Context(), err)
+	switch {
+	case errors.Is(err, context.Canceled) && class != upstreamErrorTimeout:
+		s.logger.V(4).Info("prefill request canceled by the client", "error", err.Error())
+		res.WriteHeader(http.StatusBadGateway)
+		return
+	case class == upstreamErrorTimeout:
+		s.logger.V(4).Info("prefill request timed out", "error", err.Error())
+	default:
+		s.logger.Error(err, "prefill request failed", "class", class, "target", req.URL.Host)
+	}
+	s.failUpstream(res, upstreamPrefiller, class)
+}
@@ -0,0 +1,240 @@
+/*
+Copyright 2025 The llm-d Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package proxy
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"syscall"
+
+	"github.com/llm-d/llm-d-routing-sidecar/internal/metrics"
+	. "github.com/onsi/ginkgo/v2" // nolint:revive
+	. "github.com/onsi/gomega"    // nolint:revive
+	"k8s.io/klog/v2/ktesting"
+)
+
+var _ = Describe("Upstream errors", func() {
+	DescribeTable("should classify the upstream errors",
+		func(ctx context.Context, err error, class string) {
+			Expect(classifyUpstreamError(ctx, err)).To(Equal(class))
+		},
+		Entry("refused connection", context.Background(),
+			&net.OpError{Op: "dial", Net: "tcp", Err: syscall.ECONNREFUSED}, upstreamErrorDial),
+		Entry("unknown host", context.Background(),
+			&net.OpError{Op: "dial", Net: "tcp", Err: &net.DNSError{Err: "no such host", IsNotFound: true}}, upstreamErrorDial),
+		Entry("deadline", context.Background(), fmt.Errorf("prefill: %w", context.DeadlineExceeded), upstreamErrorTimeout),
+		Entry("request timeout", canceledContext(errRequestTimeout), context.Canceled, upstreamErrorTimeout),
+		Entry("plain HTTP server", context.Background(), tls.RecordHeaderError{Msg: "first record does not look like a TLS handshake"}, upstreamErrorTLS),
+		Entry("untrusted certificate", context.Background(),
+			&tls.CertificateVerificationError{Err: errors.New("unknown authority")}, upstreamErrorTLS),
+		Entry("reset connection", context.Background(),
+			&net.OpError{Op: "read", Net: "tcp", Err: syscall.ECONNRESET}, upstreamErrorConnectionReset),
+		Entry("closed connection", context.Background(), io.EOF, upstreamErrorConnectionReset),
+		Entry("malformed response", context.Background(),
+			errors.New(`net/http: HTTP/1.x transport connection broken: malformed HTTP response "garbage"`), upstreamErrorProtocol),
+		Entry("other", context.Background(), errors.New("boom"), upstreamErrorUnknown),
+	)
+
+	DescribeTable("should classify the engine error statuses",
+		func(statusCode int, class string) {
+			Expect(classifyEngineStatus(statusCode)).To(Equal(class))
+		},
+		Entry("bad request", http.StatusBadRequest, upstreamErrorEngine4xx),
+		Entry("internal error", http.StatusInternalServerError, upstreamErrorEngine5xx),
+		Entry("unexpected status", http.StatusNoContent, upstreamErrorProtocol),
+	)
+
+	Context("with a proxy", func() {
+		const rank = 48
+
+		var (
+			decoderURL *url.URL
+			prefiller  http.HandlerFunc
+			proxy      *Server
+		)
+
+		BeforeEach(func() {
+			decoder := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+				w.Header().Set("Content-Type", "application/json")
+				w.Write([]byte(`{"choices":[{"text":"Hi"}]}`)) //nolint:all
+			}))
+			DeferCleanup(decoder.Close)
+			var err error
+			decoderURL, err = url.Parse(decoder.URL)
+			Expect(err).ToNot(HaveOccurred())
+			prefiller = func(w http.ResponseWriter, _ *http.Request) {
+				w.Write([]byte(`{"kv_transfer_params": {}}`)) //nolint:all
+			}
+		})
+
+		JustBeforeEach(func() {
+			_, ctx := ktesting.NewTestContext(GinkgoT())
+			ctx, cancelFn := context.WithCancel(ctx)
+			DeferCleanup(cancelFn)
+
+			var err error
+			proxy, err = NewProxy("0", decoderURL, Config{Connector: ConnectorNIXLV2, DataParallelRank: rank})
+			Expect(err).ToNot(HaveOccurred())
+			go func() {
+				defer GinkgoRecover()
+				Expect(proxy.Start(ctx)).To(Succeed())
+			}()
+			Eventually(func() net.Addr { return proxy.Addr() }).ShouldNot(BeNil())
+		})
+
+		// send sends a completion request, disaggregated when a prefiller is given
+		send := func(prefillHostPort string) (int, errorResponse) {
+			req, err := http.NewRequest(http.MethodPost, "http://"+proxy.Addr().String()+CompletionsPath,
+				strings.NewReader(`{"model": "m", "prompt": "Hello"}`))
+			Expect(err).ToNot(HaveOccurred())
+			if prefillHostPort != "" {
+				req.Header.Set(requestHeaderPrefillHostPort, prefillHostPort)
+			}
+			resp, err := http.DefaultClient.Do(req)
+			Expect(err).ToNot(HaveOccurred())
+			defer resp.Body.Close() //nolint:all
+
+			var er errorResponse
+			if resp.StatusCode != http.StatusOK {
+				Expect(json.NewDecoder(resp.Body).Decode(&er)).To(Succeed())
+			}
+			return resp.StatusCode, er
+		}
+
+		startPrefiller := func() string {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				prefiller(w, r)
+			}))
+			DeferCleanup(server.Close)
+			return server.Listener.Addr().String()
+		}
+
+		upstreamErrors := func(upstream string, class string) float64 {
+			families, err := metrics.Registry.Gather()
+			Expect(err).ToNot(HaveOccurred())
+			for _, family := range families {
+				if family.GetName() != "llm_d_routing_sidecar_upstream_errors_total" {
+					continue
+				}
+				for _, metric := range family.Metric {
+					labels := map[string]string{}
+					for _, label := range metric.Label {
+						labels[label.GetName()] = label.GetValue()
+					}
+					if labels[metrics.RankLabel] == fmt.Sprint(rank) && labels["upstream"] == upstream && labels["class"] == class {
+						return metric.GetCounter().GetValue()
+					}
+				}
+			}
+			return 0
+		}
+
+		Context("when the decoder is down", func() {
+			BeforeEach(func() {
+				listener, err := net.Listen("tcp", "127.0.0.1:0")
+				Expect(err).ToNot(HaveOccurred())
+				decoderURL = &url.URL{Scheme: "http", Host: listener.Addr().String()}
+				Expect(listener.Close()).To(Succeed())
+			})
+
+			It("should answer the dial errors with their class", func() {
+				before := upstreamErrors(upstreamDecoder, upstreamErrorDial)
+
+				statusCode, er := send("")
+				Expect(statusCode).To(Equal(http.StatusBadGateway))
+				Expect(er.Class).To(Equal(upstreamErrorDial))
+				Expect(er.Message).To(Equal("failed to connect to the decoder"))
+				Expect(upstreamErrors(upstreamDecoder, upstreamErrorDial)).To(Equal(before + 1))
+			})
+		})
+
+		It("should relay the client errors of the prefiller with their class", func() {
+			prefiller = func(w http.ResponseWriter, _ *http.Request) {
+				w.WriteHeader(http.StatusBadRequest)
+				w.Write([]byte(`{"object":"error","message":"prompt too long","type":"BadRequestError","code":400}`)) //nolint:all
+			}
+			before := upstreamErrors(upstreamPrefiller, upstreamErrorEngine4xx)
+
+			statusCode, er := send(startPrefiller())
+			Expect(statusCode).To(Equal(http.StatusBadRequest))
+			Expect(er.Class).To(Equal(upstreamErrorEngine4xx))
+			Expect(er.Message).To(Equal("prompt too long"))
+			Expect(upstreamErrors(upstreamPrefiller, upstreamErrorEngine4xx)).To(Equal(before + 1))
+		})
+
+		It("should classify the invalid prefiller responses as protocol violations", func() {
+			prefiller = func(w http.ResponseWriter, _ *http.Request) {
+				w.Write([]byte("not JSON")) //nolint:all
+			}
+
+			statusCode, er := send(startPrefiller())
+			Expect(statusCode).To(Equal(http.StatusBadGateway))
+			Expect(er.Class).To(Equal(upstreamErrorProtocol))
+		})
+
+		It("should classify the prefiller responses with unexpected KV transfer types as protocol violations", func() {
+			prefiller = func(w http.ResponseWriter, _ *http.Request) {
+				w.Write([]byte(`{"kv_transfer_params": "remote"}`)) //nolint:all
+			}
+
+			statusCode, er := send(startPrefiller())
+			Expect(statusCode).To(Equal(http.StatusBadGateway))
+			Expect(er.Class).To(Equal(upstreamErrorProtocol))
+		})
+
+		It("should classify the prefiller connection resets", func() {
+			prefiller = func(w http.ResponseWriter, _ *http.Request) {
+				conn, _, err := http.NewResponseController(w).Hijack()
+				Expect(err).ToNot(HaveOccurred())
+				conn.Close() //nolint:all
+			}
+			before := upstreamErrors(upstreamPrefiller, upstreamErrorConnectionReset)
+
+			statusCode, er := send(startPrefiller())
+			Expect(statusCode).To(Equal(http.StatusBadGateway))
+			Expect(er.Class).To(Equal(upstreamErrorConnectionReset))
+			Expect(upstreamErrors(upstreamPrefiller, upstreamErrorConnectionReset)).To(Equal(before + 1))
+		})
+
+		It("should count the prefiller responses without KV transfer parameters", func() {
+			prefiller = func(w http.ResponseWriter, _ *http.Request) {
+				w.Write([]byte(`{}`)) //nolint:all
+			}
+			before := upstreamErrors(upstreamPrefiller, upstreamErrorKVTransfer)
+
+			statusCode, _ := send(startPrefiller())
+			Expect(statusCode).To(Equal(http.StatusOK))
+			Expect(upstreamErrors(upstreamPrefiller, upstreamErrorKVTransfer)).To(Equal(before + 1))
+		})
+	})
+})
+
+// canceledContext returns a context canceled with the given cause
+func canceledContext(cause error) context.Context {
+	ctx, cancelFn := context.WithCancelCause(context.Background())
+	cancelFn(cause)
+	return ctx
+}
@@ -0,0 +1,135 @@
+/*
+Copyright 2025 The llm-d Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package proxy
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"strings"
+)
+
+const requestFieldIncludeUsage = "include_usage"
+
+// sseEventSeparator ends the server-sent events streamed by the decoder
+var sseEventSeparator = []byte("\n\n")
+
+// injectStreamUsage asks the decoder for the usage of a streamed completion the client did not
+// ask it for, reporting whether the request was modified
+func injectStreamUsage(p *parsedRequest) bool {
+	if !p.stream {
+		return false
+	}
+
+	var options map[string]any
+	if raw, ok := p.fields[requestFieldStreamOptions]; ok {
+		if err := json.Unmarshal(raw, &options); err != nil {
+			return false
+		}
+		if includeUsage, _ := options[requestFieldIncludeUsage].(bool); includeUsage {
+			return false
+		}
+	}
+	if options == nil {
+		options = map[string]any{}
+	}
+	options[requestFieldIncludeUsage] = true
+	return p.setField(requestFieldStreamOptions, options) == nil
+}
+
+// usageChunk is the part of a streamed chunk holding the usage of the completion
+type usageChunk struct {
+	Choices []json.RawMessage `json:"choices"`
+	Usage   *struct {
+		PromptTokens     int `json:"prompt_tokens"`
+		CompletionTokens int `json:"completion_tokens"`
+	} `json:"usage"`
+}
+
+// usageWriter records the usage of a streamed completion, and strips the final usage chunk
+// the client did not ask for. Incomplete events are held until the next write.
+type usageWriter struct {
+	http.ResponseWriter
+	strip  bool
+	record func(promptTokens int, completionTokens int)
+
+	started     bool
+	passthrough bool   // the response is not an event stream, e.g. an error
+	pending     []byte // the incomplete event
+	kept        []byte // the events written to the client
+}
+
+func (w *usageWriter) Write(b []byte) (int, error) {
+	if !w.started {
+		w.started = true
+		w.passthrough = !strings.HasPrefix(w.Header().Get("Content-Type"), "text/event-stream")
+	}
+	if w.passthrough {
+		return w.ResponseWriter.Write(b)
+	}
+
+	w.pending = append(w.pending, b...)
+	w.kept = w.kept[:0]
+	rest := w.pending
+	for {
+		i := bytes.Index(rest, sseEventSeparator)
+		if i < 0 {
+			break
+		}
+		event := rest[:i+len(sseEventSeparator)]
+		rest = rest[i+len(sseEventSeparator):]
+		if !w.usage(event) {
+			w.kept = append(w.kept, event...)
+		}
+	}
+	w.pending = append(w.pending[:0], rest...)
+
+	if len(w.kept) > 0 {
+		if _, err := w.ResponseWriter.Write(w.kept); err != nil {
+			return 0, err
+		}
+	}
+	return len(b), nil
+}
+
+// usage records the usage of the final usage chunk, without choices, reporting whether the
+// event must be stripped. The usage of the other chunks, if any, is partial.
+func (w *usageWriter) usage(event []byte) bool {
+	data, found := bytes.CutPrefix(event, []byte("data: "))
+	if !found || !bytes.Contains(data, []byte(`"usage"`)) {
+		return false
+	}
+	var chunk usageChunk
+	if err := json.Unmarshal(data, &chunk); err != nil || chunk.Usage == nil || len(chunk.Choices) > 0 {
+		return false
+	}
+	w.record(chunk.Usage.PromptTokens, chunk.Usage.CompletionTokens)
+	return w.strip
+}
+
+// finish writes the last event, if incomplete
+func (w *usageWriter) finish() {
+	if len(w.pending) > 0 {
+		w.ResponseWriter.Write(w.pending) //nolint:all
+		w.pending = nil
+	}
+}
+
+// Unwrap allows http.ResponseController to flush the wrapped ResponseWriter
+func (w *usageWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
@@ -0,0 +1,154 @@
+/*
+Copyright 2025 The llm-d Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package proxy
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2" // nolint:revive
+	. "github.com/onsi/gomega"    // nolint:revive
+	"k8s.io/klog/v2/ktesting"
+
+	"github.com/llm-d/llm-d-routing-sidecar/internal/metrics"
+)
+
+var _ = Describe("Stream usage injection", func() {
+	const rank = 43 // isolates the series of the tests
+
+	var (
+		decodeBody   chan map[string]any
+		proxyBaseURL string
+	)
+
+	BeforeEach(func() {
+		_, ctx := ktesting.NewTestContext(GinkgoT())
+		ctx, cancelFn := context.WithCancel(ctx)
+		DeferCleanup(cancelFn)
+
+		// Decoder streaming the usage chunk when asked, with events split across writes
+		decodeBody = make(chan map[string]any, 1)
+		decodeBackend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			var request map[string]any
+			Expect(json.NewDecoder(r.Body).Decode(&request)).To(Succeed())
+			decodeBody <- request
+
+			events := `data: {"choices":[{"index":0,"delta":{"content":"Hello"}}]}` + "\n\n" +
+				`data: {"choices":[{"index":0,"delta":{},"finish_reason":"stop"}]}` + "\n\n"
+			if options, ok := request[requestFieldStreamOptions].(map[string]any); ok && options[requestFieldIncludeUsage] == true {
+				events += `data: {"choices":[],"usage":{"prompt_tokens":5,"completion_tokens":2,"total_tokens":7}}` + "\n\n"
+			}
+			events += "data: [DONE]\n\n"
+
+			w.Header().Set("Content-Type", "text/event-stream")
+			for len(events) > 0 {
+				n := min(len(events), 37)
+				fmt.Fprint(w, events[:n]) //nolint:all
+				w.(http.Flusher).Flush()
+				events = events[n:]
+			}
+		}))
+		DeferCleanup(decodeBackend.Close)
+
+		decodeURL, err := url.Parse(decodeBackend.URL)
+		Expect(err).ToNot(HaveOccurred())
+		proxy, err := NewProxy("0", decodeURL, Config{Connector: ConnectorNIXLV2, InjectStreamUsage: true, DataParallelRank: rank})
+		Expect(err).ToNot(HaveOccurred())
+
+		go func() {
+			defer GinkgoRecover()
+			Expect(proxy.Start(ctx)).To(Succeed())
+		}()
+		time.Sleep(1 * time.Second)
+		Expect(proxy.Addr()).ToNot(BeNil())
+		proxyBaseURL = "http://" + proxy.Addr().String()
+	})
+
+	// tokens returns the number of tokens recorded, by type
+	tokens := func() map[string]float64 {
+		counts := map[string]float64{}
+		families, err := metrics.Registry.Gather()
+		Expect(err).ToNot(HaveOccurred())
+		for _, family := range families {
+			if family.GetName() != "llm_d_routing_sidecar_usage_tokens_total" {
+				continue
+			}
+			for _, metric := range family.Metric {
+				labels := map[string]string{}
+				for _, label := range metric.Label {
+					labels[label.GetName()] = label.GetValue()
+				}
+				if labels[metrics.RankLabel] == "43" {
+					counts[labels["type"]] += metric.GetCounter().GetValue()
+				}
+			}
+		}
+		return counts
+	}
+
+	stream := func(body string) string {
+		resp, err := http.Post(proxyBaseURL+ChatCompletionsPath, "application/json", strings.NewReader(body))
+		Expect(err).ToNot(HaveOccurred())
+		defer resp.Body.Close() //nolint:all
+		Expect(resp.StatusCode).To(Equal(http.StatusOK))
+		b, err := io.ReadAll(resp.Body)
+		Expect(err).ToNot(HaveOccurred())
+		return string(b)
+	}
+
+	It("should ask the decoder for the usage and strip it from the response", func() {
+		before := tokens()
+		response := stream(`{"model": "llama", "stream": true, "stream_options": {"continuous_usage_stats": false}, "messages": [{"role": "user", "content": "Hi"}]}`)
+
+		var request map[string]any
+		Eventually(decodeBody).Should(Receive(&request))
+		Expect(request[requestFieldStreamOptions]).To(Equal(map[string]any{"include_usage": true, "continuous_usage_stats": false}))
+
+		Expect(response).ToNot(ContainSubstring("usage"))
+		Expect(response).To(Equal(`data: {"choices":[{"index":0,"delta":{"content":"Hello"}}]}` + "\n\n" +
+			`data: {"choices":[{"index":0,"delta":{},"finish_reason":"stop"}]}` + "\n\n" +
+			"data: [DONE]\n\n"))
+		Eventually(tokens).Should(Equal(map[string]float64{"prompt": before["prompt"] + 5, "completion": before["completion"] + 2}))
+	})
+
+	It("should keep the usage the client asked for", func() {
+		before := tokens()
+		response := stream(`{"model": "llama", "stream": true, "stream_options": {"include_usage": true}, "messages": [{"role": "user", "content": "Hi"}]}`)
+
+		Eventually(decodeBody).Should(Receive())
+		Expect(response).To(ContainSubstring(`"usage":{"prompt_tokens":5`))
+		Expect(response).To(HaveSuffix("data: [DONE]\n\n"))
+		Eventually(tokens).Should(Equal(map[string]float64{"prompt": before["prompt"] + 5, "completion": before["completion"] + 2}))
+	})
+
+	It("should not modify the requests which are not streamed", func() {
+		p := mustParse(`{"model": "llama", "stream": false}`)
+		Expect(injectStreamUsage(p)).To(BeFalse())
+		Expect(p.encode()).To(MatchJSON(`{"model": "llama", "stream": false}`))
+
+		p = mustParse(`{"model": "llama", "stream": true, "stream_options": null}`)
+		Expect(injectStreamUsage(p)).To(BeTrue())
+		Expect(p.encode()).To(MatchJSON(`{"model": "llama", "stream": true, "stream_options": {"include_usage": true}}`))
+	})
+})
@@ -0,0 +1,132 @@
+/*
+Copyright 2025 The llm-d Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package proxy
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+const (
+	requestFieldModel    = "model"
+	requestFieldPrompt   = "prompt"
+	requestFieldMessages = "messages"
+)
+
+// validationError describes why a request body does not match the OpenAI schema
+type validationError struct {
+	param   string
+	message string
+}
+
+// validateCompletionRequest parses the body of a completion or chat completion request and
+// checks it against a minimal OpenAI schema, so malformed requests are rejected before any
+// upstream call. The parsed request is shared by the other stages of the request.
+func validateCompletionRequest(path string, body []byte) (*parsedRequest, *validationError) {
+	if jsonKind(body) != '{' {
+		if !json.Valid(body) {
+			return nil, &validationError{message: "JSON decode error: invalid JSON"}
+		}
+		return nil, &validationError{message: "request body must be a JSON object"}
+	}
+	p, err := parseRequest(body)
+	if err != nil {
+		return nil, &validationError{message: fmt.Sprintf("JSON decode error: %v", err)}
+	}
+
+	if model, ok := decodeString(p.fields[requestFieldModel]); !ok || model == "" {
+		return nil, &validationError{param: requestFieldModel, message: "'model' must be a non-empty string"}
+	}
+
+	var verr *validationError
+	switch path {
+	case ChatCompletionsPath:
+		verr = validateMessages(p.messages)
+	case CompletionsPath:
+		verr = validatePrompt(p.prompt)
+	}
+	if verr != nil {
+		return nil, verr
+	}
+	return p, nil
+}
+
+// decodeString decodes a JSON string, reporting whether the value is one
+func decodeString(raw json.RawMessage) (string, bool) {
+	var s string
+	if jsonKind(raw) != '"' || json.Unmarshal(raw, &s) != nil {
+		return "", false
+	}
+	return s, true
+}
+
+// validatePrompt checks the prompt is a string, a list of strings, a list of
+// token IDs or a list of token ID lists
+func validatePrompt(prompt any) *validationError {
+	invalid := &validationError{
+		param:   requestFieldPrompt,
+		message: "'prompt' must be a string, a list of strings, a list of token IDs or a list of token ID lists",
+	}
+
+	switch p := prompt.(type) {
+	case string:
+		return nil
+	case []any:
+		if len(p) == 0 {
+			return invalid
+		}
+		for _, item := range p {
+			switch i := item.(type) {
+			case string, float64:
+			case []any:
+				for _, token := range i {
+					if _, ok := token.(float64); !ok {
+						return invalid
+					}
+				}
+			default:
+				return invalid
+			}
+		}
+		return nil
+	default:
+		return invalid
+	}
+}
+
+// validateMessages checks the messages are a non-empty list of objects with a role
+func validateMessages(messages []any) *validationError {
+	if len(messages) == 0 {
+		return &validationError{param: requestFieldMessages, message: "'messages' must be a non-empty list"}
+	}
+
+	for i, item := range messages {
+		message, ok := item.(map[string]any)
+		if !ok {
+			return &validationError{param: requestFieldMessages, message: fmt.Sprintf("'messages[%d]' must be an object", i)}
+		}
+		if role, ok := message["role"].(string); !ok || role == "" {
+			return &validationError{param: requestFieldMessages, message: fmt.Sprintf("'messages[%d].role' must be a non-empty string", i)}
+		}
+		switch message["content"].(type) {
+		case nil, string, []any:
+		default:
+			return &validationError{param: requestFieldMessages, message: fmt.Sprintf("'messages[%d].content' must be a string or a list of content parts", i)}
+		}
+	}
+	return nil
+}
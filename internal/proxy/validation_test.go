@@ -0,0 +1,148 @@
+/*
+Copyright 2025 The llm-d Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package proxy
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/llm-d/llm-d-routing-sidecar/test/mock"
+	. "github.com/onsi/ginkgo/v2" // nolint:revive
+	. "github.com/onsi/gomega"    // nolint:revive
+	"k8s.io/klog/v2/ktesting"
+)
+
+var _ = Describe("Request validation", func() {
+	DescribeTable("should accept valid requests",
+		func(path string, body string) {
+			p, verr := validateCompletionRequest(path, []byte(body))
+			Expect(verr).To(BeNil())
+			Expect(p.model).To(Equal("m"))
+		},
+		Entry("when the prompt is a string", CompletionsPath, `{"model": "m", "prompt": "Hello"}`),
+		Entry("when the prompt is a list of strings", CompletionsPath, `{"model": "m", "prompt": ["Hello", "World"]}`),
+		Entry("when the prompt is a list of token IDs", CompletionsPath, `{"model": "m", "prompt": [1, 2, 3]}`),
+		Entry("when the prompt is a list of token ID lists", CompletionsPath, `{"model": "m", "prompt": [[1, 2], [3]]}`),
+		Entry("when the messages have string contents", ChatCompletionsPath, `{"model": "m", "messages": [{"role": "user", "content": "Hello"}]}`),
+		Entry("when the messages have content parts", ChatCompletionsPath, `{"model": "m", "messages": [{"role": "user", "content": [{"type": "text", "text": "Hello"}]}]}`),
+		Entry("when a message has no content", ChatCompletionsPath, `{"model": "m", "messages": [{"role": "assistant", "content": null, "tool_calls": []}]}`),
+	)
+
+	DescribeTable("should reject invalid requests",
+		func(path string, body string, param string) {
+			p, verr := validateCompletionRequest(path, []byte(body))
+			Expect(p).To(BeNil())
+			Expect(verr).ToNot(BeNil())
+			Expect(verr.param).To(Equal(param))
+		},
+		Entry("when the body is not JSON", CompletionsPath, `{"model":`, ""),
+		Entry("when the body is not an object", CompletionsPath, `["Hello"]`, ""),
+		Entry("when the model is missing", CompletionsPath, `{"prompt": "Hello"}`, requestFieldModel),
+		Entry("when the model is not a string", CompletionsPath, `{"model": 1, "prompt": "Hello"}`, requestFieldModel),
+		Entry("when the prompt is missing", CompletionsPath, `{"model": "m"}`, requestFieldPrompt),
+		Entry("when the prompt is an object", CompletionsPath, `{"model": "m", "prompt": {"text": "Hello"}}`, requestFieldPrompt),
+		Entry("when the prompt is an empty list", CompletionsPath, `{"model": "m", "prompt": []}`, requestFieldPrompt),
+		Entry("when the prompt mixes token IDs and objects", CompletionsPath, `{"model": "m", "prompt": [[1, "a"]]}`, requestFieldPrompt),
+		Entry("when the messages are missing", ChatCompletionsPath, `{"model": "m"}`, requestFieldMessages),
+		Entry("when the messages are a string", ChatCompletionsPath, `{"model": "m", "messages": "Hello"}`, requestFieldMessages),
+		Entry("when a message has no role", ChatCompletionsPath, `{"model": "m", "messages": [{"content": "Hello"}]}`, requestFieldMessages),
+		Entry("when a message content is a number", ChatCompletionsPath, `{"model": "m", "messages": [{"role": "user", "content": 1}]}`, requestFieldMessages),
+		Entry("when the body is nested too deep", ChatCompletionsPath, `{"model": "m", "messages": `+nestedJSON(maxJSONDepth+1)+`}`, ""),
+		Entry("when the body is null", CompletionsPath, `null`, ""),
+	)
+
+	It("should return a structured 400 without calling the upstreams", func() {
+		_, ctx := ktesting.NewTestContext(GinkgoT())
+		ctx, cancelFn := context.WithCancel(ctx)
+		defer cancelFn()
+
+		decodeHandler := &mock.ChatCompletionHandler{Connector: ConnectorNIXLV2, Role: mock.RoleDecode}
+		decodeBackend := httptest.NewServer(decodeHandler)
+		DeferCleanup(decodeBackend.Close)
+
+		prefillHandler := &mock.ChatCompletionHandler{Connector: ConnectorNIXLV2, Role: mock.RolePrefill}
+		prefillBackend := httptest.NewServer(prefillHandler)
+		DeferCleanup(prefillBackend.Close)
+
+		decodeURL, err := url.Parse(decodeBackend.URL)
+		Expect(err).ToNot(HaveOccurred())
+		proxy, err := NewProxy("0", decodeURL, Config{Connector: ConnectorNIXLV2})
+		Expect(err).ToNot(HaveOccurred())
+
+		go func() {
+			defer GinkgoRecover()
+			Expect(proxy.Start(ctx)).To(Succeed())
+		}()
+		time.Sleep(1 * time.Second)
+		Expect(proxy.Addr()).ToNot(BeNil())
+
+		body := `{"model": "Qwen/Qwen2-0.5B", "messages": "Hello"}`
+		req, err := http.NewRequest(http.MethodPost, "http://"+proxy.Addr().String()+ChatCompletionsPath, strings.NewReader(body))
+		Expect(err).ToNot(HaveOccurred())
+		req.Header.Add(requestHeaderPrefillHostPort, prefillBackend.URL[len("http://"):])
+
+		resp, err := http.DefaultClient.Do(req)
+		Expect(err).ToNot(HaveOccurred())
+		defer resp.Body.Close() //nolint:all
+		Expect(resp.StatusCode).To(Equal(http.StatusBadRequest))
+
+		var er errorResponse
+		Expect(json.NewDecoder(resp.Body).Decode(&er)).To(Succeed())
+		Expect(er.Object).To(Equal("error"))
+		Expect(er.Type).To(Equal("BadRequestError"))
+		Expect(er.Param).To(Equal(requestFieldMessages))
+		Expect(er.Code).To(Equal(http.StatusBadRequest))
+
+		Expect(prefillHandler.RequestCount.Load()).To(BeNumerically("==", 0))
+		Expect(decodeHandler.RequestCount.Load()).To(BeNumerically("==", 0))
+	})
+})
+
+// FuzzValidateCompletionRequest checks the crafted requests are validated without panics, and
+// the valid ones are objects with a model
+func FuzzValidateCompletionRequest(f *testing.F) {
+	for _, seed := range []string{
+		`{"model": "m", "prompt": [[1, 2], [3]]}`,
+		`{"model": "m", "messages": [{"role": "user", "content": null}]}`,
+		`{"model": "m", "messages": [{"role": "user", "content": 1}]}`,
+		`{"model": "", "prompt": "Hello"}`,
+		`{"model": "m", "prompt": ` + nestedJSON(maxJSONDepth+1) + `}`,
+		`null`,
+	} {
+		f.Add([]byte(seed))
+	}
+
+	f.Fuzz(func(t *testing.T, body []byte) {
+		for _, path := range []string{CompletionsPath, ChatCompletionsPath} {
+			if _, verr := validateCompletionRequest(path, body); verr != nil {
+				continue
+			}
+			var request struct {
+				Model string `json:"model"`
+			}
+			if err := json.Unmarshal(body, &request); err != nil || request.Model == "" {
+				t.Fatalf("valid request %q without model", body)
+			}
+		}
+	})
+}
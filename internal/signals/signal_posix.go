@@ -26,3 +26,7 @@ import (
 )
 
 var shutdownSignals = []os.Signal{os.Interrupt, syscall.SIGTERM}
+
+var dumpSignals = []os.Signal{syscall.SIGQUIT}
+
+var reloadSignals = []os.Signal{syscall.SIGHUP}
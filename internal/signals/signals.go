@@ -42,3 +42,33 @@ func SetupSignalHandler(parentCtx context.Context) context.Context {
 
 	return ctx
 }
+
+// SetupDumpHandler calls dumpFn each time SIGQUIT is received, until ctx is done.
+// Registering the handler replaces the Go runtime default of dumping goroutine
+// stacks and exiting.
+func SetupDumpHandler(ctx context.Context, dumpFn func()) {
+	notify(ctx, dumpSignals, dumpFn)
+}
+
+// SetupReloadHandler calls reloadFn each time SIGHUP is received, until ctx is done.
+// Registering the handler replaces the Go runtime default of exiting.
+func SetupReloadHandler(ctx context.Context, reloadFn func()) {
+	notify(ctx, reloadSignals, reloadFn)
+}
+
+// notify calls fn each time one of the signals is received, until ctx is done
+func notify(ctx context.Context, signals []os.Signal, fn func()) {
+	c := make(chan os.Signal, 1)
+	signal.Notify(c, signals...)
+	go func() {
+		defer signal.Stop(c)
+		for {
+			select {
+			case <-c:
+				fn()
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+}
@@ -0,0 +1,654 @@
+/*
+Copyright 2025 The llm-d Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package config holds the configuration of the routing sidecar, its defaults and validation.
+// The configuration is loaded from, by increasing precedence, its defaults, a YAML or JSON
+// file, environment variables and command-line flags.
+package config
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"net"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/llm-d/llm-d-routing-sidecar/internal/logging"
+	"github.com/llm-d/llm-d-routing-sidecar/internal/metrics"
+	"github.com/llm-d/llm-d-routing-sidecar/internal/proxy"
+)
+
+// Optional labels of the completion request metrics
+const (
+	metricsLabelModel     = "model"
+	metricsLabelTenant    = "tenant"
+	metricsLabelPrefiller = "prefiller"
+)
+
+// prefillRequiredFields are the fields of the prefill requests which cannot be stripped
+var prefillRequiredFields = []string{"model", "prompt", "messages", "kv_transfer_params"}
+
+// Config is the configuration of the routing sidecar
+type Config struct {
+	// Port is the port the sidecar is listening on
+	Port string
+	// BindAddresses are the addresses the sidecar listens on, all the interfaces when empty
+	BindAddresses []string
+	// VLLMPort is the port vLLM is listening on
+	VLLMPort string
+	// DecoderURL is the address of the decoder, replacing VLLMPort and DecoderUseTLS when set
+	DecoderURL string
+	// Connector is the P/D connector being used: nixl, nixlv2 or lmcache
+	Connector string
+	// ExperimentConnector is followed by ExperimentConnectorWeight percent of the disaggregated requests
+	ExperimentConnector       string
+	ExperimentConnectorWeight int
+
+	PrefillerUseTLS             bool
+	DecoderUseTLS               bool
+	PrefillerCAFile             string
+	PrefillerCAReloadInterval   time.Duration
+	SPIFFEEndpointSocket        string
+	SPIFFEAuthorizedIDs         []string
+	PrefillerInsecureSkipVerify bool
+	DecoderInsecureSkipVerify   bool
+	DecoderCAFile               string
+	DecoderTLSServerName        string
+	PrefillerTokenFile          string
+	PrefillerTokenAudience      string
+	PrefillerHMACKeyFile        string
+	CallerTokenAudience         string
+	CallerAuthorizedSubjects    []string
+	CallerHMACKeyFile           string
+	SecureProxy                 bool
+	CertPath                    string
+
+	PrefillOverrides         map[string]any
+	PrefillBodyPolicy        string
+	PrefillStripFields       []string
+	MaxRequestBodyBytes      int64
+	SpillThresholdBytes      int64
+	SpillDir                 string
+	FastPassthrough          bool
+	MultimodalDecodeOnly     bool
+	AudioModelRoutes         map[string]string
+	TokenizeCacheSize        int
+	PrefillCacheSize         int
+	PrefillCacheTTL          time.Duration
+	PrefixCacheSkipRatio     float64
+	PrefixCacheIndexSize     int
+	PrefixCacheProbeInterval time.Duration
+	PrefillBypassTokens      int
+	EnableBatchAPI           bool
+	BatchMaxConcurrency      int
+	BatchQueueSize           int
+	BatchItemTimeout         time.Duration
+	BatchStoreMaxFiles       int
+	BatchStoreMaxBatches     int
+	BatchStoreMaxBytes       int64
+	BatchRetention           time.Duration
+	EnableMessagesAPI        bool
+	GRPCPort                 string
+	RoutingPolicy            string
+	RoutingPolicyURL         string
+	Passthrough              string
+	PassthroughPaths         []string
+
+	EnableSleepMode   bool
+	SleepControlToken string
+	SleepRetryAfter   time.Duration
+
+	DecoderHealthGating bool
+
+	PrefillerDNSRefreshInterval time.Duration
+	PrefillerSelectionStrategy  string
+	PrefillerStatsFile          string
+	EnableSSRFProtection        bool
+	InferencePoolNamespace      string
+	InferencePoolName           string
+	SSRFStartupTimeout          time.Duration
+	SSRFStrict                  bool
+	SSRFAllowlistSnapshot       string
+	SSRFDegradedMode            string
+	SSRFDegradedGracePeriod     time.Duration
+	SSRFAuditLog                string
+	SSRFAuditAllowed            bool
+
+	// Pools are served besides the main pool, each on its own port
+	Pools []Pool
+
+	DataParallelSize       int
+	DataParallelFailover   bool
+	DataParallelHedgeDelay time.Duration
+
+	RequestTimeout     time.Duration
+	StreamIdleTimeout  time.Duration
+	StreamStallTimeout time.Duration
+	StreamErrorEvents  bool
+	StreamErrorDone    bool
+
+	ShutdownPolicy string
+	DrainTimeout   time.Duration
+
+	DecodeReplay    bool
+	KVTransferRetry string
+
+	CanaryVLLMPort      string
+	CanaryWeight        int
+	CanarySessionHeader string
+
+	SlowPrefillThreshold time.Duration
+	SlowRequestThreshold time.Duration
+	StatsLogInterval     time.Duration
+	RoutingDecisionsSize int
+	LogFormat            string
+	LogDedupWindow       time.Duration
+	LogRedactFields      []string
+
+	InjectStreamUsage     bool
+	AccessLog             bool
+	EngineResponseHeaders bool
+
+	AdmissionMaxConcurrency int
+	AdmissionQueueSize      int
+	AdmissionQueueTimeout   time.Duration
+	AdmissionPreemption     bool
+	TenantHeader            string
+	TenantConcurrencyQuotas map[string]int
+	TenantModels            map[string][]string
+	ModelAliases            map[string]string
+	PriorityHeader          string
+
+	AdminPort             string
+	AdminBindAddresses    []string
+	MergeDecoderMetrics   bool
+	MetricsIdentityLabels bool
+
+	MetricsLabels             []string
+	MetricsTenantHeader       string
+	MetricsModelAllowlist     []string
+	MetricsTenantAllowlist    []string
+	MetricsPrefillerAllowlist []string
+	MetricsLabelHashBuckets   int
+
+	OTLPMetricsEndpoint string
+	OTLPMetricsInsecure bool
+	OTLPMetricsInterval time.Duration
+
+	ProfilingServerAddress     string
+	ProfilingApplicationName   string
+	ProfilingUploadRate        time.Duration
+	ProfilingTenantID          string
+	ProfilingBasicAuthUser     string
+	ProfilingBasicAuthPassword string
+
+	KVEventsSource string
+	KVEventsTopic  string
+	KVEventsSink   string
+	KVEventsModel  string
+
+	// FeatureGates enable or disable the experimental features, which default to their stage
+	FeatureGates map[string]bool
+
+	SelfTestPrefiller string
+	SelfTestModel     string
+}
+
+// Defaults returns the default configuration
+func Defaults() Config {
+	return Config{
+		Port:                        "8000",
+		VLLMPort:                    "8001",
+		Connector:                   proxy.ConnectorNIXLV2,
+		Passthrough:                 proxy.PassthroughAll,
+		PrefillBodyPolicy:           proxy.PrefillBodyFull,
+		PrefillerCAReloadInterval:   time.Minute,
+		SecureProxy:                 true,
+		StreamErrorDone:             true,
+		ShutdownPolicy:              proxy.ShutdownWait,
+		DrainTimeout:                time.Minute,
+		PrefillCacheTTL:             5 * time.Second,
+		PrefixCacheIndexSize:        65536,
+		PrefixCacheProbeInterval:    30 * time.Second,
+		SleepRetryAfter:             30 * time.Second,
+		PrefillerDNSRefreshInterval: 30 * time.Second,
+		SSRFStartupTimeout:          2 * time.Minute,
+		SSRFDegradedMode:            proxy.SSRFDegradedFailClosed,
+		PriorityHeader:              proxy.DefaultPriorityHeader,
+		DataParallelSize:            1,
+		MetricsLabels:               []string{metricsLabelModel},
+		OTLPMetricsInterval:         30 * time.Second,
+		ProfilingApplicationName:    "llm-d-routing-sidecar",
+		ProfilingUploadRate:         15 * time.Second,
+		LogFormat:                   logging.FormatText,
+		LogDedupWindow:              time.Minute,
+		BatchMaxConcurrency:         4,
+		BatchQueueSize:              64,
+		BatchItemTimeout:            10 * time.Minute,
+		BatchStoreMaxFiles:          1000,
+		BatchStoreMaxBatches:        1000,
+		BatchStoreMaxBytes:          1 << 30,
+		BatchRetention:              24 * time.Hour,
+	}
+}
+
+// AddFlags registers the command-line flags of the configuration, defaulting to its current values
+func (c *Config) AddFlags(fs *flag.FlagSet) {
+	fs.StringVar(&c.Port, "port", c.Port, "the port the sidecar is listening on")
+	fs.Var((*listValue)(&c.BindAddresses), "bind-address", "comma-separated list of the addresses the sidecar listens on, e.g. the pod IP to restrict it to the pod network interface (all interfaces when empty)")
+	fs.StringVar(&c.VLLMPort, "vllm-port", c.VLLMPort, "the port vLLM is listening on")
+	fs.StringVar(&c.DecoderURL, "decoder-url", c.DecoderURL, "the URL of the decoder, e.g. http://10.0.0.5:8001, https://vllm:8443 or unix:///run/vllm/vllm.sock, replacing --vllm-port and --decoder-use-tls. Rank i is forwarded to its port+i (defaults to localhost on --vllm-port)")
+	fs.StringVar(&c.Connector, "connector", c.Connector, "the P/D connector being used. Either nixl, nixlv2 or lmcache")
+	fs.StringVar(&c.ExperimentConnector, "experiment-connector", c.ExperimentConnector, "a second P/D connector followed by --experiment-connector-weight percent of the disaggregated requests, to roll out a new protocol. Either nixl, nixlv2 or lmcache (disabled when empty)")
+	fs.IntVar(&c.ExperimentConnectorWeight, "experiment-connector-weight", c.ExperimentConnectorWeight, "the percentage of the disaggregated requests following the experiment connector")
+	fs.BoolVar(&c.PrefillerUseTLS, "prefiller-use-tls", c.PrefillerUseTLS, "whether to use TLS when sending requests to prefillers")
+	fs.BoolVar(&c.DecoderUseTLS, "decoder-use-tls", c.DecoderUseTLS, "whether to use TLS when sending requests to the decoder")
+	fs.StringVar(&c.PrefillerCAFile, "prefiller-ca-file", c.PrefillerCAFile, "a PEM bundle of the CAs trusted, in addition to the system roots, to verify the prefiller certificates")
+	fs.DurationVar(&c.PrefillerCAReloadInterval, "prefiller-ca-reload-interval", c.PrefillerCAReloadInterval, "how often the prefiller CA bundle is checked for changes (0 disables the reload)")
+	fs.StringVar(&c.SPIFFEEndpointSocket, "spiffe-endpoint-socket", c.SPIFFEEndpointSocket, "the address of the SPIFFE Workload API, e.g. unix:///run/spire/agent/public/api.sock, sourcing the mTLS identities of the proxy listener and the prefiller connections (disabled when empty)")
+	fs.Var((*listValue)(&c.SPIFFEAuthorizedIDs), "spiffe-authorized-ids", "comma-separated list of the SPIFFE IDs allowed to connect to the proxy and to serve prefill requests (defaults to the trust domain of the sidecar)")
+	fs.BoolVar(&c.PrefillerInsecureSkipVerify, "prefiller-tls-insecure-skip-verify", c.PrefillerInsecureSkipVerify, "configures the proxy to skip TLS verification for requests to prefiller")
+	fs.BoolVar(&c.DecoderInsecureSkipVerify, "decoder-tls-insecure-skip-verify", c.DecoderInsecureSkipVerify, "configures the proxy to skip TLS verification for requests to decoder")
+	fs.StringVar(&c.DecoderCAFile, "decoder-ca-file", c.DecoderCAFile, "a PEM bundle of the CAs trusted, in addition to the system roots, to verify the decoder certificate")
+	fs.StringVar(&c.PrefillerTokenFile, "prefiller-token-file", c.PrefillerTokenFile, "a bearer token sent to the prefillers in the x-llm-d-caller-authorization header, e.g. a projected ServiceAccount token, read again every minute (disabled when empty)")
+	fs.StringVar(&c.PrefillerTokenAudience, "prefiller-token-audience", c.PrefillerTokenAudience, "the audience the prefiller token must be issued for, checked when it is read")
+	fs.StringVar(&c.PrefillerHMACKeyFile, "prefiller-hmac-key-file", c.PrefillerHMACKeyFile, "a key shared with the prefillers, signing the prefill requests with HMAC-SHA256 in the x-llm-d-caller-signature header (disabled when empty)")
+	fs.StringVar(&c.CallerTokenAudience, "caller-token-audience", c.CallerTokenAudience, "in prefill-side mode, the audience of the ServiceAccount tokens the requests for prefill work must carry in the x-llm-d-caller-authorization header, reviewed with the API server (disabled when empty)")
+	fs.StringVar(&c.CallerHMACKeyFile, "caller-hmac-key-file", c.CallerHMACKeyFile, "in prefill-side mode, the key shared with the --prefiller-hmac-key-file of the decode side, the requests for prefill work having to be signed with it in the x-llm-d-caller-signature header (disabled when empty)")
+	fs.Var((*listValue)(&c.CallerAuthorizedSubjects), "caller-authorized-subjects", "comma-separated list of the subjects allowed to send prefill work, e.g. system:serviceaccount:llm:decode (any subject with a valid token when empty)")
+	fs.StringVar(&c.DecoderTLSServerName, "decoder-tls-server-name", c.DecoderTLSServerName, "the name verified in the decoder certificate (the decoder host when empty)")
+	fs.BoolVar(&c.SecureProxy, "secure-proxy", c.SecureProxy, "Enables secure proxy. Defaults to true.")
+	fs.StringVar(&c.CertPath,
+		"cert-path", c.CertPath, "The path to the certificate for secure proxy. The certificate and private key files "+
+			"are assumed to be named tls.crt and tls.key, respectively. If not set, and secureProxy is enabled, "+
+			"then a self-signed certificate is used (for testing).")
+	fs.Var((*jsonObjectValue)(&c.PrefillOverrides), "prefill-overrides", `JSON object of the fields set in the requests sent to prefillers, e.g. '{"max_tokens": 1, "temperature": 0, "logprobs": null}'. A null value removes the field (defaults to the connector overrides)`)
+	fs.StringVar(&c.PrefillBodyPolicy, "prefill-body-policy", c.PrefillBodyPolicy, "the fields of the requests sent to prefillers: full, or minimal to strip the client-only fields the prefillers ignore, e.g. logit_bias, user or stream_options, kept in the requests sent to vLLM")
+	fs.Var((*listValue)(&c.PrefillStripFields), "prefill-strip-fields", "comma-separated list of the fields stripped from the requests sent to prefillers with -prefill-body-policy=minimal (defaults to "+strings.Join(proxy.DefaultPrefillStripFields, ",")+")")
+	fs.Int64Var(&c.MaxRequestBodyBytes, "max-request-body-bytes", c.MaxRequestBodyBytes, "the maximum size of the completion request bodies, rejected with 413 when larger (0 means no limit)")
+	fs.Int64Var(&c.SpillThresholdBytes, "spill-threshold-bytes", c.SpillThresholdBytes, "buffer the bodies of disaggregated requests larger than this size in temp files rather than memory (0 disables the spill)")
+	fs.StringVar(&c.SpillDir, "spill-dir", c.SpillDir, "the directory of the spilled request bodies (defaults to the OS temp directory)")
+	fs.BoolVar(&c.FastPassthrough, "fast-passthrough", c.FastPassthrough, "send the completion requests without prefiller header to the decoder without reading their body, turning off their validation, prompt size and modality metrics and prefix indexing (rejected with -max-request-body-bytes, -data-parallel-hedge-delay, -routing-policy, middlewares, -inject-stream-usage, -model-aliases, -request-timeout, -stream-idle-timeout, -decode-replay, caller authentication or -prefix-cache-skip-ratio)")
+	fs.BoolVar(&c.MultimodalDecodeOnly, "multimodal-decode-only", c.MultimodalDecodeOnly, "send the requests with image, audio or video content decode-only")
+	fs.Var((*routesValue)(&c.AudioModelRoutes), "audio-model-routes", "comma-separated model=host:port routes for the audio endpoints (audio requests are sent to the decoder when empty or when the model has no route)")
+	fs.IntVar(&c.TokenizeCacheSize, "tokenize-cache-size", c.TokenizeCacheSize, "the number of /tokenize and /detokenize responses cached (0 disables the cache)")
+	fs.IntVar(&c.PrefillCacheSize, "prefill-cache-size", c.PrefillCacheSize, "the number of prefill responses cached, so identical requests sent to the same prefiller within -prefill-cache-ttl skip the prefill (0 disables the cache, nixlv2 connector only)")
+	fs.DurationVar(&c.PrefillCacheTTL, "prefill-cache-ttl", c.PrefillCacheTTL, "how long the prefill responses are cached")
+	fs.Float64Var(&c.PrefixCacheSkipRatio, "prefix-cache-skip-ratio", c.PrefixCacheSkipRatio, "send decode-only the requests whose prompt prefix is estimated to be cached by the decoder for at least this fraction of the prompt (0 disables the estimate)")
+	fs.IntVar(&c.PrefixCacheIndexSize, "prefix-cache-index-size", c.PrefixCacheIndexSize, "the number of prompt chunks of 256 characters indexed to estimate the decoder prefix cache")
+	fs.DurationVar(&c.PrefixCacheProbeInterval, "prefix-cache-probe-interval", c.PrefixCacheProbeInterval, "how often the decoder prefix cache counters are probed to detect restarts (0 disables the probe)")
+	fs.IntVar(&c.PrefillBypassTokens, "prefill-bypass-tokens", c.PrefillBypassTokens, "send the prompts with fewer tokens decode-only, as counted by the decoder /tokenize endpoint (0 disables the bypass)")
+	fs.BoolVar(&c.EnableBatchAPI, "enable-batch-api", c.EnableBatchAPI, "serve the OpenAI /v1/files and /v1/batches endpoints, running each batch item through the P/D protocol (batches are kept in memory)")
+	fs.IntVar(&c.BatchMaxConcurrency, "batch-max-concurrency", c.BatchMaxConcurrency, "the batches of the batch API run at once, the others waiting their turn (0 runs every batch right away)")
+	fs.IntVar(&c.BatchQueueSize, "batch-queue-size", c.BatchQueueSize, "the batches waiting to run at most, the creation of the others being rejected with 429 (0 for no limit)")
+	fs.DurationVar(&c.BatchItemTimeout, "batch-item-timeout", c.BatchItemTimeout, "the deadline of each batch item, the items exceeding it failing with 504 (0 for no deadline)")
+	fs.IntVar(&c.BatchStoreMaxFiles, "batch-store-max-files", c.BatchStoreMaxFiles, "the files of the batch API kept in memory at most, the oldest finished batches being evicted with their files to make room (0 for no limit)")
+	fs.IntVar(&c.BatchStoreMaxBatches, "batch-store-max-batches", c.BatchStoreMaxBatches, "the batches kept in memory at most, the oldest finished ones being evicted with their files to make room (0 for no limit)")
+	fs.Int64Var(&c.BatchStoreMaxBytes, "batch-store-max-bytes", c.BatchStoreMaxBytes, "the size of the files of the batch API kept in memory at most, the oldest finished batches being evicted with their files to make room (0 for no limit)")
+	fs.DurationVar(&c.BatchRetention, "batch-retention", c.BatchRetention, "how long the files and the finished batches of the batch API are kept (0 keeps them until evicted)")
+	fs.StringVar(&c.RoutingPolicy, "routing-policy", c.RoutingPolicy, `CEL expression deciding how each completion request is routed from its headers, path, model, prompt_tokens, modality and prefill target: "allow", "deny", "decode" or the host:port of another prefiller`)
+	fs.StringVar(&c.RoutingPolicyURL, "routing-policy-url", c.RoutingPolicyURL, "the OPA decision endpoint deciding how each completion request is routed, as -routing-policy does")
+	fs.StringVar(&c.Passthrough, "passthrough", c.Passthrough, "the requests not intercepted by the sidecar forwarded to vLLM, the others being rejected with 403: all, openai-only for the /v1/ paths, or list for the -passthrough-paths")
+	fs.Var((*listValue)(&c.PassthroughPaths), "passthrough-paths", "comma-separated list of the paths forwarded to vLLM with -passthrough=list, the paths ending with / allowing the paths under them, e.g. /v1/,/version")
+	fs.BoolVar(&c.DecoderHealthGating, "decoder-health-gating", c.DecoderHealthGating, "turn requests away with 503 and report the sidecar as not ready while the vLLM /health fails, e.g. at startup, probing it with exponential backoff")
+	fs.BoolVar(&c.EnableSleepMode, "enable-sleep-mode", c.EnableSleepMode, "serve the vLLM /sleep and /wake_up endpoints, authenticated with the sleep control token, and turn requests away with 503 while the engine sleeps")
+	fs.StringVar(&c.SleepControlToken, "sleep-control-token", c.SleepControlToken, "the bearer token authenticating the sleep and wake up requests (defaults to SLEEP_CONTROL_TOKEN env var)")
+	fs.DurationVar(&c.SleepRetryAfter, "sleep-retry-after", c.SleepRetryAfter, "the Retry-After delay of the requests turned away while the engine sleeps")
+	fs.BoolVar(&c.EnableMessagesAPI, "enable-messages-api", c.EnableMessagesAPI, "serve the Anthropic /v1/messages endpoint, translated to the decoder chat completions API")
+	fs.StringVar(&c.GRPCPort, "grpc-port", c.GRPCPort, "the port of the experimental gRPC frontend of the main pool, serving the chat completions and completions as unary and server-streaming RPCs of the llmd.routing.v1.Completions service, described by gRPC reflection. Rank i is served on grpc-port+i (disabled when empty)")
+	fs.DurationVar(&c.PrefillerDNSRefreshInterval, "prefiller-dns-refresh-interval", c.PrefillerDNSRefreshInterval, "how often the DNS names of prefillers are re-resolved to rotate requests among their addresses (0 disables the re-resolution)")
+	fs.StringVar(&c.PrefillerSelectionStrategy, "prefiller-selection-strategy", c.PrefillerSelectionStrategy, "select the prefill target among the candidates listed in the x-prefiller-host-port header: random, round-robin, least-recently-used or power-of-two, which picks the faster of two random candidates by recent prefill latency (the requests with several candidates are rejected when empty)")
+	fs.StringVar(&c.PrefillerStatsFile, "prefiller-stats-file", c.PrefillerStatsFile, "the file the latency and error rate of the selected prefillers are persisted to, and loaded from at startup so the selection does not learn them again, e.g. on an emptyDir volume (disabled when empty)")
+	fs.BoolVar(&c.EnableSSRFProtection, "enable-ssrf-protection", c.EnableSSRFProtection, "enable SSRF protection using InferencePool allowlisting")
+	fs.StringVar(&c.InferencePoolNamespace, "inference-pool-namespace", c.InferencePoolNamespace, "the Kubernetes namespace to watch for InferencePool resources (defaults to INFERENCE_POOL_NAMESPACE env var, then to the namespace of the pod's ServiceAccount)")
+	fs.StringVar(&c.InferencePoolName, "inference-pool-name", c.InferencePoolName, "the specific InferencePool name to watch (defaults to INFERENCE_POOL_NAME env var)")
+	fs.DurationVar(&c.SSRFStartupTimeout, "ssrf-startup-timeout", c.SSRFStartupTimeout, "how long the Kubernetes API server is waited for when SSRF protection starts, before failing")
+	fs.BoolVar(&c.SSRFStrict, "ssrf-strict", c.SSRFStrict, "also deny the loopback, link-local (e.g. cloud metadata) and own pod prefill targets, even when allowlisted")
+	fs.StringVar(&c.SSRFAllowlistSnapshot, "ssrf-allowlist-snapshot", c.SSRFAllowlistSnapshot, "the file the SSRF protection allowlist is persisted to, and loaded from at startup to serve prefill requests while the Kubernetes API server is unavailable (disabled when empty)")
+	fs.StringVar(&c.SSRFDegradedMode, "ssrf-degraded-mode", c.SSRFDegradedMode, "how prefill targets are decided once the SSRF protection allowlist is out of sync with the Kubernetes API server for the grace period: fail-closed denies them all, fail-open allows them all")
+	fs.DurationVar(&c.SSRFDegradedGracePeriod, "ssrf-degraded-grace-period", c.SSRFDegradedGracePeriod, "how long the SSRF protection allowlist is used while out of sync with the Kubernetes API server, before -ssrf-degraded-mode applies (0 uses it indefinitely)")
+	fs.StringVar(&c.SSRFAuditLog, "ssrf-audit-log", c.SSRFAuditLog, "the file the prefill targets denied by SSRF protection are appended to as JSON security audit records, or - for the standard output (disabled when empty)")
+	fs.BoolVar(&c.SSRFAuditAllowed, "ssrf-audit-allowed", c.SSRFAuditAllowed, "also audit the prefill targets allowed by SSRF protection")
+	fs.Var((*poolsValue)(&c.Pools), "pools", `JSON array of the virtual pools served besides the main pool, each on its own port with its own InferencePool allowlist and connector, e.g. '[{"name": "pool-b", "port": "8100", "inference-pool-name": "pool-b", "connector": "lmcache"}]'. The InferencePool namespace and the connector default to those of the main pool, the InferencePool name to the pool name`)
+	fs.IntVar(&c.DataParallelSize, "data-parallel-size", c.DataParallelSize, "the number of vLLM data parallel ranks. Rank i is served on port+i and forwarded to vllm-port+i")
+	fs.BoolVar(&c.DataParallelFailover, "data-parallel-failover", c.DataParallelFailover, "redirect the traffic of a data parallel rank to a healthy sibling rank while its vLLM engine is down")
+	fs.DurationVar(&c.RequestTimeout, "request-timeout", c.RequestTimeout, "cancel the non-streaming completion requests not answered within this deadline with 504 (0 for no deadline)")
+	fs.DurationVar(&c.StreamIdleTimeout, "stream-idle-timeout", c.StreamIdleTimeout, "cancel the streaming completion requests when no token was streamed for this timeout, e.g. by a hung engine (0 for no timeout)")
+	fs.DurationVar(&c.StreamStallTimeout, "stream-stall-timeout", c.StreamStallTimeout, "cancel the vLLM event streams receiving no data for this timeout, ending them with an error event (0 disables the watchdog)")
+	fs.BoolVar(&c.StreamErrorEvents, "stream-error-events", c.StreamErrorEvents, "end the vLLM event streams failing midway with an error event instead of truncating them")
+	fs.BoolVar(&c.StreamErrorDone, "stream-error-done", c.StreamErrorDone, "send the data: [DONE] marker after the error events ending the failed and stalled streams")
+	fs.StringVar(&c.ShutdownPolicy, "shutdown-policy", c.ShutdownPolicy, "what happens to the requests in flight at shutdown: wait for them up to -drain-timeout, close those left after -drain-timeout, ending the streams with an error event, or handoff them right away with a retryable 503")
+	fs.DurationVar(&c.DrainTimeout, "drain-timeout", c.DrainTimeout, "how long the requests in flight are waited for at shutdown")
+	fs.BoolVar(&c.DecodeReplay, "decode-replay", c.DecodeReplay, "replay once the non-streaming decode-only requests whose vLLM connection is reset before any response, on a healthy sibling data parallel rank if any")
+	fs.StringVar(&c.KVTransferRetry, "kv-transfer-retry", c.KVTransferRetry, "retry once the disaggregated requests whose vLLM decoder failed to pull the KV blocks, e.g. after a prefiller restart: prefill retries them with a fresh prefill, decode-only without prefill (disabled when empty)")
+	fs.DurationVar(&c.DataParallelHedgeDelay, "data-parallel-hedge-delay", c.DataParallelHedgeDelay, "also send the non-streaming decode-only requests still running after this delay to a sibling data parallel rank, keeping the first response (0 to disable)")
+	fs.StringVar(&c.CanaryVLLMPort, "canary-vllm-port", c.CanaryVLLMPort, "the port a canary vLLM engine is listening on, e.g. a new version, receiving --canary-weight percent of the decode traffic. Rank i is forwarded to canary-vllm-port+i (disabled when empty)")
+	fs.IntVar(&c.CanaryWeight, "canary-weight", c.CanaryWeight, "the percentage of the decode traffic sent to the canary vLLM engine")
+	fs.StringVar(&c.CanarySessionHeader, "canary-session-header", c.CanarySessionHeader, "the request header holding the session of a request, the requests of a session sticking to the same vLLM engine (requests are split at random when empty)")
+	fs.DurationVar(&c.SlowPrefillThreshold, "slow-prefill-threshold", c.SlowPrefillThreshold, "log a warning for the prefills slower than this threshold, with their target, model and sizes (0 disables the warning)")
+	fs.DurationVar(&c.SlowRequestThreshold, "slow-request-threshold", c.SlowRequestThreshold, "log a warning for the completion requests slower than this threshold end to end, with their target, model and sizes (0 disables the warning)")
+	fs.BoolVar(&c.AccessLog, "access-log", c.AccessLog, "log every completion request served, with the wall-clock times of its protocol stages (prefill sent, prefill first byte, decode sent, first token), and send the time of the prefill requests in the x-llm-d-sent-at header to correlate the logs of the prefill and decode pods")
+	fs.BoolVar(&c.InjectStreamUsage, "inject-stream-usage", c.InjectStreamUsage, "always ask the decoder for the usage of the streamed completions, for the token metrics, stripping the final usage chunk when the client did not ask for it")
+	fs.BoolVar(&c.EngineResponseHeaders, "engine-response-headers", c.EngineResponseHeaders, "report the engines which produced a response in the x-llm-d-decode-pod, x-llm-d-decode-pool, x-llm-d-decode-rank, x-llm-d-decode-target, x-llm-d-prefiller and x-llm-d-prefill-engine-id response headers, to attribute the responses in A/B analyses and bug reports")
+	fs.IntVar(&c.AdmissionMaxConcurrency, "admission-max-concurrency", c.AdmissionMaxConcurrency, "the completion requests served concurrently, the others waiting in an admission queue by priority class (0 disables the queue)")
+	fs.IntVar(&c.AdmissionQueueSize, "admission-queue-size", c.AdmissionQueueSize, "the requests waiting in the admission queue at most, the others being rejected with 503 (0 for no limit)")
+	fs.DurationVar(&c.AdmissionQueueTimeout, "admission-queue-timeout", c.AdmissionQueueTimeout, "how long a request waits in the admission queue at most before being rejected with 503 (0 for no limit)")
+	fs.BoolVar(&c.AdmissionPreemption, "admission-preemption", c.AdmissionPreemption, "let the interactive requests arriving in a saturated admission queue preempt the oldest queued or prefilling batch request, rejected with 429")
+	fs.StringVar(&c.TenantHeader, "tenant-header", c.TenantHeader, "the request header holding the tenant of the concurrency quotas and of the model entitlements")
+	fs.Var((*tenantModelsValue)(&c.TenantModels), "tenant-models", `JSON object of the models listed by GET /v1/models for each tenant, by their alias if any, e.g. '{"team-a": ["llama-70b"], "*": ["llama-8b"]}' where "*" applies to the tenants without their own entry (the others see all the models)`)
+	fs.Var((*aliasesValue)(&c.ModelAliases), "model-aliases", "comma-separated model=alias names exposing the decoder models under another name, in GET /v1/models and in the completion requests")
+	fs.Var((*quotasValue)(&c.TenantConcurrencyQuotas), "tenant-concurrency-quotas", `comma-separated tenant=limit quotas of concurrent completion requests, the others being rejected with 429, e.g. "team-a=32,*=8" where "*" applies to the tenants without their own quota`)
+	fs.StringVar(&c.PriorityHeader, "priority-header", c.PriorityHeader, "the request header selecting the priority class of the admission queue: interactive, standard (by default) or batch")
+	fs.IntVar(&c.RoutingDecisionsSize, "routing-decisions-size", c.RoutingDecisionsSize, "the number of last routing decisions of the completion requests (candidates, strategy, prefiller, fallbacks and timings) served on the admin port at /debug/routing, for each data parallel rank (0 disables the decisions)")
+	fs.DurationVar(&c.StatsLogInterval, "stats-log-interval", c.StatsLogInterval, "log the request rate, error rate, p50 and p99 latencies and prefill bypass rate at this interval, for environments without a metrics stack (0 disables the log)")
+	fs.StringVar(&c.LogFormat, "log-format", c.LogFormat, "the format of the logs: text, the klog format, or json, a JSON object per line with the keys of the metrics labels")
+	fs.DurationVar(&c.LogDedupWindow, "log-dedup-window", c.LogDedupWindow, "log a repeated warning or error at most once in this window, then the number of its repeats, e.g. \"message repeated 1829 times in 1m0s\" (0 logs all the repeats)")
+	fs.Var((*listValue)(&c.LogRedactFields), "log-redact-fields", "comma-separated list of the sensitive fields masked in the logs, e.g. x-tenant-token, in addition to the Authorization headers, API keys, tokens, passwords and secrets")
+	fs.StringVar(&c.AdminPort, "admin-port", c.AdminPort, "the port the admin endpoints are served on (disabled when empty)")
+	fs.Var((*listValue)(&c.AdminBindAddresses), "admin-bind-address", "comma-separated list of the addresses the admin endpoints are served on, e.g. 127.0.0.1 to only serve local clients (all interfaces when empty)")
+	fs.BoolVar(&c.MergeDecoderMetrics, "metrics-merge-decoder", c.MergeDecoderMetrics, "merge the metrics scraped from the decoder into the sidecar metrics served on the admin port")
+	fs.BoolVar(&c.MetricsIdentityLabels, "metrics-identity-labels", c.MetricsIdentityLabels, "label the metrics served on the admin port with the pod, namespace and node (read from the POD_NAME, POD_NAMESPACE and NODE_NAME env vars) and the InferencePool of the sidecar")
+	fs.Var((*listValue)(&c.MetricsLabels), "metrics-labels", "comma-separated list of the optional labels of the completion request metrics: model, tenant and prefiller")
+	fs.StringVar(&c.MetricsTenantHeader, "metrics-tenant-header", c.MetricsTenantHeader, "the request header holding the tenant of the tenant metrics label")
+	fs.Var((*listValue)(&c.MetricsModelAllowlist), "metrics-model-allowlist", `comma-separated list of the models kept in the model metrics label, the others being reported as "other" or hashed (all models when empty)`)
+	fs.Var((*listValue)(&c.MetricsTenantAllowlist), "metrics-tenant-allowlist", `comma-separated list of the tenants kept in the tenant metrics label, the others being reported as "other" or hashed (all tenants when empty)`)
+	fs.Var((*listValue)(&c.MetricsPrefillerAllowlist), "metrics-prefiller-allowlist", `comma-separated list of the prefiller host:ports kept in the prefiller metrics label, the others being reported as "other" or hashed (all prefillers when empty)`)
+	fs.IntVar(&c.MetricsLabelHashBuckets, "metrics-label-hash-buckets", c.MetricsLabelHashBuckets, `hash the metrics label values out of their allowlist into this number of values rather than reporting them as "other" (0 disables the hashing)`)
+	fs.StringVar(&c.OTLPMetricsEndpoint, "otlp-metrics-endpoint", c.OTLPMetricsEndpoint, "the host:port of an OpenTelemetry collector the metrics are pushed to over OTLP/HTTP (disabled when empty)")
+	fs.BoolVar(&c.OTLPMetricsInsecure, "otlp-metrics-insecure", c.OTLPMetricsInsecure, "push the OTLP metrics over plain HTTP")
+	fs.DurationVar(&c.OTLPMetricsInterval, "otlp-metrics-interval", c.OTLPMetricsInterval, "the interval between two pushes of the OTLP metrics")
+	fs.StringVar(&c.ProfilingServerAddress, "profiling-server-address", c.ProfilingServerAddress, "the URL of a Pyroscope-compatible server the CPU and allocation profiles are pushed to (disabled when empty)")
+	fs.StringVar(&c.ProfilingApplicationName, "profiling-application-name", c.ProfilingApplicationName, "the application name the profiles are pushed under")
+	fs.DurationVar(&c.ProfilingUploadRate, "profiling-upload-rate", c.ProfilingUploadRate, "the interval between two pushes of the profiles")
+	fs.StringVar(&c.ProfilingTenantID, "profiling-tenant-id", c.ProfilingTenantID, "the tenant the profiles are pushed to, for multi-tenant servers")
+	fs.StringVar(&c.ProfilingBasicAuthUser, "profiling-basic-auth-user", c.ProfilingBasicAuthUser, "the user authenticating with the profiling server (defaults to PROFILING_BASIC_AUTH_USER env var)")
+	fs.StringVar(&c.ProfilingBasicAuthPassword, "profiling-basic-auth-password", c.ProfilingBasicAuthPassword, "the password authenticating with the profiling server (defaults to PROFILING_BASIC_AUTH_PASSWORD env var)")
+	fs.StringVar(&c.KVEventsSource, "kv-events-source", c.KVEventsSource, "the KV cache event stream of the engine relayed to the scheduler: tcp://host:port for its ZMQ publisher or nats://host:port/subject (disabled when empty)")
+	fs.StringVar(&c.KVEventsTopic, "kv-events-topic", c.KVEventsTopic, "the prefix of the ZMQ topics of the KV events subscribed to (all topics when empty)")
+	fs.StringVar(&c.KVEventsSink, "kv-events-sink", c.KVEventsSink, "where the KV events are republished: tcp://[host]:port to bind a ZMQ publisher, nats://host:port/subject or an http(s) URL")
+	fs.StringVar(&c.KVEventsModel, "kv-events-model", c.KVEventsModel, "the model served by the engine, part of the topic of the relayed KV events")
+	fs.Var((*featureGatesValue)(&c.FeatureGates), "feature-gates", featureGatesUsage())
+	fs.StringVar(&c.SelfTestPrefiller, "selftest-prefiller", c.SelfTestPrefiller, "run a P/D self-test against the given prefiller host:port and the local decoder, then exit")
+	fs.StringVar(&c.SelfTestModel, "selftest-model", c.SelfTestModel, "the model used by the self-test (defaults to the first model served by the decoder)")
+}
+
+// Validate returns all the problems of the configuration, joined
+func (c *Config) Validate() error {
+	var errs []error
+	check := func(ok bool, format string, args ...any) {
+		if !ok {
+			errs = append(errs, fmt.Errorf(format, args...))
+		}
+	}
+
+	check(c.Connector == proxy.ConnectorNIXLV1 || c.Connector == proxy.ConnectorNIXLV2 || c.Connector == proxy.ConnectorLMCache,
+		"--connector must either be 'nixl', 'nixlv2' or 'lmcache'")
+	check(c.ExperimentConnector == "" || c.ExperimentConnector == proxy.ConnectorNIXLV1 || c.ExperimentConnector == proxy.ConnectorNIXLV2 || c.ExperimentConnector == proxy.ConnectorLMCache,
+		"--experiment-connector must either be 'nixl', 'nixlv2' or 'lmcache'")
+	check(c.ExperimentConnector == "" || c.ExperimentConnector != c.Connector, "--experiment-connector must differ from --connector")
+	check(c.ExperimentConnectorWeight >= 0 && c.ExperimentConnectorWeight <= 100, "--experiment-connector-weight must be between 0 and 100")
+	check(c.ExperimentConnectorWeight == 0 || c.ExperimentConnector != "", "--experiment-connector-weight requires --experiment-connector")
+	check(validPort(c.Port), "--port must be a port number, got %q", c.Port)
+	check(c.CanaryVLLMPort == "" || validPort(c.CanaryVLLMPort), "--canary-vllm-port must be a port number, got %q", c.CanaryVLLMPort)
+	check(c.AdminPort == "" || validPort(c.AdminPort), "--admin-port must be a port number, got %q", c.AdminPort)
+	check(c.GRPCPort == "" || validPort(c.GRPCPort), "--grpc-port must be a port number, got %q", c.GRPCPort)
+	check(c.GRPCPort == "" || c.GRPCPort != c.Port, "--grpc-port must differ from --port")
+	check(c.DataParallelSize >= 1, "--data-parallel-size must be at least 1")
+	for _, address := range c.BindAddresses {
+		check(validBindAddress(address), "--bind-address must be a list of IP addresses or host names, got %q", address)
+	}
+	for _, address := range c.AdminBindAddresses {
+		check(validBindAddress(address), "--admin-bind-address must be a list of IP addresses or host names, got %q", address)
+	}
+	check(len(c.AdminBindAddresses) == 0 || c.AdminPort != "", "--admin-bind-address requires --admin-port")
+
+	if c.EnableSSRFProtection {
+		check(c.InferencePoolNamespace != "", "--inference-pool-namespace or INFERENCE_POOL_NAMESPACE environment variable is required when --enable-ssrf-protection is true outside of a pod with a mounted ServiceAccount")
+		check(c.InferencePoolName != "", "--inference-pool-name or INFERENCE_POOL_NAME environment variable is required when --enable-ssrf-protection is true")
+	}
+	check(!c.SSRFStrict || c.EnableSSRFProtection, "--ssrf-strict requires --enable-ssrf-protection")
+	check(c.KVTransferRetry == "" || c.KVTransferRetry == proxy.KVTransferRetryPrefill || c.KVTransferRetry == proxy.KVTransferRetryDecodeOnly,
+		"--kv-transfer-retry must be either prefill or decode-only, got %q", c.KVTransferRetry)
+	check(c.PrefillerSelectionStrategy == "" || slices.Contains(proxy.PrefillerSelectionStrategies, c.PrefillerSelectionStrategy),
+		"--prefiller-selection-strategy must be one of %s, got %q", strings.Join(proxy.PrefillerSelectionStrategies, ", "), c.PrefillerSelectionStrategy)
+	check(c.PrefillerStatsFile == "" || c.PrefillerSelectionStrategy != "", "--prefiller-stats-file requires --prefiller-selection-strategy")
+	check(c.SSRFDegradedMode == proxy.SSRFDegradedFailClosed || c.SSRFDegradedMode == proxy.SSRFDegradedFailOpen,
+		"--ssrf-degraded-mode must be either fail-closed or fail-open, got %q", c.SSRFDegradedMode)
+	check(c.SSRFDegradedGracePeriod >= 0, "--ssrf-degraded-grace-period must not be negative")
+	check(c.SSRFAllowlistSnapshot == "" || c.EnableSSRFProtection, "--ssrf-allowlist-snapshot requires --enable-ssrf-protection")
+	check(c.SSRFAuditLog == "" || c.EnableSSRFProtection, "--ssrf-audit-log requires --enable-ssrf-protection")
+	check(!c.SSRFAuditAllowed || c.SSRFAuditLog != "", "--ssrf-audit-allowed requires --ssrf-audit-log")
+	check(!c.EnableSleepMode || c.SleepControlToken != "", "--sleep-control-token or SLEEP_CONTROL_TOKEN environment variable is required when --enable-sleep-mode is true")
+	check(c.PrefillerTokenAudience == "" || c.PrefillerTokenFile != "", "--prefiller-token-audience requires --prefiller-token-file")
+	check(len(c.CallerAuthorizedSubjects) == 0 || c.CallerTokenAudience != "", "--caller-authorized-subjects requires --caller-token-audience")
+	errs = append(errs, c.validateDecoder()...)
+	errs = append(errs, c.validatePools()...)
+	check(c.Passthrough == proxy.PassthroughAll || c.Passthrough == proxy.PassthroughOpenAIOnly || c.Passthrough == proxy.PassthroughList,
+		"--passthrough must either be 'all', 'openai-only' or 'list', got %q", c.Passthrough)
+	check(c.Passthrough != proxy.PassthroughList || len(c.PassthroughPaths) > 0, "--passthrough-paths is required when --passthrough is list")
+	check(len(c.PassthroughPaths) == 0 || c.Passthrough == proxy.PassthroughList, "--passthrough-paths requires --passthrough=list")
+	check(c.PrefillBodyPolicy == proxy.PrefillBodyFull || c.PrefillBodyPolicy == proxy.PrefillBodyMinimal,
+		"--prefill-body-policy must either be 'full' or 'minimal', got %q", c.PrefillBodyPolicy)
+	check(len(c.PrefillStripFields) == 0 || c.PrefillBodyPolicy == proxy.PrefillBodyMinimal, "--prefill-strip-fields requires --prefill-body-policy=minimal")
+	for _, field := range c.PrefillStripFields {
+		check(!slices.Contains(prefillRequiredFields, field), "--prefill-strip-fields must not strip %q, required by the prefill", field)
+	}
+	check(c.RoutingPolicy == "" || c.RoutingPolicyURL == "", "--routing-policy and --routing-policy-url are mutually exclusive")
+	check(len(c.SPIFFEAuthorizedIDs) == 0 || c.SPIFFEEndpointSocket != "", "--spiffe-authorized-ids requires --spiffe-endpoint-socket")
+	check(c.KVEventsSource == "" || c.KVEventsSink != "", "--kv-events-sink is required when --kv-events-source is set")
+	for _, label := range c.MetricsLabels {
+		check(label == metricsLabelModel || label == metricsLabelTenant || label == metricsLabelPrefiller,
+			"--metrics-labels must be a list of model, tenant or prefiller, got %q", label)
+	}
+	check(!slices.Contains(c.MetricsLabels, metricsLabelTenant) || c.MetricsTenantHeader != "", "--metrics-tenant-header is required when --metrics-labels includes tenant")
+
+	check(c.MaxRequestBodyBytes >= 0, "--max-request-body-bytes must not be negative")
+	check(c.SpillThresholdBytes >= 0, "--spill-threshold-bytes must not be negative")
+	check(c.TokenizeCacheSize >= 0, "--tokenize-cache-size must not be negative")
+	check(c.PrefillCacheSize >= 0, "--prefill-cache-size must not be negative")
+	check(c.PrefillCacheSize == 0 || c.PrefillCacheTTL > 0, "--prefill-cache-ttl must be positive when --prefill-cache-size is set")
+	check(c.PrefixCacheSkipRatio >= 0 && c.PrefixCacheSkipRatio <= 1, "--prefix-cache-skip-ratio must be between 0 and 1")
+	check(c.PrefixCacheSkipRatio == 0 || c.PrefixCacheIndexSize > 0, "--prefix-cache-index-size must be positive when --prefix-cache-skip-ratio is set")
+	check(c.PrefillBypassTokens >= 0, "--prefill-bypass-tokens must not be negative")
+	check(c.MetricsLabelHashBuckets >= 0, "--metrics-label-hash-buckets must not be negative")
+	check(c.ShutdownPolicy == proxy.ShutdownWait || c.ShutdownPolicy == proxy.ShutdownClose || c.ShutdownPolicy == proxy.ShutdownHandoff,
+		"--shutdown-policy must either be 'wait', 'close' or 'handoff', got %q", c.ShutdownPolicy)
+	check(c.DrainTimeout > 0, "--drain-timeout must be positive")
+
+	for name, d := range map[string]time.Duration{
+		"prefiller-ca-reload-interval":   c.PrefillerCAReloadInterval,
+		"prefill-cache-ttl":              c.PrefillCacheTTL,
+		"prefix-cache-probe-interval":    c.PrefixCacheProbeInterval,
+		"sleep-retry-after":              c.SleepRetryAfter,
+		"prefiller-dns-refresh-interval": c.PrefillerDNSRefreshInterval,
+		"data-parallel-hedge-delay":      c.DataParallelHedgeDelay,
+		"request-timeout":                c.RequestTimeout,
+		"stream-idle-timeout":            c.StreamIdleTimeout,
+		"stream-stall-timeout":           c.StreamStallTimeout,
+		"ssrf-startup-timeout":           c.SSRFStartupTimeout,
+		"slow-prefill-threshold":         c.SlowPrefillThreshold,
+		"slow-request-threshold":         c.SlowRequestThreshold,
+		"stats-log-interval":             c.StatsLogInterval,
+		"log-dedup-window":               c.LogDedupWindow,
+		"batch-item-timeout":             c.BatchItemTimeout,
+		"batch-retention":                c.BatchRetention,
+		"admission-queue-timeout":        c.AdmissionQueueTimeout,
+	} {
+		check(d >= 0, "--%s must not be negative", name)
+	}
+	check(c.AdmissionMaxConcurrency >= 0, "--admission-max-concurrency must not be negative")
+	check(c.BatchMaxConcurrency >= 0, "--batch-max-concurrency must not be negative")
+	check(c.BatchQueueSize >= 0, "--batch-queue-size must not be negative")
+	check(c.BatchStoreMaxFiles >= 0, "--batch-store-max-files must not be negative")
+	check(c.BatchStoreMaxBatches >= 0, "--batch-store-max-batches must not be negative")
+	check(c.BatchStoreMaxBytes >= 0, "--batch-store-max-bytes must not be negative")
+	check(c.RoutingDecisionsSize >= 0, "--routing-decisions-size must not be negative")
+	check(c.AdmissionQueueSize >= 0, "--admission-queue-size must not be negative")
+	check(!c.AdmissionPreemption || c.AdmissionMaxConcurrency > 0, "--admission-preemption requires --admission-max-concurrency")
+	check(len(c.TenantConcurrencyQuotas) == 0 || c.TenantHeader != "", "--tenant-concurrency-quotas requires --tenant-header")
+	check(len(c.TenantModels) == 0 || c.TenantHeader != "", "--tenant-models requires --tenant-header")
+	check(c.CanaryWeight >= 0 && c.CanaryWeight <= 100, "--canary-weight must be between 0 and 100")
+	check(c.CanaryWeight == 0 || c.CanaryVLLMPort != "", "--canary-weight requires --canary-vllm-port")
+	check(c.OTLPMetricsEndpoint == "" || c.OTLPMetricsInterval > 0, "--otlp-metrics-interval must be positive")
+	check(c.ProfilingServerAddress == "" || c.ProfilingUploadRate > 0, "--profiling-upload-rate must be positive")
+	check(c.LogFormat == logging.FormatText || c.LogFormat == logging.FormatJSON, "--log-format must be either text or json, got %q", c.LogFormat)
+
+	return errors.Join(errs...)
+}
+
+// ProxyConfig returns the configuration of the proxy of each data parallel rank, without the
+// disabled features
+func (c *Config) ProxyConfig() proxy.Config {
+	config := proxy.Config{
+		Connector:                   c.Connector,
+		ExperimentConnector:         c.ExperimentConnector,
+		ExperimentConnectorWeight:   c.ExperimentConnectorWeight,
+		BindAddresses:               c.BindAddresses,
+		PrefillerUseTLS:             c.PrefillerUseTLS,
+		SecureProxy:                 c.SecureProxy,
+		CertPath:                    c.CertPath,
+		PrefillerCAFile:             c.PrefillerCAFile,
+		PrefillerCAReloadInterval:   c.PrefillerCAReloadInterval,
+		PrefillerInsecureSkipVerify: c.PrefillerInsecureSkipVerify,
+		SPIFFEAuthorizedIDs:         c.SPIFFEAuthorizedIDs,
+		DecoderInsecureSkipVerify:   c.DecoderInsecureSkipVerify,
+		DecoderCAFile:               c.DecoderCAFile,
+		DecoderTLSServerName:        c.DecoderTLSServerName,
+		DecoderSocket:               c.DecoderSocket(),
+		PrefillerTokenFile:          c.PrefillerTokenFile,
+		PrefillerTokenAudience:      c.PrefillerTokenAudience,
+		PrefillerHMACKeyFile:        c.PrefillerHMACKeyFile,
+		CallerTokenAudience:         c.CallerTokenAudience,
+		CallerAuthorizedSubjects:    c.CallerAuthorizedSubjects,
+		CallerHMACKeyFile:           c.CallerHMACKeyFile,
+		EnableSSRFProtection:        c.EnableSSRFProtection,
+		InferencePoolNamespace:      c.InferencePoolNamespace,
+		InferencePoolName:           c.InferencePoolName,
+		SSRFStartupTimeout:          c.SSRFStartupTimeout,
+		SSRFStrict:                  c.SSRFStrict,
+		SSRFAllowlistSnapshot:       c.SSRFAllowlistSnapshot,
+		SSRFDegradedMode:            c.SSRFDegradedMode,
+		SSRFDegradedGracePeriod:     c.SSRFDegradedGracePeriod,
+		SSRFAuditAllowed:            c.SSRFAuditAllowed,
+		PrefillOverrides:            c.PrefillOverrides,
+		MaxRequestBodyBytes:         c.MaxRequestBodyBytes,
+		SpillThresholdBytes:         c.SpillThresholdBytes,
+		SpillDir:                    c.SpillDir,
+		FastPassthrough:             c.FastPassthrough,
+		MultimodalDecodeOnly:        c.MultimodalDecodeOnly,
+		AudioModelRoutes:            c.AudioModelRoutes,
+		TokenizeCacheSize:           c.TokenizeCacheSize,
+		PrefillCacheSize:            c.PrefillCacheSize,
+		PrefillCacheTTL:             c.PrefillCacheTTL,
+		PrefixCacheSkipRatio:        c.PrefixCacheSkipRatio,
+		PrefixCacheIndexSize:        c.PrefixCacheIndexSize,
+		PrefixCacheProbeInterval:    c.PrefixCacheProbeInterval,
+		PrefillBypassTokens:         c.PrefillBypassTokens,
+		EnableBatchAPI:              c.EnableBatchAPI,
+		BatchMaxConcurrency:         c.BatchMaxConcurrency,
+		BatchQueueSize:              c.BatchQueueSize,
+		BatchItemTimeout:            c.BatchItemTimeout,
+		BatchStoreMaxFiles:          c.BatchStoreMaxFiles,
+		BatchStoreMaxBatches:        c.BatchStoreMaxBatches,
+		BatchStoreMaxBytes:          c.BatchStoreMaxBytes,
+		BatchRetention:              c.BatchRetention,
+		EnableMessagesAPI:           c.EnableMessagesAPI,
+		RoutingPolicy:               c.RoutingPolicy,
+		RoutingPolicyURL:            c.RoutingPolicyURL,
+		Passthrough:                 c.Passthrough,
+		PassthroughPaths:            c.PassthroughPaths,
+		EnableSleepMode:             c.EnableSleepMode,
+		DecoderHealthGating:         c.DecoderHealthGating,
+		SleepControlToken:           c.SleepControlToken,
+		SleepRetryAfter:             c.SleepRetryAfter,
+		PrefillerDNSRefreshInterval: c.PrefillerDNSRefreshInterval,
+		PrefillerSelectionStrategy:  c.PrefillerSelectionStrategy,
+		PrefillerStatsFile:          c.PrefillerStatsFile,
+		DataParallelFailover:        c.DataParallelFailover,
+		DataParallelHedgeDelay:      c.DataParallelHedgeDelay,
+		RequestTimeout:              c.RequestTimeout,
+		StreamIdleTimeout:           c.StreamIdleTimeout,
+		StreamStallTimeout:          c.StreamStallTimeout,
+		StreamErrorEvents:           c.StreamErrorEvents,
+		StreamErrorOmitDone:         !c.StreamErrorDone,
+		ShutdownPolicy:              c.ShutdownPolicy,
+		DrainTimeout:                c.DrainTimeout,
+		DecodeReplay:                c.DecodeReplay,
+		KVTransferRetry:             c.KVTransferRetry,
+		CanaryWeight:                c.CanaryWeight,
+		CanarySessionHeader:         c.CanarySessionHeader,
+		SlowPrefillThreshold:        c.SlowPrefillThreshold,
+		SlowRequestThreshold:        c.SlowRequestThreshold,
+		StatsLogInterval:            c.StatsLogInterval,
+		RoutingDecisionsSize:        c.RoutingDecisionsSize,
+		InjectStreamUsage:           c.InjectStreamUsage,
+		AccessLog:                   c.AccessLog,
+		EngineResponseHeaders:       c.EngineResponseHeaders,
+		AdmissionMaxConcurrency:     c.AdmissionMaxConcurrency,
+		AdmissionQueueSize:          c.AdmissionQueueSize,
+		AdmissionQueueTimeout:       c.AdmissionQueueTimeout,
+		AdmissionPreemption:         c.AdmissionPreemption,
+		TenantHeader:                c.TenantHeader,
+		TenantConcurrencyQuotas:     c.TenantConcurrencyQuotas,
+		TenantModels:                c.TenantModels,
+		ModelAliases:                c.ModelAliases,
+		PriorityHeader:              c.PriorityHeader,
+	}
+	if c.PrefillBodyPolicy == proxy.PrefillBodyMinimal {
+		config.PrefillStripFields = c.PrefillStripFields
+		if len(config.PrefillStripFields) == 0 {
+			config.PrefillStripFields = proxy.DefaultPrefillStripFields
+		}
+	}
+	if !c.FeatureEnabled(FeatureDataParallelHedging) {
+		config.DataParallelHedgeDelay = 0
+	}
+	if !c.FeatureEnabled(FeaturePrefillCache) {
+		config.PrefillCacheSize = 0
+	}
+	return config
+}
+
+// MetricsLabelConfig returns the configuration of the optional labels of the completion request metrics
+func (c *Config) MetricsLabelConfig() metrics.LabelConfig {
+	options := func(label string, allowlist []string) metrics.LabelOptions {
+		return metrics.LabelOptions{
+			Enabled:     slices.Contains(c.MetricsLabels, label),
+			Allowlist:   allowlist,
+			HashBuckets: c.MetricsLabelHashBuckets,
+		}
+	}
+	return metrics.LabelConfig{
+		Model:        options(metricsLabelModel, c.MetricsModelAllowlist),
+		Tenant:       options(metricsLabelTenant, c.MetricsTenantAllowlist),
+		TenantHeader: c.MetricsTenantHeader,
+		Prefiller:    options(metricsLabelPrefiller, c.MetricsPrefillerAllowlist),
+	}
+}
+
+// validBindAddress returns whether address is an IP address or a host name, without port
+func validBindAddress(address string) bool {
+	return address != "" && (net.ParseIP(address) != nil || !strings.ContainsAny(address, ":/[] "))
+}
+
+// validPort returns whether port is a TCP port number
+func validPort(port string) bool {
+	p, err := strconv.Atoi(port)
+	return err == nil && p >= 0 && p <= 65535
+}
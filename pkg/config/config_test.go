@@ -0,0 +1,179 @@
+/*
+Copyright 2025 The llm-d Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"time"
+
+	"github.com/llm-d/llm-d-routing-sidecar/internal/metrics"
+	"github.com/llm-d/llm-d-routing-sidecar/internal/proxy"
+	. "github.com/onsi/ginkgo/v2" // nolint:revive
+	. "github.com/onsi/gomega"    // nolint:revive
+)
+
+var _ = Describe("Config", func() {
+	It("should validate the defaults", func() {
+		config := Defaults()
+		Expect(config.Validate()).To(Succeed())
+	})
+
+	DescribeTable("should reject invalid combinations",
+		func(update func(*Config), expected string) {
+			config := Defaults()
+			update(&config)
+			err := config.Validate()
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring(expected))
+		},
+		Entry("unknown connector", func(c *Config) { c.Connector = "mooncake" }, "--connector"),
+		Entry("invalid port", func(c *Config) { c.Port = "http" }, "--port"),
+		Entry("invalid vLLM port", func(c *Config) { c.VLLMPort = "70000" }, "--vllm-port"),
+		Entry("invalid admin port", func(c *Config) { c.AdminPort = "-1" }, "--admin-port"),
+		Entry("bind address with port", func(c *Config) { c.BindAddresses = []string{"10.0.0.1:8000"} }, "--bind-address"),
+		Entry("invalid admin bind address", func(c *Config) {
+			c.AdminPort = "9000"
+			c.AdminBindAddresses = []string{"http://localhost"}
+		}, "--admin-bind-address"),
+		Entry("admin bind address without admin port", func(c *Config) { c.AdminBindAddresses = []string{"127.0.0.1"} }, "--admin-port"),
+		Entry("no data parallel rank", func(c *Config) { c.DataParallelSize = 0 }, "--data-parallel-size"),
+		Entry("SSRF protection without namespace", func(c *Config) {
+			c.EnableSSRFProtection = true
+			c.InferencePoolName = "pool"
+		}, "--inference-pool-namespace"),
+		Entry("SSRF protection without pool", func(c *Config) {
+			c.EnableSSRFProtection = true
+			c.InferencePoolNamespace = "default"
+		}, "--inference-pool-name"),
+		Entry("strict SSRF protection without SSRF protection", func(c *Config) { c.SSRFStrict = true }, "--enable-ssrf-protection"),
+		Entry("allowlist snapshot without SSRF protection", func(c *Config) { c.SSRFAllowlistSnapshot = "/tmp/allowlist.json" }, "--enable-ssrf-protection"),
+		Entry("negative admission concurrency", func(c *Config) { c.AdmissionMaxConcurrency = -1 }, "--admission-max-concurrency"),
+		Entry("negative admission queue size", func(c *Config) { c.AdmissionQueueSize = -1 }, "--admission-queue-size"),
+		Entry("admission preemption without admission queue", func(c *Config) { c.AdmissionPreemption = true }, "--admission-preemption"),
+		Entry("tenant quotas without tenant header", func(c *Config) { c.TenantConcurrencyQuotas = map[string]int{"acme": 1} }, "--tenant-header"),
+		Entry("negative request timeout", func(c *Config) { c.RequestTimeout = -time.Second }, "--request-timeout"),
+		Entry("tenant models without tenant header", func(c *Config) { c.TenantModels = map[string][]string{"acme": {"llama"}} }, "--tenant-header"),
+		Entry("invalid SSRF degraded mode", func(c *Config) { c.SSRFDegradedMode = "fail-safe" }, "--ssrf-degraded-mode"),
+		Entry("negative batch max concurrency", func(c *Config) { c.BatchMaxConcurrency = -1 }, "--batch-max-concurrency"),
+		Entry("negative batch item timeout", func(c *Config) { c.BatchItemTimeout = -time.Second }, "--batch-item-timeout"),
+		Entry("negative batch store size", func(c *Config) { c.BatchStoreMaxBytes = -1 }, "--batch-store-max-bytes"),
+		Entry("negative log dedup window", func(c *Config) { c.LogDedupWindow = -time.Second }, "--log-dedup-window"),
+		Entry("invalid log format", func(c *Config) { c.LogFormat = "logfmt" }, "--log-format"),
+		Entry("invalid prefiller selection strategy", func(c *Config) { c.PrefillerSelectionStrategy = "fastest" }, "--prefiller-selection-strategy"),
+		Entry("prefiller stats without selection strategy", func(c *Config) { c.PrefillerStatsFile = "/var/run/prefillers.json" }, "--prefiller-selection-strategy"),
+		Entry("negative routing decisions size", func(c *Config) { c.RoutingDecisionsSize = -1 }, "--routing-decisions-size"),
+		Entry("invalid gRPC port", func(c *Config) { c.GRPCPort = "grpc" }, "--grpc-port"),
+		Entry("gRPC port of the proxy", func(c *Config) { c.GRPCPort = c.Port }, "--grpc-port"),
+		Entry("invalid KV transfer retry", func(c *Config) { c.KVTransferRetry = "always" }, "--kv-transfer-retry"),
+		Entry("negative SSRF degraded grace period", func(c *Config) { c.SSRFDegradedGracePeriod = -time.Second }, "--ssrf-degraded-grace-period"),
+		Entry("decoder CA without decoder TLS", func(c *Config) { c.DecoderCAFile = "/etc/decoder/ca.crt" }, "--decoder-use-tls"),
+		Entry("decoder server name without decoder TLS", func(c *Config) { c.DecoderTLSServerName = "vllm" }, "--decoder-use-tls"),
+		Entry("prefiller token audience without token", func(c *Config) { c.PrefillerTokenAudience = "prefill" }, "--prefiller-token-file"),
+		Entry("caller subjects without audience", func(c *Config) {
+			c.CallerAuthorizedSubjects = []string{"system:serviceaccount:llm:decode"}
+		}, "--caller-token-audience"),
+		Entry("SSRF audit without SSRF protection", func(c *Config) { c.SSRFAuditLog = "-" }, "--enable-ssrf-protection"),
+		Entry("SSRF audit of allowed targets without log", func(c *Config) { c.SSRFAuditAllowed = true }, "--ssrf-audit-log"),
+		Entry("sleep mode without token", func(c *Config) { c.EnableSleepMode = true }, "--sleep-control-token"),
+		Entry("both routing policies", func(c *Config) {
+			c.RoutingPolicy = "true"
+			c.RoutingPolicyURL = "http://localhost:8181/v1/data/llmd/routing"
+		}, "mutually exclusive"),
+		Entry("SPIFFE IDs without Workload API", func(c *Config) { c.SPIFFEAuthorizedIDs = []string{"spiffe://example.org/prefill"} }, "--spiffe-endpoint-socket"),
+		Entry("KV events without sink", func(c *Config) { c.KVEventsSource = "tcp://localhost:5557" }, "--kv-events-sink"),
+		Entry("negative body limit", func(c *Config) { c.MaxRequestBodyBytes = -1 }, "--max-request-body-bytes"),
+		Entry("negative spill threshold", func(c *Config) { c.SpillThresholdBytes = -1 }, "--spill-threshold-bytes"),
+		Entry("negative tokenize cache", func(c *Config) { c.TokenizeCacheSize = -1 }, "--tokenize-cache-size"),
+		Entry("negative prefill cache", func(c *Config) { c.PrefillCacheSize = -1 }, "--prefill-cache-size"),
+		Entry("prefill cache without TTL", func(c *Config) {
+			c.PrefillCacheSize = 16
+			c.PrefillCacheTTL = 0
+		}, "--prefill-cache-ttl"),
+		Entry("prefix cache ratio above 1", func(c *Config) { c.PrefixCacheSkipRatio = 1.5 }, "--prefix-cache-skip-ratio"),
+		Entry("prefix cache without index", func(c *Config) {
+			c.PrefixCacheSkipRatio = 0.5
+			c.PrefixCacheIndexSize = 0
+		}, "--prefix-cache-index-size"),
+		Entry("negative prefill bypass", func(c *Config) { c.PrefillBypassTokens = -1 }, "--prefill-bypass-tokens"),
+		Entry("negative hedge delay", func(c *Config) { c.DataParallelHedgeDelay = -time.Second }, "--data-parallel-hedge-delay"),
+		Entry("unknown passthrough policy", func(c *Config) { c.Passthrough = "none" }, "--passthrough"),
+		Entry("unknown shutdown policy", func(c *Config) { c.ShutdownPolicy = "abort" }, "--shutdown-policy"),
+		Entry("no drain timeout", func(c *Config) { c.DrainTimeout = 0 }, "--drain-timeout"),
+		Entry("passthrough list without paths", func(c *Config) { c.Passthrough = "list" }, "--passthrough-paths"),
+		Entry("passthrough paths without list", func(c *Config) { c.PassthroughPaths = []string{"/v1/"} }, "--passthrough=list"),
+		Entry("unknown prefill body policy", func(c *Config) { c.PrefillBodyPolicy = "compact" }, "--prefill-body-policy"),
+		Entry("prefill strip fields without minimal policy", func(c *Config) { c.PrefillStripFields = []string{"user"} }, "--prefill-body-policy=minimal"),
+		Entry("prefill strip fields with the prompt", func(c *Config) {
+			c.PrefillBodyPolicy = proxy.PrefillBodyMinimal
+			c.PrefillStripFields = []string{"user", "messages"}
+		}, `must not strip "messages"`),
+		Entry("invalid experiment connector", func(c *Config) { c.ExperimentConnector = "mooncake" }, "--experiment-connector"),
+		Entry("experiment connector same as connector", func(c *Config) { c.ExperimentConnector = c.Connector }, "--experiment-connector must differ"),
+		Entry("experiment connector weight without connector", func(c *Config) { c.ExperimentConnectorWeight = 10 }, "--experiment-connector-weight requires"),
+		Entry("invalid canary port", func(c *Config) { c.CanaryVLLMPort = "canary" }, "--canary-vllm-port"),
+		Entry("canary weight above 100", func(c *Config) { c.CanaryVLLMPort = "8101"; c.CanaryWeight = 101 }, "--canary-weight"),
+		Entry("canary weight without canary port", func(c *Config) { c.CanaryWeight = 10 }, "--canary-vllm-port"),
+		Entry("unknown metrics label", func(c *Config) { c.MetricsLabels = []string{"model", "user"} }, "--metrics-labels"),
+		Entry("tenant metrics label without header", func(c *Config) { c.MetricsLabels = []string{"tenant"} }, "--metrics-tenant-header"),
+		Entry("negative metrics label hash buckets", func(c *Config) { c.MetricsLabelHashBuckets = -1 }, "--metrics-label-hash-buckets"),
+		Entry("negative slow request threshold", func(c *Config) { c.SlowRequestThreshold = -time.Second }, "--slow-request-threshold"),
+		Entry("OTLP metrics without interval", func(c *Config) {
+			c.OTLPMetricsEndpoint = "localhost:4318"
+			c.OTLPMetricsInterval = 0
+		}, "--otlp-metrics-interval"),
+		Entry("profiling without upload rate", func(c *Config) {
+			c.ProfilingServerAddress = "http://pyroscope:4040"
+			c.ProfilingUploadRate = 0
+		}, "--profiling-upload-rate"),
+	)
+
+	It("should report all the problems", func() {
+		config := Defaults()
+		config.Connector = "mooncake"
+		config.DataParallelSize = 0
+		err := config.Validate()
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).To(ContainSubstring("--connector"))
+		Expect(err.Error()).To(ContainSubstring("--data-parallel-size"))
+	})
+
+	It("should configure the prefill body policy", func() {
+		config := Defaults()
+		Expect(config.ProxyConfig().PrefillStripFields).To(BeEmpty())
+
+		config.PrefillBodyPolicy = proxy.PrefillBodyMinimal
+		Expect(config.ProxyConfig().PrefillStripFields).To(Equal(proxy.DefaultPrefillStripFields))
+
+		config.PrefillStripFields = []string{"user"}
+		Expect(config.ProxyConfig().PrefillStripFields).To(Equal([]string{"user"}))
+	})
+
+	It("should configure the metrics labels", func() {
+		config := Defaults()
+		Expect(config.MetricsLabelConfig().Model.Enabled).To(BeTrue())
+		Expect(config.MetricsLabelConfig().Tenant.Enabled).To(BeFalse())
+
+		config.MetricsLabels = []string{"tenant", "prefiller"}
+		config.MetricsTenantHeader = "X-Tenant"
+		config.MetricsTenantAllowlist = []string{"acme"}
+		config.MetricsLabelHashBuckets = 16
+		labels := config.MetricsLabelConfig()
+		Expect(labels.Model.Enabled).To(BeFalse())
+		Expect(labels.Tenant).To(Equal(metrics.LabelOptions{Enabled: true, Allowlist: []string{"acme"}, HashBuckets: 16}))
+		Expect(labels.TenantHeader).To(Equal("X-Tenant"))
+		Expect(labels.Prefiller.Enabled).To(BeTrue())
+	})
+})
@@ -0,0 +1,118 @@
+/*
+Copyright 2025 The llm-d Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+)
+
+// decoder URL schemes
+const (
+	schemeHTTP  = "http"
+	schemeHTTPS = "https"
+	schemeUnix  = "unix"
+)
+
+// DecoderTarget returns the URL the proxy of a data parallel rank forwards the requests to:
+// the port of --decoder-url offset by the rank, or localhost on --vllm-port when not set. A
+// decoder listening on a Unix domain socket is addressed as http://localhost, the socket
+// being dialed instead, see DecoderSocket.
+func (c *Config) DecoderTarget(rank int) (*url.URL, error) {
+	if c.DecoderURL == "" {
+		scheme := schemeHTTP
+		if c.DecoderUseTLS {
+			scheme = schemeHTTPS
+		}
+		return c.offsetURL(&url.URL{Scheme: scheme, Host: net.JoinHostPort("localhost", c.VLLMPort)}, rank)
+	}
+
+	u, err := url.Parse(c.DecoderURL)
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme == schemeUnix {
+		return &url.URL{Scheme: schemeHTTP, Host: "localhost"}, nil
+	}
+	return c.offsetURL(&url.URL{Scheme: u.Scheme, Host: u.Host}, rank)
+}
+
+// DecoderSocket returns the path of the Unix domain socket the decoder listens on, if any
+func (c *Config) DecoderSocket() string {
+	u, err := url.Parse(c.DecoderURL)
+	if err != nil || u.Scheme != schemeUnix {
+		return ""
+	}
+	return u.Path
+}
+
+// decoderTLS reports whether the requests are sent to the decoder with TLS
+func (c *Config) decoderTLS() bool {
+	if c.DecoderURL == "" {
+		return c.DecoderUseTLS
+	}
+	u, err := url.Parse(c.DecoderURL)
+	return err == nil && u.Scheme == schemeHTTPS
+}
+
+// offsetURL returns the URL with its port offset by the data parallel rank
+func (c *Config) offsetURL(u *url.URL, rank int) (*url.URL, error) {
+	port, err := strconv.Atoi(u.Port())
+	if err != nil {
+		return nil, fmt.Errorf("invalid decoder port %q: %w", u.Port(), err)
+	}
+	u.Host = net.JoinHostPort(u.Hostname(), strconv.Itoa(port+rank))
+	return u, nil
+}
+
+// validateDecoder returns the problems of the decoder address
+func (c *Config) validateDecoder() []error {
+	var errs []error
+	check := func(ok bool, format string, args ...any) {
+		if !ok {
+			errs = append(errs, fmt.Errorf(format, args...))
+		}
+	}
+
+	check(validPort(c.VLLMPort), "--vllm-port must be a port number, got %q", c.VLLMPort)
+	check(c.DecoderCAFile == "" || c.decoderTLS(), "--decoder-ca-file requires --decoder-use-tls or an https --decoder-url")
+	check(c.DecoderTLSServerName == "" || c.decoderTLS(), "--decoder-tls-server-name requires --decoder-use-tls or an https --decoder-url")
+	if c.DecoderURL == "" {
+		return errs
+	}
+
+	u, err := url.Parse(c.DecoderURL)
+	if err != nil {
+		check(false, "--decoder-url is invalid: %v", err)
+		return errs
+	}
+	check(!c.DecoderUseTLS, "--decoder-use-tls does not apply to --decoder-url, use an https URL")
+	switch u.Scheme {
+	case schemeHTTP, schemeHTTPS:
+		check(u.Hostname() != "" && validPort(u.Port()) && u.Port() != "", "--decoder-url must have a host and a port, got %q", c.DecoderURL)
+		check(u.Path == "" || u.Path == "/", "--decoder-url must not have a path, got %q", c.DecoderURL)
+	case schemeUnix:
+		check(u.Path != "", "--decoder-url must have the path of the socket, got %q", c.DecoderURL)
+		check(c.DataParallelSize == 1, "--decoder-url with a Unix domain socket requires --data-parallel-size=1")
+		check(c.CanaryVLLMPort == "", "--canary-vllm-port requires a decoder listening on a TCP port")
+	default:
+		check(false, "--decoder-url must be an http, https or unix URL, got %q", c.DecoderURL)
+	}
+	return errs
+}
@@ -0,0 +1,81 @@
+/*
+Copyright 2025 The llm-d Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	. "github.com/onsi/ginkgo/v2" // nolint:revive
+	. "github.com/onsi/gomega"    // nolint:revive
+)
+
+var _ = Describe("Decoder", func() {
+	DescribeTable("should forward the ranks to their decoder",
+		func(update func(*Config), rank int, expected string) {
+			config := Defaults()
+			config.DataParallelSize = 2
+			update(&config)
+			Expect(config.Validate()).To(Succeed())
+			target, err := config.DecoderTarget(rank)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(target.String()).To(Equal(expected))
+		},
+		Entry("on the vLLM port", func(c *Config) {}, 1, "http://localhost:8002"),
+		Entry("on the vLLM port with TLS", func(c *Config) { c.DecoderUseTLS = true }, 0, "https://localhost:8001"),
+		Entry("at the decoder URL", func(c *Config) { c.DecoderURL = "https://10.0.0.5:8443" }, 1, "https://10.0.0.5:8444"),
+		Entry("at an IPv6 decoder URL", func(c *Config) { c.DecoderURL = "http://[fd00::5]:8000/" }, 1, "http://[fd00::5]:8001"),
+	)
+
+	It("should dial the socket of the decoder", func() {
+		config := Defaults()
+		config.DecoderURL = "unix:///run/vllm/vllm.sock"
+		Expect(config.Validate()).To(Succeed())
+		target, err := config.DecoderTarget(0)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(target.String()).To(Equal("http://localhost"))
+		Expect(config.ProxyConfig().DecoderSocket).To(Equal("/run/vllm/vllm.sock"))
+
+		config.DecoderURL = "http://vllm:8000"
+		Expect(config.ProxyConfig().DecoderSocket).To(BeEmpty())
+	})
+
+	DescribeTable("should reject invalid decoders",
+		func(update func(*Config), expected string) {
+			config := Defaults()
+			update(&config)
+			Expect(config.Validate()).To(MatchError(ContainSubstring(expected)))
+		},
+		Entry("unknown scheme", func(c *Config) { c.DecoderURL = "grpc://localhost:8000" }, "must be an http, https or unix URL"),
+		Entry("URL without port", func(c *Config) { c.DecoderURL = "http://vllm" }, "must have a host and a port"),
+		Entry("URL with a path", func(c *Config) { c.DecoderURL = "http://vllm:8000/v1" }, "must not have a path"),
+		Entry("URL with TLS flag", func(c *Config) {
+			c.DecoderURL = "http://vllm:8000"
+			c.DecoderUseTLS = true
+		}, "use an https URL"),
+		Entry("socket without path", func(c *Config) { c.DecoderURL = "unix://" }, "the path of the socket"),
+		Entry("socket with data parallel ranks", func(c *Config) {
+			c.DecoderURL = "unix:///run/vllm/vllm.sock"
+			c.DataParallelSize = 2
+		}, "--data-parallel-size=1"),
+		Entry("socket with canary", func(c *Config) {
+			c.DecoderURL = "unix:///run/vllm/vllm.sock"
+			c.CanaryVLLMPort = "8101"
+		}, "--canary-vllm-port"),
+		Entry("decoder CA with an http URL", func(c *Config) {
+			c.DecoderURL = "http://vllm:8000"
+			c.DecoderCAFile = "/etc/decoder/ca.crt"
+		}, "--decoder-ca-file"),
+	)
+})
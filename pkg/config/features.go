@@ -0,0 +1,152 @@
+/*
+Copyright 2025 The llm-d Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// The feature gates of the experimental behaviors, set with --feature-gates
+const (
+	// FeatureGRPCFrontend serves the completions over gRPC on --grpc-port
+	FeatureGRPCFrontend = "GRPCFrontend"
+
+	// FeatureDataParallelHedging hedges the decode-only requests to a sibling data parallel rank
+	// after --data-parallel-hedge-delay
+	FeatureDataParallelHedging = "DataParallelHedging"
+
+	// FeaturePrefillCache deduplicates the prefills of identical requests, cached by
+	// --prefill-cache-size
+	FeaturePrefillCache = "PrefillCache"
+)
+
+// The maturity of the features: the alpha features are disabled by default, the beta features
+// enabled by default. Graduated features lose their gate.
+const (
+	stageAlpha = "ALPHA"
+	stageBeta  = "BETA"
+)
+
+// featureSpec describes a feature gate
+type featureSpec struct {
+	stage string
+
+	// flag is the flag configuring the feature, ignored when the feature is disabled
+	flag string
+
+	// isSet returns whether the flag configures the feature
+	isSet func(c *Config) bool
+}
+
+// features are the known feature gates
+var features = map[string]featureSpec{
+	FeatureGRPCFrontend: {
+		stage: stageAlpha,
+		flag:  "grpc-port",
+		isSet: func(c *Config) bool { return c.GRPCPort != "" },
+	},
+	FeatureDataParallelHedging: {
+		stage: stageBeta,
+		flag:  "data-parallel-hedge-delay",
+		isSet: func(c *Config) bool { return c.DataParallelHedgeDelay > 0 },
+	},
+	FeaturePrefillCache: {
+		stage: stageBeta,
+		flag:  "prefill-cache-size",
+		isSet: func(c *Config) bool { return c.PrefillCacheSize > 0 },
+	},
+}
+
+// FeatureEnabled returns whether the given feature is enabled by --feature-gates, or by default
+func (c *Config) FeatureEnabled(feature string) bool {
+	if enabled, ok := c.FeatureGates[feature]; ok {
+		return enabled
+	}
+	return features[feature].stage == stageBeta
+}
+
+// DisabledFeatureFlags returns the flags set but ignored, since the feature they configure is
+// disabled, e.g. to warn about them
+func (c *Config) DisabledFeatureFlags() []string {
+	var flags []string
+	for _, feature := range featureNames() {
+		spec := features[feature]
+		if spec.isSet(c) && !c.FeatureEnabled(feature) {
+			flags = append(flags, spec.flag)
+		}
+	}
+	return flags
+}
+
+// featureNames returns the sorted names of the known feature gates
+func featureNames() []string {
+	names := make([]string, 0, len(features))
+	for name := range features {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// featureGatesUsage describes the --feature-gates flag, listing the known feature gates
+func featureGatesUsage() string {
+	var usage strings.Builder
+	usage.WriteString("comma-separated list of feature=true|false pairs enabling or disabling the experimental features, the flags of the disabled features being ignored. Options are:")
+	for _, name := range featureNames() {
+		stage := features[name].stage
+		fmt.Fprintf(&usage, "\n%s=true|false (%s - default=%t)", name, stage, stage == stageBeta)
+	}
+	return usage.String()
+}
+
+// featureGatesValue is a comma-separated list of feature=bool flag
+type featureGatesValue map[string]bool
+
+func (v *featureGatesValue) String() string {
+	gates := make([]string, 0, len(*v))
+	for name, enabled := range *v {
+		gates = append(gates, name+"="+strconv.FormatBool(enabled))
+	}
+	sort.Strings(gates)
+	return strings.Join(gates, ",")
+}
+
+func (v *featureGatesValue) Set(value string) error {
+	gates := make(map[string]bool)
+	for _, gate := range strings.Split(value, ",") {
+		if gate = strings.TrimSpace(gate); gate == "" {
+			continue
+		}
+		name, enabled, found := strings.Cut(gate, "=")
+		if _, ok := features[name]; !ok {
+			return fmt.Errorf("unknown feature gate %q, expected one of %s", name, strings.Join(featureNames(), ", "))
+		}
+		b, err := strconv.ParseBool(enabled)
+		if !found || err != nil {
+			return fmt.Errorf("invalid feature gate %q, expected feature=true|false", gate)
+		}
+		gates[name] = b
+	}
+	if len(gates) == 0 {
+		gates = nil
+	}
+	*v = gates
+	return nil
+}
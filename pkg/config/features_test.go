@@ -0,0 +1,79 @@
+/*
+Copyright 2025 The llm-d Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"flag"
+	"io"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2" // nolint:revive
+	. "github.com/onsi/gomega"    // nolint:revive
+)
+
+var _ = Describe("Feature gates", func() {
+	load := func(args ...string) (*Config, error) {
+		fs := flag.NewFlagSet("test", flag.ContinueOnError)
+		fs.SetOutput(io.Discard)
+		return Load(fs, args, func(string) (string, bool) { return "", false })
+	}
+
+	It("should default the features to their stage", func() {
+		config := Defaults()
+		Expect(config.FeatureEnabled(FeatureGRPCFrontend)).To(BeFalse())
+		Expect(config.FeatureEnabled(FeatureDataParallelHedging)).To(BeTrue())
+		Expect(config.FeatureEnabled(FeaturePrefillCache)).To(BeTrue())
+	})
+
+	It("should parse the feature gates", func() {
+		config, err := load("-feature-gates=GRPCFrontend=true, DataParallelHedging=false")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(config.FeatureGates).To(Equal(map[string]bool{FeatureGRPCFrontend: true, FeatureDataParallelHedging: false}))
+		Expect(config.FeatureEnabled(FeatureGRPCFrontend)).To(BeTrue())
+		Expect(config.FeatureEnabled(FeatureDataParallelHedging)).To(BeFalse())
+		Expect(config.FeatureEnabled(FeaturePrefillCache)).To(BeTrue())
+	})
+
+	DescribeTable("should reject invalid feature gates",
+		func(gates string, expected string) {
+			_, err := load("-feature-gates=" + gates)
+			Expect(err).To(MatchError(ContainSubstring(expected)))
+		},
+		Entry("unknown feature", "DecodeFirst=true", `unknown feature gate "DecodeFirst"`),
+		Entry("missing value", "GRPCFrontend", "expected feature=true|false"),
+		Entry("invalid value", "GRPCFrontend=yes", "expected feature=true|false"),
+	)
+
+	It("should ignore the flags of the disabled features", func() {
+		config := Defaults()
+		config.GRPCPort = "9000"
+		config.DataParallelHedgeDelay = time.Second
+		config.PrefillCacheSize = 16
+		Expect(config.DisabledFeatureFlags()).To(Equal([]string{"grpc-port"}))
+		Expect(config.ProxyConfig().DataParallelHedgeDelay).To(Equal(time.Second))
+		Expect(config.ProxyConfig().PrefillCacheSize).To(Equal(16))
+
+		config.FeatureGates = map[string]bool{
+			FeatureGRPCFrontend:        true,
+			FeatureDataParallelHedging: false,
+			FeaturePrefillCache:        false,
+		}
+		Expect(config.DisabledFeatureFlags()).To(Equal([]string{"data-parallel-hedge-delay", "prefill-cache-size"}))
+		Expect(config.ProxyConfig().DataParallelHedgeDelay).To(BeZero())
+		Expect(config.ProxyConfig().PrefillCacheSize).To(BeZero())
+	})
+})
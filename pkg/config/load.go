@@ -0,0 +1,395 @@
+/*
+Copyright 2025 The llm-d Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"sigs.k8s.io/yaml"
+
+	"github.com/llm-d/llm-d-routing-sidecar/internal/logging"
+)
+
+const (
+	// FileFlag is the flag of the configuration file
+	FileFlag = "config"
+
+	// EnvPrefix prefixes the environment variables setting the flags, e.g.
+	// LLM_D_ROUTING_SIDECAR_PREFILL_CACHE_SIZE sets --prefill-cache-size
+	EnvPrefix = "LLM_D_ROUTING_SIDECAR_"
+)
+
+// The sources of the settings
+const (
+	SourceDefault        = "default"
+	SourceFile           = "file"
+	SourceEnv            = "env"
+	SourceFlag           = "flag"
+	SourceServiceAccount = "service-account"
+)
+
+// Setting is the effective value of a flag and where it comes from, with the secrets masked
+type Setting struct {
+	Name    string `json:"name"`
+	Value   string `json:"value"`
+	Default string `json:"default"`
+	Source  string `json:"source"`
+}
+
+// serviceAccountNamespaceFile holds the namespace of the pod, mounted with its ServiceAccount token
+var serviceAccountNamespaceFile = "/var/run/secrets/kubernetes.io/serviceaccount/namespace"
+
+// legacyEnvVars are the environment variables the flags defaulted to before EnvPrefix
+var legacyEnvVars = map[string]string{
+	"sleep-control-token":           "SLEEP_CONTROL_TOKEN",
+	"inference-pool-namespace":      "INFERENCE_POOL_NAMESPACE",
+	"inference-pool-name":           "INFERENCE_POOL_NAME",
+	"profiling-basic-auth-user":     "PROFILING_BASIC_AUTH_USER",
+	"profiling-basic-auth-password": "PROFILING_BASIC_AUTH_PASSWORD",
+}
+
+// Load registers the configuration flags in fs, parses the command-line arguments, and returns
+// the validated configuration. The flags set on the command-line take precedence over the
+// environment variables, which take precedence over the configuration file.
+func Load(fs *flag.FlagSet, args []string, lookupEnv func(string) (string, bool)) (*Config, error) {
+	c, _, err := LoadSettings(fs, args, lookupEnv)
+	return c, err
+}
+
+// LoadSettings loads the configuration like Load, and also returns the effective settings of
+// all the flags and their sources, e.g. to diagnose the configuration drifts of a fleet
+func LoadSettings(fs *flag.FlagSet, args []string, lookupEnv func(string) (string, bool)) (*Config, []Setting, error) {
+	c := Defaults()
+	c.AddFlags(fs)
+	file := fs.String(FileFlag, "", "a YAML or JSON file of flag values, keyed by flag name, overridden by the "+EnvPrefix+"<FLAG> environment variables and the command-line flags")
+	if err := fs.Parse(args); err != nil {
+		return nil, nil, err
+	}
+
+	// flags set on the command-line, re-applied last
+	set := map[string]string{}
+	fs.Visit(func(f *flag.Flag) {
+		set[f.Name] = f.Value.String()
+	})
+	sources := map[string]string{}
+
+	if *file == "" {
+		var ok bool
+		if *file, ok = lookupEnv(envVar(FileFlag)); ok {
+			sources[FileFlag] = SourceEnv
+		}
+	}
+	if *file != "" {
+		if err := loadFile(fs, *file); err != nil {
+			return nil, nil, err
+		}
+		fs.Visit(func(f *flag.Flag) {
+			if _, ok := set[f.Name]; !ok {
+				sources[f.Name] = SourceFile
+			}
+		})
+	}
+
+	var err error
+	fs.VisitAll(func(f *flag.Flag) {
+		if err != nil || f.Name == FileFlag {
+			return
+		}
+		value, ok := lookupEnv(envVar(f.Name))
+		if !ok {
+			value, ok = lookupEnv(legacyEnvVars[f.Name])
+		}
+		if ok {
+			if setErr := fs.Set(f.Name, value); setErr != nil {
+				err = fmt.Errorf("invalid value %q for environment variable %s: %w", value, envVar(f.Name), setErr)
+			}
+			sources[f.Name] = SourceEnv
+		}
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	for name, value := range set {
+		if err := fs.Set(name, value); err != nil {
+			return nil, nil, fmt.Errorf("invalid value %q for flag -%s: %w", value, name, err)
+		}
+		sources[name] = SourceFlag
+	}
+
+	// Watch the InferencePool of the namespace of the pod by default
+	if c.EnableSSRFProtection && c.InferencePoolNamespace == "" {
+		if namespace, err := os.ReadFile(serviceAccountNamespaceFile); err == nil {
+			c.InferencePoolNamespace = strings.TrimSpace(string(namespace))
+			sources["inference-pool-namespace"] = SourceServiceAccount
+		}
+	}
+	c.setPoolDefaults()
+
+	if err := c.Validate(); err != nil {
+		return nil, nil, err
+	}
+
+	var settings []Setting
+	fs.VisitAll(func(f *flag.Flag) {
+		source, ok := sources[f.Name]
+		if !ok {
+			source = SourceDefault
+		}
+		settings = append(settings, Setting{
+			Name:    f.Name,
+			Value:   maskSecret(f.Name, f.Value.String()),
+			Default: maskSecret(f.Name, f.DefValue),
+			Source:  source,
+		})
+	})
+	return &c, settings, nil
+}
+
+// maskSecret masks the values of the secret flags, and the user information of the URLs, e.g.
+// the credentials of the OTLP endpoint
+func maskSecret(name string, value string) string {
+	if value == "" {
+		return value
+	}
+	if strings.HasSuffix(name, "-token") || strings.HasSuffix(name, "-password") {
+		return logging.Redacted
+	}
+	if u, err := url.Parse(value); err == nil && u.User != nil {
+		u.User = url.User("xxxxx") // as masked by url.URL.Redacted
+		return u.String()
+	}
+	return value
+}
+
+// envVar returns the environment variable setting the given flag
+func envVar(flagName string) string {
+	return EnvPrefix + strings.ToUpper(strings.ReplaceAll(flagName, "-", "_"))
+}
+
+// loadFile sets the flags to the values of a YAML or JSON configuration file
+func loadFile(fs *flag.FlagSet, path string) error {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read configuration file: %w", err)
+	}
+	content, err = yaml.YAMLToJSON(content)
+	if err != nil {
+		return fmt.Errorf("failed to parse configuration file %s: %w", path, err)
+	}
+
+	var values map[string]any
+	decoder := json.NewDecoder(bytes.NewReader(content))
+	decoder.UseNumber()
+	if err := decoder.Decode(&values); err != nil {
+		return fmt.Errorf("failed to parse configuration file %s: %w", path, err)
+	}
+
+	names := make([]string, 0, len(values))
+	for name := range values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if name == FileFlag || fs.Lookup(name) == nil {
+			return fmt.Errorf("unknown setting %q in configuration file %s", name, path)
+		}
+
+		var value string
+		switch v := values[name].(type) {
+		case string:
+			value = v
+		case map[string]any, []any:
+			// e.g. the prefill overrides object
+			b, err := json.Marshal(v)
+			if err != nil {
+				return err
+			}
+			value = string(b)
+		default:
+			value = fmt.Sprint(v)
+		}
+		if err := fs.Set(name, value); err != nil {
+			return fmt.Errorf("invalid value %q for %s in configuration file %s: %w", value, name, path, err)
+		}
+	}
+	return nil
+}
+
+// listValue is a comma-separated list flag, ignoring empty items
+type listValue []string
+
+func (v *listValue) String() string {
+	return strings.Join(*v, ",")
+}
+
+func (v *listValue) Set(value string) error {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	*v = items
+	return nil
+}
+
+// routesValue is a comma-separated list of model=host:port routes flag
+type routesValue map[string]string
+
+func (v *routesValue) String() string {
+	routes := make([]string, 0, len(*v))
+	for model, target := range *v {
+		routes = append(routes, model+"="+target)
+	}
+	sort.Strings(routes)
+	return strings.Join(routes, ",")
+}
+
+func (v *routesValue) Set(value string) error {
+	routes := make(map[string]string)
+	if value == "" {
+		*v = routes
+		return nil
+	}
+	for _, route := range strings.Split(value, ",") {
+		model, target, found := strings.Cut(strings.TrimSpace(route), "=")
+		if !found || model == "" || target == "" {
+			return fmt.Errorf("invalid route %q, expected model=host:port", route)
+		}
+		routes[model] = target
+	}
+	*v = routes
+	return nil
+}
+
+// aliasesValue is a comma-separated list of model=alias aliases flag
+type aliasesValue map[string]string
+
+func (v *aliasesValue) String() string {
+	return (*routesValue)(v).String()
+}
+
+func (v *aliasesValue) Set(value string) error {
+	aliases := make(map[string]string)
+	if value == "" {
+		*v = aliases
+		return nil
+	}
+	for _, entry := range strings.Split(value, ",") {
+		model, alias, found := strings.Cut(strings.TrimSpace(entry), "=")
+		if !found || model == "" || alias == "" {
+			return fmt.Errorf("invalid alias %q, expected model=alias", entry)
+		}
+		aliases[model] = alias
+	}
+	*v = aliases
+	return nil
+}
+
+// tenantModelsValue is a JSON object flag of the models listed by tenant
+type tenantModelsValue map[string][]string
+
+func (v *tenantModelsValue) String() string {
+	if *v == nil {
+		return ""
+	}
+	b, _ := json.Marshal(*v) // nolint:all
+	return string(b)
+}
+
+func (v *tenantModelsValue) Set(value string) error {
+	if value == "" {
+		*v = nil
+		return nil
+	}
+	var models map[string][]string
+	if err := json.Unmarshal([]byte(value), &models); err != nil {
+		return fmt.Errorf("must be a JSON object of model lists: %w", err)
+	}
+	if models == nil {
+		return errors.New("must be a JSON object of model lists")
+	}
+	*v = models
+	return nil
+}
+
+// quotasValue is a comma-separated list of name=limit quotas flag
+type quotasValue map[string]int
+
+func (v *quotasValue) String() string {
+	quotas := make([]string, 0, len(*v))
+	for name, limit := range *v {
+		quotas = append(quotas, name+"="+strconv.Itoa(limit))
+	}
+	sort.Strings(quotas)
+	return strings.Join(quotas, ",")
+}
+
+func (v *quotasValue) Set(value string) error {
+	quotas := make(map[string]int)
+	if value == "" {
+		*v = quotas
+		return nil
+	}
+	for _, quota := range strings.Split(value, ",") {
+		name, limit, found := strings.Cut(strings.TrimSpace(quota), "=")
+		n, err := strconv.Atoi(limit)
+		if !found || name == "" || err != nil || n <= 0 {
+			return fmt.Errorf("invalid quota %q, expected name=limit with a positive limit", quota)
+		}
+		quotas[name] = n
+	}
+	*v = quotas
+	return nil
+}
+
+// jsonObjectValue is a JSON object flag
+type jsonObjectValue map[string]any
+
+func (v *jsonObjectValue) String() string {
+	if *v == nil {
+		return ""
+	}
+	b, _ := json.Marshal(*v) // nolint:all
+	return string(b)
+}
+
+func (v *jsonObjectValue) Set(value string) error {
+	if value == "" {
+		*v = nil
+		return nil
+	}
+	var object map[string]any
+	if err := json.Unmarshal([]byte(value), &object); err != nil {
+		return fmt.Errorf("must be a JSON object: %w", err)
+	}
+	if object == nil {
+		return errors.New("must be a JSON object")
+	}
+	*v = object
+	return nil
+}
@@ -0,0 +1,150 @@
+/*
+Copyright 2025 The llm-d Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/llm-d/llm-d-routing-sidecar/internal/proxy"
+)
+
+// Pool is a virtual pool served by the sidecar on its own port besides the main pool, e.g. when
+// the decoder takes part in two InferencePools with different prefill fleets
+type Pool struct {
+	// Name names the pool in the logs and the metrics
+	Name string `json:"name"`
+	// Port is the port the pool is served on, offset by the data parallel rank
+	Port string `json:"port"`
+	// InferencePoolNamespace defaults to the namespace of the main pool
+	InferencePoolNamespace string `json:"inference-pool-namespace,omitempty"`
+	// InferencePoolName is the InferencePool allowlisting the prefillers, defaults to Name
+	InferencePoolName string `json:"inference-pool-name,omitempty"`
+	// Connector defaults to the connector of the main pool
+	Connector string `json:"connector,omitempty"`
+}
+
+// ProxyConfig returns the configuration of the proxies of the pool, from the configuration of
+// the proxies of the main pool
+func (p Pool) ProxyConfig(config proxy.Config) proxy.Config {
+	config.Pool = p.Name
+	config.InferencePoolNamespace = p.InferencePoolNamespace
+	config.InferencePoolName = p.InferencePoolName
+	if config.SSRFAllowlistSnapshot != "" {
+		config.SSRFAllowlistSnapshot += "." + p.Name
+	}
+	if config.PrefillerStatsFile != "" {
+		config.PrefillerStatsFile += "." + p.Name
+	}
+	if p.Connector != config.Connector {
+		config.Connector = p.Connector
+		config.ExperimentConnector = ""
+		config.ExperimentConnectorWeight = 0
+	}
+	return config
+}
+
+// setPoolDefaults sets the settings of the pools inherited from the main pool
+func (c *Config) setPoolDefaults() {
+	for i := range c.Pools {
+		pool := &c.Pools[i]
+		if pool.InferencePoolNamespace == "" {
+			pool.InferencePoolNamespace = c.InferencePoolNamespace
+		}
+		if pool.InferencePoolName == "" {
+			pool.InferencePoolName = pool.Name
+		}
+		if pool.Connector == "" {
+			pool.Connector = c.Connector
+		}
+	}
+}
+
+// validatePools returns the problems of the pools, which must have distinct names and ports
+func (c *Config) validatePools() []error {
+	var errs []error
+	check := func(ok bool, format string, args ...any) {
+		if !ok {
+			errs = append(errs, fmt.Errorf(format, args...))
+		}
+	}
+
+	// the pool of each port, for each data parallel rank
+	ports := map[int]string{}
+	usePorts := func(pool string, port string) {
+		p, err := strconv.Atoi(port)
+		if err != nil {
+			return
+		}
+		for rank := range c.DataParallelSize {
+			if other, ok := ports[p+rank]; ok {
+				check(false, "--pools: pool %q uses port %d of pool %q", pool, p+rank, other)
+				return
+			}
+			ports[p+rank] = pool
+		}
+	}
+	usePorts("main", c.Port)
+
+	names := map[string]bool{}
+	for _, pool := range c.Pools {
+		check(pool.Name != "" && pool.Name != "." && pool.Name != ".." && !strings.ContainsAny(pool.Name, "/ "),
+			"--pools: invalid pool name %q", pool.Name)
+		check(!names[pool.Name], "--pools: duplicate pool %q", pool.Name)
+		names[pool.Name] = true
+		check(validPort(pool.Port), "--pools: the port of pool %q must be a port number, got %q", pool.Name, pool.Port)
+		usePorts(pool.Name, pool.Port)
+		check(pool.Connector == proxy.ConnectorNIXLV1 || pool.Connector == proxy.ConnectorNIXLV2 || pool.Connector == proxy.ConnectorLMCache,
+			"--pools: the connector of pool %q must either be 'nixl', 'nixlv2' or 'lmcache'", pool.Name)
+		check(!c.EnableSSRFProtection || pool.InferencePoolNamespace != "",
+			"--pools: the InferencePool namespace of pool %q is required when --enable-ssrf-protection is true", pool.Name)
+	}
+	return errs
+}
+
+// poolsValue is a JSON array of pools flag
+type poolsValue []Pool
+
+func (v *poolsValue) String() string {
+	if len(*v) == 0 {
+		return ""
+	}
+	b, _ := json.Marshal(*v) // nolint:all
+	return string(b)
+}
+
+func (v *poolsValue) Set(value string) error {
+	if value == "" {
+		*v = nil
+		return nil
+	}
+	var pools []Pool
+	decoder := json.NewDecoder(bytes.NewReader([]byte(value)))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&pools); err != nil {
+		return fmt.Errorf("must be a JSON array of pools: %w", err)
+	}
+	if pools == nil {
+		return errors.New("must be a JSON array of pools")
+	}
+	*v = pools
+	return nil
+}
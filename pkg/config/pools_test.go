@@ -0,0 +1,83 @@
+/*
+Copyright 2025 The llm-d Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"flag"
+	"io"
+
+	"github.com/llm-d/llm-d-routing-sidecar/internal/proxy"
+	. "github.com/onsi/ginkgo/v2" // nolint:revive
+	. "github.com/onsi/gomega"    // nolint:revive
+)
+
+var _ = Describe("Pools", func() {
+	load := func(args ...string) (*Config, error) {
+		fs := flag.NewFlagSet("test", flag.ContinueOnError)
+		fs.SetOutput(io.Discard)
+		return Load(fs, args, func(string) (string, bool) { return "", false })
+	}
+
+	It("should default the pools to the main pool", func() {
+		config, err := load("-connector=nixlv2", "-inference-pool-namespace=llm", "-inference-pool-name=pool-a",
+			`-pools=[{"name": "pool-b", "port": "8100"}, {"name": "pool-c", "port": "8200", "inference-pool-name": "fleet-c", "connector": "lmcache"}]`)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(config.Pools).To(Equal([]Pool{
+			{Name: "pool-b", Port: "8100", InferencePoolNamespace: "llm", InferencePoolName: "pool-b", Connector: proxy.ConnectorNIXLV2},
+			{Name: "pool-c", Port: "8200", InferencePoolNamespace: "llm", InferencePoolName: "fleet-c", Connector: proxy.ConnectorLMCache},
+		}))
+	})
+
+	It("should override the configuration of the main pool", func() {
+		main := proxy.Config{
+			Connector:              proxy.ConnectorNIXLV2,
+			ExperimentConnector:    proxy.ConnectorLMCache,
+			InferencePoolNamespace: "llm",
+			InferencePoolName:      "pool-a",
+			SSRFAllowlistSnapshot:  "/var/run/allowlist.json",
+			PrefillerStatsFile:     "/var/run/prefillers.json",
+		}
+		pool := Pool{Name: "pool-b", Port: "8100", InferencePoolNamespace: "llm", InferencePoolName: "fleet-b", Connector: proxy.ConnectorNIXLV2}
+
+		config := pool.ProxyConfig(main)
+		Expect(config.Pool).To(Equal("pool-b"))
+		Expect(config.InferencePoolName).To(Equal("fleet-b"))
+		Expect(config.SSRFAllowlistSnapshot).To(Equal("/var/run/allowlist.json.pool-b"))
+		Expect(config.PrefillerStatsFile).To(Equal("/var/run/prefillers.json.pool-b"))
+		Expect(config.ExperimentConnector).To(Equal(proxy.ConnectorLMCache))
+
+		pool.Connector = proxy.ConnectorLMCache
+		config = pool.ProxyConfig(main)
+		Expect(config.Connector).To(Equal(proxy.ConnectorLMCache))
+		Expect(config.ExperimentConnector).To(BeEmpty())
+	})
+
+	DescribeTable("should reject invalid pools",
+		func(pools string, expected string) {
+			_, err := load("-data-parallel-size=2", "-pools="+pools)
+			Expect(err).To(MatchError(ContainSubstring(expected)))
+		},
+		Entry("unknown field", `[{"name": "pool-b", "port": "8100", "namespace": "llm"}]`, "unknown field"),
+		Entry("missing name", `[{"port": "8100"}]`, "invalid pool name"),
+		Entry("name with a slash", `[{"name": "a/b", "port": "8100"}]`, "invalid pool name"),
+		Entry("duplicate name", `[{"name": "pool-b", "port": "8100"}, {"name": "pool-b", "port": "8200"}]`, "duplicate pool"),
+		Entry("invalid port", `[{"name": "pool-b", "port": "http"}]`, "must be a port number"),
+		Entry("port of a main rank", `[{"name": "pool-b", "port": "8001"}]`, `uses port 8001 of pool "main"`),
+		Entry("overlapping ranks", `[{"name": "pool-b", "port": "8100"}, {"name": "pool-c", "port": "8099"}]`, `uses port 8100 of pool "pool-b"`),
+		Entry("unknown connector", `[{"name": "pool-b", "port": "8100", "connector": "mooncake"}]`, "the connector of pool"),
+	)
+})
@@ -0,0 +1,104 @@
+/*
+Copyright 2025 The llm-d Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package middleware lets downstream distributions hook custom logic (authentication,
+// accounting, request transformations) into the routing sidecar without forking it.
+//
+// A middleware is registered from an init function, and linked into the sidecar binary with
+// a blank import in its main package:
+//
+//	func init() {
+//		middleware.Register(&tenantTagger{})
+//	}
+package middleware
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Middleware hooks into the stages of the request handling. Embed Base to only implement
+// some of the hooks.
+type Middleware interface {
+	// Name identifies the middleware in the logs
+	Name() string
+
+	// PreRouting runs on each request before it is routed. Headers can be added or removed.
+	PreRouting(r *http.Request) error
+
+	// PrePrefill runs on each completion request sent to a prefiller, with the decoded body.
+	// The body is shared with the decode stage.
+	PrePrefill(r *http.Request, body map[string]any) error
+
+	// PreDecode runs on each completion request sent to the decoder, with the decoded body,
+	// whether it was prefilled remotely or not
+	PreDecode(r *http.Request, body map[string]any) error
+
+	// PostResponse runs after the response is sent, with its status code and latency
+	PostResponse(r *http.Request, statusCode int, duration time.Duration)
+}
+
+// Base implements all the hooks of Middleware as no-ops
+type Base struct{}
+
+// PreRouting does nothing
+func (Base) PreRouting(*http.Request) error { return nil }
+
+// PrePrefill does nothing
+func (Base) PrePrefill(*http.Request, map[string]any) error { return nil }
+
+// PreDecode does nothing
+func (Base) PreDecode(*http.Request, map[string]any) error { return nil }
+
+// PostResponse does nothing
+func (Base) PostResponse(*http.Request, int, time.Duration) {}
+
+// Error is returned by a hook to answer the request with the given status code, e.g. 401
+// for failed authentication. Other errors answer 500.
+type Error struct {
+	StatusCode int
+	Message    string
+}
+
+// NewError returns an error answering the request with the given status code and message
+func NewError(statusCode int, message string) *Error {
+	return &Error{StatusCode: statusCode, Message: message}
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%d: %s", e.StatusCode, e.Message)
+}
+
+var (
+	registryMu sync.Mutex
+	registry   []Middleware
+)
+
+// Register adds a middleware to the sidecar. The hooks run in the registration order.
+func Register(m Middleware) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	registry = append(registry, m)
+}
+
+// Registered returns the registered middlewares, in the registration order
+func Registered() []Middleware {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	return append([]Middleware(nil), registry...)
+}
@@ -0,0 +1,208 @@
+/*
+Copyright 2025 The llm-d Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package proxy embeds the llm-d routing proxy in-process, so other llm-d components and
+// tests can run the router without exec-ing the sidecar binary:
+//
+//	p, err := proxy.New(decoderURL, proxy.WithConfig(proxy.Config{Connector: proxy.ConnectorNIXLV2}))
+//	if err != nil {
+//		return err
+//	}
+//	if err := p.Start(ctx); err != nil {
+//		return err
+//	}
+//	defer p.Stop(context.Background())
+package proxy
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/url"
+	"sync"
+
+	"github.com/go-logr/logr"
+	"k8s.io/klog/v2"
+
+	"github.com/llm-d/llm-d-routing-sidecar/internal/proxy"
+)
+
+// Config is the configuration of the routing proxy
+type Config = proxy.Config
+
+// The P/D protocols the proxy can follow
+const (
+	ConnectorNIXLV1  = proxy.ConnectorNIXLV1
+	ConnectorNIXLV2  = proxy.ConnectorNIXLV2
+	ConnectorLMCache = proxy.ConnectorLMCache
+)
+
+// DefaultPort is the port the proxy listens on, unless a listener is injected
+const DefaultPort = "8000"
+
+// Option customizes a Proxy
+type Option func(*Proxy)
+
+// WithConfig sets the configuration of the proxy. The listener and transports set by the other
+// options take precedence over those of the configuration.
+func WithConfig(config Config) Option {
+	return func(p *Proxy) {
+		p.config = config
+	}
+}
+
+// WithPort sets the port the proxy listens on
+func WithPort(port string) Option {
+	return func(p *Proxy) {
+		p.port = port
+	}
+}
+
+// WithListener serves the proxy on the given listener instead of listening on its port
+func WithListener(ln net.Listener) Option {
+	return func(p *Proxy) {
+		p.listener = ln
+	}
+}
+
+// WithLogger sets the logger of the proxy, instead of the one of the Start context
+func WithLogger(logger logr.Logger) Option {
+	return func(p *Proxy) {
+		p.logger = &logger
+	}
+}
+
+// WithDecoderTransport sends the requests to the decoder with the given transport
+func WithDecoderTransport(transport http.RoundTripper) Option {
+	return func(p *Proxy) {
+		p.decoderTransport = transport
+	}
+}
+
+// WithPrefillerTransport sends the requests to the prefillers with the given transport
+func WithPrefillerTransport(transport http.RoundTripper) Option {
+	return func(p *Proxy) {
+		p.prefillerTransport = transport
+	}
+}
+
+// Proxy is a routing proxy running in-process
+type Proxy struct {
+	config             Config
+	port               string
+	listener           net.Listener
+	logger             *logr.Logger
+	decoderTransport   http.RoundTripper
+	prefillerTransport http.RoundTripper
+
+	server *proxy.Server
+
+	mu       sync.Mutex
+	started  bool
+	cancelFn context.CancelFunc
+	done     chan struct{} // closed when the proxy stopped serving
+	err      error         // the error the proxy stopped serving with
+}
+
+// New creates a routing proxy forwarding requests to the given decoder. The proxy listens on
+// its port right away, so Addr is known before it starts serving.
+func New(decoderURL *url.URL, opts ...Option) (*Proxy, error) {
+	p := &Proxy{
+		port: DefaultPort,
+		done: make(chan struct{}),
+	}
+	for _, opt := range opts {
+		opt(p)
+	}
+
+	if p.listener == nil {
+		ln, err := net.Listen("tcp", ":"+p.port)
+		if err != nil {
+			return nil, err
+		}
+		p.listener = ln
+	}
+
+	config := p.config
+	config.Listener = p.listener
+	if p.decoderTransport != nil {
+		config.DecoderTransport = p.decoderTransport
+	}
+	if p.prefillerTransport != nil {
+		config.PrefillerTransport = p.prefillerTransport
+	}
+
+	server, err := proxy.NewProxy(p.port, decoderURL, config)
+	if err != nil {
+		p.listener.Close() //nolint:all
+		return nil, err
+	}
+	p.server = server
+	return p, nil
+}
+
+// Addr returns the address the proxy listens on
+func (p *Proxy) Addr() net.Addr {
+	return p.listener.Addr()
+}
+
+// Start serves the proxy in the background, until ctx is canceled or Stop is called. A proxy
+// can only be started once.
+func (p *Proxy) Start(ctx context.Context) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.started {
+		return errors.New("proxy already started")
+	}
+	p.started = true
+
+	if p.logger != nil {
+		ctx = klog.NewContext(ctx, *p.logger)
+	}
+	ctx, p.cancelFn = context.WithCancel(ctx)
+	go func() {
+		defer close(p.done)
+		p.err = p.server.Start(ctx)
+	}()
+	return nil
+}
+
+// Wait blocks until the proxy stopped serving, and returns the error it stopped with
+func (p *Proxy) Wait() error {
+	<-p.done
+	return p.err
+}
+
+// Stop gracefully stops the proxy, waiting for the in-flight requests until ctx is done
+func (p *Proxy) Stop(ctx context.Context) error {
+	p.mu.Lock()
+	if !p.started {
+		p.started = true
+		close(p.done)
+		p.mu.Unlock()
+		return p.listener.Close()
+	}
+	p.cancelFn()
+	p.mu.Unlock()
+
+	select {
+	case <-p.done:
+		return p.err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
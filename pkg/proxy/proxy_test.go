@@ -0,0 +1,137 @@
+/*
+Copyright 2025 The llm-d Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package proxy
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync/atomic"
+
+	"github.com/llm-d/llm-d-routing-sidecar/test/mock"
+	. "github.com/onsi/ginkgo/v2" // nolint:revive
+	. "github.com/onsi/gomega"    // nolint:revive
+	"k8s.io/klog/v2/ktesting"
+)
+
+// countingTransport counts the requests sent with the default transport
+type countingTransport struct {
+	count atomic.Int32
+}
+
+func (t *countingTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	t.count.Add(1)
+	return http.DefaultTransport.RoundTrip(r)
+}
+
+var _ = Describe("Embedded proxy", func() {
+	var (
+		decodeHandler  *mock.ChatCompletionHandler
+		prefillHandler *mock.ChatCompletionHandler
+		prefillHost    string
+		decodeURL      *url.URL
+	)
+
+	BeforeEach(func() {
+		decodeHandler = &mock.ChatCompletionHandler{Connector: ConnectorNIXLV2, Role: mock.RoleDecode}
+		decodeBackend := httptest.NewServer(decodeHandler)
+		DeferCleanup(decodeBackend.Close)
+
+		prefillHandler = &mock.ChatCompletionHandler{Connector: ConnectorNIXLV2, Role: mock.RolePrefill}
+		prefillBackend := httptest.NewServer(prefillHandler)
+		DeferCleanup(prefillBackend.Close)
+		prefillHost = prefillBackend.URL[len("http://"):]
+
+		var err error
+		decodeURL, err = url.Parse(decodeBackend.URL)
+		Expect(err).ToNot(HaveOccurred())
+	})
+
+	sendRequest := func(addr net.Addr, prefiller string) int {
+		body := `{"model": "llama", "prompt": "Hello", "max_tokens": 10}`
+		req, err := http.NewRequest(http.MethodPost, "http://"+addr.String()+"/v1/completions", strings.NewReader(body))
+		Expect(err).ToNot(HaveOccurred())
+		if prefiller != "" {
+			req.Header.Add("x-prefiller-host-port", prefiller)
+		}
+
+		resp, err := http.DefaultClient.Do(req)
+		Expect(err).ToNot(HaveOccurred())
+		resp.Body.Close() //nolint:all
+		return resp.StatusCode
+	}
+
+	It("should serve on an injected listener with custom transports", func() {
+		ln, err := net.Listen("tcp", "127.0.0.1:0")
+		Expect(err).ToNot(HaveOccurred())
+		decoderTransport := &countingTransport{}
+		prefillerTransport := &countingTransport{}
+
+		p, err := New(decodeURL,
+			WithConfig(Config{Connector: ConnectorNIXLV2}),
+			WithListener(ln),
+			WithLogger(ktesting.NewLogger(GinkgoT(), ktesting.NewConfig())),
+			WithDecoderTransport(decoderTransport),
+			WithPrefillerTransport(prefillerTransport))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(p.Addr()).To(Equal(ln.Addr()))
+
+		Expect(p.Start(context.Background())).To(Succeed())
+		Expect(p.Start(context.Background())).ToNot(Succeed())
+
+		Expect(sendRequest(p.Addr(), prefillHost)).To(Equal(http.StatusOK))
+		Expect(prefillHandler.RequestCount.Load()).To(BeNumerically("==", 1))
+		Expect(decodeHandler.RequestCount.Load()).To(BeNumerically("==", 1))
+		Expect(prefillerTransport.count.Load()).To(BeNumerically("==", 1))
+		Expect(decoderTransport.count.Load()).To(BeNumerically("==", 1))
+
+		Expect(p.Stop(context.Background())).To(Succeed())
+		Expect(p.Wait()).To(Succeed())
+		_, err = net.Dial("tcp", ln.Addr().String())
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("should stop when its context is canceled", func() {
+		p, err := New(decodeURL, WithPort("0"))
+		Expect(err).ToNot(HaveOccurred())
+
+		ctx, cancelFn := context.WithCancel(context.Background())
+		Expect(p.Start(ctx)).To(Succeed())
+		Expect(sendRequest(p.Addr(), "")).To(Equal(http.StatusOK))
+
+		cancelFn()
+		Expect(p.Wait()).To(Succeed())
+	})
+
+	It("should release the listener of a proxy never started", func() {
+		p, err := New(decodeURL, WithPort("0"))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(p.Stop(context.Background())).To(Succeed())
+		Expect(p.Wait()).To(Succeed())
+		Expect(p.Start(context.Background())).ToNot(Succeed())
+	})
+
+	It("should reject invalid configurations", func() {
+		ln, err := net.Listen("tcp", "127.0.0.1:0")
+		Expect(err).ToNot(HaveOccurred())
+		_, err = New(decodeURL, WithListener(ln), WithConfig(Config{EnableSleepMode: true}))
+		Expect(err).To(HaveOccurred())
+	})
+})